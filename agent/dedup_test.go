@@ -0,0 +1,85 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"testing"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+)
+
+// TestIsDuplicate ensures that only a job ID that was already received is a duplicate
+func TestIsDuplicate(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"", false},
+		{"", false},
+		{"dedup-1", false},
+		{"dedup-2", false},
+		{"dedup-1", true},
+		{"dedup-2", true},
+		{"dedup-3", false},
+	}
+	for i, test := range tests {
+		if got := isDuplicate(test.id); got != test.want {
+			t.Errorf("%d %q: expected %t but received %t", i, test.id, test.want, got)
+		}
+	}
+}
+
+// TestIsDuplicateForgets ensures that the oldest job ID is forgotten once more than maxSeenJobs IDs were received
+func TestIsDuplicateForgets(t *testing.T) {
+	for i := 0; i <= maxSeenJobs; i++ {
+		isDuplicate(fmt.Sprintf("forget-%d", i))
+	}
+	if !isDuplicate(fmt.Sprintf("forget-%d", maxSeenJobs)) {
+		t.Error("expected the newest job ID to be a duplicate")
+	}
+	if isDuplicate("forget-0") {
+		t.Error("expected the oldest job ID to be forgotten")
+	}
+}
+
+// TestRequeue ensures that outgoing jobs from a failed check in are returned as they are at the next check in, even
+// when a job with the same ID was already received
+func TestRequeue(t *testing.T) {
+	returned := []jobs.Job{
+		{ID: "requeue-1", Type: jobs.FILETRANSFER, Payload: jobs.FileTransfer{FileLocation: "part001"}},
+		{ID: "requeue-2", Type: jobs.RESULT, Payload: jobs.Results{Stdout: "output"}},
+	}
+	isDuplicate("requeue-1")
+	requeue(returned)
+	msg := getJobs()
+	payload, ok := msg.Payload.([]jobs.Job)
+	if !ok || len(payload) != len(returned) {
+		t.Fatalf("expected %d jobs but received %+v", len(returned), msg.Payload)
+	}
+	for i, job := range payload {
+		if job.ID != returned[i].ID || job.Type != returned[i].Type {
+			t.Errorf("expected %s job %s but received %s job %s", jobs.String(returned[i].Type), returned[i].ID, jobs.String(job.Type), job.ID)
+		}
+	}
+	if msg = getJobs(); msg.Payload != nil {
+		t.Errorf("expected the requeued jobs to be returned once but received %+v", msg.Payload)
+	}
+}
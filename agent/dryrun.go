@@ -0,0 +1,111 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/commands"
+)
+
+// dryrun is the state of the dry run mode where high-risk jobs are described instead of executed
+type dryrun struct {
+	enabled bool // enabled is true while high-risk jobs are simulated
+	locked  bool // locked is true when the agent was built or started in dry run mode and it can't be turned off
+}
+
+// dryrunJobs are the high-risk jobs that are simulated in dry run mode: injection, dumping, and persistence
+var dryrunJobs = func() map[string]bool {
+	names := map[string]bool{"persistence": true}
+	for _, group := range []string{"inject", "dump"} {
+		for _, name := range policyGroups[group] {
+			names[name] = true
+		}
+	}
+	return names
+}()
+
+// simulated returns true if the job is simulated instead of executed. Listing the persistence methods or the installed
+// persistence changes nothing and is executed
+func (d dryrun) simulated(job jobs.Job) bool {
+	if !d.enabled || job.Type == jobs.CONTROL || !dryrunJobs[policyName(job)] {
+		return false
+	}
+	if cmd, ok := job.Payload.(jobs.Command); ok && policyName(job) == "persistence" && len(cmd.Args) > 0 {
+		switch strings.ToLower(cmd.Args[0]) {
+		case "methods", "list":
+			return false
+		}
+	}
+	return true
+}
+
+// simulate returns the actions the job would have taken and the artifacts it would have created
+func simulate(job jobs.Job) jobs.Results {
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Simulating %s job %s in dry run mode", policyName(job), job.ID))
+	}
+	switch payload := job.Payload.(type) {
+	case jobs.Command:
+		return commands.Simulate(payload)
+	case jobs.Shellcode:
+		return commands.SimulateShellcode(payload)
+	}
+	return jobs.Results{Stderr: fmt.Sprintf("the %s job can't be simulated", policyName(job))}
+}
+
+// String returns the dry run mode's state
+func (d dryrun) String() string {
+	switch {
+	case d.locked:
+		return "on (built in)"
+	case d.enabled:
+		return "on"
+	}
+	return "off"
+}
+
+// dryrunControl reports or sets the dry run mode. A dry run mode the agent was built or started with can't be turned
+// off so a purple team agent can never be tasked into executing the jobs it was only meant to describe
+// dryrun [on|off]
+func (a *Agent) dryrunControl(args []string) (results jobs.Results) {
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "on", "true":
+			a.dryrun.enabled = true
+		case "off", "false":
+			if a.dryrun.locked {
+				results.Stderr = "the agent was built in dry run mode and it can't be turned off"
+				return
+			}
+			a.dryrun.enabled = false
+		default:
+			results.Stderr = fmt.Sprintf("unknown dry run mode: %s, use on or off", args[0])
+			return
+		}
+	}
+	results.Stdout = fmt.Sprintf("Dry Run: %s", a.dryrun)
+	return
+}
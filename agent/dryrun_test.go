@@ -0,0 +1,60 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"testing"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+)
+
+// TestDryrunSimulated ensures that only high-risk jobs are simulated, and only while dry run mode is enabled
+func TestDryrunSimulated(t *testing.T) {
+	module := func(command string, args ...string) jobs.Job {
+		return jobs.Job{Type: jobs.MODULE, Payload: jobs.Command{Command: command, Args: args}}
+	}
+	tests := []struct {
+		name string
+		job  jobs.Job
+		want bool
+	}{
+		{"shellcode", jobs.Job{Type: jobs.SHELLCODE, Payload: jobs.Shellcode{Method: "self"}}, true},
+		{"createprocess", module("CreateProcess"), true},
+		{"minidump", module("minidump"), true},
+		{"procdump", module("procdump", "1234"), true},
+		{"memory readproc", module("memory", "readproc", "1234", "0x1000", "16"), true},
+		{"memory search", module("memory", "search", "1234", "password"), true},
+		{"persistence install", module("persistence", "install", "auto", "name"), true},
+		{"persistence list", module("persistence", "list"), false},
+		{"persistence methods", module("persistence", "methods"), false},
+		{"ls", jobs.Job{Type: jobs.NATIVE, Payload: jobs.Command{Command: "ls"}}, false},
+		{"run", jobs.Job{Type: jobs.CMD, Payload: jobs.Command{Command: "/usr/bin/id"}}, false},
+		{"control", jobs.Job{Type: jobs.CONTROL, Payload: jobs.Command{Command: "minidump"}}, false},
+	}
+	enabled := dryrun{enabled: true}
+	for _, test := range tests {
+		if got := enabled.simulated(test.job); got != test.want {
+			t.Errorf("%s: expected simulated %t but received %t", test.name, test.want, got)
+		}
+		if (dryrun{}).simulated(test.job) {
+			t.Errorf("%s: expected the job to be executed when dry run mode is off", test.name)
+		}
+	}
+}
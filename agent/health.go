@@ -0,0 +1,288 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+const (
+	// healthWindow is the number of most recent check ins a transport's health is scored on
+	healthWindow = 20
+	// healthMinimum is the number of check ins a transport needs before a low score, rather than failures, shifts traffic
+	healthMinimum = 5
+	// unscored is the score of a transport that has not been used yet
+	unscored = 50
+)
+
+// checkIn is the outcome of a single check in over a transport
+type checkIn struct {
+	latency time.Duration
+	ok      bool
+}
+
+// transport is the recent check in history of a communication profile
+type transport struct {
+	history []checkIn // history is the most recent check ins, oldest first
+	failed  int       // failed is the number of consecutive failed check ins
+}
+
+// health scores each communication profile the agent has used on its latency, error rate, and jitter, and shifts
+// traffic to a healthier profile when the one in use degrades
+type health struct {
+	transports map[string]*transport // transports are keyed by profile name, empty for the build configuration
+	failures   int                   // failures is the consecutive failed check ins that shift traffic, 0 disables failover
+	score      int                   // score is the lowest health score tolerated, 0 only shifts traffic on failures
+}
+
+// parseFailover parses when the agent shifts traffic to a healthier communication profile as
+// <consecutive failures>[,<minimum score>]. An empty value or off only scores the transports
+func parseFailover(value string) (*health, error) {
+	h := &health{transports: make(map[string]*transport)}
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, "off") {
+		return h, nil
+	}
+	failures, score, _ := strings.Cut(value, ",")
+	var err error
+	if h.failures, err = strconv.Atoi(strings.TrimSpace(failures)); err != nil || h.failures < 1 {
+		return h, fmt.Errorf("%s is not a valid number of consecutive failed check ins", failures)
+	}
+	if score = strings.TrimSpace(score); score != "" {
+		if h.score, err = strconv.Atoi(score); err != nil || h.score < 0 || h.score > 100 {
+			h.failures = 0
+			return h, fmt.Errorf("%s is not a health score between 0 and 100", score)
+		}
+	}
+	return h, nil
+}
+
+// String returns when the agent shifts traffic to a healthier communication profile
+func (h *health) String() string {
+	if h.failures == 0 {
+		return "disabled"
+	}
+	if h.score == 0 {
+		return fmt.Sprintf("after %d consecutive failed check ins", h.failures)
+	}
+	return fmt.Sprintf("after %d consecutive failed check ins or below a score of %d", h.failures, h.score)
+}
+
+// record adds the outcome of a check in over the named communication profile
+func (h *health) record(name string, latency time.Duration, err error) {
+	if h == nil {
+		return
+	}
+	t, ok := h.transports[name]
+	if !ok {
+		t = &transport{}
+		h.transports[name] = t
+	}
+	t.history = append(t.history, checkIn{latency: latency, ok: err == nil})
+	if len(t.history) > healthWindow {
+		t.history = t.history[len(t.history)-healthWindow:]
+	}
+	if err != nil {
+		t.failed++
+	} else {
+		t.failed = 0
+	}
+}
+
+// stats returns the transport's mean latency and jitter, the mean difference between consecutive latencies, of the
+// successful check ins and the fraction of check ins that failed
+func (t *transport) stats() (latency, jitter time.Duration, errorRate float64) {
+	if t == nil || len(t.history) == 0 {
+		return
+	}
+	var ok int
+	var last time.Duration
+	for _, c := range t.history {
+		if !c.ok {
+			continue
+		}
+		if ok > 0 {
+			diff := c.latency - last
+			if diff < 0 {
+				diff = -diff
+			}
+			jitter += diff
+		}
+		latency += c.latency
+		last = c.latency
+		ok++
+	}
+	if ok > 0 {
+		latency /= time.Duration(ok)
+	}
+	if ok > 1 {
+		jitter /= time.Duration(ok - 1)
+	}
+	errorRate = float64(len(t.history)-ok) / float64(len(t.history))
+	return
+}
+
+// score rates the transport from 0 to 100. Failed check ins cost the most, then latency up to 25 points at 2.5
+// seconds, then jitter up to 15 points at 1.5 seconds
+func (t *transport) score() int {
+	if t == nil || len(t.history) == 0 {
+		return unscored
+	}
+	latency, jitter, errorRate := t.stats()
+	score := 100 * (1 - errorRate)
+	score -= minFloat(25, latency.Seconds()*10)
+	score -= minFloat(15, jitter.Seconds()*10)
+	if score < 0 {
+		return 0
+	}
+	return int(score)
+}
+
+// minFloat returns the smaller of the two numbers
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// transportName returns the name of the communication profile for display
+func transportName(name string) string {
+	if name == "" {
+		return "(build configuration)"
+	}
+	return name
+}
+
+// report returns the health of every transport the agent has used, one per line
+func (h *health) report(current string) (report string) {
+	names := make([]string, 0, len(h.transports))
+	for name := range h.transports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := h.transports[name]
+		latency, jitter, errorRate := t.stats()
+		var marker string
+		if name == current {
+			marker = " (current)"
+		}
+		report += fmt.Sprintf("Transport %s%s: score %d, latency %s, jitter %s, error rate %.0f%%, %d check ins, %d consecutive failures\n",
+			transportName(name), marker, t.score(), latency.Round(time.Millisecond), jitter.Round(time.Millisecond), errorRate*100, len(t.history), t.failed)
+	}
+	return
+}
+
+// failover shifts traffic to the healthiest other communication profile when the one in use has failed the configured
+// number of consecutive check ins, never more than MaxRetry allows, or its score dropped below the minimum. The failed
+// check in count is kept so the agent still quits after MaxRetry when no transport can reach the server
+func (a *Agent) failover() {
+	h := a.health
+	if h == nil || h.failures == 0 || len(a.profiles) == 0 {
+		return
+	}
+	current := h.transports[a.profile]
+	if current == nil {
+		return
+	}
+	limit := h.failures
+	if a.MaxRetry > 1 && limit >= a.MaxRetry {
+		limit = a.MaxRetry - 1
+	}
+	degraded := current.failed >= limit
+	if !degraded && h.score > 0 && len(current.history) >= healthMinimum && current.score() < h.score {
+		degraded = true
+	}
+	if !degraded {
+		return
+	}
+
+	var names []string
+	for name := range a.profiles {
+		if name != a.profile {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	best, bestScore := "", -1
+	for _, name := range names {
+		if score := h.transports[name].score(); score > bestScore {
+			best, bestScore = name, score
+		}
+	}
+	if best == "" || bestScore <= current.score() {
+		return
+	}
+
+	reason := fmt.Sprintf("%s scored %d with %d consecutive failed check ins", transportName(a.profile), current.score(), current.failed)
+	failed := a.FailedCheckin
+	if err := a.setProfile(best); err != nil {
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error shifting traffic to the %s profile: %s", best, err))
+		}
+		return
+	}
+	a.FailedCheckin = failed
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Transport health shifted traffic to the %s profile because %s", best, reason))
+	}
+	jobsOut <- jobs.Job{
+		AgentID: a.ID,
+		Type:    jobs.RESULT,
+		Payload: jobs.Results{Stdout: fmt.Sprintf("Transport health at %s shifted traffic to the %s profile, scored %d, because %s", time.Now().UTC().Format(time.RFC3339), best, bestScore, reason)},
+	}
+}
+
+// healthControl returns the health of the transports the agent has used or changes when traffic is shifted
+// health
+// health failover <consecutive failures>[,<minimum score>]|off
+func (a *Agent) healthControl(args []string) (results jobs.Results) {
+	if a.health == nil {
+		a.health, _ = parseFailover("")
+	}
+	if len(args) > 0 {
+		if strings.ToLower(args[0]) != "failover" || len(args) < 2 {
+			results.Stderr = "the health command only accepts failover <consecutive failures>[,<minimum score>] or failover off"
+			return
+		}
+		h, err := parseFailover(strings.Join(args[1:], ","))
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		a.health.failures, a.health.score = h.failures, h.score
+	}
+	results.Stdout = fmt.Sprintf("Transport Failover: %s\n", a.health)
+	if a.health.failures > 0 && len(a.profiles) == 0 {
+		results.Stdout += "The agent was not built with any communication profiles to shift traffic to\n"
+	}
+	results.Stdout += a.health.report(a.profile)
+	return
+}
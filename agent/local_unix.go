@@ -0,0 +1,73 @@
+//go:build !windows
+// +build !windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+// socketListener is a Unix domain socket only the agent's user can connect to
+type socketListener struct {
+	net.Listener
+	path string
+}
+
+// listenLocal creates the Unix domain socket with permissions that only allow the agent's user to connect. An existing
+// socket left behind by a previous agent is replaced, but any other file at the path is not
+func listenLocal(path string) (localListener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s already exists and is not a Unix domain socket", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, fmt.Errorf("there was an error removing the existing socket %s: %s", path, err)
+		}
+	}
+	// The umask keeps other users from connecting before the socket's permissions are restricted
+	mask := syscall.Umask(0077)
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(mask)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error listening on the Unix domain socket %s: %s", path, err)
+	}
+	if err = os.Chmod(path, 0600); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("there was an error restricting the permissions of %s: %s", path, err)
+	}
+	return &socketListener{Listener: listener, path: path}, nil
+}
+
+// Accept waits for a local tool to connect to the socket
+func (l *socketListener) Accept() (io.ReadWriteCloser, error) {
+	return l.Listener.Accept()
+}
+
+// Close stops listening and removes the socket file
+func (l *socketListener) Close() error {
+	err := l.Listener.Close()
+	_ = os.Remove(l.path)
+	return err
+}
@@ -0,0 +1,167 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/kernel32"
+)
+
+// pipeListener creates a new instance of the named pipe for each local tool that connects
+type pipeListener struct {
+	sync.Mutex
+	name   string
+	sa     *windows.SecurityAttributes
+	next   windows.Handle // next is the instance created, but not yet connected, when the listener started
+	closed bool
+}
+
+// pipeConn is a connected instance of the named pipe
+type pipeConn struct {
+	*os.File
+	handle windows.Handle
+}
+
+// listenLocal creates the first instance of the named pipe, failing if another process already created it, with a
+// DACL that only grants the agent's user access and rejects remote clients
+func listenLocal(path string) (localListener, error) {
+	name := path
+	if !strings.HasPrefix(strings.ToLower(name), `\\.\pipe\`) {
+		name = `\\.\pipe\` + name
+	}
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return nil, fmt.Errorf("there was an error getting the agent's user: %s", err)
+	}
+	sd, err := windows.SecurityDescriptorFromString(fmt.Sprintf("D:P(A;;GA;;;%s)", user.User.Sid))
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating the named pipe's security descriptor: %s", err)
+	}
+	sa := &windows.SecurityAttributes{SecurityDescriptor: sd}
+	sa.Length = uint32(unsafe.Sizeof(*sa))
+
+	l := &pipeListener{name: name, sa: sa}
+	l.next, err = l.create(windows.FILE_FLAG_FIRST_PIPE_INSTANCE)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// create makes a new synchronous instance of the named pipe
+func (l *pipeListener) create(flags uint32) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(l.name)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+	handle, err := windows.CreateNamedPipe(
+		name,
+		windows.PIPE_ACCESS_DUPLEX|flags,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT|windows.PIPE_REJECT_REMOTE_CLIENTS,
+		windows.PIPE_UNLIMITED_INSTANCES,
+		4096,
+		4096,
+		0,
+		l.sa,
+	)
+	if err != nil {
+		return windows.InvalidHandle, fmt.Errorf("there was an error calling kernel32!CreateNamedPipeW for %s: %s", l.name, err)
+	}
+	return handle, nil
+}
+
+// Accept waits for a local tool to connect to an instance of the named pipe
+func (l *pipeListener) Accept() (io.ReadWriteCloser, error) {
+	l.Lock()
+	if l.closed {
+		l.Unlock()
+		return nil, os.ErrClosed
+	}
+	handle := l.next
+	l.next = 0
+	l.Unlock()
+
+	var err error
+	if handle == 0 {
+		if handle, err = l.create(0); err != nil {
+			return nil, err
+		}
+	}
+	err = windows.ConnectNamedPipe(handle, nil)
+	if err != nil && err != windows.ERROR_PIPE_CONNECTED {
+		_ = windows.CloseHandle(handle)
+		return nil, fmt.Errorf("there was an error calling kernel32!ConnectNamedPipe: %s", err)
+	}
+	l.Lock()
+	closed := l.closed
+	l.Unlock()
+	if closed {
+		_ = windows.CloseHandle(handle)
+		return nil, os.ErrClosed
+	}
+	return &pipeConn{File: os.NewFile(uintptr(handle), l.name), handle: handle}, nil
+}
+
+// Close stops accepting connections. Connecting to the pipe releases an Accept that is blocked waiting for a client
+func (l *pipeListener) Close() error {
+	l.Lock()
+	if l.closed {
+		l.Unlock()
+		return nil
+	}
+	l.closed = true
+	if l.next != 0 {
+		// Accept has not taken the first instance yet so it is not blocked
+		_ = windows.CloseHandle(l.next)
+		l.next = 0
+		l.Unlock()
+		return nil
+	}
+	l.Unlock()
+
+	name, err := windows.UTF16PtrFromString(l.name)
+	if err != nil {
+		return err
+	}
+	client, err := windows.CreateFile(name, windows.GENERIC_READ, 0, nil, windows.OPEN_EXISTING, 0, 0)
+	if err == nil {
+		_ = windows.CloseHandle(client)
+	}
+	return nil
+}
+
+// Close flushes what was written to the local tool and disconnects it before closing the pipe instance
+func (c *pipeConn) Close() error {
+	_ = windows.FlushFileBuffers(c.handle)
+	_ = kernel32.DisconnectNamedPipe(c.handle)
+	return c.File.Close()
+}
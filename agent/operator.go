@@ -0,0 +1,68 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"strings"
+	"sync"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+)
+
+// operators are the operators that tasked the jobs that have not finished, keyed by job ID
+var operators sync.Map
+
+// attribute records that the job was tasked by the operator set for the message being handled, if any
+func (a *Agent) attribute(job jobs.Job) {
+	if a.operator != "" && job.ID != "" {
+		operators.Store(job.ID, a.operator)
+	}
+}
+
+// operatorOf returns the operator that tasked the job, empty if the server did not identify one
+func operatorOf(id string) string {
+	if operator, ok := operators.Load(id); ok {
+		return operator.(string)
+	}
+	return ""
+}
+
+// attributed prefixes the job's text results with the operator that tasked it, if the server identified one
+func attributed(id string, results jobs.Results) jobs.Results {
+	if operator := operatorOf(id); operator != "" {
+		results.Stdout = fmt.Sprintf("Tasked by %s\n%s", operator, results.Stdout)
+	}
+	return results
+}
+
+// operatorControl attributes the jobs that follow it in the same message from the server to an operator. Jobs are
+// Merlin server structures the agent can't add an operator to, so a server running a team engagement sends this
+// control before each operator's jobs
+// operator <id>
+func (a *Agent) operatorControl(args []string) (results jobs.Results) {
+	if len(args) < 1 {
+		results.Stderr = "the operator control requires an operator identifier"
+		return
+	}
+	a.operator = strings.Join(args, " ")
+	results.Stdout = fmt.Sprintf("The following jobs are attributed to operator %s", a.operator)
+	return
+}
@@ -0,0 +1,128 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+)
+
+// policyGroups are named sets of jobs a policy allows or denies together
+var policyGroups = map[string][]string{
+	"recon":   {"activity", "authcontext", "cd", "container", "crawl", "download", "env", "handles", "history", "ifconfig", "logonmon", "modules", "ls", "netstat", "nslookup", "pipes", "procmon", "ps", "ptree", "pwd", "shares", "software", "sshgraph", "staging", "uptime", "watch"},
+	"execute": {"run", "runas", "shell"},
+	"inject":  {"clr", "createprocess", "memfd", "memory", "shellcode"},
+	"dump":    {"dcsync", "disk", "hashdump", "memory", "minidump", "ntds", "procdump"},
+}
+
+// policy restricts the jobs the agent executes. It is compiled into the agent and can't be changed by a control
+type policy struct {
+	source string          // source is the policy as it was configured
+	allow  map[string]bool // allow are the jobs that are executed, every job when nil
+	deny   map[string]bool // deny are the jobs that are never executed
+}
+
+// parsePolicy parses a comma separated list of the jobs, or groups of jobs, the agent executes. A job prefixed with !
+// is denied, and a policy with only denied jobs allows every other job (e.g., recon,upload or all,!inject,!dump).
+// Jobs are named the way the Merlin server's CLI names them and controls are always executed
+func parsePolicy(value string) (*policy, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	p := &policy{source: value, allow: make(map[string]bool), deny: make(map[string]bool)}
+	var all bool
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		names := p.allow
+		if strings.HasPrefix(entry, "!") {
+			entry = strings.TrimSpace(entry[1:])
+			names = p.deny
+			if entry == "all" {
+				return nil, fmt.Errorf("the job policy %q can't deny all jobs", value)
+			}
+		}
+		switch {
+		case entry == "":
+			return nil, fmt.Errorf("the job policy %q has an empty entry", value)
+		case entry == "all":
+			all = true
+		case policyGroups[entry] != nil:
+			for _, name := range policyGroups[entry] {
+				names[name] = true
+			}
+		default:
+			names[entry] = true
+		}
+	}
+	// Without any allowed jobs only the denied jobs restrict the policy
+	if all || len(p.allow) == 0 {
+		p.allow = nil
+	}
+	return p, nil
+}
+
+// allowed returns an error if the policy does not allow the job to execute. Only the jobs the server sends for the
+// agent to execute are checked; controls are always executed and SOCKS data is not a job the agent executes
+func (p *policy) allowed(job jobs.Job) error {
+	if p == nil {
+		return nil
+	}
+	switch job.Type {
+	case jobs.FILETRANSFER, jobs.CMD, jobs.MODULE, jobs.SHELLCODE, jobs.NATIVE:
+	default:
+		return nil
+	}
+	name := policyName(job)
+	if p.deny[name] || (p.allow != nil && !p.allow[name]) {
+		return fmt.Errorf("the %s job is not allowed by the agent's job policy", name)
+	}
+	return nil
+}
+
+// String returns the policy as it was configured
+func (p *policy) String() string {
+	if p == nil {
+		return "all"
+	}
+	return p.source
+}
+
+// policyName returns the name of the job the way the Merlin server's CLI names it. A command job other than shell is
+// the program the run and exec commands execute, and a file transfer the agent downloads from the server is the
+// operator's upload
+func policyName(job jobs.Job) string {
+	switch payload := job.Payload.(type) {
+	case jobs.Command:
+		if job.Type == jobs.CMD && payload.Command != "shell" {
+			return "run"
+		}
+		return strings.ToLower(payload.Command)
+	case jobs.FileTransfer:
+		if payload.IsDownload {
+			return "upload"
+		}
+		return "download"
+	case jobs.Shellcode:
+		return "shellcode"
+	}
+	return strings.ToLower(jobs.String(job.Type))
+}
@@ -0,0 +1,123 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"testing"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+)
+
+// TestParsePolicy ensures that job policies are parsed into the jobs they allow and deny
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		allowed []string
+		denied  []string
+		hasErr  bool
+	}{
+		{"group and job", "recon,upload", []string{"ls", "ps", "upload"}, []string{"run", "minidump", "dcsync"}, false},
+		{"deny only", "!inject,!dump", []string{"ls", "run", "upload"}, []string{"shellcode", "minidump", "memory"}, false},
+		{"all with denials", "all, !execute", []string{"ls", "minidump"}, []string{"run", "shell", "runas"}, false},
+		{"case and spaces", " Recon , !PS ", []string{"ls"}, []string{"ps", "run"}, false},
+		{"empty entry", "recon,,upload", nil, nil, true},
+		{"deny all", "!all", nil, nil, true},
+		{"empty deny", "recon,!", nil, nil, true},
+	}
+	for _, test := range tests {
+		p, err := parsePolicy(test.policy)
+		if test.hasErr {
+			if err == nil {
+				t.Errorf("%s: expected an error but received none", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		for _, name := range test.allowed {
+			if err = p.allowed(jobs.Job{Type: jobs.MODULE, Payload: jobs.Command{Command: name}}); err != nil {
+				t.Errorf("%s: expected %s to be allowed: %s", test.name, name, err)
+			}
+		}
+		for _, name := range test.denied {
+			if p.allowed(jobs.Job{Type: jobs.MODULE, Payload: jobs.Command{Command: name}}) == nil {
+				t.Errorf("%s: expected %s to be denied", test.name, name)
+			}
+		}
+	}
+	if p, err := parsePolicy(" "); p != nil || err != nil {
+		t.Errorf("expected no policy for an empty value but received %v, %v", p, err)
+	}
+}
+
+// TestPolicyAllowed ensures that the policy names jobs the way the Merlin server's CLI does and only checks the jobs
+// the server sends for the agent to execute
+func TestPolicyAllowed(t *testing.T) {
+	p, err := parsePolicy("recon,upload,!ls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		job   jobs.Job
+		allow bool
+	}{
+		{"control", jobs.Job{Type: jobs.CONTROL, Payload: jobs.Command{Command: "sleep"}}, true},
+		{"result", jobs.Job{Type: jobs.RESULT, Payload: jobs.Results{}}, true},
+		{"agentinfo", jobs.Job{Type: jobs.AGENTINFO}, true},
+		{"socks", jobs.Job{Type: jobs.SOCKS, Payload: jobs.Socks{}}, true},
+		{"upload", jobs.Job{Type: jobs.FILETRANSFER, Payload: jobs.FileTransfer{IsDownload: true}}, true},
+		{"download", jobs.Job{Type: jobs.FILETRANSFER, Payload: jobs.FileTransfer{}}, true},
+		{"denied module", jobs.Job{Type: jobs.NATIVE, Payload: jobs.Command{Command: "ls"}}, false},
+		{"run", jobs.Job{Type: jobs.CMD, Payload: jobs.Command{Command: "/usr/bin/id"}}, false},
+		{"shell", jobs.Job{Type: jobs.CMD, Payload: jobs.Command{Command: "shell", Args: []string{"id"}}}, false},
+		{"shellcode", jobs.Job{Type: jobs.SHELLCODE, Payload: jobs.Shellcode{Method: "self"}}, false},
+	}
+	for _, test := range tests {
+		if err = p.allowed(test.job); (err == nil) != test.allow {
+			t.Errorf("%s: expected allowed %t but received %v", test.name, test.allow, err)
+		}
+	}
+}
+
+// TestPolicyName ensures that command jobs other than shell are named run
+func TestPolicyName(t *testing.T) {
+	tests := []struct {
+		job  jobs.Job
+		want string
+	}{
+		{jobs.Job{Type: jobs.CMD, Payload: jobs.Command{Command: "/usr/bin/id"}}, "run"},
+		{jobs.Job{Type: jobs.CMD, Payload: jobs.Command{Command: "C:\\Windows\\System32\\whoami.exe"}}, "run"},
+		{jobs.Job{Type: jobs.CMD, Payload: jobs.Command{Command: "shell"}}, "shell"},
+		{jobs.Job{Type: jobs.MODULE, Payload: jobs.Command{Command: "MiniDump"}}, "minidump"},
+		{jobs.Job{Type: jobs.NATIVE, Payload: jobs.Command{Command: "ls"}}, "ls"},
+		{jobs.Job{Type: jobs.FILETRANSFER, Payload: jobs.FileTransfer{IsDownload: true}}, "upload"},
+		{jobs.Job{Type: jobs.FILETRANSFER, Payload: jobs.FileTransfer{}}, "download"},
+		{jobs.Job{Type: jobs.SHELLCODE, Payload: jobs.Shellcode{}}, "shellcode"},
+	}
+	for _, test := range tests {
+		if got := policyName(test.job); got != test.want {
+			t.Errorf("expected %s but received %s for %+v", test.want, got, test.job.Payload)
+		}
+	}
+}
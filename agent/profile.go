@@ -0,0 +1,196 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// profile is a complete communication profile compiled into the agent that an operator can switch to by name
+type profile struct {
+	name     string
+	settings [][2]string // settings are the profile's flag names and values in the order they were given
+}
+
+// parseProfiles parses the profiles compiled into the agent. Each profile starts with -profile <name> followed by the
+// agent's command line flags that make up the profile
+// (e.g., -profile phase2 -url https://cdn.example.com/ -proto h2 -sleep 1h -profile phase3 -url ...)
+func parseProfiles(config string) (map[string]profile, error) {
+	if strings.TrimSpace(config) == "" {
+		return nil, nil
+	}
+	args, err := splitProfiles(config)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make(map[string]profile)
+	var current string
+	for i := 0; i < len(args); i += 2 {
+		if !strings.HasPrefix(args[i], "-") {
+			return nil, fmt.Errorf("expected a flag in the communication profiles but received %s", args[i])
+		}
+		if i+1 >= len(args) {
+			return nil, fmt.Errorf("the %s flag in the communication profiles does not have a value", args[i])
+		}
+		key, value := strings.ToLower(strings.TrimLeft(args[i], "-")), args[i+1]
+		if key == "profile" {
+			if _, ok := profiles[value]; ok {
+				return nil, fmt.Errorf("the %s communication profile is defined more than once", value)
+			}
+			current = value
+			profiles[current] = profile{name: current}
+			continue
+		}
+		if current == "" {
+			return nil, fmt.Errorf("the communication profiles must start with -profile <name>")
+		}
+		p := profiles[current]
+		p.settings = append(p.settings, [2]string{key, value})
+		profiles[current] = p
+	}
+	return profiles, nil
+}
+
+// splitProfiles splits the profiles into words on white space outside of single or double quotes. Backslashes are
+// kept as is because the headers and useragents settings use \n to separate their values
+func splitProfiles(config string) (words []string, err error) {
+	var word strings.Builder
+	var quote rune
+	var inWord bool
+	for _, r := range config {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("the communication profiles have an unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return
+}
+
+// setProfile switches the agent to the named communication profile. The sleep, skew, and maxretry settings are
+// applied by the agent and the rest are passed to the client, which rejects the profile without changing anything if
+// a setting is invalid
+func (a *Agent) setProfile(name string) error {
+	p, ok := a.profiles[name]
+	if !ok {
+		return fmt.Errorf("%s is not a communication profile compiled into the agent", name)
+	}
+
+	waitTime, skew, maxRetry := a.WaitTime, a.Skew, a.MaxRetry
+	var transport []string
+	var err error
+	for _, setting := range p.settings {
+		switch setting[0] {
+		case "sleep":
+			if waitTime, err = time.ParseDuration(setting[1]); err != nil || waitTime < 0 {
+				return fmt.Errorf("the %s profile's sleep is not a duration greater than or equal to zero: %s", name, setting[1])
+			}
+		case "skew":
+			if skew, err = strconv.ParseInt(setting[1], 10, 64); err != nil {
+				return fmt.Errorf("there was an error converting the %s profile's skew to an integer: %s", name, err)
+			}
+		case "maxretry":
+			if maxRetry, err = strconv.Atoi(setting[1]); err != nil {
+				return fmt.Errorf("there was an error converting the %s profile's max retry to an integer: %s", name, err)
+			}
+		default:
+			if strings.Contains(setting[1], "\n") {
+				return fmt.Errorf("the %s profile's %s setting can't contain a new line", name, setting[0])
+			}
+			transport = append(transport, setting[0]+"="+setting[1])
+		}
+	}
+	if len(transport) > 0 {
+		if err = a.Client.Set("profile", strings.Join(transport, "\n")); err != nil {
+			return fmt.Errorf("there was an error switching the client to the %s profile: %s", name, err)
+		}
+	}
+	a.WaitTime, a.Skew, a.MaxRetry = waitTime, skew, maxRetry
+	a.profile = name
+	// Failures to reach the previous infrastructure don't count against the new one
+	a.FailedCheckin = 0
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Switched to the %s communication profile", name))
+	}
+	return nil
+}
+
+// profileControl lists the communication profiles compiled into the agent or, with a name, switches to one
+// profile
+// profile <name>
+func (a *Agent) profileControl(args []string) (results jobs.Results) {
+	if len(args) > 0 {
+		if err := a.setProfile(args[0]); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+	}
+	if len(a.profiles) == 0 {
+		results.Stdout = "the agent was not built with any communication profiles"
+		return
+	}
+	current := a.profile
+	if current == "" {
+		current = "(build configuration)"
+	}
+	results.Stdout = fmt.Sprintf("Current Profile: %s\n", current)
+	var names []string
+	for name := range a.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var settings []string
+		for _, setting := range a.profiles[name].settings {
+			settings = append(settings, fmt.Sprintf("-%s \"%s\"", setting[0], setting[1]))
+		}
+		results.Stdout += fmt.Sprintf("  %s: %s\n", name, strings.Join(settings, " "))
+	}
+	return
+}
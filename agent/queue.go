@@ -0,0 +1,188 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// queued is a job that was received from the server but has not started executing
+type queued struct {
+	job      jobs.Job
+	received time.Time
+}
+
+// queue holds received jobs until they are dispatched to execute so that operators can review and flush them
+var queue = struct {
+	sync.Mutex
+	pending []queued // Jobs waiting to execute, in the order they were received
+	active  int      // The number of dispatched jobs that have not finished
+	limit   int      // The maximum number of jobs that execute at once, 0 is unlimited
+	held    bool     // When true, received jobs wait in the queue until they are released
+}{}
+
+// enqueue adds a received job to the end of the queue; it is not executed until dispatch is called
+func enqueue(job jobs.Job) {
+	queue.Lock()
+	queue.pending = append(queue.pending, queued{job: job, received: time.Now()})
+	queue.Unlock()
+}
+
+// dispatch moves jobs from the front of the queue to the executor while the queue is not held and the concurrency
+// limit has not been reached
+func dispatch() {
+	queue.Lock()
+	defer queue.Unlock()
+	for len(queue.pending) > 0 && !queue.held && (queue.limit <= 0 || queue.active < queue.limit) {
+		job := queue.pending[0].job
+		queue.pending = queue.pending[1:]
+		queue.active++
+		jobsIn <- job
+	}
+}
+
+// finished records that a dispatched job completed and dispatches the next queued job
+func finished() {
+	queue.Lock()
+	queue.active--
+	queue.Unlock()
+	dispatch()
+}
+
+// queueLength returns the number of received jobs that have not started executing
+func queueLength() int {
+	queue.Lock()
+	defer queue.Unlock()
+	return len(queue.pending)
+}
+
+// flush removes queued jobs, all of them when no IDs are provided, and returns a result for each one so the server
+// does not wait on jobs that will never execute
+func (a *Agent) flush(ids []string) (count int) {
+	remove := make(map[string]bool)
+	for _, id := range ids {
+		remove[id] = true
+	}
+	queue.Lock()
+	var keep []queued
+	var flushed []queued
+	for _, q := range queue.pending {
+		if len(ids) == 0 || remove[q.job.ID] {
+			flushed = append(flushed, q)
+		} else {
+			keep = append(keep, q)
+		}
+	}
+	queue.pending = keep
+	queue.Unlock()
+
+	for _, q := range flushed {
+		jobsOut <- jobs.Job{
+			AgentID: a.ID,
+			ID:      q.job.ID,
+			Token:   q.job.Token,
+			Type:    jobs.RESULT,
+			Payload: attributed(q.job.ID, jobs.Results{Stderr: fmt.Sprintf("the %s job was flushed from the agent's queue before it executed", jobName(q.job))}),
+		}
+		operators.Delete(q.job.ID)
+	}
+	return len(flushed)
+}
+
+// listQueue returns the state of the job queue and the jobs waiting to execute
+func listQueue() string {
+	queue.Lock()
+	defer queue.Unlock()
+	limit := "unlimited"
+	if queue.limit > 0 {
+		limit = strconv.Itoa(queue.limit)
+	}
+	state := "released"
+	if queue.held {
+		state = "held"
+	}
+	list := fmt.Sprintf("Queue: %s, Running Jobs: %d, Concurrency Limit: %s, Queued Jobs: %d", state, queue.active, limit, len(queue.pending))
+	for _, q := range queue.pending {
+		list += fmt.Sprintf("\n%s\t%s\t%s ago\t%s", q.job.ID, jobs.String(q.job.Type), time.Since(q.received).Round(time.Second), jobName(q.job))
+	}
+	return list
+}
+
+// jobQueue handles the queue control to list, flush, hold, release, or limit jobs waiting to execute
+func (a *Agent) jobQueue(args []string) (results jobs.Results) {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	switch strings.ToLower(args[0]) {
+	case "list":
+	case "flush":
+		count := a.flush(args[1:])
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Flushed %d jobs from the queue", count))
+		}
+		results.Stdout = fmt.Sprintf("Flushed %d jobs from the queue\n", count)
+	case "hold":
+		queue.Lock()
+		queue.held = true
+		queue.Unlock()
+		if cli.Enabled {
+			cli.Message(cli.NOTE, "Holding received jobs in the queue")
+		}
+	case "release":
+		queue.Lock()
+		queue.held = false
+		queue.Unlock()
+		if cli.Enabled {
+			cli.Message(cli.NOTE, "Releasing queued jobs to execute")
+		}
+		dispatch()
+	case "limit":
+		if len(args) < 2 {
+			results.Stderr = "the queue limit control requires the maximum number of jobs to execute at once"
+			return
+		}
+		limit, err := strconv.Atoi(args[1])
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error converting the queue limit to an integer:\r\n%s", err)
+			return
+		}
+		queue.Lock()
+		queue.limit = limit
+		queue.Unlock()
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Setting the job concurrency limit to %d", limit))
+		}
+		dispatch()
+	default:
+		results.Stderr = fmt.Sprintf("%s is not a valid queue control, use list, flush [id...], hold, release, or limit <n>", args[0])
+		return
+	}
+	results.Stdout += listQueue()
+	return
+}
@@ -0,0 +1,128 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+)
+
+// limiter is a token bucket that limits the number of results returned to the server so a burst of results, such as
+// the events from a directory walk, is spread over multiple check ins instead of being sent at once
+type limiter struct {
+	rate   float64   // rate is the number of results per minute the bucket refills with
+	burst  float64   // burst is the most results that can be returned at once
+	tokens float64   // tokens is the number of results that can be returned now
+	last   time.Time // last is when the bucket was last refilled
+}
+
+// outbound holds the results rate limiter and the results it held back, which are returned first at the next check in
+var outbound = struct {
+	sync.Mutex
+	limiter *limiter
+	held    []jobs.Job
+	retry   []jobs.Job // retry are jobs that were packaged into a message that failed to send
+}{}
+
+// parseRateLimit parses the results per minute and, optionally, the burst size as <rate>[,<burst>]. The burst
+// defaults to the rate
+func parseRateLimit(value string) (*limiter, error) {
+	if value == "" || strings.EqualFold(value, "off") {
+		return nil, nil
+	}
+	rate, burst, _ := strings.Cut(value, ",")
+	l := &limiter{}
+	var err error
+	if l.rate, err = strconv.ParseFloat(strings.TrimSpace(rate), 64); err != nil || l.rate <= 0 {
+		return nil, fmt.Errorf("%s is not a valid number of results per minute", rate)
+	}
+	l.burst = l.rate
+	if burst = strings.TrimSpace(burst); burst != "" {
+		if l.burst, err = strconv.ParseFloat(burst, 64); err != nil || l.burst < 1 {
+			return nil, fmt.Errorf("%s is not a valid burst size", burst)
+		}
+	}
+	l.tokens = l.burst
+	l.last = time.Now()
+	return l, nil
+}
+
+// allow refills the bucket for the time since it was last refilled and takes a token for a result if one is available
+func (l *limiter) allow() bool {
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Minutes() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// String returns the rate and burst size
+func (l *limiter) String() string {
+	if l == nil {
+		return "off"
+	}
+	return fmt.Sprintf("%s results per minute, burst %s", strconv.FormatFloat(l.rate, 'f', -1, 64), strconv.FormatFloat(l.burst, 'f', -1, 64))
+}
+
+// limited returns true if the rate limiter holds the job back. SOCKS traffic is never held back because the
+// connection it belongs to would stall
+func limited(job jobs.Job) bool {
+	if outbound.limiter == nil || job.Type == jobs.SOCKS {
+		return false
+	}
+	return !outbound.limiter.allow()
+}
+
+// heldResults returns the number of results the rate limiter is holding back
+func heldResults() int {
+	outbound.Lock()
+	defer outbound.Unlock()
+	return len(outbound.held)
+}
+
+// rateLimitControl returns or changes the limit on the number of results returned to the server
+// ratelimit
+// ratelimit <results per minute> [burst]
+// ratelimit off
+func rateLimitControl(args []string) (results jobs.Results) {
+	outbound.Lock()
+	defer outbound.Unlock()
+	if len(args) > 0 {
+		l, err := parseRateLimit(strings.Join(args, ","))
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		outbound.limiter = l
+	}
+	results.Stdout = fmt.Sprintf("Result Rate Limit: %s\nHeld Results: %d", outbound.limiter, len(outbound.held))
+	return
+}
@@ -0,0 +1,156 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// runtimeControl tunes the Go runtime's garbage collector, memory limit, and processor count on a live agent, which
+// keeps the agent's memory and thread footprint inconspicuous on small appliances and VDI hosts
+// runtime [gc <percent|off>] [memlimit <size|off>] [maxprocs <count>] [free]
+func (a *Agent) runtimeControl(args []string) (results jobs.Results) {
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "gc":
+			if len(args) < 2 {
+				results.Stderr = "the runtime gc command requires a percentage or off"
+				return
+			}
+			percent := -1
+			if strings.ToLower(args[1]) != "off" {
+				var err error
+				percent, err = strconv.Atoi(args[1])
+				if err != nil || percent < 1 {
+					results.Stderr = fmt.Sprintf("%s is not a valid garbage collection percentage", args[1])
+					return
+				}
+			}
+			debug.SetGCPercent(percent)
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Setting the Go garbage collection target to %s", args[1]))
+			}
+		case "memlimit":
+			if len(args) < 2 {
+				results.Stderr = "the runtime memlimit command requires a size or off"
+				return
+			}
+			limit := int64(math.MaxInt64)
+			if strings.ToLower(args[1]) != "off" {
+				var err error
+				limit, err = parseMemorySize(args[1])
+				if err != nil {
+					results.Stderr = err.Error()
+					return
+				}
+			}
+			debug.SetMemoryLimit(limit)
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Setting the Go memory limit to %s", args[1]))
+			}
+		case "maxprocs":
+			if len(args) < 2 {
+				results.Stderr = "the runtime maxprocs command requires a processor count"
+				return
+			}
+			procs, err := strconv.Atoi(args[1])
+			if err != nil || procs < 1 {
+				results.Stderr = fmt.Sprintf("%s is not a valid processor count", args[1])
+				return
+			}
+			runtime.GOMAXPROCS(procs)
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Setting GOMAXPROCS to %d", procs))
+			}
+		case "free":
+			before := residentMemory()
+			debug.FreeOSMemory()
+			results.Stdout = fmt.Sprintf("Returned %d bytes to the operating system\n", before-residentMemory())
+		default:
+			results.Stderr = fmt.Sprintf("unknown runtime command: %s", args[0])
+			return
+		}
+	}
+	results.Stdout += runtimeStatus()
+	return
+}
+
+// runtimeStatus returns the Go runtime's tuning and memory footprint
+func runtimeStatus() string {
+	// SetGCPercent returns the previous setting, so it is set twice to read it
+	percent := debug.SetGCPercent(100)
+	debug.SetGCPercent(percent)
+	gc := "off"
+	if percent >= 0 {
+		gc = fmt.Sprintf("%d%%", percent)
+	}
+	// A negative limit reads the current one without changing it
+	limit := "off"
+	if current := debug.SetMemoryLimit(-1); current != math.MaxInt64 {
+		limit = fmt.Sprintf("%d bytes", current)
+	}
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return fmt.Sprintf("GC Target: %s, Memory Limit: %s, GOMAXPROCS: %d of %d CPUs\n"+
+		"Heap In Use: %d bytes, Obtained From OS: %d bytes, Returned To OS: %d bytes, GC Cycles: %d, Goroutines: %d",
+		gc, limit, runtime.GOMAXPROCS(0), runtime.NumCPU(),
+		stats.HeapInuse, stats.Sys, stats.HeapReleased, stats.NumGC, runtime.NumGoroutine())
+}
+
+// residentMemory returns how many bytes the Go runtime holds from the operating system and has not released
+func residentMemory() int64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return int64(stats.Sys - stats.HeapReleased)
+}
+
+// parseMemorySize parses a size in bytes or with a KB, MB, or GB (or KiB, MiB, GiB) suffix, which are all powers of 1024
+func parseMemorySize(size string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for i, suffix := range []string{"K", "M", "G"} {
+		for _, unit := range []string{suffix + "IB", suffix + "B", suffix} {
+			if strings.HasSuffix(value, unit) {
+				value = strings.TrimSuffix(value, unit)
+				multiplier = 1 << (10 * (i + 1))
+				break
+			}
+		}
+		if multiplier > 1 {
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(value), "B"), 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s is not a valid memory size, use bytes or a KB, MB, or GB suffix", size)
+	}
+	return n * multiplier, nil
+}
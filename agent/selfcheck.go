@@ -0,0 +1,162 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"fmt"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	merlinOS "github.com/Ne0nd0g/merlin-agent/os"
+)
+
+// selfcheck periodically checks whether a debugger or memory scanner is inspecting the agent's process
+type selfcheck struct {
+	interval time.Duration   // interval is the least amount of time between checks
+	action   string          // action is report, or what the agent does when it is burned: dormant, profile:<name>, exit, or uninstall
+	checked  time.Time       // checked is when the agent was last checked
+	found    map[string]bool // found are the inspections seen by the last check so that ongoing ones are reported once
+}
+
+// parseSelfcheck parses how often the agent checks itself and, optionally, the burn action taken when it is being
+// inspected as <interval>[,<action>]. The default action is report, which only returns the inspections to the server
+func parseSelfcheck(value string) (*selfcheck, error) {
+	if value == "" {
+		return nil, nil
+	}
+	interval, action, _ := strings.Cut(value, ",")
+	s := &selfcheck{action: "report"}
+	var err error
+	if s.interval, err = time.ParseDuration(strings.TrimSpace(interval)); err != nil || s.interval <= 0 {
+		return nil, fmt.Errorf("%s is not a valid self-check interval (e.g., 5m)", interval)
+	}
+	if action = strings.TrimSpace(action); action != "" && !strings.EqualFold(action, "report") {
+		if s.action, err = parseBurnAction(action); err != nil {
+			return nil, fmt.Errorf("%s is not a self-check action, use report, dormant, profile:<name>, exit, or uninstall", action)
+		}
+	}
+	return s, nil
+}
+
+// String returns how often the agent checks itself and the action taken when it is being inspected
+func (s *selfcheck) String() string {
+	if s == nil {
+		return "disabled"
+	}
+	return fmt.Sprintf("every %s, action %s", s.interval, s.action)
+}
+
+// inspect returns the debuggers and memory scanners inspecting the agent. A check that fails without finding anything
+// is treated as finding nothing
+func (s *selfcheck) inspect() (found []string) {
+	s.checked = time.Now()
+	inspections, err := merlinOS.Inspections()
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, err.Error())
+		}
+	}
+	for _, inspection := range inspections {
+		found = append(found, inspection.String())
+	}
+	return
+}
+
+// checkSelf checks, at most once every self-check interval, whether the agent is being inspected. New inspections
+// are returned to the server and, unless the action is report, the burn action is applied. It returns how long the
+// agent goes dormant for, if that is the action
+func (a *Agent) checkSelf() (dormant time.Duration) {
+	if a.selfcheck == nil || time.Since(a.selfcheck.checked) < a.selfcheck.interval {
+		return
+	}
+	found := a.selfcheck.inspect()
+	var added []string
+	current := make(map[string]bool)
+	for _, inspection := range found {
+		current[inspection] = true
+		if !a.selfcheck.found[inspection] {
+			added = append(added, inspection)
+		}
+	}
+	a.selfcheck.found = current
+	if len(found) == 0 {
+		return
+	}
+	reason := "the agent is being inspected: " + strings.Join(found, "; ")
+	if cli.Enabled {
+		cli.Message(cli.WARN, reason)
+	}
+	if a.selfcheck.action != "report" {
+		return a.burn(a.selfcheck.action, reason)
+	}
+	if len(added) > 0 {
+		jobsOut <- jobs.Job{
+			AgentID: a.ID,
+			Type:    jobs.RESULT,
+			Payload: jobs.Results{Stdout: fmt.Sprintf("Self-check at %s found the agent is being inspected:\n%s", a.selfcheck.checked.UTC().Format(time.RFC3339), strings.Join(added, "\n"))},
+		}
+	}
+	return
+}
+
+// selfcheckControl runs a self-check or returns or changes the periodic self-check configuration
+// selfcheck
+// selfcheck run
+// selfcheck set <interval> [report|dormant|profile:<name>|exit|uninstall]
+// selfcheck off
+func (a *Agent) selfcheckControl(args []string) (results jobs.Results) {
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "run":
+			// A one-off check only reports, the burn action is left to the periodic check
+			found := (&selfcheck{}).inspect()
+			if len(found) == 0 {
+				results.Stdout = "The agent is not being inspected\n"
+			} else {
+				results.Stdout = fmt.Sprintf("The agent is being inspected:\n%s\n", strings.Join(found, "\n"))
+			}
+		case "set":
+			if len(args) < 2 {
+				results.Stderr = "the selfcheck set command requires an interval"
+				return
+			}
+			s, err := parseSelfcheck(strings.Join(args[1:], ","))
+			if err != nil {
+				results.Stderr = err.Error()
+				return
+			}
+			a.selfcheck = s
+		case "off":
+			a.selfcheck = nil
+		default:
+			results.Stderr = fmt.Sprintf("unknown selfcheck command: %s", args[0])
+			return
+		}
+	}
+	results.Stdout += fmt.Sprintf("Self-Check: %s", a.selfcheck)
+	if a.selfcheck != nil && !a.selfcheck.checked.IsZero() {
+		results.Stdout += fmt.Sprintf("\nLast Checked: %s", a.selfcheck.checked.UTC().Format(time.RFC3339))
+	}
+	return
+}
@@ -0,0 +1,236 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package agent
+
+import (
+	// Standard
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// X Packages
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// knockWindow is how long a source has to complete the port-knock sequence
+const knockWindow = 10 * time.Second
+
+// trigger is a wake listener that is only armed while the agent is sleeping and ends the sleep early, at most once,
+// so that an agent with a long sleep can be made to check in on demand
+type trigger struct {
+	kind   string // kind is the type of trigger: udp, icmp, or knock
+	ports  []int  // ports is the UDP port, or the ordered TCP port-knock sequence
+	secret []byte // secret is the UDP or ICMP payload that must be received
+}
+
+// parseTrigger parses a wake trigger configuration string:
+//
+//	udp:<port>:<secret>     - a UDP packet to the port with the secret as its payload
+//	icmp:<secret>           - an ICMP echo request that contains the secret; requires raw socket privileges
+//	knock:<port>,<port>,... - TCP connections to the ports, in order, from the same address within 10 seconds
+func parseTrigger(config string) (*trigger, error) {
+	if config == "" || strings.ToLower(config) == "off" {
+		return nil, nil
+	}
+	parts := strings.SplitN(config, ":", 3)
+	t := &trigger{kind: strings.ToLower(parts[0])}
+	switch t.kind {
+	case "udp":
+		if len(parts) != 3 || parts[2] == "" {
+			return nil, fmt.Errorf("the udp wake trigger must be in the form udp:<port>:<secret>")
+		}
+		port, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("there was an error converting the wake trigger port to an integer: %s", err)
+		}
+		t.ports = []int{port}
+		t.secret = []byte(parts[2])
+	case "icmp":
+		if len(parts) < 2 || parts[1] == "" {
+			return nil, fmt.Errorf("the icmp wake trigger must be in the form icmp:<secret>")
+		}
+		t.secret = []byte(strings.Join(parts[1:], ":"))
+	case "knock":
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("the knock wake trigger must be in the form knock:<port>,<port>,...")
+		}
+		for _, p := range strings.Split(parts[1], ",") {
+			port, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil {
+				return nil, fmt.Errorf("there was an error converting the wake trigger port to an integer: %s", err)
+			}
+			t.ports = append(t.ports, port)
+		}
+		if len(t.ports) < 2 {
+			return nil, fmt.Errorf("the knock wake trigger requires at least two ports")
+		}
+	default:
+		return nil, fmt.Errorf("%s is not a valid wake trigger, use udp, icmp, knock, or off", parts[0])
+	}
+	return t, nil
+}
+
+// String returns the wake trigger configuration without its secret
+func (t *trigger) String() string {
+	if t == nil {
+		return "off"
+	}
+	switch t.kind {
+	case "udp":
+		return fmt.Sprintf("udp:%d", t.ports[0])
+	case "knock":
+		var ports []string
+		for _, p := range t.ports {
+			ports = append(ports, strconv.Itoa(p))
+		}
+		return fmt.Sprintf("knock:%s", strings.Join(ports, ","))
+	}
+	return t.kind
+}
+
+// listen arms the trigger, sends the source address to the wake channel when triggered, and returns a function that
+// disarms the trigger by closing its listeners
+func (t *trigger) listen(wake chan<- string) (func(), error) {
+	var closers []func() error
+	switch t.kind {
+	case "udp":
+		conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", t.ports[0]))
+		if err != nil {
+			return nil, fmt.Errorf("there was an error starting the udp wake listener: %s", err)
+		}
+		closers = append(closers, conn.Close)
+		go t.packets(conn, wake, func(b []byte) bool { return subtle.ConstantTimeCompare(b, t.secret) == 1 })
+	case "icmp":
+		conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+		if err != nil {
+			return nil, fmt.Errorf("the icmp wake trigger requires raw socket privileges: %s", err)
+		}
+		closers = append(closers, conn.Close)
+		go t.packets(conn, wake, func(b []byte) bool {
+			msg, errP := icmp.ParseMessage(1, b)
+			if errP != nil || msg.Type != ipv4.ICMPTypeEcho {
+				return false
+			}
+			echo, ok := msg.Body.(*icmp.Echo)
+			return ok && strings.Contains(string(echo.Data), string(t.secret))
+		})
+	case "knock":
+		var mu sync.Mutex
+		// progress is the next knock index and the time of the first knock for each source address
+		progress := make(map[string]int)
+		started := make(map[string]time.Time)
+		for i, port := range t.ports {
+			l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+			if err != nil {
+				for _, c := range closers {
+					_ = c()
+				}
+				return nil, fmt.Errorf("there was an error starting the knock wake listener: %s", err)
+			}
+			closers = append(closers, l.Close)
+			go func(i int, l net.Listener) {
+				for {
+					conn, errA := l.Accept()
+					if errA != nil {
+						return
+					}
+					host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+					_ = conn.Close()
+					mu.Lock()
+					if i == 0 {
+						progress[host], started[host] = 1, time.Now()
+					} else if progress[host] == i && time.Since(started[host]) <= knockWindow {
+						progress[host]++
+					} else {
+						delete(progress, host)
+					}
+					done := progress[host] == len(t.ports)
+					mu.Unlock()
+					if done {
+						send(wake, host)
+					}
+				}
+			}(i, l)
+		}
+	}
+	stop := func() {
+		for _, c := range closers {
+			_ = c()
+		}
+	}
+	return trackListener(t.String()+" wake trigger", stop), nil
+}
+
+// packets reads from the connection until it is closed and wakes the agent when a packet matches
+func (t *trigger) packets(conn net.PacketConn, wake chan<- string, match func([]byte) bool) {
+	b := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		if match(b[:n]) {
+			send(wake, addr.String())
+		}
+	}
+}
+
+// send delivers the wake without blocking because the trigger only fires once
+func send(wake chan<- string, source string) {
+	select {
+	case wake <- source:
+	default:
+	}
+}
+
+// sleep waits for the duration to pass, for the agent's wake trigger to fire, or for results that should be returned
+// right away, whichever is first
+func (a *Agent) sleep(d time.Duration) {
+	wake := make(chan string, 1)
+	if a.wake != nil {
+		stop, err := a.wake.listen(wake)
+		if err != nil {
+			if cli.Enabled {
+				cli.Message(cli.WARN, err.Error())
+			}
+		} else {
+			defer stop()
+		}
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case source := <-wake:
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Woken by the %s trigger from %s", a.wake.kind, source))
+		}
+	case <-hurry:
+		if cli.Enabled {
+			cli.Message(cli.NOTE, "Woken to return chunked transfer acknowledgments")
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package audit keeps an append-only, encrypted record of every job the agent executed for deconfliction and reporting
+package audit
+
+import (
+	// Standard
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/loot"
+)
+
+// MaxCommand is the number of characters of a job's command and arguments that are recorded
+const MaxCommand = 256
+
+// Record is a job the agent executed
+type Record struct {
+	Time     time.Time `json:"time"`               // Time is when the job started executing
+	ID       string    `json:"id"`                 // ID is the job's ID
+	Type     string    `json:"type"`               // Type is the job's type (e.g., Module)
+	Command  string    `json:"command"`            // Command is the job's command and arguments, truncated to MaxCommand characters
+	Operator string    `json:"operator,omitempty"` // Operator is who tasked the job, empty if the server did not identify them
+	Result   string    `json:"result"`             // Result is the hex SHA-256 hash of the job's first result, empty until it returns
+	Chain    string    `json:"chain"`              // Chain is the hex SHA-256 hash of the previous record's chain and this record
+}
+
+// trail holds the encrypted records in the order the jobs returned a result and the jobs that have not returned one
+// yet. Records are encrypted with a random key that never leaves memory and can't be removed. When a file is
+// configured, every record is also appended to it sealed to the operator's public key so the trail survives the
+// agent exiting and can only be read by the operator
+var trail = struct {
+	sync.Mutex
+	aead    cipher.AEAD
+	entries [][]byte
+	pending map[string]Record
+	chain   string
+	file    string
+	fileErr error
+}{pending: make(map[string]Record)}
+
+func init() {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("there was an error generating the audit trail key: %s", err))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(fmt.Sprintf("there was an error creating the audit trail cipher: %s", err))
+	}
+	if trail.aead, err = cipher.NewGCM(block); err != nil {
+		panic(fmt.Sprintf("there was an error creating the audit trail cipher: %s", err))
+	}
+}
+
+// Executed records that a job started executing, the record is added to the trail once the job returns a result
+func Executed(id, kind, command, operator string) {
+	if len(command) > MaxCommand {
+		command = command[:MaxCommand] + "..."
+	}
+	trail.Lock()
+	trail.pending[id] = Record{Time: time.Now().UTC(), ID: id, Type: kind, Command: command, Operator: operator}
+	trail.Unlock()
+}
+
+// Returned adds the record of an executed job to the trail with the hash of its first result. Later results for the
+// same job, such as the chunks of a file transfer, are not recorded
+func Returned(id string, result []byte) {
+	trail.Lock()
+	defer trail.Unlock()
+	record, ok := trail.pending[id]
+	if !ok {
+		return
+	}
+	delete(trail.pending, id)
+	hash := sha256.Sum256(result)
+	record.Result = hex.EncodeToString(hash[:])
+	add(record)
+}
+
+// add chains the record to the previous one, encrypts it, and appends it to the trail and the file, if configured;
+// the trail lock must be held
+func add(record Record) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	chain := sha256.Sum256(append([]byte(trail.chain), data...))
+	record.Chain = hex.EncodeToString(chain[:])
+	trail.chain = record.Chain
+	if data, err = json.Marshal(record); err != nil {
+		return
+	}
+
+	nonce := make([]byte, trail.aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+	trail.entries = append(trail.entries, trail.aead.Seal(nonce, nonce, data, nil))
+	if trail.file != "" {
+		trail.fileErr = appendFile(trail.file, data)
+	}
+}
+
+// appendFile seals the record to the operator's public key and appends it to the file as a base64 encoded line
+func appendFile(path string, data []byte) error {
+	sealed, err := loot.Seal(data)
+	if err != nil {
+		return fmt.Errorf("the audit record could not be sealed: %s", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("there was an error opening the audit file: %s", err)
+	}
+	defer f.Close()
+	if _, err = f.WriteString(base64.StdEncoding.EncodeToString(sealed) + "\n"); err != nil {
+		return fmt.Errorf("there was an error writing to the audit file: %s", err)
+	}
+	return nil
+}
+
+// Records decrypts and returns the trail in the order the jobs returned followed by the jobs that have not returned
+// a result, oldest first
+func Records() ([]Record, error) {
+	trail.Lock()
+	defer trail.Unlock()
+	var records []Record
+	nonceSize := trail.aead.NonceSize()
+	for i, entry := range trail.entries {
+		data, err := trail.aead.Open(nil, entry[:nonceSize], entry[nonceSize:], nil)
+		if err != nil {
+			return records, fmt.Errorf("there was an error decrypting audit record %d: %s", i, err)
+		}
+		var record Record
+		if err = json.Unmarshal(data, &record); err != nil {
+			return records, fmt.Errorf("there was an error decoding audit record %d: %s", i, err)
+		}
+		records = append(records, record)
+	}
+	var pending []Record
+	for _, record := range trail.pending {
+		pending = append(pending, record)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Time.Before(pending[j].Time) })
+	return append(records, pending...), nil
+}
+
+// SetFile sets the file every record is appended to, sealed to the operator's public key, or stops writing to a file
+// when the path is empty. Records already in the trail are not written to the new file
+func SetFile(path string) error {
+	if path != "" && loot.Key() == "" {
+		return fmt.Errorf("an audit file requires an operator public key to seal the records to")
+	}
+	trail.Lock()
+	trail.file = path
+	trail.fileErr = nil
+	trail.Unlock()
+	return nil
+}
+
+// File returns the file records are appended to, empty if there isn't one, and the error from the last write to it
+func File() (string, error) {
+	trail.Lock()
+	defer trail.Unlock()
+	return trail.file, trail.fileErr
+}
@@ -0,0 +1,295 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package cache
+
+import (
+	// Standard
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/vault"
+)
+
+// Prefix marks a job argument that refers to a cached payload by its SHA-256 hash, or a unique prefix of at least
+// MinPrefix characters, instead of carrying the payload itself
+const Prefix = "cache:"
+
+// MinPrefix is the shortest hash prefix accepted when referring to a cached payload
+const MinPrefix = 8
+
+// DefaultMaxSize is the most payload bytes the cache holds before the least recently used payloads are evicted
+const DefaultMaxSize = 64 * 1024 * 1024
+
+// Entry is a payload, such as a BOF, assembly, or script, held in the cache
+type Entry struct {
+	Hash    string    // Hash is the hex encoded SHA-256 hash of the payload
+	Name    string    // Name is what the operator called the payload
+	Version string    // Version distinguishes builds of the same payload; adding a new version replaces the old one
+	Size    int       // Size is the length of the payload
+	Added   time.Time // Added is when the payload was cached
+	Used    time.Time // Used is when the payload was last used by a job
+	Hits    int       // Hits is how many jobs have used the payload
+	sealed  []byte    // sealed is the payload encrypted by the vault when it is held in memory
+	path    string    // path is the file holding the payload encrypted by the vault when it is held on disk
+}
+
+// cache holds payloads encrypted by the vault, keyed by their hash, so jobs that run the same tool repeatedly don't
+// transfer it over the network each time. Payloads are held in memory unless a directory is set
+var cache = struct {
+	sync.Mutex
+	entries map[string]*Entry
+	dir     string
+	max     int
+	size    int
+}{entries: make(map[string]*Entry), max: DefaultMaxSize}
+
+// Add caches the payload under its SHA-256 hash and evicts any other version of a payload with the same name. The
+// least recently used payloads are evicted to make room for it
+func Add(name, version string, data []byte) (Entry, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	cache.Lock()
+	defer cache.Unlock()
+	if len(data) > cache.max {
+		return Entry{}, fmt.Errorf("the %d byte payload is larger than the %d byte cache", len(data), cache.max)
+	}
+	if entry, ok := cache.entries[hash]; ok {
+		entry.Name, entry.Version = name, version
+		return *entry, nil
+	}
+	for _, entry := range cache.entries {
+		if strings.EqualFold(entry.Name, name) {
+			_ = remove(entry)
+		}
+	}
+	for cache.size+len(data) > cache.max {
+		_ = remove(leastRecentlyUsed())
+	}
+
+	now := time.Now().UTC()
+	entry := &Entry{Hash: hash, Name: name, Version: version, Size: len(data), Added: now, Used: now}
+	if cache.dir != "" {
+		entry.path = filepath.Join(cache.dir, hash[:16])
+		if err := vault.Write(entry.path, data); err != nil {
+			return Entry{}, err
+		}
+	} else {
+		sealed, err := vault.Seal(Prefix+hash, data)
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.sealed = sealed
+	}
+	cache.entries[hash] = entry
+	cache.size += entry.Size
+	return *entry, nil
+}
+
+// Get returns the cached payload for the hash, or a unique prefix of it, and records that a job used it
+func Get(hash string) ([]byte, error) {
+	cache.Lock()
+	defer cache.Unlock()
+	entry, err := find(hash)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	if entry.path != "" {
+		data, err = vault.Read(entry.path)
+	} else {
+		data, err = vault.Open(Prefix+entry.Hash, entry.sealed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != entry.Hash {
+		_ = remove(entry)
+		return nil, fmt.Errorf("the cached payload %s was corrupt and has been evicted", entry.Hash)
+	}
+	entry.Used = time.Now().UTC()
+	entry.Hits++
+	return data, nil
+}
+
+// Resolve returns the Base64 encoded payload for an argument that refers to a cached payload and true, or the
+// argument unchanged and false when it does not refer to the cache
+func Resolve(arg string) (string, bool, error) {
+	if !strings.HasPrefix(arg, Prefix) {
+		return arg, false, nil
+	}
+	data, err := Get(strings.TrimPrefix(arg, Prefix))
+	if err != nil {
+		return arg, true, err
+	}
+	return base64.StdEncoding.EncodeToString(data), true, nil
+}
+
+// Evict removes the payloads matching the hash, a unique prefix of it, or a name and returns what was removed
+func Evict(key string) (evicted []Entry, err error) {
+	cache.Lock()
+	defer cache.Unlock()
+	for _, entry := range cache.entries {
+		if strings.EqualFold(entry.Name, key) {
+			evicted = append(evicted, *entry)
+			if e := remove(entry); e != nil {
+				err = e
+			}
+		}
+	}
+	if len(evicted) > 0 {
+		return
+	}
+	entry, err := find(key)
+	if err != nil {
+		return nil, err
+	}
+	return []Entry{*entry}, remove(entry)
+}
+
+// Purge removes every cached payload and returns how many were removed
+func Purge() (count int, err error) {
+	cache.Lock()
+	defer cache.Unlock()
+	for _, entry := range cache.entries {
+		if e := remove(entry); e != nil {
+			err = e
+		}
+		count++
+	}
+	return
+}
+
+// List returns the cached payloads sorted by name
+func List() (list []Entry) {
+	cache.Lock()
+	for _, entry := range cache.entries {
+		list = append(list, *entry)
+	}
+	cache.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name == list[j].Name {
+			return list[i].Hash < list[j].Hash
+		}
+		return list[i].Name < list[j].Name
+	})
+	return
+}
+
+// Size returns the number of payload bytes cached and the most the cache holds
+func Size() (int, int) {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.size, cache.max
+}
+
+// SetMaxSize sets the most payload bytes the cache holds and evicts the least recently used payloads until the cache
+// fits
+func SetMaxSize(max int) error {
+	if max <= 0 {
+		return fmt.Errorf("the cache size must be greater than zero: %d", max)
+	}
+	cache.Lock()
+	defer cache.Unlock()
+	cache.max = max
+	for cache.size > cache.max {
+		_ = remove(leastRecentlyUsed())
+	}
+	return nil
+}
+
+// SetDir holds payloads cached from now on in the directory, encrypted by the vault, instead of in memory. An empty
+// directory holds them in memory
+func SetDir(dir string) error {
+	if dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return fmt.Errorf("there was an error checking the cache directory: %s", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+	}
+	cache.Lock()
+	cache.dir = dir
+	cache.Unlock()
+	return nil
+}
+
+// Dir returns the directory payloads are cached in, or an empty string when they are held in memory
+func Dir() string {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.dir
+}
+
+// find returns the entry for the hash or a unique prefix of it; the cache lock must be held
+func find(hash string) (*Entry, error) {
+	hash = strings.ToLower(hash)
+	if entry, ok := cache.entries[hash]; ok {
+		return entry, nil
+	}
+	if len(hash) < MinPrefix {
+		return nil, fmt.Errorf("%s is not a cached payload, hash prefixes must be at least %d characters", hash, MinPrefix)
+	}
+	var match *Entry
+	for h, entry := range cache.entries {
+		if strings.HasPrefix(h, hash) {
+			if match != nil {
+				return nil, fmt.Errorf("%s matches more than one cached payload", hash)
+			}
+			match = entry
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("%s is not a cached payload, send the payload again to cache it", hash)
+	}
+	return match, nil
+}
+
+// leastRecentlyUsed returns the entry that was used longest ago; the cache lock must be held and the cache not empty
+func leastRecentlyUsed() (oldest *Entry) {
+	for _, entry := range cache.entries {
+		if oldest == nil || entry.Used.Before(oldest.Used) {
+			oldest = entry
+		}
+	}
+	return
+}
+
+// remove deletes the entry from the cache and overwrites its payload; the cache lock must be held
+func remove(entry *Entry) error {
+	delete(cache.entries, entry.Hash)
+	cache.size -= entry.Size
+	for i := range entry.sealed {
+		entry.sealed[i] = 0
+	}
+	if entry.path != "" {
+		return vault.Remove(entry.path)
+	}
+	return nil
+}
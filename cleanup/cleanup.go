@@ -0,0 +1,115 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package cleanup tracks the processes, listeners, pipes, drivers, and forwards the agent creates so they can be torn
+// down before the agent exits instead of being left orphaned on the host
+package cleanup
+
+import (
+	// Standard
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// PROCESS is a child process started by the agent
+	PROCESS = "process"
+	// LISTENER is a network socket the agent is listening on
+	LISTENER = "listener"
+	// PIPE is a named pipe or Unix domain socket the agent created
+	PIPE = "pipe"
+	// DRIVER is a kernel driver the agent loaded
+	DRIVER = "driver"
+	// FORWARD is a port forward or routing change the agent made
+	FORWARD = "forward"
+)
+
+// Item is a single resource the agent created and must tear down before it exits
+type Item struct {
+	ID      int       // ID is the registry's unique identifier for the item
+	Kind    string    // Kind is the type of resource: process, listener, pipe, driver, or forward
+	Name    string    // Name describes the resource, such as a process ID or listening address
+	Created time.Time // Created is when the resource was registered
+	close   func() error
+}
+
+// registry holds every resource that has not been removed by its owner
+var registry = struct {
+	sync.Mutex
+	next  int
+	items []*Item
+}{}
+
+// Add registers a resource with the function that tears it down and returns a function the owner calls to remove the
+// resource from the registry once it has released the resource on its own
+func Add(kind, name string, teardown func() error) (remove func()) {
+	registry.Lock()
+	registry.next++
+	item := &Item{ID: registry.next, Kind: kind, Name: name, Created: time.Now().UTC(), close: teardown}
+	registry.items = append(registry.items, item)
+	registry.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { drop(item) })
+	}
+}
+
+// drop removes the item from the registry without tearing it down
+func drop(item *Item) {
+	registry.Lock()
+	defer registry.Unlock()
+	for i, v := range registry.items {
+		if v == item {
+			registry.items = append(registry.items[:i], registry.items[i+1:]...)
+			return
+		}
+	}
+}
+
+// List returns a copy of the registered resources, oldest first
+func List() (items []Item) {
+	registry.Lock()
+	defer registry.Unlock()
+	for _, item := range registry.items {
+		items = append(items, *item)
+	}
+	return
+}
+
+// Run tears down every registered resource, newest first so that dependents are released before what they depend on,
+// empties the registry, and returns one line describing the outcome for each resource
+func Run() (results []string) {
+	registry.Lock()
+	items := registry.items
+	registry.items = nil
+	registry.Unlock()
+
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+		if item.close == nil {
+			continue
+		}
+		if err := item.close(); err != nil {
+			results = append(results, fmt.Sprintf("there was an error tearing down %s %s: %s", item.Kind, item.Name, err))
+			continue
+		}
+		results = append(results, fmt.Sprintf("tore down %s %s", item.Kind, item.Name))
+	}
+	return
+}
@@ -18,6 +18,10 @@
 package cli
 
 import (
+	// Standard
+	"fmt"
+	"strings"
+
 	// 3rd Party
 	"github.com/fatih/color"
 
@@ -38,8 +42,53 @@ const (
 	SUCCESS = 5
 )
 
+// warnings is used to print WARN messages when verbose output is disabled
+var warnings = false
+
+// SetLevel changes which messages are printed to Standard Out while the agent is running
+// none disables all output, warn only prints warnings, info prints all non-debug messages, and debug prints everything
+func SetLevel(level string) error {
+	core.Mutex.Lock()
+	defer core.Mutex.Unlock()
+	switch strings.ToLower(level) {
+	case "none":
+		core.Verbose, core.Debug, warnings = false, false, false
+	case "warn":
+		core.Verbose, core.Debug, warnings = false, false, true
+	case "info":
+		core.Verbose, core.Debug, warnings = true, false, false
+	case "debug":
+		core.Verbose, core.Debug, warnings = true, true, false
+	default:
+		return fmt.Errorf("%s is not a valid message level, use none, warn, info, or debug", level)
+	}
+	return nil
+}
+
+// Level returns the name of the message level that is printed to Standard Out
+func Level() string {
+	core.Mutex.Lock()
+	defer core.Mutex.Unlock()
+	switch {
+	case core.Debug && core.Verbose:
+		return "debug"
+	case core.Debug:
+		return "debug only"
+	case core.Verbose:
+		return "info"
+	case warnings:
+		return "warn"
+	default:
+		return "none"
+	}
+}
+
 // Message is used to print text to Standard Out
 func Message(level int, message string) {
+	if !Enabled {
+		return
+	}
+	record(level, message)
 	core.Mutex.Lock()
 	defer core.Mutex.Unlock()
 	switch level {
@@ -52,7 +101,7 @@ func Message(level int, message string) {
 			color.Yellow("[-]" + message)
 		}
 	case WARN:
-		if core.Verbose {
+		if core.Verbose || warnings {
 			color.Red("[!]" + message)
 		}
 	case DEBUG:
@@ -0,0 +1,167 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	// Standard
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultLogSize is the number of messages the debug log holds before the oldest messages are overwritten
+const DefaultLogSize = 1000
+
+// debugLog is an in-memory ring buffer of encrypted messages used to diagnose the agent without console access.
+// Messages are encrypted with a random key that is generated when the log is enabled and never leaves memory.
+type debugLog struct {
+	sync.Mutex
+	aead    cipher.AEAD
+	entries [][]byte
+	next    int
+	full    bool
+}
+
+// log is the agent's debug log; it is nil when the log is disabled
+var log *debugLog
+
+// logMu protects the log variable
+var logMu sync.RWMutex
+
+// levels maps message levels to the label written in the debug log
+var levels = map[int]string{
+	INFO:    "INFO",
+	NOTE:    "NOTE",
+	WARN:    "WARN",
+	DEBUG:   "DEBUG",
+	SUCCESS: "SUCCESS",
+}
+
+// EnableLog starts capturing every message, regardless of the verbose or debug settings, in an encrypted in-memory
+// ring buffer that holds the provided number of messages. Enabling the log again discards any existing messages.
+func EnableLog(size int) error {
+	if size <= 0 {
+		size = DefaultLogSize
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("there was an error generating the debug log key: %s", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("there was an error creating the debug log cipher: %s", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("there was an error creating the debug log cipher: %s", err)
+	}
+
+	logMu.Lock()
+	log = &debugLog{aead: aead, entries: make([][]byte, size)}
+	logMu.Unlock()
+	return nil
+}
+
+// DisableLog stops capturing messages and discards the debug log
+func DisableLog() {
+	logMu.Lock()
+	log = nil
+	logMu.Unlock()
+}
+
+// LogEnabled returns true if messages are being captured in the debug log
+func LogEnabled() bool {
+	logMu.RLock()
+	defer logMu.RUnlock()
+	return log != nil
+}
+
+// ReadLog decrypts and returns the messages in the debug log from oldest to newest
+func ReadLog() ([]string, error) {
+	logMu.RLock()
+	l := log
+	logMu.RUnlock()
+	if l == nil {
+		return nil, fmt.Errorf("the debug log is not enabled")
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	var messages []string
+	start, count := 0, l.next
+	if l.full {
+		start, count = l.next, len(l.entries)
+	}
+	for i := 0; i < count; i++ {
+		entry := l.entries[(start+i)%len(l.entries)]
+		nonceSize := l.aead.NonceSize()
+		plaintext, err := l.aead.Open(nil, entry[:nonceSize], entry[nonceSize:], nil)
+		if err != nil {
+			return messages, fmt.Errorf("there was an error decrypting debug log entry %d: %s", i, err)
+		}
+		messages = append(messages, string(plaintext))
+	}
+	return messages, nil
+}
+
+// ClearLog removes all messages from the debug log
+func ClearLog() {
+	logMu.RLock()
+	l := log
+	logMu.RUnlock()
+	if l == nil {
+		return
+	}
+	l.Lock()
+	l.entries = make([][]byte, len(l.entries))
+	l.next = 0
+	l.full = false
+	l.Unlock()
+}
+
+// record encrypts the message and adds it to the debug log, if enabled
+func record(level int, message string) {
+	logMu.RLock()
+	l := log
+	logMu.RUnlock()
+	if l == nil {
+		return
+	}
+
+	label, ok := levels[level]
+	if !ok {
+		label = fmt.Sprintf("LEVEL %d", level)
+	}
+	plaintext := fmt.Sprintf("%s [%s] %s", time.Now().UTC().Format(time.RFC3339), label, message)
+
+	nonce := make([]byte, l.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return
+	}
+
+	l.Lock()
+	l.entries[l.next] = l.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+	l.Unlock()
+}
@@ -0,0 +1,81 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// SkewThreshold is the difference between the agent and server clocks that is reported as significant because it can
+// cause the server to reject the agent's JSON Web Tokens
+const SkewThreshold = 5 * time.Second
+
+// clockOffset is the number of nanoseconds the server's clock is ahead of the agent's, negative if it is behind
+var clockOffset int64
+
+// ClockOffset returns how far the server's clock is ahead of the agent's clock, as measured from the last response
+func ClockOffset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&clockOffset))
+}
+
+// Now returns the current time on the server's clock and should be used for any time the server validates
+func Now() time.Time {
+	return time.Now().Add(ClockOffset())
+}
+
+// syncClock measures the clock offset from the HTTP Date header on the server's response. The server's time is
+// compared to the midpoint of the request so the network round trip doesn't count as skew.
+func syncClock(date string, sent, received time.Time) {
+	if date == "" {
+		return
+	}
+	server, err := http.ParseTime(date)
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("there was an error parsing the server's Date header %s: %s", date, err))
+		}
+		return
+	}
+	local := sent.Add(received.Sub(sent) / 2)
+	// The Date header only has one second precision
+	offset := server.Sub(local.Truncate(time.Second))
+	if offset > -time.Second && offset < time.Second {
+		offset = 0
+	}
+	previous := time.Duration(atomic.SwapInt64(&clockOffset, int64(offset)))
+	if abs(offset-previous) >= SkewThreshold {
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("The server's clock is offset %s from the agent's clock, compensating", offset))
+		}
+	}
+}
+
+// abs returns the absolute value of the duration
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,158 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Decoy extracts the C2 payload from a benign looking HTTP response body, such as a web page, instead of expecting
+// the payload to be the entire body. The payload is Base64 encoded wherever it is embedded.
+type Decoy struct {
+	kind  string         // kind is how the payload is embedded: html, json, image, or regex
+	arg   string         // arg is the kind specific argument such as the HTML comment marker or JSON field path
+	regex *regexp.Regexp // regex is the compiled regular expression for the regex kind
+}
+
+// pngEnd is the PNG IEND chunk type and CRC that ends a PNG image
+var pngEnd = []byte{0x49, 0x45, 0x4E, 0x44, 0xAE, 0x42, 0x60, 0x82}
+
+// jpegEnd is the JPEG End Of Image marker
+var jpegEnd = []byte{0xFF, 0xD9}
+
+// htmlComment matches the contents of HTML comments
+var htmlComment = regexp.MustCompile(`(?s)<!--(.*?)-->`)
+
+// NewDecoy parses a response profile that describes where the payload is embedded in the response body:
+//
+//	html[:marker]   - the first HTML comment, or the first one that starts with marker (e.g., <!-- marker PAYLOAD -->)
+//	json:field.path - a JSON string field; array elements are selected by index (e.g., json:data.items.0.blob)
+//	image           - data appended after the end of a PNG or JPEG image
+//	regex:pattern   - the first capture group of a regular expression
+//
+// An empty profile returns nil, and the response body is used as the payload
+func NewDecoy(profile string) (*Decoy, error) {
+	if profile == "" {
+		return nil, nil
+	}
+	kind, arg := profile, ""
+	if i := strings.Index(profile, ":"); i >= 0 {
+		kind, arg = profile[:i], profile[i+1:]
+	}
+	d := &Decoy{kind: strings.ToLower(kind), arg: arg}
+	switch d.kind {
+	case "html", "image":
+	case "json":
+		if arg == "" {
+			return nil, fmt.Errorf("the json response profile requires a field path (e.g., json:data.blob)")
+		}
+	case "regex":
+		var err error
+		d.regex, err = regexp.Compile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("there was an error compiling the response profile regular expression: %s", err)
+		}
+		if d.regex.NumSubexp() < 1 {
+			return nil, fmt.Errorf("the response profile regular expression must have a capture group for the payload")
+		}
+	default:
+		return nil, fmt.Errorf("%s is not a valid response profile, use html, json, image, or regex", kind)
+	}
+	return d, nil
+}
+
+// Extract returns the decoded payload embedded in the response body
+func (d *Decoy) Extract(body []byte) ([]byte, error) {
+	var encoded string
+	switch d.kind {
+	case "html":
+		for _, match := range htmlComment.FindAllSubmatch(body, -1) {
+			comment := strings.TrimSpace(string(match[1]))
+			if d.arg != "" {
+				if !strings.HasPrefix(comment, d.arg) {
+					continue
+				}
+				comment = strings.TrimSpace(strings.TrimPrefix(comment, d.arg))
+			}
+			encoded = comment
+			break
+		}
+	case "json":
+		var doc interface{}
+		err := json.Unmarshal(body, &doc)
+		if err != nil {
+			return nil, fmt.Errorf("there was an error parsing the JSON response body: %s", err)
+		}
+		for _, key := range strings.Split(d.arg, ".") {
+			switch node := doc.(type) {
+			case map[string]interface{}:
+				doc = node[key]
+			case []interface{}:
+				i, errI := strconv.Atoi(key)
+				if errI != nil || i < 0 || i >= len(node) {
+					return nil, fmt.Errorf("the JSON response did not contain element %s of %s", key, d.arg)
+				}
+				doc = node[i]
+			default:
+				return nil, fmt.Errorf("the JSON response did not contain the field %s", d.arg)
+			}
+		}
+		value, ok := doc.(string)
+		if !ok {
+			return nil, fmt.Errorf("the JSON response field %s was not a string", d.arg)
+		}
+		encoded = value
+	case "image":
+		if i := bytes.Index(body, pngEnd); i >= 0 {
+			encoded = string(body[i+len(pngEnd):])
+		} else if i = bytes.LastIndex(body, jpegEnd); i >= 0 {
+			encoded = string(body[i+len(jpegEnd):])
+		}
+	case "regex":
+		if match := d.regex.FindSubmatch(body); match != nil {
+			encoded = string(match[1])
+		}
+	}
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return nil, fmt.Errorf("the response body did not contain a payload for the %s response profile", d.kind)
+	}
+	payload, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error Base64 decoding the payload from the %s response profile: %s", d.kind, err)
+	}
+	return payload, nil
+}
+
+// String returns the response profile
+func (d *Decoy) String() string {
+	if d == nil {
+		return ""
+	}
+	if d.arg == "" {
+		return d.kind
+	}
+	return fmt.Sprintf("%s:%s", d.kind, d.arg)
+}
@@ -0,0 +1,84 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"testing"
+)
+
+// TestDecoyExtract ensures that the payload is extracted from each kind of decoy response body
+func TestDecoyExtract(t *testing.T) {
+	// cGF5bG9hZA== is the Base64 encoding of payload
+	png := string([]byte{0x89, 'P', 'N', 'G', 0x00, 0x49, 0x45, 0x4E, 0x44, 0xAE, 0x42, 0x60, 0x82})
+	jpeg := string([]byte{0xFF, 0xD8, 0xFF, 0xD9, 0x00, 0xFF, 0xD9})
+	tests := []struct {
+		name    string
+		profile string
+		body    string
+		hasErr  bool
+	}{
+		{"html first comment", "html", "<html><!-- cGF5bG9hZA== --><!-- other --></html>", false},
+		{"html marker", "html:id", "<html><!-- unrelated --><!--id cGF5bG9hZA== --></html>", false},
+		{"html missing marker", "html:id", "<html><!-- cGF5bG9hZA== --></html>", true},
+		{"json field", "json:data.blob", `{"data":{"blob":"cGF5bG9hZA=="}}`, false},
+		{"json array element", "json:items.1", `{"items":["x","cGF5bG9hZA=="]}`, false},
+		{"json index out of range", "json:items.2", `{"items":["x","cGF5bG9hZA=="]}`, true},
+		{"json not a string", "json:data", `{"data":{"blob":"cGF5bG9hZA=="}}`, true},
+		{"json invalid", "json:data", `{"data":`, true},
+		{"png", "image", png + "cGF5bG9hZA==", false},
+		{"jpeg", "image", jpeg + "cGF5bG9hZA==", false},
+		{"image without payload", "image", png, true},
+		{"regex", `regex:token="([^"]+)"`, `<input token="cGF5bG9hZA==">`, false},
+		{"regex no match", `regex:token="([^"]+)"`, `<input>`, true},
+		{"invalid Base64", "html", "<!-- not base64! -->", true},
+	}
+	for _, test := range tests {
+		d, err := NewDecoy(test.profile)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		payload, err := d.Extract([]byte(test.body))
+		if test.hasErr {
+			if err == nil {
+				t.Errorf("%s: expected an error but received %q", test.name, payload)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if string(payload) != "payload" {
+			t.Errorf("%s: expected payload but received %q", test.name, payload)
+		}
+	}
+}
+
+// TestNewDecoy ensures that invalid response profiles are rejected
+func TestNewDecoy(t *testing.T) {
+	for _, profile := range []string{"json", "json:", "regex:(", "regex:no group", "xml"} {
+		if _, err := NewDecoy(profile); err == nil {
+			t.Errorf("expected an error for the %s response profile but received none", profile)
+		}
+	}
+	if d, err := NewDecoy(""); d != nil || err != nil {
+		t.Errorf("expected no decoy for an empty response profile but received %v, %v", d, err)
+	}
+}
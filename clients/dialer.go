@@ -0,0 +1,195 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	// 3rd Party
+	"github.com/lucas-clemente/quic-go"
+)
+
+// HappyEyeballsDelay is how long a connection attempt is given before an attempt to the next address is started
+// https://www.rfc-editor.org/rfc/rfc8305#section-5
+const HappyEyeballsDelay = 250 * time.Millisecond
+
+// Dialer returns a net.Dialer that races IPv6 and IPv4 connection attempts to dual-stack hosts (Happy Eyeballs)
+// and resolves hostnames with the configured resolver
+func Dialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:       30 * time.Second,
+		KeepAlive:     30 * time.Second,
+		FallbackDelay: HappyEyeballsDelay,
+		Resolver:      getResolver(),
+	}
+}
+
+// DialQUIC establishes a QUIC connection to the provided address by racing connection attempts to every address the
+// host resolves to, preferring IPv6. The quic-go package only dials the first resolved address which, on IPv6-only
+// or IPv4-only networks, may not be reachable.
+func DialQUIC(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error parsing the QUIC address %s: %s", addr, err)
+	}
+	ips, err := getResolver().LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error resolving %s: %s", host, err)
+	}
+	addrs := interleave(ips)
+
+	type result struct {
+		conn quic.EarlyConnection
+		err  error
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	results := make(chan result, len(addrs))
+	failed := make(chan struct{}, len(addrs))
+
+	// Start the next attempt when the delay expires, or the previous attempt failed, whichever is first
+	go func() {
+		for i, ip := range addrs {
+			if i > 0 {
+				select {
+				case <-time.After(HappyEyeballsDelay):
+				case <-failed:
+				case <-ctx.Done():
+				}
+			}
+			if ctx.Err() != nil {
+				results <- result{err: ctx.Err()}
+				continue
+			}
+			go func(ip net.IP) {
+				conn, errDial := dialQUIC(ctx, &net.UDPAddr{IP: ip, Port: portNumber(port)}, host, tlsCfg, cfg)
+				if errDial != nil {
+					failed <- struct{}{}
+				}
+				results <- result{conn: conn, err: errDial}
+			}(ip)
+		}
+	}()
+
+	var errs []error
+	for i := range addrs {
+		r := <-results
+		if r.err != nil {
+			errs = append(errs, r.err)
+			continue
+		}
+		// Stop the remaining attempts and close any connection that won at the same time
+		cancel()
+		go func(remaining int) {
+			for j := 0; j < remaining; j++ {
+				if late := <-results; late.conn != nil {
+					_ = late.conn.CloseWithError(0, "")
+				}
+			}
+		}(len(addrs) - i - 1)
+		return r.conn, nil
+	}
+	cancel()
+	return nil, fmt.Errorf("unable to establish a QUIC connection to any of the addresses for %s: %v", host, errs)
+}
+
+// dialQUIC establishes a QUIC connection to a single remote address from a new UDP socket
+func dialQUIC(ctx context.Context, remote *net.UDPAddr, host string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+	// A wildcard UDP socket works for both IPv4 and IPv6 destinations
+	pconn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := quic.DialEarlyContext(ctx, pconn, remote, host, tlsCfg, cfg)
+	if err != nil {
+		_ = pconn.Close()
+		return nil, err
+	}
+	// quic-go doesn't close a net.PacketConn it did not create
+	go func() {
+		<-conn.Context().Done()
+		_ = pconn.Close()
+	}()
+	if ctx.Err() != nil {
+		// Another attempt already won the race
+		_ = conn.CloseWithError(0, "")
+		return nil, ctx.Err()
+	}
+	return conn, nil
+}
+
+// interleave orders the resolved addresses alternating between IPv6 and IPv4, starting with IPv6
+// https://www.rfc-editor.org/rfc/rfc8305#section-4
+func interleave(ips []net.IPAddr) (addrs []net.IP) {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.IP.To4() != nil {
+			v4 = append(v4, ip.IP)
+		} else {
+			v6 = append(v6, ip.IP)
+		}
+	}
+	for len(v4) > 0 || len(v6) > 0 {
+		if len(v6) > 0 {
+			addrs = append(addrs, v6[0])
+			v6 = v6[1:]
+		}
+		if len(v4) > 0 {
+			addrs = append(addrs, v4[0])
+			v4 = v4[1:]
+		}
+	}
+	return
+}
+
+// portNumber converts a port string into an integer, returning 0 if it is invalid
+func portNumber(port string) int {
+	p, err := net.LookupPort("udp", port)
+	if err != nil {
+		return 0
+	}
+	return p
+}
+
+// ParseURL parses a C2 URL and encloses a literal IPv6 address in brackets if the operator omitted them
+// (e.g., https://2001:db8::1/ becomes https://[2001:db8::1]/). An unbracketed address with a port is ambiguous and is
+// treated as an address without a port when the whole host is a valid IPv6 address.
+func ParseURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("there was an error parsing the URL %s: %s", rawURL, err)
+	}
+	if u.Host == "" || strings.HasPrefix(u.Host, "[") || strings.Count(u.Host, ":") < 2 {
+		return u.String(), nil
+	}
+	if ip := net.ParseIP(u.Host); ip != nil {
+		// The entire host is an IPv6 address without a port
+		u.Host = fmt.Sprintf("[%s]", ip)
+	} else if ip = net.ParseIP(u.Hostname()); ip != nil {
+		u.Host = net.JoinHostPort(ip.String(), u.Port())
+	} else {
+		return "", fmt.Errorf("unable to parse the IPv6 address in URL %s, enclose it in brackets", rawURL)
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,58 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"testing"
+)
+
+// TestParseURL ensures that literal IPv6 addresses in C2 URLs are enclosed in brackets and other URLs are unchanged
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		want   string
+		hasErr bool
+	}{
+		{"hostname", "https://example.com/", "https://example.com/", false},
+		{"hostname with port", "https://example.com:8443/news", "https://example.com:8443/news", false},
+		{"IPv4", "https://127.0.0.1:443/", "https://127.0.0.1:443/", false},
+		{"bracketed IPv6", "https://[2001:db8::1]:443/", "https://[2001:db8::1]:443/", false},
+		{"unbracketed IPv6", "https://2001:db8::1/", "https://[2001:db8::1]/", false},
+		{"ambiguous IPv6 port", "https://2001:db8::1:443/", "https://[2001:db8::1:443]/", false},
+		{"full IPv6 with port", "https://2001:db8:0:0:0:0:0:1:443/", "https://[2001:db8::1]:443/", false},
+		{"invalid IPv6", "https://2001:db8::g::1/", "", true},
+	}
+	for _, test := range tests {
+		got, err := ParseURL(test.url)
+		if test.hasErr {
+			if err == nil {
+				t.Errorf("%s: expected an error but received %s", test.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: expected %s but received %s", test.name, test.want, got)
+		}
+	}
+}
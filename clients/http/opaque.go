@@ -38,11 +38,13 @@ import (
 
 // opaqueAuth is the top-level function that subsequently runs OPAQUE registration and authentication
 func (client *Client) opaqueAuth(register bool) (messages.Base, error) {
-	cli.Message(cli.DEBUG, "Entering into clients.http.opaqueAuth()...")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.http.opaqueAuth()...")
+	}
 
 	// Set, or reset, the secret used for JWT & JWE encryption key from PSK
-	k := sha256.Sum256([]byte(client.psk))
-	client.secret = k[:]
+	k := sha256.Sum256(client.psk.Bytes())
+	client.setSecret(k[:])
 
 	// OPAQUE Registration
 	if register { // If the client has previously registered, then this will not be empty
@@ -67,15 +69,60 @@ func (client *Client) opaqueAuth(register bool) (messages.Base, error) {
 	}
 
 	// The OPAQUE derived Diffie-Hellman secret
-	client.secret = []byte(client.opaque.Kex.SharedSecret.String())
+	client.setSecret([]byte(client.opaque.Kex.SharedSecret.String()))
 
 	return msg, nil
 }
 
+// reauthenticate transparently authenticates the agent again when the server rejects its JWT, because it expired or
+// the server restarted, and then resends the message so the rejected message isn't lost or counted as a failed check in.
+// The existing OPAQUE registration is used first, and the agent registers again if the server no longer knows it.
+func (client *Client) reauthenticate(m messages.Base) ([]messages.Base, error) {
+	client.reauth = true
+	defer func() { client.reauth = false }()
+
+	var msg messages.Base
+	var err error
+	register := client.opaque == nil
+	if !register {
+		msg, err = client.opaqueAuth(false)
+		if err != nil {
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("OPAQUE re-authentication failed, re-registering: %s", err))
+			}
+			register = true
+		} else if msg.Type == messages.OPAQUE && msg.Payload.(opaque.Opaque).Type == opaque.ReRegister {
+			register = true
+		}
+	}
+	if register {
+		if cli.Enabled {
+			cli.Message(cli.NOTE, "Re-registering and re-authenticating this orphaned agent")
+		}
+		msg, err = client.opaqueAuth(true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	returnMessages := []messages.Base{msg}
+
+	// OPAQUE messages are not resent because authentication already replaced them
+	if m.Type == messages.OPAQUE {
+		return returnMessages, nil
+	}
+	msgs, err := client.Send(m)
+	if err != nil {
+		return returnMessages, fmt.Errorf("there was an error resending the %s message after re-authenticating:\r\n%s", messages.String(m.Type), err)
+	}
+	return append(returnMessages, msgs...), nil
+}
+
 //opaqueRegister is the logic used to perform the OPAQUE protocol Registration
 func (client *Client) opaqueRegister() error {
-	cli.Message(cli.DEBUG, "Entering into agent.opaqueRegister")
-	cli.Message(cli.NOTE, "Starting OPAQUE Registration")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into agent.opaqueRegister")
+		cli.Message(cli.NOTE, "Starting OPAQUE Registration")
+	}
 
 	msg := messages.Base{
 		ID:   client.AgentID,
@@ -100,7 +147,9 @@ func (client *Client) opaqueRegister() error {
 			return fmt.Errorf("there was an error creating the OPAQUE User Registration Initialization message:\r\n%s", err)
 		}
 		// Send OPAQUE RegInit message to the server
-		cli.Message(cli.DEBUG, "Sending OPAQUE RegInit message")
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, "Sending OPAQUE RegInit message")
+		}
 		msgs, err := client.Send(msg)
 		if err != nil {
 			client.opaque = nil
@@ -131,7 +180,9 @@ func (client *Client) opaqueRegister() error {
 		return fmt.Errorf("there was an error creating the OPAQUE User Registration Complete message:\r\n%s", err)
 	}
 	// Send OPAQUE RegComplete to the server
-	cli.Message(cli.DEBUG, "Sending OPAQUE RegComplete message")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Sending OPAQUE RegComplete message")
+	}
 	if client.PaddingMax > 0 {
 		// #nosec G404 -- Random number does not impact security
 		msg.Padding = core.RandStringBytesMaskImprSrc(rand.Intn(client.PaddingMax))
@@ -159,13 +210,17 @@ func (client *Client) opaqueRegister() error {
 		return fmt.Errorf("expected OPAQUE message type %d, received type %d", opaque.RegComplete, msg.Payload.(opaque.Opaque).Type)
 	}
 
-	cli.Message(cli.NOTE, "OPAQUE registration complete")
+	if cli.Enabled {
+		cli.Message(cli.NOTE, "OPAQUE registration complete")
+	}
 	return nil
 }
 
 // opaqueAuthenticate is the logic used to perform the OPAQUE Password Authenticated Key Exchange (PAKE) authentication
 func (client *Client) opaqueAuthenticate() (messages.Base, error) {
-	cli.Message(cli.NOTE, "Starting OPAQUE Authentication")
+	if cli.Enabled {
+		cli.Message(cli.NOTE, "Starting OPAQUE Authentication")
+	}
 
 	msg := messages.Base{
 		ID:   client.AgentID,
@@ -189,7 +244,9 @@ func (client *Client) opaqueAuthenticate() (messages.Base, error) {
 	}
 	msg.Payload = payload
 	// Send OPAQUE AuthInit message to the server
-	cli.Message(cli.DEBUG, "Sending OPAQUE AuthInit message")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Sending OPAQUE AuthInit message")
+	}
 	msgs, err := client.Send(msg)
 	if err != nil {
 		return msg, fmt.Errorf("there was an error sending the OPAQUE User Authentication Initialization message to the server:\r\n%s", err)
@@ -209,7 +266,9 @@ func (client *Client) opaqueAuthenticate() (messages.Base, error) {
 	}
 	// When the Merlin server has restarted but doesn't know the agent
 	if msg.Payload.(opaque.Opaque).Type == opaque.ReRegister {
-		cli.Message(cli.NOTE, "Received OPAQUE ReRegister response, setting initial to false")
+		if cli.Enabled {
+			cli.Message(cli.NOTE, "Received OPAQUE ReRegister response, setting initial to false")
+		}
 		return msg, nil
 	}
 	// Build AuthComplete message
@@ -224,9 +283,11 @@ func (client *Client) opaqueAuthenticate() (messages.Base, error) {
 	}
 
 	// Save the OPAQUE derived Diffie-Hellman secret
-	client.secret = []byte(client.opaque.Kex.SharedSecret.String())
+	client.setSecret([]byte(client.opaque.Kex.SharedSecret.String()))
 	// Send OPAQUE AuthComplete to the server
-	cli.Message(cli.DEBUG, "Sending OPAQUE AuthComplete message")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Sending OPAQUE AuthComplete message")
+	}
 	msgs, err = client.Send(msg)
 	if err != nil {
 		return msg, fmt.Errorf("there was an error sending the OPAQUE User Authentication Complete message to the server:\r\n%s", err)
@@ -236,7 +297,9 @@ func (client *Client) opaqueAuthenticate() (messages.Base, error) {
 	} else {
 		return msg, fmt.Errorf("the OPAQUE RegInit request returned %d messages", len(msgs))
 	}
-	cli.Message(cli.SUCCESS, "Agent authentication successful")
-	cli.Message(cli.DEBUG, "Leaving agent.opaqueAuthenticate without error")
+	if cli.Enabled {
+		cli.Message(cli.SUCCESS, "Agent authentication successful")
+		cli.Message(cli.DEBUG, "Leaving agent.opaqueAuthenticate without error")
+	}
 	return msg, nil
 }
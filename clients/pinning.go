@@ -0,0 +1,165 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrPinMismatch is returned from the TLS handshake when the server's certificate chain does not match a pin
+var ErrPinMismatch = errors.New("the server certificate did not match a pinned certificate or public key")
+
+// ErrIntercepted is returned from the TLS handshake when the server's certificate was issued by a TLS inspection product
+var ErrIntercepted = errors.New("the server certificate was issued by a TLS inspection product")
+
+// pins are the acceptable SHA256 hashes of the C2 server's certificate or its SubjectPublicKeyInfo (SPKI)
+var pins = struct {
+	sync.RWMutex
+	hashes map[string]bool
+}{hashes: make(map[string]bool)}
+
+// intercepted is the reason the last TLS handshake was aborted because the server looked like a TLS intercepting proxy
+var intercepted atomic.Value
+
+// issuerCheck determines if certificates issued by TLS inspection products abort the handshake when pins are not set
+var issuerCheck int32
+
+// interceptionIssuers are lowercase parts of the issuer names used by TLS inspection products and proxies
+var interceptionIssuers = []string{
+	"avast", "barracuda", "blue coat", "bluecoat", "burp", "charles proxy", "check point", "checkpoint", "cisco umbrella",
+	"do_not_trust", "eset ssl", "fiddler", "forcepoint", "fortinet", "fortigate", "kaspersky", "mcafee web gateway",
+	"mitmproxy", "netskope", "palo alto", "paloalto", "sophos", "squid", "untangle", "websense", "zscaler",
+}
+
+// SetIssuerCheck enables or disables aborting the handshake when the server's certificate was issued by a known TLS
+// inspection product and pins are not configured
+func SetIssuerCheck(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&issuerCheck, v)
+}
+
+// SetPins configures the acceptable C2 server certificates from a comma separated list of pins. A pin is the SHA256
+// hash of the certificate in hex (e.g., from openssl x509 -fingerprint -sha256) or the base64 SHA256 hash of its
+// public key prefixed with sha256/ (e.g., sha256/AbC...=). A certificate anywhere in the chain can be pinned.
+// An empty list, or off, disables pinning
+func SetPins(list string) error {
+	hashes := make(map[string]bool)
+	if !strings.EqualFold(list, "off") {
+		for _, pin := range strings.Split(list, ",") {
+			pin = strings.TrimSpace(pin)
+			if pin == "" {
+				continue
+			}
+			if strings.HasPrefix(strings.ToLower(pin), "sha256/") {
+				b, err := base64.StdEncoding.DecodeString(pin[7:])
+				if err != nil || len(b) != sha256.Size {
+					return fmt.Errorf("%s is not a valid base64 SHA256 public key pin", pin)
+				}
+				hashes["spki:"+hex.EncodeToString(b)] = true
+				continue
+			}
+			b, err := hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+			if err != nil || len(b) != sha256.Size {
+				return fmt.Errorf("%s is not a valid hex SHA256 certificate pin", pin)
+			}
+			hashes["cert:"+hex.EncodeToString(b)] = true
+		}
+	}
+	pins.Lock()
+	defer pins.Unlock()
+	pins.hashes = hashes
+	return nil
+}
+
+// Pins returns the configured pins in the format they are set with
+func Pins() (list []string) {
+	pins.RLock()
+	defer pins.RUnlock()
+	for hash := range pins.hashes {
+		kind, value, _ := strings.Cut(hash, ":")
+		if kind == "spki" {
+			b, _ := hex.DecodeString(value)
+			list = append(list, "sha256/"+base64.StdEncoding.EncodeToString(b))
+			continue
+		}
+		list = append(list, value)
+	}
+	sort.Strings(list)
+	return
+}
+
+// VerifyPins is used as a TLS configuration's VerifyPeerCertificate function so a TLS intercepting proxy's
+// certificate aborts the handshake before any C2 traffic is sent through it. When pinning is not configured, every
+// certificate is accepted unless the issuer check is enabled and a TLS inspection product issued it
+func VerifyPins(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	pins.RLock()
+	defer pins.RUnlock()
+	if len(pins.hashes) == 0 {
+		if atomic.LoadInt32(&issuerCheck) == 0 || len(rawCerts) == 0 {
+			return nil
+		}
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return nil
+		}
+		issuer := strings.ToLower(cert.Issuer.String())
+		for _, product := range interceptionIssuers {
+			if strings.Contains(issuer, product) {
+				intercepted.Store(fmt.Sprintf("the server certificate was issued by %s", cert.Issuer))
+				return ErrIntercepted
+			}
+		}
+		return nil
+	}
+	for _, raw := range rawCerts {
+		sum := sha256.Sum256(raw)
+		if pins.hashes["cert:"+hex.EncodeToString(sum[:])] {
+			return nil
+		}
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			continue
+		}
+		sum = sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		if pins.hashes["spki:"+hex.EncodeToString(sum[:])] {
+			return nil
+		}
+	}
+	intercepted.Store("the server certificate did not match a pin")
+	return ErrPinMismatch
+}
+
+// Intercepted returns the reason a TLS handshake was aborted because the server looked like a TLS intercepting proxy
+// since the last call, or an empty string if none were
+func Intercepted() string {
+	reason, _ := intercepted.Swap("").(string)
+	return reason
+}
@@ -0,0 +1,212 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	// X Packages
+	"golang.org/x/net/http/httpproxy"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// proxyCacheTime is how long a detected proxy is used before the host's configuration is checked again
+const proxyCacheTime = 10 * time.Minute
+
+// ProxySetting is a proxy detected from the host's configuration for a C2 URL
+type ProxySetting struct {
+	Source string // Source is where the setting came from such as environment, wininet, winhttp, pac, wpad, or direct
+	Proxy  string // Proxy is the proxy URL, empty for a direct connection
+	PAC    string // PAC is the proxy auto-config script URL that was evaluated, if any
+	Bypass string // Bypass is the host's list of destinations that are not sent through the proxy
+}
+
+// String returns a description of the proxy setting
+func (p ProxySetting) String() string {
+	out := fmt.Sprintf("Source: %s\nProxy: %s", p.Source, p.Proxy)
+	if p.Proxy == "" {
+		out = fmt.Sprintf("Source: %s\nProxy: none, direct connection", p.Source)
+	}
+	if p.PAC != "" {
+		out += fmt.Sprintf("\nPAC: %s", p.PAC)
+	}
+	if p.Bypass != "" {
+		out += fmt.Sprintf("\nBypass: %s", p.Bypass)
+	}
+	return out
+}
+
+// detected is a cached proxy detection for a scheme and host
+type detected struct {
+	setting ProxySetting
+	expires time.Time
+}
+
+// proxies caches detected proxies by scheme and host so the host's configuration, and any PAC script, isn't
+// evaluated for every connection
+var proxies = struct {
+	sync.Mutex
+	cache map[string]detected
+}{cache: make(map[string]detected)}
+
+// Proxy is used as an HTTP transport's proxy function when a proxy was not provided. The proxy is detected from the
+// HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables, then the operating system's proxy configuration
+// including proxy auto-config (PAC) scripts and WPAD
+func Proxy(req *http.Request) (*url.URL, error) {
+	key := req.URL.Scheme + "://" + req.URL.Host
+	proxies.Lock()
+	d, ok := proxies.cache[key]
+	proxies.Unlock()
+	if !ok || time.Now().After(d.expires) {
+		d = detected{setting: DetectProxy(req.URL), expires: time.Now().Add(proxyCacheTime)}
+		proxies.Lock()
+		proxies.cache[key] = d
+		proxies.Unlock()
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("Detected proxy for %s:\n%s", key, d.setting))
+		}
+	}
+	if d.setting.Proxy == "" {
+		return nil, nil
+	}
+	return url.Parse(d.setting.Proxy)
+}
+
+// ResetProxy clears the cached proxy detections so the host's configuration is checked at the next connection
+func ResetProxy() {
+	proxies.Lock()
+	defer proxies.Unlock()
+	proxies.cache = make(map[string]detected)
+}
+
+// DetectProxy returns the proxy the host is configured to use for the target URL
+func DetectProxy(target *url.URL) ProxySetting {
+	if p, err := httpproxy.FromEnvironment().ProxyFunc()(target); err == nil && p != nil {
+		return ProxySetting{Source: "environment", Proxy: p.String()}
+	}
+	if setting, ok := systemProxy(target); ok {
+		return setting
+	}
+	return ProxySetting{Source: "direct"}
+}
+
+// pacDirective matches the proxy directives returned by a proxy auto-config script
+var pacDirective = regexp.MustCompile(`(?i)["']((?:PROXY|HTTPS|SOCKS5?)\s+[^"']+)["']`)
+
+// pacProxy downloads a proxy auto-config script and returns the first proxy it can return. The script is not
+// executed, so conditions in the FindProxyForURL function are not evaluated; the first PROXY, HTTPS, or SOCKS
+// directive is used and a script that only returns DIRECT is a direct connection
+func pacProxy(pac string) (string, error) {
+	client := &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{Proxy: nil, DialContext: Dialer().DialContext}}
+	resp, err := client.Get(pac) // #nosec G107 - The PAC URL is from the host's proxy configuration
+	if err != nil {
+		return "", fmt.Errorf("there was an error downloading the proxy auto-config script %s: %s", pac, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("the proxy auto-config script %s returned %s", pac, resp.Status)
+	}
+	script, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("there was an error reading the proxy auto-config script %s: %s", pac, err)
+	}
+	match := pacDirective.FindSubmatch(script)
+	if match == nil {
+		return "", nil
+	}
+	return parsePACDirective(string(match[1])), nil
+}
+
+// parsePACDirective converts the first entry of a PAC return value, such as "PROXY 10.0.0.1:8080; DIRECT", to a URL
+func parsePACDirective(directive string) string {
+	entry := strings.TrimSpace(strings.Split(directive, ";")[0])
+	fields := strings.Fields(entry)
+	if len(fields) != 2 {
+		return ""
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "PROXY":
+		return "http://" + fields[1]
+	case "HTTPS":
+		return "https://" + fields[1]
+	case "SOCKS", "SOCKS5":
+		return "socks5://" + fields[1]
+	}
+	return ""
+}
+
+// parseProxyList returns the proxy URL for the target's scheme from a Windows or system proxy list such as
+// "10.0.0.1:8080" or "http=10.0.0.1:8080;https=10.0.0.2:8443;socks=10.0.0.3:1080"
+func parseProxyList(list string, scheme string) string {
+	var fallback, socks string
+	for _, entry := range strings.FieldsFunc(list, func(r rune) bool { return r == ';' || r == ' ' }) {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			value = key
+			key = ""
+		}
+		if strings.Contains(value, "://") {
+			if key == "" || strings.EqualFold(key, scheme) {
+				return value
+			}
+			continue
+		}
+		switch strings.ToLower(key) {
+		case strings.ToLower(scheme):
+			return "http://" + value
+		case "", "http":
+			if fallback == "" {
+				fallback = "http://" + value
+			}
+		case "socks":
+			socks = "socks5://" + value
+		}
+	}
+	if fallback != "" {
+		return fallback
+	}
+	return socks
+}
+
+// bypassed returns true if the host matches the proxy bypass list such as "<local>;*.corp.local;10.*"
+func bypassed(host, list string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range strings.FieldsFunc(strings.ToLower(list), func(r rune) bool { return r == ';' || r == ',' || r == ' ' }) {
+		if entry == "<local>" {
+			if !strings.Contains(host, ".") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(entry, host); ok || entry == host {
+			return true
+		}
+	}
+	return false
+}
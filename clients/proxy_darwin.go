@@ -0,0 +1,88 @@
+//go:build darwin
+// +build darwin
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// systemProxy returns the proxy for the target from the macOS system configuration, downloading the proxy
+// auto-config script when one is configured
+func systemProxy(target *url.URL) (ProxySetting, bool) {
+	out, err := exec.Command("scutil", "--proxy").Output() // #nosec G204
+	if err != nil {
+		return ProxySetting{}, false
+	}
+	settings := make(map[string]string)
+	var exceptions []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), " : ")
+		if !ok {
+			continue
+		}
+		if _, err := fmt.Sscanf(key, "%d", new(int)); err == nil {
+			exceptions = append(exceptions, value)
+			continue
+		}
+		settings[key] = value
+	}
+	bypass := strings.Join(exceptions, ";")
+
+	if settings["ProxyAutoConfigEnable"] == "1" && settings["ProxyAutoConfigURLString"] != "" {
+		pac := settings["ProxyAutoConfigURLString"]
+		proxy, err := pacProxy(pac)
+		if err != nil {
+			if cli.Enabled {
+				cli.Message(cli.DEBUG, err.Error())
+			}
+		}
+		return ProxySetting{Source: "pac", Proxy: proxy, PAC: pac}, true
+	}
+	prefix := "HTTP"
+	if strings.EqualFold(target.Scheme, "https") {
+		prefix = "HTTPS"
+	}
+	for _, p := range []string{prefix, "SOCKS"} {
+		if settings[p+"Enable"] == "1" && settings[p+"Proxy"] != "" {
+			setting := ProxySetting{Source: "system", Bypass: bypass}
+			if !bypassed(target.Hostname(), bypass) {
+				scheme := "http://"
+				if p == "SOCKS" {
+					scheme = "socks5://"
+				}
+				setting.Proxy = scheme + net.JoinHostPort(settings[p+"Proxy"], settings[p+"Port"])
+			}
+			return setting, true
+		}
+	}
+	return ProxySetting{}, false
+}
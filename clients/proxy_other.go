@@ -0,0 +1,118 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"bufio"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// systemProxy returns the proxy for the target from the GNOME proxy settings, downloading the proxy auto-config
+// script when one is configured or discovering it with WPAD when the mode is automatic without a script URL
+func systemProxy(target *url.URL) (ProxySetting, bool) {
+	mode := gsetting("org.gnome.system.proxy", "mode")
+	switch mode {
+	case "auto":
+		pac := gsetting("org.gnome.system.proxy", "autoconfig-url")
+		source := "pac"
+		if pac == "" {
+			source = "wpad"
+			pac = wpad()
+		}
+		if pac == "" {
+			return ProxySetting{}, false
+		}
+		proxy, err := pacProxy(pac)
+		if err != nil {
+			if cli.Enabled {
+				cli.Message(cli.DEBUG, err.Error())
+			}
+		}
+		return ProxySetting{Source: source, Proxy: proxy, PAC: pac}, true
+	case "manual":
+		bypass := strings.NewReplacer("[", "", "]", "", "'", "", " ", "").Replace(gsetting("org.gnome.system.proxy", "ignore-hosts"))
+		for _, schema := range []string{strings.ToLower(target.Scheme), "http", "socks"} {
+			host := gsetting("org.gnome.system.proxy."+schema, "host")
+			port := gsetting("org.gnome.system.proxy."+schema, "port")
+			if host == "" || port == "" || port == "0" {
+				continue
+			}
+			setting := ProxySetting{Source: "system", Bypass: bypass}
+			if !bypassed(target.Hostname(), bypass) {
+				scheme := "http://"
+				if schema == "socks" {
+					scheme = "socks5://"
+				}
+				setting.Proxy = scheme + net.JoinHostPort(host, port)
+			}
+			return setting, true
+		}
+	}
+	return ProxySetting{}, false
+}
+
+// gsetting returns a GNOME setting's value without quotes, or an empty string if it can't be read
+func gsetting(schema, key string) string {
+	if _, err := exec.LookPath("gsettings"); err != nil {
+		return ""
+	}
+	out, err := exec.Command("gsettings", "get", schema, key).Output() // #nosec G204
+	if err != nil {
+		return ""
+	}
+	return strings.Trim(strings.TrimSpace(string(out)), "'")
+}
+
+// wpad returns the first WPAD script URL that resolves for the host's DNS search domains, from the most to the least
+// specific domain (e.g., wpad.a.corp.local then wpad.corp.local)
+func wpad() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	var domains []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && (fields[0] == "search" || fields[0] == "domain") {
+			domains = append(domains, fields[1:]...)
+		}
+	}
+	for _, domain := range domains {
+		labels := strings.Split(strings.Trim(domain, "."), ".")
+		for i := 0; i < len(labels)-1; i++ {
+			host := "wpad." + strings.Join(labels[i:], ".")
+			if _, err := net.LookupHost(host); err == nil {
+				return "http://" + host + "/wpad.dat"
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"fmt"
+	"net/url"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/winhttp"
+)
+
+// systemProxy returns the proxy for the target from the current user's WinINET settings, evaluating a proxy
+// auto-config script or WPAD with WinHTTP when configured, and then the machine's WinHTTP settings
+func systemProxy(target *url.URL) (ProxySetting, bool) {
+	ie, err := winhttp.WinHttpGetIEProxyConfigForCurrentUser()
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, err.Error())
+		}
+	}
+	if ie.AutoDetect || ie.AutoConfigURL != "" {
+		info, err := winhttp.WinHttpGetProxyForUrl(target.String(), ie.AutoDetect, ie.AutoConfigURL)
+		switch {
+		case err != nil:
+			if cli.Enabled {
+				cli.Message(cli.DEBUG, fmt.Sprintf("there was an error evaluating the proxy auto-config script: %s", err))
+			}
+		case info.AccessType == winhttp.WINHTTP_ACCESS_TYPE_NAMED_PROXY && info.Proxy != "":
+			source := "pac"
+			if ie.AutoConfigURL == "" {
+				source = "wpad"
+			}
+			return ProxySetting{Source: source, Proxy: parseProxyList(info.Proxy, target.Scheme), PAC: ie.AutoConfigURL, Bypass: info.Bypass}, true
+		default:
+			return ProxySetting{Source: "pac", PAC: ie.AutoConfigURL}, true
+		}
+	}
+	if ie.Proxy != "" {
+		setting := ProxySetting{Source: "wininet", Bypass: ie.Bypass}
+		if !bypassed(target.Hostname(), ie.Bypass) {
+			setting.Proxy = parseProxyList(ie.Proxy, target.Scheme)
+		}
+		return setting, true
+	}
+	info, err := winhttp.WinHttpGetDefaultProxyConfiguration()
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, err.Error())
+		}
+		return ProxySetting{}, false
+	}
+	if info.AccessType == winhttp.WINHTTP_ACCESS_TYPE_NAMED_PROXY && info.Proxy != "" {
+		setting := ProxySetting{Source: "winhttp", Bypass: info.Bypass}
+		if !bypassed(target.Hostname(), info.Bypass) {
+			setting.Proxy = parseProxyList(info.Proxy, target.Scheme)
+		}
+		return setting, true
+	}
+	return ProxySetting{}, false
+}
@@ -0,0 +1,178 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resolver is used to resolve the C2 server's hostname; the system resolver is used by default
+var resolver = net.DefaultResolver
+
+// resolverMu protects the resolver variable
+var resolverMu sync.RWMutex
+
+// SetResolver configures the DNS server used to resolve the C2 server's hostname instead of the system resolver.
+// The server is an IP address and optional port for DNS over UDP (e.g., 8.8.8.8 or udp://8.8.8.8:53),
+// tcp://IP:port for DNS over TCP, or an HTTPS URL for DNS over HTTPS (e.g., https://1.1.1.1/dns-query).
+// An empty string reverts to the system resolver.
+func SetResolver(server string) error {
+	resolverMu.Lock()
+	defer resolverMu.Unlock()
+
+	if server == "" {
+		resolver = net.DefaultResolver
+		return nil
+	}
+
+	var dial func(ctx context.Context, network, address string) (net.Conn, error)
+	switch {
+	case strings.HasPrefix(strings.ToLower(server), "https://"):
+		doh, err := url.Parse(server)
+		if err != nil {
+			return fmt.Errorf("there was an error parsing the DNS over HTTPS URL %s: %s", server, err)
+		}
+		dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+			return &dohConn{ctx: ctx, url: doh.String()}, nil
+		}
+	default:
+		network := "udp"
+		if i := strings.Index(server, "://"); i > 0 {
+			network = strings.ToLower(server[:i])
+			server = server[i+3:]
+		}
+		if network != "udp" && network != "tcp" {
+			return fmt.Errorf("unsupported DNS resolver protocol %s, use udp, tcp, or https", network)
+		}
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+		}
+		if host, _, _ := net.SplitHostPort(server); net.ParseIP(host) == nil {
+			return fmt.Errorf("the DNS resolver %s must be an IP address", server)
+		}
+		dial = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		}
+	}
+	resolver = &net.Resolver{PreferGo: true, Dial: dial}
+	return nil
+}
+
+// getResolver returns the resolver used for C2 connections
+func getResolver() *net.Resolver {
+	resolverMu.RLock()
+	defer resolverMu.RUnlock()
+	return resolver
+}
+
+// dohClient sends DNS over HTTPS queries; it must not use the custom resolver to avoid recursion
+var dohClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, FallbackDelay: HappyEyeballsDelay}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        2,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// dohConn is a net.Conn that carries DNS messages written by the Go resolver over DNS over HTTPS (RFC 8484).
+// It does not implement net.PacketConn so the resolver uses the TCP message format with a 2-byte length prefix.
+type dohConn struct {
+	ctx      context.Context
+	url      string
+	response bytes.Reader
+	deadline time.Time
+}
+
+// Write sends the length prefixed DNS query to the DNS over HTTPS server
+func (c *dohConn) Write(b []byte) (int, error) {
+	if len(b) < 2 || int(binary.BigEndian.Uint16(b)) != len(b)-2 {
+		return 0, fmt.Errorf("invalid DNS message length")
+	}
+
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(b[2:]))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := dohClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("the DNS over HTTPS server returned %s", resp.Status)
+	}
+	msg, err := io.ReadAll(io.LimitReader(resp.Body, 65535))
+	if err != nil {
+		return 0, err
+	}
+	c.response.Reset(append(binary.BigEndian.AppendUint16(nil, uint16(len(msg))), msg...))
+	return len(b), nil
+}
+
+// Read returns the length prefixed DNS response
+func (c *dohConn) Read(b []byte) (int, error) {
+	return c.response.Read(b)
+}
+
+// Close is a no-op because the underlying HTTP connections are managed by the HTTP client
+func (c *dohConn) Close() error { return nil }
+
+// LocalAddr is not applicable to DNS over HTTPS
+func (c *dohConn) LocalAddr() net.Addr { return nil }
+
+// RemoteAddr is not applicable to DNS over HTTPS
+func (c *dohConn) RemoteAddr() net.Addr { return nil }
+
+// SetDeadline sets the deadline for the DNS over HTTPS request
+func (c *dohConn) SetDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+// SetReadDeadline is not applicable because the response is read during Write
+func (c *dohConn) SetReadDeadline(time.Time) error { return nil }
+
+// SetWriteDeadline sets the deadline for the DNS over HTTPS request
+func (c *dohConn) SetWriteDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
@@ -0,0 +1,105 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Rotation is a list of values, such as URI paths or User-Agent strings, where a weighted random value is selected for
+// every request so that each check in does not have an identical signature
+type Rotation struct {
+	values  []string
+	weights []int
+	total   int
+}
+
+// NewRotation parses a list of values into a Rotation. Each value can end with a |weight (e.g., /news.php|3) that makes
+// it proportionally more likely to be selected; values without a weight have a weight of 1.
+// Empty values are ignored and nil is returned if the list has no values.
+func NewRotation(list []string) (*Rotation, error) {
+	r := &Rotation{}
+	for _, entry := range list {
+		value := strings.TrimSpace(entry)
+		weight := 1
+		if i := strings.LastIndex(value, "|"); i >= 0 {
+			w, err := strconv.Atoi(strings.TrimSpace(value[i+1:]))
+			if err != nil || w < 1 {
+				return nil, fmt.Errorf("the rotation entry %s does not have a weight that is an integer greater than 0", entry)
+			}
+			value = strings.TrimSpace(value[:i])
+			weight = w
+		}
+		if value == "" {
+			continue
+		}
+		r.values = append(r.values, value)
+		r.weights = append(r.weights, weight)
+		r.total += weight
+	}
+	if len(r.values) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// Next returns a weighted random value from the Rotation
+func (r *Rotation) Next() string {
+	// #nosec G404 -- Random number does not impact security
+	n := rand.Intn(r.total)
+	for i, weight := range r.weights {
+		if n < weight {
+			return r.values[i]
+		}
+		n -= weight
+	}
+	return r.values[len(r.values)-1]
+}
+
+// String returns the Rotation's values and their weights
+func (r *Rotation) String() string {
+	if r == nil {
+		return ""
+	}
+	var entries []string
+	for i, value := range r.values {
+		entries = append(entries, fmt.Sprintf("%s|%d", value, r.weights[i]))
+	}
+	return strings.Join(entries, ", ")
+}
+
+// WithPath replaces the path, and query, of a URL with a URI path from a Rotation (e.g., /news.php?id=7)
+func WithPath(rawURL, path string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("there was an error parsing the URL %s: %s", rawURL, err)
+	}
+	p, err := url.Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("there was an error parsing the URI path %s: %s", path, err)
+	}
+	u.Path = p.Path
+	u.RawPath = p.RawPath
+	u.RawQuery = p.RawQuery
+	return u.String(), nil
+}
@@ -0,0 +1,75 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"testing"
+)
+
+// TestNewRotation ensures that rotation entries are parsed with their optional weights and invalid weights are rejected
+func TestNewRotation(t *testing.T) {
+	tests := []struct {
+		name   string
+		list   []string
+		want   string
+		hasErr bool
+	}{
+		{"unweighted", []string{"/a", "/b"}, "/a|1, /b|1", false},
+		{"weighted", []string{"/news.php|3", " /index.html | 2 "}, "/news.php|3, /index.html|2", false},
+		{"query and pipe", []string{"/q?a=b|c|4"}, "/q?a=b|c|4", false},
+		{"empty values", []string{"", " ", "|2"}, "", false},
+		{"zero weight", []string{"/a|0"}, "", true},
+		{"negative weight", []string{"/a|-1"}, "", true},
+		{"non-numeric weight", []string{"/a|x"}, "", true},
+	}
+	for _, test := range tests {
+		r, err := NewRotation(test.list)
+		if test.hasErr {
+			if err == nil {
+				t.Errorf("%s: expected an error but received none", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if r.String() != test.want {
+			t.Errorf("%s: expected %q but received %q", test.name, test.want, r.String())
+		}
+	}
+}
+
+// TestRotationNext ensures that a weighted rotation only returns its values and favors the heavier value
+func TestRotationNext(t *testing.T) {
+	r, err := NewRotation([]string{"/a|9", "/b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		counts[r.Next()]++
+	}
+	if len(counts) != 2 || counts["/a"]+counts["/b"] != 1000 {
+		t.Fatalf("expected only /a and /b but received %v", counts)
+	}
+	if counts["/a"] <= counts["/b"] {
+		t.Errorf("expected /a to be selected more often than /b but received %v", counts)
+	}
+}
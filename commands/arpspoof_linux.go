@@ -0,0 +1,99 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"net"
+	"os"
+	"strings"
+
+	// X Packages
+	"golang.org/x/sys/unix"
+)
+
+// ipForwardPath controls IPv4 forwarding between interfaces
+const ipForwardPath = "/proc/sys/net/ipv4/ip_forward"
+
+// arpPacketSocket is an AF_PACKET socket bound to the ARP protocol on one interface
+type arpPacketSocket struct {
+	fd    int
+	index int
+	buf   []byte
+}
+
+// openARP opens an AF_PACKET socket that receives ARP frames on the interface. It requires root or CAP_NET_RAW
+func openARP(iface *net.Interface) (arpSocket, error) {
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(unix.ETH_P_ARP)))
+	if err != nil {
+		return nil, err
+	}
+	if err = unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_ARP), Ifindex: iface.Index}); err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	if err = unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Usec: 200000}); err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	return &arpPacketSocket{fd: fd, index: iface.Index, buf: make([]byte, 1514)}, nil
+}
+
+// WriteFrame sends an Ethernet frame out of the interface
+func (s *arpPacketSocket) WriteFrame(frame []byte) error {
+	addr := &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_ARP), Ifindex: s.index, Halen: 6}
+	copy(addr.Addr[:], frame[:6])
+	return unix.Sendto(s.fd, frame, 0, addr)
+}
+
+// ReadFrame returns the next ARP frame or nil if none arrived before the read timeout
+func (s *arpPacketSocket) ReadFrame() ([]byte, error) {
+	n, _, err := unix.Recvfrom(s.fd, s.buf, 0)
+	if err == unix.EAGAIN || err == unix.EINTR {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), s.buf[:n]...), nil
+}
+
+// Close releases the socket
+func (s *arpPacketSocket) Close() error {
+	return unix.Close(s.fd)
+}
+
+// setIPForwarding sets the kernel's IPv4 forwarding and returns if it was already enabled
+func setIPForwarding(enable bool) (bool, error) {
+	data, err := os.ReadFile(ipForwardPath)
+	if err != nil {
+		return false, err
+	}
+	previous := strings.TrimSpace(string(data)) == "1"
+	if previous == enable {
+		return previous, nil
+	}
+	value := "0"
+	if enable {
+		value = "1"
+	}
+	return previous, os.WriteFile(ipForwardPath, []byte(value), 0644)
+}
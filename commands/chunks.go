@@ -0,0 +1,80 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+)
+
+// defaultChunkMB is the size, in megabytes, of each file transfer when a chunk size is not provided
+const defaultChunkMB = 10
+
+// stageTransfer describes a staged file and the parts of chunk megabytes it is retrieved in, named
+// <name>.<id>.partNNNofNNN, with the SHA256 hash of the file and each part so the server side can verify and reassemble
+// them. The server completes a job when it receives the job's first file transfer and rejects any others, so a file
+// that fits in one part is returned as the job's file transfer and a larger file is retrieved one part per
+// "staging download" job
+func stageTransfer(name, id string, data []byte, chunk int) (summary string, transfer *jobs.FileTransfer) {
+	summary = fmt.Sprintf("Staged %s (%d bytes) as %s, SHA256 %x\n", name, len(data), id, sha256.Sum256(data))
+	parts := chunkCount(len(data), chunk)
+	for i := 1; i <= parts; i++ {
+		location, part := chunkPart(name, id, data, chunk, i)
+		summary += fmt.Sprintf("  %s %d bytes SHA256 %x\n", location, len(part), sha256.Sum256(part))
+	}
+	if parts == 1 {
+		location, part := chunkPart(name, id, data, chunk, 1)
+		return summary, &jobs.FileTransfer{
+			FileLocation: location,
+			FileBlob:     base64.StdEncoding.EncodeToString(part),
+			IsDownload:   true,
+		}
+	}
+	summary += fmt.Sprintf("Retrieve each part with \"staging download %s <part> %d\"\n", id, chunk)
+	return
+}
+
+// chunkCount returns the number of parts of chunk megabytes the data is split into, at least one
+func chunkCount(size, chunk int) int {
+	bytes := chunk * 1024 * 1024
+	if parts := (size + bytes - 1) / bytes; parts > 1 {
+		return parts
+	}
+	return 1
+}
+
+// chunkPart returns the file name and data of the part, numbered from one, of chunk megabytes of a staged file. The
+// part is empty if it is past the end of the data
+func chunkPart(name, id string, data []byte, chunk, part int) (string, []byte) {
+	size := chunk * 1024 * 1024
+	parts := chunkCount(len(data), chunk)
+	location := fmt.Sprintf("%s.%s.part%03dof%03d", name, id, part, parts)
+	start, end := (part-1)*size, part*size
+	if part < 1 || start >= len(data) {
+		return location, nil
+	}
+	if end > len(data) {
+		end = len(data)
+	}
+	return location, data[start:end]
+}
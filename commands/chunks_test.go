@@ -0,0 +1,103 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// TestChunkCount ensures that data is split into the number of parts of chunk megabytes it needs, at least one
+func TestChunkCount(t *testing.T) {
+	mb := 1024 * 1024
+	tests := []struct {
+		size  int
+		chunk int
+		want  int
+	}{
+		{0, 1, 1},
+		{1, 1, 1},
+		{mb, 1, 1},
+		{mb + 1, 1, 2},
+		{5*mb + 1, 2, 3},
+		{10 * mb, 10, 1},
+	}
+	for _, test := range tests {
+		if got := chunkCount(test.size, test.chunk); got != test.want {
+			t.Errorf("chunkCount(%d, %d): expected %d but received %d", test.size, test.chunk, test.want, got)
+		}
+	}
+}
+
+// TestChunkPart ensures that each part is named with its number and the part count and holds its range of the data
+func TestChunkPart(t *testing.T) {
+	mb := 1024 * 1024
+	data := bytes.Repeat([]byte{'a'}, 2*mb+10)
+	tests := []struct {
+		part     int
+		location string
+		size     int
+	}{
+		{1, "file.txt.id.part001of003", mb},
+		{2, "file.txt.id.part002of003", mb},
+		{3, "file.txt.id.part003of003", 10},
+		{4, "file.txt.id.part004of003", 0},
+		{0, "file.txt.id.part000of003", 0},
+	}
+	for _, test := range tests {
+		location, part := chunkPart("file.txt", "id", data, 1, test.part)
+		if location != test.location {
+			t.Errorf("part %d: expected %s but received %s", test.part, test.location, location)
+		}
+		if len(part) != test.size {
+			t.Errorf("part %d: expected %d bytes but received %d", test.part, test.size, len(part))
+		}
+	}
+}
+
+// TestStageTransfer ensures that data that fits in one part is returned as a file transfer and larger data is left to
+// be retrieved a part at a time with staging download
+func TestStageTransfer(t *testing.T) {
+	mb := 1024 * 1024
+	summary, transfer := stageTransfer("small.bin", "id", []byte("data"), 1)
+	if transfer == nil {
+		t.Fatal("expected a file transfer for data that fits in one part")
+	}
+	if transfer.FileLocation != "small.bin.id.part001of001" || !transfer.IsDownload {
+		t.Errorf("unexpected file transfer %s download %t", transfer.FileLocation, transfer.IsDownload)
+	}
+	if transfer.FileBlob != base64.StdEncoding.EncodeToString([]byte("data")) {
+		t.Errorf("unexpected file transfer data %s", transfer.FileBlob)
+	}
+	if strings.Contains(summary, "staging download") {
+		t.Errorf("expected no staging download instructions for one part but received:\n%s", summary)
+	}
+
+	summary, transfer = stageTransfer("large.bin", "id", make([]byte, mb+1), 1)
+	if transfer != nil {
+		t.Errorf("expected no file transfer for data larger than one part but received %s", transfer.FileLocation)
+	}
+	for _, want := range []string{"large.bin.id.part001of002", "large.bin.id.part002of002", "staging download id <part> 1"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("expected the summary to contain %q but received:\n%s", want, summary)
+		}
+	}
+}
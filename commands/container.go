@@ -0,0 +1,38 @@
+//go:build !linux
+// +build !linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"runtime"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+)
+
+// Container enumerates the Linux capabilities, security modules, and container indicators for the agent's process
+// Linux only
+func Container(cmd jobs.Command) (jobs.Results, Structured) {
+	return jobs.Results{
+		Stderr: fmt.Sprintf("the container command is not implemented for the %s operating system", runtime.GOOS),
+	}, Structured{}
+}
@@ -0,0 +1,254 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// capabilities are the Linux capability names indexed by their bit number
+// https://man7.org/linux/man-pages/man7/capabilities.7.html
+var capabilities = []string{
+	"CAP_CHOWN", "CAP_DAC_OVERRIDE", "CAP_DAC_READ_SEARCH", "CAP_FOWNER", "CAP_FSETID", "CAP_KILL", "CAP_SETGID",
+	"CAP_SETUID", "CAP_SETPCAP", "CAP_LINUX_IMMUTABLE", "CAP_NET_BIND_SERVICE", "CAP_NET_BROADCAST", "CAP_NET_ADMIN",
+	"CAP_NET_RAW", "CAP_IPC_LOCK", "CAP_IPC_OWNER", "CAP_SYS_MODULE", "CAP_SYS_RAWIO", "CAP_SYS_CHROOT",
+	"CAP_SYS_PTRACE", "CAP_SYS_PACCT", "CAP_SYS_ADMIN", "CAP_SYS_BOOT", "CAP_SYS_NICE", "CAP_SYS_RESOURCE",
+	"CAP_SYS_TIME", "CAP_SYS_TTY_CONFIG", "CAP_MKNOD", "CAP_LEASE", "CAP_AUDIT_WRITE", "CAP_AUDIT_CONTROL",
+	"CAP_SETFCAP", "CAP_MAC_OVERRIDE", "CAP_MAC_ADMIN", "CAP_SYSLOG", "CAP_WAKE_ALARM", "CAP_BLOCK_SUSPEND",
+	"CAP_AUDIT_READ", "CAP_PERFMON", "CAP_BPF", "CAP_CHECKPOINT_RESTORE",
+}
+
+// escapeCapabilities are capabilities that commonly allow a process to escape a container
+var escapeCapabilities = map[string]bool{
+	"CAP_SYS_ADMIN": true, "CAP_SYS_PTRACE": true, "CAP_SYS_MODULE": true, "CAP_DAC_READ_SEARCH": true,
+	"CAP_SYS_RAWIO": true, "CAP_NET_ADMIN": true, "CAP_BPF": true,
+}
+
+// seccompModes are the /proc/self/status Seccomp field values
+var seccompModes = map[string]string{"0": "disabled", "1": "strict", "2": "filter"}
+
+// sockets are container runtime sockets that allow control of the host's containers
+var sockets = []string{
+	"/var/run/docker.sock", "/run/docker.sock", "/run/containerd/containerd.sock", "/var/run/crio/crio.sock",
+	"/run/podman/podman.sock", "/var/run/cri-dockerd.sock",
+}
+
+// pseudoFilesystems are mounted file system types that aren't host paths
+var pseudoFilesystems = map[string]bool{
+	"proc": true, "sysfs": true, "tmpfs": true, "devpts": true, "mqueue": true, "cgroup": true, "cgroup2": true,
+	"overlay": true, "securityfs": true, "debugfs": true, "tracefs": true, "bpf": true, "devtmpfs": true,
+	"hugetlbfs": true, "pstore": true, "configfs": true, "fusectl": true, "autofs": true, "binfmt_misc": true,
+	"nsfs": true, "shm": true, "rpc_pipefs": true, "efivarfs": true, "selinuxfs": true,
+}
+
+// Container enumerates the Linux capabilities, security modules, and container indicators for the agent's process
+// so the operator knows if the agent is running in a container and what escape avenues may exist
+func Container(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Container() with %+v", cmd))
+	}
+	var findings []FindingRecord
+	add := func(category, name, value string) {
+		findings = append(findings, FindingRecord{Category: category, Name: name, Value: value})
+	}
+
+	// Capabilities and seccomp from the process status
+	status, err := procStatus()
+	if err != nil {
+		results.Stderr = fmt.Sprintf("there was an error reading the process status: %s\n", err)
+	}
+	for _, set := range []string{"CapEff", "CapPrm", "CapInh", "CapBnd", "CapAmb"} {
+		if mask, ok := status[set]; ok {
+			add("capabilities", set, strings.Join(capabilityNames(mask), ","))
+		}
+	}
+	if mask, ok := status["CapEff"]; ok {
+		var escape []string
+		for _, name := range capabilityNames(mask) {
+			if escapeCapabilities[name] {
+				escape = append(escape, name)
+			}
+		}
+		if len(escape) > 0 {
+			add("escape", "Effective Capabilities", strings.Join(escape, ","))
+		}
+	}
+	if mode, ok := status["Seccomp"]; ok {
+		add("security", "Seccomp", seccompModes[mode])
+	}
+	if nnp, ok := status["NoNewPrivs"]; ok {
+		add("security", "NoNewPrivs", nnp)
+	}
+
+	// Linux Security Modules
+	if profile := readTrimmed("/proc/self/attr/apparmor/current"); profile != "" {
+		add("security", "AppArmor", profile)
+	} else if _, err = os.Stat("/sys/kernel/security/apparmor"); err == nil {
+		add("security", "AppArmor", readTrimmed("/proc/self/attr/current"))
+	}
+	if enforce := readTrimmed("/sys/fs/selinux/enforce"); enforce != "" {
+		mode := "permissive"
+		if enforce == "1" {
+			mode = "enforcing"
+		}
+		add("security", "SELinux", fmt.Sprintf("%s %s", mode, readTrimmed("/proc/self/attr/current")))
+	}
+
+	// Container indicators
+	container := false
+	for _, file := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err = os.Stat(file); err == nil {
+			add("container", "Indicator File", file)
+			container = true
+		}
+	}
+	for _, line := range strings.Split(readTrimmed("/proc/1/cgroup"), "\n") {
+		for _, name := range []string{"docker", "kubepods", "containerd", "crio", "libpod", "lxc"} {
+			if strings.Contains(line, name) {
+				add("container", "Control Group", line)
+				container = true
+				break
+			}
+		}
+	}
+	if v := os.Getenv("container"); v != "" {
+		add("container", "Runtime", v)
+		container = true
+	}
+	if host := os.Getenv("KUBERNETES_SERVICE_HOST"); host != "" {
+		add("container", "Kubernetes API", fmt.Sprintf("%s:%s", host, os.Getenv("KUBERNETES_SERVICE_PORT")))
+		container = true
+	}
+	if _, err = os.Stat("/var/run/secrets/kubernetes.io/serviceaccount/token"); err == nil {
+		add("container", "Kubernetes Service Account", "/var/run/secrets/kubernetes.io/serviceaccount")
+		container = true
+	}
+	if pid1 := readTrimmed("/proc/1/comm"); pid1 != "" {
+		add("container", "PID 1", pid1)
+	}
+	add("container", "In Container", strconv.FormatBool(container))
+
+	// Runtime sockets and host paths mounted into the agent's mount namespace
+	for _, socket := range sockets {
+		if _, err = os.Stat(socket); err == nil {
+			add("escape", "Runtime Socket", socket)
+		}
+	}
+	mounts, err := hostMounts()
+	if err != nil {
+		results.Stderr += fmt.Sprintf("there was an error reading the mounts: %s\n", err)
+	}
+	for _, mount := range mounts {
+		add("mounts", "Host Mount", mount)
+	}
+
+	results.Stdout = findingsText(findings)
+	structured = newStructured("container", findings)
+	return
+}
+
+// procStatus returns the fields from the /proc/self/status file
+func procStatus() (map[string]string, error) {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	status := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(scanner.Text(), ":"); ok {
+			status[key] = strings.TrimSpace(value)
+		}
+	}
+	return status, scanner.Err()
+}
+
+// capabilityNames decodes a hexadecimal capability mask into capability names
+func capabilityNames(mask string) (names []string) {
+	bits, err := strconv.ParseUint(mask, 16, 64)
+	if err != nil {
+		return []string{mask}
+	}
+	for i := 0; i < 64; i++ {
+		if bits&(1<<uint(i)) == 0 {
+			continue
+		}
+		if i < len(capabilities) {
+			names = append(names, capabilities[i])
+		} else {
+			names = append(names, fmt.Sprintf("CAP_%d", i))
+		}
+	}
+	return
+}
+
+// hostMounts returns the mounts, from /proc/self/mountinfo, that are not pseudo file systems and could be host paths
+// https://man7.org/linux/man-pages/man5/proc.5.html
+func hostMounts() (mounts []string, err error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(scanner.Text())
+		sep := -1
+		for i, field := range fields {
+			if field == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 0 || len(fields) < sep+3 || len(fields) < 6 {
+			continue
+		}
+		fsType := fields[sep+1]
+		if pseudoFilesystems[fsType] {
+			continue
+		}
+		options := strings.Split(fields[5], ",")[0]
+		mounts = append(mounts, fmt.Sprintf("%s (%s) on %s type %s %s", fields[3], fields[sep+2], fields[4], fsType, options))
+	}
+	return mounts, scanner.Err()
+}
+
+// readTrimmed returns the contents of the file without surrounding whitespace, or an empty string if it can't be read
+func readTrimmed(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(data), "\x00"))
+}
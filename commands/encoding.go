@@ -0,0 +1,176 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	// X Packages
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// codePages maps Windows code page identifiers to their character encoding
+// https://learn.microsoft.com/en-us/windows/win32/intl/code-page-identifiers
+var codePages = map[int]encoding.Encoding{
+	437:   charmap.CodePage437,
+	850:   charmap.CodePage850,
+	852:   charmap.CodePage852,
+	855:   charmap.CodePage855,
+	858:   charmap.CodePage858,
+	860:   charmap.CodePage860,
+	862:   charmap.CodePage862,
+	863:   charmap.CodePage863,
+	865:   charmap.CodePage865,
+	866:   charmap.CodePage866,
+	874:   charmap.Windows874,
+	932:   japanese.ShiftJIS,
+	936:   simplifiedchinese.GBK,
+	949:   korean.EUCKR,
+	950:   traditionalchinese.Big5,
+	1200:  unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	1250:  charmap.Windows1250,
+	1251:  charmap.Windows1251,
+	1252:  charmap.Windows1252,
+	1253:  charmap.Windows1253,
+	1254:  charmap.Windows1254,
+	1255:  charmap.Windows1255,
+	1256:  charmap.Windows1256,
+	1257:  charmap.Windows1257,
+	1258:  charmap.Windows1258,
+	20866: charmap.KOI8R,
+	21866: charmap.KOI8U,
+	28591: charmap.ISO8859_1,
+	54936: simplifiedchinese.GB18030,
+	65001: encoding.Nop,
+}
+
+// outputEncoding is the character encoding of process output that is transcoded to UTF-8 before it is returned.
+// "auto" detects UTF-16LE and decodes output that isn't valid UTF-8 with the host's OEM code page.
+var outputEncoding = "auto"
+
+// outputMu protects the outputEncoding variable
+var outputMu sync.RWMutex
+
+// SetOutputEncoding sets the character encoding used to transcode process output to UTF-8.
+// Valid values are "auto", "utf-8", "utf-16le", or a Windows code page identifier (e.g., 850, cp866, or 932)
+func SetOutputEncoding(enc string) error {
+	enc = strings.ToLower(strings.TrimSpace(enc))
+	switch enc {
+	case "", "auto":
+		enc = "auto"
+	case "utf-8", "utf8", "none":
+		enc = "cp65001"
+	case "utf-16", "utf-16le", "utf16", "utf16le", "unicode":
+		enc = "cp1200"
+	default:
+		cp, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(enc, "cp"), "windows-"))
+		if err != nil {
+			return fmt.Errorf("%s is not a valid output encoding, use auto, utf-8, utf-16le, or a code page number", enc)
+		}
+		if _, ok := codePages[cp]; !ok {
+			return fmt.Errorf("code page %d is not supported", cp)
+		}
+		enc = fmt.Sprintf("cp%d", cp)
+	}
+	outputMu.Lock()
+	outputEncoding = enc
+	outputMu.Unlock()
+	return nil
+}
+
+// OutputEncoding returns the character encoding used to transcode process output
+func OutputEncoding() string {
+	outputMu.RLock()
+	defer outputMu.RUnlock()
+	if outputEncoding == "auto" && oemCodePage() > 0 {
+		return fmt.Sprintf("auto (OEM code page %d)", oemCodePage())
+	}
+	return outputEncoding
+}
+
+// transcode converts process output from the configured character encoding to a UTF-8 string. Binary output is
+// encoded with the configured binary output format instead
+func transcode(out []byte) string {
+	if wrapped := wrapBinary(out); wrapped != nil {
+		return string(wrapped)
+	}
+	outputMu.RLock()
+	enc := outputEncoding
+	outputMu.RUnlock()
+
+	var decoder encoding.Encoding
+	if enc == "auto" {
+		switch {
+		case isUTF16LE(out):
+			decoder = codePages[1200]
+		case utf8.Valid(out):
+			return string(out)
+		default:
+			var ok bool
+			if decoder, ok = codePages[oemCodePage()]; !ok {
+				return string(out)
+			}
+		}
+	} else {
+		cp, _ := strconv.Atoi(strings.TrimPrefix(enc, "cp"))
+		decoder = codePages[cp]
+	}
+
+	utf, err := decoder.NewDecoder().Bytes(out)
+	if err != nil {
+		return string(out)
+	}
+	return string(utf)
+}
+
+// isUTF16LE uses a byte order mark or the ratio of NULL bytes to determine if the data is UTF-16LE encoded text,
+// as written by programs such as cmd.exe /u or PowerShell redirection
+func isUTF16LE(data []byte) bool {
+	if len(data) >= 2 && data[0] == 0xFF && data[1] == 0xFE {
+		return true
+	}
+	if len(data) < 4 || len(data)%2 != 0 {
+		return false
+	}
+	sample := data
+	if len(sample) > 512 {
+		sample = sample[:512]
+	}
+	var odd, even int
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 {
+			even++
+		}
+		if sample[i+1] == 0 {
+			odd++
+		}
+	}
+	// Latin script UTF-16LE text has a NULL high byte for nearly every character
+	return even == 0 && odd*2 >= len(sample)/2
+}
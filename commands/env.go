@@ -29,7 +29,9 @@ import (
 
 // env is used to view or modify a host's environment variables
 func env(Args []string) (resp string, stderr string) {
-	cli.Message(cli.DEBUG, fmt.Sprintf("entering ENV() with args: %+v...", Args))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering ENV() with args: %+v...", Args))
+	}
 	if len(Args) > 0 {
 		switch strings.ToLower(Args[0]) {
 		case "get":
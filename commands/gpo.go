@@ -0,0 +1,156 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// adReconTimeout is how long each LDAP request to the domain controller can take
+const adReconTimeout = 30 * time.Second
+
+// groupPolicy is a Group Policy Object and the containers it is linked to
+type groupPolicy struct {
+	name    string // The GUID in braces
+	display string
+	path    string
+	dacl    []accessEntry
+	linked  []string
+}
+
+// GPO lists the domain's Group Policy Objects and audits their permissions over LDAP. Principals other than the
+// domain's administrators that can modify a GPO can run code on every computer or user in the containers it is
+// linked to. Only the directory object's DACL is audited, not the files in SYSVOL
+// gpo list <dc> <domain> <user> <password>
+// gpo permissions <dc> <domain> <user> <password>
+func GPO(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering GPO() with %+v", cmd))
+	}
+	if len(cmd.Args) < 5 {
+		results.Stderr = fmt.Sprintf("expected 5 arguments for the gpo command, received %d", len(cmd.Args))
+		return
+	}
+	dc, domain := cmd.Args[1], cmd.Args[2]
+	conn, err := ldapLogin(dc, domain, cmd.Args[3], cmd.Args[4], adReconTimeout)
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+	defer conn.Close()
+	policies, err := groupPolicies(conn, domain)
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+
+	var findings []FindingRecord
+	switch strings.ToLower(cmd.Args[0]) {
+	case "list":
+		for _, gpo := range policies {
+			category := fmt.Sprintf("%s %s", gpo.display, gpo.name)
+			findings = append(findings, FindingRecord{Category: category, Name: "Path", Value: gpo.path})
+			findings = append(findings, FindingRecord{Category: category, Name: "Linked", Value: linkedText(gpo.linked)})
+		}
+	case "permissions":
+		var sids []string
+		for _, gpo := range policies {
+			for _, entry := range gpo.dacl {
+				sids = append(sids, entry.SID)
+			}
+		}
+		names := resolveSIDs(conn, domain, sids)
+		for _, gpo := range policies {
+			category := fmt.Sprintf("%s %s", gpo.display, gpo.name)
+			var found bool
+			for _, entry := range gpo.dacl {
+				rights := entry.rights()
+				if len(rights) == 0 || privilegedSID(entry.SID) {
+					continue
+				}
+				value := strings.Join(rights, ", ")
+				if entry.ObjectType != "" {
+					value += " on " + entry.ObjectType
+				}
+				findings = append(findings, FindingRecord{Category: category, Name: fmt.Sprintf("%s (%s)", names[entry.SID], entry.SID), Value: value})
+				found = true
+			}
+			if found {
+				findings = append(findings, FindingRecord{Category: category, Name: "Linked", Value: linkedText(gpo.linked)})
+			}
+		}
+		if len(findings) == 0 {
+			results.Stdout = fmt.Sprintf("none of the %d GPOs can be modified by principals other than the domain administrators", len(policies))
+			return
+		}
+	default:
+		results.Stderr = fmt.Sprintf("unknown gpo command: %s", cmd.Args[0])
+		return
+	}
+	results.Stdout = findingsText(findings)
+	structured = newStructured("gpo", findings)
+	return
+}
+
+// groupPolicies returns the domain's Group Policy Objects with their DACL and the containers they are linked to
+func groupPolicies(conn *ldapConn, domain string) (policies []groupPolicy, err error) {
+	base := domainDN(domain)
+	entries, err := conn.search("CN=Policies,CN=System,"+base, ldapEquals("objectClass", "groupPolicyContainer"),
+		[]string{"name", "displayName", "gPCFileSysPath", "nTSecurityDescriptor"}, sdFlagsControl)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error searching for GPOs: %s", err)
+	}
+	links, err := conn.search(base, ldapPresent("gPLink"), []string{"gPLink"})
+	if err != nil {
+		return nil, fmt.Errorf("there was an error searching for GPO links: %s", err)
+	}
+	for _, entry := range entries {
+		gpo := groupPolicy{name: entry.get("name"), display: entry.get("displayName"), path: entry.get("gPCFileSysPath")}
+		if sd := entry.get("nTSecurityDescriptor"); sd != "" {
+			if gpo.dacl, err = parseDACL([]byte(sd)); err != nil {
+				return nil, fmt.Errorf("there was an error parsing the security descriptor of %s: %s", gpo.name, err)
+			}
+		}
+		for _, link := range links {
+			if strings.Contains(strings.ToLower(link.get("gPLink")), strings.ToLower(gpo.name)) {
+				gpo.linked = append(gpo.linked, link.DN)
+			}
+		}
+		policies = append(policies, gpo)
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].display < policies[j].display })
+	return policies, nil
+}
+
+// linkedText describes the containers a GPO is linked to
+func linkedText(linked []string) string {
+	if len(linked) == 0 {
+		return "not linked"
+	}
+	return strings.Join(linked, "; ")
+}
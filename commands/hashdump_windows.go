@@ -0,0 +1,108 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/netapi32"
+)
+
+// TIMEQ_FOREVER is the value NetUserModalsGet returns for a setting that never expires
+const TIMEQ_FOREVER = 0xFFFFFFFF
+
+// Hashdump enumerates local accounts and returns the local password and lockout policy. Windows password hashes are
+// stored in the SAM and are not returned, use the minidump or registry based tools for them
+func Hashdump(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Hashdump() with %+v", cmd))
+	}
+	var dump HashdumpRecord
+	add := func(name, value string) {
+		dump.Policy = append(dump.Policy, FindingRecord{Category: "policy", Name: name, Value: value})
+	}
+	seconds := func(s uint32) string {
+		if s == TIMEQ_FOREVER {
+			return "never"
+		}
+		return strconv.FormatUint(uint64(s), 10) + "s"
+	}
+
+	var password netapi32.USER_MODALS_INFO_0
+	if err := netapi32.NetUserModalsGet(0, &password); err != nil {
+		results.Stderr = err.Error()
+	} else {
+		add("Minimum Password Length", strconv.Itoa(int(password.MinPasswdLen)))
+		add("Maximum Password Age", seconds(password.MaxPasswdAge))
+		add("Minimum Password Age", seconds(password.MinPasswdAge))
+		add("Force Logoff", seconds(password.ForceLogoff))
+		add("Password History Length", strconv.Itoa(int(password.PasswordHistLen)))
+	}
+	var lockout netapi32.USER_MODALS_INFO_3
+	if err := netapi32.NetUserModalsGet(3, &lockout); err != nil {
+		results.Stderr += err.Error()
+	} else {
+		add("Lockout Threshold", strconv.Itoa(int(lockout.LockoutThreshold)))
+		add("Lockout Duration", seconds(lockout.LockoutDuration))
+		add("Lockout Observation Window", seconds(lockout.LockoutObservationWindow))
+	}
+
+	users, err := netapi32.NetUserEnum()
+	if err != nil {
+		results.Stderr += err.Error()
+	}
+	privileges := []string{"guest", "user", "admin"}
+	for _, user := range users {
+		// UF_ACCOUNTDISABLE 0x2, UF_LOCKOUT 0x10
+		account := AccountRecord{
+			Name:       windows.UTF16PtrToString(user.Name),
+			Privilege:  privileges[user.Priv%3],
+			Home:       windows.UTF16PtrToString(user.HomeDir),
+			Comment:    windows.UTF16PtrToString(user.Comment),
+			Locked:     user.Flags&0x2 != 0 || user.Flags&0x10 != 0,
+			LastChange: fmt.Sprintf("%d days ago", user.PasswordAge/86400),
+		}
+		dump.Accounts = append(dump.Accounts, account)
+	}
+
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Name\tPrivilege\tDisabled/Locked\tPassword Changed\tComment")
+	for _, a := range dump.Accounts {
+		fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\n", a.Name, a.Privilege, a.Locked, a.LastChange, a.Comment)
+	}
+	_ = w.Flush()
+	results.Stdout = sb.String() + "\n" + findingsText(dump.Policy)
+	structured = newStructured("hashdump", dump)
+	return
+}
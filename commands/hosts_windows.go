@@ -0,0 +1,52 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"path/filepath"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+// hostsPath returns the path to the system hosts file
+func hostsPath() string {
+	root := os.Getenv("SystemRoot")
+	if root == "" {
+		root = "C:\\Windows"
+	}
+	return filepath.Join(root, "System32", "drivers", "etc", "hosts")
+}
+
+// flushDNS clears the DNS Client service's cache, the same as ipconfig /flushdns
+func flushDNS() (string, error) {
+	proc := windows.NewLazySystemDLL("dnsapi.dll").NewProc("DnsFlushResolverCache")
+	if err := proc.Find(); err != nil {
+		return "", err
+	}
+	if ret, _, err := proc.Call(); ret == 0 {
+		return "", fmt.Errorf("DnsFlushResolverCache failed: %s", err)
+	}
+	return "Flushed the DNS resolver cache\n", nil
+}
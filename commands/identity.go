@@ -0,0 +1,39 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"strings"
+)
+
+// remote determines if the path is on another host, such as a UNC path to an SMB share, where accessing it
+// authenticates with the agent's network identity
+func remote(path string) bool {
+	return strings.HasPrefix(path, `\\`) || strings.HasPrefix(path, "//")
+}
+
+// identityNote returns a line reporting the network identity used to access a remote path, or an empty string for a
+// local path. Setup must have been called so the note reflects the token that was applied
+func identityNote(path string) string {
+	if !remote(path) {
+		return ""
+	}
+	return fmt.Sprintf("Network Identity: %s\n", networkIdentity())
+}
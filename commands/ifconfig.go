@@ -26,22 +26,36 @@ import (
 )
 
 // ifconfig enumerates the network interfaces and their configuration
-func ifconfig() (stdout string, err error) {
+func ifconfig() (stdout string, records []InterfaceRecord, err error) {
 	ifaces, err := net.Interfaces()
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
+	// DHCP is left out if it can't be determined
+	dhcp, _ := dhcpInterfaces()
+
 	for _, i := range ifaces {
 		stdout += fmt.Sprintf("%s\n", i.Name)
 		stdout += fmt.Sprintf("  MAC Address\t%s\n", i.HardwareAddr.String())
+		stdout += fmt.Sprintf("  MTU\t\t%d\n", i.MTU)
+		record := InterfaceRecord{Name: i.Name, MAC: i.HardwareAddr.String(), MTU: i.MTU, DHCP: dhcp[i.Index]}
 		addrs, err := i.Addrs()
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 		for _, a := range addrs {
 			stdout += fmt.Sprintf("  IP Address\t%s\n", a.String())
+			record.Addresses = append(record.Addresses, a.String())
+		}
+		if dhcp != nil && len(record.Addresses) > 0 {
+			if dhcp[i.Index] {
+				stdout += "  DHCP\t\tEnabled\n"
+			} else {
+				stdout += "  DHCP\t\tDisabled (static)\n"
+			}
 		}
+		records = append(records, record)
 	}
-	return stdout, nil
+	return stdout, records, nil
 }
@@ -28,13 +28,13 @@ import (
 
 // ifconfig enumerates the network interfaces and their configuration
 // Much of this is ripped from interface_windows.go
-func ifconfig() (stdout string, err error) {
+func ifconfig() (stdout string, records []InterfaceRecord, err error) {
 	fSize := uint32(0)
 	b := make([]byte, 1000)
 
 	ifaces, err := net.Interfaces()
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	var adapterInfo *syscall.IpAdapterInfo
@@ -47,7 +47,7 @@ func ifconfig() (stdout string, err error) {
 		adapterInfo = (*syscall.IpAdapterInfo)(unsafe.Pointer(&b[0]))
 		err = syscall.GetAdaptersInfo(adapterInfo, &fSize)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 	}
 
@@ -56,29 +56,36 @@ func ifconfig() (stdout string, err error) {
 			if int(ainfo.Index) == iface.Index {
 				stdout += fmt.Sprintf("%s\n", iface.Name)
 				stdout += fmt.Sprintf("  MAC Address\t%s\n", iface.HardwareAddr.String())
+				stdout += fmt.Sprintf("  MTU\t\t%d\n", iface.MTU)
+				record := InterfaceRecord{Name: iface.Name, MAC: iface.HardwareAddr.String(), MTU: iface.MTU}
 				ipentry := &ainfo.IpAddressList
 				for ; ipentry != nil; ipentry = ipentry.Next {
 					stdout += fmt.Sprintf("  IP Address\t%s\n", ipentry.IpAddress.String)
 					stdout += fmt.Sprintf("  Subnet Mask\t%s\n", ipentry.IpMask.String)
+					record.Addresses = append(record.Addresses, fmt.Sprintf("%s/%s", StringFromNullTerminated(ipentry.IpAddress.String[:]), StringFromNullTerminated(ipentry.IpMask.String[:])))
 				}
 				gateways := &ainfo.GatewayList
 				for ; gateways != nil; gateways = gateways.Next {
 					stdout += fmt.Sprintf("  Gateway\t%s\n", gateways.IpAddress.String)
+					record.Gateways = append(record.Gateways, StringFromNullTerminated(gateways.IpAddress.String[:]))
 				}
 
 				if ainfo.DhcpEnabled != 0 {
 					stdout += fmt.Sprintf("  DHCP\t\tEnabled\n")
+					record.DHCP = true
 					dhcpServers := &ainfo.DhcpServer
 					for ; dhcpServers != nil; dhcpServers = dhcpServers.Next {
 						stdout += fmt.Sprintf("  DHCP Server:\t%s\n", dhcpServers.IpAddress.String)
+						record.DHCPServers = append(record.DHCPServers, StringFromNullTerminated(dhcpServers.IpAddress.String[:]))
 					}
 				} else {
-					stdout += fmt.Sprintf("  DHCP\t\tDisabled\n")
+					stdout += fmt.Sprintf("  DHCP\t\tDisabled (static)\n")
 				}
 				stdout += "\n"
+				records = append(records, record)
 			}
 		}
 	}
 
-	return stdout, nil
+	return stdout, records, nil
 }
@@ -0,0 +1,121 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ifconfigControl adds or removes an IP address on an interface, or a route, so an operator can reach a subnet that
+// the host is connected to but not configured for. Changing the configuration requires root or Administrator
+// ifconfig add <interface> <address/prefix>
+// ifconfig del <interface> <address/prefix>
+// ifconfig route add <destination/prefix> <interface> [gateway]
+// ifconfig route del <destination/prefix> <interface> [gateway]
+func ifconfigControl(args []string) (stdout string, err error) {
+	if strings.EqualFold(args[0], "route") {
+		if len(args) < 4 {
+			return "", fmt.Errorf("the ifconfig route command requires add or del, a destination/prefix, and an interface")
+		}
+		add, err := ifconfigAction(args[1])
+		if err != nil {
+			return "", err
+		}
+		_, dst, err := net.ParseCIDR(args[2])
+		if err != nil {
+			return "", fmt.Errorf("%s is not a destination/prefix: %s", args[2], err)
+		}
+		iface, err := lookupInterface(args[3])
+		if err != nil {
+			return "", err
+		}
+		var gateway net.IP
+		if len(args) > 4 {
+			if gateway = net.ParseIP(args[4]); gateway == nil {
+				return "", fmt.Errorf("%s is not a gateway IP address", args[4])
+			}
+			if (gateway.To4() == nil) != (dst.IP.To4() == nil) {
+				return "", fmt.Errorf("the gateway %s and destination %s are not the same IP version", gateway, dst)
+			}
+		}
+		if err = routeChange(add, dst, gateway, iface); err != nil {
+			return "", fmt.Errorf("there was an error changing the route to %s: %s", dst, err)
+		}
+		via := ""
+		if gateway != nil {
+			via = fmt.Sprintf(" via %s", gateway)
+		}
+		if add {
+			return fmt.Sprintf("Added route to %s%s on %s", dst, via, iface.Name), nil
+		}
+		return fmt.Sprintf("Removed route to %s%s on %s", dst, via, iface.Name), nil
+	}
+
+	add, err := ifconfigAction(args[0])
+	if err != nil {
+		return "", err
+	}
+	if len(args) < 3 {
+		return "", fmt.Errorf("the ifconfig %s command requires an interface and an address/prefix", args[0])
+	}
+	iface, err := lookupInterface(args[1])
+	if err != nil {
+		return "", err
+	}
+	ip, network, err := net.ParseCIDR(args[2])
+	if err != nil {
+		return "", fmt.Errorf("%s is not an address/prefix: %s", args[2], err)
+	}
+	network.IP = ip
+	if err = addressChange(add, iface, network); err != nil {
+		return "", fmt.Errorf("there was an error changing the address %s on %s: %s", network, iface.Name, err)
+	}
+	if add {
+		return fmt.Sprintf("Added %s to %s", network, iface.Name), nil
+	}
+	return fmt.Sprintf("Removed %s from %s", network, iface.Name), nil
+}
+
+// ifconfigAction returns true for add and false for del
+func ifconfigAction(action string) (bool, error) {
+	switch strings.ToLower(action) {
+	case "add":
+		return true, nil
+	case "del", "delete", "remove":
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown ifconfig command: %s", action)
+}
+
+// lookupInterface returns the network interface with the name or index
+func lookupInterface(name string) (*net.Interface, error) {
+	if index, err := strconv.Atoi(name); err == nil {
+		if iface, err := net.InterfaceByIndex(index); err == nil {
+			return iface, nil
+		}
+	}
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a network interface: %s", name, err)
+	}
+	return iface, nil
+}
@@ -0,0 +1,167 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"encoding/binary"
+	"net"
+	"syscall"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/unix"
+)
+
+// nativeEndian is the host byte order that netlink messages are encoded in
+var nativeEndian = func() interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+} {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// addressChange adds or removes an IP address on an interface with an rtnetlink message, the same as ip addr
+func addressChange(add bool, iface *net.Interface, address *net.IPNet) error {
+	family, ip := netlinkFamily(address.IP)
+	prefix, _ := address.Mask.Size()
+	msg := []byte{family, uint8(prefix), 0, unix.RT_SCOPE_UNIVERSE}
+	msg = nativeEndian.AppendUint32(msg, uint32(iface.Index))
+	msg = netlinkAttr(msg, unix.IFA_LOCAL, ip)
+	msg = netlinkAttr(msg, unix.IFA_ADDRESS, ip)
+	if add {
+		return netlinkRequest(unix.RTM_NEWADDR, unix.NLM_F_CREATE|unix.NLM_F_EXCL, msg)
+	}
+	return netlinkRequest(unix.RTM_DELADDR, 0, msg)
+}
+
+// routeChange adds or removes a route in the main routing table with an rtnetlink message, the same as ip route
+func routeChange(add bool, dst *net.IPNet, gateway net.IP, iface *net.Interface) error {
+	family, ip := netlinkFamily(dst.IP)
+	prefix, _ := dst.Mask.Size()
+	scope := uint8(unix.RT_SCOPE_UNIVERSE)
+	if gateway == nil {
+		scope = unix.RT_SCOPE_LINK
+	}
+	if !add {
+		scope = unix.RT_SCOPE_NOWHERE
+	}
+	msg := []byte{family, uint8(prefix), 0, 0, unix.RT_TABLE_MAIN, unix.RTPROT_STATIC, scope, unix.RTN_UNICAST, 0, 0, 0, 0}
+	msg = netlinkAttr(msg, unix.RTA_DST, ip)
+	if gateway != nil {
+		_, gw := netlinkFamily(gateway)
+		msg = netlinkAttr(msg, unix.RTA_GATEWAY, gw)
+	}
+	msg = netlinkAttr(msg, unix.RTA_OIF, nativeEndian.AppendUint32(nil, uint32(iface.Index)))
+	if add {
+		return netlinkRequest(unix.RTM_NEWROUTE, unix.NLM_F_CREATE|unix.NLM_F_EXCL, msg)
+	}
+	return netlinkRequest(unix.RTM_DELROUTE, 0, msg)
+}
+
+// dhcpInterfaces returns the index of the interfaces with a dynamic IPv4 address. Addresses configured by hand or a
+// static network configuration are permanent while addresses leased from a DHCP server expire
+func dhcpInterfaces() (map[int]bool, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETADDR, syscall.AF_INET)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, err
+	}
+	dhcp := make(map[int]bool)
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWADDR || len(m.Data) < syscall.SizeofIfAddrmsg {
+			continue
+		}
+		if m.Data[2]&syscall.IFA_F_PERMANENT == 0 {
+			dhcp[int(nativeEndian.Uint32(m.Data[4:8]))] = true
+		}
+	}
+	return dhcp, nil
+}
+
+// netlinkFamily returns the address family and bytes of the IP address
+func netlinkFamily(ip net.IP) (uint8, []byte) {
+	if v4 := ip.To4(); v4 != nil {
+		return unix.AF_INET, v4
+	}
+	return unix.AF_INET6, ip.To16()
+}
+
+// netlinkAttr appends a route attribute, padded to four bytes, to the message
+func netlinkAttr(msg []byte, kind uint16, data []byte) []byte {
+	msg = nativeEndian.AppendUint16(msg, uint16(unix.SizeofRtAttr+len(data)))
+	msg = nativeEndian.AppendUint16(msg, kind)
+	msg = append(msg, data...)
+	for len(msg)%unix.NLMSG_ALIGNTO != 0 {
+		msg = append(msg, 0)
+	}
+	return msg
+}
+
+// netlinkRequest sends an rtnetlink request and returns the error the kernel acknowledged it with
+func netlinkRequest(kind uint16, flags uint16, body []byte) error {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	if err = unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	msg := nativeEndian.AppendUint32(nil, uint32(unix.NLMSG_HDRLEN+len(body)))
+	msg = nativeEndian.AppendUint16(msg, kind)
+	msg = nativeEndian.AppendUint16(msg, unix.NLM_F_REQUEST|unix.NLM_F_ACK|flags)
+	msg = nativeEndian.AppendUint32(msg, 1)
+	msg = nativeEndian.AppendUint32(msg, 0)
+	msg = append(msg, body...)
+	if err = unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	buf := make([]byte, unix.Getpagesize())
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return err
+		}
+		replies, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return err
+		}
+		for _, reply := range replies {
+			if reply.Header.Seq != 1 || reply.Header.Type != unix.NLMSG_ERROR || len(reply.Data) < 4 {
+				continue
+			}
+			if errno := int32(nativeEndian.Uint32(reply.Data[:4])); errno != 0 {
+				return unix.Errno(-errno)
+			}
+			return nil
+		}
+	}
+}
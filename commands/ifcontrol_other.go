@@ -0,0 +1,44 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// addressChange adds or removes an IP address on an interface
+func addressChange(add bool, iface *net.Interface, address *net.IPNet) error {
+	return fmt.Errorf("changing interface addresses is not supported on %s", runtime.GOOS)
+}
+
+// routeChange adds or removes a route
+func routeChange(add bool, dst *net.IPNet, gateway net.IP, iface *net.Interface) error {
+	return fmt.Errorf("changing routes is not supported on %s", runtime.GOOS)
+}
+
+// dhcpInterfaces returns the index of the interfaces with an address leased from DHCP; it is not known on this
+// operating system
+func dhcpInterfaces() (map[int]bool, error) {
+	return nil, nil
+}
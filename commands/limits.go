@@ -0,0 +1,152 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cleanup"
+)
+
+// limits are the CPU priority and CPU time ceiling applied to commands the agent spawns
+var limits = struct {
+	sync.RWMutex
+	nice    int           // The Unix nice level, -20 (highest) to 19 (lowest), mapped to a Windows priority class
+	ceiling time.Duration // The soft limit on CPU time a spawned command can consume, 0 is unlimited
+}{}
+
+// SetPriority sets the CPU priority of spawned commands from a nice level or one of idle, low, normal, or high
+func SetPriority(level string) error {
+	var nice int
+	switch strings.ToLower(level) {
+	case "idle":
+		nice = 19
+	case "low":
+		nice = 10
+	case "normal":
+		nice = 0
+	case "high":
+		nice = -10
+	default:
+		var err error
+		nice, err = strconv.Atoi(level)
+		if err != nil {
+			return fmt.Errorf("there was an error parsing the priority %q, use idle, low, normal, high, or a nice level: %s", level, err)
+		}
+		if nice < -20 || nice > 19 {
+			return fmt.Errorf("the nice level %d is not between -20 and 19", nice)
+		}
+	}
+	limits.Lock()
+	limits.nice = nice
+	limits.Unlock()
+	return nil
+}
+
+// SetCPULimit sets the soft limit on CPU time, not wall clock time, that a spawned command can consume; 0 removes it
+func SetCPULimit(ceiling string) error {
+	d, err := time.ParseDuration(ceiling)
+	if err != nil {
+		seconds, errInt := strconv.Atoi(ceiling)
+		if errInt != nil {
+			return fmt.Errorf("there was an error parsing the CPU time limit %q: %s", ceiling, err)
+		}
+		d = time.Duration(seconds) * time.Second
+	}
+	if d < 0 {
+		return fmt.Errorf("the CPU time limit %s can not be negative", d)
+	}
+	if d > 0 && !cpuLimitSupported {
+		return fmt.Errorf("CPU time limits are not supported on this operating system")
+	}
+	limits.Lock()
+	limits.ceiling = d.Round(time.Second)
+	limits.Unlock()
+	return nil
+}
+
+// Limits returns a description of the CPU priority and CPU time limit applied to spawned commands
+func Limits() string {
+	limits.RLock()
+	defer limits.RUnlock()
+	ceiling := "unlimited"
+	if limits.ceiling > 0 {
+		ceiling = limits.ceiling.String()
+	}
+	return fmt.Sprintf("Spawned Command Priority: %d (nice), CPU Time Limit: %s", limits.nice, ceiling)
+}
+
+// start starts the command and applies the configured CPU priority and CPU time limit. If the limits can not be
+// applied the command is terminated rather than left to run unrestricted. The returned function must be called after
+// the process exits
+func start(cmd *exec.Cmd) (ceiling time.Duration, release func(), err error) {
+	limits.RLock()
+	nice, ceiling := limits.nice, limits.ceiling
+	limits.RUnlock()
+
+	release = func() {}
+	if nice == 0 && ceiling == 0 {
+		if err = cmd.Start(); err == nil {
+			release = track(cmd, release)
+		}
+		return
+	}
+
+	prepare(cmd, nice)
+	if err = cmd.Start(); err != nil {
+		return
+	}
+	release, err = restrict(cmd.Process.Pid, nice, ceiling)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		release()
+		err = fmt.Errorf("the process was terminated because its CPU priority or time limit could not be applied: %s", err)
+		return
+	}
+	release = track(cmd, release)
+	return
+}
+
+// track registers a started process with the exit-time cleanup registry and returns a release function that also
+// removes the process from the registry once its owner has waited on it
+func track(cmd *exec.Cmd, release func()) func() {
+	remove := cleanup.Add(cleanup.PROCESS, fmt.Sprintf("%s (%d)", cmd.Path, cmd.Process.Pid), func() error {
+		return terminate(cmd)
+	})
+	return func() {
+		remove()
+		release()
+	}
+}
+
+// cpuExceeded adds the CPU time limit to the error of a process that used most of it; CPU time accounting is coarse,
+// so a process that used 90% of its ceiling is assumed to have been stopped by it
+func cpuExceeded(cmd *exec.Cmd, ceiling time.Duration, err error) error {
+	if err != nil && ceiling > 0 && cmd.ProcessState != nil && cmd.ProcessState.UserTime()+cmd.ProcessState.SystemTime() >= ceiling*9/10 {
+		return fmt.Errorf("%s after reaching the %s CPU time limit", err, ceiling)
+	}
+	return err
+}
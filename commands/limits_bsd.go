@@ -0,0 +1,37 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"errors"
+	"time"
+)
+
+// cpuLimitSupported indicates if CPU time limits can be applied to spawned commands on this operating system
+const cpuLimitSupported = false
+
+// cpuLimit is not supported because the resource limits of another process can not be changed on this operating system
+//
+//lint:ignore SA4009 Function needs to mirror limits_linux.go and inputs must be used
+func cpuLimit(pid int, ceiling time.Duration) error {
+	return errors.New("CPU time limits are not supported on this operating system")
+}
@@ -0,0 +1,47 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"time"
+
+	// X Packages
+	"golang.org/x/sys/unix"
+)
+
+// cpuLimitSupported indicates if CPU time limits can be applied to spawned commands on this operating system
+const cpuLimitSupported = true
+
+// cpuLimit sets the process's RLIMIT_CPU soft limit so the process receives SIGXCPU when it consumes the ceiling of
+// CPU time, with a hard limit five seconds later for processes that ignore the signal
+func cpuLimit(pid int, ceiling time.Duration) error {
+	seconds := uint64(ceiling / time.Second)
+	if seconds == 0 {
+		seconds = 1
+	}
+	limit := unix.Rlimit{Cur: seconds, Max: seconds + 5}
+	if err := unix.Prlimit(pid, unix.RLIMIT_CPU, &limit, nil); err != nil {
+		return fmt.Errorf("there was an error setting the CPU time limit to %s: %s", ceiling, err)
+	}
+	return nil
+}
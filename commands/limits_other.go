@@ -0,0 +1,53 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"errors"
+	"os/exec"
+	"time"
+)
+
+// cpuLimitSupported indicates if CPU time limits can be applied to spawned commands on this operating system
+const cpuLimitSupported = false
+
+// prepare is not implemented for this operating system
+//
+//lint:ignore SA4009 Function needs to mirror limits_windows.go and inputs must be used
+func prepare(cmd *exec.Cmd, nice int) {}
+
+// restrict is not implemented for this operating system
+//
+//lint:ignore SA4009 Function needs to mirror limits_unix.go and inputs must be used
+func restrict(pid int, nice int, ceiling time.Duration) (func(), error) {
+	return func() {}, errors.New("CPU priority and time limits are not implemented for this operating system")
+}
+
+// isolate is not implemented for this operating system
+//
+//lint:ignore SA4009 Function needs to mirror limits_unix.go and inputs must be used
+func isolate(cmd *exec.Cmd) {}
+
+// terminate kills the started process
+func terminate(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
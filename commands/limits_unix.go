@@ -0,0 +1,68 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+
+	// X Packages
+	"golang.org/x/sys/unix"
+)
+
+// prepare sets process attributes that must be in place before the command starts; Unix priority is set afterwards
+//
+//lint:ignore SA4009 Function needs to mirror limits_windows.go and inputs must be used
+func prepare(cmd *exec.Cmd, nice int) {}
+
+// restrict sets the nice level and CPU time limit of the started process
+func restrict(pid int, nice int, ceiling time.Duration) (release func(), err error) {
+	release = func() {}
+	if nice != 0 {
+		if err = unix.Setpriority(unix.PRIO_PROCESS, pid, nice); err != nil {
+			return release, fmt.Errorf("there was an error setting the nice level to %d: %s", nice, err)
+		}
+	}
+	if ceiling > 0 {
+		err = cpuLimit(pid, ceiling)
+	}
+	return release, err
+}
+
+// isolate places the command in its own process group so that it and any processes it starts can be stopped together
+func isolate(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// terminate kills the process group of a command started with isolate so that children holding its output pipes open
+// are stopped too
+func terminate(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+		return unix.Kill(-cmd.Process.Pid, unix.SIGKILL)
+	}
+	return cmd.Process.Kill()
+}
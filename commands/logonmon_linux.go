@@ -0,0 +1,72 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strconv"
+)
+
+const (
+	// utmpPath is the file where the active login records are kept
+	utmpPath = "/var/run/utmp"
+	// utmpSize is the size of a glibc utmp record
+	utmpSize = 384
+	// utmpUserProcess is the USER_PROCESS record type for a logged in user
+	utmpUserProcess = 7
+)
+
+// logonSessions parses the utmp records of logged in users
+func logonSessions() ([]logonSession, error) {
+	data, err := os.ReadFile(utmpPath)
+	if err != nil {
+		return nil, err
+	}
+	field := func(b []byte) string {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return string(b)
+	}
+	var sessions []logonSession
+	for offset := 0; offset+utmpSize <= len(data); offset += utmpSize {
+		record := data[offset : offset+utmpSize]
+		if binary.LittleEndian.Uint16(record[0:]) != utmpUserProcess {
+			continue
+		}
+		pid := int(binary.LittleEndian.Uint32(record[4:]))
+		// Skip stale records for sessions whose process has exited without cleaning up
+		if _, err = os.Stat("/proc/" + strconv.Itoa(pid)); err != nil {
+			continue
+		}
+		line, user, host := field(record[8:40]), field(record[44:76]), field(record[76:332])
+		sessions = append(sessions, logonSession{
+			ID:     line,
+			User:   user,
+			Type:   terminalType(line, host),
+			Source: host,
+		})
+	}
+	return sessions, nil
+}
@@ -0,0 +1,53 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"os/exec"
+	"strings"
+)
+
+// logonSessions parses the output of who because the utmpx format differs between the BSDs and macOS
+func logonSessions() ([]logonSession, error) {
+	out, err := exec.Command("who").Output()
+	if err != nil {
+		return nil, err
+	}
+	var sessions []logonSession
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		var host string
+		if last := fields[len(fields)-1]; strings.HasPrefix(last, "(") && strings.HasSuffix(last, ")") {
+			host = strings.Trim(last, "()")
+		}
+		sessions = append(sessions, logonSession{
+			ID:     fields[1],
+			User:   fields[0],
+			Type:   terminalType(fields[1], host),
+			Source: host,
+		})
+	}
+	return sessions, nil
+}
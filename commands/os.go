@@ -20,16 +20,45 @@
 
 package commands
 
-import "github.com/Ne0nd0g/merlin-agent/cli"
+import (
+	// Standard
+	"fmt"
+	"os/user"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
 
 // Setup is used to prepare the environment or context for subsequent commands and is specific to each operating system
 func Setup() error {
-	cli.Message(cli.DEBUG, "entering Setup() function from the commands.os package")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "entering Setup() function from the commands.os package")
+	}
 	return nil
 }
 
 // TearDown is the opposite of Setup and removes and environment or context applications
 func TearDown() error {
-	cli.Message(cli.DEBUG, "entering TearDown() function from the commands.os package")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "entering TearDown() function from the commands.os package")
+	}
 	return nil
 }
+
+// networkIdentity returns the identity used to authenticate to remote hosts, the process user and the Kerberos
+// principal of the credential cache in KRB5CCNAME, if any
+func networkIdentity() string {
+	identity := "unknown"
+	if u, err := user.Current(); err == nil {
+		identity = u.Username
+	}
+	if principal, name := ccachePrincipal(); principal != "" {
+		identity += fmt.Sprintf(" (Kerberos %s from %s)", principal, name)
+	}
+	return identity
+}
+
+// oemCodePage returns the operating system's OEM code page identifier used by console programs, if applicable
+func oemCodePage() int {
+	return 0
+}
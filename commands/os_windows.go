@@ -21,25 +21,65 @@
 package commands
 
 import (
+	// Standard
+	"fmt"
+	"os/user"
+	"runtime"
+
 	// X-Packages
 	"golang.org/x/sys/windows"
 
 	// Internal
 	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/kernel32"
 	"github.com/Ne0nd0g/merlin-agent/os/windows/pkg/tokens"
 )
 
 // Setup is used to prepare the environment or context for subsequent commands and is specific to each operating system
 func Setup() error {
-	cli.Message(cli.DEBUG, "entering Setup() function from the commands.os package")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "entering Setup() function from the commands.os package")
+	}
+	// Impersonation applies to the calling thread so the goroutine must not move until TearDown reverts it, otherwise
+	// network authentication in between could use the process token
+	runtime.LockOSThread()
 	// Apply Windows access token, if any
-	return tokens.ApplyToken()
+	err := tokens.ApplyToken()
+	if err != nil {
+		runtime.UnlockOSThread()
+	}
+	return err
 }
 
 // TearDown is the opposite of Setup and removes and environment or context applications
 func TearDown() error {
-	cli.Message(cli.DEBUG, "entering TearDown() function from the commands.os package")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "entering TearDown() function from the commands.os package")
+	}
 
 	// Remove applied Windows access token
+	defer runtime.UnlockOSThread()
 	return windows.RevertToSelf()
 }
+
+// networkIdentity returns the identity used to authenticate to remote hosts: the make_token netonly credentials, the
+// impersonated token's user, or the process user
+func networkIdentity() string {
+	if tokens.Token != 0 {
+		if tokens.NetOnly != "" {
+			return fmt.Sprintf("%s (make_token netonly credentials)", tokens.NetOnly)
+		}
+		if name, err := tokens.GetTokenUsername(tokens.Token); err == nil {
+			return fmt.Sprintf("%s (impersonated token)", name)
+		}
+	}
+	if u, err := user.Current(); err == nil {
+		return fmt.Sprintf("%s (process token)", u.Username)
+	}
+	return "unknown"
+}
+
+// oemCodePage returns the operating system's OEM code page identifier used by console programs (e.g., 850 or 866)
+func oemCodePage() int {
+	return int(kernel32.GetOEMCP())
+}
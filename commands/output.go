@@ -0,0 +1,212 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// DefaultOutputLimit is the default maximum number of bytes of output read from a spawned command
+const DefaultOutputLimit = 64 * 1024 * 1024
+
+// processOutput holds how the output of spawned commands is read and returned
+var processOutput = struct {
+	sync.RWMutex
+	limit  int64  // The maximum number of bytes read from a spawned command before it is terminated, 0 is unlimited
+	binary string // How binary output is returned: base64, hex, or raw
+}{limit: DefaultOutputLimit, binary: "base64"}
+
+// SetOutputLimit sets the maximum number of bytes of output read from a spawned command, 0 is unlimited, and optionally
+// how binary output is returned: base64, hex, or raw to return it unchanged
+func SetOutputLimit(limit string, binary string) error {
+	size, err := strconv.ParseInt(limit, 10, 64)
+	if err != nil {
+		return fmt.Errorf("there was an error converting the output limit to an integer: %s", err)
+	}
+	if size < 0 {
+		return fmt.Errorf("the output limit must be greater than or equal to zero: %d", size)
+	}
+	binary = strings.ToLower(binary)
+	switch binary {
+	case "", "base64", "hex", "raw":
+	default:
+		return fmt.Errorf("%s is not a valid binary output format, use base64, hex, or raw", binary)
+	}
+	processOutput.Lock()
+	processOutput.limit = size
+	if binary != "" {
+		processOutput.binary = binary
+	}
+	processOutput.Unlock()
+	return nil
+}
+
+// OutputLimit returns a description of how the output of spawned commands is read and returned
+func OutputLimit() string {
+	processOutput.RLock()
+	defer processOutput.RUnlock()
+	limit := "unlimited"
+	if processOutput.limit > 0 {
+		limit = fmt.Sprintf("%d bytes", processOutput.limit)
+	}
+	return fmt.Sprintf("Spawned Command Output Limit: %s, Binary Output: %s", limit, processOutput.binary)
+}
+
+// outputPipes collects the output a process writes to its stdout and stderr pipes, in the order it arrives, and stops the
+// process as soon as the combined output exceeds the limit
+type outputPipes struct {
+	sync.Mutex
+	buf      bytes.Buffer
+	limit    int64
+	total    int64
+	exceeded bool
+	stop     func()
+}
+
+// read copies from a process's output pipe until it is closed, keeping output up to the limit and discarding the rest
+func (c *outputPipes) read(pipe io.Reader) {
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := pipe.Read(chunk)
+		if n > 0 {
+			c.Lock()
+			c.total += int64(n)
+			keep := int64(n)
+			if c.limit > 0 && c.total > c.limit {
+				keep -= c.total - c.limit
+				if keep < 0 {
+					keep = 0
+				}
+				if !c.exceeded {
+					c.exceeded = true
+					c.stop()
+				}
+			}
+			c.buf.Write(chunk[:keep])
+			c.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// run starts the command with its stdout and stderr connected to pipes that are read as the process writes to them,
+// enforcing the output limit while the process is running rather than after all of its output was buffered, and
+// returns the combined output once the process exits
+func run(cmd *exec.Cmd) ([]byte, error) {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating the stdout pipe: %s", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating the stderr pipe: %s", err)
+	}
+
+	processOutput.RLock()
+	out := &outputPipes{limit: processOutput.limit}
+	processOutput.RUnlock()
+
+	isolate(cmd)
+	ceiling, release, err := start(cmd)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	out.stop = func() { _ = terminate(cmd) }
+
+	// All reads from the pipes must complete before calling Wait
+	var wg sync.WaitGroup
+	for _, pipe := range []io.Reader{stdout, stderr} {
+		wg.Add(1)
+		go func(pipe io.Reader) {
+			defer wg.Done()
+			out.read(pipe)
+		}(pipe)
+	}
+	wg.Wait()
+	err = cpuExceeded(cmd, ceiling, cmd.Wait())
+
+	if out.exceeded {
+		err = fmt.Errorf("the process was terminated after writing more than the %d byte output limit", out.limit)
+	}
+	return out.buf.Bytes(), err
+}
+
+// isBinary determines if process output is binary data rather than text in any supported encoding by looking for NULL
+// bytes, outside of UTF-16LE text, or a high ratio of control characters
+func isBinary(data []byte) bool {
+	if len(data) == 0 || isUTF16LE(data) {
+		return false
+	}
+	sample := data
+	if len(sample) > 8192 {
+		sample = sample[:8192]
+	}
+	var control int
+	for _, b := range sample {
+		switch {
+		case b == 0:
+			return true
+		case b == '\t', b == '\n', b == '\r', b == '\f', b == '\b', b == 0x1b:
+		case b < 0x20, b == 0x7f:
+			control++
+		}
+	}
+	return control*10 > len(sample)
+}
+
+// wrapBinary encodes binary process output so it survives the trip to the server as text, based on the configured
+// format. Text output, and all output when the format is raw, is returned as nil
+func wrapBinary(data []byte) []byte {
+	processOutput.RLock()
+	format := processOutput.binary
+	processOutput.RUnlock()
+	if format == "raw" || !isBinary(data) {
+		return nil
+	}
+	var out bytes.Buffer
+	switch format {
+	case "hex":
+		out.WriteString(fmt.Sprintf("[binary output, %d bytes, hex dump]\n", len(data)))
+		out.WriteString(hex.Dump(data))
+	default:
+		out.WriteString(fmt.Sprintf("[binary output, %d bytes, base64 encoded]\n", len(data)))
+		encoded := base64.StdEncoding.EncodeToString(data)
+		for len(encoded) > 76 {
+			out.WriteString(encoded[:76] + "\n")
+			encoded = encoded[76:]
+		}
+		out.WriteString(encoded)
+	}
+	if !utf8.Valid(out.Bytes()) {
+		return nil
+	}
+	return out.Bytes()
+}
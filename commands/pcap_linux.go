@@ -0,0 +1,98 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"net"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// packetSocket is an AF_PACKET socket that receives every frame on an interface
+type packetSocket struct {
+	fd  int
+	buf []byte
+}
+
+// htons converts a short from host to network byte order
+func htons(i uint16) uint16 {
+	return i<<8 | i>>8
+}
+
+// openCapture opens an AF_PACKET socket on the interface, or every interface for "any", and attaches the BPF filter
+// in the kernel. It requires root or CAP_NET_RAW
+func openCapture(iface string, filter []bpf.RawInstruction) (captureSource, uint32, error) {
+	var index int
+	if iface != "any" {
+		i, err := net.InterfaceByName(iface)
+		if err != nil {
+			return nil, 0, err
+		}
+		index = i.Index
+	}
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(unix.ETH_P_ALL)))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(filter) > 0 {
+		prog := unix.SockFprog{
+			Len:    uint16(len(filter)),
+			Filter: (*unix.SockFilter)(unsafe.Pointer(&filter[0])),
+		}
+		if err = unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &prog); err != nil {
+			_ = unix.Close(fd)
+			return nil, 0, err
+		}
+	}
+	if err = unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_ALL), Ifindex: index}); err != nil {
+		_ = unix.Close(fd)
+		return nil, 0, err
+	}
+	// Time out reads so the capture can check if it was stopped
+	if err = unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Sec: 1}); err != nil {
+		_ = unix.Close(fd)
+		return nil, 0, err
+	}
+	return &packetSocket{fd: fd, buf: make([]byte, snapLength)}, linkTypeEthernet, nil
+}
+
+// ReadPacket returns the next packet or nil if none arrived before the read timeout
+func (s *packetSocket) ReadPacket() ([]byte, error) {
+	n, _, err := unix.Recvfrom(s.fd, s.buf, 0)
+	if err == unix.EAGAIN || err == unix.EINTR {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	packet := make([]byte, n)
+	copy(packet, s.buf[:n])
+	return packet, nil
+}
+
+// Close stops the capture
+func (s *packetSocket) Close() error {
+	return unix.Close(s.fd)
+}
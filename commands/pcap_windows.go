@@ -0,0 +1,113 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"net"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/windows"
+)
+
+// SIO_RCVALL enables a raw socket to receive all IP packets on the interface
+const SIO_RCVALL = 0x98000001
+
+// rawSocket is a raw IP socket in promiscuous mode, packets start with the IP header
+type rawSocket struct {
+	handle windows.Handle
+	buf    []byte
+	vm     *bpf.VM
+}
+
+// openCapture opens a raw IP socket bound to the interface's IPv4 address and enables SIO_RCVALL. The kernel can not
+// run BPF filters on raw sockets so the filter runs in user space. It requires administrator
+func openCapture(iface string, filter []bpf.RawInstruction) (captureSource, uint32, error) {
+	vm, err := filterVM(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	ip := net.ParseIP(iface).To4()
+	if ip == nil {
+		i, err := net.InterfaceByName(iface)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s is not an interface name or IPv4 address: %s", iface, err)
+		}
+		addrs, _ := i.Addrs()
+		for _, addr := range addrs {
+			if n, ok := addr.(*net.IPNet); ok && n.IP.To4() != nil {
+				ip = n.IP.To4()
+				break
+			}
+		}
+		if ip == nil {
+			return nil, 0, fmt.Errorf("%s does not have an IPv4 address", iface)
+		}
+	}
+
+	handle, err := windows.Socket(windows.AF_INET, windows.SOCK_RAW, windows.IPPROTO_IP)
+	if err != nil {
+		return nil, 0, err
+	}
+	sa := &windows.SockaddrInet4{}
+	copy(sa.Addr[:], ip)
+	if err = windows.Bind(handle, sa); err != nil {
+		_ = windows.Closesocket(handle)
+		return nil, 0, err
+	}
+	// Time out reads so the capture can check if it was stopped
+	if err = windows.SetsockoptInt(handle, windows.SOL_SOCKET, windows.SO_RCVTIMEO, 1000); err != nil {
+		_ = windows.Closesocket(handle)
+		return nil, 0, err
+	}
+	on := uint32(1)
+	var returned uint32
+	if err = windows.WSAIoctl(handle, SIO_RCVALL, (*byte)(unsafe.Pointer(&on)), 4, nil, 0, &returned, nil, 0); err != nil {
+		_ = windows.Closesocket(handle)
+		return nil, 0, err
+	}
+	return &rawSocket{handle: handle, buf: make([]byte, snapLength), vm: vm}, linkTypeRaw, nil
+}
+
+// ReadPacket returns the next packet or nil if none arrived before the read timeout or it did not match the filter
+func (s *rawSocket) ReadPacket() ([]byte, error) {
+	n, _, err := windows.Recvfrom(s.handle, s.buf, 0)
+	if err == windows.WSAETIMEDOUT {
+		return nil, nil
+	}
+	if n <= 0 {
+		return nil, err
+	}
+	if !filterPacket(s.vm, s.buf[:n]) {
+		return nil, nil
+	}
+	packet := make([]byte, n)
+	copy(packet, s.buf[:n])
+	return packet, nil
+}
+
+// Close stops the capture
+func (s *rawSocket) Close() error {
+	return windows.Closesocket(s.handle)
+}
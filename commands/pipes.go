@@ -29,7 +29,9 @@ import (
 
 // Pipes is only a valid function on Windows agents...for now
 func Pipes() jobs.Results {
-	cli.Message(cli.DEBUG, "entering Pipes()...")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "entering Pipes()...")
+	}
 	return jobs.Results{
 		Stderr: "the pipes command is not supported by this agent type",
 	}
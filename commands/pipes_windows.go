@@ -34,7 +34,9 @@ import (
 
 // Pipes enumerates and returns a list of named pipes for Windows hosts only
 func Pipes() jobs.Results {
-	cli.Message(cli.DEBUG, fmt.Sprintf("entering Pipes()..."))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Pipes()..."))
+	}
 	var results jobs.Results
 	var err string
 
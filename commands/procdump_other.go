@@ -0,0 +1,33 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// dumpProcess is not supported on this operating system
+func dumpProcess(pid int, w io.Writer) (name string, size int64, note string, err error) {
+	return "", 0, "", fmt.Errorf("dumping process memory is not supported on %s", runtime.GOOS)
+}
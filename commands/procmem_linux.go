@@ -0,0 +1,87 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// linuxProcessMemory reads a process's memory through /proc/<pid>/mem, which requires the same access as ptrace
+type linuxProcessMemory struct {
+	pid  int
+	file *os.File
+}
+
+// openProcessMemory opens the process's memory for reading
+func openProcessMemory(pid int) (processMemory, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/mem", pid))
+	if err != nil {
+		return nil, fmt.Errorf("there was an error opening the memory of process %d: %s", pid, err)
+	}
+	return &linuxProcessMemory{pid: pid, file: f}, nil
+}
+
+// Regions returns the readable mappings in /proc/<pid>/maps
+func (m *linuxProcessMemory) Regions() (regions []memoryRegion, err error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", m.pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// start-end perms offset dev inode path
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[1], "r") {
+			continue
+		}
+		// The kernel's vvar page can't be read through /proc/<pid>/mem
+		path := strings.Join(fields[5:], " ")
+		if path == "[vvar]" || path == "[vsyscall]" {
+			continue
+		}
+		start, end, _ := strings.Cut(fields[0], "-")
+		region := memoryRegion{Perms: fields[1], Path: path}
+		if region.Start, err = strconv.ParseUint(start, 16, 64); err != nil {
+			return nil, err
+		}
+		if region.End, err = strconv.ParseUint(end, 16, 64); err != nil {
+			return nil, err
+		}
+		regions = append(regions, region)
+	}
+	return regions, scanner.Err()
+}
+
+// ReadAt reads the process's memory at the address
+func (m *linuxProcessMemory) ReadAt(data []byte, address uint64) (int, error) {
+	return m.file.ReadAt(data, int64(address))
+}
+
+// Close closes /proc/<pid>/mem
+func (m *linuxProcessMemory) Close() error {
+	return m.file.Close()
+}
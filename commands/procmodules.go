@@ -0,0 +1,139 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// securityModules maps the lowercase names of DLLs that security products inject into processes to the product
+var securityModules = map[string]string{
+	"amsi.dll":                 "Antimalware Scan Interface",
+	"mpoav.dll":                "Microsoft Defender",
+	"atcuf32.dll":              "Bitdefender",
+	"atcuf64.dll":              "Bitdefender",
+	"bdhkm32.dll":              "Bitdefender",
+	"bdhkm64.dll":              "Bitdefender",
+	"cyinjct.dll":              "Palo Alto Cortex XDR",
+	"cyvrtrap.dll":             "Palo Alto Cortex XDR",
+	"cylancememdef.dll":        "Cylance",
+	"cylancememdef64.dll":      "Cylance",
+	"ctiuser.dll":              "Carbon Black",
+	"inprocessclient.dll":      "SentinelOne",
+	"inprocessclient64.dll":    "SentinelOne",
+	"hmpalert.dll":             "Sophos",
+	"sophos_detoured.dll":      "Sophos",
+	"sophos_detoured_x64.dll":  "Sophos",
+	"aswhook.dll":              "Avast",
+	"avghooka.dll":             "AVG",
+	"avghookx.dll":             "AVG",
+	"sysfer.dll":               "Symantec",
+	"tmumh.dll":                "Trend Micro",
+	"libesets_pac.so":          "ESET",
+	"libfalcon-sensor-hook.so": "CrowdStrike",
+}
+
+// loadedModule is a DLL or shared library mapped into a process
+type loadedModule struct {
+	Path string
+	Base uint64
+	Size uint64
+}
+
+// Modules lists the DLLs or shared libraries loaded in a process and flags the ones that belong to security products,
+// which shows where an EDR has hooked user mode. The list can be limited to modules whose path contains a filter
+// modules [pid] [filter]
+func Modules(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Modules() with %+v", cmd))
+	}
+	structured = newStructured("modules", nil)
+	pid := os.Getpid()
+	if len(cmd.Args) > 0 {
+		var err error
+		if pid, err = strconv.Atoi(cmd.Args[0]); err != nil {
+			results.Stderr = fmt.Sprintf("%s is not a valid process ID", cmd.Args[0])
+			structured.Error = results.Stderr
+			return
+		}
+	}
+	var filter string
+	if len(cmd.Args) > 1 {
+		filter = strings.ToLower(strings.Join(cmd.Args[1:], " "))
+	}
+
+	modules, err := processModules(pid)
+	if err != nil {
+		results.Stderr = err.Error()
+		structured.Error = results.Stderr
+		return
+	}
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Base < modules[j].Base })
+
+	var records []ModuleRecord
+	var products []string
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Base\tSize\tPath\tProduct")
+	for _, m := range modules {
+		if filter != "" && !strings.Contains(strings.ToLower(m.Path), filter) {
+			continue
+		}
+		name := filepath.Base(strings.ReplaceAll(m.Path, "\\", "/"))
+		product := securityProduct(name)
+		if product != "" {
+			products = append(products, fmt.Sprintf("%s (%s)", product, name))
+		}
+		fmt.Fprintf(w, "0x%x\t%d\t%s\t%s\n", m.Base, m.Size, m.Path, product)
+		records = append(records, ModuleRecord{PID: pid, Name: name, Path: m.Path, Base: fmt.Sprintf("0x%x", m.Base), Size: m.Size, Product: product})
+	}
+	_ = w.Flush()
+	results.Stdout = fmt.Sprintf("%d modules loaded in process %d\n", len(records), pid)
+	if len(products) > 0 {
+		results.Stdout += fmt.Sprintf("Security products: %s\n", strings.Join(products, ", "))
+	}
+	results.Stdout += sb.String()
+	structured.Fields = records
+	return
+}
+
+// securityProduct returns the security product a module belongs to, or an empty string
+func securityProduct(name string) string {
+	name = strings.ToLower(name)
+	if product, ok := securityModules[name]; ok {
+		return product
+	}
+	// CrowdStrike Falcon's user mode DLL is named umppc followed by a build number
+	if strings.HasPrefix(name, "umppc") && strings.HasSuffix(name, ".dll") {
+		return "CrowdStrike"
+	}
+	return ""
+}
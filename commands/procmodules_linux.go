@@ -0,0 +1,65 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// processModules returns the shared objects and the executable mapped into the process from /proc/<pid>/maps; the
+// maps file is readable for processes whose memory isn't
+func processModules(pid int) ([]loadedModule, error) {
+	regions, err := (&linuxProcessMemory{pid: pid}).Regions()
+	if err != nil {
+		return nil, fmt.Errorf("there was an error reading the memory map of process %d: %s", pid, err)
+	}
+	index := make(map[string]int)
+	executable := make(map[string]bool)
+	var mapped []loadedModule
+	for _, r := range regions {
+		if !strings.HasPrefix(r.Path, "/") || strings.HasPrefix(r.Path, "/dev/") {
+			continue
+		}
+		if strings.Contains(r.Perms, "x") {
+			executable[r.Path] = true
+		}
+		if i, ok := index[r.Path]; ok {
+			// A module is mapped as several regions; its size spans all of them
+			if r.End > mapped[i].Base+mapped[i].Size {
+				mapped[i].Size = r.End - mapped[i].Base
+			}
+			continue
+		}
+		index[r.Path] = len(mapped)
+		mapped = append(mapped, loadedModule{Path: r.Path, Base: r.Start, Size: r.End - r.Start})
+	}
+	// Data files such as locale archives are mapped too but never executable
+	var modules []loadedModule
+	for _, m := range mapped {
+		if executable[m.Path] || strings.Contains(filepath.Base(m.Path), ".so") {
+			modules = append(modules, m)
+		}
+	}
+	return modules, nil
+}
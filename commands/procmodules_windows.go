@@ -0,0 +1,57 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+// processModules returns the DLLs and the executable loaded in the process from a Toolhelp snapshot, including the
+// 32-bit modules of a WOW64 process
+func processModules(pid int) (modules []loadedModule, err error) {
+	var snapshot windows.Handle
+	// The snapshot fails with ERROR_BAD_LENGTH while the process is loading or unloading a module
+	for i := 0; i < 5; i++ {
+		snapshot, err = windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPMODULE|windows.TH32CS_SNAPMODULE32, uint32(pid))
+		if err != windows.ERROR_BAD_LENGTH {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating a module snapshot of process %d: %s", pid, err)
+	}
+	defer windows.CloseHandle(snapshot)
+	var entry windows.ModuleEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = windows.Module32First(snapshot, &entry); err == nil; err = windows.Module32Next(snapshot, &entry) {
+		modules = append(modules, loadedModule{
+			Path: windows.UTF16ToString(entry.ExePath[:]),
+			Base: uint64(entry.ModBaseAddr),
+			Size: uint64(entry.ModBaseSize),
+		})
+	}
+	return modules, nil
+}
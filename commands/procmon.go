@@ -0,0 +1,157 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// defaultProcmonInterval is how often the process table is polled when an interval is not provided
+const defaultProcmonInterval = 2
+
+// forensicProcesses is the pattern set used for the "forensic" keyword, common incident response, forensic, and
+// analysis tools that suggest someone is looking at the host
+var forensicProcesses = []string{
+	"procmon*", "procexp*", "processhacker*", "systeminformer*", "autoruns*", "tcpview*", "sysmon*", "wireshark*",
+	"dumpcap*", "tshark*", "tcpdump", "fiddler*", "x64dbg*", "x32dbg*", "ollydbg*", "windbg*", "ida*", "ghidra*",
+	"volatility*", "vol.py", "winpmem*", "dumpit*", "ftk*", "kape*", "velociraptor*", "osqueryd*", "osqueryi*",
+	"thor*", "loki*", "redline*", "gdb", "strace", "ltrace", "lsof", "auditctl", "ausearch", "chkrootkit",
+	"rkhunter", "unhide*", "fs_usage", "dtrace", "dtruss", "opensnoop", "execsnoop",
+}
+
+// procEntry is a process seen in the process table
+type procEntry struct {
+	PID     int
+	PPID    int
+	Name    string
+	Owner   string
+	Command string
+}
+
+// Procmon polls the process table and reports new processes whose names match the patterns on check-in
+// procmon start <patterns|forensic|*> [interval seconds]
+// procmon list
+// procmon stop <id>
+// Patterns are comma separated process name globs such as procmon*,wireshark*
+func Procmon(cmd jobs.Command, report Reporter) (results jobs.Results) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Procmon() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the procmon command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "start":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the procmon start command"
+			return
+		}
+		var patterns []string
+		for _, pattern := range strings.Split(cmd.Args[1], ",") {
+			if strings.EqualFold(pattern, "forensic") {
+				patterns = append(patterns, forensicProcesses...)
+				continue
+			}
+			patterns = append(patterns, pattern)
+		}
+		interval := defaultProcmonInterval
+		if len(cmd.Args) > 2 {
+			var err error
+			if interval, err = strconv.Atoi(cmd.Args[2]); err != nil || interval < 1 {
+				results.Stderr = fmt.Sprintf("%s is not a valid interval in seconds", cmd.Args[2])
+				return
+			}
+		}
+		// Take the first snapshot here so an unsupported or failing process table is returned with the job
+		previous, err := processTable()
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error listing processes: %s", err)
+			return
+		}
+		m, err := startMonitor("procmon", fmt.Sprintf("%s every %ds", cmd.Args[1], interval), report, func(m *monitor, stop <-chan struct{}) error {
+			return runProcmon(m, previous, patterns, time.Duration(interval)*time.Second, stop)
+		})
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Started procmon %s for %s every %d seconds", m.ID, cmd.Args[1], interval)
+	case "list":
+		results.Stdout = listMonitors("procmon")
+	case "stop":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the procmon stop command"
+			return
+		}
+		if err := stopMonitor("procmon", cmd.Args[1]); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Stopped procmon %s", cmd.Args[1])
+	default:
+		results.Stderr = fmt.Sprintf("unknown procmon command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// runProcmon compares each process table snapshot against the last one and records new processes that match
+func runProcmon(m *monitor, previous map[int]procEntry, patterns []string, interval time.Duration, stop <-chan struct{}) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+		current, err := processTable()
+		if err != nil {
+			// Tolerate transient failures but stop a monitor that can no longer see the process table
+			if failures++; failures > 10 {
+				return err
+			}
+			continue
+		}
+		failures = 0
+		for pid, entry := range current {
+			if old, ok := previous[pid]; ok && (old.Name == entry.Name || entry.Name == "") {
+				continue
+			}
+			processDetails(&entry)
+			current[pid] = entry
+			if entry.Name == "" || !matchesAny(entry.Name, patterns) {
+				continue
+			}
+			m.event("start pid %d ppid %d user %s name %s command %s", entry.PID, entry.PPID, entry.Owner, entry.Name, entry.Command)
+		}
+		previous = current
+	}
+}
@@ -0,0 +1,60 @@
+//go:build darwin
+// +build darwin
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"os/user"
+	"strconv"
+
+	// X Packages
+	"golang.org/x/sys/unix"
+)
+
+// processTable reads the process IDs, parents, names, and owners from the kern.proc.all sysctl
+func processTable() (map[int]procEntry, error) {
+	procs, err := unix.SysctlKinfoProcSlice("kern.proc.all")
+	if err != nil {
+		return nil, err
+	}
+	table := make(map[int]procEntry, len(procs))
+	for _, proc := range procs {
+		comm := proc.Proc.P_comm[:]
+		if i := bytes.IndexByte(comm, 0); i >= 0 {
+			comm = comm[:i]
+		}
+		table[int(proc.Proc.P_pid)] = procEntry{
+			PID:   int(proc.Proc.P_pid),
+			PPID:  int(proc.Eproc.Ppid),
+			Name:  string(comm),
+			Owner: strconv.Itoa(int(proc.Eproc.Ucred.Uid)),
+		}
+	}
+	return table, nil
+}
+
+// processDetails resolves the owner's user name
+func processDetails(entry *procEntry) {
+	if u, err := user.LookupId(entry.Owner); err == nil {
+		entry.Owner = u.Username
+	}
+}
@@ -0,0 +1,80 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// processTable lists the process IDs in /proc, the details are only read for new processes
+func processTable() (map[int]procEntry, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	table := make(map[int]procEntry, len(entries))
+	for _, entry := range entries {
+		if pid, err := strconv.Atoi(entry.Name()); err == nil {
+			table[pid] = procEntry{PID: pid}
+		}
+	}
+	return table, nil
+}
+
+// processDetails reads the process's name, parent, owner, and command line from /proc
+func processDetails(entry *procEntry) {
+	dir := filepath.Join("/proc", strconv.Itoa(entry.PID))
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return
+	}
+	// The name is in parentheses and may contain spaces, the fields after it are space separated
+	if open, end := bytes.IndexByte(stat, '('), bytes.LastIndexByte(stat, ')'); open >= 0 && end > open {
+		entry.Name = string(stat[open+1 : end])
+		if fields := strings.Fields(string(stat[end+1:])); len(fields) > 1 {
+			entry.PPID, _ = strconv.Atoi(fields[1])
+		}
+	}
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil && len(cmdline) > 0 {
+		args := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+		entry.Command = strings.Join(args, " ")
+		// comm is truncated to 15 characters so prefer the executable name from the arguments
+		if name := filepath.Base(args[0]); strings.HasPrefix(name, entry.Name) {
+			entry.Name = name
+		}
+	}
+	if info, err := os.Stat(dir); err == nil {
+		if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+			uid := strconv.Itoa(int(sys.Uid))
+			entry.Owner = uid
+			if u, err := user.LookupId(uid); err == nil {
+				entry.Owner = u.Username
+			}
+		}
+	}
+}
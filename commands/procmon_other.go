@@ -0,0 +1,60 @@
+//go:build !linux && !windows && !darwin
+// +build !linux,!windows,!darwin
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// processTable runs ps because there is no native process table wired up for this operating system
+func processTable() (map[int]procEntry, error) {
+	out, err := exec.Command("ps", "-axo", "pid=,ppid=,user=,command=").Output()
+	if err != nil {
+		return nil, err
+	}
+	table := make(map[int]procEntry)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		ppid, _ := strconv.Atoi(fields[1])
+		table[pid] = procEntry{
+			PID:     pid,
+			PPID:    ppid,
+			Owner:   fields[2],
+			Name:    filepath.Base(fields[3]),
+			Command: strings.Join(fields[3:], " "),
+		}
+	}
+	return table, nil
+}
+
+// processDetails has nothing to add because ps returns every field
+func processDetails(entry *procEntry) {}
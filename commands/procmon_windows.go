@@ -0,0 +1,91 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"syscall"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+// processTable takes a Toolhelp snapshot of the process IDs, parents, and executable names
+func processTable() (map[int]procEntry, error) {
+	handle, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.CloseHandle(handle)
+
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	if err = syscall.Process32First(handle, &entry); err != nil {
+		return nil, err
+	}
+	table := make(map[int]procEntry)
+	for {
+		table[int(entry.ProcessID)] = procEntry{
+			PID:  int(entry.ProcessID),
+			PPID: int(entry.ParentProcessID),
+			Name: syscall.UTF16ToString(entry.ExeFile[:]),
+		}
+		if err = syscall.Process32Next(handle, &entry); err != nil {
+			break
+		}
+	}
+	return table, nil
+}
+
+// processDetails adds the process's owner and command line, or its full image path when the command line can't be read
+func processDetails(entry *procEntry) {
+	entry.Owner, _ = getProcessOwner(uint32(entry.PID))
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(entry.PID))
+	if err != nil {
+		return
+	}
+	defer windows.CloseHandle(handle)
+	if entry.Command = processCommandLine(handle); entry.Command != "" {
+		return
+	}
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	if err = windows.QueryFullProcessImageName(handle, 0, &buf[0], &size); err == nil {
+		entry.Command = windows.UTF16ToString(buf[:size])
+	}
+}
+
+// processCommandLine returns the process's command line, which Windows 8.1 and later return from
+// NtQueryInformationProcess with only the limited query access right
+func processCommandLine(handle windows.Handle) string {
+	var size uint32
+	// The first call fails and returns the size of the buffer needed for the UNICODE_STRING and its characters
+	windows.NtQueryInformationProcess(handle, windows.ProcessCommandLineInformation, nil, 0, &size)
+	if size < uint32(unsafe.Sizeof(windows.NTUnicodeString{})) {
+		return ""
+	}
+	buf := make([]byte, size)
+	if err := windows.NtQueryInformationProcess(handle, windows.ProcessCommandLineInformation, unsafe.Pointer(&buf[0]), size, &size); err != nil {
+		return ""
+	}
+	return (*windows.NTUnicodeString)(unsafe.Pointer(&buf[0])).String()
+}
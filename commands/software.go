@@ -0,0 +1,58 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// software enumerates installed applications, packages, and hotfixes and returns those whose name contains the
+// optional filter
+func software(args []string) (stdout string, records []SoftwareRecord, err error) {
+	records, err = installedSoftware()
+	if len(args) > 0 {
+		filter := strings.ToLower(strings.Join(args, " "))
+		var filtered []SoftwareRecord
+		for _, record := range records {
+			if strings.Contains(strings.ToLower(record.Name), filter) {
+				filtered = append(filtered, record)
+			}
+		}
+		records = filtered
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Source != records[j].Source {
+			return records[i].Source < records[j].Source
+		}
+		return strings.ToLower(records[i].Name) < strings.ToLower(records[j].Name)
+	})
+
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Source\tName\tVersion\tVendor\tInstalled")
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Source, r.Name, r.Version, r.Vendor, r.Installed)
+	}
+	_ = w.Flush()
+	stdout = sb.String()
+	return
+}
@@ -0,0 +1,131 @@
+//go:build !windows
+// +build !windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// plistVersion extracts the application name and version from an XML Info.plist
+var plistVersion = regexp.MustCompile(`<key>(CFBundleName|CFBundleShortVersionString)</key>\s*<string>([^<]*)</string>`)
+
+// installedSoftware reads the dpkg, apk, and pacman databases, Homebrew Cellars, and macOS applications directly.
+// The rpm database is a Berkeley DB or SQLite file and is the only source read with an executable
+func installedSoftware() (records []SoftwareRecord, err error) {
+	records = append(records, stanzas("/var/lib/dpkg/status", "dpkg", "Package", "Version", "Maintainer", "Status")...)
+	records = append(records, stanzas("/lib/apk/db/installed", "apk", "P", "V", "m", "")...)
+
+	// pacman keeps a desc file for each package
+	descs, _ := filepath.Glob("/var/lib/pacman/local/*/desc")
+	for _, desc := range descs {
+		data, err := os.ReadFile(desc) // #nosec G304
+		if err != nil {
+			continue
+		}
+		fields := make(map[string]string)
+		sections := strings.Split(string(data), "\n\n")
+		for _, section := range sections {
+			lines := strings.SplitN(strings.TrimSpace(section), "\n", 2)
+			if len(lines) == 2 {
+				fields[lines[0]] = lines[1]
+			}
+		}
+		records = append(records, SoftwareRecord{Name: fields["%NAME%"], Version: fields["%VERSION%"], Vendor: fields["%PACKAGER%"], Source: "pacman"})
+	}
+
+	if _, statErr := os.Stat("/var/lib/rpm"); statErr == nil {
+		out, rpmErr := exec.Command("rpm", "-qa", "--qf", "%{NAME}\\t%{VERSION}-%{RELEASE}\\t%{VENDOR}\\t%{INSTALLTIME:date}\\n").Output() // #nosec G204
+		if rpmErr != nil {
+			err = rpmErr
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			fields := strings.Split(line, "\t")
+			if len(fields) == 4 {
+				records = append(records, SoftwareRecord{Name: fields[0], Version: fields[1], Vendor: fields[2], Source: "rpm", Installed: fields[3]})
+			}
+		}
+	}
+
+	// Homebrew installs each version of a formula to its own directory in the Cellar
+	for _, cellar := range []string{"/usr/local/Cellar", "/opt/homebrew/Cellar", "/home/linuxbrew/.linuxbrew/Cellar"} {
+		versions, _ := filepath.Glob(filepath.Join(cellar, "*", "*"))
+		for _, version := range versions {
+			records = append(records, SoftwareRecord{Name: filepath.Base(filepath.Dir(version)), Version: filepath.Base(version), Source: "brew"})
+		}
+	}
+
+	apps, _ := filepath.Glob("/Applications/*.app/Contents/Info.plist")
+	for _, app := range apps {
+		record := SoftwareRecord{Name: strings.TrimSuffix(filepath.Base(filepath.Dir(filepath.Dir(app))), ".app"), Source: "application"}
+		// Binary property lists are skipped and only report the application's name
+		if data, err := os.ReadFile(app); err == nil { // #nosec G304
+			for _, match := range plistVersion.FindAllStringSubmatch(string(data), -1) {
+				if match[1] == "CFBundleShortVersionString" {
+					record.Version = match[2]
+				}
+			}
+		}
+		records = append(records, record)
+	}
+	return
+}
+
+// stanzas parses a package database made of blank line separated "Key: Value" stanzas, such as dpkg's status file.
+// Packages are skipped if the status key is set and the package is not installed
+func stanzas(path, source, name, version, vendor, status string) (records []SoftwareRecord) {
+	f, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	separator := ": "
+	if source == "apk" {
+		separator = ":"
+	}
+	fields := make(map[string]string)
+	flush := func() {
+		if fields[name] != "" && (status == "" || strings.HasSuffix(fields[status], " installed")) {
+			records = append(records, SoftwareRecord{Name: fields[name], Version: fields[version], Vendor: fields[vendor], Source: source})
+		}
+		fields = make(map[string]string)
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		if key, value, found := strings.Cut(line, separator); found && !strings.HasPrefix(line, " ") {
+			fields[key] = value
+		}
+	}
+	flush()
+	return
+}
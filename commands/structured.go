@@ -0,0 +1,342 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// StructuredVersion is the version of the structured result schema
+const StructuredVersion = 1
+
+// Structured is a machine-readable representation of a command's results that is returned alongside the
+// human-readable text so that server-side tooling can parse the results without scraping the text
+type Structured struct {
+	Version    int         `json:"version"`              // Version is the structured result schema version
+	Type       string      `json:"type"`                 // Type is the command that produced the results (e.g., ls or ps)
+	Fields     interface{} `json:"fields"`               // Fields is a list of records specific to the result Type
+	Error      string      `json:"error,omitempty"`      // Error is the command's error message, if any
+	Operator   string      `json:"operator,omitempty"`   // Operator is who tasked the command, if the server identified them
+	Techniques []string    `json:"techniques,omitempty"` // Techniques are the MITRE ATT&CK technique IDs the command exercised
+}
+
+// FileRecord is a structured result for a file system entry
+type FileRecord struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Mode     string    `json:"mode"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	IsDir    bool      `json:"is_dir"`
+}
+
+// ProcessRecord is a structured result for a running process
+type ProcessRecord struct {
+	PID   int    `json:"pid"`
+	PPID  int    `json:"ppid"`
+	Arch  string `json:"arch"`
+	Owner string `json:"owner"`
+	Exe   string `json:"exe"`
+}
+
+// ConnectionRecord is a structured result for a network socket
+type ConnectionRecord struct {
+	Proto         string `json:"proto"`
+	LocalAddress  string `json:"local_address"`
+	LocalPort     uint16 `json:"local_port"`
+	RemoteAddress string `json:"remote_address"`
+	RemotePort    uint16 `json:"remote_port"`
+	State         string `json:"state"`
+	PID           uint32 `json:"pid,omitempty"`
+	Process       string `json:"process,omitempty"`
+}
+
+// InterfaceRecord is a structured result for a network interface
+type InterfaceRecord struct {
+	Name        string   `json:"name"`
+	MAC         string   `json:"mac"`
+	MTU         int      `json:"mtu,omitempty"`
+	Addresses   []string `json:"addresses"`
+	Gateways    []string `json:"gateways,omitempty"`
+	DHCP        bool     `json:"dhcp,omitempty"`
+	DHCPServers []string `json:"dhcp_servers,omitempty"`
+}
+
+// FindingRecord is a structured result for an enumeration finding such as a capability or container indicator
+type FindingRecord struct {
+	Category string `json:"category"`
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+}
+
+// AccountRecord is a structured result for a local user account and its password hash, if readable
+type AccountRecord struct {
+	Name       string `json:"name"`
+	UID        string `json:"uid,omitempty"`
+	GID        string `json:"gid,omitempty"`
+	Home       string `json:"home,omitempty"`
+	Shell      string `json:"shell,omitempty"`
+	Hash       string `json:"hash,omitempty"`
+	Algorithm  string `json:"algorithm,omitempty"`
+	Locked     bool   `json:"locked"`
+	LastChange string `json:"last_change,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+	Privilege  string `json:"privilege,omitempty"`
+}
+
+// HashdumpRecord is a structured result for local accounts and the local password and lockout policy
+type HashdumpRecord struct {
+	Accounts []AccountRecord `json:"accounts"`
+	Policy   []FindingRecord `json:"policy"`
+}
+
+// SoftwareRecord is a structured result for an installed application, package, or hotfix
+type SoftwareRecord struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Vendor    string `json:"vendor,omitempty"`
+	Source    string `json:"source"`
+	Installed string `json:"installed,omitempty"`
+}
+
+// EventRecord is a structured result for a Windows event log entry
+type EventRecord struct {
+	Channel  string            `json:"channel"`
+	RecordID uint64            `json:"record_id"`
+	EventID  int               `json:"event_id"`
+	Time     string            `json:"time"`
+	Provider string            `json:"provider"`
+	Level    int               `json:"level"`
+	Computer string            `json:"computer"`
+	Data     map[string]string `json:"data,omitempty"`
+}
+
+// TicketRecord is a structured result for a Kerberos ticket held in a credential cache
+type TicketRecord struct {
+	Cache   string    `json:"cache"`
+	Client  string    `json:"client"`
+	Server  string    `json:"server"`
+	EncType int       `json:"enctype"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Renew   time.Time `json:"renew,omitempty"`
+	Flags   string    `json:"flags"`
+	Expired bool      `json:"expired"`
+}
+
+// SprayRecord is a structured result for a single password spraying attempt
+type SprayRecord struct {
+	Time     time.Time `json:"time"`
+	Protocol string    `json:"protocol"`
+	Target   string    `json:"target"`
+	Domain   string    `json:"domain"`
+	User     string    `json:"user"`
+	Password string    `json:"password"`
+	Outcome  string    `json:"outcome"`
+	Valid    bool      `json:"valid"`
+	Detail   string    `json:"detail,omitempty"`
+	Attempts int       `json:"attempts"`
+	Risk     string    `json:"lockout_risk"`
+}
+
+// RoastRecord is a structured result for a Kerberos service ticket or AS-REP that can be cracked offline
+type RoastRecord struct {
+	Type    string `json:"type"`
+	User    string `json:"user"`
+	Realm   string `json:"realm"`
+	SPN     string `json:"spn,omitempty"`
+	EncType int    `json:"enctype,omitempty"`
+	Hash    string `json:"hash,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DCSyncRecord is a structured result for the credentials of an account replicated from a domain controller
+type DCSyncRecord struct {
+	User      string   `json:"user"`
+	SID       string   `json:"sid,omitempty"`
+	RID       uint32   `json:"rid,omitempty"`
+	Disabled  bool     `json:"disabled"`
+	LM        string   `json:"lm,omitempty"`
+	NT        string   `json:"nt,omitempty"`
+	LMHistory []string `json:"lm_history,omitempty"`
+	NTHistory []string `json:"nt_history,omitempty"`
+	Keys      []string `json:"kerberos_keys,omitempty"`
+	Cleartext string   `json:"cleartext,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// String returns the account's hashes in the user:rid:lm:nt::: format followed by its password history, Kerberos
+// keys, and cleartext password
+func (r DCSyncRecord) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s:%d:%s:%s:::\n", r.User, r.RID, r.LM, r.NT)
+	for i, nt := range r.NTHistory {
+		lm := "aad3b435b51404eeaad3b435b51404ee"
+		if i < len(r.LMHistory) {
+			lm = r.LMHistory[i]
+		}
+		fmt.Fprintf(&sb, "%s_history%d:%d:%s:%s:::\n", r.User, i, r.RID, lm, nt)
+	}
+	for _, key := range r.Keys {
+		fmt.Fprintf(&sb, "%s:%s\n", r.User, key)
+	}
+	if r.Cleartext != "" {
+		fmt.Fprintf(&sb, "%s:CLEARTEXT:%s\n", r.User, r.Cleartext)
+	}
+	return sb.String()
+}
+
+// SQLResultRecord is a structured result for a result set returned by a SQL Server
+type SQLResultRecord struct {
+	Server  string     `json:"server"`
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+}
+
+// DeviceRecord is a structured result for a network device found by an SNMP or SSH sweep for the network map
+type DeviceRecord struct {
+	Address     string   `json:"address"`
+	Protocol    string   `json:"protocol"`
+	Credential  string   `json:"credential,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Location    string   `json:"location,omitempty"`
+	Contact     string   `json:"contact,omitempty"`
+	ObjectID    string   `json:"object_id,omitempty"`
+	Uptime      string   `json:"uptime,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	HostKey     string   `json:"host_key,omitempty"`
+	Interfaces  []string `json:"interfaces,omitempty"`
+	Addresses   []string `json:"addresses,omitempty"`
+	Output      string   `json:"output,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// HandleRecord is a structured result for a handle or file descriptor open in a process
+type HandleRecord struct {
+	PID    int    `json:"pid"`
+	Handle uint64 `json:"handle"`
+	Type   string `json:"type"`
+	Access string `json:"access,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+// ModuleRecord is a structured result for a module, a DLL or shared library, loaded in a process
+type ModuleRecord struct {
+	PID     int    `json:"pid"`
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Base    string `json:"base"`
+	Size    uint64 `json:"size"`
+	Product string `json:"product,omitempty"`
+}
+
+// ShareRecord is a structured result for a share or printer found on a host and the access the agent has to it
+type ShareRecord struct {
+	Host   string `json:"host"`
+	Share  string `json:"share,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Remark string `json:"remark,omitempty"`
+	Read   bool   `json:"read"`
+	Write  bool   `json:"write"`
+	Error  string `json:"error,omitempty"`
+}
+
+// CrawlRecord is a structured result for a candidate file a crawl found by its name or contents
+type CrawlRecord struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Match    string    `json:"match"`
+	Context  string    `json:"context,omitempty"`
+}
+
+// SSHEdgeRecord is a structured result for an SSH connection a local user has made, or is configured to make, to a
+// remote host and the private key it likely uses
+type SSHEdgeRecord struct {
+	Source   string   `json:"source"`
+	User     string   `json:"user,omitempty"`
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Key      string   `json:"key,omitempty"`
+	Evidence []string `json:"evidence"`
+}
+
+// HistoryRecord is a structured result for a user's shell or PowerShell history file
+type HistoryRecord struct {
+	User     string    `json:"user"`
+	Path     string    `json:"path"`
+	Modified time.Time `json:"modified"`
+	Total    int       `json:"total"`
+	Commands []string  `json:"commands"`
+}
+
+// AgentRecord is a structured result for the information about the agent and its host that the AgentInfo message,
+// whose structure is defined by the Merlin server, does not have fields for
+type AgentRecord struct {
+	Alias       string   `json:"alias,omitempty"`
+	Note        string   `json:"note,omitempty"`
+	Fingerprint string   `json:"fingerprint,omitempty"`
+	OSVersion   string   `json:"os_version,omitempty"`
+	OSBuild     string   `json:"os_build,omitempty"`
+	Locale      string   `json:"locale,omitempty"`
+	TimeZone    string   `json:"time_zone,omitempty"`
+	Elevation   string   `json:"elevation,omitempty"`
+	Gateways    []string `json:"gateways,omitempty"`
+}
+
+// structured determines if structured results are returned alongside the human-readable results
+var structured int32
+
+// SetStructured enables or disables returning structured results alongside the human-readable results
+func SetStructured(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&structured, v)
+}
+
+// StructuredEnabled returns true if structured results are returned alongside the human-readable results
+func StructuredEnabled() bool {
+	return atomic.LoadInt32(&structured) == 1
+}
+
+// newStructured returns a structured result of the provided type with the records as its fields
+func newStructured(resultType string, fields interface{}) Structured {
+	return Structured{
+		Version: StructuredVersion,
+		Type:    resultType,
+		Fields:  fields,
+	}
+}
+
+// String returns the structured result as a JSON document
+func (s Structured) String() string {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Sprintf("{\"version\":%d,\"type\":%q,\"error\":%q}", StructuredVersion, s.Type, err.Error())
+	}
+	return string(data)
+}
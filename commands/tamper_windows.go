@@ -0,0 +1,129 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/os/windows/pkg/tokens"
+)
+
+// tamperChange is a change made to the host's security controls and how to revert it
+type tamperChange struct {
+	id          int
+	module      string
+	description string
+	made        time.Time
+	revert      []string
+}
+
+// tamper tracks the changes made by the defender and firewall modules so they can be reverted during cleanup
+var tamper = struct {
+	sync.Mutex
+	next    int
+	changes []tamperChange
+}{next: 1}
+
+// recordChange tracks a change and the command that reverts it, and returns the change's ID
+func recordChange(module, description string, revert ...string) int {
+	tamper.Lock()
+	defer tamper.Unlock()
+	change := tamperChange{id: tamper.next, module: module, description: description, made: time.Now().UTC(), revert: revert}
+	tamper.next++
+	tamper.changes = append(tamper.changes, change)
+	return change.id
+}
+
+// listChanges returns a table of the module's changes that have not been reverted
+func listChanges(module string) string {
+	tamper.Lock()
+	defer tamper.Unlock()
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tMade\tChange\tRevert")
+	for _, change := range tamper.changes {
+		if change.module == module {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", change.id, change.made.Format("2006-01-02T15:04:05Z"), change.description, strings.Join(change.revert, " "))
+		}
+	}
+	_ = w.Flush()
+	return sb.String()
+}
+
+// revertChange runs the command that reverts the change, or every change for the module if the id is "all"
+func revertChange(module, id string) (stdout string, err error) {
+	tamper.Lock()
+	defer tamper.Unlock()
+	var kept []tamperChange
+	var found bool
+	// Revert the newest changes first
+	for i := len(tamper.changes) - 1; i >= 0; i-- {
+		change := tamper.changes[i]
+		if change.module != module || (id != "all" && id != strconv.Itoa(change.id)) {
+			kept = append([]tamperChange{change}, kept...)
+			continue
+		}
+		found = true
+		if _, e := runHidden(change.revert[0], change.revert[1:]...); e != nil {
+			err = fmt.Errorf("there was an error reverting change %d: %s", change.id, e)
+			kept = append([]tamperChange{change}, kept...)
+			continue
+		}
+		stdout += fmt.Sprintf("Reverted change %d: %s\n", change.id, change.description)
+	}
+	tamper.changes = kept
+	if !found {
+		return "", fmt.Errorf("%s is not a valid %s change ID", id, module)
+	}
+	return
+}
+
+// runHidden runs the program with the agent's token without a window and returns its output, the output is included
+// in the error if it fails
+func runHidden(name string, args ...string) (string, error) {
+	// #nosec G204 -- Subprocess must be launched with a variable
+	cmd := exec.Command(name, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true, Token: syscall.Token(tokens.Token)}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s %s", err, strings.TrimSpace(transcode(out)))
+	}
+	return transcode(out), nil
+}
+
+// powershell returns the arguments to run a PowerShell command without a profile or prompts
+func powershell(command string) []string {
+	return []string{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command", command}
+}
+
+// psQuote quotes a string for a PowerShell single quoted literal
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,864 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// TDS packet types and the prelogin encryption values
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-tds/b46a581a-39de-4745-b076-ec4dbb7d13ec
+const (
+	tdsBatch         = 0x01
+	tdsReply         = 0x04
+	tdsLogin7        = 0x10
+	tdsSSPIMessage   = 0x11
+	tdsPrelogin      = 0x12
+	tdsHeaderSize    = 8
+	tdsPacketSize    = 4096
+	tdsVersion74     = 0x74000004
+	tdsEncryptOff    = 0x00
+	tdsEncryptNotSup = 0x02
+	// tdsMaxMessage limits the size of a response read into memory
+	tdsMaxMessage = 64 * 1024 * 1024
+)
+
+// TDS response token types
+const (
+	tdsTokenReturnStatus = 0x79
+	tdsTokenColMetadata  = 0x81
+	tdsTokenTabName      = 0xa4
+	tdsTokenColInfo      = 0xa5
+	tdsTokenOrder        = 0xa9
+	tdsTokenError        = 0xaa
+	tdsTokenInfo         = 0xab
+	tdsTokenLoginAck     = 0xad
+	tdsTokenRow          = 0xd1
+	tdsTokenNBCRow       = 0xd2
+	tdsTokenEnvChange    = 0xe3
+	tdsTokenSSPI         = 0xed
+	tdsTokenDone         = 0xfd
+	tdsTokenDoneProc     = 0xfe
+	tdsTokenDoneInProc   = 0xff
+)
+
+// TDS data types
+const (
+	tdsNull            = 0x1f
+	tdsImage           = 0x22
+	tdsText            = 0x23
+	tdsGUID            = 0x24
+	tdsVarBinary       = 0x25
+	tdsIntN            = 0x26
+	tdsVarChar         = 0x27
+	tdsDateN           = 0x28
+	tdsTimeN           = 0x29
+	tdsDateTime2N      = 0x2a
+	tdsDateTimeOffsetN = 0x2b
+	tdsBinary          = 0x2d
+	tdsChar            = 0x2f
+	tdsInt1            = 0x30
+	tdsBit             = 0x32
+	tdsInt2            = 0x34
+	tdsDecimal         = 0x37
+	tdsInt4            = 0x38
+	tdsDateTim4        = 0x3a
+	tdsFlt4            = 0x3b
+	tdsMoney           = 0x3c
+	tdsDateTime        = 0x3d
+	tdsFlt8            = 0x3e
+	tdsNumeric         = 0x3f
+	tdsVariant         = 0x62
+	tdsNText           = 0x63
+	tdsBitN            = 0x68
+	tdsDecimalN        = 0x6a
+	tdsNumericN        = 0x6c
+	tdsFltN            = 0x6d
+	tdsMoneyN          = 0x6e
+	tdsDateTimeN       = 0x6f
+	tdsMoney4          = 0x7a
+	tdsInt8            = 0x7f
+	tdsBigVarBinary    = 0xa5
+	tdsBigVarChar      = 0xa7
+	tdsBigBinary       = 0xad
+	tdsBigChar         = 0xaf
+	tdsNVarChar        = 0xe7
+	tdsNChar           = 0xef
+	tdsUDT             = 0xf0
+	tdsXML             = 0xf1
+)
+
+// tdsFixedSizes are the sizes of the fixed length data types
+var tdsFixedSizes = map[byte]int{
+	tdsNull: 0, tdsInt1: 1, tdsBit: 1, tdsInt2: 2, tdsInt4: 4, tdsDateTim4: 4, tdsFlt4: 4, tdsMoney: 8, tdsDateTime: 8,
+	tdsFlt8: 8, tdsMoney4: 4, tdsInt8: 8,
+}
+
+// tdsConn is a TDS client connection to a SQL Server
+type tdsConn struct {
+	conn       net.Conn
+	transport  io.ReadWriter
+	timeout    time.Duration
+	packetSize int
+}
+
+// tdsColumn is a result column's name and the type information needed to read and format its values
+type tdsColumn struct {
+	Name string
+	typ  byte
+	// length is the size of the value's length prefix, 0 for fixed length types, 8 for partially length-prefixed
+	// values, and -1 for sql_variant values
+	length int
+	size   int
+	scale  byte
+}
+
+// tdsResult is a result set returned by a query
+type tdsResult struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// tdsResponse is the result sets and the error and informational messages returned by a batch
+type tdsResponse struct {
+	Results  []tdsResult
+	Messages []string
+	Errors   []string
+	LoggedIn bool
+	SSPI     []byte
+}
+
+// tdsTokens reads the little-endian values of a token stream and records the first error
+type tdsTokens struct {
+	b   []byte
+	off int
+	err error
+}
+
+// tdsHandshake carries the TLS handshake in prelogin packets as the protocol requires, after the handshake TLS records
+// are written directly to the connection
+type tdsHandshake struct {
+	net.Conn
+	done    bool
+	pending bytes.Buffer
+	packet  []byte
+}
+
+// dialTDS connects to a SQL Server at host, host:port, or host\instance where the instance's port is resolved with
+// the SQL Server Browser service
+func dialTDS(server string, timeout time.Duration) (*tdsConn, error) {
+	addr := server
+	if i := strings.Index(server, "\\"); i > 0 {
+		port, err := sqlBrowser(server[:i], server[i+1:], timeout)
+		if err != nil {
+			return nil, err
+		}
+		addr = net.JoinHostPort(server[:i], port)
+	} else if _, _, err := net.SplitHostPort(server); err != nil {
+		addr = net.JoinHostPort(server, "1433")
+	}
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &tdsConn{conn: conn, transport: conn, timeout: timeout, packetSize: tdsPacketSize}, nil
+}
+
+// sqlBrowser asks the SQL Server Browser service on UDP port 1434 for the TCP port of a named instance
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/mc-sqlr/1ea6e25f-bff9-4364-ba21-5dc449a601b7
+func sqlBrowser(host, instance string, timeout time.Duration) (string, error) {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(host, "1434"), timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	if _, err = conn.Write(append(append([]byte{0x04}, instance...), 0)); err != nil {
+		return "", err
+	}
+	response := make([]byte, 4096)
+	n, err := conn.Read(response)
+	if err != nil {
+		return "", fmt.Errorf("the SQL Server Browser on %s did not respond: %s", host, err)
+	}
+	if n < 3 || response[0] != 0x05 {
+		return "", fmt.Errorf("the SQL Server Browser on %s returned a malformed response", host)
+	}
+	fields := strings.Split(string(response[3:n]), ";")
+	for i := 0; i+1 < len(fields); i += 2 {
+		if strings.EqualFold(fields[i], "tcp") {
+			return fields[i+1], nil
+		}
+	}
+	return "", fmt.Errorf("the %s instance on %s is not listening on TCP", instance, host)
+}
+
+// Close closes the connection to the SQL Server
+func (t *tdsConn) Close() error {
+	return t.conn.Close()
+}
+
+// login negotiates encryption and logs in with SQL Server authentication or, when a domain is provided, Windows
+// authentication with NTLMv2. Only the login is encrypted unless the server requires encryption
+func (t *tdsConn) login(server, domain, user, password, database string) error {
+	// Prelogin with the version, encryption, instance, thread ID, and MARS options
+	options := []struct {
+		token byte
+		data  []byte
+	}{{0, make([]byte, 6)}, {1, []byte{tdsEncryptOff}}, {2, []byte{0}}, {3, make([]byte, 4)}, {4, []byte{0}}}
+	var header, data bytes.Buffer
+	offset := len(options)*5 + 1
+	for _, o := range options {
+		header.WriteByte(o.token)
+		_ = binary.Write(&header, binary.BigEndian, []uint16{uint16(offset + data.Len()), uint16(len(o.data))})
+		data.Write(o.data)
+	}
+	header.WriteByte(0xff)
+	if err := t.write(tdsPrelogin, append(header.Bytes(), data.Bytes()...)); err != nil {
+		return err
+	}
+	response, err := t.read()
+	if err != nil {
+		return fmt.Errorf("there was an error reading the prelogin response: %s", err)
+	}
+	encryption := byte(tdsEncryptNotSup)
+	for i := 0; i+5 <= len(response) && response[i] != 0xff; i += 5 {
+		o, l := int(binary.BigEndian.Uint16(response[i+1:])), int(binary.BigEndian.Uint16(response[i+3:]))
+		if response[i] == 1 && l == 1 && o < len(response) {
+			encryption = response[o]
+		}
+	}
+
+	if encryption != tdsEncryptNotSup {
+		handshake := &tdsHandshake{Conn: t.conn}
+		host, _, _ := net.SplitHostPort(t.conn.RemoteAddr().String())
+		// G402: TLS InsecureSkipVerify set true. (Confidence: HIGH, Severity: HIGH) SQL Server certificates are self-signed
+		secure := tls.Client(handshake, &tls.Config{InsecureSkipVerify: true, ServerName: host, MaxVersion: tls.VersionTLS12}) // #nosec G402
+		_ = t.conn.SetDeadline(time.Now().Add(t.timeout))
+		if err = secure.Handshake(); err != nil {
+			return fmt.Errorf("there was an error negotiating TLS with the SQL Server: %s", err)
+		}
+		if err = handshake.flush(); err != nil {
+			return err
+		}
+		handshake.done = true
+		t.transport = secure
+	}
+
+	// Windows authentication sends the NTLM negotiate message in place of the login's user name and password
+	login := login7(server, user, password, database, nil)
+	if domain != "" {
+		negotiate := make([]byte, 32)
+		copy(negotiate, ntlmSignature)
+		binary.LittleEndian.PutUint32(negotiate[8:], 1)
+		binary.LittleEndian.PutUint32(negotiate[12:], ntlmClientFlags)
+		login = login7(server, "", "", database, negotiate)
+	}
+	if err = t.write(tdsLogin7, login); err != nil {
+		return err
+	}
+	// The server only requires the login to be encrypted when it does not require encryption
+	if encryption == tdsEncryptOff {
+		t.transport = t.conn
+	}
+	reply, err := t.response()
+	if err != nil {
+		return err
+	}
+	if reply.SSPI != nil && domain != "" {
+		start := bytes.Index(reply.SSPI, ntlmSignature)
+		if start < 0 || ntlmMessageType(reply.SSPI[start:]) != 2 {
+			return fmt.Errorf("the SQL Server did not return an NTLM challenge")
+		}
+		authenticate, _, err := ntlmAuthenticate(reply.SSPI[start:], domain, user, password, ntlmClientFlags)
+		if err != nil {
+			return err
+		}
+		if err = t.write(tdsSSPIMessage, authenticate); err != nil {
+			return err
+		}
+		if reply, err = t.response(); err != nil {
+			return err
+		}
+	}
+	if !reply.LoggedIn {
+		if len(reply.Errors) > 0 {
+			return fmt.Errorf("the login failed: %s", strings.Join(reply.Errors, ", "))
+		}
+		return fmt.Errorf("the login failed")
+	}
+	return nil
+}
+
+// login7 builds the LOGIN7 message with the password obfuscated as the protocol requires
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-tds/773a62b6-ee89-4c02-9e5e-344882630aac
+func login7(server, user, password, database string, sspi []byte) []byte {
+	const fixed = 94
+	fixedPart := make([]byte, fixed)
+	binary.LittleEndian.PutUint32(fixedPart[4:], tdsVersion74)
+	binary.LittleEndian.PutUint32(fixedPart[8:], tdsPacketSize)
+	// USE_DB_ON, INIT_DB_FATAL, and SET_LANG_ON, then INIT_LANG_FATAL and ODBC_ON with integrated security for SSPI
+	fixedPart[24] = 0xe0
+	fixedPart[25] = 0x03
+	if sspi != nil {
+		fixedPart[25] |= 0x80
+	}
+	binary.LittleEndian.PutUint32(fixedPart[32:], 0x409)
+
+	pw := utf16le(password)
+	for i, b := range pw {
+		pw[i] = (b<<4 | b>>4) ^ 0xa5
+	}
+	var variable bytes.Buffer
+	field := func(position int, value []byte, characters bool) {
+		length := len(value)
+		if characters {
+			length /= 2
+		}
+		binary.LittleEndian.PutUint16(fixedPart[position:], uint16(fixed+variable.Len()))
+		binary.LittleEndian.PutUint16(fixedPart[position+2:], uint16(length))
+		variable.Write(value)
+	}
+	field(36, nil, true)
+	field(40, utf16le(user), true)
+	field(44, pw, true)
+	field(48, nil, true)
+	field(52, utf16le(server), true)
+	field(56, nil, true)
+	field(60, utf16le("ODBC"), true)
+	field(64, nil, true)
+	field(68, utf16le(database), true)
+	field(78, sspi, false)
+	field(82, nil, true)
+	field(86, nil, true)
+	message := append(fixedPart, variable.Bytes()...)
+	binary.LittleEndian.PutUint32(message, uint32(len(message)))
+	return message
+}
+
+// query runs a SQL batch and returns its result sets and messages
+func (t *tdsConn) query(sql string) (tdsResponse, error) {
+	// ALL_HEADERS with the transaction descriptor header for auto-commit
+	batch := []byte{22, 0, 0, 0, 18, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0}
+	if err := t.write(tdsBatch, append(batch, utf16le(sql)...)); err != nil {
+		return tdsResponse{}, err
+	}
+	return t.response()
+}
+
+// write sends a message split into packets of the negotiated size
+func (t *tdsConn) write(ptype byte, message []byte) error {
+	_ = t.conn.SetDeadline(time.Now().Add(t.timeout))
+	max := t.packetSize - tdsHeaderSize
+	for id := 1; ; id++ {
+		chunk, status := message, byte(1)
+		if len(chunk) > max {
+			chunk, status = chunk[:max], 0
+		}
+		packet := []byte{ptype, status, 0, 0, 0, 0, byte(id), 0}
+		binary.BigEndian.PutUint16(packet[2:], uint16(len(chunk)+tdsHeaderSize))
+		if _, err := t.transport.Write(append(packet, chunk...)); err != nil {
+			return err
+		}
+		message = message[len(chunk):]
+		if status == 1 {
+			return nil
+		}
+	}
+}
+
+// read returns the next message reassembled from its packets
+func (t *tdsConn) read() ([]byte, error) {
+	var message []byte
+	for {
+		_ = t.conn.SetDeadline(time.Now().Add(t.timeout))
+		header := make([]byte, tdsHeaderSize)
+		if _, err := io.ReadFull(t.transport, header); err != nil {
+			return nil, err
+		}
+		length := int(binary.BigEndian.Uint16(header[2:]))
+		if length < tdsHeaderSize || len(message)+length > tdsMaxMessage {
+			return nil, fmt.Errorf("the SQL Server returned a malformed packet")
+		}
+		payload := make([]byte, length-tdsHeaderSize)
+		if _, err := io.ReadFull(t.transport, payload); err != nil {
+			return nil, err
+		}
+		message = append(message, payload...)
+		if header[1]&0x01 != 0 {
+			return message, nil
+		}
+	}
+}
+
+// response reads a reply message and parses its token stream
+func (t *tdsConn) response() (reply tdsResponse, err error) {
+	message, err := t.read()
+	if err != nil {
+		return reply, fmt.Errorf("there was an error reading the SQL Server response: %s", err)
+	}
+	r := &tdsTokens{b: message}
+	var columns []tdsColumn
+	for r.off < len(r.b) && r.err == nil {
+		token := r.u8()
+		switch token {
+		case tdsTokenColMetadata:
+			count := int(r.u16())
+			if count == 0xffff {
+				columns = nil
+				continue
+			}
+			columns = make([]tdsColumn, count)
+			result := tdsResult{}
+			for i := range columns {
+				r.u32()
+				r.u16()
+				columns[i] = r.typeInfo()
+				columns[i].Name = r.bVarchar()
+				result.Columns = append(result.Columns, columns[i].Name)
+			}
+			reply.Results = append(reply.Results, result)
+		case tdsTokenRow, tdsTokenNBCRow:
+			if len(reply.Results) == 0 {
+				return reply, fmt.Errorf("the SQL Server returned a row without column metadata")
+			}
+			var nulls []byte
+			if token == tdsTokenNBCRow {
+				nulls = r.bytes((len(columns) + 7) / 8)
+			}
+			row := make([]string, len(columns))
+			for i, c := range columns {
+				if nulls != nil && nulls[i/8]&(1<<(i%8)) != 0 {
+					row[i] = "NULL"
+					continue
+				}
+				value, null := r.value(c)
+				if null {
+					row[i] = "NULL"
+				} else {
+					row[i] = c.format(value)
+				}
+			}
+			result := &reply.Results[len(reply.Results)-1]
+			result.Rows = append(result.Rows, row)
+		case tdsTokenError, tdsTokenInfo:
+			data := &tdsTokens{b: r.bytes(int(r.u16()))}
+			number, state, class := data.u32(), data.u8(), data.u8()
+			text := data.usVarchar()
+			if token == tdsTokenError {
+				reply.Errors = append(reply.Errors, fmt.Sprintf("Msg %d, Level %d, State %d: %s", number, class, state, text))
+			} else {
+				reply.Messages = append(reply.Messages, text)
+			}
+		case tdsTokenLoginAck:
+			r.bytes(int(r.u16()))
+			reply.LoggedIn = true
+		case tdsTokenEnvChange:
+			data := &tdsTokens{b: r.bytes(int(r.u16()))}
+			// The packet size change applies to the following messages
+			if data.u8() == 4 {
+				if size, err := strconv.Atoi(data.bVarchar()); err == nil && size >= 512 && size <= 32767 {
+					t.packetSize = size
+				}
+			}
+		case tdsTokenSSPI:
+			reply.SSPI = r.bytes(int(r.u16()))
+		case tdsTokenOrder, tdsTokenColInfo, tdsTokenTabName:
+			r.bytes(int(r.u16()))
+		case tdsTokenReturnStatus:
+			r.u32()
+		case tdsTokenDone, tdsTokenDoneProc, tdsTokenDoneInProc:
+			r.bytes(12)
+		default:
+			return reply, fmt.Errorf("the SQL Server returned an unsupported token 0x%02x", token)
+		}
+	}
+	if r.err != nil {
+		return reply, fmt.Errorf("there was an error parsing the SQL Server response: %s", r.err)
+	}
+	return reply, nil
+}
+
+// typeInfo reads a column's TYPE_INFO and, for the large object types, its table name
+func (r *tdsTokens) typeInfo() (c tdsColumn) {
+	c.typ = r.u8()
+	if size, ok := tdsFixedSizes[c.typ]; ok {
+		c.size = size
+		return
+	}
+	c.length = 1
+	switch c.typ {
+	case tdsGUID, tdsIntN, tdsBitN, tdsFltN, tdsMoneyN, tdsDateTimeN, tdsChar, tdsVarChar, tdsBinary, tdsVarBinary:
+		r.u8()
+	case tdsDecimal, tdsNumeric, tdsDecimalN, tdsNumericN:
+		r.u8()
+		r.u8()
+		c.scale = r.u8()
+	case tdsDateN:
+	case tdsTimeN, tdsDateTime2N, tdsDateTimeOffsetN:
+		c.scale = r.u8()
+	case tdsBigVarBinary, tdsBigBinary, tdsBigVarChar, tdsBigChar, tdsNVarChar, tdsNChar:
+		c.length = 2
+		if r.u16() == 0xffff {
+			c.length = 8
+		}
+		if c.typ != tdsBigVarBinary && c.typ != tdsBigBinary {
+			r.bytes(5)
+		}
+	case tdsImage, tdsText, tdsNText:
+		c.length = 4
+		r.u32()
+		if c.typ != tdsImage {
+			r.bytes(5)
+		}
+		for parts := r.u8(); parts > 0; parts-- {
+			r.usVarchar()
+		}
+	case tdsXML:
+		c.length = 8
+		if r.u8() == 1 {
+			r.bVarchar()
+			r.bVarchar()
+			r.usVarchar()
+		}
+	case tdsUDT:
+		c.length = 8
+		r.u16()
+		r.bVarchar()
+		r.bVarchar()
+		r.bVarchar()
+		r.usVarchar()
+	case tdsVariant:
+		c.length = -1
+		r.u32()
+	default:
+		if r.err == nil {
+			r.err = fmt.Errorf("unsupported data type 0x%02x", c.typ)
+		}
+	}
+	return
+}
+
+// value reads a column value and reports if it is NULL
+func (r *tdsTokens) value(c tdsColumn) (data []byte, null bool) {
+	switch c.length {
+	case 0:
+		return r.bytes(c.size), c.typ == tdsNull
+	case 1:
+		n := int(r.u8())
+		return r.bytes(n), n == 0 && c.typ != tdsDateN
+	case 2:
+		n := r.u16()
+		if n == 0xffff {
+			return nil, true
+		}
+		return r.bytes(int(n)), false
+	case 4:
+		pointer := int(r.u8())
+		if pointer == 0 {
+			return nil, true
+		}
+		r.bytes(pointer + 8)
+		return r.bytes(int(r.u32())), false
+	case 8:
+		if r.u64() == math.MaxUint64 {
+			return nil, true
+		}
+		for {
+			n := int(r.u32())
+			if n == 0 || r.err != nil {
+				return data, false
+			}
+			data = append(data, r.bytes(n)...)
+		}
+	default:
+		n := int(r.u32())
+		return r.bytes(n), n == 0
+	}
+}
+
+// format returns the text representation of a column value
+func (c tdsColumn) format(b []byte) string {
+	switch c.typ {
+	case tdsInt1:
+		if len(b) == 1 {
+			return strconv.Itoa(int(b[0]))
+		}
+	case tdsBit, tdsBitN:
+		if len(b) == 1 {
+			return strconv.FormatBool(b[0] != 0)
+		}
+	case tdsInt2, tdsInt4, tdsInt8, tdsIntN:
+		switch len(b) {
+		case 1:
+			return strconv.Itoa(int(b[0]))
+		case 2:
+			return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(b))))
+		case 4:
+			return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(b))))
+		case 8:
+			return strconv.FormatInt(int64(binary.LittleEndian.Uint64(b)), 10)
+		}
+	case tdsFlt4, tdsFlt8, tdsFltN:
+		switch len(b) {
+		case 4:
+			return strconv.FormatFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), 'g', -1, 32)
+		case 8:
+			return strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)), 'g', -1, 64)
+		}
+	case tdsMoney, tdsMoney4, tdsMoneyN:
+		var v int64
+		switch len(b) {
+		case 4:
+			v = int64(int32(binary.LittleEndian.Uint32(b)))
+		case 8:
+			v = int64(binary.LittleEndian.Uint32(b))<<32 | int64(binary.LittleEndian.Uint32(b[4:]))
+		default:
+			return "0x" + hex.EncodeToString(b)
+		}
+		return decimalString(big.NewInt(v), 4)
+	case tdsDateTime, tdsDateTim4, tdsDateTimeN:
+		base := time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+		switch len(b) {
+		case 4:
+			return base.AddDate(0, 0, int(binary.LittleEndian.Uint16(b))).Add(time.Duration(binary.LittleEndian.Uint16(b[2:])) * time.Minute).Format("2006-01-02 15:04:05")
+		case 8:
+			ticks := time.Duration(binary.LittleEndian.Uint32(b[4:])) * time.Second / 300
+			return base.AddDate(0, 0, int(int32(binary.LittleEndian.Uint32(b)))).Add(ticks).Format("2006-01-02 15:04:05.000")
+		}
+	case tdsDecimal, tdsNumeric, tdsDecimalN, tdsNumericN:
+		if len(b) > 1 {
+			magnitude := make([]byte, len(b)-1)
+			for i, v := range b[1:] {
+				magnitude[len(magnitude)-1-i] = v
+			}
+			v := new(big.Int).SetBytes(magnitude)
+			if b[0] == 0 {
+				v.Neg(v)
+			}
+			return decimalString(v, int(c.scale))
+		}
+	case tdsGUID:
+		if len(b) == 16 {
+			return fmt.Sprintf("%X-%X-%X-%X-%X", []byte{b[3], b[2], b[1], b[0]}, []byte{b[5], b[4]}, []byte{b[7], b[6]}, b[8:10], b[10:])
+		}
+	case tdsDateN, tdsTimeN, tdsDateTime2N, tdsDateTimeOffsetN:
+		return c.dateTime(b)
+	case tdsBigVarChar, tdsBigChar, tdsChar, tdsVarChar, tdsText:
+		runes := make([]rune, len(b))
+		for i, v := range b {
+			runes[i] = rune(v)
+		}
+		return string(runes)
+	case tdsNVarChar, tdsNChar, tdsNText, tdsXML:
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			u[i] = binary.LittleEndian.Uint16(b[i*2:])
+		}
+		return string(utf16.Decode(u))
+	case tdsVariant:
+		// The base type, its property bytes, and the value
+		if len(b) >= 2 && len(b) >= 2+int(b[1]) {
+			inner := tdsColumn{typ: b[0]}
+			props := b[2 : 2+int(b[1])]
+			switch {
+			case (inner.typ == tdsDecimalN || inner.typ == tdsNumericN) && len(props) == 2:
+				inner.scale = props[1]
+			case (inner.typ == tdsTimeN || inner.typ == tdsDateTime2N || inner.typ == tdsDateTimeOffsetN) && len(props) == 1:
+				inner.scale = props[0]
+			}
+			return inner.format(b[2+len(props):])
+		}
+	}
+	return "0x" + hex.EncodeToString(b)
+}
+
+// dateTime formats the date, time, datetime2, and datetimeoffset types, which store the time as a count of 10^-scale
+// second units followed by the days since 0001-01-01 and, for datetimeoffset, the offset in minutes from UTC
+func (c tdsColumn) dateTime(b []byte) string {
+	var t time.Time
+	var units uint64
+	timeLength := 0
+	if c.typ != tdsDateN {
+		timeLength = 5
+		if c.scale <= 2 {
+			timeLength = 3
+		} else if c.scale <= 4 {
+			timeLength = 4
+		}
+		if len(b) < timeLength {
+			return "0x" + hex.EncodeToString(b)
+		}
+		for i := timeLength - 1; i >= 0; i-- {
+			units = units<<8 | uint64(b[i])
+		}
+	}
+	if c.scale > 7 {
+		return "0x" + hex.EncodeToString(b)
+	}
+	elapsed := time.Duration(units) * time.Duration(math.Pow10(9-int(c.scale)))
+	if c.typ == tdsTimeN {
+		return time.Time{}.Add(elapsed).Format("15:04:05.9999999")
+	}
+	if len(b) < timeLength+3 {
+		return "0x" + hex.EncodeToString(b)
+	}
+	days := int(b[timeLength]) | int(b[timeLength+1])<<8 | int(b[timeLength+2])<<16
+	t = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, days).Add(elapsed)
+	switch c.typ {
+	case tdsDateN:
+		return t.Format("2006-01-02")
+	case tdsDateTimeOffsetN:
+		if len(b) >= timeLength+5 {
+			offset := int(int16(binary.LittleEndian.Uint16(b[timeLength+3:])))
+			return t.In(time.FixedZone("", offset*60)).Format("2006-01-02 15:04:05.9999999 -07:00")
+		}
+	}
+	return t.Format("2006-01-02 15:04:05.9999999")
+}
+
+// decimalString formats an integer with scale digits after the decimal point
+func decimalString(v *big.Int, scale int) string {
+	s := new(big.Int).Abs(v).String()
+	if scale > 0 {
+		if len(s) <= scale {
+			s = strings.Repeat("0", scale-len(s)+1) + s
+		}
+		s = s[:len(s)-scale] + "." + s[len(s)-scale:]
+	}
+	if v.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// bytes returns the next n bytes
+func (r *tdsTokens) bytes(n int) []byte {
+	if r.err != nil || n < 0 || r.off+n > len(r.b) {
+		if r.err == nil {
+			r.err = fmt.Errorf("the token stream is truncated at offset %d", r.off)
+		}
+		return nil
+	}
+	b := r.b[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+// u8 returns the next byte
+func (r *tdsTokens) u8() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// u16 returns the next 16-bit unsigned integer
+func (r *tdsTokens) u16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+// u32 returns the next 32-bit unsigned integer
+func (r *tdsTokens) u32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+// u64 returns the next 64-bit unsigned integer
+func (r *tdsTokens) u64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// bVarchar returns the next UTF-16 string with a one byte character count
+func (r *tdsTokens) bVarchar() string {
+	return ntlmString(r.bytes(2*int(r.u8())), true)
+}
+
+// usVarchar returns the next UTF-16 string with a two byte character count
+func (r *tdsTokens) usVarchar() string {
+	return ntlmString(r.bytes(2*int(r.u16())), true)
+}
+
+// Write buffers the TLS handshake records until the handshake reads the server's response
+func (h *tdsHandshake) Write(b []byte) (int, error) {
+	if h.done {
+		return h.Conn.Write(b)
+	}
+	return h.pending.Write(b)
+}
+
+// Read sends the buffered handshake records in a prelogin packet and returns the handshake records from the server's
+// packets
+func (h *tdsHandshake) Read(b []byte) (int, error) {
+	if h.done {
+		return h.Conn.Read(b)
+	}
+	if err := h.flush(); err != nil {
+		return 0, err
+	}
+	if len(h.packet) == 0 {
+		header := make([]byte, tdsHeaderSize)
+		if _, err := io.ReadFull(h.Conn, header); err != nil {
+			return 0, err
+		}
+		length := int(binary.BigEndian.Uint16(header[2:]))
+		if length < tdsHeaderSize {
+			return 0, fmt.Errorf("the SQL Server returned a malformed packet")
+		}
+		h.packet = make([]byte, length-tdsHeaderSize)
+		if _, err := io.ReadFull(h.Conn, h.packet); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, h.packet)
+	h.packet = h.packet[n:]
+	return n, nil
+}
+
+// flush sends the buffered handshake records in a prelogin packet
+func (h *tdsHandshake) flush() error {
+	if h.pending.Len() == 0 {
+		return nil
+	}
+	packet := []byte{tdsPrelogin, 1, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(packet[2:], uint16(h.pending.Len()+tdsHeaderSize))
+	_, err := h.Conn.Write(append(packet, h.pending.Bytes()...))
+	h.pending.Reset()
+	return err
+}
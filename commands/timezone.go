@@ -0,0 +1,126 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// timeLayouts are the layouts, without a time zone, that ParseTime accepts before a UTC or local suffix
+var timeLayouts = []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"}
+
+// Timezone returns the host's time zone, locale, and regional settings so times given to the agent, and times in the
+// host's logs, can be converted without guessing the offset
+func Timezone(cmd jobs.Command) (results jobs.Results) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Timezone() with %+v", cmd))
+	}
+	now := time.Now()
+	name, offset := now.Zone()
+	results.Stdout = fmt.Sprintf("Local Time\t%s\n", now.Format("2006-01-02 15:04:05 MST"))
+	results.Stdout += fmt.Sprintf("UTC Time\t%s\n", now.UTC().Format("2006-01-02 15:04:05 MST"))
+	results.Stdout += fmt.Sprintf("Time Zone\t%s (UTC%s)\n", name, utcOffset(offset))
+	if now.IsDST() {
+		results.Stdout += "Daylight Saving\tin effect\n"
+	}
+	for _, change := range zoneChanges(now) {
+		results.Stdout += fmt.Sprintf("Next Change\t%s\n", change)
+	}
+	settings, err := regionalSettings()
+	for _, setting := range settings {
+		results.Stdout += setting + "\n"
+	}
+	if err != nil {
+		results.Stderr = fmt.Sprintf("there was an error getting the regional settings: %s", err)
+	}
+	return
+}
+
+// ParseTime parses a time that must say which time zone it is in so it isn't mistaken for another: a Unix timestamp,
+// an RFC 3339 time with an offset (e.g., 2006-01-02T15:04:05-07:00), or a date and time followed by UTC or local for
+// the host's time zone (e.g., 2006-01-02 17:00 local)
+func ParseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	rest, loc, explicit := timeZoneSuffix(value)
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, rest, loc); err == nil {
+			if !explicit {
+				return time.Time{}, fmt.Errorf("%s does not have a time zone, add UTC or local", value)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%s is not a Unix timestamp, an RFC 3339 time, or a date and time followed by UTC or local", value)
+}
+
+// timeZoneSuffix removes a trailing UTC or local from the value and returns its location; the host's location is
+// returned, and explicit is false, if there isn't one
+func timeZoneSuffix(value string) (rest string, loc *time.Location, explicit bool) {
+	value = strings.TrimSpace(value)
+	i := strings.LastIndexAny(value, " ")
+	if i < 0 {
+		return value, time.Local, false
+	}
+	switch strings.ToLower(value[i+1:]) {
+	case "utc", "z", "gmt":
+		return strings.TrimSpace(value[:i]), time.UTC, true
+	case "local":
+		return strings.TrimSpace(value[:i]), time.Local, true
+	}
+	return value, time.Local, false
+}
+
+// utcOffset formats a time zone offset in seconds as +HH:MM
+func utcOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	return fmt.Sprintf("%s%02d:%02d", sign, offset/3600, offset%3600/60)
+}
+
+// zoneChanges returns the next time the host's UTC offset changes, such as the start or end of daylight saving time,
+// within a year
+func zoneChanges(now time.Time) (changes []string) {
+	_, offset := now.Zone()
+	// Offsets change on the hour or half hour, so checking every 30 minutes finds the change
+	for t := now.Truncate(30 * time.Minute); t.Before(now.AddDate(1, 0, 0)); t = t.Add(30 * time.Minute) {
+		if _, o := t.Zone(); o != offset {
+			name, _ := t.Zone()
+			changes = append(changes, fmt.Sprintf("%s to %s (UTC%s)", t.Format("2006-01-02 15:04"), name, utcOffset(o)))
+			break
+		}
+	}
+	return
+}
@@ -0,0 +1,61 @@
+//go:build !windows
+// +build !windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"strings"
+)
+
+// regionalSettings returns the host's time zone database name and locale settings
+func regionalSettings() (settings []string, err error) {
+	if tz := os.Getenv("TZ"); tz != "" {
+		settings = append(settings, fmt.Sprintf("TZ\t\t%s", tz))
+	}
+	if link, e := os.Readlink("/etc/localtime"); e == nil {
+		if _, zone, found := strings.Cut(link, "zoneinfo/"); found {
+			link = zone
+		}
+		settings = append(settings, fmt.Sprintf("Zone Name\t%s", link))
+	} else if data, e := os.ReadFile("/etc/timezone"); e == nil {
+		settings = append(settings, fmt.Sprintf("Zone Name\t%s", strings.TrimSpace(string(data))))
+	}
+	for _, name := range []string{"LANG", "LANGUAGE", "LC_ALL", "LC_TIME", "LC_NUMERIC", "LC_MONETARY"} {
+		if value := os.Getenv(name); value != "" {
+			settings = append(settings, fmt.Sprintf("%s\t\t%s", name, value))
+		}
+	}
+	// The system locale applies to services and users that don't set their own
+	for _, path := range []string{"/etc/locale.conf", "/etc/default/locale"} {
+		data, e := os.ReadFile(path) // #nosec G304 the paths are constant
+		if e != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				settings = append(settings, fmt.Sprintf("System Locale\t%s", line))
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,109 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"strings"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+// Locale information types for GetLocaleInfoEx
+// https://learn.microsoft.com/en-us/windows/win32/intl/locale-information-constants
+const (
+	localeSEnglishCountryName = 0x1002
+	localeSShortDate          = 0x1F
+	localeSLongDate           = 0x20
+	localeSTimeFormat         = 0x1003
+	localeIFirstDayOfWeek     = 0x100C
+	localeSDecimal            = 0x0E
+	localeSCurrency           = 0x14
+)
+
+// regionalSettings returns the host's Windows time zone and the user and system locale settings
+func regionalSettings() (settings []string, err error) {
+	var tzi windows.Timezoneinformation
+	if _, e := windows.GetTimeZoneInformation(&tzi); e == nil {
+		settings = append(settings, fmt.Sprintf("Zone Name\t%s", windows.UTF16ToString(tzi.StandardName[:])))
+		if daylight := windows.UTF16ToString(tzi.DaylightName[:]); daylight != "" {
+			settings = append(settings, fmt.Sprintf("Daylight Name\t%s", daylight))
+		}
+	} else {
+		err = fmt.Errorf("there was an error calling GetTimeZoneInformation: %s", e)
+	}
+
+	kernel32 := windows.NewLazySystemDLL("kernel32.dll")
+	user, e := localeName(kernel32.NewProc("GetUserDefaultLocaleName"))
+	if e != nil {
+		return settings, e
+	}
+	settings = append(settings, fmt.Sprintf("User Locale\t%s", user))
+	if system, e := localeName(kernel32.NewProc("GetSystemDefaultLocaleName")); e == nil {
+		settings = append(settings, fmt.Sprintf("System Locale\t%s", system))
+	}
+	if languages, e := windows.GetUserPreferredUILanguages(windows.MUI_LANGUAGE_NAME); e == nil {
+		settings = append(settings, fmt.Sprintf("UI Languages\t%s", strings.Join(languages, ", ")))
+	}
+
+	getLocaleInfo := kernel32.NewProc("GetLocaleInfoEx")
+	for _, info := range []struct {
+		name string
+		kind uint32
+	}{
+		{"Country\t", localeSEnglishCountryName},
+		{"Short Date\t", localeSShortDate},
+		{"Long Date\t", localeSLongDate},
+		{"Time Format\t", localeSTimeFormat},
+		{"First Day\t", localeIFirstDayOfWeek},
+		{"Decimal\t", localeSDecimal},
+		{"Currency\t", localeSCurrency},
+	} {
+		buf := make([]uint16, 85)
+		name, _ := windows.UTF16PtrFromString(user)
+		if n, _, _ := getLocaleInfo.Call(uintptr(unsafe.Pointer(name)), uintptr(info.kind), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf))); n == 0 {
+			continue
+		}
+		value := windows.UTF16ToString(buf)
+		if info.kind == localeIFirstDayOfWeek {
+			// 0 is Monday
+			days := []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+			if i := int(value[0] - '0'); len(value) == 1 && i >= 0 && i < len(days) {
+				value = days[i]
+			}
+		}
+		settings = append(settings, fmt.Sprintf("%s%s", info.name, value))
+	}
+	return
+}
+
+// localeName calls GetUserDefaultLocaleName or GetSystemDefaultLocaleName and returns the locale name (e.g., en-US)
+func localeName(proc *windows.LazyProc) (string, error) {
+	// LOCALE_NAME_MAX_LENGTH
+	buf := make([]uint16, 85)
+	if n, _, err := proc.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf))); n == 0 {
+		return "", fmt.Errorf("there was an error calling %s: %s", proc.Name, err)
+	}
+	return windows.UTF16ToString(buf), nil
+}
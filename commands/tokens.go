@@ -33,7 +33,9 @@ import (
 
 // Token is the entrypoint for Jobs that are processed to determine which Token function should be executed
 func Token(cmd jobs.Command) jobs.Results {
-	cli.Message(cli.DEBUG, fmt.Sprintf("entering Token() with %+v", cmd))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Token() with %+v", cmd))
+	}
 	return jobs.Results{
 		Stderr: "the Token module is not supported by this agent type",
 	}
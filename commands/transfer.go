@@ -0,0 +1,432 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/crypto/secure"
+	"github.com/Ne0nd0g/merlin-agent/vault"
+)
+
+// chunkPrefix is the upload file location prefix, chunk:<transfer ID>:<index>, that delivers one chunk of a transfer
+const chunkPrefix = "chunk:"
+
+// manifest describes a file uploaded in chunks and tracks which chunks have been received and verified
+type manifest struct {
+	ID          string
+	Destination string
+	Size        int64
+	SHA256      string
+	Chunks      []string
+	Window      int
+	Created     time.Time
+	Updated     time.Time
+	received    map[int]string
+}
+
+// manifests are the chunked uploads in progress, keyed by transfer ID
+var manifests = struct {
+	sync.Mutex
+	transfers map[string]*manifest
+}{transfers: make(map[string]*manifest)}
+
+// Transfer manages uploads that are delivered in chunks so a dropped message only resends one chunk. The transfer ID
+// is the first 12 characters of the file's SHA256 so chunks can be sent with the manifest without waiting for a
+// reply, and issuing the same manifest again resumes the transfer with the chunks already received
+// transfer manifest <destination> <size> <sha256> <chunk sha256,chunk sha256,...> [window]
+// transfer status [id]
+// transfer cancel <id>
+// transfer preflight <destination> <size>
+// transfer scanned <warn|block>
+// The destination's free space and writability are checked before the first chunk is accepted; writes to locations
+// commonly scanned by anti-virus warn unless they are set to block. Chunks are uploaded to the file location chunk:<id>:<index> with the index starting at 0. The window is how many
+// chunks past the first missing chunk may be in flight at once; with a window larger than one every acknowledgment
+// makes the agent check in immediately so interactive transports, such as HTTP/2 or HTTP/3 with a persistent
+// connection, move the next chunks without waiting for the sleep interval
+func Transfer(cmd jobs.Command) (results jobs.Results, structured Structured) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Transfer() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the transfer command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "manifest":
+		if len(cmd.Args) < 5 {
+			results.Stderr = "not enough arguments provided to the transfer manifest command"
+			return
+		}
+		size, err := strconv.ParseInt(cmd.Args[2], 10, 64)
+		if err != nil || size < 0 {
+			results.Stderr = fmt.Sprintf("%s is not a valid file size", cmd.Args[2])
+			return
+		}
+		window := 1
+		if len(cmd.Args) > 5 {
+			if window, err = strconv.Atoi(cmd.Args[5]); err != nil || window < 1 {
+				results.Stderr = fmt.Sprintf("%s is not a valid window, it must be at least 1", cmd.Args[5])
+				return
+			}
+		}
+		var m *manifest
+		m, structured, err = newManifest(cmd.Args[1], size, cmd.Args[3], strings.Split(cmd.Args[4], ","), window)
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = m.status()
+	case "status":
+		manifests.Lock()
+		defer manifests.Unlock()
+		if len(cmd.Args) > 1 {
+			m, ok := manifests.transfers[cmd.Args[1]]
+			if !ok {
+				results.Stderr = fmt.Sprintf("%s is not a valid transfer ID", cmd.Args[1])
+				return
+			}
+			results.Stdout = m.status()
+			return
+		}
+		if len(manifests.transfers) == 0 {
+			results.Stdout = "there are no chunked transfers in progress"
+			return
+		}
+		var lines []string
+		for _, m := range manifests.transfers {
+			lines = append(lines, m.status())
+		}
+		sort.Strings(lines)
+		results.Stdout = strings.Join(lines, "\n")
+	case "cancel":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the transfer cancel command"
+			return
+		}
+		manifests.Lock()
+		m, ok := manifests.transfers[cmd.Args[1]]
+		delete(manifests.transfers, cmd.Args[1])
+		manifests.Unlock()
+		if !ok {
+			results.Stderr = fmt.Sprintf("%s is not a valid transfer ID", cmd.Args[1])
+			return
+		}
+		m.removeChunks()
+		results.Stdout = fmt.Sprintf("Canceled transfer %s and removed %d received chunks", m.ID, len(m.received))
+	case "preflight":
+		if len(cmd.Args) < 3 {
+			results.Stderr = "not enough arguments provided to the transfer preflight command"
+			return
+		}
+		size, err := strconv.ParseInt(cmd.Args[2], 10, 64)
+		if err != nil || size < 0 {
+			results.Stderr = fmt.Sprintf("%s is not a valid file size", cmd.Args[2])
+			return
+		}
+		structured, err = preflight(cmd.Args[1], size)
+		var lines []string
+		for _, check := range structured.Fields.([]PreflightRecord) {
+			status := "passed"
+			if !check.Passed {
+				status = "FAILED"
+			}
+			lines = append(lines, fmt.Sprintf("%-9s%-7s %s", check.Check, status, check.Detail))
+		}
+		results.Stdout = strings.Join(lines, "\n")
+		if err != nil {
+			results.Stderr = err.Error()
+		}
+	case "scanned":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the transfer scanned command"
+			return
+		}
+		switch strings.ToLower(cmd.Args[1]) {
+		case "warn":
+			SetBlockScanned(false)
+		case "block":
+			SetBlockScanned(true)
+		default:
+			results.Stderr = fmt.Sprintf("%s is not valid, use warn or block", cmd.Args[1])
+			return
+		}
+		results.Stdout = fmt.Sprintf("Writes to locations commonly scanned by anti-virus will %s", strings.ToLower(cmd.Args[1]))
+	default:
+		results.Stderr = fmt.Sprintf("unknown transfer command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// newManifest validates and registers a chunked transfer, an existing transfer of the same file to the same
+// destination is resumed. A new transfer's destination must have room for the held chunks and the assembled file
+func newManifest(destination string, size int64, sum string, chunks []string, window int) (*manifest, Structured, error) {
+	sum = strings.ToLower(sum)
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+		return nil, Structured{}, fmt.Errorf("%s is not a valid SHA256 hash", sum)
+	}
+	for i, chunk := range chunks {
+		chunks[i] = strings.ToLower(chunk)
+		if b, err := hex.DecodeString(chunks[i]); err != nil || len(b) != sha256.Size {
+			return nil, Structured{}, fmt.Errorf("chunk %d hash %s is not a valid SHA256 hash", i, chunk)
+		}
+	}
+	destination, err := filepath.Abs(destination)
+	if err != nil {
+		return nil, Structured{}, fmt.Errorf("there was an error getting the absolute path for %s: %s", destination, err)
+	}
+	manifests.Lock()
+	defer manifests.Unlock()
+	id := sum[:12]
+	if m, ok := manifests.transfers[id]; ok {
+		if m.Destination == destination && len(m.Chunks) == len(chunks) {
+			m.Updated, m.Window = time.Now().UTC(), window
+			return m, Structured{}, nil
+		}
+		m.removeChunks()
+		delete(manifests.transfers, id)
+	}
+	// The encrypted chunks are held next to the destination until the file is assembled
+	structured, err := preflight(destination, size*2)
+	if err != nil {
+		return nil, structured, err
+	}
+	m := &manifest{
+		ID:          id,
+		Destination: destination,
+		Size:        size,
+		SHA256:      sum,
+		Chunks:      chunks,
+		Window:      window,
+		Created:     time.Now().UTC(),
+		Updated:     time.Now().UTC(),
+		received:    make(map[int]string),
+	}
+	manifests.transfers[id] = m
+	return m, structured, nil
+}
+
+// receiveChunk verifies an uploaded chunk against the manifest, holds it encrypted by the vault, and assembles the
+// file once every chunk has been received
+func receiveChunk(transfer jobs.FileTransfer) (result jobs.Results) {
+	id, index, ok := strings.Cut(strings.TrimPrefix(transfer.FileLocation, chunkPrefix), ":")
+	i, err := strconv.Atoi(index)
+	if !ok || err != nil {
+		result.Stderr = fmt.Sprintf("%s is not a valid chunk location, use chunk:<id>:<index>", transfer.FileLocation)
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(transfer.FileBlob)
+	if err != nil {
+		result.Stderr = fmt.Sprintf("there was an error decoding chunk %d of transfer %s: %s", i, id, err)
+		return
+	}
+	defer secure.Zero(data)
+
+	manifests.Lock()
+	m, ok := manifests.transfers[id]
+	var expected, path string
+	var first int
+	var duplicate bool
+	if ok && i >= 0 && i < len(m.Chunks) {
+		expected, first = m.Chunks[i], m.next()
+		path = fmt.Sprintf("%s.%s.%d", m.Destination, m.ID, i)
+		_, duplicate = m.received[i]
+	}
+	manifests.Unlock()
+	switch {
+	case !ok:
+		result.Stderr = fmt.Sprintf("%s is not a valid transfer ID, send the manifest first", id)
+		return
+	case expected == "":
+		result.Stderr = fmt.Sprintf("chunk %d is out of range for transfer %s with %d chunks", i, id, len(m.Chunks))
+		return
+	case duplicate:
+		result.Stdout = fmt.Sprintf("Chunk %d of transfer %s was already received", i, id)
+		return
+	case i >= first+m.Window:
+		result.Stderr = fmt.Sprintf("chunk %d of transfer %s is outside the window of chunks %d-%d, resend it", i, id, first, first+m.Window-1)
+		return
+	}
+
+	// Chunks in flight at the same time are verified and written concurrently
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != expected {
+		result.Stderr = fmt.Sprintf("chunk %d of transfer %s failed verification, resend it", i, id)
+		return
+	}
+	if err = vault.Write(path, data); err != nil {
+		result.Stderr = fmt.Sprintf("there was an error holding chunk %d of transfer %s: %s", i, id, err)
+		return
+	}
+
+	manifests.Lock()
+	defer manifests.Unlock()
+	if manifests.transfers[id] != m {
+		_ = vault.Remove(path)
+		result.Stderr = fmt.Sprintf("transfer %s was canceled or replaced while chunk %d was being written", id, i)
+		return
+	}
+	m.received[i] = path
+	m.Updated = time.Now().UTC()
+	if len(m.received) < len(m.Chunks) {
+		first = m.next()
+		result.Stdout = fmt.Sprintf("Verified chunk %d of transfer %s, %d of %d chunks received, window %d-%d", i, id, len(m.received), len(m.Chunks), first, min(first+m.Window, len(m.Chunks))-1)
+		return
+	}
+	if err = m.assemble(); err != nil {
+		result.Stderr = err.Error()
+		return
+	}
+	delete(manifests.transfers, id)
+	result.Stdout = fmt.Sprintf("Successfully uploaded file to %s in %d chunks, SHA256 %s verified", m.Destination, len(m.Chunks), m.SHA256)
+	return
+}
+
+// TransferWindowed returns true if a chunked transfer allowing more than one chunk in flight is in progress
+func TransferWindowed() bool {
+	manifests.Lock()
+	defer manifests.Unlock()
+	for _, m := range manifests.transfers {
+		if m.Window > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// next returns the index of the first chunk that has not been received, the manifests lock must be held
+func (m *manifest) next() int {
+	for i := range m.Chunks {
+		if _, ok := m.received[i]; !ok {
+			return i
+		}
+	}
+	return len(m.Chunks)
+}
+
+// min returns the smaller integer
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// assemble writes the chunks in order to a temporary file, verifies the file's hash, and moves it to the destination
+func (m *manifest) assemble() error {
+	tmp := m.Destination + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("there was an error creating %s: %s", tmp, err)
+	}
+	hash := sha256.New()
+	var size int64
+	for i := range m.Chunks {
+		data, e := vault.Read(m.received[i])
+		if e == nil {
+			_, _ = hash.Write(data)
+			size += int64(len(data))
+			_, e = f.Write(data)
+			secure.Zero(data)
+		}
+		if e != nil {
+			_ = f.Close()
+			_ = os.Remove(tmp)
+			return fmt.Errorf("there was an error writing chunk %d of transfer %s: %s", i, m.ID, e)
+		}
+	}
+	if err = f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("there was an error writing %s: %s", tmp, err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != m.SHA256 || size != m.Size {
+		_ = os.Remove(tmp)
+		m.removeChunks()
+		m.received = make(map[int]string)
+		return fmt.Errorf("the assembled file for transfer %s is %d bytes with SHA256 %s but %d bytes with %s was expected, every chunk must be resent", m.ID, size, sum, m.Size, m.SHA256)
+	}
+	if err = os.Rename(tmp, m.Destination); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("there was an error moving the file to %s: %s", m.Destination, err)
+	}
+	m.removeChunks()
+	return nil
+}
+
+// removeChunks removes the vault files holding the received chunks
+func (m *manifest) removeChunks() {
+	for _, path := range m.received {
+		_ = vault.Remove(path)
+	}
+}
+
+// status describes the transfer's progress and lists the chunks that still need to be sent
+func (m *manifest) status() string {
+	var missing []string
+	for i := range m.Chunks {
+		if _, ok := m.received[i]; !ok {
+			missing = append(missing, strconv.Itoa(i))
+		}
+	}
+	out := fmt.Sprintf("Transfer %s to %s: %d of %d chunks received, window %d", m.ID, m.Destination, len(m.received), len(m.Chunks), m.Window)
+	if len(missing) > 0 {
+		out += fmt.Sprintf(", missing %s", compactRanges(missing))
+	}
+	return out
+}
+
+// compactRanges collapses sorted chunk indexes into ranges such as 0-4,7,9-12
+func compactRanges(indexes []string) string {
+	var out []string
+	for i := 0; i < len(indexes); {
+		start, _ := strconv.Atoi(indexes[i])
+		end := start
+		j := i + 1
+		for ; j < len(indexes); j++ {
+			n, _ := strconv.Atoi(indexes[j])
+			if n != end+1 {
+				break
+			}
+			end = n
+		}
+		if end > start {
+			out = append(out, fmt.Sprintf("%d-%d", start, end))
+		} else {
+			out = append(out, strconv.Itoa(start))
+		}
+		i = j
+	}
+	return strings.Join(out, ",")
+}
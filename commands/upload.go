@@ -24,7 +24,6 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
-	"io/ioutil"
 
 	// Merlin Main
 	"github.com/Ne0nd0g/merlin/pkg/jobs"
@@ -35,9 +34,11 @@ import (
 
 // Upload receives a job from the server to upload a file from the host to the Merlin server
 func Upload(transfer jobs.FileTransfer) (jobs.FileTransfer, error) {
-	cli.Message(cli.DEBUG, "Entering into commands.Upload() function")
-	// Agent will be uploading a file to the server
-	cli.Message(cli.NOTE, "FileTransfer type: Upload")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into commands.Upload() function")
+		// Agent will be uploading a file to the server
+		cli.Message(cli.NOTE, "FileTransfer type: Upload")
+	}
 
 	// Setup OS environment, if any
 	err := Setup()
@@ -46,23 +47,29 @@ func Upload(transfer jobs.FileTransfer) (jobs.FileTransfer, error) {
 	}
 	defer TearDown()
 
-	fileData, fileDataErr := ioutil.ReadFile(transfer.FileLocation)
+	fileData, fileDataErr := readFile(transfer.FileLocation)
 	if fileDataErr != nil {
-		cli.Message(cli.WARN, fmt.Sprintf("There was an error reading %s", transfer.FileLocation))
-		cli.Message(cli.WARN, fileDataErr.Error())
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("There was an error reading %s", transfer.FileLocation))
+			cli.Message(cli.WARN, fileDataErr.Error())
+		}
 		return jobs.FileTransfer{}, fmt.Errorf("there was an error reading %s:\r\n%s", transfer.FileLocation, fileDataErr.Error())
 	}
 
 	fileHash := sha1.New() // #nosec G401 // Use SHA1 because it is what many Blue Team tools use
 	_, errW := io.WriteString(fileHash, string(fileData))
 	if errW != nil {
-		cli.Message(cli.WARN, fmt.Sprintf("There was an error generating the SHA1 file hash e:\r\n%s", errW.Error()))
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("There was an error generating the SHA1 file hash e:\r\n%s", errW.Error()))
+		}
 	}
 
-	cli.Message(cli.NOTE, fmt.Sprintf("Uploading file %s of size %d bytes and a SHA1 hash of %x to the server",
-		transfer.FileLocation,
-		len(fileData),
-		fileHash.Sum(nil)))
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Uploading file %s of size %d bytes and a SHA1 hash of %x to the server",
+			transfer.FileLocation,
+			len(fileData),
+			fileHash.Sum(nil)))
+	}
 
 	ft := jobs.FileTransfer{
 		FileLocation: transfer.FileLocation,
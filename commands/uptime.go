@@ -30,7 +30,9 @@ import (
 // Uptime retrieves the system's uptime
 // Windows only
 func Uptime() jobs.Results {
-	cli.Message(cli.DEBUG, "entering Uptime()")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "entering Uptime()")
+	}
 	return jobs.Results{
 		Stderr: "the Uptime command is not supported by this agent type",
 	}
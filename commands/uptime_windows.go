@@ -35,7 +35,9 @@ import (
 
 // Uptime uses the Windows API to get the host's uptime
 func Uptime() jobs.Results {
-	cli.Message(cli.DEBUG, fmt.Sprintf("entering Uptime()"))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Uptime()"))
+	}
 	var results jobs.Results
 
 	kernel32 := windows.NewLazySystemDLL("kernel32")
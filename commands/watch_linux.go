@@ -0,0 +1,120 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask is the set of inotify events that are translated to create, modify, and delete events
+const inotifyMask = unix.IN_CREATE | unix.IN_MOVED_TO | unix.IN_CLOSE_WRITE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_DELETE_SELF
+
+// watchFiles uses inotify to watch the file, or the directory and its subdirectories, until stopped
+func watchFiles(root string, events chan<- fsEvent, stop <-chan struct{}) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	watches := make(map[int]string)
+	add := func(path string) {
+		if len(watches) >= maxWatchDirectories {
+			return
+		}
+		if wd, err := unix.InotifyAddWatch(fd, path, inotifyMask); err == nil {
+			watches[wd] = path
+		}
+	}
+	addTree := func(dir string) {
+		_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				add(path)
+			}
+			return nil
+		})
+	}
+	if info.IsDir() {
+		addTree(root)
+	} else {
+		add(root)
+	}
+	if len(watches) == 0 {
+		return unix.ENOSPC
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		if _, err = unix.Poll([]unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}, 1000); err != nil && err != unix.EINTR {
+			return err
+		}
+		n, err := unix.Read(fd, buf)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			name := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(raw.Len)]
+			offset += unix.SizeofInotifyEvent + int(raw.Len)
+
+			path := watches[int(raw.Wd)]
+			if name = bytes.TrimRight(name, "\x00"); len(name) > 0 {
+				path = filepath.Join(path, string(name))
+			}
+			switch {
+			case raw.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+				if raw.Mask&unix.IN_ISDIR != 0 && info.IsDir() {
+					addTree(path)
+				}
+				events <- fsEvent{Op: "create", Path: path}
+			case raw.Mask&unix.IN_CLOSE_WRITE != 0:
+				events <- fsEvent{Op: "modify", Path: path}
+			case raw.Mask&(unix.IN_DELETE|unix.IN_MOVED_FROM|unix.IN_DELETE_SELF) != 0:
+				events <- fsEvent{Op: "delete", Path: path}
+			case raw.Mask&unix.IN_IGNORED != 0:
+				delete(watches, int(raw.Wd))
+			}
+		}
+		if len(watches) == 0 {
+			return nil
+		}
+	}
+}
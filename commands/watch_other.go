@@ -0,0 +1,94 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// watchPollInterval is how often the file tree is compared against the last snapshot
+const watchPollInterval = 2 * time.Second
+
+// fileState is the modification time and size used to detect changes
+type fileState struct {
+	modified time.Time
+	size     int64
+}
+
+// watchFiles polls the file, or the directory and its subdirectories, for changes until stopped because there is no
+// native watcher wired up for this operating system
+func watchFiles(root string, events chan<- fsEvent, stop <-chan struct{}) error {
+	snapshot := func() (map[string]fileState, error) {
+		files := make(map[string]fileState)
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if len(files) >= maxWatchDirectories*16 {
+				return filepath.SkipDir
+			}
+			if info, e := d.Info(); e == nil && !d.IsDir() {
+				files[path] = fileState{modified: info.ModTime(), size: info.Size()}
+			}
+			return nil
+		})
+		return files, err
+	}
+	if _, err := os.Stat(root); err != nil {
+		return err
+	}
+	previous, err := snapshot()
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+		current, err := snapshot()
+		if err != nil {
+			continue
+		}
+		for path, state := range current {
+			old, ok := previous[path]
+			switch {
+			case !ok:
+				events <- fsEvent{Op: "create", Path: path}
+			case !old.modified.Equal(state.modified) || old.size != state.size:
+				events <- fsEvent{Op: "modify", Path: path}
+			}
+		}
+		for path := range previous {
+			if _, ok := current[path]; !ok {
+				events <- fsEvent{Op: "delete", Path: path}
+			}
+		}
+		previous = current
+	}
+}
@@ -0,0 +1,121 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+// watchFiles uses ReadDirectoryChangesW to watch the directory and its subdirectories, or the directory containing
+// the file, until stopped
+func watchFiles(root string, events chan<- fsEvent, stop <-chan struct{}) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	dir, only := root, ""
+	if !info.IsDir() {
+		dir, only = filepath.Dir(root), filepath.Base(root)
+	}
+	name, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return err
+	}
+	handle, err := windows.CreateFile(
+		name,
+		windows.FILE_LIST_DIRECTORY,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil,
+		windows.OPEN_EXISTING,
+		windows.FILE_FLAG_BACKUP_SEMANTICS|windows.FILE_FLAG_OVERLAPPED,
+		0,
+	)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(handle)
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(event)
+
+	filter := uint32(windows.FILE_NOTIFY_CHANGE_FILE_NAME | windows.FILE_NOTIFY_CHANGE_DIR_NAME | windows.FILE_NOTIFY_CHANGE_LAST_WRITE | windows.FILE_NOTIFY_CHANGE_SIZE)
+	// DWORD aligned buffer for FILE_NOTIFY_INFORMATION records
+	buf := make([]uint32, 16*1024)
+	for {
+		overlapped := windows.Overlapped{HEvent: event}
+		if err = windows.ReadDirectoryChanges(handle, (*byte)(unsafe.Pointer(&buf[0])), uint32(len(buf)*4), info.IsDir(), filter, nil, &overlapped, 0); err != nil {
+			return err
+		}
+		var n uint32
+		for {
+			select {
+			case <-stop:
+				_ = windows.CancelIoEx(handle, &overlapped)
+				_ = windows.GetOverlappedResult(handle, &overlapped, &n, true)
+				return nil
+			default:
+			}
+			s, e := windows.WaitForSingleObject(event, 1000)
+			if e != nil {
+				return e
+			}
+			if s == windows.WAIT_OBJECT_0 {
+				break
+			}
+		}
+		if err = windows.GetOverlappedResult(handle, &overlapped, &n, false); err != nil {
+			return err
+		}
+		if n == 0 {
+			// The buffer overflowed and the changes were lost
+			continue
+		}
+		for offset := uint32(0); ; {
+			record := (*windows.FileNotifyInformation)(unsafe.Pointer(uintptr(unsafe.Pointer(&buf[0])) + uintptr(offset)))
+			file := windows.UTF16ToString(unsafe.Slice(&record.FileName, record.FileNameLength/2))
+			if only == "" || strings.EqualFold(file, only) {
+				path := filepath.Join(dir, file)
+				switch record.Action {
+				case windows.FILE_ACTION_ADDED, windows.FILE_ACTION_RENAMED_NEW_NAME:
+					events <- fsEvent{Op: "create", Path: path}
+				case windows.FILE_ACTION_MODIFIED:
+					events <- fsEvent{Op: "modify", Path: path}
+				case windows.FILE_ACTION_REMOVED, windows.FILE_ACTION_RENAMED_OLD_NAME:
+					events <- fsEvent{Op: "delete", Path: path}
+				}
+			}
+			if record.NextEntryOffset == 0 {
+				break
+			}
+			offset += record.NextEntryOffset
+		}
+		_ = windows.ResetEvent(event)
+	}
+}
@@ -0,0 +1,78 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package commands
+
+import (
+	// Standard
+	"fmt"
+	"strings"
+
+	// Merlin Main
+	"github.com/Ne0nd0g/merlin/pkg/jobs"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cache"
+	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/staging"
+	"github.com/Ne0nd0g/merlin-agent/vault"
+)
+
+// Wipe renders everything the agent has collected unrecoverable: every staged item and cached payload is removed,
+// every file the vault wrote is overwritten and deleted, and the vault key is replaced
+// wipe
+// wipe files
+func Wipe(cmd jobs.Command) (results jobs.Results) {
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("entering Wipe() with %+v", cmd))
+	}
+	if len(cmd.Args) > 0 {
+		if strings.ToLower(cmd.Args[0]) != "files" {
+			results.Stderr = fmt.Sprintf("unknown wipe command: %s", cmd.Args[0])
+			return
+		}
+		files := vault.Files()
+		if len(files) == 0 {
+			results.Stdout = "the agent has not written any encrypted files"
+			return
+		}
+		results.Stdout = strings.Join(files, "\n")
+		return
+	}
+
+	var errs []string
+	// Spilled staging items and cached payloads are vault files removed by the purge
+	files := vault.Files()
+	count, err := staging.Purge()
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	cached, err := cache.Purge()
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	if _, err = vault.Wipe(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	remaining := vault.Files()
+	results.Stdout = fmt.Sprintf("Purged %d staged items and %d cached payloads, wiped %d of %d encrypted files, and replaced the vault key", count, cached, len(files)-len(remaining), len(files))
+	if len(files) > 0 {
+		results.Stdout += "\n" + strings.Join(files, "\n")
+	}
+	results.Stderr = strings.Join(errs, "\n")
+	return
+}
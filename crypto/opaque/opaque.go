@@ -49,7 +49,9 @@ type User struct {
 
 // UserRegisterInit is used to perform the OPAQUE Password Authenticated Key Exchange (PAKE) protocol Registration steps for the user
 func UserRegisterInit(AgentID uuid.UUID) (opaque.Opaque, *User, error) {
-	cli.Message(cli.DEBUG, "Entering into opaque.UserRegisterInit...")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into opaque.UserRegisterInit...")
+	}
 	var user User
 	// Generate a random password and run it through 5000 iterations of PBKDF2; Used with OPAQUE
 	x := core.RandStringBytesMaskImprSrc(30)
@@ -59,9 +61,11 @@ func UserRegisterInit(AgentID uuid.UUID) (opaque.Opaque, *User, error) {
 	user.reg = gopaque.NewUserRegister(gopaque.CryptoDefault, AgentID.Bytes(), nil)
 	userRegInit := user.reg.Init(user.pwdU)
 
-	cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE UserID: %x", userRegInit.UserID))
-	cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE Alpha: %v", userRegInit.Alpha))
-	cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE PwdU: %x", user.pwdU))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE UserID: %x", userRegInit.UserID))
+		cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE Alpha: %v", userRegInit.Alpha))
+		cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE PwdU: %x", user.pwdU))
+	}
 
 	userRegInitBytes, errUserRegInitBytes := userRegInit.ToBytes()
 	if errUserRegInitBytes != nil {
@@ -79,7 +83,9 @@ func UserRegisterInit(AgentID uuid.UUID) (opaque.Opaque, *User, error) {
 
 // UserRegisterComplete consumes the Server's response and finishes OPAQUE registration
 func UserRegisterComplete(regInitResp opaque.Opaque, user *User) (opaque.Opaque, error) {
-	cli.Message(cli.DEBUG, "Entering into opaque.UserRegisterComplete...")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into opaque.UserRegisterComplete...")
+	}
 
 	if regInitResp.Type != opaque.RegInit {
 		return opaque.Opaque{}, fmt.Errorf("expected OPAQUE message type %d, got %d", opaque.RegInit, regInitResp.Type)
@@ -94,10 +100,12 @@ func UserRegisterComplete(regInitResp opaque.Opaque, user *User) (opaque.Opaque,
 			return opaque.Opaque{}, fmt.Errorf("there was an error unmarshalling the OPAQUE server register initialization message from bytes:\r\n%s", errServerRegInit.Error())
 		}
 
-		cli.Message(cli.NOTE, "Received OPAQUE server registration initialization message")
-		cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE Beta: %v", serverRegInit.Beta))
-		cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE V: %v", serverRegInit.V))
-		cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE PubS: %s", serverRegInit.ServerPublicKey))
+		if cli.Enabled {
+			cli.Message(cli.NOTE, "Received OPAQUE server registration initialization message")
+			cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE Beta: %v", serverRegInit.Beta))
+			cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE V: %v", serverRegInit.V))
+			cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE PubS: %s", serverRegInit.ServerPublicKey))
+		}
 
 		// TODO extend gopaque to run RwdU through n iterations of PBKDF2
 		user.regComplete = user.reg.Complete(&serverRegInit)
@@ -108,8 +116,10 @@ func UserRegisterComplete(regInitResp opaque.Opaque, user *User) (opaque.Opaque,
 		return opaque.Opaque{}, fmt.Errorf("there was an error marshalling the OPAQUE user registration complete message to bytes:\r\n%s", errUserRegCompleteBytes.Error())
 	}
 
-	cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE EnvU: %x", user.regComplete.EnvU))
-	cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE PubU: %v", user.regComplete.UserPublicKey))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE EnvU: %x", user.regComplete.EnvU))
+		cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE PubU: %v", user.regComplete.UserPublicKey))
+	}
 
 	// message to be sent to the server
 	regComplete := opaque.Opaque{
@@ -122,7 +132,9 @@ func UserRegisterComplete(regInitResp opaque.Opaque, user *User) (opaque.Opaque,
 
 // UserAuthenticateInit is used to authenticate an agent leveraging the OPAQUE Password Authenticated Key Exchange (PAKE) protocol
 func UserAuthenticateInit(AgentID uuid.UUID, user *User) (opaque.Opaque, error) {
-	cli.Message(cli.DEBUG, "Entering into opaque.UserAuthenticateInit...")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into opaque.UserAuthenticateInit...")
+	}
 
 	// 1 - Create a NewUserAuth with an embedded key exchange
 	user.Kex = gopaque.NewKeyExchangeSigma(gopaque.CryptoDefault)
@@ -150,7 +162,9 @@ func UserAuthenticateInit(AgentID uuid.UUID, user *User) (opaque.Opaque, error)
 
 // UserAuthenticateComplete consumes the Server's authentication message and finishes the user authentication and key exchange
 func UserAuthenticateComplete(authInitResp opaque.Opaque, user *User) (opaque.Opaque, error) {
-	cli.Message(cli.DEBUG, "Entering into opaque.UserAuthenticateComplete...")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "Entering into opaque.UserAuthenticateComplete...")
+	}
 
 	if authInitResp.Type != opaque.AuthInit {
 		return opaque.Opaque{}, fmt.Errorf("expected OPAQUE message type: %d, received: %d", opaque.AuthInit, authInitResp.Type)
@@ -167,11 +181,13 @@ func UserAuthenticateComplete(authInitResp opaque.Opaque, user *User) (opaque.Op
 	// 4 - Call Complete with the server's ServerAuthComplete. The resulting UserAuthFinish has user and server key
 	// information. This would be the last step if we were not using an embedded key exchange. Since we are, take the
 	// resulting UserAuthComplete and send it to the server.
-	cli.Message(cli.NOTE, "Received OPAQUE server complete message")
-	cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE Beta: %x", serverComplete.Beta))
-	cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE V: %x", serverComplete.V))
-	cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE PubS: %x", serverComplete.ServerPublicKey))
-	cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE EnvU: %x", serverComplete.EnvU))
+	if cli.Enabled {
+		cli.Message(cli.NOTE, "Received OPAQUE server complete message")
+		cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE Beta: %x", serverComplete.Beta))
+		cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE V: %x", serverComplete.V))
+		cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE PubS: %x", serverComplete.ServerPublicKey))
+		cli.Message(cli.DEBUG, fmt.Sprintf("OPAQUE EnvU: %x", serverComplete.EnvU))
+	}
 
 	_, userAuthComplete, errUserAuth := user.auth.Complete(&serverComplete)
 	if errUserAuth != nil {
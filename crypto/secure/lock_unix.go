@@ -0,0 +1,43 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package secure
+
+import (
+	// X Packages
+	"golang.org/x/sys/unix"
+)
+
+// alloc maps anonymous memory outside the Go heap and locks it so it is not written to swap
+func alloc(size int) ([]byte, bool) {
+	data, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, false
+	}
+	// Locking can fail when RLIMIT_MEMLOCK is reached; the mapping is still outside the Go heap
+	_ = unix.Mlock(data)
+	return data, true
+}
+
+// free unlocks and unmaps memory returned from alloc
+func free(data []byte) {
+	_ = unix.Munlock(data)
+	_ = unix.Munmap(data)
+}
@@ -0,0 +1,49 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package secure
+
+import (
+	// Standard
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+// alloc allocates memory outside the Go heap and locks it so it is not written to the page file
+func alloc(size int) ([]byte, bool) {
+	addr, err := windows.VirtualAlloc(0, uintptr(size), windows.MEM_COMMIT|windows.MEM_RESERVE, windows.PAGE_READWRITE)
+	if err != nil {
+		return nil, false
+	}
+	// Locking can fail when the process's minimum working set size is exceeded; the allocation is still outside the Go heap
+	_ = windows.VirtualLock(addr, uintptr(size))
+	// Convert the address without a uintptr to unsafe.Pointer conversion; the memory is not managed by the Go runtime
+	ptr := *(*unsafe.Pointer)(unsafe.Pointer(&addr))
+	return unsafe.Slice((*byte)(ptr), size), true
+}
+
+// free unlocks and releases memory returned from alloc
+func free(data []byte) {
+	addr := uintptr(unsafe.Pointer(&data[0]))
+	_ = windows.VirtualUnlock(addr, uintptr(len(data)))
+	_ = windows.VirtualFree(addr, 0, windows.MEM_RELEASE)
+}
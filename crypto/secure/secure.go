@@ -0,0 +1,159 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package secure
+
+import (
+	// Standard
+	"crypto/rand"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Zero overwrites the contents of a byte slice so the data no longer resides in memory
+func Zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+	// Prevent the compiler from treating the writes as dead stores
+	runtime.KeepAlive(b)
+}
+
+// ZeroUint16 overwrites the contents of a uint16 slice such as a Windows UTF-16 string
+func ZeroUint16(b []uint16) {
+	for i := range b {
+		b[i] = 0
+	}
+	runtime.KeepAlive(b)
+}
+
+// Buffer holds sensitive data, such as a key, in memory that is locked so that it is not written to swap and that is not
+// managed, or copied, by the Go garbage collector
+// If the memory could not be allocated or locked, the data is kept in a regular byte slice and is still zeroed when destroyed
+type Buffer struct {
+	sync.Mutex
+	data   []byte
+	locked bool
+}
+
+// NewBuffer copies data into a new locked Buffer and zeroes the original data
+func NewBuffer(data []byte) *Buffer {
+	buf := &Buffer{}
+	if len(data) > 0 {
+		buf.data, buf.locked = alloc(len(data))
+	}
+	if !buf.locked {
+		buf.data = make([]byte, len(data))
+	}
+	copy(buf.data, data)
+	Zero(data)
+	masks.Lock()
+	masks.buffers[buf] = nil
+	masks.Unlock()
+	return buf
+}
+
+// Bytes returns the data held in the Buffer
+// The returned slice must not be used after the Buffer is destroyed
+func (b *Buffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	b.Lock()
+	defer b.Unlock()
+	return b.data
+}
+
+// Destroy zeroes the Buffer's data and releases any locked memory
+func (b *Buffer) Destroy() {
+	if b == nil {
+		return
+	}
+	masks.Lock()
+	if pad := masks.buffers[b]; pad != nil {
+		Zero(pad)
+	}
+	delete(masks.buffers, b)
+	masks.Unlock()
+	b.Lock()
+	defer b.Unlock()
+	Zero(b.data)
+	if b.locked {
+		free(b.data)
+	}
+	b.data = nil
+	b.locked = false
+}
+
+// masks tracks every Buffer that has not been destroyed and, while the Buffers are masked, the random pad each one's
+// data was XORed with
+var masks = struct {
+	sync.Mutex
+	buffers map[*Buffer][]byte
+	masked  bool
+}{buffers: make(map[*Buffer][]byte)}
+
+// Mask XORs the data of every Buffer with its own random pad so key material can't be found in a memory dump while
+// the agent is idle for a long time. Buffers must not be used until Unmask is called
+func Mask() error {
+	masks.Lock()
+	defer masks.Unlock()
+	if masks.masked {
+		return nil
+	}
+	for b := range masks.buffers {
+		b.Lock()
+		pad := make([]byte, len(b.data))
+		if _, err := rand.Read(pad); err != nil {
+			b.Unlock()
+			unmask()
+			return fmt.Errorf("there was an error generating a memory mask: %s", err)
+		}
+		for i := range b.data {
+			b.data[i] ^= pad[i]
+		}
+		masks.buffers[b] = pad
+		b.Unlock()
+	}
+	masks.masked = true
+	return nil
+}
+
+// Unmask restores the data of every Buffer masked by Mask
+func Unmask() {
+	masks.Lock()
+	defer masks.Unlock()
+	unmask()
+	masks.masked = false
+}
+
+// unmask XORs every Buffer that has a pad with it and zeroes the pad; the masks lock must be held
+func unmask() {
+	for b, pad := range masks.buffers {
+		if pad == nil {
+			continue
+		}
+		b.Lock()
+		for i := range b.data {
+			b.data[i] ^= pad[i]
+		}
+		b.Unlock()
+		Zero(pad)
+		masks.buffers[b] = nil
+	}
+}
@@ -16,6 +16,7 @@ require (
 	golang.org/x/crypto v0.1.0
 	golang.org/x/net v0.1.0
 	golang.org/x/sys v0.1.0
+	golang.org/x/text v0.4.0
 	gopkg.in/square/go-jose.v2 v2.6.0
 )
 
@@ -42,6 +43,5 @@ require (
 	go.dedis.ch/kyber/v3 v3.0.13 // indirect
 	golang.org/x/exp v0.0.0-20220722155223-a9213eeb770e // indirect
 	golang.org/x/mod v0.6.0-dev.0.20220419223038-86c51ed26bb4 // indirect
-	golang.org/x/text v0.4.0 // indirect
 	golang.org/x/tools v0.1.12 // indirect
 )
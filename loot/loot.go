@@ -0,0 +1,148 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package loot
+
+import (
+	// Standard
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	// X Packages
+	"golang.org/x/crypto/nacl/box"
+)
+
+// Header and Footer armor sealed text results so they can be found and decrypted with the operator's private key
+const (
+	Header = "-----BEGIN MERLIN SEALED LOOT-----"
+	Footer = "-----END MERLIN SEALED LOOT-----"
+)
+
+// Extension is appended to the name of file transfers sealed to the operator's public key
+const Extension = ".sealed"
+
+// DefaultModules are the modules whose results are sealed when an operator public key is configured
+var DefaultModules = []string{"askcreds", "cloud", "dcsync", "hashdump", "minidump", "ntds", "ntlmcapture", "responder", "roast", "sccm", "spray", "sshkeys"}
+
+// loot holds the operator's X25519 public key and the modules whose results are sealed to it
+var loot = struct {
+	sync.RWMutex
+	key     *[32]byte
+	modules map[string]bool
+}{}
+
+func init() {
+	_ = SetModules(DefaultModules)
+}
+
+// SetKey sets the operator's base64 encoded X25519 public key that sensitive results are sealed to. An empty key or
+// "off" stops sealing results
+func SetKey(key string) error {
+	if key == "" || strings.EqualFold(key, "off") {
+		loot.Lock()
+		loot.key = nil
+		loot.Unlock()
+		return nil
+	}
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("there was an error decoding the operator public key: %s", err)
+	}
+	if len(b) != 32 {
+		return fmt.Errorf("the operator public key must be 32 bytes but was %d", len(b))
+	}
+	var k [32]byte
+	copy(k[:], b)
+	loot.Lock()
+	loot.key = &k
+	loot.Unlock()
+	return nil
+}
+
+// Key returns the base64 encoded operator public key, or an empty string if one is not configured
+func Key() string {
+	loot.RLock()
+	defer loot.RUnlock()
+	if loot.key == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(loot.key[:])
+}
+
+// SetModules replaces the modules whose results are sealed
+func SetModules(modules []string) error {
+	m := make(map[string]bool)
+	for _, module := range modules {
+		if module = strings.ToLower(strings.TrimSpace(module)); module != "" {
+			m[module] = true
+		}
+	}
+	loot.Lock()
+	loot.modules = m
+	loot.Unlock()
+	return nil
+}
+
+// Modules returns the modules whose results are sealed
+func Modules() (modules []string) {
+	loot.RLock()
+	for module := range loot.modules {
+		modules = append(modules, module)
+	}
+	loot.RUnlock()
+	sort.Strings(modules)
+	return
+}
+
+// Sensitive returns true if an operator public key is configured and the module's results are sealed
+func Sensitive(module string) bool {
+	loot.RLock()
+	defer loot.RUnlock()
+	return loot.key != nil && loot.modules[strings.ToLower(module)]
+}
+
+// Seal encrypts the data to the operator's public key with an anonymous NaCl box, only the holder of the private key
+// can open it with box.OpenAnonymous
+func Seal(data []byte) ([]byte, error) {
+	loot.RLock()
+	key := loot.key
+	loot.RUnlock()
+	if key == nil {
+		return nil, fmt.Errorf("an operator public key is not configured")
+	}
+	return box.SealAnonymous(nil, data, key, rand.Reader)
+}
+
+// Armor seals the text and wraps the base64 encoded box between the Header and Footer lines
+func Armor(text string) (string, error) {
+	sealed, err := Seal([]byte(text))
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.StdEncoding.EncodeToString(sealed)
+	var lines []string
+	for len(encoded) > 76 {
+		lines = append(lines, encoded[:76])
+		encoded = encoded[76:]
+	}
+	lines = append(lines, encoded)
+	return fmt.Sprintf("%s\n%s\n%s\n", Header, strings.Join(lines, "\n"), Footer), nil
+}
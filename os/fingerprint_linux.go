@@ -0,0 +1,42 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+import (
+	// Standard
+	"os"
+	"strings"
+)
+
+// getMachineIDs returns the systemd or dbus machine ID. The DMI product UUID is not used because only root can read it
+func getMachineIDs() (ids []string) {
+	for _, file := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		// #nosec G304 -- hardcoded file paths
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return []string{id}
+		}
+	}
+	return
+}
@@ -0,0 +1,49 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+import (
+	// X Packages
+	"golang.org/x/sys/windows/registry"
+)
+
+// getMachineIDs returns the Windows MachineGuid and the SMBIOS system UUID, if readable
+func getMachineIDs() (ids []string) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Cryptography`, registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err == nil {
+		guid, _, err := key.GetStringValue("MachineGuid")
+		if err == nil && guid != "" {
+			ids = append(ids, guid)
+		}
+		key.Close()
+	}
+
+	// LastConfig holds the SMBIOS system UUID of the current hardware profile
+	key, err = registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\HardwareConfig`, registry.QUERY_VALUE)
+	if err == nil {
+		uuid, _, err := key.GetStringValue("LastConfig")
+		if err == nil && uuid != "" {
+			ids = append(ids, uuid)
+		}
+		key.Close()
+	}
+	return
+}
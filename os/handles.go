@@ -0,0 +1,32 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+// Handle is a handle, or file descriptor, that a process has open
+type Handle struct {
+	Value  uint64 // Value is the handle or file descriptor number in the process
+	Type   string // Type is the kind of object such as File, Token, Mutant, socket, or pipe
+	Access string // Access is the access the handle was granted
+	Name   string // Name is the object's name or path, empty if it doesn't have one or it couldn't be read
+	Note   string // Note flags a handle that gives access to a more privileged object, such as another user's token
+}
+
+// Handles returns the handles the process has open
+func Handles(pid int) ([]Handle, error) {
+	return handles(pid)
+}
@@ -0,0 +1,77 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// handles returns the process's open file descriptors from /proc/<pid>/fd with the access mode from fdinfo
+func handles(pid int) (found []Handle, err error) {
+	dir := fmt.Sprintf("/proc/%d/fd", pid)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error reading the file descriptors of process %d: %s", pid, err)
+	}
+	self := os.Geteuid()
+	var linkErr error
+	for _, entry := range entries {
+		fd, err := strconv.ParseUint(entry.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+		link, err := os.Readlink(dir + "/" + entry.Name())
+		if err != nil {
+			linkErr = err
+			continue
+		}
+		h := Handle{Value: fd, Type: "file", Name: link}
+		// Special files are linked as type:[inode] or anon_inode:name
+		if kind, name, ok := strings.Cut(link, ":"); ok && !strings.HasPrefix(link, "/") {
+			h.Type, h.Name = kind, name
+		}
+		if info, err := os.ReadFile(fmt.Sprintf("/proc/%d/fdinfo/%d", pid, fd)); err == nil {
+			for _, line := range strings.Split(string(info), "\n") {
+				if strings.HasPrefix(line, "flags:") {
+					mode, _ := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "flags:")), 8, 64)
+					h.Access = []string{"read", "write", "read/write", "read/write"}[mode&3]
+				}
+			}
+		}
+		// An open file the agent can't open itself is readable or writable through the process
+		if h.Type == "file" && self != 0 {
+			// R_OK, checked without opening the file, which could be a FIFO that blocks
+			if err := syscall.Access(link, 4); err == syscall.EACCES {
+				h.Note = "the agent can't read this file"
+			}
+		}
+		found = append(found, h)
+	}
+	if len(found) == 0 && linkErr != nil {
+		return nil, fmt.Errorf("there was an error reading the file descriptors of process %d: %s", pid, linkErr)
+	}
+	return found, nil
+}
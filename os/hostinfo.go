@@ -0,0 +1,107 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+import (
+	// Standard
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HostInfo contains details about the host operating system that operators would otherwise have to gather with
+// follow-up commands on every new agent
+type HostInfo struct {
+	Domain    string   // Domain is the Active Directory domain, workgroup, or DNS domain the host belongs to
+	OSVersion string   // OSVersion is the operating system's product name and version
+	OSBuild   string   // OSBuild is the operating system's build or kernel release number
+	Locale    string   // Locale is the system or user locale (e.g., en-US)
+	TimeZone  string   // TimeZone is the host's configured time zone
+	Elevation string   // Elevation is the agent's security context such as UAC elevation type, SELinux mode, or TCC access
+	Gateways  []string // Gateways is a list of the host's default gateways
+}
+
+// GetHostInfo gathers information about the host operating system
+// Any piece of information that can't be determined is left empty
+func GetHostInfo() (info HostInfo) {
+	info = getHostInfo()
+	if info.TimeZone == "" {
+		info.TimeZone = timeZone()
+	}
+	return
+}
+
+// Gateways returns the host's current default gateways
+func Gateways() []string {
+	return gateways()
+}
+
+// timeZone returns the IANA name of the local time zone, if it can be determined, otherwise the zone abbreviation
+func timeZone() string {
+	if tz := os.Getenv("TZ"); tz != "" {
+		return tz
+	}
+	// /etc/localtime is typically a symbolic link into the zoneinfo database
+	if link, err := os.Readlink("/etc/localtime"); err == nil {
+		if i := strings.Index(link, "zoneinfo/"); i >= 0 {
+			return link[i+len("zoneinfo/"):]
+		}
+		return filepath.Base(link)
+	}
+	name, _ := time.Now().Zone()
+	return name
+}
+
+// resolvDomain returns the domain or first search domain from /etc/resolv.conf
+func resolvDomain() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	var search string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "domain":
+			return fields[1]
+		case "search":
+			if search == "" {
+				search = fields[1]
+			}
+		}
+	}
+	return search
+}
+
+// locale returns the locale from the POSIX environment variables
+func locale() string {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if l := os.Getenv(env); l != "" {
+			return l
+		}
+	}
+	return ""
+}
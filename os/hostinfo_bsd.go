@@ -0,0 +1,100 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+import (
+	// Standard
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	// X Packages
+	"golang.org/x/net/route"
+	"golang.org/x/sys/unix"
+)
+
+// getHostInfo gathers macOS and FreeBSD specific host information
+func getHostInfo() (info HostInfo) {
+	info.Domain = resolvDomain()
+	info.Locale = locale()
+	info.Gateways = gateways()
+
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err == nil {
+		info.OSVersion = fmt.Sprintf("%s %s", unix.ByteSliceToString(uname.Sysname[:]), unix.ByteSliceToString(uname.Release[:]))
+	}
+
+	if runtime.GOOS == "darwin" {
+		if version, err := unix.Sysctl("kern.osproductversion"); err == nil {
+			info.OSVersion = fmt.Sprintf("macOS %s", version)
+		}
+		if build, err := unix.Sysctl("kern.osversion"); err == nil {
+			info.OSBuild = build
+		}
+		// Reading the user's TCC database requires Full Disk Access
+		if home, err := os.UserHomeDir(); err == nil {
+			f, err := os.Open(filepath.Join(home, "Library", "Application Support", "com.apple.TCC", "TCC.db"))
+			if err == nil {
+				f.Close()
+				info.Elevation = "TCC Full Disk Access"
+			} else {
+				info.Elevation = "TCC No Full Disk Access"
+			}
+		}
+	} else if build, err := unix.Sysctl("kern.osrevision"); err == nil {
+		info.OSBuild = build
+	}
+	return
+}
+
+// gateways parses the kernel's routing information base for IPv4 default routes
+func gateways() (gws []string) {
+	rib, err := route.FetchRIB(syscall.AF_INET, route.RIBTypeRoute, 0)
+	if err != nil {
+		return
+	}
+	msgs, err := route.ParseRIB(route.RIBTypeRoute, rib)
+	if err != nil {
+		return
+	}
+	for _, msg := range msgs {
+		rm, ok := msg.(*route.RouteMessage)
+		if !ok || rm.Flags&syscall.RTF_GATEWAY == 0 || len(rm.Addrs) <= syscall.RTAX_GATEWAY {
+			continue
+		}
+		dst, ok := rm.Addrs[syscall.RTAX_DST].(*route.Inet4Addr)
+		if !ok || dst.IP != [4]byte{} {
+			continue
+		}
+		if gw, ok := rm.Addrs[syscall.RTAX_GATEWAY].(*route.Inet4Addr); ok {
+			ip := net.IP(gw.IP[:])
+			if iface, err := net.InterfaceByIndex(rm.Index); err == nil {
+				gws = append(gws, fmt.Sprintf("%s (%s)", ip, iface.Name))
+			} else {
+				gws = append(gws, ip.String())
+			}
+		}
+	}
+	return
+}
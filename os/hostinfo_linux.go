@@ -0,0 +1,113 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+import (
+	// Standard
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	// X Packages
+	"golang.org/x/sys/unix"
+)
+
+// getHostInfo gathers Linux specific host information
+func getHostInfo() (info HostInfo) {
+	info.Domain = resolvDomain()
+	info.OSVersion = osRelease()
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err == nil {
+		info.OSBuild = unix.ByteSliceToString(uname.Release[:])
+	}
+	info.Locale = locale()
+	if tz, err := os.ReadFile("/etc/timezone"); err == nil {
+		info.TimeZone = strings.TrimSpace(string(tz))
+	}
+	info.Elevation = selinux()
+	info.Gateways = gateways()
+	return
+}
+
+// osRelease returns the PRETTY_NAME from the os-release file
+func osRelease() string {
+	for _, file := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		f, err := os.Open(file) // #nosec G304 -- hardcoded file paths
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "PRETTY_NAME=") {
+				f.Close()
+				return strings.Trim(strings.TrimPrefix(scanner.Text(), "PRETTY_NAME="), "\"'")
+			}
+		}
+		f.Close()
+	}
+	return ""
+}
+
+// selinux returns the SELinux mode and the agent process's security context, if SELinux is enabled
+func selinux() string {
+	enforce, err := os.ReadFile("/sys/fs/selinux/enforce")
+	if err != nil {
+		return ""
+	}
+	mode := "SELinux Permissive"
+	if strings.TrimSpace(string(enforce)) == "1" {
+		mode = "SELinux Enforcing"
+	}
+	if context, err := os.ReadFile("/proc/self/attr/current"); err == nil {
+		mode += fmt.Sprintf(" (%s)", strings.Trim(string(context), "\x00\n "))
+	}
+	return mode
+}
+
+// gateways parses the kernel's IPv4 routing table for default routes
+func gateways() (gws []string) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	// Iface Destination Gateway Flags RefCnt Use Metric Mask MTU Window IRTT
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		gw, err := hex.DecodeString(fields[2])
+		if err != nil || len(gw) != net.IPv4len {
+			continue
+		}
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(gw))
+		gws = append(gws, fmt.Sprintf("%s (%s)", ip, fields[0]))
+	}
+	return
+}
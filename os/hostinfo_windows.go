@@ -0,0 +1,150 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+import (
+	// Standard
+	"fmt"
+	"net"
+	"os"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/kernel32"
+)
+
+// getHostInfo gathers Windows specific host information
+func getHostInfo() (info HostInfo) {
+	info.Domain = joinInformation()
+	info.OSVersion, info.OSBuild = windowsVersion()
+	if loc, err := kernel32.GetUserDefaultLocaleName(); err == nil {
+		info.Locale = loc
+	}
+	if key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\TimeZoneInformation`, registry.QUERY_VALUE); err == nil {
+		info.TimeZone, _, _ = key.GetStringValue("TimeZoneKeyName")
+		key.Close()
+	}
+	info.Elevation = elevation()
+	info.Gateways = gateways()
+	return
+}
+
+// joinInformation returns the Active Directory domain or workgroup the host is joined to
+func joinInformation() string {
+	var buf *uint16
+	var status uint32
+	if err := windows.NetGetJoinInformation(nil, &buf, &status); err != nil {
+		return os.Getenv("USERDOMAIN")
+	}
+	defer windows.NetApiBufferFree((*byte)(unsafe.Pointer(buf)))
+	name := windows.UTF16PtrToString(buf)
+	switch status {
+	case windows.NetSetupDomainName:
+		return name
+	case windows.NetSetupWorkgroupName:
+		return fmt.Sprintf("%s (workgroup)", name)
+	default:
+		return ""
+	}
+}
+
+// windowsVersion returns the product name and display version along with the build number and update build revision
+func windowsVersion() (version, build string) {
+	v := windows.RtlGetVersion()
+	version = fmt.Sprintf("Windows %d.%d", v.MajorVersion, v.MinorVersion)
+	build = fmt.Sprintf("%d", v.BuildNumber)
+
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows NT\CurrentVersion`, registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return
+	}
+	defer key.Close()
+	if product, _, err := key.GetStringValue("ProductName"); err == nil {
+		version = product
+		if display, _, err := key.GetStringValue("DisplayVersion"); err == nil {
+			version = fmt.Sprintf("%s %s", product, display)
+		}
+	}
+	if ubr, _, err := key.GetIntegerValue("UBR"); err == nil {
+		build = fmt.Sprintf("%d.%d", v.BuildNumber, ubr)
+	}
+	return
+}
+
+// elevation returns the UAC elevation type of the agent's process token
+func elevation() string {
+	token := windows.GetCurrentProcessToken()
+	var elevationType uint32
+	var returnLength uint32
+	err := windows.GetTokenInformation(token, windows.TokenElevationType, (*byte)(unsafe.Pointer(&elevationType)), uint32(unsafe.Sizeof(elevationType)), &returnLength)
+	if err != nil {
+		return ""
+	}
+	// https://docs.microsoft.com/en-us/windows/win32/api/winnt/ne-winnt-token_elevation_type
+	var uac string
+	switch elevationType {
+	case 1:
+		uac = "TokenElevationTypeDefault"
+	case 2:
+		uac = "TokenElevationTypeFull"
+	case 3:
+		uac = "TokenElevationTypeLimited"
+	default:
+		uac = fmt.Sprintf("TokenElevationType %d", elevationType)
+	}
+	if token.IsElevated() {
+		return fmt.Sprintf("Elevated (%s)", uac)
+	}
+	return fmt.Sprintf("Not Elevated (%s)", uac)
+}
+
+// gateways returns the default gateways configured on the host's network adapters
+func gateways() (gws []string) {
+	// GAA_FLAG_INCLUDE_GATEWAYS
+	flags := uint32(0x80)
+	size := uint32(15000)
+	for i := 0; i < 3; i++ {
+		buf := make([]byte, size)
+		adapters := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0]))
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC, flags, 0, adapters, &size)
+		if err == windows.ERROR_BUFFER_OVERFLOW {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		for adapter := adapters; adapter != nil; adapter = adapter.Next {
+			for gw := adapter.FirstGatewayAddress; gw != nil; gw = gw.Next {
+				ip := gw.Address.IP()
+				if ip == nil || ip.Equal(net.IPv4zero) || ip.Equal(net.IPv6unspecified) {
+					continue
+				}
+				gws = append(gws, fmt.Sprintf("%s (%s)", ip, windows.UTF16PtrToString(adapter.FriendlyName)))
+			}
+		}
+		return
+	}
+	return
+}
@@ -0,0 +1,60 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// terminals are the device files whose access time is updated when a user types into a terminal or console
+var terminals = []string{"/dev/pts/*", "/dev/tty[0-9]*", "/dev/ttyv*", "/dev/ttys*", "/dev/console", "/dev/input/event*"}
+
+// IdleTime returns how long it has been since the last input to any terminal or input device on the host
+func IdleTime() (time.Duration, error) {
+	var last time.Time
+	for _, pattern := range terminals {
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				continue
+			}
+			if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+				if atime := accessTime(stat); atime.After(last) {
+					last = atime
+				}
+			}
+		}
+	}
+	if last.IsZero() {
+		return 0, fmt.Errorf("there were no terminal or input devices to determine the idle time from")
+	}
+	idle := time.Since(last)
+	if idle < 0 {
+		idle = 0
+	}
+	return idle, nil
+}
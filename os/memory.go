@@ -0,0 +1,43 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package os
+
+import (
+	// Standard
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// ResidentMemory returns the agent process's peak resident set size in bytes
+// The current resident set size is not available from getrusage on these operating systems
+func ResidentMemory() (uint64, error) {
+	var usage syscall.Rusage
+	err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage)
+	if err != nil {
+		return 0, fmt.Errorf("there was an error calling getrusage: %s", err)
+	}
+	// macOS reports bytes while the BSDs report kilobytes
+	if runtime.GOOS == "darwin" {
+		return uint64(usage.Maxrss), nil
+	}
+	return uint64(usage.Maxrss) * 1024, nil
+}
@@ -32,6 +32,27 @@ import (
 
 var Advapi32 = windows.NewLazySystemDLL("Advapi32.dll")
 
+// AdjustTokenPrivileges enables or disables privileges in the specified access token. The call succeeds with
+// ERROR_NOT_ALL_ASSIGNED, which is returned as an error, when the token does not hold one of the privileges
+// https://docs.microsoft.com/en-us/windows/win32/api/securitybaseapi/nf-securitybaseapi-adjusttokenprivileges
+func AdjustTokenPrivileges(hToken windows.Token, newState *windows.Tokenprivileges) (err error) {
+	adjustTokenPrivileges := Advapi32.NewProc("AdjustTokenPrivileges")
+
+	// BOOL AdjustTokenPrivileges(
+	//  [in]            HANDLE            TokenHandle,
+	//  [in]            BOOL              DisableAllPrivileges,
+	//  [in, optional]  PTOKEN_PRIVILEGES NewState,
+	//  [in]            DWORD             BufferLength,
+	//  [out, optional] PTOKEN_PRIVILEGES PreviousState,
+	//  [out, optional] PDWORD            ReturnLength
+	//);
+	ret, _, err := adjustTokenPrivileges.Call(uintptr(hToken), 0, uintptr(unsafe.Pointer(newState)), 0, 0, 0)
+	if ret == 0 || err == windows.ERROR_NOT_ALL_ASSIGNED {
+		return fmt.Errorf("there was an error calling advapi32!AdjustTokenPrivileges: %s", err)
+	}
+	return nil
+}
+
 // CreateProcessWithLogon Creates a new process and its primary thread.
 // Then the new process runs the specified executable file in the security context of the specified credentials
 // (user, domain, and password). It can optionally load the user profile for a specified user.
@@ -134,6 +155,57 @@ func CreateProcessWithTokenW(hToken, dwLogonFlags, lpApplicationName, lpCommandL
 	return nil
 }
 
+// CREDENTIAL contains a credential from the user's Credential Manager vault
+// https://docs.microsoft.com/en-us/windows/win32/api/wincred/ns-wincred-credentialw
+type CREDENTIAL struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// CredEnumerate enumerates the credentials in the user's Credential Manager vault and returns their type, target, and
+// user name. The credential blobs are not returned
+// https://docs.microsoft.com/en-us/windows/win32/api/wincred/nf-wincred-credenumeratew
+func CredEnumerate() (credentials []CREDENTIAL, err error) {
+	credEnumerateW := Advapi32.NewProc("CredEnumerateW")
+	credFree := Advapi32.NewProc("CredFree")
+
+	// BOOL CredEnumerateW(
+	//  [in]  LPCWSTR      Filter,
+	//  [in]  DWORD        Flags,
+	//  [out] DWORD        *Count,
+	//  [out] PCREDENTIALW **Credential
+	//);
+	var count uint32
+	var list **CREDENTIAL
+	ret, _, err := credEnumerateW.Call(0, 0, uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&list)))
+	if ret == 0 {
+		// ERROR_NOT_FOUND is returned when the vault is empty
+		if err == windows.ERROR_NOT_FOUND {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("there was an error calling advapi32!CredEnumerateW: %s", err)
+	}
+	defer credFree.Call(uintptr(unsafe.Pointer(list))) // #nosec G104 the list is only read from
+	for _, credential := range unsafe.Slice(list, count) {
+		c := *credential
+		c.TargetName = windows.StringToUTF16Ptr(windows.UTF16PtrToString(c.TargetName))
+		c.UserName = windows.StringToUTF16Ptr(windows.UTF16PtrToString(c.UserName))
+		c.Comment, c.TargetAlias, c.CredentialBlob, c.CredentialBlobSize, c.Attributes = nil, nil, nil, 0, 0
+		credentials = append(credentials, c)
+	}
+	return credentials, nil
+}
+
 // ImpersonateLoggedOnUser lets the calling thread impersonate the security context of a logged-on user.
 // The user is represented by a token handle.
 // https://docs.microsoft.com/en-us/windows/win32/api/securitybaseapi/nf-securitybaseapi-impersonateloggedonuser
@@ -152,6 +224,23 @@ func ImpersonateLoggedOnUser(hToken windows.Token) (err error) {
 	return
 }
 
+// ImpersonateNamedPipeClient impersonates a named-pipe client application.
+// The server must read data from the pipe before the client can be impersonated.
+// https://docs.microsoft.com/en-us/windows/win32/api/namedpipeapi/nf-namedpipeapi-impersonatenamedpipeclient
+func ImpersonateNamedPipeClient(hNamedPipe windows.Handle) (err error) {
+	impersonateNamedPipeClient := Advapi32.NewProc("ImpersonateNamedPipeClient")
+
+	// BOOL ImpersonateNamedPipeClient(
+	//  [in] HANDLE hNamedPipe
+	//);
+	ret, _, err := impersonateNamedPipeClient.Call(uintptr(hNamedPipe))
+	if err != syscall.Errno(0) || ret == 0 {
+		err = fmt.Errorf("there was an error calling advapi32!ImpersonateNamedPipeClient with return code %d: %s", ret, err)
+		return
+	}
+	return nil
+}
+
 // LogonUser attempts to log a user on to the local computer.
 // The local computer is the computer from which LogonUser was called. You cannot use LogonUser to log on to a remote computer.
 // You specify the user with a user name and domain and authenticate the user with a plaintext password.
@@ -0,0 +1,106 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package credui
+
+import (
+	// Standard
+	"fmt"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+var Credui = windows.NewLazySystemDLL("Credui.dll")
+
+// CREDUIWIN_GENERIC returns the user name and password in plain text from the prompt
+const CREDUIWIN_GENERIC = 0x1
+
+// CREDUIWIN_CHECKBOX shows the "Remember my credentials" check box
+const CREDUIWIN_CHECKBOX = 0x2
+
+// CREDUI_INFO contains information used to customize the credential prompt
+// https://docs.microsoft.com/en-us/windows/win32/api/wincred/ns-wincred-credui_infow
+type CREDUI_INFO struct {
+	CbSize         uint32
+	HwndParent     uintptr
+	PszMessageText *uint16
+	PszCaptionText *uint16
+	HbmBanner      uintptr
+}
+
+// CredUIPromptForWindowsCredentials creates and displays a configurable dialog box that accepts credentials from the
+// user and returns the packed authentication buffer, it must be freed with CoTaskMemFree
+// https://docs.microsoft.com/en-us/windows/win32/api/wincred/nf-wincred-creduipromptforwindowscredentialsw
+func CredUIPromptForWindowsCredentials(caption, message string, flags uint32) (buf *byte, size uint32, err error) {
+	credUIPromptForWindowsCredentials := Credui.NewProc("CredUIPromptForWindowsCredentialsW")
+	info := CREDUI_INFO{CbSize: uint32(unsafe.Sizeof(CREDUI_INFO{}))}
+	if info.PszCaptionText, err = windows.UTF16PtrFromString(caption); err != nil {
+		return
+	}
+	if info.PszMessageText, err = windows.UTF16PtrFromString(message); err != nil {
+		return
+	}
+	var pkg uint32
+	var save int32
+	ret, _, _ := credUIPromptForWindowsCredentials.Call(
+		uintptr(unsafe.Pointer(&info)),
+		0,
+		uintptr(unsafe.Pointer(&pkg)),
+		0,
+		0,
+		uintptr(unsafe.Pointer(&buf)),
+		uintptr(unsafe.Pointer(&size)),
+		uintptr(unsafe.Pointer(&save)),
+		uintptr(flags),
+	)
+	if ret != 0 {
+		err = fmt.Errorf("there was an error calling CredUIPromptForWindowsCredentials: %s", windows.Errno(ret))
+	}
+	return
+}
+
+// CredUnPackAuthenticationBuffer converts an authentication buffer returned by CredUIPromptForWindowsCredentials
+// into a user name, domain, and password
+// https://docs.microsoft.com/en-us/windows/win32/api/wincred/nf-wincred-credunpackauthenticationbufferw
+func CredUnPackAuthenticationBuffer(buf *byte, size uint32) (user, domain, password string, err error) {
+	credUnPackAuthenticationBuffer := Credui.NewProc("CredUnPackAuthenticationBufferW")
+	u := make([]uint16, 514)
+	d := make([]uint16, 338)
+	p := make([]uint16, 514)
+	uLen, dLen, pLen := uint32(len(u)), uint32(len(d)), uint32(len(p))
+	ret, _, e := credUnPackAuthenticationBuffer.Call(
+		0,
+		uintptr(unsafe.Pointer(buf)),
+		uintptr(size),
+		uintptr(unsafe.Pointer(&u[0])),
+		uintptr(unsafe.Pointer(&uLen)),
+		uintptr(unsafe.Pointer(&d[0])),
+		uintptr(unsafe.Pointer(&dLen)),
+		uintptr(unsafe.Pointer(&p[0])),
+		uintptr(unsafe.Pointer(&pLen)),
+	)
+	if ret == 0 {
+		err = fmt.Errorf("there was an error calling CredUnPackAuthenticationBuffer: %s", e)
+		return
+	}
+	return windows.UTF16ToString(u), windows.UTF16ToString(d), windows.UTF16ToString(p), nil
+}
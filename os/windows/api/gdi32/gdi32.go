@@ -0,0 +1,128 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package gdi32
+
+import (
+	// Standard
+	"fmt"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+var Gdi32 = windows.NewLazySystemDLL("Gdi32.dll")
+
+const (
+	// SRCCOPY copies the source rectangle directly to the destination rectangle
+	SRCCOPY = 0x00CC0020
+	// CAPTUREBLT includes windows that are layered on top of the window in the resulting image
+	CAPTUREBLT = 0x40000000
+	// DIB_RGB_COLORS means the color table contains literal RGB values
+	DIB_RGB_COLORS = 0
+	// BI_RGB is an uncompressed bitmap format
+	BI_RGB = 0
+)
+
+// BITMAPINFOHEADER contains information about the dimensions and color format of a device-independent bitmap (DIB)
+// https://docs.microsoft.com/en-us/windows/win32/api/wingdi/ns-wingdi-bitmapinfoheader
+type BITMAPINFOHEADER struct {
+	Size          uint32
+	Width         int32
+	Height        int32
+	Planes        uint16
+	BitCount      uint16
+	Compression   uint32
+	SizeImage     uint32
+	XPelsPerMeter int32
+	YPelsPerMeter int32
+	ClrUsed       uint32
+	ClrImportant  uint32
+}
+
+// CreateCompatibleDC Creates a memory device context (DC) compatible with the specified device
+// https://docs.microsoft.com/en-us/windows/win32/api/wingdi/nf-wingdi-createcompatibledc
+func CreateCompatibleDC(hDC uintptr) (uintptr, error) {
+	createCompatibleDC := Gdi32.NewProc("CreateCompatibleDC")
+	ret, _, err := createCompatibleDC.Call(hDC)
+	if ret == 0 {
+		return 0, fmt.Errorf("there was an error calling CreateCompatibleDC: %s", err)
+	}
+	return ret, nil
+}
+
+// CreateCompatibleBitmap Creates a bitmap compatible with the device that is associated with the specified device
+// context
+// https://docs.microsoft.com/en-us/windows/win32/api/wingdi/nf-wingdi-createcompatiblebitmap
+func CreateCompatibleBitmap(hDC uintptr, width, height int32) (uintptr, error) {
+	createCompatibleBitmap := Gdi32.NewProc("CreateCompatibleBitmap")
+	ret, _, err := createCompatibleBitmap.Call(hDC, uintptr(width), uintptr(height))
+	if ret == 0 {
+		return 0, fmt.Errorf("there was an error calling CreateCompatibleBitmap: %s", err)
+	}
+	return ret, nil
+}
+
+// SelectObject Selects an object into the specified device context (DC) and returns the object being replaced
+// https://docs.microsoft.com/en-us/windows/win32/api/wingdi/nf-wingdi-selectobject
+func SelectObject(hDC, object uintptr) uintptr {
+	selectObject := Gdi32.NewProc("SelectObject")
+	ret, _, _ := selectObject.Call(hDC, object)
+	return ret
+}
+
+// BitBlt Performs a bit-block transfer of the color data corresponding to a rectangle of pixels from the specified
+// source device context into a destination device context
+// https://docs.microsoft.com/en-us/windows/win32/api/wingdi/nf-wingdi-bitblt
+func BitBlt(dst uintptr, x, y, width, height int32, src uintptr, x1, y1 int32, rop uint32) error {
+	bitBlt := Gdi32.NewProc("BitBlt")
+	ret, _, err := bitBlt.Call(dst, uintptr(x), uintptr(y), uintptr(width), uintptr(height), src, uintptr(x1), uintptr(y1), uintptr(rop))
+	if ret == 0 {
+		return fmt.Errorf("there was an error calling BitBlt: %s", err)
+	}
+	return nil
+}
+
+// GetDIBits Retrieves the bits of the specified compatible bitmap and copies them into a buffer as a DIB using the
+// specified format
+// https://docs.microsoft.com/en-us/windows/win32/api/wingdi/nf-wingdi-getdibits
+func GetDIBits(hDC, bitmap uintptr, lines uint32, bits []byte, info *BITMAPINFOHEADER) error {
+	getDIBits := Gdi32.NewProc("GetDIBits")
+	ret, _, err := getDIBits.Call(hDC, bitmap, 0, uintptr(lines), uintptr(unsafe.Pointer(&bits[0])), uintptr(unsafe.Pointer(info)), DIB_RGB_COLORS)
+	if ret == 0 {
+		return fmt.Errorf("there was an error calling GetDIBits: %s", err)
+	}
+	return nil
+}
+
+// DeleteObject Deletes a logical pen, brush, font, bitmap, region, or palette, freeing all system resources
+// https://docs.microsoft.com/en-us/windows/win32/api/wingdi/nf-wingdi-deleteobject
+func DeleteObject(object uintptr) {
+	deleteObject := Gdi32.NewProc("DeleteObject")
+	_, _, _ = deleteObject.Call(object)
+}
+
+// DeleteDC Deletes the specified device context (DC)
+// https://docs.microsoft.com/en-us/windows/win32/api/wingdi/nf-wingdi-deletedc
+func DeleteDC(hDC uintptr) {
+	deleteDC := Gdi32.NewProc("DeleteDC")
+	_, _, _ = deleteDC.Call(hDC)
+}
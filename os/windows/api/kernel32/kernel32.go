@@ -19,3 +19,196 @@
 // along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
 
 package kernel32
+
+import (
+	// Standard
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+var Kernel32 = windows.NewLazySystemDLL("kernel32.dll")
+
+// DisconnectNamedPipe Disconnects the server end of a named pipe instance from a client process.
+// https://docs.microsoft.com/en-us/windows/win32/api/namedpipeapi/nf-namedpipeapi-disconnectnamedpipe
+func DisconnectNamedPipe(hNamedPipe windows.Handle) (err error) {
+	disconnectNamedPipe := Kernel32.NewProc("DisconnectNamedPipe")
+
+	// BOOL DisconnectNamedPipe(
+	//  [in] HANDLE hNamedPipe
+	//);
+	ret, _, err := disconnectNamedPipe.Call(uintptr(hNamedPipe))
+	if err != syscall.Errno(0) || ret == 0 {
+		err = fmt.Errorf("there was an error calling kernel32!DisconnectNamedPipe with return code %d: %s", ret, err)
+		return
+	}
+	return nil
+}
+
+// Win32FindStreamData contains information about a stream found by FindFirstStreamW or FindNextStreamW
+// https://docs.microsoft.com/en-us/windows/win32/api/fileapi/ns-fileapi-win32_find_stream_data
+type Win32FindStreamData struct {
+	StreamSize int64
+	StreamName [windows.MAX_PATH + 36]uint16
+}
+
+// FindFirstStreamW Enumerates the first stream with a ::$DATA stream type in the specified file or directory.
+// https://docs.microsoft.com/en-us/windows/win32/api/fileapi/nf-fileapi-findfirststreamw
+func FindFirstStreamW(fileName string, data *Win32FindStreamData) (handle windows.Handle, err error) {
+	findFirstStreamW := Kernel32.NewProc("FindFirstStreamW")
+
+	name, err := windows.UTF16PtrFromString(fileName)
+	if err != nil {
+		return
+	}
+
+	// HANDLE FindFirstStreamW(
+	//  [in] LPCWSTR            lpFileName,
+	//  [in] STREAM_INFO_LEVELS InfoLevel,
+	//  [out] LPVOID            lpFindStreamData,
+	//       DWORD              dwFlags
+	//);
+	ret, _, err := findFirstStreamW.Call(uintptr(unsafe.Pointer(name)), 0, uintptr(unsafe.Pointer(data)), 0)
+	if windows.Handle(ret) == windows.InvalidHandle {
+		// ERROR_HANDLE_EOF is returned when there are no streams, such as for a directory
+		return windows.InvalidHandle, err
+	}
+	return windows.Handle(ret), nil
+}
+
+// FindNextStreamW Continues a stream search started by a previous call to the FindFirstStreamW function.
+// https://docs.microsoft.com/en-us/windows/win32/api/fileapi/nf-fileapi-findnextstreamw
+func FindNextStreamW(hFindStream windows.Handle, data *Win32FindStreamData) (err error) {
+	findNextStreamW := Kernel32.NewProc("FindNextStreamW")
+
+	// BOOL FindNextStreamW(
+	//  [in]  HANDLE hFindStream,
+	//  [out] LPVOID lpFindStreamData
+	//);
+	ret, _, err := findNextStreamW.Call(uintptr(hFindStream), uintptr(unsafe.Pointer(data)))
+	if ret == 0 {
+		// ERROR_HANDLE_EOF is returned when there are no more streams
+		return err
+	}
+	return nil
+}
+
+// GetUserDefaultLocaleName Retrieves the user default locale name.
+// https://docs.microsoft.com/en-us/windows/win32/api/winnls/nf-winnls-getuserdefaultlocalename
+func GetUserDefaultLocaleName() (name string, err error) {
+	getUserDefaultLocaleName := Kernel32.NewProc("GetUserDefaultLocaleName")
+
+	// LOCALE_NAME_MAX_LENGTH
+	buf := make([]uint16, 85)
+
+	// int GetUserDefaultLocaleName(
+	//  [out] LPWSTR lpLocaleName,
+	//  [in]  int    cchLocaleName
+	//);
+	ret, _, err := getUserDefaultLocaleName.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	if err != syscall.Errno(0) || ret == 0 {
+		err = fmt.Errorf("there was an error calling kernel32!GetUserDefaultLocaleName with return code %d: %s", ret, err)
+		return
+	}
+	return windows.UTF16ToString(buf), nil
+}
+
+// GetOEMCP Returns the current original equipment manufacturer (OEM) code page identifier for the operating system.
+// https://docs.microsoft.com/en-us/windows/win32/api/winnls/nf-winnls-getoemcp
+func GetOEMCP() uint32 {
+	getOEMCP := Kernel32.NewProc("GetOEMCP")
+
+	// UINT GetOEMCP();
+	ret, _, _ := getOEMCP.Call()
+	return uint32(ret)
+}
+
+// ProcessMemoryCounters contains the memory statistics for a process
+// https://docs.microsoft.com/en-us/windows/win32/api/psapi/ns-psapi-process_memory_counters
+type ProcessMemoryCounters struct {
+	CB                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+// K32GetProcessMemoryInfo Retrieves information about the memory usage of the specified process.
+// https://docs.microsoft.com/en-us/windows/win32/api/psapi/nf-psapi-getprocessmemoryinfo
+func K32GetProcessMemoryInfo(hProcess windows.Handle) (counters ProcessMemoryCounters, err error) {
+	k32GetProcessMemoryInfo := Kernel32.NewProc("K32GetProcessMemoryInfo")
+
+	counters.CB = uint32(unsafe.Sizeof(counters))
+
+	// BOOL GetProcessMemoryInfo(
+	//  [in]  HANDLE                   Process,
+	//  [out] PPROCESS_MEMORY_COUNTERS ppsmemCounters,
+	//  [in]  DWORD                    cb
+	//);
+	ret, _, err := k32GetProcessMemoryInfo.Call(uintptr(hProcess), uintptr(unsafe.Pointer(&counters)), uintptr(counters.CB))
+	if err != syscall.Errno(0) || ret == 0 {
+		err = fmt.Errorf("there was an error calling kernel32!K32GetProcessMemoryInfo with return code %d: %s", ret, err)
+		return
+	}
+	return counters, nil
+}
+
+// GetTickCount Retrieves the number of milliseconds that have elapsed since the system was started, up to 49.7 days
+// https://docs.microsoft.com/en-us/windows/win32/api/sysinfoapi/nf-sysinfoapi-gettickcount
+func GetTickCount() uint32 {
+	getTickCount := Kernel32.NewProc("GetTickCount")
+	ret, _, _ := getTickCount.Call()
+	return uint32(ret)
+}
+
+// GlobalFree Frees the specified global memory object and invalidates its handle
+// https://docs.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-globalfree
+func GlobalFree(hMem uintptr) {
+	globalFree := Kernel32.NewProc("GlobalFree")
+	_, _, _ = globalFree.Call(hMem)
+}
+
+// GlobalLock Locks a global memory object and returns a pointer to the first byte of the object's memory block
+// https://docs.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-globallock
+func GlobalLock(hMem uintptr) (addr uintptr, err error) {
+	globalLock := Kernel32.NewProc("GlobalLock")
+	addr, _, err = globalLock.Call(hMem)
+	if addr == 0 {
+		err = fmt.Errorf("there was an error calling kernel32!GlobalLock: %s", err)
+		return
+	}
+	return addr, nil
+}
+
+// GlobalUnlock Decrements the lock count associated with a memory object that was allocated with GMEM_MOVEABLE
+// https://docs.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-globalunlock
+func GlobalUnlock(hMem uintptr) {
+	globalUnlock := Kernel32.NewProc("GlobalUnlock")
+	_, _, _ = globalUnlock.Call(hMem)
+}
+
+// GlobalSize Retrieves the current size of the specified global memory object, in bytes
+// https://docs.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-globalsize
+func GlobalSize(hMem uintptr) uintptr {
+	globalSize := Kernel32.NewProc("GlobalSize")
+	size, _, _ := globalSize.Call(hMem)
+	return size
+}
+
+// RtlMoveMemory Copies the contents of a source memory block to a destination memory block
+// https://docs.microsoft.com/en-us/windows/win32/devnotes/rtlmovememory
+func RtlMoveMemory(dst []byte, src uintptr) {
+	if len(dst) == 0 {
+		return
+	}
+	rtlMoveMemory := Kernel32.NewProc("RtlMoveMemory")
+	_, _, _ = rtlMoveMemory.Call(uintptr(unsafe.Pointer(&dst[0])), src, uintptr(len(dst)))
+}
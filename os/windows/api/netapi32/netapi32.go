@@ -0,0 +1,183 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package netapi32
+
+import (
+	// Standard
+	"fmt"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+var Netapi32 = windows.NewLazySystemDLL("Netapi32.dll")
+
+// MAX_PREFERRED_LENGTH lets the function allocate as much memory as the data requires
+const MAX_PREFERRED_LENGTH = 0xFFFFFFFF
+
+// USER_MODALS_INFO_0 contains global password information for users and global groups
+// https://docs.microsoft.com/en-us/windows/win32/api/lmaccess/ns-lmaccess-user_modals_info_0
+type USER_MODALS_INFO_0 struct {
+	MinPasswdLen    uint32
+	MaxPasswdAge    uint32
+	MinPasswdAge    uint32
+	ForceLogoff     uint32
+	PasswordHistLen uint32
+}
+
+// USER_MODALS_INFO_3 contains lockout information for users and global groups
+// https://docs.microsoft.com/en-us/windows/win32/api/lmaccess/ns-lmaccess-user_modals_info_3
+type USER_MODALS_INFO_3 struct {
+	LockoutDuration          uint32
+	LockoutObservationWindow uint32
+	LockoutThreshold         uint32
+}
+
+// USER_INFO_1 contains information about a user account
+// https://docs.microsoft.com/en-us/windows/win32/api/lmaccess/ns-lmaccess-user_info_1
+type USER_INFO_1 struct {
+	Name        *uint16
+	Password    *uint16
+	PasswordAge uint32
+	Priv        uint32
+	HomeDir     *uint16
+	Comment     *uint16
+	Flags       uint32
+	ScriptPath  *uint16
+}
+
+// SHARE_INFO_1 contains information about a shared resource, including its name, type, and remark
+// https://docs.microsoft.com/en-us/windows/win32/api/lmshare/ns-lmshare-share_info_1
+type SHARE_INFO_1 struct {
+	NetName *uint16
+	Type    uint32
+	Remark  *uint16
+}
+
+// NetUserModalsGet retrieves global information for all users and global groups on the local computer
+// Level 0 is USER_MODALS_INFO_0 password information and level 3 is USER_MODALS_INFO_3 lockout information
+// https://docs.microsoft.com/en-us/windows/win32/api/lmaccess/nf-lmaccess-netusermodalsget
+func NetUserModalsGet(level uint32, info interface{}) error {
+	netUserModalsGet := Netapi32.NewProc("NetUserModalsGet")
+	var buf *byte
+	ret, _, _ := netUserModalsGet.Call(0, uintptr(level), uintptr(unsafe.Pointer(&buf)))
+	if ret != 0 {
+		return fmt.Errorf("there was an error calling NetUserModalsGet: %s", windows.Errno(ret))
+	}
+	defer NetApiBufferFree(buf)
+	switch i := info.(type) {
+	case *USER_MODALS_INFO_0:
+		*i = *(*USER_MODALS_INFO_0)(unsafe.Pointer(buf))
+	case *USER_MODALS_INFO_3:
+		*i = *(*USER_MODALS_INFO_3)(unsafe.Pointer(buf))
+	default:
+		return fmt.Errorf("unsupported NetUserModalsGet information type %T", info)
+	}
+	return nil
+}
+
+// NetUserEnum retrieves level 1 information about all user accounts on the local computer
+// https://docs.microsoft.com/en-us/windows/win32/api/lmaccess/nf-lmaccess-netuserenum
+func NetUserEnum() (users []USER_INFO_1, err error) {
+	netUserEnum := Netapi32.NewProc("NetUserEnum")
+	var resume uint32
+	for {
+		var buf *byte
+		var read, total uint32
+		// FILTER_NORMAL_ACCOUNT 0x2
+		ret, _, _ := netUserEnum.Call(0, 1, 0x2, uintptr(unsafe.Pointer(&buf)), MAX_PREFERRED_LENGTH, uintptr(unsafe.Pointer(&read)), uintptr(unsafe.Pointer(&total)), uintptr(unsafe.Pointer(&resume)))
+		// ERROR_MORE_DATA 234
+		if ret != 0 && ret != 234 {
+			return users, fmt.Errorf("there was an error calling NetUserEnum: %s", windows.Errno(ret))
+		}
+		if buf != nil {
+			entries := unsafe.Slice((*USER_INFO_1)(unsafe.Pointer(buf)), read)
+			for _, entry := range entries {
+				entry.Name = copyString(entry.Name)
+				entry.Comment = copyString(entry.Comment)
+				entry.HomeDir = copyString(entry.HomeDir)
+				entry.Password = nil
+				entry.ScriptPath = nil
+				users = append(users, entry)
+			}
+			_ = NetApiBufferFree(buf)
+		}
+		if ret == 0 {
+			return
+		}
+	}
+}
+
+// NetShareEnum retrieves level 1 information about each shared resource on a server
+// https://docs.microsoft.com/en-us/windows/win32/api/lmshare/nf-lmshare-netshareenum
+func NetShareEnum(server string) (shares []SHARE_INFO_1, err error) {
+	netShareEnum := Netapi32.NewProc("NetShareEnum")
+	name, err := windows.UTF16PtrFromString(server)
+	if err != nil {
+		return
+	}
+	var resume uint32
+	for {
+		var buf *byte
+		var read, total uint32
+		ret, _, _ := netShareEnum.Call(uintptr(unsafe.Pointer(name)), 1, uintptr(unsafe.Pointer(&buf)), MAX_PREFERRED_LENGTH, uintptr(unsafe.Pointer(&read)), uintptr(unsafe.Pointer(&total)), uintptr(unsafe.Pointer(&resume)))
+		// ERROR_MORE_DATA 234
+		if ret != 0 && ret != 234 {
+			return shares, fmt.Errorf("there was an error calling NetShareEnum: %w", windows.Errno(ret))
+		}
+		if buf != nil {
+			entries := unsafe.Slice((*SHARE_INFO_1)(unsafe.Pointer(buf)), read)
+			for _, entry := range entries {
+				entry.NetName = copyString(entry.NetName)
+				entry.Remark = copyString(entry.Remark)
+				shares = append(shares, entry)
+			}
+			_ = NetApiBufferFree(buf)
+		}
+		if ret == 0 {
+			return
+		}
+	}
+}
+
+// NetApiBufferFree frees the memory that the NetApiBufferAllocate function allocates
+// https://docs.microsoft.com/en-us/windows/win32/api/lmapibuf/nf-lmapibuf-netapibufferfree
+func NetApiBufferFree(buf *byte) error {
+	netApiBufferFree := Netapi32.NewProc("NetApiBufferFree")
+	ret, _, _ := netApiBufferFree.Call(uintptr(unsafe.Pointer(buf)))
+	if ret != 0 {
+		return fmt.Errorf("there was an error calling NetApiBufferFree: %s", windows.Errno(ret))
+	}
+	return nil
+}
+
+// copyString copies a UTF-16 string out of a buffer that is about to be freed
+func copyString(s *uint16) *uint16 {
+	if s == nil {
+		return nil
+	}
+	p, err := windows.UTF16PtrFromString(windows.UTF16PtrToString(s))
+	if err != nil {
+		return nil
+	}
+	return p
+}
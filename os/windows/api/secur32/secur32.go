@@ -0,0 +1,102 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package secur32
+
+import (
+	// Standard
+	"fmt"
+	"time"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+var Secur32 = windows.NewLazySystemDLL("Secur32.dll")
+
+// SECURITY_LOGON_SESSION_DATA contains information about a logon session. Only the members up to the user principal
+// name are declared, the structure is only read from the buffer LsaGetLogonSessionData returns
+// https://docs.microsoft.com/en-us/windows/win32/api/ntsecapi/ns-ntsecapi-security_logon_session_data
+type SECURITY_LOGON_SESSION_DATA struct {
+	Size                  uint32
+	LogonId               windows.LUID
+	UserName              windows.NTUnicodeString
+	LogonDomain           windows.NTUnicodeString
+	AuthenticationPackage windows.NTUnicodeString
+	LogonType             uint32
+	Session               uint32
+	Sid                   *windows.SID
+	LogonTime             int64
+	LogonServer           windows.NTUnicodeString
+	DnsDomainName         windows.NTUnicodeString
+	Upn                   windows.NTUnicodeString
+}
+
+// LogonSession is the information about a logon session copied out of the LSA's buffer
+type LogonSession struct {
+	UserName              string
+	LogonDomain           string
+	AuthenticationPackage string
+	LogonType             uint32
+	Session               uint32
+	LogonTime             time.Time
+	LogonServer           string
+	DnsDomainName         string
+	Upn                   string
+}
+
+// LsaGetLogonSessionData retrieves information about the logon session with the specified LUID
+// https://docs.microsoft.com/en-us/windows/win32/api/ntsecapi/nf-ntsecapi-lsagetlogonsessiondata
+func LsaGetLogonSessionData(luid windows.LUID) (session LogonSession, err error) {
+	lsaGetLogonSessionData := Secur32.NewProc("LsaGetLogonSessionData")
+	lsaFreeReturnBuffer := Secur32.NewProc("LsaFreeReturnBuffer")
+
+	// NTSTATUS LsaGetLogonSessionData(
+	//  [in]  PLUID                        LogonId,
+	//  [out] PSECURITY_LOGON_SESSION_DATA *ppLogonSessionData
+	//);
+	var data *SECURITY_LOGON_SESSION_DATA
+	ret, _, _ := lsaGetLogonSessionData.Call(uintptr(unsafe.Pointer(&luid)), uintptr(unsafe.Pointer(&data)))
+	if ret != 0 {
+		return session, fmt.Errorf("there was an error calling secur32!LsaGetLogonSessionData: %s", windows.NTStatus(ret))
+	}
+	defer lsaFreeReturnBuffer.Call(uintptr(unsafe.Pointer(data))) // #nosec G104 the buffer is only read from
+
+	session = LogonSession{
+		UserName:              data.UserName.String(),
+		LogonDomain:           data.LogonDomain.String(),
+		AuthenticationPackage: data.AuthenticationPackage.String(),
+		LogonType:             data.LogonType,
+		Session:               data.Session,
+		LogonServer:           data.LogonServer.String(),
+		DnsDomainName:         data.DnsDomainName.String(),
+	}
+	// The logon time is a FILETIME, the number of 100-nanosecond intervals since January 1, 1601
+	if data.LogonTime > 0 {
+		ft := windows.Filetime{LowDateTime: uint32(data.LogonTime), HighDateTime: uint32(data.LogonTime >> 32)}
+		session.LogonTime = time.Unix(0, ft.Nanoseconds())
+	}
+	// The UPN member was added in Windows Vista, older structures are smaller
+	if uintptr(data.Size) >= unsafe.Sizeof(*data) {
+		session.Upn = data.Upn.String()
+	}
+	return session, nil
+}
@@ -24,6 +24,7 @@ import (
 	// Standard
 	"fmt"
 	"syscall"
+	"unsafe"
 
 	// X Packages
 	"golang.org/x/sys/windows"
@@ -60,3 +61,129 @@ func GetThreadDesktop(threadID uint32) (hDesktop uintptr, err error) {
 	}
 	return
 }
+
+// LastInputInfo contains the time of the last input
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/ns-winuser-lastinputinfo
+type LastInputInfo struct {
+	CbSize uint32
+	DwTime uint32
+}
+
+// GetLastInputInfo Retrieves the tick count, in milliseconds, of the last input event in the current session
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/nf-winuser-getlastinputinfo
+func GetLastInputInfo() (tick uint32, err error) {
+	GetLastInputInfo := User32.NewProc("GetLastInputInfo")
+
+	info := LastInputInfo{CbSize: uint32(unsafe.Sizeof(LastInputInfo{}))}
+	ret, _, err := GetLastInputInfo.Call(uintptr(unsafe.Pointer(&info)))
+	if ret == 0 {
+		err = fmt.Errorf("there was an error calling GetLastInputInfo: %s", err)
+		return
+	}
+	return info.DwTime, nil
+}
+
+// CF_UNICODETEXT is the clipboard format for Unicode text
+// https://docs.microsoft.com/en-us/windows/win32/dataxchg/standard-clipboard-formats
+const CF_UNICODETEXT = 13
+
+// GetForegroundWindow Retrieves a handle to the window with which the user is currently working
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/nf-winuser-getforegroundwindow
+func GetForegroundWindow() (hWnd uintptr) {
+	getForegroundWindow := User32.NewProc("GetForegroundWindow")
+	hWnd, _, _ = getForegroundWindow.Call()
+	return
+}
+
+// GetWindowText Copies the text of the specified window's title bar
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/nf-winuser-getwindowtextw
+func GetWindowText(hWnd uintptr) string {
+	getWindowText := User32.NewProc("GetWindowTextW")
+	buf := make([]uint16, 512)
+	n, _, _ := getWindowText.Call(hWnd, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	return windows.UTF16ToString(buf[:n])
+}
+
+// GetWindowThreadProcessId Retrieves the identifier of the process that created the specified window
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/nf-winuser-getwindowthreadprocessid
+func GetWindowThreadProcessId(hWnd uintptr) (pid uint32) {
+	getWindowThreadProcessId := User32.NewProc("GetWindowThreadProcessId")
+	_, _, _ = getWindowThreadProcessId.Call(hWnd, uintptr(unsafe.Pointer(&pid)))
+	return
+}
+
+// GetClipboardSequenceNumber Retrieves the clipboard sequence number for the current window station, it changes
+// every time the contents of the clipboard change
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/nf-winuser-getclipboardsequencenumber
+func GetClipboardSequenceNumber() uint32 {
+	getClipboardSequenceNumber := User32.NewProc("GetClipboardSequenceNumber")
+	ret, _, _ := getClipboardSequenceNumber.Call()
+	return uint32(ret)
+}
+
+// OpenClipboard Opens the clipboard for examination and prevents other applications from modifying the content
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/nf-winuser-openclipboard
+func OpenClipboard(hWnd uintptr) error {
+	openClipboard := User32.NewProc("OpenClipboard")
+	ret, _, err := openClipboard.Call(hWnd)
+	if ret == 0 {
+		return fmt.Errorf("there was an error calling OpenClipboard: %s", err)
+	}
+	return nil
+}
+
+// CloseClipboard Closes the clipboard
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/nf-winuser-closeclipboard
+func CloseClipboard() {
+	closeClipboard := User32.NewProc("CloseClipboard")
+	_, _, _ = closeClipboard.Call()
+}
+
+// GetClipboardData Retrieves a handle to the clipboard data in the specified format, the clipboard must be open
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/nf-winuser-getclipboarddata
+func GetClipboardData(format uint32) (hMem uintptr, err error) {
+	getClipboardData := User32.NewProc("GetClipboardData")
+	hMem, _, err = getClipboardData.Call(uintptr(format))
+	if hMem == 0 {
+		err = fmt.Errorf("there was an error calling GetClipboardData: %s", err)
+		return
+	}
+	return hMem, nil
+}
+
+// System metrics for the bounding rectangle of all display monitors
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/nf-winuser-getsystemmetrics
+const (
+	SM_XVIRTUALSCREEN  = 76
+	SM_YVIRTUALSCREEN  = 77
+	SM_CXVIRTUALSCREEN = 78
+	SM_CYVIRTUALSCREEN = 79
+)
+
+// GetSystemMetrics Retrieves the specified system metric or system configuration setting
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/nf-winuser-getsystemmetrics
+func GetSystemMetrics(index int) int32 {
+	getSystemMetrics := User32.NewProc("GetSystemMetrics")
+	ret, _, _ := getSystemMetrics.Call(uintptr(index))
+	return int32(ret)
+}
+
+// GetDC Retrieves a handle to a device context (DC) for the client area of a window, or the entire screen when hWnd
+// is 0
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/nf-winuser-getdc
+func GetDC(hWnd uintptr) (hDC uintptr, err error) {
+	getDC := User32.NewProc("GetDC")
+	hDC, _, err = getDC.Call(hWnd)
+	if hDC == 0 {
+		err = fmt.Errorf("there was an error calling GetDC: %s", err)
+		return
+	}
+	return hDC, nil
+}
+
+// ReleaseDC Releases a device context (DC) retrieved with GetDC
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/nf-winuser-releasedc
+func ReleaseDC(hWnd, hDC uintptr) {
+	releaseDC := User32.NewProc("ReleaseDC")
+	_, _, _ = releaseDC.Call(hWnd, hDC)
+}
@@ -0,0 +1,154 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package wevtapi
+
+import (
+	// Standard
+	"fmt"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+var Wevtapi = windows.NewLazySystemDLL("Wevtapi.dll")
+
+const (
+	// EvtQueryChannelPath specifies that the path is the name of a channel
+	EvtQueryChannelPath = 0x1
+	// EvtQueryFilePath specifies that the path is the full path to a log file
+	EvtQueryFilePath = 0x2
+	// EvtQueryReverseDirection returns the newest events first
+	EvtQueryReverseDirection = 0x200
+	// EvtRenderEventXml renders the event as an XML string
+	EvtRenderEventXml = 1
+)
+
+// EvtQuery runs a query to retrieve events from a channel or log file that match the XPath query
+// https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtquery
+func EvtQuery(path, query string, flags uint32) (windows.Handle, error) {
+	evtQuery := Wevtapi.NewProc("EvtQuery")
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	q, err := windows.UTF16PtrFromString(query)
+	if err != nil {
+		return 0, err
+	}
+	ret, _, err := evtQuery.Call(0, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(q)), uintptr(flags))
+	if ret == 0 {
+		return 0, fmt.Errorf("there was an error calling EvtQuery: %s", err)
+	}
+	return windows.Handle(ret), nil
+}
+
+// EvtNext gets the next events from the query results, an empty slice means there are no more events
+// https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtnext
+func EvtNext(results windows.Handle, count uint32) ([]windows.Handle, error) {
+	evtNext := Wevtapi.NewProc("EvtNext")
+	events := make([]windows.Handle, count)
+	var returned uint32
+	ret, _, err := evtNext.Call(uintptr(results), uintptr(count), uintptr(unsafe.Pointer(&events[0])), windows.INFINITE, 0, uintptr(unsafe.Pointer(&returned)))
+	if ret == 0 {
+		if err == windows.ERROR_NO_MORE_ITEMS {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("there was an error calling EvtNext: %s", err)
+	}
+	return events[:returned], nil
+}
+
+// EvtRender renders the event as an XML string
+// https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtrender
+func EvtRender(event windows.Handle) (string, error) {
+	evtRender := Wevtapi.NewProc("EvtRender")
+	var used, count uint32
+	// The first call gets the size of the buffer
+	ret, _, err := evtRender.Call(0, uintptr(event), EvtRenderEventXml, 0, 0, uintptr(unsafe.Pointer(&used)), uintptr(unsafe.Pointer(&count)))
+	if ret == 0 && err != windows.ERROR_INSUFFICIENT_BUFFER {
+		return "", fmt.Errorf("there was an error calling EvtRender: %s", err)
+	}
+	buf := make([]uint16, used/2+1)
+	ret, _, err = evtRender.Call(0, uintptr(event), EvtRenderEventXml, uintptr(len(buf)*2), uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&used)), uintptr(unsafe.Pointer(&count)))
+	if ret == 0 {
+		return "", fmt.Errorf("there was an error calling EvtRender: %s", err)
+	}
+	return windows.UTF16ToString(buf), nil
+}
+
+// EvtClose closes an open event log handle
+// https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtclose
+func EvtClose(handle windows.Handle) {
+	evtClose := Wevtapi.NewProc("EvtClose")
+	_, _, _ = evtClose.Call(uintptr(handle))
+}
+
+// EvtClearLog removes all events from a channel and optionally saves them to a log file first
+// https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtclearlog
+func EvtClearLog(channel, backup string) error {
+	evtClearLog := Wevtapi.NewProc("EvtClearLog")
+	c, err := windows.UTF16PtrFromString(channel)
+	if err != nil {
+		return err
+	}
+	var target uintptr
+	if backup != "" {
+		b, err := windows.UTF16PtrFromString(backup)
+		if err != nil {
+			return err
+		}
+		target = uintptr(unsafe.Pointer(b))
+	}
+	ret, _, err := evtClearLog.Call(0, uintptr(unsafe.Pointer(c)), target, 0)
+	if ret == 0 {
+		return fmt.Errorf("there was an error calling EvtClearLog: %s", err)
+	}
+	return nil
+}
+
+// EvtChannels returns the names of the registered channels
+// https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtnextchannelpath
+func EvtChannels() (channels []string, err error) {
+	evtOpenChannelEnum := Wevtapi.NewProc("EvtOpenChannelEnum")
+	evtNextChannelPath := Wevtapi.NewProc("EvtNextChannelPath")
+	enum, _, err := evtOpenChannelEnum.Call(0, 0)
+	if enum == 0 {
+		return nil, fmt.Errorf("there was an error calling EvtOpenChannelEnum: %s", err)
+	}
+	defer EvtClose(windows.Handle(enum))
+	buf := make([]uint16, 512)
+	for {
+		var used uint32
+		ret, _, err := evtNextChannelPath.Call(enum, uintptr(len(buf)), uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&used)))
+		if ret == 0 {
+			if err == windows.ERROR_NO_MORE_ITEMS {
+				return channels, nil
+			}
+			if err == windows.ERROR_INSUFFICIENT_BUFFER {
+				buf = make([]uint16, used)
+				continue
+			}
+			return channels, fmt.Errorf("there was an error calling EvtNextChannelPath: %s", err)
+		}
+		channels = append(channels, windows.UTF16ToString(buf))
+	}
+}
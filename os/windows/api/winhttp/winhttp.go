@@ -0,0 +1,173 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package winhttp
+
+import (
+	// Standard
+	"fmt"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/kernel32"
+)
+
+var Winhttp = windows.NewLazySystemDLL("Winhttp.dll")
+
+// WinHTTP access types
+// https://docs.microsoft.com/en-us/windows/win32/api/winhttp/ns-winhttp-winhttp_proxy_info
+const (
+	WINHTTP_ACCESS_TYPE_NO_PROXY    = 1
+	WINHTTP_ACCESS_TYPE_NAMED_PROXY = 3
+)
+
+// WINHTTP_AUTOPROXY_OPTIONS flags
+// https://docs.microsoft.com/en-us/windows/win32/api/winhttp/ns-winhttp-winhttp_autoproxy_options
+const (
+	WINHTTP_AUTOPROXY_AUTO_DETECT  = 0x1
+	WINHTTP_AUTOPROXY_CONFIG_URL   = 0x2
+	WINHTTP_AUTO_DETECT_TYPE_DHCP  = 0x1
+	WINHTTP_AUTO_DETECT_TYPE_DNS_A = 0x2
+)
+
+// WINHTTP_CURRENT_USER_IE_PROXY_CONFIG contains the Internet Explorer proxy configuration for the current user
+// https://docs.microsoft.com/en-us/windows/win32/api/winhttp/ns-winhttp-winhttp_current_user_ie_proxy_config
+type WINHTTP_CURRENT_USER_IE_PROXY_CONFIG struct {
+	FAutoDetect       int32
+	LpszAutoConfigUrl *uint16
+	LpszProxy         *uint16
+	LpszProxyBypass   *uint16
+}
+
+// WINHTTP_PROXY_INFO contains the proxy server and bypass list
+// https://docs.microsoft.com/en-us/windows/win32/api/winhttp/ns-winhttp-winhttp_proxy_info
+type WINHTTP_PROXY_INFO struct {
+	DwAccessType    uint32
+	LpszProxy       *uint16
+	LpszProxyBypass *uint16
+}
+
+// WINHTTP_AUTOPROXY_OPTIONS is used to find a proxy with WinHttpGetProxyForUrl
+// https://docs.microsoft.com/en-us/windows/win32/api/winhttp/ns-winhttp-winhttp_autoproxy_options
+type WINHTTP_AUTOPROXY_OPTIONS struct {
+	DwFlags                uint32
+	DwAutoDetectFlags      uint32
+	LpszAutoConfigUrl      *uint16
+	LpvReserved            uintptr
+	DwReserved             uint32
+	FAutoLogonIfChallenged int32
+}
+
+// IEProxyConfig is the current user's Internet Explorer, or WinINET, proxy configuration
+type IEProxyConfig struct {
+	AutoDetect    bool
+	AutoConfigURL string
+	Proxy         string
+	Bypass        string
+}
+
+// ProxyInfo is a proxy server and bypass list returned by WinHTTP
+type ProxyInfo struct {
+	AccessType uint32
+	Proxy      string
+	Bypass     string
+}
+
+// take converts a string allocated by WinHTTP and frees it
+func take(s *uint16) string {
+	if s == nil {
+		return ""
+	}
+	defer kernel32.GlobalFree(uintptr(unsafe.Pointer(s)))
+	return windows.UTF16PtrToString(s)
+}
+
+// WinHttpGetIEProxyConfigForCurrentUser retrieves the Internet Explorer proxy configuration for the current user
+// https://docs.microsoft.com/en-us/windows/win32/api/winhttp/nf-winhttp-winhttpgetieproxyconfigforcurrentuser
+func WinHttpGetIEProxyConfigForCurrentUser() (config IEProxyConfig, err error) {
+	winHttpGetIEProxyConfigForCurrentUser := Winhttp.NewProc("WinHttpGetIEProxyConfigForCurrentUser")
+	var c WINHTTP_CURRENT_USER_IE_PROXY_CONFIG
+	ret, _, e := winHttpGetIEProxyConfigForCurrentUser.Call(uintptr(unsafe.Pointer(&c)))
+	if ret == 0 {
+		err = fmt.Errorf("there was an error calling WinHttpGetIEProxyConfigForCurrentUser: %s", e)
+		return
+	}
+	config.AutoDetect = c.FAutoDetect != 0
+	config.AutoConfigURL = take(c.LpszAutoConfigUrl)
+	config.Proxy = take(c.LpszProxy)
+	config.Bypass = take(c.LpszProxyBypass)
+	return
+}
+
+// WinHttpGetDefaultProxyConfiguration retrieves the WinHTTP proxy configuration set with netsh winhttp
+// https://docs.microsoft.com/en-us/windows/win32/api/winhttp/nf-winhttp-winhttpgetdefaultproxyconfiguration
+func WinHttpGetDefaultProxyConfiguration() (info ProxyInfo, err error) {
+	winHttpGetDefaultProxyConfiguration := Winhttp.NewProc("WinHttpGetDefaultProxyConfiguration")
+	var i WINHTTP_PROXY_INFO
+	ret, _, e := winHttpGetDefaultProxyConfiguration.Call(uintptr(unsafe.Pointer(&i)))
+	if ret == 0 {
+		err = fmt.Errorf("there was an error calling WinHttpGetDefaultProxyConfiguration: %s", e)
+		return
+	}
+	return ProxyInfo{AccessType: i.DwAccessType, Proxy: take(i.LpszProxy), Bypass: take(i.LpszProxyBypass)}, nil
+}
+
+// WinHttpGetProxyForUrl evaluates the proxy auto-config script, discovered with WPAD when autoDetect is true or
+// downloaded from configURL, to find the proxy for the target URL
+// https://docs.microsoft.com/en-us/windows/win32/api/winhttp/nf-winhttp-winhttpgetproxyforurl
+func WinHttpGetProxyForUrl(target string, autoDetect bool, configURL string) (info ProxyInfo, err error) {
+	winHttpOpen := Winhttp.NewProc("WinHttpOpen")
+	winHttpGetProxyForUrl := Winhttp.NewProc("WinHttpGetProxyForUrl")
+	winHttpCloseHandle := Winhttp.NewProc("WinHttpCloseHandle")
+
+	session, _, e := winHttpOpen.Call(0, WINHTTP_ACCESS_TYPE_NO_PROXY, 0, 0, 0)
+	if session == 0 {
+		err = fmt.Errorf("there was an error calling WinHttpOpen: %s", e)
+		return
+	}
+	defer func() { _, _, _ = winHttpCloseHandle.Call(session) }()
+
+	var options WINHTTP_AUTOPROXY_OPTIONS
+	options.FAutoLogonIfChallenged = 1
+	if autoDetect {
+		options.DwFlags |= WINHTTP_AUTOPROXY_AUTO_DETECT
+		options.DwAutoDetectFlags = WINHTTP_AUTO_DETECT_TYPE_DHCP | WINHTTP_AUTO_DETECT_TYPE_DNS_A
+	}
+	if configURL != "" {
+		options.DwFlags |= WINHTTP_AUTOPROXY_CONFIG_URL
+		if options.LpszAutoConfigUrl, err = windows.UTF16PtrFromString(configURL); err != nil {
+			return
+		}
+	}
+	targetPtr, err := windows.UTF16PtrFromString(target)
+	if err != nil {
+		return
+	}
+	var i WINHTTP_PROXY_INFO
+	ret, _, e := winHttpGetProxyForUrl.Call(session, uintptr(unsafe.Pointer(targetPtr)), uintptr(unsafe.Pointer(&options)), uintptr(unsafe.Pointer(&i)))
+	if ret == 0 {
+		err = fmt.Errorf("there was an error calling WinHttpGetProxyForUrl: %s", e)
+		return
+	}
+	return ProxyInfo{AccessType: i.DwAccessType, Proxy: take(i.LpszProxy), Bypass: take(i.LpszProxyBypass)}, nil
+}
@@ -0,0 +1,172 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package wtsapi32
+
+import (
+	// Standard
+	"fmt"
+	"net"
+	"unsafe"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+)
+
+var Wtsapi32 = windows.NewLazySystemDLL("Wtsapi32.dll")
+
+// WTS_INFO_CLASS values used with WTSQuerySessionInformation
+// https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/ne-wtsapi32-wts_info_class
+const (
+	WTSUserName       = 5
+	WTSWinStationName = 6
+	WTSDomainName     = 7
+	WTSClientName     = 10
+	WTSClientAddress  = 14
+)
+
+// AF_INET is the WTS_CLIENT_ADDRESS family for an IPv4 address
+const AF_INET = 2
+
+// WTS_CLIENT_ADDRESS contains the client network address of a Remote Desktop Services session
+// https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/ns-wtsapi32-wts_client_address
+type WTS_CLIENT_ADDRESS struct {
+	AddressFamily uint32
+	Address       [20]byte
+}
+
+// Session is a Remote Desktop Services session on the local server and its user
+type Session struct {
+	ID      uint32
+	Station string
+	State   uint32
+	User    string
+	Domain  string
+	Client  string
+	Address string
+}
+
+// Sessions enumerates the sessions on the local server and queries each one's user and client
+// https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/nf-wtsapi32-wtsenumeratesessionsw
+func Sessions() (sessions []Session, err error) {
+	var info *windows.WTS_SESSION_INFO
+	var count uint32
+	if err = windows.WTSEnumerateSessions(0, 0, 1, &info, &count); err != nil {
+		return nil, fmt.Errorf("there was an error calling WTSEnumerateSessions: %s", err)
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(info)))
+	for _, s := range unsafe.Slice(info, count) {
+		session := Session{
+			ID:      s.SessionID,
+			Station: windows.UTF16PtrToString(s.WindowStationName),
+			State:   s.State,
+		}
+		session.User, _ = WTSQuerySessionString(s.SessionID, WTSUserName)
+		session.Domain, _ = WTSQuerySessionString(s.SessionID, WTSDomainName)
+		session.Client, _ = WTSQuerySessionString(s.SessionID, WTSClientName)
+		if buf, e := WTSQuerySessionInformation(s.SessionID, WTSClientAddress); e == nil && len(buf) >= int(unsafe.Sizeof(WTS_CLIENT_ADDRESS{})) {
+			address := (*WTS_CLIENT_ADDRESS)(unsafe.Pointer(&buf[0]))
+			if address.AddressFamily == AF_INET {
+				session.Address = net.IP(address.Address[2:6]).String()
+			}
+		}
+		sessions = append(sessions, session)
+	}
+	return
+}
+
+// WTSQuerySessionInformation retrieves session information for the specified session on the local server
+// https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/nf-wtsapi32-wtsquerysessioninformationw
+func WTSQuerySessionInformation(session uint32, class uint32) ([]byte, error) {
+	wtsQuerySessionInformation := Wtsapi32.NewProc("WTSQuerySessionInformationW")
+	var buf *byte
+	var size uint32
+	ret, _, err := wtsQuerySessionInformation.Call(0, uintptr(session), uintptr(class), uintptr(unsafe.Pointer(&buf)), uintptr(unsafe.Pointer(&size)))
+	if ret == 0 {
+		return nil, fmt.Errorf("there was an error calling WTSQuerySessionInformation: %s", err)
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(buf)))
+	return append([]byte(nil), unsafe.Slice(buf, size)...), nil
+}
+
+// WTSQuerySessionString retrieves a string session information class such as WTSUserName
+func WTSQuerySessionString(session uint32, class uint32) (string, error) {
+	buf, err := WTSQuerySessionInformation(session, class)
+	if err != nil || len(buf) < 2 {
+		return "", err
+	}
+	return windows.UTF16ToString(unsafe.Slice((*uint16)(unsafe.Pointer(&buf[0])), len(buf)/2)), nil
+}
+
+// State returns the name of a WTS_CONNECTSTATE_CLASS value
+// https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/ne-wtsapi32-wts_connectstate_class
+func State(state uint32) string {
+	switch state {
+	case windows.WTSActive:
+		return "active"
+	case windows.WTSConnected:
+		return "connected"
+	case windows.WTSConnectQuery:
+		return "connect query"
+	case windows.WTSShadow:
+		return "shadow"
+	case windows.WTSDisconnected:
+		return "disconnected"
+	case windows.WTSIdle:
+		return "idle"
+	case windows.WTSListen:
+		return "listen"
+	case windows.WTSReset:
+		return "reset"
+	case windows.WTSDown:
+		return "down"
+	case windows.WTSInit:
+		return "init"
+	default:
+		return fmt.Sprintf("unknown (%d)", state)
+	}
+}
+
+// WTSConnectSession connects a Remote Desktop Services session to an existing session on the local computer. The
+// password is not required when the caller is running as SYSTEM
+// https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/nf-wtsapi32-wtsconnectsessionw
+func WTSConnectSession(session, target uint32, password string) error {
+	wtsConnectSession := Wtsapi32.NewProc("WTSConnectSessionW")
+	p, err := windows.UTF16PtrFromString(password)
+	if err != nil {
+		return err
+	}
+	ret, _, err := wtsConnectSession.Call(uintptr(session), uintptr(target), uintptr(unsafe.Pointer(p)), 1)
+	if ret == 0 {
+		return fmt.Errorf("there was an error calling WTSConnectSession: %s", err)
+	}
+	return nil
+}
+
+// WTSDisconnectSession disconnects the logged-on user from the specified session without closing the session
+// https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/nf-wtsapi32-wtsdisconnectsession
+func WTSDisconnectSession(session uint32) error {
+	wtsDisconnectSession := Wtsapi32.NewProc("WTSDisconnectSession")
+	ret, _, err := wtsDisconnectSession.Call(0, uintptr(session), 1)
+	if ret == 0 {
+		return fmt.Errorf("there was an error calling WTSDisconnectSession: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+//go:build windows && (!amd64 || purego || gccgo)
+// +build windows
+// +build !amd64 purego gccgo
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package evasion
+
+// BananaPhone's direct syscalls are assembly stubs only implemented for 64-bit x86 and the gc toolchain, so 32-bit x86
+// and ARM64 agents, gccgo builds, and builds with the purego tag read and write through the Windows API instead.
+// The agent works the same but the calls pass through any user-mode hooks on the Windows API
+
+// DirectSyscalls is false because ReadBanana and WriteBanana fall back to the Windows API in this build
+const DirectSyscalls = false
+
+// ReadBanana reads the start of the target procedure with ReadProcessMemory because direct syscalls are not
+// available in this build
+func ReadBanana(module string, proc string, byteLength int) ([]byte, error) {
+	return Read(module, proc, byteLength)
+}
+
+// WriteBanana overwrites the start of the target procedure with VirtualProtect and WriteProcessMemory because direct
+// syscalls are not available in this build
+func WriteBanana(module string, proc string, data *[]byte) error {
+	return Write(module, proc, data)
+}
@@ -23,6 +23,9 @@ package pipes
 import (
 	// Standard
 	"fmt"
+	"strings"
+	"time"
+	"unsafe"
 
 	// X Packages
 	"golang.org/x/sys/windows"
@@ -206,3 +209,106 @@ func ReadPipes(stdInRead, stdOutRead, stdErrRead windows.Handle) (stdin, stdout,
 	err = nil
 	return
 }
+
+// CreateNamedPipe creates a single instance, overlapped, duplex named pipe secured with the provided SDDL string.
+// The name can be provided with or without the \\.\pipe\ prefix.
+func CreateNamedPipe(name, sddl string) (handle windows.Handle, err error) {
+	if !strings.HasPrefix(strings.ToLower(name), `\\.\pipe\`) {
+		name = `\\.\pipe\` + name
+	}
+	pipeName, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		err = fmt.Errorf("there was an error converting the pipe name %s to LPCWSTR: %s", name, err)
+		return
+	}
+
+	// Pipe Security Attributes
+	sa := &windows.SecurityAttributes{}
+	sa.Length = uint32(unsafe.Sizeof(*sa))
+	if sddl != "" {
+		sa.SecurityDescriptor, err = windows.SecurityDescriptorFromString(sddl)
+		if err != nil {
+			err = fmt.Errorf("there was an error parsing the SDDL string %s: %s", sddl, err)
+			return
+		}
+	}
+
+	handle, err = windows.CreateNamedPipe(
+		pipeName,
+		windows.PIPE_ACCESS_DUPLEX|windows.FILE_FLAG_OVERLAPPED,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT,
+		1,
+		4096,
+		4096,
+		0,
+		sa,
+	)
+	if err != nil {
+		err = fmt.Errorf("there was an error calling kernel32!CreateNamedPipeW for %s: %s", name, err)
+	}
+	return
+}
+
+// WaitForClient waits up to the provided timeout for a client to connect to the overlapped named pipe and write data.
+// Data must be read from the pipe before the client can be impersonated. A timeout of zero waits indefinitely.
+func WaitForClient(pipe windows.Handle, timeout time.Duration) (err error) {
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return fmt.Errorf("there was an error calling kernel32!CreateEvent: %s", err)
+	}
+	defer windows.CloseHandle(event)
+
+	wait := uint32(windows.INFINITE)
+	if timeout > 0 {
+		wait = uint32(timeout.Milliseconds())
+	}
+
+	overlapped := windows.Overlapped{HEvent: event}
+	err = windows.ConnectNamedPipe(pipe, &overlapped)
+	switch err {
+	case nil, windows.ERROR_PIPE_CONNECTED:
+	case windows.ERROR_IO_PENDING:
+		err = waitOverlapped(pipe, &overlapped, wait)
+		if err != nil {
+			return fmt.Errorf("there was an error waiting for a client to connect to the named pipe: %s", err)
+		}
+	default:
+		return fmt.Errorf("there was an error calling kernel32!ConnectNamedPipe: %s", err)
+	}
+
+	var done uint32
+	buf := make([]byte, 1)
+	overlapped = windows.Overlapped{HEvent: event}
+	err = windows.ReadFile(pipe, buf, &done, &overlapped)
+	switch err {
+	case nil, windows.ERROR_MORE_DATA:
+	case windows.ERROR_IO_PENDING:
+		err = waitOverlapped(pipe, &overlapped, wait)
+		if err != nil && err != windows.ERROR_MORE_DATA {
+			return fmt.Errorf("there was an error waiting for the named pipe client to send data: %s", err)
+		}
+	default:
+		return fmt.Errorf("there was an error reading from the named pipe: %s", err)
+	}
+	return nil
+}
+
+// waitOverlapped waits for a pending overlapped operation to complete and cancels it if the wait times out
+func waitOverlapped(handle windows.Handle, overlapped *windows.Overlapped, wait uint32) error {
+	event, err := windows.WaitForSingleObject(overlapped.HEvent, wait)
+	if err != nil {
+		return err
+	}
+	var done uint32
+	if event != windows.WAIT_OBJECT_0 {
+		errCancel := windows.CancelIoEx(handle, overlapped)
+		// The kernel can still write to the overlapped structure, buffer, and event until the canceled operation
+		// completes, so wait for it before they are released. ERROR_NOT_FOUND means it already completed
+		_ = windows.GetOverlappedResult(handle, overlapped, &done, true)
+		if errCancel != nil && errCancel != windows.ERROR_NOT_FOUND {
+			return fmt.Errorf("the operation timed out and could not be canceled: %s", errCancel)
+		}
+		return fmt.Errorf("the operation timed out")
+	}
+	return windows.GetOverlappedResult(handle, overlapped, &done, false)
+}
@@ -31,6 +31,7 @@ import (
 	"golang.org/x/sys/windows"
 
 	// Internal
+	"github.com/Ne0nd0g/merlin-agent/crypto/secure"
 	"github.com/Ne0nd0g/merlin-agent/os/windows/api/advapi32"
 	"github.com/Ne0nd0g/merlin-agent/os/windows/pkg/pipes"
 )
@@ -95,11 +96,13 @@ func CreateProcessWithLogon(username string, domain string, password string, app
 	}
 
 	// Convert the password to a LPCWSTR
-	lpPassword, err := syscall.UTF16PtrFromString(password)
+	password16, err := syscall.UTF16FromString(password)
 	if err != nil {
 		stderr = fmt.Sprintf("there was an error converting the password \"%s\" to LPCWSTR: %s", password, err)
 		return
 	}
+	defer secure.ZeroUint16(password16)
+	lpPassword := &password16[0]
 
 	// Search PATH environment variable to retrieve the application's absolute path
 	application, err = exec.LookPath(application)
@@ -0,0 +1,82 @@
+//go:build windows
+// +build windows
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package tokens
+
+import (
+	// Standard
+	"fmt"
+	"strings"
+
+	// X Packages
+	"golang.org/x/sys/windows"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/os/windows/api/advapi32"
+)
+
+// PrivilegeName returns the full name of a privilege given with or without the Se prefix and Privilege suffix
+// (e.g., debug or SeDebug returns SeDebugPrivilege)
+func PrivilegeName(name string) string {
+	lower := strings.ToLower(name)
+	if !strings.HasPrefix(lower, "se") || len(name) < 3 || name[2] < 'A' || name[2] > 'Z' {
+		name = "Se" + strings.ToUpper(name[:1]) + name[1:]
+	}
+	if !strings.HasSuffix(lower, "privilege") {
+		name += "Privilege"
+	}
+	return name
+}
+
+// PrivilegeState returns the attributes of the privilege in the token and false if the token doesn't hold it
+func PrivilegeState(token windows.Token, name string) (attributes uint32, held bool, err error) {
+	var luid windows.LUID
+	if err = windows.LookupPrivilegeValue(nil, windows.StringToUTF16Ptr(name), &luid); err != nil {
+		return 0, false, fmt.Errorf("%s is not a privilege: %s", name, err)
+	}
+	privs, err := GetTokenPrivileges(token)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, priv := range privs {
+		if priv.Luid == luid {
+			return priv.Attributes, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// AdjustPrivilege enables or disables a privilege the token holds. A privilege can only be enabled if it is in the
+// token, so this fails with ERROR_NOT_ALL_ASSIGNED for a privilege the token doesn't hold
+func AdjustPrivilege(token windows.Token, name string, enable bool) error {
+	var luid windows.LUID
+	if err := windows.LookupPrivilegeValue(nil, windows.StringToUTF16Ptr(name), &luid); err != nil {
+		return fmt.Errorf("%s is not a privilege: %s", name, err)
+	}
+	privileges := windows.Tokenprivileges{PrivilegeCount: 1}
+	privileges.Privileges[0].Luid = luid
+	if enable {
+		privileges.Privileges[0].Attributes = windows.SE_PRIVILEGE_ENABLED
+	}
+	if err := advapi32.AdjustTokenPrivileges(token, &privileges); err != nil {
+		return fmt.Errorf("there was an error adjusting %s: %s", name, err)
+	}
+	return nil
+}
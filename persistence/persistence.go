@@ -0,0 +1,169 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package persistence
+
+import (
+	// Standard
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Method is a persistence technique that runs a command when the host starts or a user logs in
+type Method interface {
+	// Description explains where the method persists and when the command runs
+	Description() string
+	// Privileged is true if the method requires root
+	Privileged() bool
+	// Install persists the command using the name, such as a file or label name, and returns what was changed
+	Install(name, command string) (Record, error)
+	// Remove reverts the changes made when the record was installed
+	Remove(record Record) error
+}
+
+// availability is implemented by methods that depend on something the host may not have, such as systemd
+type availability interface {
+	Available() bool
+}
+
+// Record tracks an installed persistence method so that it can be removed
+type Record struct {
+	ID        string    // ID is the unique identifier used to remove the persistence
+	Method    string    // Method is the name of the persistence method that was installed
+	Name      string    // Name is the file or label name the method used
+	Command   string    // Command is what the persistence runs
+	Artifact  string    // Artifact is what was changed on the host, such as a file path or crontab line, to remove it
+	Installed time.Time // Installed is when the persistence was installed
+}
+
+// methods are the persistence methods available on this operating system, keyed by name
+var methods = make(map[string]Method)
+
+// records are the installed persistence methods, keyed by record ID
+var records = make(map[string]Record)
+
+// mu protects the records map
+var mu sync.Mutex
+
+// register adds a persistence method, it is called from each operating system's init function
+func register(name string, method Method) {
+	methods[name] = method
+}
+
+// Methods returns the names of the persistence methods available on this operating system sorted by name
+func Methods() (names []string) {
+	for name := range methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Describe returns the method's description and if it requires root
+func Describe(name string) (string, bool, error) {
+	method, ok := methods[name]
+	if !ok {
+		return "", false, fmt.Errorf("%s is not a valid persistence method", name)
+	}
+	return method.Description(), method.Privileged(), nil
+}
+
+// Root returns true if the agent is running as root and can use privileged persistence methods
+func Root() bool {
+	return os.Geteuid() == 0
+}
+
+// Auto returns the first available persistence method, in the preferred order, appropriate for the agent's privileges.
+// Root prefers methods that require root and falls back to user methods.
+func Auto(preferred []string) (string, error) {
+	for _, privileged := range []bool{Root(), false} {
+		for _, name := range preferred {
+			method, ok := methods[name]
+			if !ok || method.Privileged() != privileged {
+				continue
+			}
+			if a, ok := method.(availability); ok && !a.Available() {
+				continue
+			}
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("there are no persistence methods appropriate for the agent's privileges")
+}
+
+// Install persists the command with the named method and tracks it so that it can be removed
+func Install(name, label, command string) (Record, error) {
+	method, ok := methods[strings.ToLower(name)]
+	if !ok {
+		return Record{}, fmt.Errorf("%s is not a valid persistence method", name)
+	}
+	if method.Privileged() && !Root() {
+		return Record{}, fmt.Errorf("the %s persistence method requires root", name)
+	}
+	record, err := method.Install(label, command)
+	if err != nil {
+		return Record{}, fmt.Errorf("there was an error installing %s persistence: %s", name, err)
+	}
+
+	b := make([]byte, 4)
+	if _, err = rand.Read(b); err != nil {
+		return Record{}, fmt.Errorf("there was an error generating a persistence record ID: %s", err)
+	}
+	record.ID = hex.EncodeToString(b)
+	record.Method = strings.ToLower(name)
+	record.Name = label
+	record.Command = command
+	record.Installed = time.Now().UTC()
+
+	mu.Lock()
+	records[record.ID] = record
+	mu.Unlock()
+	return record, nil
+}
+
+// Remove reverts the installed persistence and stops tracking it
+func Remove(id string) (Record, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	record, ok := records[id]
+	if !ok {
+		return Record{}, fmt.Errorf("%s is not a valid persistence record ID", id)
+	}
+	err := methods[record.Method].Remove(record)
+	if err != nil {
+		return record, fmt.Errorf("there was an error removing %s persistence: %s", record.Method, err)
+	}
+	delete(records, id)
+	return record, nil
+}
+
+// List returns every installed persistence record sorted by install time
+func List() (list []Record) {
+	mu.Lock()
+	for _, record := range records {
+		list = append(list, record)
+	}
+	mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Installed.Before(list[j].Installed) })
+	return
+}
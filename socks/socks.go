@@ -47,7 +47,9 @@ func Handler(msg jobs.Job, jobsOut *chan jobs.Job) {
 	if server == nil {
 		err := start()
 		if err != nil {
-			cli.Message(cli.WARN, err.Error())
+			if cli.Enabled {
+				cli.Message(cli.WARN, err.Error())
+			}
 			return
 		}
 	}
@@ -72,24 +74,34 @@ func Handler(msg jobs.Job, jobsOut *chan jobs.Job) {
 
 	conn, ok := connections.Load(job.ID)
 	if !ok {
-		cli.Message(cli.WARN, fmt.Sprintf("connection ID %s was not found", job.ID))
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("connection ID %s was not found", job.ID))
+		}
 		return
 	}
 
 	// If the SOCKS client has sent io.EOF to close the connection
 	if job.Close {
-		cli.Message(cli.NOTE, fmt.Sprintf("Closing SOCKS connection %s", job.ID))
+		if cli.Enabled {
+			cli.Message(cli.NOTE, fmt.Sprintf("Closing SOCKS connection %s", job.ID))
 
-		cli.Message(cli.DEBUG, fmt.Sprintf("Closing SOCKS connection %s OUTBOUND pipe", job.ID))
+			cli.Message(cli.DEBUG, fmt.Sprintf("Closing SOCKS connection %s OUTBOUND pipe", job.ID))
+		}
 		err := conn.(*Connection).Out.Close()
 		if err != nil {
-			cli.Message(cli.WARN, fmt.Sprintf("there was an error closing the SOCKS connection %s OUTBOUND pipe: %s", job.ID, err))
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("there was an error closing the SOCKS connection %s OUTBOUND pipe: %s", job.ID, err))
+			}
 		}
 
-		cli.Message(cli.DEBUG, fmt.Sprintf("Closing SOCKS connection %s INBOUND pipe", job.ID))
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("Closing SOCKS connection %s INBOUND pipe", job.ID))
+		}
 		err = conn.(*Connection).In.Close()
 		if err != nil {
-			cli.Message(cli.WARN, fmt.Sprintf("there was an error closing the SOCKS connection %s INBOUND pipe: %s", job.ID, err))
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("there was an error closing the SOCKS connection %s INBOUND pipe: %s", job.ID, err))
+			}
 		}
 
 		// Send a message back to the server, so it knows the connection has been shutdown/completed
@@ -115,22 +127,30 @@ func Handler(msg jobs.Job, jobsOut *chan jobs.Job) {
 	var buff bytes.Buffer
 	_, err := buff.Write(job.Data)
 	if err != nil {
-		cli.Message(cli.WARN, fmt.Sprintf("there was an error writing SOCKS data to the buffer: %s", err))
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error writing SOCKS data to the buffer: %s", err))
+		}
 		return
 	}
 
 	//fmt.Printf("Writing bytes to SOCKS target %X\n", job.Data)
 	n, err := conn.(*Connection).Out.Write(buff.Bytes())
 	if err != nil {
-		cli.Message(cli.WARN, fmt.Sprintf("there was an error writing data to the SOCKS %s OUTBOUND pipe: %s", job.ID, err))
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error writing data to the SOCKS %s OUTBOUND pipe: %s", job.ID, err))
+		}
 		return
 	}
-	cli.Message(cli.DEBUG, fmt.Sprintf("Wrote %d bytes to the SOCKS %s OUTBOUND pipe with error %s", n, job.ID, err))
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("Wrote %d bytes to the SOCKS %s OUTBOUND pipe with error %s", n, job.ID, err))
+	}
 }
 
 // start uses an empty SOCKS server configuration and creates a new instance
 func start() (err error) {
-	cli.Message(cli.NOTE, "Starting SOCKS5 server")
+	if cli.Enabled {
+		cli.Message(cli.NOTE, "Starting SOCKS5 server")
+	}
 	// Create SOCKS5 server
 	conf := &socks5.Config{}
 	server, err = socks5.New(conf)
@@ -142,19 +162,27 @@ func start() (err error) {
 
 // sendToSOCKSServer reads data from an incoming job and sends it to the SOCKS server which will in turn send it to the target
 func sendToSOCKSServer(id uuid.UUID) {
-	cli.Message(cli.NOTE, fmt.Sprintf("Serving new SOCKS connection ID %s", id))
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Serving new SOCKS connection ID %s", id))
+	}
 
 	connection, ok := connections.Load(id)
 	if !ok {
-		cli.Message(cli.WARN, fmt.Sprintf("connection %s not found", id))
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("connection %s not found", id))
+		}
 		return
 	}
 
-	err := server.ServeConn(connection.(*Connection).In)
+	err := serve(connection.(*Connection).In)
 	if err != nil {
-		cli.Message(cli.WARN, fmt.Sprintf("there was an error serving SOCKS connection %s: %s", id, err))
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error serving SOCKS connection %s: %s", id, err))
+		}
+	}
+	if cli.Enabled {
+		cli.Message(cli.DEBUG, fmt.Sprintf("Finished serving SOCKS connection ID %s", id))
 	}
-	cli.Message(cli.DEBUG, fmt.Sprintf("Finished serving SOCKS connection ID %s", id))
 }
 
 // receiveFromSOCKSServer continuously listens for data being returned from the SOCKS server to be sent to the agent
@@ -162,7 +190,9 @@ func receiveFromSOCKSServer(id uuid.UUID) {
 	// Listen for data on the agent-side write pipe
 	connection, ok := connections.Load(id)
 	if !ok {
-		cli.Message(cli.WARN, fmt.Sprintf("connection %s not found", id))
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("connection %s not found", id))
+		}
 		return
 	}
 
@@ -183,12 +213,16 @@ func receiveFromSOCKSServer(id uuid.UUID) {
 		data := make([]byte, 500000)
 
 		n, err := connection.(*Connection).Out.Read(data)
-		cli.Message(cli.DEBUG, fmt.Sprintf("Read %d bytes from the OUTBOUND pipe with error %s", n, err))
+		if cli.Enabled {
+			cli.Message(cli.DEBUG, fmt.Sprintf("Read %d bytes from the OUTBOUND pipe with error %s", n, err))
+		}
 
 		// Check to see if we closed the connection because we are done with it
 		fin, good := done.Load(id)
 		if !good {
-			cli.Message(cli.WARN, fmt.Sprintf("could not find connection ID %s's done map", id))
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("could not find connection ID %s's done map", id))
+			}
 		}
 
 		if fin.(bool) {
@@ -197,7 +231,9 @@ func receiveFromSOCKSServer(id uuid.UUID) {
 		}
 
 		if err != nil {
-			cli.Message(cli.WARN, fmt.Sprintf("there was an error reading from the OUTBOUND pipe: %s", err))
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("there was an error reading from the OUTBOUND pipe: %s", err))
+			}
 			return
 		}
 
@@ -0,0 +1,293 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package socks
+
+import (
+	// Standard
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+
+	// 3rd Party
+	"github.com/armon/go-socks5"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/cli"
+)
+
+// SOCKS5 protocol constants from RFC 1928 that are not exported by the go-socks5 package
+const (
+	socks5Version = uint8(5)
+	ipv4Address   = uint8(1)
+	fqdnAddress   = uint8(3)
+	ipv6Address   = uint8(4)
+	successReply  = uint8(0)
+	serverFailure = uint8(1)
+)
+
+// udpTunnelCommand is the SOCKS5 UDP tunnel (UDP over TCP) extension command used by gost and its clients.
+// The Merlin server's SOCKS listener only relays the client's TCP stream, so a standard UDP ASSOCIATE can't work
+// because the client would send its datagrams to the agent's relay address directly.
+const udpTunnelCommand = uint8(0xF3)
+
+// maxDatagram is the largest UDP payload that can be relayed
+const maxDatagram = 65507
+
+// serve negotiates the SOCKS5 method and reads the client's request so that UDP tunnel requests can be handled by
+// the agent. All other requests are replayed to the go-socks5 server.
+func serve(conn net.Conn) error {
+	bufConn := bufio.NewReader(conn)
+
+	// Version identifier/method selection message
+	greeting := []byte{0, 0}
+	if _, err := io.ReadFull(bufConn, greeting); err != nil {
+		return fmt.Errorf("there was an error reading the SOCKS version identifier message: %s", err)
+	}
+	methods := make([]byte, greeting[1])
+	if _, err := io.ReadFull(bufConn, methods); err != nil {
+		return fmt.Errorf("there was an error reading the SOCKS authentication methods: %s", err)
+	}
+	greeting = append(greeting, methods...)
+
+	// Let the go-socks5 server handle anything it would reject
+	if greeting[0] != socks5Version || !bytes.Contains(methods, []byte{socks5.NoAuth}) {
+		return server.ServeConn(&replayConn{Conn: conn, reader: io.MultiReader(bytes.NewReader(greeting), bufConn)})
+	}
+
+	// METHOD selection message
+	if _, err := conn.Write([]byte{socks5Version, socks5.NoAuth}); err != nil {
+		return fmt.Errorf("there was an error sending the SOCKS method selection message: %s", err)
+	}
+
+	// Record the request bytes so they can be replayed if this isn't a UDP tunnel request
+	var request bytes.Buffer
+	req, err := socks5.NewRequest(io.TeeReader(bufConn, &request))
+	if err != nil {
+		return fmt.Errorf("there was an error reading the SOCKS request: %s", err)
+	}
+
+	if req.Command == udpTunnelCommand {
+		return tunnel(conn, bufConn)
+	}
+
+	// The method selection message was already sent, discard the one written by the go-socks5 server
+	return server.ServeConn(&replayConn{
+		Conn:    conn,
+		reader:  io.MultiReader(bytes.NewReader(greeting), &request, bufConn),
+		discard: 2,
+	})
+}
+
+// tunnel relays the UDP datagrams carried on the client's stream until the stream is closed
+func tunnel(conn net.Conn, bufConn *bufio.Reader) error {
+	relay, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		errReply := sendReply(conn, serverFailure, nil)
+		if errReply != nil {
+			if cli.Enabled {
+				cli.Message(cli.WARN, errReply.Error())
+			}
+		}
+		return fmt.Errorf("there was an error creating the SOCKS UDP relay: %s", err)
+	}
+	defer relay.Close()
+
+	if cli.Enabled {
+		cli.Message(cli.NOTE, fmt.Sprintf("Started SOCKS UDP relay on %s", relay.LocalAddr()))
+	}
+	err = sendReply(conn, successReply, relay.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		return err
+	}
+
+	// Only datagrams from destinations the client sent to are relayed back
+	var peers sync.Map
+	go func() {
+		buf := make([]byte, maxDatagram)
+		for {
+			n, addr, errRead := relay.ReadFromUDP(buf)
+			if errRead != nil {
+				if cli.Enabled {
+					cli.Message(cli.DEBUG, fmt.Sprintf("SOCKS UDP relay %s stopped reading: %s", relay.LocalAddr(), errRead))
+				}
+				return
+			}
+			if _, ok := peers.Load(addr.String()); !ok {
+				if cli.Enabled {
+					cli.Message(cli.DEBUG, fmt.Sprintf("dropping SOCKS UDP datagram from unsolicited source %s", addr))
+				}
+				continue
+			}
+			if _, errWrite := conn.Write(datagram(addr, buf[:n])); errWrite != nil {
+				if cli.Enabled {
+					cli.Message(cli.WARN, fmt.Sprintf("there was an error writing a UDP datagram to the SOCKS client: %s", errWrite))
+				}
+				return
+			}
+		}
+	}()
+
+	for {
+		dst, data, errRead := readDatagram(bufConn)
+		if errRead == io.EOF || errRead == io.ErrClosedPipe {
+			// The tunnel terminates when the stream it arrived on terminates
+			if cli.Enabled {
+				cli.Message(cli.NOTE, fmt.Sprintf("Closing SOCKS UDP relay %s", relay.LocalAddr()))
+			}
+			return nil
+		}
+		if errRead != nil {
+			return errRead
+		}
+		if dst == nil {
+			continue
+		}
+		peers.Store(dst.String(), true)
+		if _, err = relay.WriteToUDP(data, dst); err != nil {
+			if cli.Enabled {
+				cli.Message(cli.WARN, fmt.Sprintf("there was an error sending a UDP datagram to %s: %s", dst, err))
+			}
+		}
+	}
+}
+
+// readDatagram reads one UDP tunnel datagram from the client's stream and returns its destination and data.
+// The datagram is the RFC 1928 UDP request header with the reserved field holding the length of the data.
+// A nil destination and error means the datagram was read but must be dropped.
+func readDatagram(r io.Reader) (*net.UDPAddr, []byte, error) {
+	// +----+------+------+----------+----------+----------+
+	// |RSV | FRAG | ATYP | DST.ADDR | DST.PORT |   DATA   |
+	// +----+------+------+----------+----------+----------+
+	// | 2  |  1   |  1   | Variable |    2     | Variable |
+	// +----+------+------+----------+----------+----------+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+
+	var addr []byte
+	switch header[3] {
+	case ipv4Address:
+		addr = make([]byte, net.IPv4len)
+	case ipv6Address:
+		addr = make([]byte, net.IPv6len)
+	case fqdnAddress:
+		length := []byte{0}
+		if _, err := io.ReadFull(r, length); err != nil {
+			return nil, nil, fmt.Errorf("there was an error reading the SOCKS UDP datagram domain name length: %s", err)
+		}
+		addr = make([]byte, length[0])
+	default:
+		// The length of the rest of the datagram is unknown, so the stream can't be read any further
+		return nil, nil, fmt.Errorf("unrecognized SOCKS UDP datagram address type: %d", header[3])
+	}
+
+	// Destination address, port, and data
+	rest := make([]byte, len(addr)+2+int(binary.BigEndian.Uint16(header[:2])))
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, nil, fmt.Errorf("there was an error reading the SOCKS UDP datagram: %s", err)
+	}
+	copy(addr, rest)
+	port := binary.BigEndian.Uint16(rest[len(addr) : len(addr)+2])
+	data := rest[len(addr)+2:]
+
+	// Fragmentation is optional, and implementations that don't support it must drop fragmented datagrams
+	if header[2] != 0 {
+		if cli.Enabled {
+			cli.Message(cli.WARN, "dropping fragmented SOCKS UDP datagram")
+		}
+		return nil, nil, nil
+	}
+
+	host := string(addr)
+	if header[3] != fqdnAddress {
+		host = net.IP(addr).String()
+	}
+	dst, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		if cli.Enabled {
+			cli.Message(cli.WARN, fmt.Sprintf("there was an error resolving the SOCKS UDP destination %s: %s", host, err))
+		}
+		return nil, nil, nil
+	}
+	return dst, data, nil
+}
+
+// datagram builds the UDP tunnel datagram for data received from the provided address
+func datagram(addr *net.UDPAddr, data []byte) []byte {
+	header := make([]byte, 3, 22+len(data))
+	binary.BigEndian.PutUint16(header, uint16(len(data)))
+	return append(append(header, address(addr)...), data...)
+}
+
+// address builds the RFC 1928 ATYP, ADDR, and PORT fields for the provided address
+func address(addr *net.UDPAddr) []byte {
+	var b []byte
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		b = append([]byte{ipv4Address}, ip4...)
+	} else {
+		b = append([]byte{ipv6Address}, addr.IP.To16()...)
+	}
+	return binary.BigEndian.AppendUint16(b, uint16(addr.Port))
+}
+
+// sendReply writes a SOCKS5 reply message to the client with the provided bound address, if any
+func sendReply(w io.Writer, reply uint8, addr *net.UDPAddr) error {
+	msg := []byte{socks5Version, reply, 0}
+	if addr == nil {
+		msg = append(msg, ipv4Address, 0, 0, 0, 0, 0, 0)
+	} else {
+		msg = append(msg, address(addr)...)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("there was an error sending the SOCKS reply message: %s", err)
+	}
+	return nil
+}
+
+// replayConn is a net.Conn that first returns data that was already read from the underlying connection
+type replayConn struct {
+	net.Conn
+	reader  io.Reader // reader returns the previously read data followed by the remaining connection data
+	discard int       // discard is the number of bytes written to the connection that should be dropped
+}
+
+// Read reads data from the replay reader
+func (r *replayConn) Read(b []byte) (int, error) {
+	return r.reader.Read(b)
+}
+
+// Write drops the first discard bytes and writes the remaining data to the underlying connection
+func (r *replayConn) Write(b []byte) (int, error) {
+	if r.discard > 0 {
+		if len(b) <= r.discard {
+			r.discard -= len(b)
+			return len(b), nil
+		}
+		n := r.discard
+		r.discard = 0
+		written, err := r.Conn.Write(b[n:])
+		return n + written, err
+	}
+	return r.Conn.Write(b)
+}
@@ -0,0 +1,217 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package socks
+
+import (
+	// Standard
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestReadDatagram ensures that UDP tunnel datagrams are parsed and that malformed datagrams are rejected or dropped
+func TestReadDatagram(t *testing.T) {
+	ipv4 := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+	ipv6 := &net.UDPAddr{IP: net.IPv6loopback, Port: 88}
+	fqdn := append([]byte{0, 4, 0, fqdnAddress, 9}, []byte("localhost")...)
+	fqdn = append(fqdn, 0, 123)
+	fqdn = append(fqdn, []byte("data")...)
+	fragment := datagram(ipv4, []byte("data"))
+	fragment[2] = 1
+	tests := []struct {
+		name   string
+		frame  []byte
+		dst    string
+		hasErr bool
+	}{
+		{"ipv4", datagram(ipv4, []byte("data")), "127.0.0.1:53", false},
+		{"ipv6", datagram(ipv6, []byte("data")), "[::1]:88", false},
+		{"domain name", fqdn, "127.0.0.1:123", false},
+		{"fragmented", fragment, "", false},
+		{"unknown address type", []byte{0, 4, 0, 9, 127, 0, 0, 1, 0, 53, 'd', 'a', 't', 'a'}, "", true},
+		{"truncated", datagram(ipv4, []byte("data"))[:12], "", true},
+		{"empty", []byte{}, "", true},
+	}
+	for _, test := range tests {
+		dst, data, err := readDatagram(bytes.NewReader(test.frame))
+		if test.hasErr {
+			if err == nil {
+				t.Errorf("%s: expected an error but received none", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if test.dst == "" {
+			if dst != nil {
+				t.Errorf("%s: expected the datagram to be dropped but it was sent to %s", test.name, dst)
+			}
+			continue
+		}
+		if dst == nil || dst.String() != test.dst {
+			t.Errorf("%s: expected destination %s but received %s", test.name, test.dst, dst)
+		}
+		if string(data) != "data" {
+			t.Errorf("%s: expected data but received %q", test.name, data)
+		}
+	}
+}
+
+// TestTunnel ensures that datagrams sent on a UDP tunnel stream are relayed to the destination and back
+func TestTunnel(t *testing.T) {
+	echo, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, maxDatagram)
+		for {
+			n, addr, errRead := echo.ReadFromUDP(buf)
+			if errRead != nil {
+				return
+			}
+			_, _ = echo.WriteToUDP(buf[:n], addr)
+		}
+	}()
+
+	client, agent := net.Pipe()
+	defer client.Close()
+	go func() {
+		_ = serve(agent)
+	}()
+	err = client.SetDeadline(time.Now().Add(10 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Method selection
+	if _, err = client.Write([]byte{socks5Version, 1, 0}); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 2)
+	if _, err = io.ReadFull(client, reply); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reply, []byte{socks5Version, 0}) {
+		t.Fatalf("expected the no authentication method but received %X", reply)
+	}
+
+	// UDP tunnel request
+	if _, err = client.Write([]byte{socks5Version, udpTunnelCommand, 0, ipv4Address, 0, 0, 0, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	reply = make([]byte, 4)
+	if _, err = io.ReadFull(client, reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply[1] != successReply {
+		t.Fatalf("expected a successful reply but received %X", reply)
+	}
+	bound := make([]byte, net.IPv4len+2)
+	if reply[3] == ipv6Address {
+		bound = make([]byte, net.IPv6len+2)
+	}
+	if _, err = io.ReadFull(client, bound); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := echo.LocalAddr().(*net.UDPAddr)
+	if _, err = client.Write(datagram(dst, []byte("ping"))); err != nil {
+		t.Fatal(err)
+	}
+	src, data, err := readDatagram(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.String() != dst.String() {
+		t.Errorf("expected the datagram to come from %s but received %s", dst, src)
+	}
+	if string(data) != "ping" {
+		t.Errorf("expected ping but received %q", data)
+	}
+}
+
+// TestServeConnect ensures that requests other than the UDP tunnel are replayed to the go-socks5 server
+func TestServeConnect(t *testing.T) {
+	if server == nil {
+		if err := start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, errAccept := listener.Accept()
+		if errAccept != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	}()
+
+	client, agent := net.Pipe()
+	defer client.Close()
+	go func() {
+		_ = serve(agent)
+	}()
+	err = client.SetDeadline(time.Now().Add(10 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = client.Write([]byte{socks5Version, 1, 0}); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 2)
+	if _, err = io.ReadFull(client, reply); err != nil {
+		t.Fatal(err)
+	}
+
+	// CONNECT request
+	addr := listener.Addr().(*net.TCPAddr)
+	request := append([]byte{socks5Version, 1, 0}, address(&net.UDPAddr{IP: addr.IP, Port: addr.Port})...)
+	if _, err = client.Write(request); err != nil {
+		t.Fatal(err)
+	}
+	reply = make([]byte, 10)
+	if _, err = io.ReadFull(client, reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply[0] != socks5Version || reply[1] != successReply {
+		t.Fatalf("expected a successful reply but received %X", reply)
+	}
+
+	if _, err = client.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 4)
+	if _, err = io.ReadFull(client, data); err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "ping" {
+		t.Errorf("expected ping but received %q", data)
+	}
+}
@@ -0,0 +1,96 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package staging
+
+import (
+	// Standard
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// maxInline is the largest job output, in bytes, returned inline with a job result; zero is unlimited
+var maxInline int64
+
+// spill is where items at or over the threshold are written, encrypted, instead of being held in memory
+var spill = struct {
+	sync.RWMutex
+	dir       string
+	threshold int64
+}{}
+
+// SetSpill writes staged items at or over the threshold, in bytes, to the directory encrypted by the vault instead
+// of holding them in memory. An empty directory disables spilling
+func SetSpill(dir string, threshold int64) error {
+	if threshold < 0 {
+		return fmt.Errorf("the spill threshold must be greater than or equal to zero: %d", threshold)
+	}
+	if dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return fmt.Errorf("there was an error checking the spill directory: %s", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+	}
+	spill.Lock()
+	spill.dir, spill.threshold = dir, threshold
+	spill.Unlock()
+	return nil
+}
+
+// Spill returns the directory and threshold, in bytes, for staged items written to disk
+func Spill() (string, int64) {
+	spill.RLock()
+	defer spill.RUnlock()
+	return spill.dir, spill.threshold
+}
+
+// SetLimit sets the largest job output, in bytes, returned inline with a job result. Zero disables the limit.
+func SetLimit(size int64) error {
+	if size < 0 {
+		return fmt.Errorf("the output size limit must be greater than or equal to zero: %d", size)
+	}
+	atomic.StoreInt64(&maxInline, size)
+	return nil
+}
+
+// Limit returns the largest job output, in bytes, returned inline with a job result
+func Limit() int64 {
+	return atomic.LoadInt64(&maxInline)
+}
+
+// Truncate stores output larger than the inline limit in the staging area and returns the portion of the output that
+// fits within the limit followed by instructions to retrieve the rest. Output within the limit is returned unchanged.
+func Truncate(name, output string) string {
+	limit := Limit()
+	if limit <= 0 || int64(len(output)) <= limit {
+		return output
+	}
+	id, err := Add(name, []byte(output))
+	if err != nil {
+		return output[:limit] + fmt.Sprintf("\n\n[!] output truncated at %d of %d bytes and could not be staged: %s", limit, len(output), err)
+	}
+	return output[:limit] + fmt.Sprintf(
+		"\n\n[!] output truncated at %d of %d bytes, the full output is in the staging area with ID %s\n"+
+			"Use \"staging get %s <page>\" to retrieve it in pages or \"staging download %s\" to download it as a file",
+		limit, len(output), id, id, id,
+	)
+}
@@ -0,0 +1,173 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package staging
+
+import (
+	// Standard
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	// Internal
+	"github.com/Ne0nd0g/merlin-agent/vault"
+)
+
+// DefaultPageSize is the number of bytes returned per page when a page size is not provided
+const DefaultPageSize = 1024 * 1024
+
+// Item is data held in the staging area
+type Item struct {
+	ID      string    // ID is the unique identifier used to retrieve the item
+	Name    string    // Name describes where the data came from (e.g., the command that produced it)
+	Data    []byte    // Data is the staged content, it is only populated by Get for items spilled to disk
+	Size    int       // Size is the length of the staged content
+	Created time.Time // Created is when the item was added to the staging area
+	path    string    // path is the encrypted file holding the content of an item spilled to disk
+}
+
+// items is the staging area, keyed by item ID, where the agent holds data such as oversized job output until an
+// operator retrieves or deletes it. Nothing in the staging area is written to disk unless spilling is enabled, and
+// spilled items are encrypted by the vault.
+var items = make(map[string]*Item)
+
+// mu protects the items map
+var mu sync.RWMutex
+
+// Add copies the data into the staging area and returns the item's ID
+func Add(name string, data []byte) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("there was an error generating a staging area ID: %s", err)
+	}
+	id := hex.EncodeToString(b)
+
+	item := &Item{
+		ID:      id,
+		Name:    name,
+		Size:    len(data),
+		Created: time.Now().UTC(),
+	}
+	if dir, threshold := Spill(); dir != "" && int64(len(data)) >= threshold {
+		item.path = filepath.Join(dir, id)
+		if err := vault.Write(item.path, data); err != nil {
+			return "", err
+		}
+	} else {
+		item.Data = append([]byte(nil), data...)
+	}
+	mu.Lock()
+	items[id] = item
+	mu.Unlock()
+	return id, nil
+}
+
+// Get returns the staged item for the provided ID
+func Get(id string) (Item, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	item, ok := items[id]
+	if !ok {
+		return Item{}, fmt.Errorf("%s is not a valid staging area ID", id)
+	}
+	if item.path != "" {
+		data, err := vault.Read(item.path)
+		if err != nil {
+			return Item{}, err
+		}
+		copied := *item
+		copied.Data = data
+		return copied, nil
+	}
+	return *item, nil
+}
+
+// Page returns the requested page, starting at 1, of a staged item's data and the total number of pages
+func Page(id string, page, size int) ([]byte, int, error) {
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	item, err := Get(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	pages := (len(item.Data) + size - 1) / size
+	if pages == 0 {
+		pages = 1
+	}
+	if page < 1 || page > pages {
+		return nil, pages, fmt.Errorf("page %d is out of range, %s has %d page(s)", page, id, pages)
+	}
+	end := page * size
+	if end > len(item.Data) {
+		end = len(item.Data)
+	}
+	return item.Data[(page-1)*size : end], pages, nil
+}
+
+// Delete removes a staged item and overwrites its data in memory
+func Delete(id string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	item, ok := items[id]
+	if !ok {
+		return fmt.Errorf("%s is not a valid staging area ID", id)
+	}
+	delete(items, id)
+	return wipe(item)
+}
+
+// Purge removes every staged item, overwriting data in memory and removing spilled files, and returns how many were
+// removed
+func Purge() (count int, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+	for id, item := range items {
+		if e := wipe(item); e != nil {
+			err = e
+		}
+		delete(items, id)
+		count++
+	}
+	return
+}
+
+// wipe overwrites an item's data in memory or removes its spilled file
+func wipe(item *Item) error {
+	for i := range item.Data {
+		item.Data[i] = 0
+	}
+	if item.path != "" {
+		return vault.Remove(item.path)
+	}
+	return nil
+}
+
+// List returns every item in the staging area sorted by creation time without the data of spilled items
+func List() (list []Item) {
+	mu.RLock()
+	for _, item := range items {
+		list = append(list, *item)
+	}
+	mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return
+}
@@ -0,0 +1,197 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package vault
+
+import (
+	// Standard
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// magic identifies a file written by the vault
+var magic = []byte("MLV1")
+
+// vault holds the per-agent key and the files encrypted with it. Everything the agent writes to disk for its own use
+// goes through the vault so files left behind are unreadable once the agent exits or the vault is wiped; the key
+// only exists in the agent's memory
+var vault = struct {
+	sync.Mutex
+	key   []byte
+	files map[string]int64
+}{files: make(map[string]int64)}
+
+func init() {
+	vault.key = newKey()
+}
+
+// newKey returns a random AES-256 key
+func newKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("there was an error generating the vault key: %s", err))
+	}
+	return key
+}
+
+// aead returns the AES-GCM cipher for the current key, the vault lock must be held
+func aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(vault.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Write encrypts the data with AES-256-GCM, authenticating the file path, and writes it to the file
+func Write(path string, data []byte) error {
+	vault.Lock()
+	defer vault.Unlock()
+	out, err := seal(path, data)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(path, out, 0600); err != nil {
+		return fmt.Errorf("there was an error writing the vault file %s: %s", path, err)
+	}
+	vault.files[path] = int64(len(out))
+	return nil
+}
+
+// Read decrypts a file written by the vault
+func Read(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error reading the vault file %s: %s", path, err)
+	}
+	vault.Lock()
+	defer vault.Unlock()
+	return open(path, data)
+}
+
+// Seal encrypts data the agent holds in memory with AES-256-GCM, authenticating the label, so it is only readable
+// with the vault key. Sealed data can no longer be opened once the vault is wiped
+func Seal(label string, data []byte) ([]byte, error) {
+	vault.Lock()
+	defer vault.Unlock()
+	return seal(label, data)
+}
+
+// Open decrypts data encrypted by Seal with the same label
+func Open(label string, sealed []byte) ([]byte, error) {
+	vault.Lock()
+	defer vault.Unlock()
+	return open(label, sealed)
+}
+
+// seal encrypts the data, authenticating the label, and prefixes it with the magic and nonce; the vault lock must be
+// held
+func seal(label string, data []byte) ([]byte, error) {
+	gcm, err := aead()
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating the vault cipher: %s", err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("there was an error generating a vault nonce: %s", err)
+	}
+	return append(append(append([]byte(nil), magic...), nonce...), gcm.Seal(nil, nonce, data, []byte(label))...), nil
+}
+
+// open decrypts data encrypted by seal with the same label; the vault lock must be held
+func open(label string, data []byte) ([]byte, error) {
+	gcm, err := aead()
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating the vault cipher: %s", err)
+	}
+	if len(data) < len(magic)+gcm.NonceSize() || !bytes.Equal(data[:len(magic)], magic) {
+		return nil, fmt.Errorf("%s is not encrypted by the vault", label)
+	}
+	data = data[len(magic):]
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(label))
+	if err != nil {
+		return nil, fmt.Errorf("there was an error decrypting %s: %s", label, err)
+	}
+	return plain, nil
+}
+
+// Remove overwrites and deletes a file written by the vault
+func Remove(path string) error {
+	vault.Lock()
+	defer vault.Unlock()
+	delete(vault.files, path)
+	return shred(path)
+}
+
+// Files returns the paths of the files the vault has written that have not been removed
+func Files() (files []string) {
+	vault.Lock()
+	defer vault.Unlock()
+	for path := range vault.files {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return
+}
+
+// Wipe overwrites and deletes every file the vault has written and replaces the key so any copy of the files that
+// was missed can no longer be decrypted. It returns the files that were removed
+func Wipe() (removed []string, err error) {
+	vault.Lock()
+	defer vault.Unlock()
+	for path := range vault.files {
+		if e := shred(path); e != nil && !os.IsNotExist(e) {
+			err = fmt.Errorf("there was an error wiping %s: %s", path, e)
+			continue
+		}
+		removed = append(removed, path)
+		delete(vault.files, path)
+	}
+	for i := range vault.key {
+		vault.key[i] = 0
+	}
+	vault.key = newKey()
+	sort.Strings(removed)
+	return
+}
+
+// shred overwrites the file with random data before deleting it
+func shred(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		_, err = io.CopyN(f, rand.Reader, info.Size())
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}